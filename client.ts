@@ -1,4 +1,5 @@
-import { randomUUID } from "node:crypto";
+import { exec, spawn, type ChildProcess } from "node:child_process";
+import { createHash, randomUUID } from "node:crypto";
 import { Buffer } from "node:buffer";
 import { stdin, stdout } from "node:process";
 import { createInterface } from "node:readline/promises";
@@ -8,6 +9,9 @@ import * as http from "node:http";
 import * as https from "node:https";
 import net from "node:net";
 import os from "node:os";
+import path from "node:path";
+import { fileURLToPath } from "node:url";
+import { format, promisify } from "node:util";
 import player from "play-sound";
 
 // Parse command line arguments
@@ -46,8 +50,177 @@ const CONTROL_HOST = process.env.CLIENT_HTTP_HOST ?? "127.0.0.1";
 const CONTROL_PORT = Number.parseInt(process.env.CLIENT_HTTP_PORT ?? "4455", 10);
 const CONTROL_SOCKET_PORT = Number.parseInt(process.env.CLIENT_SOCKET_PORT ?? String(CONTROL_PORT), 10);
 
+// Socket protocol revision and the actions beyond the original set that
+// this hub handles; clients gate newer features on these.
+const SOCKET_PROTOCOL_VERSION = 1;
+const SOCKET_CAPABILITIES: string[] = ["chunked-upload", "playback", "now-playing", "peer-files", "audio-stream", "subscribe", "logs", "idempotency-keys", "binary-frames", "tags", "delete", "storage", "broadcast-plan", "audit", "clipboard", "kv", "chat", "broadcast-image", "command-stream", "jobs", "peer-ping", "peer-control", "peer-config", "zones", "sync-play", "broadcast-stop", "normalize", "stats", "move", "trash", "temporary-uploads", "direct-transfer"];
+// Framings a client may switch to with a "framing" request. Newline-delimited
+// JSON is the default; "length-prefixed" is a 4-byte big-endian length then
+// the JSON. A length with the top bit set is a binary frame: a 4-byte header
+// length, the JSON header, then raw bytes standing in for the member the
+// header's "binary" names.
+const SOCKET_PROTOCOLS: string[] = ["length-prefixed"];
+// Codecs a client may switch to in the same framing request; they need
+// length-prefixed frames.
+const SOCKET_CODECS: string[] = ["cbor"];
+// Role given to socket clients: "read-only" may only look, "operator" may
+// also play, broadcast, upload and tag, and "admin" may also delete.
+const SOCKET_ROLE = process.env.CLIENT_SOCKET_ROLE ?? "admin";
+const READ_ACTIONS = new Set([
+  "status", "files", "storage", "broadcast-plan", "framing", "bye", "command", "tags",
+  "audit", "kv-get", "kv-watch", "chat-history", "command-start", "command-cancel", "jobs",
+  "peer-ping", "peer-config", "zones", "clock", "stats", "trash", "peer-files", "peer-files-response",
+  "subscribe", "logs",
+]);
+const ADMIN_ACTIONS = new Set(["delete", "move", "restore", "purge", "peer-restart", "peer-update"]);
+const READ_COMMANDS = new Set(["help", "peers", "whoami", "get", "keys", "ttl", "audit", "stats"]);
+const READ_AUDIO_COMMANDS = new Set(["list", "get", "usage"]);
+const MAX_SOCKET_FRAME = 64 * 1024 * 1024;
+const BINARY_FRAME_FLAG = 0x80000000;
+
 const socketClients = new Set<net.Socket>();
-const socketBuffers = new Map<net.Socket, string>();
+// Key prefixes each socket asked to watch with kv-watch.
+const kvWatches = new Map<net.Socket, string[]>();
+// What each socket narrowed its events to with subscribe: the event names
+// it still gets, all when unset, and the timer pushing it status.
+const subscriptions = new Map<net.Socket, { events?: Set<string>; statusTimer?: NodeJS.Timeout }>();
+// MIN_STATUS_INTERVAL_SECONDS keeps a subscriber from asking for status
+// faster than the hub can be asked for it.
+const MIN_STATUS_INTERVAL_SECONDS = 1;
+// Relays to another peer's socket clients waiting for its answer, by
+// requestId, and the relayed requests this peer's own socket clients are
+// answering, with the peer each answer goes back to.
+const peerRelays = new Map<string, { resolve: (reply: Record<string, unknown>) => void; timer: NodeJS.Timeout }>();
+const relayedRequests = new Map<string, string>();
+// PEER_RELAY_TIMEOUTS bound the wait for a peer's socket clients to
+// answer: a listing is quick, an upload of a shared file may not be.
+const PEER_RELAY_TIMEOUTS: Record<string, number> = { "peer-files": 15_000, "peer-upload": 5 * 60_000 };
+// MAX_AUDIO_CHUNK_BASE64 bounds one intercom chunk; the GTK client sends
+// 100ms of 16 kHz mono, a little over 4 KiB once encoded.
+const MAX_AUDIO_CHUNK_BASE64 = 256 * 1024;
+// Chunked uploads in progress, by uploadId: what upload-begin declared and
+// the temporary file the chunks so far went to. They outlive the socket so
+// a client can resume after reconnecting; one left idle for
+// CHUNKED_UPLOAD_IDLE_MS is dropped.
+type ChunkedUpload = {
+  filename: string;
+  size: number;
+  sha256?: string;
+  contentType?: string;
+  metadata?: Record<string, unknown>;
+  temporary?: TemporaryUpload;
+  tempPath: string;
+  offset: number;
+  idle: NodeJS.Timeout;
+};
+const chunkedUploads = new Map<string, ChunkedUpload>();
+const CHUNKED_UPLOAD_IDLE_MS = 60 * 60_000;
+// A temporary upload goes after ttlSeconds, which the worker enforces, or
+// when the socket that made it disconnects. disconnectUploads holds the
+// latter by socket; the worker also removes them if this client leaves.
+type TemporaryUpload = { ttlSeconds?: number; deleteOnDisconnect?: boolean };
+const disconnectUploads = new Map<net.Socket, Set<string>>();
+// Console commands started with command-start, by id, with the socket
+// that gets their output. COMMAND_SLOTS of them run at once; the rest
+// wait, highest priority first, and are listed by "jobs".
+const COMMAND_SLOTS = 2;
+type StartedCommand = {
+  id: string;
+  socket: net.Socket;
+  command: string;
+  priority: number;
+  seq: number;
+  createdAt: string;
+  running: boolean;
+  cancelled: boolean;
+};
+const runningCommands = new Map<string, StartedCommand>();
+let commandSeq = 0;
+// ownVolume is the volume, a percentage, the hub stores for this peer;
+// broadcasts play at the player's own level while it is unset.
+let ownVolume: number | undefined;
+// clockOffsetMs is how far the hub's clock runs ahead of this machine's,
+// from the clock sample with the shortest round trip, clockRttMs.
+let clockOffsetMs = 0;
+let clockRttMs = 0;
+// Clock offsets drift, so they are measured again every
+// CLOCK_SYNC_INTERVAL_MS from CLOCK_SAMPLES round trips.
+const CLOCK_SYNC_INTERVAL_MS = 60_000;
+const CLOCK_SAMPLES = 5;
+// activePlayers are the players running now, so a broadcast-stop can end
+// them; it also bumps playbackEpoch, which ends loops between repeats and
+// plays still downloading.
+const activePlayers = new Set<ChildProcess>();
+let playbackEpoch = 0;
+// Playing is the file this peer started last, which pause, resume, seek
+// and volume act on. position is where it was at since, in seconds; while
+// paused it holds still.
+type Playing = {
+  filename: string;
+  tempPath: string;
+  loop: boolean;
+  gain?: number;
+  // volume is a level set with a volume request, for this file only
+  volume?: number;
+  // triggeredBy is the peer whose play or broadcast-play started it
+  triggeredBy?: string;
+  duration?: number;
+  position: number;
+  since: number;
+  paused: boolean;
+  child?: ChildProcess;
+  // run counts player starts, so a player ended for a seek or a volume
+  // change does not end the play
+  run: number;
+  epoch: number;
+  cleanup: () => void;
+};
+let playing: Playing | undefined;
+// NowPlaying is what a peer reports in now-playing events, as the Go
+// clients read it.
+type NowPlaying = {
+  peer: string;
+  filename: string;
+  position: number;
+  duration?: number;
+  state: "playing" | "paused" | "stopped" | "ended";
+  triggeredBy?: string;
+  volume?: number;
+  loop?: boolean;
+};
+// peersPlaying is the last now-playing heard from each peer still
+// playing, and when, for the status snapshot.
+const peersPlaying = new Map<string, { np: NowPlaying; at: number }>();
+// MP3_FRAME_SECONDS is the length of one MPEG-1 Layer III frame at 44.1
+// kHz, which mpg123 and mpg321 count their start offset in.
+const MP3_FRAME_SECONDS = 1152 / 44100;
+const socketBuffers = new Map<net.Socket, Buffer>();
+const framedSockets = new Set<net.Socket>();
+const cborSockets = new Set<net.Socket>();
+// Console lines are kept, the last LOG_HISTORY of them, for the logs
+// action, and pushed to sockets as log events as they are written.
+type LogEntry = { time: string; level: string; message: string; source: string };
+const LOG_HISTORY = 1000;
+const LOG_LEVELS = ["debug", "info", "warn", "error"];
+const logHistory: LogEntry[] = [];
+// pushingLog stops a failed send, which logs, from pushing its own line.
+let pushingLog = false;
+for (const [method, level] of [["debug", "debug"], ["log", "info"], ["info", "info"], ["warn", "warn"], ["error", "error"]] as const) {
+  const original = console[method].bind(console);
+  console[method] = (...args: unknown[]) => {
+    original(...args);
+    const entry = { time: new Date().toISOString(), level, message: format(...args), source: "client" };
+    logHistory.push(entry);
+    if (logHistory.length > LOG_HISTORY) logHistory.shift();
+    if (pushingLog) return;
+    pushingLog = true;
+    try {
+      broadcastSocketEvent("log", entry);
+    } finally {
+      pushingLog = false;
+    }
+  };
+}
 
 type ClientDescriptor = {
   id: string;
@@ -56,6 +229,24 @@ type ClientDescriptor = {
 };
 
 class Client extends RpcTarget {
+  // ping is the hub checking this peer is there, or relaying a peer-ping
+  // from another client to run from here.
+  ping(peer?: string) {
+    return peer ? pingPeer(peer) : { pong: true };
+  }
+
+  // control is the hub asking this peer to restart, after updating it for
+  // "update"; it answers before going down so the hub hears the result.
+  async control(action: string, progress: (phase: string, message?: string) => unknown) {
+    if (action === "update") {
+      await progress("updating", `running ${UPDATE_COMMAND}`);
+      const output = await runUpdate();
+      if (output) await progress("updating", output);
+    }
+    console.log(`🔁 Restarting for a peer-${action} request`);
+    setTimeout(restartSelf, RESTART_DELAY_MS);
+  }
+
   broadcast(message: unknown) {
     if (isBenchmarkRequest(message)) {
       void respondToBenchmark(message);
@@ -75,6 +266,8 @@ class Client extends RpcTarget {
             from: msg.from ?? descriptor.id,
             timestamp: msg.timestamp ?? new Date().toISOString(),
             self: true,
+            startAt: syncStartAt(msg.startAt),
+            gain: msg.gain,
           });
           return;
         }
@@ -84,16 +277,119 @@ class Client extends RpcTarget {
           from: msg.from ?? null,
           timestamp: msg.timestamp ?? new Date().toISOString(),
           self: false,
+          startAt: syncStartAt(msg.startAt),
+          gain: msg.gain,
         });
         // Construct the audio URL based on our host
         const httpHost = host.replace(/^ws/, 'http');
         const audioUrl = `${httpHost}/audio/${msg.filename}`;
         // Play the audio asynchronously
-        playAudio(audioUrl, msg.filename).catch(err => {
+        const startAt = typeof msg.startAt === "number" ? msg.startAt : undefined;
+        const gain = typeof msg.gain === "number" ? msg.gain : undefined;
+        const from = typeof msg.from === "string" ? msg.from : undefined;
+        playAudio(audioUrl, msg.filename, startAt, msg.loop === true, gain, from).catch(err => {
           console.error(`Failed to play broadcasted audio: ${err}`);
         });
         return;
       }
+      if (msg.type === "stop-audio") {
+        const stopped = stopPlayback();
+        console.log(`⏹ Playback stopped by ${msg.from || 'unknown'} (${stopped} player(s))`);
+        broadcastSocketEvent('broadcast-stop', {
+          from: msg.from ?? null,
+          timestamp: msg.timestamp ?? new Date().toISOString(),
+          self: msg.from === descriptor.id,
+        });
+        return;
+      }
+      if ((msg.type === "peer-files-request" || msg.type === "peer-upload-request") &&
+          typeof msg.requestId === "string" && typeof msg.from === "string") {
+        takeRelayedRequest(msg.type === "peer-files-request" ? "peer-files" : "peer-upload", msg);
+        return;
+      }
+      if ((msg.type === "peer-files-response" || msg.type === "peer-upload-response") && typeof msg.requestId === "string") {
+        const relay = peerRelays.get(msg.requestId);
+        if (relay) {
+          clearTimeout(relay.timer);
+          peerRelays.delete(msg.requestId);
+          relay.resolve(msg.reply && typeof msg.reply === "object" ? msg.reply : {});
+        }
+        return;
+      }
+      if ((msg.type === "transfer-offer" || msg.type === "transfer-answer" || msg.type === "transfer-cancel") &&
+          typeof msg.transferId === "string") {
+        // the hub only sends these to the peer they are for
+        const { type: _type, ...payload } = msg;
+        broadcastSocketEvent(msg.type, payload);
+        return;
+      }
+      if (msg.type === "audio-stream" && typeof msg.streamId === "string") {
+        const { type: _type, ...chunk } = msg;
+        broadcastSocketEvent("audio-stream", { ...chunk, self: msg.from === descriptor.id });
+        return;
+      }
+      if (msg.type === "now-playing" && msg.nowPlaying && typeof msg.nowPlaying.peer === "string") {
+        // this peer told its own sockets when it announced
+        if (msg.from !== descriptor.id) recordNowPlaying(msg.nowPlaying, false);
+        return;
+      }
+      if (msg.type === "playback-control" && typeof msg.action === "string") {
+        const value = typeof msg.value === "number" ? msg.value : undefined;
+        try {
+          const acted = applyPlayback(msg.action, value);
+          console.log(`⏯ ${msg.action} from ${msg.from || 'unknown'}${acted ? '' : ' (nothing playing)'}`);
+        } catch (error) {
+          console.warn(`⏯ ${msg.action} from ${msg.from || 'unknown'} failed: ${error instanceof Error ? error.message : String(error)}`);
+        }
+        return;
+      }
+      if (msg.type === "clipboard" && typeof msg.text === "string") {
+        broadcastSocketEvent('clipboard', {
+          text: msg.text,
+          from: msg.from ?? null,
+          timestamp: msg.timestamp ?? new Date().toISOString(),
+          self: msg.from === descriptor.id,
+        });
+        return;
+      }
+      if (msg.type === "show-image" && typeof msg.filename === "string") {
+        broadcastSocketEvent('broadcast-image', {
+          filename: msg.filename,
+          caption: msg.caption ?? undefined,
+          contentType: msg.contentType ?? undefined,
+          size: typeof msg.size === "number" ? msg.size : undefined,
+          from: msg.from ?? null,
+          timestamp: msg.timestamp ?? new Date().toISOString(),
+          self: msg.from === descriptor.id,
+        });
+        return;
+      }
+      if (msg.type === "chat" && msg.message && typeof msg.message.text === "string") {
+        broadcastSocketEvent('chat', msg.message);
+        return;
+      }
+      if (msg.type === "chat-typing" && typeof msg.channel === "string") {
+        // the typer's own client does not show it typing
+        if (msg.from !== descriptor.id) {
+          broadcastSocketEvent('chat-typing', { channel: msg.channel, from: msg.from ?? "unknown" });
+        }
+        return;
+      }
+      if (msg.type === "peer-config-changed" && msg.config && typeof msg.config.peer === "string") {
+        if (msg.config.peer === descriptor.id) {
+          ownVolume = typeof msg.config.volume === "number" ? msg.config.volume : undefined;
+        }
+        broadcastSocketEvent('peer-config', msg.config);
+        return;
+      }
+      if (msg.type === "zone-changed" && msg.zone && typeof msg.zone.name === "string") {
+        broadcastSocketEvent('zone', msg.zone);
+        return;
+      }
+      if (msg.type === "kv-changed" && msg.entry && typeof msg.entry.key === "string") {
+        sendKvEvent(msg.entry);
+        return;
+      }
       if (msg.type === "mapreduce-task") {
         void handleMapReduceTask(msg);
         return;
@@ -113,8 +409,28 @@ class Client extends RpcTarget {
 
 type HubApi = {
   addClient(stub: Client, descriptor: ClientDescriptor): Promise<number>;
-  broadcast(message: unknown): Promise<number>;
-  runCommand(command: string, clientId?: string): Promise<unknown>;
+  broadcast(message: unknown, to?: string[]): Promise<number>;
+  runCommand(command: string, clientId?: string, output?: (text: string) => void): Promise<unknown>;
+  recordAudit(actor: string, action: string, target?: string): Promise<void>;
+  clock(): Promise<number>;
+  syncStart(): Promise<number>;
+  pingPeer(peer: string, from?: string): Promise<PeerPing>;
+  controlPeer(
+    peer: string,
+    action: "restart" | "update",
+    from: string,
+    progress: (phase: string, message?: string) => void,
+  ): Promise<void>;
+  transferOffer(from: string, to: string, offer: Record<string, unknown>): Promise<{ transferId?: string; error?: string; code?: string }>;
+  transferSignal(kind: string, from: string, transferId: string, fields: Record<string, unknown>): Promise<{ error?: string; code?: string }>;
+};
+
+type PeerPing = {
+  peer: string;
+  from?: string;
+  reachable: boolean;
+  latencyMs?: number;
+  error?: string;
 };
 
 type SocketRequest = {
@@ -153,13 +469,17 @@ function isBenchmarkRequest(message: unknown): message is BenchmarkRequestPayloa
 
 const api = newWebSocketRpcSession<HubApi>(host);
 const descriptor: ClientDescriptor = {
-  id: randomUUID(),
+  // a restart keeps the id, so the hub and peers see the same node return
+  id: process.env.BRAIN_CLIENT_ID || randomUUID(),
   joinedAt: new Date().toISOString(),
   vector: Array.from({ length: 3 }, () => Number.parseFloat(Math.random().toFixed(3))),
 };
 
 const client = new Client();
 const total = await api.addClient(client, descriptor);
+void loadOwnVolume();
+void measureClock();
+setInterval(() => void measureClock(), CLOCK_SYNC_INTERVAL_MS).unref();
 console.log(`Connected to: ${host}`);
 console.log(`Connected clients: ${total}`);
 console.log('Commands available: type "help"; "exit" to quit.');
@@ -320,8 +640,263 @@ async function handleMapReduceTask(task: any) {
   }
 }
 
-// Audio playback function
-async function playAudio(url: string, filename: string) {
+async function loadOwnVolume() {
+  try {
+    const { configs } = await peerConfigPayload();
+    const own = configs.find((c) => c.peer === descriptor.id);
+    ownVolume = typeof own?.volume === "number" ? own.volume : undefined;
+  } catch (error) {
+    console.warn(`Failed to load peer settings: ${error instanceof Error ? error.message : String(error)}`);
+  }
+}
+
+// measureClock samples the hub's clock and keeps the offset from the
+// quickest round trip, whose midpoint guess is the most accurate.
+async function measureClock() {
+  let best: { offset: number; rtt: number } | undefined;
+  for (let i = 0; i < CLOCK_SAMPLES; i++) {
+    try {
+      const sent = Date.now();
+      const hubNow = await api.clock();
+      const received = Date.now();
+      const rtt = received - sent;
+      if (!best || rtt < best.rtt) best = { offset: hubNow - (sent + received) / 2, rtt };
+    } catch (error) {
+      console.warn(`Clock sample failed: ${error instanceof Error ? error.message : String(error)}`);
+      return;
+    }
+  }
+  if (best) {
+    clockOffsetMs = best.offset;
+    clockRttMs = best.rtt;
+  }
+}
+
+// hubNow is the hub's time as this machine estimates it.
+function hubNow() {
+  return Date.now() + clockOffsetMs;
+}
+
+// syncStartAt gives a synchronized start, in hub time, as this machine's
+// time for socket clients, or undefined for an unsynchronized broadcast.
+function syncStartAt(startAt: unknown) {
+  return typeof startAt === "number" ? new Date(startAt - clockOffsetMs).toISOString() : undefined;
+}
+
+// playerVolumeOptions passes volume to whichever player play-sound picks.
+function playerVolumeOptions(volume: number): Record<string, string[]> {
+  const scale = volume / 100;
+  return {
+    afplay: ["-v", String(scale)],
+    mplayer: ["-volume", String(volume)],
+    mpv: [`--volume=${volume}`],
+    ffplay: ["-volume", String(volume)],
+    mpg123: ["-f", String(Math.round(32768 * scale))],
+    mpg321: ["-g", String(volume)],
+    play: ["-v", String(scale)],
+    cvlc: ["--gain", String(scale)],
+  };
+}
+
+// playerSeekOptions starts whichever player play-sound picks offset
+// seconds in. Players missing here cannot start part way through.
+function playerSeekOptions(offset: number): Record<string, string[]> {
+  const seconds = offset.toFixed(1);
+  const frames = String(Math.round(offset / MP3_FRAME_SECONDS));
+  return {
+    mplayer: ["-ss", seconds],
+    mpv: [`--start=${seconds}`],
+    ffplay: ["-ss", seconds],
+    mpg123: ["-k", frames],
+    mpg321: ["-k", frames],
+    cvlc: [`--start-time=${seconds}`],
+  };
+}
+
+function canSeek() {
+  return player().player in playerSeekOptions(0);
+}
+
+function playerOptions(volume: number | undefined, offset: number) {
+  const options: Record<string, string[]> = volume === undefined ? {} : playerVolumeOptions(volume);
+  if (offset > 0) {
+    for (const [name, args] of Object.entries(playerSeekOptions(offset))) {
+      options[name] = [...(options[name] ?? []), ...args];
+    }
+  }
+  return options;
+}
+
+// playbackVolume is the volume a file plays at: level, else the hub's
+// stored volume for this peer, scaled by a ReplayGain in dB. Players are
+// not driven past full volume, so quiet files are raised only that far.
+function playbackVolume(gain?: number, level = ownVolume) {
+  if (gain === undefined) return level;
+  return Math.min(100, Math.round((level ?? 100) * Math.pow(10, gain / 20)));
+}
+
+// normalizedGain is the ReplayGain a normalized play of a file applies,
+// or undefined when its uploader did not measure its loudness.
+function normalizedGain(info: any): number | undefined {
+  return typeof info?.loudness === "number" && typeof info?.replayGain === "number" ? info.replayGain : undefined;
+}
+
+function playingPosition(p: Playing) {
+  const position = p.position + (p.paused ? 0 : (Date.now() - p.since) / 1000);
+  if (p.duration === undefined) return position;
+  return p.loop ? position % p.duration : Math.min(position, p.duration);
+}
+
+// endPlayer kills a player; a paused one is continued first, or the
+// signal would wait until it was.
+function endPlayer(child: ChildProcess) {
+  activePlayers.delete(child);
+  child.kill("SIGCONT");
+  child.kill();
+}
+
+// stopPlayback ends every running player and any loop, and returns how
+// many players it ended.
+function stopPlayback() {
+  playbackEpoch++;
+  const p = playing;
+  playing = undefined;
+  if (p) announcePlaying(p, "stopped");
+  const stopped = activePlayers.size;
+  for (const child of [...activePlayers]) endPlayer(child);
+  // a player ended while paused for a seek leaves nothing to clean up after
+  if (p && !p.child) p.cleanup();
+  return stopped;
+}
+
+// startPlayer plays p from offset seconds in.
+function startPlayer(p: Playing, offset: number) {
+  const run = ++p.run;
+  const audioPlayer = player();
+  const options = playerOptions(playbackVolume(p.gain, p.volume), offset);
+  p.position = offset;
+  p.since = Date.now();
+  p.paused = false;
+  const child: ChildProcess = audioPlayer.play(p.tempPath, options, (err: any) => {
+    activePlayers.delete(child);
+    if (run !== p.run) return;
+    p.child = undefined;
+    if (err) {
+      console.error(p.epoch === playbackEpoch ? 'Error playing audio:' : '   Playback stopped', err);
+    } else {
+      console.log('   Playback finished');
+      if (p.loop && p.epoch === playbackEpoch) {
+        startPlayer(p, 0);
+        return;
+      }
+    }
+    if (playing === p) {
+      playing = undefined;
+      announcePlaying(p, err ? "stopped" : "ended");
+    }
+    p.cleanup();
+  });
+  p.child = child;
+  activePlayers.add(child);
+}
+
+// restartPlayer moves p to offset by starting its player again there; a
+// paused p stays paused and starts there on resume.
+function restartPlayer(p: Playing, offset: number) {
+  p.run++;
+  if (p.child) endPlayer(p.child);
+  p.child = undefined;
+  if (p.paused) {
+    p.position = offset;
+    return;
+  }
+  startPlayer(p, offset);
+}
+
+// applyPlayback runs a transport action on this peer's playback, and
+// returns whether there was playback for it to act on.
+function applyPlayback(action: string, value?: number) {
+  if (action === "stop") return stopPlayback() > 0;
+  const p = playing;
+  if (!p) return false;
+  switch (action) {
+    case "pause":
+      if (p.paused) break;
+      p.position = playingPosition(p);
+      p.paused = true;
+      p.child?.kill("SIGSTOP");
+      break;
+    case "resume":
+      if (!p.paused) break;
+      if (!p.child) {
+        startPlayer(p, p.position);
+        break;
+      }
+      p.since = Date.now();
+      p.paused = false;
+      p.child.kill("SIGCONT");
+      break;
+    case "seek":
+      if (!canSeek()) throw new SocketError("invalid", `${player().player} cannot seek`);
+      restartPlayer(p, Math.max(0, value ?? 0));
+      break;
+    case "volume":
+      p.volume = value;
+      if (canSeek()) {
+        restartPlayer(p, playingPosition(p));
+      } else {
+        console.log(`   ${player().player} cannot change volume mid-play; ${value}% applies to the next play`);
+      }
+      break;
+  }
+  announcePlaying(p, p.paused ? "paused" : "playing");
+  return true;
+}
+
+// announcePlaying tells this client's sockets, and through the hub every
+// other peer, what this peer is playing now.
+function announcePlaying(p: Playing, state: NowPlaying["state"]) {
+  const np: NowPlaying = {
+    peer: descriptor.id,
+    filename: p.filename,
+    position: playingPosition(p),
+    duration: p.duration,
+    state,
+    triggeredBy: p.triggeredBy,
+    volume: playbackVolume(p.gain, p.volume),
+    ...(p.loop && { loop: true }),
+  };
+  recordNowPlaying(np, true);
+  api.broadcast({ type: "now-playing", nowPlaying: np, from: descriptor.id }).catch((error) => {
+    console.warn(`Failed to announce now playing: ${error instanceof Error ? error.message : String(error)}`);
+  });
+}
+
+function recordNowPlaying(np: NowPlaying, self: boolean) {
+  if (np.state === "playing" || np.state === "paused") {
+    peersPlaying.set(np.peer, { np, at: Date.now() });
+  } else {
+    peersPlaying.delete(np.peer);
+  }
+  broadcastSocketEvent("now-playing", { ...np, self });
+}
+
+// nowPlayingList is every peer's playback for the status snapshot, each
+// position moved on to now.
+function nowPlayingList() {
+  const now = Date.now();
+  return [...peersPlaying.values()].map(({ np, at }) => {
+    let position = np.position + (np.state === "playing" ? (now - at) / 1000 : 0);
+    if (np.duration !== undefined) position = np.loop ? position % np.duration : Math.min(position, np.duration);
+    return { ...np, position, self: np.peer === descriptor.id };
+  });
+}
+
+// Audio playback function; with startAt, a hub time, playback waits for
+// it after the download so synchronized peers start together. With loop
+// it repeats until a broadcast-stop, and gain, in dB, normalizes it.
+async function playAudio(url: string, filename: string, startAt?: number, loop = false, gain?: number, triggeredBy?: string) {
+  const epoch = playbackEpoch;
   console.log(`🎵 Downloading and playing: ${filename}`);
   console.log(`   URL: ${url}`);
   
@@ -348,30 +923,82 @@ async function playAudio(url: string, filename: string) {
     });
     
     console.log(`   Downloaded to: ${tempPath}`);
-    
-    // Play the audio file
-    const audioPlayer = player();
-    audioPlayer.play(tempPath, (err: any) => {
-      if (err) {
-        console.error('Error playing audio:', err);
+    // the duration lets seeks and positions stay inside the file
+    const info = await getAudioInfo(filename).catch(() => undefined);
+    if (startAt !== undefined) {
+      const wait = startAt - hubNow();
+      if (wait > 0) {
+        await new Promise((resolve) => setTimeout(resolve, wait));
       } else {
-        console.log('   Playback finished');
+        console.warn(`   Starting ${Math.round(-wait)} ms late for a synchronized start`);
       }
-      
-      // Clean up temp file
+    }
+    
+    // Clean up temp file
+    const cleanup = () => {
       try {
         fs.unlinkSync(tempPath);
         console.log('   Cleaned up temporary file');
       } catch (cleanupErr) {
         console.warn('   Failed to clean up temp file:', cleanupErr);
       }
-    });
+    };
+    if (epoch !== playbackEpoch) {
+      console.log('   Stopped before it started');
+      cleanup();
+      return;
+    }
+
+    // Play the audio file, at the volume the hub stores for this peer
+    const volume = playbackVolume(gain);
+    if (volume !== undefined) console.log(`   Volume: ${volume}%`);
+    if (gain !== undefined) console.log(`   ReplayGain: ${gain.toFixed(1)} dB`);
+    if (loop) console.log('   Looping until stopped');
+    const duration = typeof info?.duration === "number" && info.duration > 0 ? info.duration : undefined;
+    // a file paused and then moved has no player left to clean up after it
+    if (playing && !playing.child) playing.cleanup();
+    playing = { filename, tempPath, loop, gain, triggeredBy, duration, position: 0, since: Date.now(), paused: false, run: 0, epoch, cleanup };
+    startPlayer(playing, 0);
+    announcePlaying(playing, "playing");
     
   } catch (error) {
     console.error('Failed to play audio:', error);
   }
 }
 
+// playbackPayload runs a volume, pause, resume, stop or seek request, on
+// this client's playback or, with broadcast, on every peer's; this client
+// hears its own broadcast from the hub like the rest.
+async function playbackPayload(action: string, request: Record<string, unknown>) {
+  let value: number | undefined;
+  if (action === "volume") {
+    value = request.volume as number;
+    if (typeof value !== "number" || !Number.isInteger(value) || value < 0 || value > 100) {
+      throw new SocketError("invalid", "volume must be an integer from 0 to 100");
+    }
+  } else if (action === "seek") {
+    value = request.position as number;
+    if (typeof value !== "number" || !Number.isFinite(value) || value < 0) {
+      throw new SocketError("invalid", "position must be a number of seconds");
+    }
+  }
+  if (request.broadcast === true) {
+    const message = {
+      type: "playback-control",
+      action,
+      ...(value !== undefined && { value }),
+      from: descriptor.id,
+      timestamp: new Date().toISOString(),
+    };
+    const recipients = await api.broadcast(message);
+    return { recipients };
+  }
+  if (!applyPlayback(action, value)) {
+    throw new SocketError("not-found", "nothing is playing");
+  }
+  return {};
+}
+
 // Main command loop
 
 try {
@@ -490,8 +1117,26 @@ async function safeRunCommand(command: string) {
   }
 }
 
+// localAddresses lists this machine's non-loopback addresses, so peers can
+// be told where to reach it.
+function localAddresses() {
+  const addresses: string[] = [];
+  for (const entries of Object.values(os.networkInterfaces())) {
+    for (const entry of entries ?? []) {
+      if (!entry.internal) addresses.push(entry.address);
+    }
+  }
+  return addresses;
+}
+
 async function getStatusPayload() {
-  const whoami = await safeRunCommand("whoami");
+  const whoami = {
+    ...((await safeRunCommand("whoami")) as Record<string, unknown>),
+    id: descriptor.id,
+    name: os.hostname(),
+    capabilities: SOCKET_CAPABILITIES,
+    addresses: localAddresses(),
+  };
   const audioList = await safeRunCommand("audio list");
   return {
     host,
@@ -500,6 +1145,7 @@ async function getStatusPayload() {
     timestamp: new Date().toISOString(),
     whoami,
     audioList,
+    nowPlaying: nowPlayingList(),
   };
 }
 
@@ -508,47 +1154,641 @@ async function commandPayload(command: string) {
   return { result };
 }
 
-async function playPayload(filename: string) {
+// startCommand queues command for socket, streaming its output as
+// command-output events and ending with a command-done event.
+function startCommand(socket: net.Socket, command: string) {
+  const id = randomUUID();
+  runningCommands.set(id, {
+    id,
+    socket,
+    command,
+    priority: 0,
+    seq: ++commandSeq,
+    createdAt: new Date().toISOString(),
+    running: false,
+    cancelled: false,
+  });
+  // after the command-start answer has gone out
+  setImmediate(scheduleCommands);
+  return { id };
+}
+
+function compareCommands(a: StartedCommand, b: StartedCommand) {
+  if (a.running !== b.running) return a.running ? -1 : 1;
+  return b.priority - a.priority || a.seq - b.seq;
+}
+
+// scheduleCommands starts waiting commands while there are free slots.
+function scheduleCommands() {
+  const all = [...runningCommands.values()];
+  let running = all.filter((run) => run.running).length;
+  for (const run of all.filter((run) => !run.running).sort(compareCommands)) {
+    if (running >= COMMAND_SLOTS) return;
+    run.running = true;
+    running++;
+    void runStartedCommand(run);
+  }
+}
+
+async function runStartedCommand(run: StartedCommand) {
+  const { id, socket } = run;
+  const output = (text: string) => {
+    if (!run.cancelled) sendSocket(socket, { type: "event", event: "command-output", payload: { id, text } });
+  };
+  let done: Record<string, unknown>;
+  try {
+    done = { id, result: await api.runCommand(run.command, descriptor.id, output) };
+  } catch (error) {
+    done = { id, error: error instanceof Error ? error.message : String(error) };
+  }
+  // a cancelled command has had its command-done already
+  if (run.cancelled) return;
+  runningCommands.delete(id);
+  sendSocket(socket, { type: "event", event: "command-done", payload: done });
+  scheduleCommands();
+}
+
+// cancelCommand drops a waiting command, or stops forwarding a running
+// one's output, and ends it; the hub finishes a running one regardless.
+function cancelCommand(id: string) {
+  const run = runningCommands.get(id);
+  if (!run) return { cancelled: false };
+  run.cancelled = true;
+  runningCommands.delete(id);
+  sendSocket(run.socket, { type: "event", event: "command-done", payload: { id, cancelled: true } });
+  scheduleCommands();
+  return { cancelled: true };
+}
+
+function commandJob(run: StartedCommand) {
+  return {
+    id: run.id,
+    kind: "command",
+    title: run.command,
+    state: run.running ? "running" : "pending",
+    priority: run.priority,
+    owner: descriptor.id,
+    createdAt: run.createdAt,
+  };
+}
+
+function jobsPayload() {
+  return { jobs: [...runningCommands.values()].sort(compareCommands).map(commandJob) };
+}
+
+function jobPriorityPayload(jobId: string, priority: number) {
+  const run = runningCommands.get(jobId);
+  if (!run) throw new SocketError("not-found", `unknown job ${jobId}`);
+  run.priority = priority;
+  return { job: commandJob(run) };
+}
+
+// pingPeer pings peer through the hub, timing the whole round trip from
+// here; with from, the hub has that peer do the pinging instead.
+async function pingPeer(peer: string, from?: string): Promise<PeerPing> {
+  if (from && from !== descriptor.id) {
+    return await api.pingPeer(peer, from);
+  }
+  const started = performance.now();
+  const result = await api.pingPeer(peer);
+  if (!result.reachable) return result;
+  return { ...result, latencyMs: Math.round((performance.now() - started) * 10) / 10 };
+}
+
+// audioStreamPayload relays one intercom chunk to every peer as it comes;
+// a lost or late chunk is the listener's to skip, so nothing is retried.
+async function audioStreamPayload(request: SocketRequest) {
+  const streamId = typeof request.streamId === "string" ? request.streamId : undefined;
+  const phase = typeof request.phase === "string" ? request.phase : undefined;
+  if (!streamId || !phase) throw new SocketError("invalid", "streamId and phase are required");
+  if (!["start", "data", "end"].includes(phase)) throw new SocketError("invalid", `unknown phase ${phase}`);
+  const base64 = typeof request.base64 === "string" ? request.base64 : undefined;
+  if (base64 && base64.length > MAX_AUDIO_CHUNK_BASE64) {
+    throw new SocketError("too-large", `audio chunk over ${MAX_AUDIO_CHUNK_BASE64} bytes`);
+  }
+  const recipients = await api.broadcast({
+    type: "audio-stream",
+    from: descriptor.id,
+    streamId,
+    seq: typeof request.seq === "number" ? request.seq : 0,
+    phase,
+    format: request.format && typeof request.format === "object" ? request.format : undefined,
+    base64,
+  });
+  return { recipients };
+}
+
+// relayToPeer sends a peer-files or peer-upload request to peer's socket
+// clients through the hub and waits for the first of them to answer.
+async function relayToPeer(kind: "peer-files" | "peer-upload", peer: string, fields: Record<string, unknown>) {
+  const requestId = randomUUID();
+  const reply = new Promise<Record<string, unknown>>((resolve, reject) => {
+    const timer = setTimeout(() => {
+      peerRelays.delete(requestId);
+      reject(new Error(`${peer} did not answer ${kind}`));
+    }, PEER_RELAY_TIMEOUTS[kind]);
+    peerRelays.set(requestId, { resolve, timer });
+  });
+  let recipients = 0;
+  try {
+    recipients = await api.broadcast({ type: `${kind}-request`, requestId, from: descriptor.id, ...fields }, [peer]);
+  } finally {
+    if (!recipients) {
+      clearTimeout(peerRelays.get(requestId)?.timer);
+      peerRelays.delete(requestId);
+    }
+  }
+  if (!recipients) throw new SocketError("not-found", `${peer} is not connected`);
+  const answer = await reply;
+  if (typeof answer.error === "string" && answer.error) throw new Error(answer.error);
+  return answer;
+}
+
+// transferOfferPayload asks the hub to broker a direct transfer to peer.
+// The offer carries what the receiver needs to connect back: the token
+// proving a connection belongs to the transfer and the sender's
+// endpoints. The file itself never passes through here.
+async function transferOfferPayload(request: SocketRequest) {
+  const peer = typeof request.peer === "string" ? request.peer : "";
+  const filename = typeof request.filename === "string" ? request.filename : "";
+  const token = typeof request.token === "string" ? request.token : "";
+  if (!peer || !filename || !token || typeof request.size !== "number") {
+    throw new SocketError("invalid", "peer, filename, size and token are required");
+  }
+  const endpoints = Array.isArray(request.endpoints) ? request.endpoints.filter((e) => typeof e === "string") : [];
+  const contentType = typeof request.contentType === "string" ? request.contentType : guessContentType(filename);
+  const response = await api.transferOffer(descriptor.id, peer, { filename, size: request.size, contentType, token, endpoints });
+  if (response?.error) throw new SocketError(response.code ?? "invalid", response.error);
+  return { transferId: response.transferId };
+}
+
+// transferSignalPayload passes a transfer-answer or transfer-cancel to
+// the other peer of a brokered transfer.
+async function transferSignalPayload(type: "transfer-answer" | "transfer-cancel", request: SocketRequest) {
+  const transferId = typeof request.transferId === "string" ? request.transferId : "";
+  if (!transferId) throw new SocketError("invalid", "transferId is required");
+  const fields: Record<string, unknown> = {};
+  if (typeof request.reason === "string") fields.reason = request.reason;
+  if (type === "transfer-answer") {
+    fields.accept = request.accept === true;
+    fields.endpoints = Array.isArray(request.endpoints) ? request.endpoints.filter((e) => typeof e === "string") : [];
+  } else {
+    if (typeof request.fallback === "string") fields.fallback = request.fallback;
+    if (typeof request.filename === "string") fields.filename = request.filename;
+  }
+  const response = await api.transferSignal(type, descriptor.id, transferId, fields);
+  if (response?.error) throw new SocketError(response.code ?? "invalid", response.error);
+  return {};
+}
+
+// takeRelayedRequest hands this peer's socket clients a relayed request,
+// remembering who to answer; with no socket client to answer, the asker
+// hears so at once.
+function takeRelayedRequest(kind: "peer-files" | "peer-upload", msg: Record<string, unknown>) {
+  const requestId = msg.requestId as string;
+  const from = msg.from as string;
+  if (socketClients.size === 0) {
+    const reply = { error: "no client on this peer is sharing files" };
+    void api.broadcast({ type: `${kind}-response`, requestId, from: descriptor.id, reply }, [from]).catch(() => {});
+    return;
+  }
+  relayedRequests.set(requestId, from);
+  setTimeout(() => relayedRequests.delete(requestId), PEER_RELAY_TIMEOUTS[kind]).unref();
+  const { type: _type, ...payload } = msg;
+  broadcastSocketEvent(`${kind}-request`, payload);
+}
+
+// answerRelayedRequest sends a socket client's answer back to the peer
+// that asked; later answers to the same request are dropped.
+async function answerRelayedRequest(kind: "peer-files" | "peer-upload", request: SocketRequest) {
+  const { id: _id, type: _type, requestId, ...reply } = request;
+  const to = typeof requestId === "string" ? relayedRequests.get(requestId) : undefined;
+  if (!to) throw new SocketError("not-found", "no such relayed request, or it was answered already");
+  relayedRequests.delete(requestId as string);
+  await api.broadcast({ type: `${kind}-response`, requestId, from: descriptor.id, reply }, [to]);
+  return {};
+}
+
+// UPDATE_COMMAND brings this client up to date before a peer-update
+// restart; it runs in the client's own directory.
+const UPDATE_COMMAND = process.env.CLIENT_UPDATE_COMMAND ?? "git pull --ff-only";
+const RESTART_DELAY_MS = 250;
+const execAsync = promisify(exec);
+
+async function runUpdate() {
+  const cwd = path.dirname(fileURLToPath(import.meta.url));
+  try {
+    const { stdout: out } = await execAsync(UPDATE_COMMAND, { cwd, timeout: 5 * 60 * 1000 });
+    return out.trim().split("\n").slice(-1)[0] ?? "";
+  } catch (error) {
+    const stderr = (error as { stderr?: string }).stderr?.trim();
+    throw new Error(`${UPDATE_COMMAND} failed${stderr ? `: ${stderr}` : ""}`);
+  }
+}
+
+// restartSelf starts a fresh copy of this client with the same id and
+// arguments, then exits.
+function restartSelf() {
+  const child = spawn(process.execPath, [...process.execArgv, ...process.argv.slice(1)], {
+    stdio: "inherit",
+    env: { ...process.env, BRAIN_CLIENT_ID: descriptor.id },
+  });
+  child.unref();
+  process.exit(0);
+}
+
+// controlPeerPayload starts a peer restart or update and answers with its
+// operation id; peer-control events report how it goes.
+async function controlPeerPayload(peer: string, action: "restart" | "update") {
+  const response = (await api.runCommand("peers", descriptor.id)) as { peers?: { id: string }[] };
+  if (!(response.peers ?? []).some((p) => p.id === peer)) {
+    throw new SocketError("not-found", `${peer} is not connected`);
+  }
+  const operationId = randomUUID();
+  const report = (phase: string, message?: string) => {
+    broadcastSocketEvent("peer-control", { operationId, peer, action, phase, ...(message && { message }) });
+  };
+  setImmediate(() => {
+    report("requested");
+    api.controlPeer(peer, action, descriptor.id, report).then(
+      () => report("done", "back online"),
+      (error) => report("failed", error instanceof Error ? error.message : String(error)),
+    );
+  });
+  return { operationId };
+}
+
+async function playPayload(filename: string, loop = false, normalize = false) {
   const info = await getAudioInfo(filename);
   if (!info || !info.exists) {
     throw new Error("Audio file not found");
   }
-  await playAudio(buildAudioUrl(filename), filename);
+  await playAudio(buildAudioUrl(filename), filename, undefined, loop, normalize ? normalizedGain(info) : undefined, descriptor.id);
   return { played: filename, info };
 }
 
-async function broadcastPayload(message: string) {
+// broadcastStopPayload silences every peer; this client hears its own
+// stop from the hub like the rest.
+async function broadcastStopPayload() {
+  const message = {
+    type: "stop-audio",
+    from: descriptor.id,
+    timestamp: new Date().toISOString(),
+  };
+  const recipients = await api.broadcast(message);
+  return { recipients };
+}
+
+async function broadcastPayload(message: string, zone?: string) {
+  const to = zone ? await zonePeers(zone) : undefined;
   const payload = {
     type: "user-message",
     from: descriptor.id,
     message,
     timestamp: new Date().toISOString(),
   };
-  const recipients = await api.broadcast(payload);
+  const recipients = await api.broadcast(payload, to);
   return { recipients, payload };
 }
 
-async function broadcastPlayPayload(filename: string) {
+// Bound on one clipboard share, matching the Go clients.
+const MAX_CLIPBOARD_BYTES = 64 * 1024;
+
+async function clipboardPayload(text: string) {
+  if (Buffer.byteLength(text, "utf8") > MAX_CLIPBOARD_BYTES) {
+    throw new SocketError("too-large", `clipboard text over ${MAX_CLIPBOARD_BYTES} bytes`);
+  }
+  const message = {
+    type: "clipboard",
+    from: descriptor.id,
+    text,
+    timestamp: new Date().toISOString(),
+  };
+  const recipients = await api.broadcast(message);
+  return { recipients };
+}
+
+async function kvGetPayload(query: { key?: string; prefix?: string }) {
+  const response = (await api.runCommand(`kv get ${JSON.stringify(query)}`, descriptor.id)) as { entries?: unknown[]; error?: string };
+  if (response?.error) throw new Error(response.error);
+  return { entries: response.entries ?? [] };
+}
+
+async function peerConfigPayload() {
+  const response = (await api.runCommand("peer-config get", descriptor.id)) as {
+    configs?: { peer: string; volume?: number }[];
+    error?: string;
+  };
+  if (response?.error) throw new Error(response.error);
+  return { configs: response.configs ?? [] };
+}
+
+async function peerConfigSetPayload(peer: string, volume: number) {
+  const response = (await api.runCommand(`peer-config set ${JSON.stringify({ peer, volume })}`, descriptor.id)) as {
+    config?: unknown;
+    error?: string;
+  };
+  if (response?.error) throw new SocketError("invalid", response.error);
+  return { config: response.config };
+}
+
+// kvSetPayload stores value under key, or deletes key when value is null.
+async function kvSetPayload(key: string, value: string | null, ttl?: number) {
+  const command = value === null ? `kv delete ${JSON.stringify({ key })}` : `kv set ${JSON.stringify({ key, value, ttl })}`;
+  const response = (await api.runCommand(command, descriptor.id)) as { entry?: unknown; error?: string };
+  if (response?.error) throw new SocketError("invalid", response.error);
+  return { entry: response.entry };
+}
+
+// chatPayload runs a "chat" hub command: send, history or typing.
+async function chatPayload(action: "send" | "history" | "typing", request: Record<string, unknown>) {
+  const response = (await api.runCommand(`chat ${action} ${JSON.stringify(request)}`, descriptor.id)) as Record<string, unknown> & { error?: string };
+  if (response?.error) throw new SocketError("invalid", response.error);
+  switch (action) {
+    case "send":
+      return { message: response.message };
+    case "history":
+      return { messages: response.messages ?? [] };
+    default:
+      return {};
+  }
+}
+
+async function broadcastPlayPayload(filename: string, zone?: string, sync = false, loop = false, normalize = false) {
   const info = await getAudioInfo(filename);
   if (!info || !info.exists) {
     throw new Error("Audio file not found");
   }
+  const gain = normalize ? normalizedGain(info) : undefined;
+  const to = zone ? await zonePeers(zone) : undefined;
+  const startAt = sync ? await api.syncStart() : undefined;
   const message = {
     type: "play-audio",
     filename,
     from: descriptor.id,
     timestamp: new Date().toISOString(),
+    ...(startAt !== undefined && { startAt }),
+    ...(loop && { loop }),
+    ...(gain !== undefined && { gain }),
+  };
+  await api.broadcast(message, to);
+  if (!to || to.includes(descriptor.id)) {
+    const started = playAudio(buildAudioUrl(filename), filename, startAt, loop, gain, descriptor.id);
+    // a synchronized start answers at once instead of after the wait
+    if (startAt === undefined) await started;
+    else started.catch((err) => console.error(`Failed to play broadcasted audio: ${err}`));
+  }
+  return { broadcast: true, filename, info, ...(startAt !== undefined && { startAt: syncStartAt(startAt) }) };
+}
+
+async function statsPayload() {
+  const response = (await api.runCommand("stats", descriptor.id)) as {
+    files?: { name: string; plays: number; lastPlayed?: string }[];
+    error?: string;
+  };
+  if (response?.error) throw new Error(response.error);
+  return { files: response.files ?? [] };
+}
+
+async function zonesPayload() {
+  const response = (await api.runCommand("zone list", descriptor.id)) as {
+    zones?: { name: string; peers: string[] }[];
+    error?: string;
+  };
+  if (response?.error) throw new Error(response.error);
+  return { zones: response.zones ?? [] };
+}
+
+// zonePeers lists the peers in zone, for a broadcast limited to it.
+async function zonePeers(zone: string) {
+  const { zones } = await zonesPayload();
+  const found = zones.find((z) => z.name === zone);
+  if (!found) throw new SocketError("not-found", `no zone ${zone}`);
+  return found.peers;
+}
+
+async function zoneCommandPayload(action: "set" | "delete", request: Record<string, unknown>) {
+  const response = (await api.runCommand(`zone ${action} ${JSON.stringify(request)}`, descriptor.id)) as {
+    zone?: unknown;
+    deleted?: boolean;
+    error?: string;
+  };
+  if (response?.error) throw new SocketError("invalid", response.error);
+  return action === "set" ? { zone: response.zone } : { deleted: response.deleted === true };
+}
+
+// zoneArg is the zone a broadcast request is limited to, if any.
+function zoneArg(request: Record<string, unknown>) {
+  return typeof request.zone === "string" && request.zone ? request.zone : undefined;
+}
+
+// broadcastImagePayload shows an uploaded image to every peer; they fetch
+// it over HTTP like any other file.
+async function broadcastImagePayload(filename: string, caption?: string) {
+  const info = await getAudioInfo(filename);
+  if (!info || !info.exists) {
+    throw new SocketError("not-found", "Image not found");
+  }
+  const contentType = typeof info.contentType === "string" ? info.contentType : guessImageType(filename);
+  if (!contentType.startsWith("image/")) {
+    throw new SocketError("invalid", `${filename} is not an image`);
+  }
+  const message = {
+    type: "show-image",
+    filename,
+    caption,
+    contentType,
+    size: info.size,
+    from: descriptor.id,
+    timestamp: new Date().toISOString(),
+  };
+  const recipients = await api.broadcast(message);
+  return { recipients };
+}
+
+function guessImageType(path: string) {
+  const ext = path.toLowerCase().split(".").pop() ?? "";
+  const types: Record<string, string> = { png: "image/png", jpg: "image/jpeg", jpeg: "image/jpeg", gif: "image/gif", webp: "image/webp" };
+  return types[ext] ?? "application/octet-stream";
+}
+
+// broadcastPlanPayload answers who a broadcast or broadcast-play would
+// reach, checking the file as the real broadcast-play would, without
+// sending anything.
+async function broadcastPlanPayload(action: string, target: string, zone?: string) {
+  const plan: Record<string, unknown> = { action };
+  if (action === "broadcast-play") {
+    const info = await getAudioInfo(target);
+    if (!info || !info.exists) {
+      throw new SocketError("not-found", "Audio file not found");
+    }
+    plan.filename = target;
+  } else if (action !== "broadcast") {
+    throw new SocketError("invalid", `cannot plan ${action}`);
+  }
+  const response = (await api.runCommand("peers", descriptor.id)) as {
+    peers?: { id: string; isMe?: boolean }[];
+    error?: string;
   };
-  await api.broadcast(message);
-  await playAudio(buildAudioUrl(filename), filename);
-  return { broadcast: true, filename, info };
+  if (response?.error) throw new Error(response.error);
+  let peers = response.peers ?? [];
+  if (zone) {
+    const members = await zonePeers(zone);
+    peers = peers.filter((peer) => members.includes(peer.id));
+    plan.zone = zone;
+  }
+  plan.recipients = peers.map((peer) => ({ id: peer.id, self: peer.isMe === true }));
+  return plan;
+}
+
+// dropChunkedUpload forgets uploadId and removes what it stored so far.
+async function dropChunkedUpload(uploadId: string) {
+  const upload = chunkedUploads.get(uploadId);
+  if (!upload) return;
+  chunkedUploads.delete(uploadId);
+  clearTimeout(upload.idle);
+  await fs.promises.rm(upload.tempPath, { force: true }).catch(() => {});
+}
+
+// chunkedUploadPayload answers upload-begin, -chunk, -resume, -commit and
+// -cancel. Chunks collect in a temporary file; the commit checks it against
+// the declared size and digest, then stores it as a plain upload would.
+async function chunkedUploadPayload(socket: net.Socket, action: string, request: SocketRequest) {
+  if (action === "upload-begin") {
+    const filename = typeof request.filename === "string" ? request.filename : undefined;
+    const size = typeof request.size === "number" ? request.size : undefined;
+    if (!filename || size === undefined || size < 0) throw new SocketError("invalid", "filename and size are required");
+    const uploadId = `upload-${randomUUID()}`;
+    const tempPath = path.join(os.tmpdir(), `brain-${uploadId}`);
+    await fs.promises.writeFile(tempPath, new Uint8Array());
+    const temporary = temporaryArg(request);
+    chunkedUploads.set(uploadId, {
+      filename,
+      size,
+      temporary,
+      sha256: typeof request.sha256 === "string" && request.sha256 ? request.sha256.toLowerCase() : undefined,
+      contentType: typeof request.contentType === "string" ? request.contentType : undefined,
+      metadata:
+        request.metadata && typeof request.metadata === "object" && !Array.isArray(request.metadata)
+          ? (request.metadata as Record<string, unknown>)
+          : undefined,
+      tempPath,
+      offset: 0,
+      idle: setTimeout(() => void dropChunkedUpload(uploadId), CHUNKED_UPLOAD_IDLE_MS).unref(),
+    });
+    return { uploadId, offset: 0 };
+  }
+  const uploadId = typeof request.uploadId === "string" ? request.uploadId : undefined;
+  if (!uploadId) throw new SocketError("invalid", "uploadId is required");
+  const upload = chunkedUploads.get(uploadId);
+  if (!upload) throw new SocketError("not-found", `unknown upload ${uploadId}`);
+  upload.idle.refresh();
+  switch (action) {
+    case "upload-chunk": {
+      const base64 = typeof request.base64 === "string" ? request.base64 : undefined;
+      if (base64 === undefined || typeof request.offset !== "number") throw new SocketError("invalid", "offset and base64 are required");
+      // a chunk repeated after a lost answer, or one past a gap, changes
+      // nothing; the offset in the answer says where to go on
+      if (request.offset === upload.offset) {
+        const data = Buffer.from(base64, "base64");
+        if (upload.offset + data.length > upload.size) {
+          throw new SocketError("too-large", `chunk runs past the declared ${upload.size} bytes`);
+        }
+        await fs.promises.appendFile(upload.tempPath, data);
+        upload.offset += data.length;
+      }
+      return { uploadId, offset: upload.offset };
+    }
+    case "upload-resume":
+      if (typeof request.sha256 === "string" && upload.sha256 && request.sha256.toLowerCase() !== upload.sha256) {
+        throw new SocketError("not-found", `upload ${uploadId} is of a different file`);
+      }
+      return { uploadId, offset: upload.offset };
+    case "upload-cancel":
+      await dropChunkedUpload(uploadId);
+      return {};
+  }
+  if (upload.offset !== upload.size) {
+    throw new SocketError("invalid", `upload ${uploadId} has ${upload.offset} of ${upload.size} bytes`);
+  }
+  const data = await fs.promises.readFile(upload.tempPath);
+  const sha256 = createHash("sha256").update(data).digest("hex");
+  if (upload.sha256 && upload.sha256 !== sha256) {
+    await dropChunkedUpload(uploadId);
+    throw new SocketError("invalid", `checksum mismatch: received ${sha256.slice(0, 12)}, sent ${upload.sha256.slice(0, 12)}`);
+  }
+  const result = await uploadPayload(upload.filename, data.toString("base64"), upload.contentType, upload.metadata, upload.temporary);
+  await dropChunkedUpload(uploadId);
+  return { ...keepTemporary(socket, result, upload.temporary), sha256: typeof result?.sha256 === "string" ? result.sha256 : sha256 };
+}
+
+// temporaryArg reads an upload's temporary, ttlSeconds and
+// deleteOnDisconnect; a TTL wins when both are given.
+function temporaryArg(request: SocketRequest): TemporaryUpload | undefined {
+  if (request.temporary !== true) return undefined;
+  if (typeof request.ttlSeconds === "number" && request.ttlSeconds > 0) return { ttlSeconds: Math.floor(request.ttlSeconds) };
+  if (request.deleteOnDisconnect === true) return { deleteOnDisconnect: true };
+  throw new SocketError("invalid", "a temporary upload needs ttlSeconds or deleteOnDisconnect");
+}
+
+// keepTemporary notes an upload to remove when socket disconnects and
+// says so in its answer; one with a TTL already carries expiresAt.
+function keepTemporary(socket: net.Socket, result: any, temporary?: TemporaryUpload) {
+  if (temporary?.ttlSeconds && typeof result?.expiresAt !== "string") {
+    throw new Error(`the hub stored ${result?.filename ?? "the upload"} without an expiry`);
+  }
+  if (!temporary?.deleteOnDisconnect) return result;
+  const filename = String(result?.filename);
+  disconnectUploads.set(socket, (disconnectUploads.get(socket) ?? new Set()).add(filename));
+  return { ...result, deleteOnDisconnect: true };
+}
+
+// expireUploads removes the temporary uploads a socket made as it goes.
+function expireUploads(socket: net.Socket) {
+  const filenames = disconnectUploads.get(socket);
+  disconnectUploads.delete(socket);
+  for (const filename of filenames ?? []) {
+    api
+      .runCommand(`audio expire ${filename}`, descriptor.id)
+      .then((response: any) => {
+        if (response?.error && response.code !== "not-found") throw new Error(response.error);
+        console.log(`[UPLOAD] removed temporary ${filename}`);
+      })
+      .catch((error: unknown) => {
+        console.warn(`[UPLOAD] failed to remove temporary ${filename}`, error instanceof Error ? error.message : String(error));
+      });
+  }
+}
+
+// logsPayload is the last count console lines at level or above.
+function logsPayload(request: SocketRequest) {
+  const count = typeof request.count === "number" && request.count > 0 ? Math.min(Math.floor(request.count), LOG_HISTORY) : 100;
+  const level = typeof request.level === "string" ? request.level.toLowerCase() : "";
+  if (level && !LOG_LEVELS.includes(level)) throw new SocketError("invalid", `unknown level ${level}`);
+  const min = level ? LOG_LEVELS.indexOf(level) : 0;
+  const lines = logHistory.filter((entry) => LOG_LEVELS.indexOf(entry.level) >= min);
+  return { lines: lines.slice(-count) };
 }
 
-async function uploadPayload(filename: string, base64: string, contentType?: string) {
+async function uploadPayload(
+  filename: string,
+  base64: string,
+  contentType?: string,
+  metadata?: Record<string, unknown>,
+  temporary?: TemporaryUpload,
+) {
   const normalizedContentType = contentType ?? guessContentType(filename);
   try {
-    return await uploadFileViaHttp(filename, base64, normalizedContentType);
+    const result = await uploadFileViaHttp(filename, base64, normalizedContentType, metadata, temporary);
+    // the hub only sees uploads that go through its commands
+    void api.recordAudit(descriptor.id, "upload", filename).catch((error) => {
+      console.warn("[AUDIT] failed to record upload", error instanceof Error ? error.message : String(error));
+    });
+    return result;
   } catch (error) {
+    // the command path would only be refused again, and cannot make a
+    // file temporary
+    if (error instanceof SocketError || temporary) throw error;
     const message = error instanceof Error ? error.message : String(error);
     console.warn(`[HTTP] upload http fallback ${new Date().toISOString()} reason=${message}`);
     return await uploadFileViaCommand(filename, base64, normalizedContentType);
@@ -560,6 +1800,76 @@ function buildAudioUrl(filename: string) {
   return `${base}/audio/${filename}`;
 }
 
+// tagsPayload lists every file's tags, or replaces one file's first. The
+// answer is the whole map either way.
+async function tagsPayload(update?: { filename: string; tags: string[] }) {
+  const command = update ? `tags set ${JSON.stringify(update)}` : "tags list";
+  const response = (await api.runCommand(command, descriptor.id)) as { tags?: unknown; error?: string };
+  if (response?.error) throw new Error(response.error);
+  return { tags: response?.tags ?? {} };
+}
+
+async function filesPayload() {
+  const response = (await api.runCommand("audio list", descriptor.id)) as { files?: any[]; error?: string };
+  if (response?.error) throw new Error(response.error);
+  const files = (response?.files ?? []).map((file) => ({
+    name: file.name,
+    size: file.size,
+    modified: file.uploaded,
+    ...(file.contentType && { contentType: file.contentType }),
+    ...(typeof file.loudness === "number" && { loudness: file.loudness, replayGain: file.replayGain ?? 0 }),
+  }));
+  return { files };
+}
+
+async function storagePayload() {
+  const response = (await api.runCommand("audio usage", descriptor.id)) as {
+    total?: number;
+    used?: number;
+    quota?: number;
+    files?: number;
+    error?: string;
+  };
+  if (response?.error) throw new Error(response.error);
+  return { total: response.total ?? 0, used: response.used ?? 0, quota: response.quota ?? 0, files: response.files ?? 0 };
+}
+
+async function deletePayload(filename: string) {
+  const response = (await api.runCommand(`audio delete ${filename}`, descriptor.id)) as { error?: string; trashed?: boolean };
+  if (response?.error) throw new Error(response.error);
+  return { deleted: filename, trashed: response.trashed === true };
+}
+
+// trashPayload runs "trash list", "trash restore" or "trash purge".
+async function trashPayload(action: "list" | "restore" | "purge", filename = "") {
+  const response = (await api.runCommand(`trash ${action} ${filename}`.trim(), descriptor.id)) as {
+    files?: unknown[];
+    restored?: string;
+    purged?: number;
+    error?: string;
+    code?: string;
+  };
+  if (response?.error) {
+    if (response.code === "not-found" || response.code === "invalid") throw new SocketError(response.code, response.error);
+    throw new Error(response.error);
+  }
+  if (action === "list") return { files: response.files ?? [] };
+  if (action === "restore") return { restored: response.restored ?? filename };
+  return { purged: response.purged ?? 0 };
+}
+
+async function movePayload(from: string, to: string) {
+  const response = (await api.runCommand(`audio move ${JSON.stringify({ from, to })}`, descriptor.id)) as {
+    error?: string;
+    code?: string;
+  };
+  if (response?.error) {
+    if (response.code === "not-found" || response.code === "invalid") throw new SocketError(response.code, response.error);
+    throw new Error(response.error);
+  }
+  return { filename: from, to };
+}
+
 async function getAudioInfo(filename: string) {
   return (await api.runCommand(`audio get ${filename}`, descriptor.id)) as any;
 }
@@ -573,10 +1883,23 @@ function guessContentType(path: string) {
   return "application/octet-stream";
 }
 
-async function uploadFileViaHttp(filename: string, base64: string, contentType: string) {
+async function uploadFileViaHttp(
+  filename: string,
+  base64: string,
+  contentType: string,
+  metadata?: Record<string, unknown>,
+  temporary?: TemporaryUpload,
+) {
   const uploadUrl = new URL("/upload", buildAudioUrl(""));
   uploadUrl.pathname = "/upload";
-  const body = JSON.stringify({ filename, base64, contentType });
+  const body = JSON.stringify({
+    filename,
+    base64,
+    contentType,
+    metadata,
+    ...(temporary?.ttlSeconds && { ttlSeconds: temporary.ttlSeconds }),
+    ...(temporary?.deleteOnDisconnect && { owner: descriptor.id }),
+  });
   const isHttps = uploadUrl.protocol === "https:";
   const requestFn = isHttps ? https.request : http.request;
 
@@ -604,6 +1927,14 @@ async function uploadFileViaHttp(filename: string, base64: string, contentType:
           } catch (error) {
             reject(new Error(`Failed to parse upload response: ${error instanceof Error ? error.message : String(error)}`));
           }
+        } else if (status === 413) {
+          let message = text;
+          try {
+            message = JSON.parse(text).error ?? text;
+          } catch {
+            // not JSON; keep the body as it is
+          }
+          reject(new SocketError("quota-exceeded", message || "storage quota exceeded"));
         } else {
           reject(new Error(`HTTP ${status}: ${text || res.statusMessage || "Unknown error"}`));
         }
@@ -626,9 +1957,9 @@ async function uploadFileViaCommand(filename: string, base64: string, contentTyp
   if (!result || typeof result !== "object") {
     throw new Error("Unexpected response from audio upload command");
   }
-  const payload = result as { error?: string; size?: number; filename?: string };
+  const payload = result as { error?: string; code?: string; size?: number; filename?: string };
   if (payload.error) {
-    throw new Error(payload.error);
+    throw payload.code ? new SocketError(payload.code, payload.error) : new Error(payload.error);
   }
   const decoded = Buffer.from(sanitizedBase64, "base64");
   return {
@@ -639,9 +1970,226 @@ async function uploadFileViaCommand(filename: string, base64: string, contentTyp
   };
 }
 
+// CBOR (RFC 8949) for the values JSON can hold, plus byte strings. Like
+// JSON.stringify it drops undefined members and honours toJSON.
+function cborEncode(value: unknown): Buffer {
+  const parts: Buffer[] = [];
+  const head = (major: number, n: number) => {
+    const type = major << 5;
+    if (n < 24) {
+      parts.push(Buffer.from([type | n]));
+    } else if (n < 0x100) {
+      parts.push(Buffer.from([type | 24, n]));
+    } else if (n < 0x10000) {
+      const b = Buffer.alloc(3);
+      b[0] = type | 25;
+      b.writeUInt16BE(n, 1);
+      parts.push(b);
+    } else if (n < 0x100000000) {
+      const b = Buffer.alloc(5);
+      b[0] = type | 26;
+      b.writeUInt32BE(n, 1);
+      parts.push(b);
+    } else {
+      const b = Buffer.alloc(9);
+      b[0] = type | 27;
+      b.writeBigUInt64BE(BigInt(n), 1);
+      parts.push(b);
+    }
+  };
+  const write = (v: unknown, depth: number): void => {
+    if (depth > 512) throw new Error("cbor: nesting too deep");
+    if (v === null || v === undefined || typeof v === "function" || typeof v === "symbol") {
+      parts.push(Buffer.from([0xf6]));
+      return;
+    }
+    if (v instanceof Uint8Array) {
+      head(2, v.length);
+      parts.push(Buffer.from(v));
+      return;
+    }
+    if (typeof v === "object" && typeof (v as { toJSON?: unknown }).toJSON === "function") {
+      write((v as { toJSON: () => unknown }).toJSON(), depth + 1);
+      return;
+    }
+    switch (typeof v) {
+      case "boolean":
+        parts.push(Buffer.from([v ? 0xf5 : 0xf4]));
+        return;
+      case "bigint":
+        write(Number(v), depth);
+        return;
+      case "number":
+        if (!Number.isFinite(v)) {
+          parts.push(Buffer.from([0xf6]));
+        } else if (Number.isInteger(v) && Math.abs(v) <= Number.MAX_SAFE_INTEGER) {
+          if (v >= 0) head(0, v);
+          else head(1, -1 - v);
+        } else {
+          const b = Buffer.alloc(9);
+          b[0] = 0xfb;
+          b.writeDoubleBE(v, 1);
+          parts.push(b);
+        }
+        return;
+      case "string": {
+        const text = Buffer.from(v, "utf8");
+        head(3, text.length);
+        parts.push(text);
+        return;
+      }
+    }
+    if (Array.isArray(v)) {
+      head(4, v.length);
+      for (const item of v) write(item, depth + 1);
+      return;
+    }
+    const entries = Object.entries(v as Record<string, unknown>).filter(
+      ([, item]) => item !== undefined && typeof item !== "function" && typeof item !== "symbol",
+    );
+    head(5, entries.length);
+    for (const [key, item] of entries) {
+      write(key, depth + 1);
+      write(item, depth + 1);
+    }
+  };
+  write(value, 0);
+  return Buffer.concat(parts);
+}
+
+function cborDecode(buf: Buffer): unknown {
+  let off = 0;
+  const need = (n: number) => {
+    if (off + n > buf.length) throw new Error("cbor: unexpected end of data");
+  };
+  const readHead = (): [number, number, number] => {
+    need(1);
+    const initial = buf[off++];
+    const major = initial >> 5;
+    const info = initial & 0x1f;
+    if (info < 24) return [major, info, info];
+    let n: number;
+    switch (info) {
+      case 24:
+        need(1);
+        n = buf[off];
+        off += 1;
+        break;
+      case 25:
+        need(2);
+        n = buf.readUInt16BE(off);
+        off += 2;
+        break;
+      case 26:
+        need(4);
+        n = buf.readUInt32BE(off);
+        off += 4;
+        break;
+      case 27:
+        need(8);
+        n = Number(buf.readBigUInt64BE(off));
+        off += 8;
+        break;
+      case 31:
+        if (major === 0 || major === 1 || major === 6) throw new Error("cbor: invalid indefinite length");
+        return [major, info, -1];
+      default:
+        throw new Error(`cbor: invalid initial byte ${initial}`);
+    }
+    return [major, info, n];
+  };
+  const readString = (major: number, info: number, n: number): Buffer => {
+    if (info !== 31) {
+      need(n);
+      off += n;
+      return buf.subarray(off - n, off);
+    }
+    const chunks: Buffer[] = [];
+    for (;;) {
+      need(1);
+      if (buf[off] === 0xff) {
+        off++;
+        return Buffer.concat(chunks);
+      }
+      const [m, i, len] = readHead();
+      if (m !== major || i === 31) throw new Error("cbor: bad chunk in indefinite string");
+      chunks.push(readString(m, i, len));
+    }
+  };
+  const atBreak = () => {
+    need(1);
+    if (buf[off] !== 0xff) return false;
+    off++;
+    return true;
+  };
+  const item = (depth: number): unknown => {
+    if (depth > 512) throw new Error("cbor: nesting too deep");
+    need(1);
+    const initial = buf[off];
+    if (initial === 0xf9 || initial === 0xfa || initial === 0xfb) {
+      const size = initial === 0xf9 ? 2 : initial === 0xfa ? 4 : 8;
+      need(1 + size);
+      off += 1 + size;
+      if (size === 8) return buf.readDoubleBE(off - 8);
+      if (size === 4) return buf.readFloatBE(off - 4);
+      const half = buf.readUInt16BE(off - 2);
+      const exp = (half >> 10) & 0x1f;
+      const mant = half & 0x3ff;
+      const magnitude = exp === 0 ? mant * 2 ** -24 : exp === 31 ? (mant ? NaN : Infinity) : (mant + 1024) * 2 ** (exp - 25);
+      return half & 0x8000 ? -magnitude : magnitude;
+    }
+    const [major, info, n] = readHead();
+    switch (major) {
+      case 0:
+        return n;
+      case 1:
+        return -1 - n;
+      case 2:
+        return Buffer.from(readString(major, info, n));
+      case 3:
+        return readString(major, info, n).toString("utf8");
+      case 4: {
+        const out: unknown[] = [];
+        for (let i = 0; info === 31 ? !atBreak() : i < n; i++) out.push(item(depth + 1));
+        return out;
+      }
+      case 5: {
+        const out: Record<string, unknown> = {};
+        for (let i = 0; info === 31 ? !atBreak() : i < n; i++) {
+          const key = String(item(depth + 1));
+          Object.defineProperty(out, key, { value: item(depth + 1), enumerable: true, writable: true, configurable: true });
+        }
+        return out;
+      }
+      case 6:
+        return item(depth + 1);
+    }
+    switch (info) {
+      case 20:
+        return false;
+      case 21:
+        return true;
+      case 22:
+      case 23:
+        return null;
+    }
+    throw new Error(`cbor: unsupported simple value ${n}`);
+  };
+  const value = item(0);
+  if (off !== buf.length) throw new Error(`cbor: ${buf.length - off} trailing bytes`);
+  return value;
+}
+
 function sendSocket(socket: net.Socket, message: SocketResponse) {
   try {
-    socket.write(JSON.stringify(message) + "\n");
+    const body = cborSockets.has(socket) ? cborEncode(message) : Buffer.from(JSON.stringify(message), "utf8");
+    if (framedSockets.has(socket)) {
+      const header = Buffer.alloc(4);
+      header.writeUInt32BE(body.length);
+      socket.write(Buffer.concat([header, body]));
+    } else {
+      socket.write(Buffer.concat([body, Buffer.from("\n")]));
+    }
   } catch (error) {
     console.error("[SOCKET] failed to send message", error instanceof Error ? error.message : String(error));
     socket.destroy();
@@ -650,34 +2198,192 @@ function sendSocket(socket: net.Socket, message: SocketResponse) {
 
 function broadcastSocketEvent(event: string, payload: unknown) {
   for (const socket of socketClients) {
+    const events = subscriptions.get(socket)?.events;
+    if (events && !events.has(event)) continue;
     sendSocket(socket, { type: "event", event, payload });
   }
 }
 
+// subscribe narrows the events socket gets to events, every event when
+// there are none, and pushes it status every statusIntervalSeconds when
+// that is given. The answer is what was applied.
+function subscribe(socket: net.Socket, request: SocketRequest) {
+  if (request.events !== undefined && (!Array.isArray(request.events) || request.events.some((e) => typeof e !== "string"))) {
+    throw new SocketError("invalid", "events must be a list of event names");
+  }
+  const events = (request.events as string[] | undefined) ?? [];
+  let interval = typeof request.statusIntervalSeconds === "number" ? request.statusIntervalSeconds : 0;
+  if (interval > 0) interval = Math.max(interval, MIN_STATUS_INTERVAL_SECONDS);
+  clearInterval(subscriptions.get(socket)?.statusTimer);
+  const subscription: { events?: Set<string>; statusTimer?: NodeJS.Timeout } = {};
+  if (events.length > 0) subscription.events = new Set(events);
+  if (interval > 0) {
+    subscription.statusTimer = setInterval(() => {
+      void getStatusPayload()
+        .then((status) => sendSocket(socket, { type: "event", event: "status", payload: status }))
+        .catch(() => {});
+    }, interval * 1000);
+  }
+  subscriptions.set(socket, subscription);
+  return { events, statusIntervalSeconds: interval };
+}
+
+// sendKvEvent passes a key-value change to the sockets watching a prefix
+// of its key.
+function sendKvEvent(entry: { key: string }) {
+  for (const [socket, prefixes] of kvWatches) {
+    if (prefixes.some((prefix) => entry.key.startsWith(prefix))) {
+      sendSocket(socket, { type: "event", event: "kv", payload: entry });
+    }
+  }
+}
+
 function removeSocket(socket: net.Socket) {
+  expireUploads(socket);
   socketClients.delete(socket);
+  kvWatches.delete(socket);
+  clearInterval(subscriptions.get(socket)?.statusTimer);
+  subscriptions.delete(socket);
+  for (const [id, run] of runningCommands) {
+    if (run.socket === socket) {
+      run.cancelled = true;
+      runningCommands.delete(id);
+    }
+  }
+  scheduleCommands();
   socketBuffers.delete(socket);
+  framedSockets.delete(socket);
+  cborSockets.delete(socket);
 }
 
-function handleSocketData(socket: net.Socket, chunk: string) {
-  const previous = socketBuffers.get(socket) ?? "";
-  const combined = previous + chunk;
-  const parts = combined.split("\n");
-  const remainder = parts.pop() ?? "";
-  socketBuffers.set(socket, remainder);
-  for (const part of parts) {
-    const line = part.trim();
-    if (!line) continue;
-    let request: SocketRequest;
+type SocketMessage = { message: Buffer; data?: Buffer; rest: Buffer };
+
+// nextSocketMessage cuts one message off the front of buffer in the
+// socket's current framing, or returns undefined until more data arrives.
+function nextSocketMessage(socket: net.Socket, buffer: Buffer): SocketMessage | undefined {
+  if (framedSockets.has(socket)) {
+    if (buffer.length < 4) return undefined;
+    const word = buffer.readUInt32BE(0);
+    const size = word & ~BINARY_FRAME_FLAG;
+    if (size > MAX_SOCKET_FRAME) throw new Error(`frame of ${size} bytes exceeds limit`);
+    if (buffer.length < 4 + size) return undefined;
+    const frame = buffer.subarray(4, 4 + size);
+    const rest = buffer.subarray(4 + size);
+    if (!(word & BINARY_FRAME_FLAG)) return { message: frame, rest };
+    const headerLength = frame.length >= 4 ? frame.readUInt32BE(0) : Infinity;
+    if (headerLength > frame.length - 4) throw new Error("malformed binary frame");
+    return { message: frame.subarray(4, 4 + headerLength), data: frame.subarray(4 + headerLength), rest };
+  }
+  const end = buffer.indexOf(0x0a);
+  if (end < 0) {
+    if (buffer.length > MAX_SOCKET_FRAME) throw new Error("line exceeds limit");
+    return undefined;
+  }
+  return { message: buffer.subarray(0, end), rest: buffer.subarray(end + 1) };
+}
+
+function handleSocketData(socket: net.Socket, chunk: Buffer) {
+  let buffer = Buffer.concat([socketBuffers.get(socket) ?? Buffer.alloc(0), chunk]);
+  for (;;) {
+    let next: SocketMessage | undefined;
     try {
-      request = JSON.parse(line) as SocketRequest;
+      next = nextSocketMessage(socket, buffer);
     } catch (error) {
-      console.warn("[SOCKET] invalid JSON", error instanceof Error ? error.message : String(error));
-      sendSocket(socket, { type: "error", ok: false, error: "invalid json" });
+      console.warn("[SOCKET] dropping client:", error instanceof Error ? error.message : String(error));
+      socket.destroy();
+      return;
+    }
+    if (!next) break;
+    buffer = next.rest;
+    let request: SocketRequest;
+    if (cborSockets.has(socket)) {
+      if (next.message.length === 0) continue;
+      try {
+        request = cborDecode(next.message) as SocketRequest;
+      } catch (error) {
+        console.warn("[SOCKET] invalid CBOR", error instanceof Error ? error.message : String(error));
+        sendSocket(socket, { type: "error", ok: false, error: "invalid cbor" });
+        continue;
+      }
+    } else {
+      const line = next.message.toString("utf8").trim();
+      if (!line) continue;
+      try {
+        request = JSON.parse(line) as SocketRequest;
+      } catch (error) {
+        console.warn("[SOCKET] invalid JSON", error instanceof Error ? error.message : String(error));
+        sendSocket(socket, { type: "error", ok: false, error: "invalid json" });
+        continue;
+      }
+    }
+    if (!request || typeof request !== "object") {
+      sendSocket(socket, { type: "error", ok: false, error: "request must be an object" });
+      continue;
+    }
+    if (next.data && typeof request.binary === "string") {
+      // the handlers take file data base64-encoded, as in plain JSON
+      request[request.binary] = next.data.toString("base64");
+      delete request.binary;
+    }
+    if (request.type === "framing") {
+      // switch before looking at the rest of the buffer, which the client
+      // already wrote in the new framing
+      switchSocketFraming(socket, request);
       continue;
     }
     void handleSocketRequest(socket, request);
   }
+  socketBuffers.set(socket, buffer);
+}
+
+// switchSocketFraming answers a framing request in the old framing and
+// codec and uses the new ones for everything after it, in both directions.
+function switchSocketFraming(socket: net.Socket, request: SocketRequest) {
+  const { id, type } = request;
+  if (request.mode !== "length-prefixed") {
+    sendSocket(socket, { id, type, ok: false, error: `unsupported framing: ${String(request.mode)}` });
+    return;
+  }
+  const codec = request.codec === undefined ? "json" : request.codec;
+  if (codec !== "json" && !(typeof codec === "string" && SOCKET_CODECS.includes(codec))) {
+    sendSocket(socket, { id, type, ok: false, error: `unsupported codec: ${String(codec)}` });
+    return;
+  }
+  sendSocket(socket, { id, type, ok: true, data: { mode: request.mode, codec } });
+  framedSockets.add(socket);
+  if (codec === "cbor") cborSockets.add(socket);
+}
+
+// Results of keyed requests, so a client re-sending after an ambiguous
+// timeout gets the first answer instead of a second broadcast. Failures
+// are forgotten so they can be retried.
+const IDEMPOTENCY_TTL_MS = 10 * 60 * 1000;
+const idempotentResults = new Map<string, { expires: number; result: Promise<unknown> }>();
+
+function runIdempotent(key: string, run: () => Promise<unknown>): Promise<unknown> {
+  const now = Date.now();
+  for (const [k, entry] of idempotentResults) {
+    if (entry.expires <= now) idempotentResults.delete(k);
+  }
+  const existing = idempotentResults.get(key);
+  if (existing) return existing.result;
+  const result = run();
+  idempotentResults.set(key, { expires: now + IDEMPOTENCY_TTL_MS, result });
+  result.catch(() => idempotentResults.delete(key));
+  return result;
+}
+
+// SocketError carries a machine-readable code to the client along with
+// the message.
+class SocketError extends Error {
+  constructor(readonly code: string, message: string) {
+    super(message);
+  }
+}
+
+function socketErrorPayload(error: unknown) {
+  const message = error instanceof Error ? error.message : String(error);
+  return error instanceof SocketError ? { code: error.code, message } : message;
 }
 
 async function handleSocketRequest(socket: net.Socket, request: SocketRequest) {
@@ -686,60 +2392,321 @@ async function handleSocketRequest(socket: net.Socket, request: SocketRequest) {
     sendSocket(socket, { type: "error", ok: false, error: "request id is required" });
     return;
   }
+  if (type === "bye") {
+    const reason = typeof request.reason === "string" ? request.reason : "";
+    console.log(`[SOCKET] client said bye${reason ? ` (${reason})` : ""}`);
+    sendSocket(socket, { id, type, ok: true, data: {} });
+    socket.end();
+    return;
+  }
+  if (type === "kv-watch") {
+    try {
+      checkRole(request);
+      const prefix = typeof request.prefix === "string" ? request.prefix : "";
+      const data = await kvGetPayload({ prefix });
+      kvWatches.set(socket, [...(kvWatches.get(socket) ?? []), prefix]);
+      sendSocket(socket, { id, type, ok: true, data });
+    } catch (error) {
+      sendSocket(socket, { id, type, ok: false, error: socketErrorPayload(error) });
+    }
+    return;
+  }
+  if (type === "subscribe") {
+    try {
+      checkRole(request);
+      sendSocket(socket, { id, type, ok: true, data: subscribe(socket, request) });
+    } catch (error) {
+      sendSocket(socket, { id, type, ok: false, error: socketErrorPayload(error) });
+    }
+    return;
+  }
+  if (type === "command-start") {
+    try {
+      checkRole(request);
+      const command = typeof request.command === "string" ? request.command : undefined;
+      if (!command) throw new SocketError("invalid", "command is required");
+      const key = typeof request.idempotencyKey === "string" ? request.idempotencyKey : "";
+      const data = key
+        ? await runIdempotent(`${type}:${key}`, async () => startCommand(socket, command))
+        : startCommand(socket, command);
+      sendSocket(socket, { id, type, ok: true, data });
+    } catch (error) {
+      sendSocket(socket, { id, type, ok: false, error: socketErrorPayload(error) });
+    }
+    return;
+  }
   try {
-    let data: unknown;
-    switch (type) {
-      case "status":
-        data = await getStatusPayload();
-        break;
-      case "command": {
-        const command = typeof request.command === "string" ? request.command : undefined;
-        if (!command) throw new Error("command is required");
-        data = await commandPayload(command);
-        break;
-      }
-      case "play": {
-        const filename = typeof request.filename === "string" ? request.filename : undefined;
-        if (!filename) throw new Error("filename is required");
-        data = await playPayload(filename);
-        break;
-      }
-      case "broadcast": {
-        const message = typeof request.message === "string" ? request.message : undefined;
-        if (!message) throw new Error("message is required");
-        data = await broadcastPayload(message);
-        break;
+    const key = typeof request.idempotencyKey === "string" ? request.idempotencyKey : "";
+    const data = key
+      ? await runIdempotent(`${type}:${key}`, () => runSocketAction(socket, request))
+      : await runSocketAction(socket, request);
+    sendSocket(socket, { id, type, ok: true, data });
+  } catch (error) {
+    sendSocket(socket, { id, type, ok: false, error: socketErrorPayload(error) });
+  }
+}
+
+function readOnlyCommand(command: string) {
+  const [first, second] = command.toLowerCase().trim().split(/\s+/);
+  if (first === "audio") return READ_AUDIO_COMMANDS.has(second ?? "");
+  return READ_COMMANDS.has(first ?? "");
+}
+
+// checkRole throws a forbidden error for actions SOCKET_ROLE does not
+// allow. Clients make the same check from the hello before sending.
+function checkRole(request: SocketRequest) {
+  const type = String(request.type);
+  if (SOCKET_ROLE === "admin") return;
+  let allowed = READ_ACTIONS.has(type) || (SOCKET_ROLE === "operator" && !ADMIN_ACTIONS.has(type));
+  if (SOCKET_ROLE === "read-only" && (type === "command" || type === "command-start")) {
+    allowed = typeof request.command === "string" && readOnlyCommand(request.command);
+  }
+  if (SOCKET_ROLE === "read-only" && type === "tags") {
+    allowed = request.filename === undefined;
+  }
+  if (!allowed) {
+    throw new SocketError("forbidden", `${type} is not allowed for the ${SOCKET_ROLE} role`);
+  }
+}
+
+async function runSocketAction(socket: net.Socket, request: SocketRequest): Promise<unknown> {
+  const { type } = request;
+  checkRole(request);
+  switch (type) {
+    case "status":
+      return await getStatusPayload();
+    case "command": {
+      const command = typeof request.command === "string" ? request.command : undefined;
+      if (!command) throw new Error("command is required");
+      return await commandPayload(command);
+    }
+    case "command-cancel": {
+      const commandId = typeof request.commandId === "string" ? request.commandId : undefined;
+      if (!commandId) throw new SocketError("invalid", "commandId is required");
+      return cancelCommand(commandId);
+    }
+    case "jobs":
+      return jobsPayload();
+    case "job-cancel": {
+      const jobId = typeof request.jobId === "string" ? request.jobId : undefined;
+      if (!jobId) throw new SocketError("invalid", "jobId is required");
+      return cancelCommand(jobId);
+    }
+    case "job-priority": {
+      const jobId = typeof request.jobId === "string" ? request.jobId : undefined;
+      if (!jobId) throw new SocketError("invalid", "jobId is required");
+      if (typeof request.priority !== "number" || !Number.isInteger(request.priority)) {
+        throw new SocketError("invalid", "priority must be an integer");
       }
-      case "broadcast-play": {
-        const filename = typeof request.filename === "string" ? request.filename : undefined;
-        if (!filename) throw new Error("filename is required");
-        data = await broadcastPlayPayload(filename);
-        break;
+      return jobPriorityPayload(jobId, request.priority);
+    }
+    case "peer-ping": {
+      const peer = typeof request.peer === "string" ? request.peer : undefined;
+      if (!peer) throw new SocketError("invalid", "peer is required");
+      const from = typeof request.from === "string" ? request.from : undefined;
+      return await pingPeer(peer, from);
+    }
+    case "peer-files": {
+      const peer = typeof request.peer === "string" ? request.peer : undefined;
+      if (!peer) throw new SocketError("invalid", "peer is required");
+      const path = typeof request.path === "string" ? request.path : "";
+      const answer = await relayToPeer("peer-files", peer, { path });
+      return { peer, path: answer.path ?? path, files: Array.isArray(answer.files) ? answer.files : [] };
+    }
+    case "peer-upload": {
+      const peer = typeof request.peer === "string" ? request.peer : undefined;
+      const filename = typeof request.filename === "string" ? request.filename : undefined;
+      if (!peer || !filename) throw new SocketError("invalid", "peer and filename are required");
+      const answer = await relayToPeer("peer-upload", peer, { filename });
+      return { peer, upload: answer.upload };
+    }
+    case "peer-files-response":
+      return await answerRelayedRequest("peer-files", request);
+    case "peer-upload-response":
+      return await answerRelayedRequest("peer-upload", request);
+    case "peer-config":
+      return await peerConfigPayload();
+    case "peer-config-set": {
+      const peer = typeof request.peer === "string" ? request.peer : undefined;
+      if (!peer) throw new SocketError("invalid", "peer is required");
+      if (typeof request.volume !== "number") throw new SocketError("invalid", "volume is required");
+      return await peerConfigSetPayload(peer, request.volume);
+    }
+    case "zones":
+      return await zonesPayload();
+    case "stats":
+      return await statsPayload();
+    case "clock":
+      return { nowMs: hubNow(), offsetMs: clockOffsetMs, rttMs: clockRttMs };
+    case "zone-set": {
+      const zone = typeof request.zone === "string" ? request.zone : undefined;
+      if (!zone) throw new SocketError("invalid", "zone is required");
+      if (!Array.isArray(request.peers)) throw new SocketError("invalid", "peers is required");
+      return await zoneCommandPayload("set", { name: zone, peers: request.peers });
+    }
+    case "zone-delete": {
+      const zone = typeof request.zone === "string" ? request.zone : undefined;
+      if (!zone) throw new SocketError("invalid", "zone is required");
+      return await zoneCommandPayload("delete", { name: zone });
+    }
+    case "peer-restart":
+    case "peer-update": {
+      const peer = typeof request.peer === "string" ? request.peer : undefined;
+      if (!peer) throw new SocketError("invalid", "peer is required");
+      return await controlPeerPayload(peer, type === "peer-update" ? "update" : "restart");
+    }
+    case "play": {
+      const filename = typeof request.filename === "string" ? request.filename : undefined;
+      if (!filename) throw new Error("filename is required");
+      return await playPayload(filename, request.loop === true, request.normalize === true);
+    }
+    case "broadcast": {
+      const message = typeof request.message === "string" ? request.message : undefined;
+      if (!message) throw new Error("message is required");
+      return await broadcastPayload(message, zoneArg(request));
+    }
+    case "broadcast-play": {
+      const filename = typeof request.filename === "string" ? request.filename : undefined;
+      if (!filename) throw new Error("filename is required");
+      return await broadcastPlayPayload(
+        filename,
+        zoneArg(request),
+        request.sync === true,
+        request.loop === true,
+        request.normalize === true,
+      );
+    }
+    case "broadcast-stop":
+      return await broadcastStopPayload();
+    case "audio-stream":
+      return await audioStreamPayload(request);
+    case "volume":
+    case "pause":
+    case "resume":
+    case "stop":
+    case "seek":
+      return await playbackPayload(type, request);
+    case "kv-get": {
+      const key = typeof request.key === "string" ? request.key : undefined;
+      const prefix = typeof request.prefix === "string" ? request.prefix : undefined;
+      return await kvGetPayload(key !== undefined ? { key } : { prefix: prefix ?? "" });
+    }
+    case "kv-set": {
+      const key = typeof request.key === "string" ? request.key : undefined;
+      if (!key) throw new Error("key is required");
+      if (request.value !== null && typeof request.value !== "string") throw new Error("value must be a string or null");
+      const ttl = typeof request.ttl === "number" && request.ttl > 0 ? request.ttl : undefined;
+      return await kvSetPayload(key, request.value as string | null, ttl);
+    }
+    case "broadcast-image": {
+      const filename = typeof request.filename === "string" ? request.filename : undefined;
+      if (!filename) throw new Error("filename is required");
+      const caption = typeof request.caption === "string" && request.caption ? request.caption : undefined;
+      return await broadcastImagePayload(filename, caption);
+    }
+    case "chat": {
+      const text = typeof request.text === "string" ? request.text : undefined;
+      if (!text) throw new Error("text is required");
+      return await chatPayload("send", { channel: request.channel, text });
+    }
+    case "chat-history": {
+      const limit = typeof request.limit === "number" ? request.limit : undefined;
+      return await chatPayload("history", { channel: request.channel, limit });
+    }
+    case "chat-typing":
+      return await chatPayload("typing", { channel: request.channel });
+    case "clipboard": {
+      const text = typeof request.text === "string" ? request.text : undefined;
+      if (!text) throw new Error("text is required");
+      return await clipboardPayload(text);
+    }
+    case "broadcast-plan": {
+      const action = typeof request.action === "string" ? request.action : undefined;
+      const target = action === "broadcast" ? request.message : request.filename;
+      if (!action || typeof target !== "string" || !target) {
+        throw new Error("action and a filename or message are required");
       }
-      case "upload": {
-        const filename = typeof request.filename === "string" ? request.filename : undefined;
-        const base64 = typeof request.base64 === "string" ? request.base64 : undefined;
-        const contentType = typeof request.contentType === "string" ? request.contentType : undefined;
-        if (!filename || !base64) throw new Error("filename and base64 are required");
-        data = await uploadPayload(filename, base64, contentType);
-        break;
+      return await broadcastPlanPayload(action, target, zoneArg(request));
+    }
+    case "upload": {
+      const filename = typeof request.filename === "string" ? request.filename : undefined;
+      const base64 = typeof request.base64 === "string" ? request.base64 : undefined;
+      const contentType = typeof request.contentType === "string" ? request.contentType : undefined;
+      const metadata =
+        request.metadata && typeof request.metadata === "object" && !Array.isArray(request.metadata)
+          ? (request.metadata as Record<string, unknown>)
+          : undefined;
+      if (!filename || !base64) throw new Error("filename and base64 are required");
+      const temporary = temporaryArg(request);
+      // check what arrived before storing it, and answer with a digest so
+      // the client can tell a verified upload from an unverified one
+      const sha256 = createHash("sha256").update(Buffer.from(base64, "base64")).digest("hex");
+      if (typeof request.sha256 === "string" && request.sha256.toLowerCase() !== sha256) {
+        throw new SocketError("invalid", `checksum mismatch: received ${sha256.slice(0, 12)}, sent ${request.sha256.slice(0, 12)}`);
       }
-      default:
-        throw new Error(`Unknown request type: ${String(type)}`);
+      const result = await uploadPayload(filename, base64, contentType, metadata, temporary);
+      return { ...keepTemporary(socket, result, temporary), sha256: typeof result?.sha256 === "string" ? result.sha256 : sha256 };
     }
-    sendSocket(socket, { id, type, ok: true, data });
-  } catch (error) {
-    const message = error instanceof Error ? error.message : String(error);
-    sendSocket(socket, { id, type, ok: false, error: message });
+    case "upload-begin":
+    case "upload-chunk":
+    case "upload-resume":
+    case "upload-commit":
+    case "upload-cancel":
+      return await chunkedUploadPayload(socket, type, request);
+    case "transfer-offer":
+      return await transferOfferPayload(request);
+    case "transfer-answer":
+    case "transfer-cancel":
+      return await transferSignalPayload(type, request);
+    case "logs":
+      return logsPayload(request);
+    case "files":
+      return await filesPayload();
+    case "storage":
+      return await storagePayload();
+    case "audit": {
+      const count = typeof request.count === "number" && request.count > 0 ? Math.floor(request.count) : 100;
+      const response = (await api.runCommand(`audit ${count}`, descriptor.id)) as { entries?: unknown[]; error?: string };
+      if (response?.error) throw new Error(response.error);
+      return { entries: response.entries ?? [] };
+    }
+    case "delete": {
+      const filename = typeof request.filename === "string" ? request.filename : undefined;
+      if (!filename) throw new Error("filename is required");
+      return await deletePayload(filename);
+    }
+    case "trash":
+      return await trashPayload("list");
+    case "restore": {
+      const filename = typeof request.filename === "string" ? request.filename : undefined;
+      if (!filename) throw new Error("filename is required");
+      return await trashPayload("restore", filename);
+    }
+    case "purge":
+      return await trashPayload("purge", typeof request.filename === "string" ? request.filename : "");
+    case "move": {
+      const filename = typeof request.filename === "string" ? request.filename : undefined;
+      const to = typeof request.to === "string" ? request.to : undefined;
+      if (!filename || !to) throw new Error("filename and to are required");
+      return await movePayload(filename, to);
+    }
+    case "tags": {
+      if (request.filename === undefined) return await tagsPayload();
+      const filename = typeof request.filename === "string" ? request.filename : undefined;
+      if (!filename) throw new Error("filename is required");
+      const tags = Array.isArray(request.tags) ? request.tags.filter((tag) => typeof tag === "string") : [];
+      return await tagsPayload({ filename, tags });
+    }
+    default:
+      throw new Error(`Unknown request type: ${String(type)}`);
   }
 }
 
 async function startSocketInterface(): Promise<boolean> {
   return await new Promise<boolean>((resolve, reject) => {
     const server = net.createServer((socket) => {
-      socket.setEncoding("utf8");
       socketClients.add(socket);
-      socketBuffers.set(socket, "");
+      socketBuffers.set(socket, Buffer.alloc(0));
       console.log(`[SOCKET] client connected from ${socket.remoteAddress}:${socket.remotePort}`);
       sendSocket(socket, {
         type: "event",
@@ -748,6 +2715,11 @@ async function startSocketInterface(): Promise<boolean> {
           host,
           descriptor,
           connectedAt: new Date().toISOString(),
+          version: SOCKET_PROTOCOL_VERSION,
+          role: SOCKET_ROLE,
+          capabilities: SOCKET_CAPABILITIES,
+          protocols: SOCKET_PROTOCOLS,
+          codecs: SOCKET_CODECS,
         },
       });
       void getStatusPayload()
@@ -761,7 +2733,7 @@ async function startSocketInterface(): Promise<boolean> {
             payload: { message: error instanceof Error ? error.message : String(error) },
           });
         });
-      socket.on("data", (chunk) => handleSocketData(socket, chunk));
+      socket.on("data", (chunk: Buffer) => handleSocketData(socket, chunk));
       socket.on("close", () => {
         console.log("[SOCKET] client disconnected");
         removeSocket(socket);
@@ -0,0 +1,101 @@
+// Command brainctl drives the hub from the command line.
+//
+//	brainctl run [-control URL] [-jsonrpc] script.brain
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/signal"
+
+	"brain/internal/hubclient"
+	"brain/internal/script"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: brainctl run [-control URL] [-jsonrpc] script.brain|-")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "run":
+		os.Exit(runScript(os.Args[2:]))
+	default:
+		usage()
+	}
+}
+
+// connect dials the socket for control, defaulting to CLIENT_CONTROL_URL
+// and then the local hub.
+func connect(control string, jsonrpc bool) (*hubclient.Client, error) {
+	if control == "" {
+		control = os.Getenv("CLIENT_CONTROL_URL")
+	}
+	if control == "" {
+		control = hubclient.DefaultControlURL
+	}
+	parsed, err := url.Parse(control)
+	if err != nil {
+		return nil, fmt.Errorf("invalid control URL: %w", err)
+	}
+	addr, err := hubclient.SocketAddress(parsed)
+	if err != nil {
+		return nil, err
+	}
+	client, err := hubclient.DialProxy(addr, hubclient.ProxyFromEnvironment(addr), nil)
+	if err != nil {
+		return nil, err
+	}
+	client.PreferJSONRPC(jsonrpc)
+	return client, nil
+}
+
+func runScript(args []string) int {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	control := fs.String("control", "", "hub control URL (default $CLIENT_CONTROL_URL or "+hubclient.DefaultControlURL+")")
+	jsonrpc := fs.Bool("jsonrpc", false, "use JSON-RPC 2.0 framing if the hub offers it")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		usage()
+	}
+
+	var in io.Reader = os.Stdin
+	if name := fs.Arg(0); name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		defer f.Close()
+		in = f
+	}
+	steps, err := script.Parse(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fs.Arg(0), err)
+		return 2
+	}
+
+	client, err := connect(*control, *jsonrpc)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "connect: %v\n", err)
+		return 1
+	}
+	defer client.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	runner := &script.Runner{Client: client, Out: os.Stdout}
+	if err := runner.Run(ctx, steps); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+	return 0
+}
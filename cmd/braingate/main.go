@@ -0,0 +1,146 @@
+// Command braingate serves the hub's main actions as a REST API for tools
+// such as home automation that cannot speak the socket protocol.
+//
+//	braingate [-control URL] [-listen 127.0.0.1:4460] [-token secret]
+//	          [-mqtt broker [-mqtt-prefix brain]]
+//
+// See package gateway for the endpoints. The token may also be given in
+// BRAINGATE_TOKEN. With -mqtt it also bridges hub events and commands to
+// an MQTT broker, see package mqtt; BRAINGATE_MQTT_USERNAME and
+// BRAINGATE_MQTT_PASSWORD hold the broker login.
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"brain/internal/gateway"
+	"brain/internal/hubclient"
+	"brain/internal/mqtt"
+)
+
+const redialDelay = 3 * time.Second
+
+// hub keeps one socket to the hub open, redialling after it drops.
+type hub struct {
+	addr string
+	// events, when set, sees every event from the hub.
+	events func(hubclient.Message)
+
+	mu     sync.Mutex
+	client *hubclient.Client
+}
+
+func (h *hub) current() *hubclient.Client {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.client
+}
+
+func (h *hub) run(ctx context.Context) {
+	for ctx.Err() == nil {
+		lost := make(chan struct{})
+		var once sync.Once
+		client, err := hubclient.DialProxy(h.addr, hubclient.ProxyFromEnvironment(h.addr), func(msg hubclient.Message) {
+			if h.events != nil {
+				h.events(msg)
+			}
+			if msg.Event == "disconnect" {
+				once.Do(func() { close(lost) })
+			}
+		})
+		if err != nil {
+			log.Printf("connect %s: %v", h.addr, err)
+		} else {
+			log.Printf("connected to %s", h.addr)
+			h.mu.Lock()
+			h.client = client
+			h.mu.Unlock()
+			select {
+			case <-lost:
+				log.Printf("hub connection lost")
+			case <-ctx.Done():
+				client.Close()
+			}
+			h.mu.Lock()
+			h.client = nil
+			h.mu.Unlock()
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(redialDelay):
+		}
+	}
+}
+
+func main() {
+	control := flag.String("control", "", "hub control URL (default $CLIENT_CONTROL_URL or "+hubclient.DefaultControlURL+")")
+	listen := flag.String("listen", "127.0.0.1:4460", "address to serve the REST API on")
+	token := flag.String("token", os.Getenv("BRAINGATE_TOKEN"), "bearer token clients must send; empty allows anyone who can reach -listen")
+	maxUpload := flag.Int64("max-upload", gateway.DefaultMaxUpload, "largest /upload file in bytes")
+	broker := flag.String("mqtt", "", "MQTT broker to bridge events and commands to, e.g. tcp://localhost:1883")
+	prefix := flag.String("mqtt-prefix", mqtt.DefaultPrefix, "MQTT topic prefix")
+	flag.Parse()
+
+	if *control == "" {
+		*control = os.Getenv("CLIENT_CONTROL_URL")
+	}
+	if *control == "" {
+		*control = hubclient.DefaultControlURL
+	}
+	parsed, err := url.Parse(*control)
+	if err != nil {
+		log.Fatalf("invalid control URL: %v", err)
+	}
+	addr, err := hubclient.SocketAddress(parsed)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	h := &hub{addr: addr}
+	if *broker != "" {
+		bridge := mqtt.NewBridge(mqtt.BridgeConfig{
+			Options: mqtt.Options{
+				Broker:   *broker,
+				Username: os.Getenv("BRAINGATE_MQTT_USERNAME"),
+				Password: os.Getenv("BRAINGATE_MQTT_PASSWORD"),
+			},
+			Prefix: *prefix,
+			Client: h.current,
+			Logf:   log.Printf,
+		})
+		h.events = bridge.Event
+		go bridge.Run(ctx)
+	}
+	go h.run(ctx)
+
+	srv := &http.Server{
+		Addr: *listen,
+		Handler: gateway.New(gateway.Config{
+			Client:    h.current,
+			Token:     *token,
+			MaxUpload: *maxUpload,
+			Logf:      log.Printf,
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdown)
+	}()
+	log.Printf("REST gateway on http://%s", *listen)
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,60 @@
+// Command fakehub runs a hub simulator with canned peers, files and events
+// so a client can be developed without the real hub.
+//
+//	fakehub [-control URL] [-events 5s] [-quota bytes] [-empty]
+//
+// Clients given the same control URL connect to its socket; the stored
+// files are served over HTTP on the control port itself.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"os"
+	"os/signal"
+	"time"
+
+	"brain/internal/fakehub"
+	"brain/internal/hubclient"
+)
+
+func main() {
+	control := flag.String("control", hubclient.DefaultControlURL, "control URL clients are given")
+	events := flag.Duration("events", 5*time.Second, "interval between canned events, 0 for none")
+	quota := flag.Int64("quota", 0, "storage quota in bytes, 0 for none")
+	empty := flag.Bool("empty", false, "start with no files")
+	flag.Parse()
+
+	parsed, err := url.Parse(*control)
+	if err != nil {
+		log.Fatalf("invalid control URL: %v", err)
+	}
+	socketAddr, err := hubclient.SocketAddress(parsed)
+	if err != nil {
+		log.Fatal(err)
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = fmt.Sprint(hubclient.DefaultControlPort)
+	}
+	cfg := fakehub.Config{
+		EventInterval: *events,
+		Quota:         *quota,
+		Logf:          log.Printf,
+	}
+	if *empty {
+		cfg.Files = []fakehub.File{}
+	}
+	hub := fakehub.New(cfg)
+	if err := hub.Start(socketAddr, net.JoinHostPort(parsed.Hostname(), port)); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Fprintf(os.Stderr, "fakehub: socket %s, host %s; Ctrl+C to stop\n", hub.SocketAddr(), hub.Host())
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+	hub.Close()
+}
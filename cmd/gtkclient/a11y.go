@@ -0,0 +1,55 @@
+package main
+
+// #cgo pkg-config: gtk+-3.0
+// #include <stdlib.h>
+// #include <gtk/gtk.h>
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// setAccessible gives w the name and description screen readers announce.
+// gotk3 has no ATK bindings, so this goes through cgo. An empty string
+// keeps what GTK derives from the widget's label or tooltip.
+func setAccessible(w gtk.IWidget, name, description string) {
+	if w == nil {
+		return
+	}
+	widget := (*C.GtkWidget)(unsafe.Pointer(w.ToWidget().Native()))
+	obj := C.gtk_widget_get_accessible(widget)
+	if obj == nil {
+		return
+	}
+	if name != "" {
+		cs := C.CString(name)
+		defer C.free(unsafe.Pointer(cs))
+		C.atk_object_set_name(obj, cs)
+	}
+	if description != "" {
+		cs := C.CString(description)
+		defer C.free(unsafe.Pointer(cs))
+		C.atk_object_set_description(obj, cs)
+	}
+}
+
+// mnemonicLabel builds a label whose underlined letter focuses target with
+// Alt, which also makes the label target's accessible name.
+func mnemonicLabel(text string, target gtk.IWidget) *gtk.Label {
+	label, _ := gtk.LabelNewWithMnemonic(text)
+	label.SetMnemonicWidget(target)
+	return label
+}
+
+// isActivateKey reports whether ev is Space or Enter, the keys that press
+// a focused button.
+func isActivateKey(ev *gdk.Event) bool {
+	switch gdk.EventKeyNewFromEvent(ev).KeyVal() {
+	case gdk.KEY_space, gdk.KEY_Return, gdk.KEY_KP_Enter:
+		return true
+	}
+	return false
+}
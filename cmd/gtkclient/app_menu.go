@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// buildHeaderBar replaces the window title bar with one carrying the app
+// menu. The menu items are app.* actions from installActions.
+func (a *app) buildHeaderBar(win *gtk.Window) {
+	bar, err := gtk.HeaderBarNew()
+	if err != nil {
+		return
+	}
+	a.headerBar = bar
+	bar.SetTitle(tr("Brain Hub (GTK)"))
+	bar.SetSubtitle(a.profileName())
+	bar.SetShowCloseButton(true)
+
+	menu := glib.MenuNew()
+	settings := glib.MenuNew()
+	settings.Append(tr("Preferences"), "app.preferences")
+	settings.Append(tr("Event Setups"), "app.event-setups")
+	settings.Append(tr("Command Macros"), "app.macros")
+	settings.Append(tr("Webhooks"), "app.webhooks")
+	settings.Append(tr("Reload Scripts"), "app.reload-scripts")
+	menu.AppendSectionWithoutLabel(&settings.MenuModel)
+	help := glib.MenuNew()
+	help.Append(tr("Command Palette"), "app.palette")
+	help.Append(tr("Keyboard Shortcuts"), "app.shortcuts")
+	help.Append(tr("Diagnostics"), "app.diagnostics")
+	help.Append(tr("Traffic Statistics"), "app.statistics")
+	menu.AppendSectionWithoutLabel(&help.MenuModel)
+	session := glib.MenuNew()
+	session.Append(tr("Recently Played"), "app.recent-plays")
+	session.Append(tr("Trash"), "app.trash")
+	session.Append(tr("Record Session"), "app.record-session")
+	session.Append(tr("Replay Session…"), "app.replay-session")
+	session.Append(tr("Mute Chimes"), "app.mute-chimes")
+	session.Append(tr("Do Not Disturb"), "app.do-not-disturb")
+	session.Append(tr("Sync Clipboard"), "app.clipboard-sync")
+	menu.AppendSectionWithoutLabel(&session.MenuModel)
+	windows := glib.MenuNew()
+	windows.Append(tr("Log in Own Window"), "app.panel-log")
+	windows.Append(tr("Audio Grid in Own Window"), "app.panel-audio")
+	windows.Append(tr("Files in Own Window"), "app.panel-files")
+	windows.Append(tr("Peers in Own Window"), "app.panel-peers")
+	menu.AppendSection(tr("Windows"), &windows.MenuModel)
+	quit := glib.MenuNew()
+	quit.Append(tr("Quit"), "app.quit")
+	menu.AppendSectionWithoutLabel(&quit.MenuModel)
+
+	menuBtn, _ := gtk.MenuButtonNew()
+	icon, _ := gtk.ImageNewFromIconName("open-menu-symbolic", gtk.ICON_SIZE_BUTTON)
+	menuBtn.SetImage(icon)
+	menuBtn.SetMenuModel(&menu.MenuModel)
+	setAccessible(menuBtn, tr("Main menu"), "")
+	a.menuButton = menuBtn
+	bar.PackEnd(menuBtn)
+	win.SetTitlebar(bar)
+}
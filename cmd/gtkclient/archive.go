@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const archiveDownloadTimeout = 5 * time.Minute
+
+var archiveHTTPClient = &http.Client{Timeout: archiveDownloadTimeout}
+
+// setHubHost remembers the hub's websocket URL as reported by hello/status,
+// which is also where its audio files are served over HTTP.
+func (a *app) setHubHost(host string) {
+	if host == "" {
+		return
+	}
+	a.hubMu.Lock()
+	a.hubHost = host
+	a.hubMu.Unlock()
+}
+
+func (a *app) hubAudioURL(filename string) (string, error) {
+	a.hubMu.Lock()
+	host := a.hubHost
+	a.hubMu.Unlock()
+	if host == "" {
+		return "", fmt.Errorf("hub address unknown; refresh status first")
+	}
+	base, err := url.Parse(host)
+	if err != nil {
+		return "", err
+	}
+	switch base.Scheme {
+	case "wss":
+		base.Scheme = "https"
+	case "ws":
+		base.Scheme = "http"
+	}
+	base.Path = strings.TrimRight(base.Path, "/") + "/audio/" + filename
+	return base.String(), nil
+}
+
+// archiveBroadcast downloads a file that was just broadcast-played into the
+// local received folder.
+func (a *app) archiveBroadcast(filename string) {
+	path, size, err := a.downloadHubAudio(filename)
+	if err != nil {
+		a.logf("archive error: %s: %v", filename, err)
+		return
+	}
+	a.logf("archived %s to %s (%s)", filename, path, formatBytes(size))
+}
+
+func (a *app) downloadHubAudio(filename string) (string, int64, error) {
+	target, size, err := a.downloadHubFile(filename)
+	if err != nil {
+		return "", 0, err
+	}
+	go a.cacheWaveform(target, filename)
+	return target, size, nil
+}
+
+// downloadHubFile saves any hub file into the received folder under its
+// base name, made unique.
+func (a *app) downloadHubFile(filename string) (string, int64, error) {
+	src, err := a.hubAudioURL(filename)
+	if err != nil {
+		return "", 0, err
+	}
+	dir, err := a.receiveDir()
+	if err != nil {
+		return "", 0, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", 0, err
+	}
+	resp, err := archiveHTTPClient.Get(src)
+	if err != nil {
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	tmp, err := os.CreateTemp(dir, ".download-*")
+	if err != nil {
+		return "", 0, err
+	}
+	defer os.Remove(tmp.Name())
+	size, err := io.Copy(tmp, resp.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	target, err := placeUnique(tmp.Name(), dir, filepath.Base(filename))
+	if err != nil {
+		return "", 0, err
+	}
+	a.recordTransfer("download", "archive", size)
+	return target, size, nil
+}
+
+// placeUnique moves src into dir under name, appending " (n)" before the
+// extension until it no longer clashes with an existing file.
+func placeUnique(src, dir, name string) (string, error) {
+	ext := filepath.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	for i := 0; i < 10000; i++ {
+		candidate := name
+		if i > 0 {
+			candidate = fmt.Sprintf("%s (%d)%s", stem, i, ext)
+		}
+		target := filepath.Join(dir, candidate)
+		// a hard link fails if target exists, which makes the check and
+		// the claim atomic
+		if err := os.Link(src, target); err == nil {
+			return target, os.Remove(src)
+		} else if !os.IsExist(err) {
+			if _, statErr := os.Stat(target); os.IsNotExist(statErr) {
+				return target, os.Rename(src, target)
+			}
+		}
+	}
+	return "", fmt.Errorf("no free name for %s in %s", name, dir)
+}
+
+func (a *app) receiveDir() (string, error) {
+	if dir := os.Getenv("CLIENT_RECEIVE_DIR"); dir != "" {
+		return dir, nil
+	}
+	if a.profile() != nil && a.profile().ReceiveDir != "" {
+		return a.profile().ReceiveDir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, "Downloads", "brain"), nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+type audioMenuItem struct {
+	label string
+	run   func()
+}
+
+// audioMenuItems lists the secondary actions offered when right-clicking a
+// remote audio button, or pressing the menu key on it. Left click stays
+// broadcast-play.
+func (a *app) audioMenuItems(file audioFile) []audioMenuItem {
+	name := file.Name
+	items := []audioMenuItem{
+		{label: tr("Play locally"), run: func() { go a.invokePlay(name) }},
+		{label: tr("Verify against local copy…"), run: func() { a.chooseVerifyTarget(name) }},
+		{label: tr("Edit tags…"), run: func() { a.editTags(file) }},
+		{label: tr("Assign hotkey…"), run: func() { a.assignSoundboardKey(name) }},
+	}
+	if keys := a.soundboardLabel(name); keys != "" {
+		items = append(items, audioMenuItem{label: fmt.Sprintf(tr("Remove hotkey (%s)"), keys), run: func() { a.clearSoundboardKeys(name) }})
+	}
+	return items
+}
+
+func (a *app) attachAudioMenu(btn *gtk.Button, file audioFile) {
+	btn.Connect("button-press-event", func(_ *gtk.Button, ev *gdk.Event) bool {
+		button := gdk.EventButtonNewFromEvent(ev)
+		if button.Type() != gdk.EVENT_BUTTON_PRESS || button.Button() != gdk.BUTTON_SECONDARY {
+			return false
+		}
+		menu := a.audioMenu(file)
+		if menu == nil {
+			return false
+		}
+		menu.PopupAtPointer(ev)
+		return true
+	})
+	// Shift+F10 and the menu key
+	btn.Connect("popup-menu", func() bool {
+		menu := a.audioMenu(file)
+		if menu == nil {
+			return false
+		}
+		menu.PopupAtWidget(btn, gdk.Gravity(gdk.GDK_GRAVITY_SOUTH_WEST), gdk.Gravity(gdk.GDK_GRAVITY_NORTH_WEST), nil)
+		menu.SelectFirst(true)
+		return true
+	})
+}
+
+func (a *app) audioMenu(file audioFile) *gtk.Menu {
+	menu, err := gtk.MenuNew()
+	if err != nil {
+		return nil
+	}
+	for _, item := range a.audioMenuItems(file) {
+		item := item
+		mi, err := gtk.MenuItemNewWithLabel(item.label)
+		if err != nil {
+			continue
+		}
+		mi.Connect("activate", func() { item.run() })
+		menu.Append(mi)
+	}
+	menu.ShowAll()
+	return menu
+}
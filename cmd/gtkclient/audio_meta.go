@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"brain/internal/audiotag"
+	"brain/internal/hubclient"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// readAudioMeta reads duration, bitrate and tags from a file about to be
+// uploaded, and measures its loudness. Files it cannot read are uploaded
+// without them.
+func (a *app) readAudioMeta(path string) *hubclient.AudioMeta {
+	meta := &hubclient.AudioMeta{}
+	info, err := audiotag.ReadFile(path)
+	switch {
+	case err == nil:
+		meta.Duration = info.Duration.Seconds()
+		meta.Bitrate = info.Bitrate
+		meta.Title = info.Title
+		meta.Artist = info.Artist
+		meta.Album = info.Album
+	case !errors.Is(err, audiotag.ErrUnknownFormat):
+		a.logf("audio tag read error for %s: %v", path, err)
+	}
+	if strings.HasPrefix(hubclient.ContentType(path), "audio/") {
+		a.readLoudness(path, meta)
+	}
+	if *meta == (hubclient.AudioMeta{}) {
+		return nil
+	}
+	return meta
+}
+
+// withTags fills in what meta lacks from known, such as a downloader's
+// description of the page a file came from. Either may be nil.
+func withTags(meta, known *hubclient.AudioMeta) *hubclient.AudioMeta {
+	if known == nil {
+		return meta
+	}
+	if meta == nil {
+		meta = &hubclient.AudioMeta{}
+	}
+	if meta.Title == "" {
+		meta.Title = known.Title
+	}
+	if meta.Artist == "" {
+		meta.Artist = known.Artist
+	}
+	if meta.Album == "" {
+		meta.Album = known.Album
+	}
+	if meta.Duration == 0 {
+		meta.Duration = known.Duration
+	}
+	return meta
+}
+
+// readLoudness fills in meta's loudness and ReplayGain, sharing the
+// waveform decoder slot.
+func (a *app) readLoudness(path string, meta *hubclient.AudioMeta) {
+	select {
+	case waveformSlot <- struct{}{}:
+	case <-a.ctx.Done():
+		return
+	}
+	lufs, err := measureLoudness(a.ctx, path)
+	<-waveformSlot
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			a.logf("loudness skipped for %s: gst-launch-1.0 is not installed", path)
+		} else {
+			a.logf("loudness error for %s: %v", path, err)
+		}
+		return
+	}
+	meta.Loudness = math.Round(lufs*100) / 100
+	meta.ReplayGain = math.Round((hubclient.ReplayGainReference-lufs)*100) / 100
+	a.logf("%s: %.1f LUFS, ReplayGain %+.1f dB", path, meta.Loudness, meta.ReplayGain)
+}
+
+// audioDisplayName is "Artist – Title" for tagged files and the file name
+// otherwise.
+func audioDisplayName(file audioFile) string {
+	switch {
+	case file.Title != "" && file.Artist != "":
+		return file.Artist + " – " + file.Title
+	case file.Title != "":
+		return file.Title
+	}
+	return file.Name
+}
+
+// audioTagDetails is the tooltip text for what the label leaves out.
+func audioTagDetails(file audioFile) string {
+	var lines []string
+	if file.Title != "" {
+		lines = append(lines, fmt.Sprintf(tr("File: %s"), file.Name))
+	}
+	if file.Album != "" {
+		lines = append(lines, fmt.Sprintf(tr("Album: %s"), file.Album))
+	}
+	if file.Bitrate > 0 {
+		lines = append(lines, fmt.Sprintf(tr("%d kbps"), (file.Bitrate+500)/1000))
+	}
+	if file.Loudness != 0 {
+		lines = append(lines, fmt.Sprintf(tr("%.1f LUFS"), file.Loudness))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sortAudioFiles returns files in the order picked by the sort combo,
+// leaving files unchanged. Favorites come first, and files without the
+// sort key go last.
+func sortAudioFiles(files []audioFile, order string) []audioFile {
+	sorted := append([]audioFile(nil), files...)
+	var less func(x, y audioFile) bool
+	switch order {
+	case "newest":
+		// RFC 3339 times in UTC compare as strings
+		less = func(x, y audioFile) bool { return x.Uploaded > y.Uploaded }
+	case "duration":
+		less = func(x, y audioFile) bool {
+			if (x.Duration > 0) != (y.Duration > 0) {
+				return x.Duration > 0
+			}
+			return x.Duration < y.Duration
+		}
+	case "plays":
+		less = func(x, y audioFile) bool {
+			if x.Plays != y.Plays {
+				return x.Plays > y.Plays
+			}
+			return strings.ToLower(x.Name) < strings.ToLower(y.Name)
+		}
+	default:
+		less = func(x, y audioFile) bool { return strings.ToLower(x.Name) < strings.ToLower(y.Name) }
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if fi, fj := hasTag(sorted[i].Tags, favoriteTag), hasTag(sorted[j].Tags, favoriteTag); fi != fj {
+			return fi
+		}
+		return less(sorted[i], sorted[j])
+	})
+	return sorted
+}
+
+func (a *app) buildAudioToolbar() gtk.IWidget {
+	bar, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	bar.SetMarginStart(4)
+	bar.SetMarginEnd(4)
+	bar.SetMarginTop(2)
+	filterEntry, _ := gtk.SearchEntryNew()
+	filterEntry.SetPlaceholderText(tr("Filter by name or tag"))
+	setAccessible(filterEntry, tr("Filter audio files"), "")
+	filterEntry.Connect("search-changed", func() {
+		a.audioFilter, _ = filterEntry.GetText()
+		if a.audioFiles != nil {
+			a.refreshAudioButtons(a.audioFiles, "")
+		}
+	})
+	bar.PackStart(filterEntry, false, false, 0)
+	favoritesCheck, _ := gtk.CheckButtonNewWithLabel(tr("Favorites only"))
+	favoritesCheck.SetActive(a.profile().FavoritesOnly)
+	favoritesCheck.Connect("toggled", func() {
+		only := favoritesCheck.GetActive()
+		a.updateProfile(func(p *profileConfig) { p.FavoritesOnly = only })
+		if err := a.config.save(); err != nil {
+			a.logf("config save error: %v", err)
+		}
+		if a.audioFiles != nil {
+			a.refreshAudioButtons(a.audioFiles, "")
+		}
+	})
+	bar.PackStart(favoritesCheck, false, false, 0)
+	a.neverPlayedCheck, _ = gtk.CheckButtonNewWithLabel(tr("Never played"))
+	a.neverPlayedCheck.SetActive(a.profile().NeverPlayedOnly)
+	a.neverPlayedCheck.Connect("toggled", func() {
+		only := a.neverPlayedCheck.GetActive()
+		a.updateProfile(func(p *profileConfig) { p.NeverPlayedOnly = only })
+		if err := a.config.save(); err != nil {
+			a.logf("config save error: %v", err)
+		}
+		if a.audioFiles != nil {
+			a.refreshAudioButtons(a.audioFiles, "")
+		}
+	})
+	bar.PackStart(a.neverPlayedCheck, false, false, 0)
+	a.setNeverPlayedAvailable(false)
+	bar.PackStart(a.buildAudioSelectToggle(), false, false, 0)
+	combo, _ := gtk.ComboBoxTextNew()
+	combo.Append("name", tr("Name"))
+	combo.Append("newest", tr("Newest first"))
+	combo.Append("duration", tr("Duration"))
+	combo.Append("plays", tr("Most played"))
+	if !combo.SetActiveID(a.profile().AudioSort) {
+		combo.SetActiveID("name")
+	}
+	combo.Connect("changed", func() {
+		sort := combo.GetActiveID()
+		if sort == "name" {
+			sort = ""
+		}
+		a.updateProfile(func(p *profileConfig) { p.AudioSort = sort })
+		if err := a.config.save(); err != nil {
+			a.logf("config save error: %v", err)
+		}
+		if a.audioFiles != nil {
+			a.refreshAudioButtons(a.audioFiles, "")
+		}
+	})
+	setAccessible(combo, tr("Sort audio files"), "")
+	bar.PackEnd(combo, false, false, 0)
+	// every letter of "Sort by" is already a mnemonic in this window
+	label, _ := gtk.LabelNew(tr("Sort by:"))
+	bar.PackEnd(label, false, false, 0)
+	return bar
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// auditFetch is how many entries the Audit tab asks for.
+const auditFetch = 500
+
+const (
+	auditColTime = iota
+	auditColActor
+	auditColAction
+	auditColTarget
+	auditColTimeRaw
+)
+
+var auditActions = []string{"broadcast", "broadcast-play", "broadcast-image", "upload", "delete", "tags"}
+
+// auditView is the "Audit" tab. All fields are owned by the GTK main
+// loop.
+type auditView struct {
+	store   *gtk.ListStore
+	search  *gtk.SearchEntry
+	action  *gtk.ComboBoxText
+	summary *gtk.Label
+	entries []hubclient.AuditEntry
+}
+
+func (a *app) buildAuditTab() gtk.IWidget {
+	v := &auditView{}
+	a.audit = v
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+
+	bar, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	box.PackStart(bar, false, false, 0)
+	refreshBtn, _ := gtk.ButtonNewWithLabel(tr("Refresh"))
+	setAccessible(refreshBtn, tr("Refresh the audit trail"), "")
+	refreshBtn.Connect("clicked", func() { go a.fetchAudit() })
+	bar.PackStart(refreshBtn, false, false, 0)
+	v.action, _ = gtk.ComboBoxTextNew()
+	v.action.AppendText(tr("All actions"))
+	for _, action := range auditActions {
+		v.action.AppendText(action)
+	}
+	v.action.SetActive(0)
+	setAccessible(v.action, tr("Action"), "")
+	v.action.Connect("changed", func() { a.showAudit() })
+	bar.PackStart(v.action, false, false, 0)
+	v.search, _ = gtk.SearchEntryNew()
+	v.search.SetPlaceholderText(tr("Filter by peer or file"))
+	v.search.Connect("search-changed", func() { a.showAudit() })
+	bar.PackStart(v.search, true, true, 0)
+	v.summary, _ = gtk.LabelNew("")
+	bar.PackEnd(v.summary, false, false, 0)
+
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	scroll.SetVExpand(true)
+	box.PackStart(scroll, true, true, 0)
+	v.store, _ = gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_INT64)
+	view, _ := gtk.TreeViewNewWithModel(v.store)
+	view.SetSearchColumn(auditColTarget)
+	setAccessible(view, tr("Hub audit trail"), "")
+	for _, col := range []struct {
+		title       string
+		shown, sort int
+		expand      bool
+	}{
+		{tr("Time"), auditColTime, auditColTimeRaw, false},
+		{tr("Who"), auditColActor, auditColActor, false},
+		{tr("Action"), auditColAction, auditColAction, false},
+		{tr("What"), auditColTarget, auditColTarget, true},
+	} {
+		renderer, _ := gtk.CellRendererTextNew()
+		column, err := gtk.TreeViewColumnNewWithAttribute(col.title, renderer, "text", col.shown)
+		if err != nil {
+			continue
+		}
+		column.SetResizable(true)
+		column.SetExpand(col.expand)
+		column.SetSortColumnID(col.sort)
+		view.AppendColumn(column)
+	}
+	scroll.Add(view)
+	return box
+}
+
+// fetchAudit loads the hub's audit trail into the Audit tab.
+func (a *app) fetchAudit() {
+	hub := a.currentSocket()
+	if !hub.Supports(protocol.CapAudit) {
+		return
+	}
+	entries, err := hub.Audit(a.ctx, auditFetch)
+	if err != nil {
+		a.reportError("audit", err, a.fetchAudit)
+		return
+	}
+	glib.IdleAdd(func() bool {
+		if a.audit != nil {
+			a.audit.entries = entries
+			a.showAudit()
+		}
+		return false
+	})
+}
+
+// auditActor names a peer by the name the hub gave it, when known. Must
+// run on the GTK main loop.
+func (a *app) auditActor(id string) string {
+	if p := a.peers[id]; p != nil && p.Name != "" {
+		return fmt.Sprintf("%s (%s)", p.Name, id)
+	}
+	return id
+}
+
+// showAudit fills the table with the entries that pass the filters, newest
+// first. Must run on the GTK main loop.
+func (a *app) showAudit() {
+	v := a.audit
+	if v == nil {
+		return
+	}
+	action := ""
+	if v.action.GetActive() > 0 {
+		action = v.action.GetActiveText()
+	}
+	query, _ := v.search.GetText()
+	query = strings.ToLower(strings.TrimSpace(query))
+	v.store.Clear()
+	shown := 0
+	for i := len(v.entries) - 1; i >= 0; i-- {
+		e := v.entries[i]
+		actor := a.auditActor(e.Actor)
+		if action != "" && e.Action != action {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(actor+" "+e.Target), query) {
+			continue
+		}
+		when, raw := e.Time, int64(0)
+		if t, err := time.Parse(time.RFC3339Nano, e.Time); err == nil {
+			when, raw = t.Local().Format("2006-01-02 15:04:05"), t.Unix()
+		}
+		v.store.Set(v.store.Append(),
+			[]int{auditColTime, auditColActor, auditColAction, auditColTarget, auditColTimeRaw},
+			[]interface{}{when, actor, e.Action, e.Target, raw})
+		shown++
+	}
+	v.summary.SetText(fmt.Sprintf(tr("%d of %d actions"), shown, len(v.entries)))
+}
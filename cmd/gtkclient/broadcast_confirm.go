@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// planTimeout bounds the broadcast-plan lookup behind a confirmation, so
+// a slow hub does not hold up the question.
+const planTimeout = 3 * time.Second
+
+// planBroadcast asks the hub who a broadcast, limited to zone when it is
+// set, would reach. It is nil with no error when the hub cannot say.
+func (a *app) planBroadcast(ctx context.Context, action, target, zone string) (*hubclient.BroadcastPlan, error) {
+	hub := a.currentSocket()
+	if !hub.Supports(protocol.CapBroadcastPlan) {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, planTimeout)
+	defer cancel()
+	return hub.PlanBroadcastTo(ctx, action, target, zone)
+}
+
+// planRecipients lists a plan's peers by name, this client last.
+func planRecipients(plan *hubclient.BroadcastPlan) string {
+	var names []string
+	self := false
+	for _, r := range plan.Recipients {
+		if r.Self {
+			self = true
+			continue
+		}
+		name := r.Name
+		if name == "" {
+			name = r.ID
+		}
+		names = append(names, name)
+	}
+	if self {
+		names = append(names, tr("this computer"))
+	}
+	if len(names) == 0 {
+		return tr("No peers are connected.")
+	}
+	return fmt.Sprintf(tr("Reaches %d: %s"), len(names), strings.Join(names, ", "))
+}
+
+func broadcastWhat(action, target, zone string) string {
+	switch {
+	case action == "broadcast-play" && zone != "":
+		return fmt.Sprintf(tr("Play %s in %s"), target, zone)
+	case action == "broadcast-play":
+		return fmt.Sprintf(tr("Play %s on every peer"), target)
+	case zone != "":
+		return fmt.Sprintf(tr("Send “%s” to %s"), target, zone)
+	}
+	return fmt.Sprintf(tr("Send “%s” to every peer"), target)
+}
+
+// confirmBroadcast runs a dry run instead of the broadcast when that mode
+// is on, and asks first with ConfirmBroadcasts or do not disturb. It
+// blocks, so it must not run on the GTK main loop.
+func (a *app) confirmBroadcast(action, target, zone string) bool {
+	if a.dryRun.Load() {
+		a.showBroadcastPlan(action, target, zone)
+		return false
+	}
+	dnd := a.dndActive()
+	if (!dnd && !a.profile().ConfirmBroadcasts) || a.win == nil {
+		return true
+	}
+	detail := ""
+	plan, err := a.planBroadcast(a.ctx, action, target, zone)
+	if err != nil {
+		a.reportError("broadcast plan", err, nil)
+		return false
+	}
+	if plan != nil {
+		detail = "\n" + planRecipients(plan)
+	}
+	answer := make(chan bool, 1)
+	glib.IdleAdd(func() bool {
+		title := tr("Broadcast to every peer?")
+		if zone != "" {
+			title = fmt.Sprintf(tr("Broadcast to %s?"), zone)
+		}
+		if dnd {
+			title = tr("Do not disturb is on")
+		}
+		dialog := gtk.MessageDialogNew(a.win, gtk.DIALOG_MODAL, gtk.MESSAGE_QUESTION, gtk.BUTTONS_NONE, "%s", title)
+		dialog.FormatSecondaryText("%s", broadcastWhat(action, target, zone)+detail)
+		dialog.AddButton(tr("Cancel"), gtk.RESPONSE_CANCEL)
+		dialog.AddButton(tr("Send"), gtk.RESPONSE_ACCEPT)
+		dialog.SetDefaultResponse(gtk.RESPONSE_CANCEL)
+		response := dialog.Run()
+		dialog.Destroy()
+		answer <- response == gtk.RESPONSE_ACCEPT
+		return false
+	})
+	select {
+	case ok := <-answer:
+		if !ok {
+			a.logf("%s %s cancelled", action, target)
+		}
+		return ok
+	case <-a.ctx.Done():
+		return false
+	}
+}
+
+// showBroadcastPlan is the dry run: it shows who a broadcast would reach
+// without sending it.
+func (a *app) showBroadcastPlan(action, target, zone string) {
+	plan, err := a.planBroadcast(a.ctx, action, target, zone)
+	if err != nil {
+		a.reportError("dry run", err, nil)
+		return
+	}
+	var detail string
+	if plan == nil {
+		a.logf("dry run %s %s: the hub cannot list recipients", action, target)
+		detail = tr("This hub cannot say which peers it would reach.")
+	} else {
+		detail = planRecipients(plan)
+		a.logf("dry run %s %s: %d recipients", action, target, len(plan.Recipients))
+	}
+	glib.IdleAdd(func() bool {
+		dialog := gtk.MessageDialogNew(a.win, gtk.DIALOG_MODAL, gtk.MESSAGE_INFO, gtk.BUTTONS_CLOSE,
+			"%s", tr("Dry run: nothing was sent"))
+		dialog.FormatSecondaryText("%s", broadcastWhat(action, target, zone)+"\n"+detail)
+		dialog.Run()
+		dialog.Destroy()
+		return false
+	})
+}
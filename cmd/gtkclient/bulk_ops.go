@@ -0,0 +1,489 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+var errBulkCancelled = errors.New("bulk operation cancelled")
+
+// bulkResult is how one file of a bulk operation went.
+type bulkResult struct {
+	name string
+	err  error
+}
+
+// bulkProgress is the dialog shown while a bulk operation runs. Its
+// widgets are owned by the GTK main loop.
+type bulkProgress struct {
+	dialog *gtk.Dialog
+	label  *gtk.Label
+	bar    *gtk.ProgressBar
+}
+
+// open shows p as a modal dialog whose Cancel, or closing it, calls
+// cancel. Must run on the GTK main loop.
+func (p *bulkProgress) open(parent *gtk.Window, title string, cancel func()) {
+	p.dialog, _ = gtk.DialogNew()
+	p.dialog.SetTitle(title)
+	p.dialog.SetTransientFor(parent)
+	p.dialog.SetModal(true)
+	p.dialog.SetDefaultSize(360, -1)
+	p.dialog.AddButton(tr("Cancel"), gtk.RESPONSE_CANCEL)
+	content, _ := p.dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.SetBorderWidth(8)
+	p.label, _ = gtk.LabelNew("")
+	p.label.SetXAlign(0)
+	content.PackStart(p.label, false, false, 0)
+	p.bar, _ = gtk.ProgressBarNew()
+	p.bar.SetShowText(true)
+	content.PackStart(p.bar, false, false, 0)
+	// closing the window cancels too
+	p.dialog.Connect("response", func() {
+		p.label.SetText(tr("Cancelling…"))
+		cancel()
+	})
+	p.dialog.ShowAll()
+}
+
+// runBulk applies each to names one at a time behind a progress dialog
+// whose Cancel stops before the next file. It returns the results of the
+// files it got to and whether it was cancelled.
+func (a *app) runBulk(title string, names []string, each func(ctx context.Context, name string) error) ([]bulkResult, bool) {
+	opCtx, done := a.startOp("bulk")
+	defer done()
+	ctx, cancel := context.WithCancelCause(opCtx)
+	defer cancel(nil)
+	p := &bulkProgress{}
+	glib.IdleAdd(func() bool {
+		p.open(a.win, title, func() { cancel(errBulkCancelled) })
+		return false
+	})
+	defer glib.IdleAdd(func() bool {
+		p.dialog.Destroy()
+		return false
+	})
+	results := make([]bulkResult, 0, len(names))
+	for i, name := range names {
+		if ctx.Err() != nil {
+			break
+		}
+		glib.IdleAdd(func() bool {
+			p.label.SetText(name)
+			p.bar.SetFraction(float64(i) / float64(len(names)))
+			p.bar.SetText(fmt.Sprintf(tr("%d of %d"), i+1, len(names)))
+			return false
+		})
+		err := each(ctx, name)
+		if err != nil && context.Cause(ctx) == errBulkCancelled {
+			break
+		}
+		results = append(results, bulkResult{name: name, err: err})
+	}
+	return results, context.Cause(ctx) == errBulkCancelled
+}
+
+// reportBulk logs a bulk action and, unless every file went through,
+// lists what failed or was skipped. A non-nil undo is offered for the
+// files that did.
+func (a *app) reportBulk(action, title string, total int, results []bulkResult, cancelled bool, undo func()) {
+	var lines []string
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			lines = append(lines, fmt.Sprintf(tr("✗ %s: %s"), r.name, protocol.Friendly(r.err)))
+		}
+	}
+	done := len(results) - failed
+	a.logf("bulk %s: %d of %d done, %d failed, cancelled %v", action, done, total, failed, cancelled)
+	if skipped := total - len(results); skipped > 0 {
+		lines = append(lines, fmt.Sprintf(tr("Cancelled before %d file(s)"), skipped))
+	}
+	glib.IdleAdd(func() bool {
+		if undo != nil && done > 0 {
+			a.showUndoToast(fmt.Sprintf(tr("%s: %d file(s) done"), title, done), undo)
+		}
+		if len(lines) == 0 {
+			if undo == nil {
+				a.showToastType(gtk.MESSAGE_INFO, fmt.Sprintf(tr("%s: %d file(s) done"), title, done), nil, false)
+			}
+			return false
+		}
+		dialog := gtk.MessageDialogNew(a.win, gtk.DIALOG_DESTROY_WITH_PARENT, gtk.MESSAGE_WARNING, gtk.BUTTONS_CLOSE,
+			"%s", fmt.Sprintf(tr("%s: %d of %d done, %d failed"), title, done, total, failed))
+		dialog.FormatSecondaryText("%s", strings.Join(lines, "\n"))
+		dialog.Connect("response", func() { dialog.Destroy() })
+		dialog.Show()
+		return false
+	})
+}
+
+// confirmDeleteHubFiles deletes the named files, asking once first unless
+// the hub keeps a trash to undo it from.
+func (a *app) confirmDeleteHubFiles(names []string) {
+	switch len(names) {
+	case 0:
+		return
+	case 1:
+		a.confirmDeleteHubFile(names[0])
+		return
+	}
+	client := a.currentSocket()
+	trashed := client.Supports(protocol.CapTrash)
+	if !trashed && !a.confirmDelete(fmt.Sprintf(tr("Delete %d files from the hub?"), len(names))) {
+		return
+	}
+	go func() {
+		title := tr("Deleting files")
+		if trashed {
+			title = tr("Moving files to the trash")
+		}
+		results, cancelled := a.runBulk(title, names, func(ctx context.Context, name string) error {
+			return client.Delete(ctx, name)
+		})
+		var deleted []string
+		for _, r := range results {
+			if r.err == nil {
+				deleted = append(deleted, r.name)
+			}
+		}
+		// idle callbacks run in order, so kept is set before the undo
+		// toast can use it
+		var kept localFileState
+		glib.IdleAdd(func() bool {
+			kept = a.forgetHubFiles(deleted)
+			a.clearAudioSelection(deleted)
+			return false
+		})
+		var undo func()
+		if trashed {
+			undo = func() { go a.restoreHubFiles(deleted, kept) }
+		}
+		a.reportBulk("delete", title, len(names), results, cancelled, undo)
+		a.fetchFiles()
+		a.fetchStatus()
+	}()
+}
+
+// promptMoveHubFiles asks for a folder and moves the named files into it,
+// keeping their base names.
+func (a *app) promptMoveHubFiles(names []string) {
+	if len(names) == 0 {
+		return
+	}
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		a.logf("move dialog error: %v", err)
+		return
+	}
+	dialog.SetTitle(tr("Move Files"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetModal(true)
+	dialog.AddButton(tr("Cancel"), gtk.RESPONSE_CANCEL)
+	dialog.AddButton(tr("Move"), gtk.RESPONSE_ACCEPT)
+	dialog.SetDefaultResponse(gtk.RESPONSE_ACCEPT)
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.SetBorderWidth(8)
+	label, _ := gtk.LabelNew(fmt.Sprintf(tr("Move %d file(s) into the folder (empty for the top level):"), len(names)))
+	label.SetXAlign(0)
+	content.PackStart(label, false, false, 0)
+	entry, _ := gtk.EntryNew()
+	entry.SetPlaceholderText(tr("e.g. archive/2024"))
+	entry.SetActivatesDefault(true)
+	if folder := path.Dir(names[0]); folder != "." {
+		entry.SetText(folder)
+	}
+	setAccessible(entry, tr("Target folder"), "")
+	content.PackStart(entry, false, false, 0)
+	dialog.ShowAll()
+	response := dialog.Run()
+	folder, _ := entry.GetText()
+	dialog.Destroy()
+	if response != gtk.RESPONSE_ACCEPT {
+		return
+	}
+	folder = strings.Trim(strings.TrimSpace(folder), "/")
+	go a.moveHubFiles(names, folder)
+}
+
+func (a *app) moveHubFiles(names []string, folder string) {
+	client := a.currentSocket()
+	title := tr("Moving files")
+	moved := make(map[string]string)
+	results, cancelled := a.runBulk(title, names, func(ctx context.Context, name string) error {
+		to := path.Join(folder, path.Base(name))
+		if to == name {
+			return nil
+		}
+		if err := client.Move(ctx, name, to); err != nil {
+			return err
+		}
+		moved[name] = to
+		return nil
+	})
+	glib.IdleAdd(func() bool {
+		a.renameHubFiles(moved)
+		return false
+	})
+	a.reportBulk("move", title, len(names), results, cancelled, nil)
+	a.fetchFiles()
+	a.fetchStatus()
+	a.fetchPlayStats()
+}
+
+// renameHubFiles carries the hotkeys, local tags and grid selection of
+// moved files over to their new names. Must run on the GTK main loop.
+func (a *app) renameHubFiles(moved map[string]string) {
+	if len(moved) == 0 {
+		return
+	}
+	bound, tagged := false, false
+	a.updateProfile(func(p *profileConfig) {
+		for accel, f := range p.Soundboard {
+			if to, ok := moved[f]; ok {
+				p.Soundboard[accel] = to
+				bound = true
+			}
+		}
+		for from, to := range moved {
+			if tags, ok := p.FileTags[from]; ok {
+				delete(p.FileTags, from)
+				p.FileTags[to] = tags
+				tagged = true
+			}
+		}
+	})
+	for from, to := range moved {
+		if a.audioSelected[from] {
+			delete(a.audioSelected, from)
+			a.audioSelected[to] = true
+		}
+	}
+	if bound {
+		a.saveSoundboard()
+	} else if tagged {
+		if err := a.config.save(); err != nil {
+			a.logf("config save error: %v", err)
+		}
+	}
+}
+
+// downloadHubFiles saves one file to the receive folder as usual, or
+// several into a zip the user names.
+func (a *app) downloadHubFiles(names []string) {
+	switch len(names) {
+	case 0:
+		return
+	case 1:
+		go a.downloadHubFileLogged(names[0])
+		return
+	}
+	dialog, err := gtk.FileChooserDialogNewWith2Buttons(
+		tr("Save files as zip"),
+		a.win,
+		gtk.FILE_CHOOSER_ACTION_SAVE,
+		tr("Cancel"), gtk.RESPONSE_CANCEL,
+		tr("Save"), gtk.RESPONSE_ACCEPT,
+	)
+	if err != nil {
+		a.logf("zip dialog error: %v", err)
+		return
+	}
+	dialog.SetDoOverwriteConfirmation(true)
+	dialog.SetCurrentName("hub-files.zip")
+	if dir, err := a.receiveDir(); err == nil {
+		dialog.SetCurrentFolder(dir)
+	}
+	response := dialog.Run()
+	target := dialog.GetFilename()
+	dialog.Destroy()
+	if response != gtk.RESPONSE_ACCEPT || target == "" {
+		return
+	}
+	go a.downloadZip(names, target)
+}
+
+// downloadZip streams each file from the hub's HTTP endpoint straight into
+// a zip at target, written beside it first so a cancelled download leaves
+// nothing behind.
+func (a *app) downloadZip(names []string, target string) {
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".download-*.zip")
+	if err != nil {
+		a.reportError("download", err, nil)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	zw := zip.NewWriter(tmp)
+	var total int64
+	title := tr("Downloading files")
+	results, cancelled := a.runBulk(title, names, func(ctx context.Context, name string) error {
+		n, err := a.zipHubFile(ctx, zw, name)
+		total += n
+		return err
+	})
+	err = zw.Close()
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	stored := 0
+	for _, r := range results {
+		if r.err == nil {
+			stored++
+		}
+	}
+	if err == nil && !cancelled && stored > 0 {
+		err = os.Rename(tmp.Name(), target)
+	}
+	if err != nil {
+		a.reportError("download", err, nil)
+		return
+	}
+	if !cancelled && stored > 0 {
+		a.recordTransfer("download", "archive", total)
+		a.logf("downloaded %d file(s) to %s (%s)", stored, target, formatBytes(total))
+	}
+	a.reportBulk("download", title, len(names), results, cancelled, nil)
+}
+
+// zipHubFile adds filename to zw under its hub name.
+func (a *app) zipHubFile(ctx context.Context, zw *zip.Writer, filename string) (int64, error) {
+	src, err := a.hubAudioURL(filename)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := archiveHTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	w, err := zw.Create(filename)
+	if err != nil {
+		return 0, err
+	}
+	return io.Copy(w, resp.Body)
+}
+
+// audioBulkBar holds the actions on the files selected in the audio grid.
+// Its widgets are owned by the GTK main loop.
+type audioBulkBar struct {
+	box       *gtk.Box
+	count     *gtk.Label
+	deleteBtn *gtk.Button
+	moveBtn   *gtk.Button
+}
+
+// buildAudioSelectToggle is the audio toolbar's Select button, which
+// turns the grid's buttons into checkboxes for the bulk actions.
+func (a *app) buildAudioSelectToggle() gtk.IWidget {
+	toggle, _ := gtk.ToggleButtonNewWithLabel(tr("Select"))
+	toggle.SetTooltipText(tr("Select several files to delete, move or download together"))
+	toggle.Connect("toggled", func() {
+		a.audioSelecting = toggle.GetActive()
+		a.audioSelected = nil
+		if a.audioSelecting {
+			a.audioSelected = make(map[string]bool)
+			a.audioBulk.box.Show()
+		} else {
+			a.audioBulk.box.Hide()
+		}
+		a.updateAudioBulkBar()
+		if a.audioFiles != nil {
+			a.refreshAudioButtons(a.audioFiles, "")
+		}
+	})
+	return toggle
+}
+
+func (a *app) buildAudioBulkBar() gtk.IWidget {
+	b := &audioBulkBar{}
+	a.audioBulk = b
+	b.box, _ = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	b.box.SetMarginStart(4)
+	b.box.SetMarginEnd(4)
+	b.box.SetNoShowAll(true)
+	b.count, _ = gtk.LabelNew("")
+	b.box.PackStart(b.count, false, false, 0)
+	downloadBtn, _ := gtk.ButtonNewWithLabel(tr("Download"))
+	downloadBtn.SetTooltipText(tr("Download the selected file, or several as one zip"))
+	downloadBtn.Connect("clicked", func() { a.downloadHubFiles(a.audioSelectedNames()) })
+	b.box.PackEnd(downloadBtn, false, false, 0)
+	b.moveBtn, _ = gtk.ButtonNewWithLabel(tr("Move…"))
+	b.moveBtn.Connect("clicked", func() { a.promptMoveHubFiles(a.audioSelectedNames()) })
+	b.box.PackEnd(b.moveBtn, false, false, 0)
+	b.deleteBtn, _ = gtk.ButtonNewWithLabel(tr("Delete"))
+	b.deleteBtn.Connect("clicked", func() { a.confirmDeleteHubFiles(a.audioSelectedNames()) })
+	b.box.PackEnd(b.deleteBtn, false, false, 0)
+	client := a.currentSocket()
+	a.setFilesDeletable(client.Supports(protocol.CapDelete) && client.Allows("delete"))
+	a.setFilesMovable(client.Supports(protocol.CapMove) && client.Allows("move"))
+	for _, w := range []gtk.IWidget{b.count, downloadBtn, b.moveBtn, b.deleteBtn} {
+		w.ToWidget().Show()
+	}
+	return b.box
+}
+
+// newAudioSelectCheck is the checkbox for filename in selection mode.
+func (a *app) newAudioSelectCheck(filename string) *gtk.CheckButton {
+	check, _ := gtk.CheckButtonNew()
+	check.SetActive(a.audioSelected[filename])
+	setAccessible(check, fmt.Sprintf(tr("Select %s"), filename), "")
+	check.Connect("toggled", func() {
+		if check.GetActive() {
+			a.audioSelected[filename] = true
+		} else {
+			delete(a.audioSelected, filename)
+		}
+		a.updateAudioBulkBar()
+	})
+	return check
+}
+
+// audioSelectedNames lists the selected files still on the hub, in the
+// hub's order.
+func (a *app) audioSelectedNames() []string {
+	var names []string
+	for _, f := range a.audioFiles {
+		if a.audioSelected[f.Name] {
+			names = append(names, f.Name)
+		}
+	}
+	return names
+}
+
+// clearAudioSelection unselects names. Must run on the GTK main loop.
+func (a *app) clearAudioSelection(names []string) {
+	for _, name := range names {
+		delete(a.audioSelected, name)
+	}
+	a.updateAudioBulkBar()
+}
+
+func (a *app) updateAudioBulkBar() {
+	if a.audioBulk == nil {
+		return
+	}
+	a.audioBulk.count.SetText(fmt.Sprintf(tr("%d selected"), len(a.audioSelectedNames())))
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// helloWait bounds how long connect-time work waits for the hub's hello
+// before going ahead without knowing its capabilities.
+const helloWait = 2 * time.Second
+
+// afterHello checks the hub's protocol version, gates the UI on its
+// capabilities and then runs the work that follows every connect.
+func (a *app) afterHello(client *hubclient.Client) {
+	ctx, cancel := context.WithTimeout(a.ctx, helloWait)
+	hello := client.WaitHello(ctx)
+	cancel()
+	if hello != nil {
+		a.helloArrived(hello)
+		a.negotiateFraming(client, hello)
+	} else if a.ctx.Err() == nil && a.currentSocket() == client {
+		a.setConnState(stateDegraded, reasonNoHello, nil)
+		go a.lateHello(client)
+	}
+	go a.applySubscription()
+	go a.flushOutbox()
+	go a.loadHubLogHistory()
+	go a.fetchAudit()
+	go a.watchKV()
+	go a.fetchZones()
+	go a.fetchPlayStats()
+	go a.measureHubClock()
+	a.panelsConnected(client)
+	go a.resumePendingUploads()
+	glib.IdleAdd(func() bool {
+		a.dispatchScriptEvent(scriptConnected, a.profileName(), map[string]any{"text": a.profileName()})
+		if a.syncer != nil {
+			a.syncer.SyncNow()
+		}
+		return false
+	})
+}
+
+// lateHello finishes the handshake for a hub that answered after helloWait.
+func (a *app) lateHello(client *hubclient.Client) {
+	if hello := client.WaitHello(a.ctx); hello != nil && a.currentSocket() == client {
+		a.helloArrived(hello)
+		a.negotiateFraming(client, hello)
+	}
+}
+
+// negotiateFraming moves the socket to length-prefixed frames when the hub
+// offers them, unless the profile pins newline framing.
+func (a *app) negotiateFraming(client *hubclient.Client, hello *protocol.Hello) {
+	if !hello.Speaks(protocol.FramingLengthPrefixed) || (a.profile() != nil && a.profile().Framing == "newline") {
+		return
+	}
+	codec := ""
+	if a.profile() != nil && a.profile().Codec != "" {
+		switch {
+		case client.JSONRPC():
+			a.logf("socket codec: %s is not used with JSON-RPC", a.profile().Codec)
+		case hello.HasCodec(a.profile().Codec):
+			codec = a.profile().Codec
+		default:
+			a.logf("socket codec: hub does not offer %s, using json", a.profile().Codec)
+		}
+	}
+	ctx, cancel := context.WithTimeout(a.ctx, helloWait)
+	defer cancel()
+	if err := client.UseLengthPrefixed(ctx, codec); err != nil {
+		a.logf("socket framing: staying on newlines: %v", err)
+		return
+	}
+	a.logf("socket framing: %s, codec %s", protocol.FramingLengthPrefixed, client.Codec())
+	if client.BinaryFrames() {
+		a.logf("socket framing: file data in binary frames")
+	}
+}
+
+func (a *app) helloArrived(hello *protocol.Hello) {
+	a.logf("hub %s", hello)
+	warn := hello.Compatibility()
+	if warn != "" {
+		a.logf("protocol warning: %s", warn)
+		glib.IdleAdd(func() bool {
+			a.showToastType(gtk.MESSAGE_WARNING, tr("Protocol mismatch: ")+warn, nil, false)
+			return false
+		})
+		a.setConnState(stateDegraded, "protocol mismatch", nil)
+	} else {
+		a.setConnState(stateConnected, "", nil)
+	}
+	a.applyCapabilities(hello)
+}
+
+// roleGate is a control whose action the client's role may forbid.
+type roleGate struct {
+	action string
+	widget *gtk.Widget
+}
+
+// gateOnRole disables w while the hub's role for this client does not
+// allow action. Must run on the GTK main loop.
+func (a *app) gateOnRole(action string, w gtk.IWidget) {
+	a.roleGated = append(a.roleGated, roleGate{action: action, widget: w.ToWidget()})
+}
+
+// applyCapabilities disables controls for actions the hub does not offer,
+// or that the role it gave this client does not allow.
+func (a *app) applyCapabilities(hello *protocol.Hello) {
+	role := hello.Role
+	if role == "" {
+		role = protocol.RoleAdmin
+	}
+	playback := hello.Has(protocol.CapPlayback) && role.Allows("volume")
+	nowPlaying := hello.Has(protocol.CapNowPlaying)
+	deletable := hello.Has(protocol.CapDelete) && role.Allows("delete")
+	movable := hello.Has(protocol.CapMove) && role.Allows("move")
+	trash := hello.Has(protocol.CapTrash)
+	controllable := hello.Has(protocol.CapPeerControl)
+	peerFiles := hello.Has(protocol.CapPeerFiles)
+	intercom := hello.Has(protocol.CapAudioStream)
+	logs := hello.Has(protocol.CapLogs)
+	zones := hello.Has(protocol.CapZones)
+	syncPlay := hello.Has(protocol.CapSyncPlay)
+	stoppable := hello.Has(protocol.CapBroadcastStop)
+	temporary := hello.Has(protocol.CapTemporary)
+	direct := hello.Has(protocol.CapDirectTransfer)
+	glib.IdleAdd(func() bool {
+		a.applyRole(role)
+		a.setFilesDeletable(deletable)
+		a.setFilesMovable(movable)
+		a.setTrashAvailable(trash)
+		a.setPeerControllable(controllable, role)
+		a.setPeerFilesAvailable(peerFiles)
+		a.setIntercomAvailable(intercom, role)
+		a.setHubLogsAvailable(logs)
+		a.setZonesAvailable(zones)
+		a.setSyncPlayAvailable(syncPlay)
+		a.setStopAvailable(stoppable, role)
+		a.setTemporaryAvailable(temporary)
+		a.setDirectTransferAvailable(direct, role)
+		if a.nowPlayingLabel != nil {
+			a.nowPlayingLabel.SetVisible(nowPlaying)
+		}
+		if a.playbackBox == nil {
+			return false
+		}
+		a.playbackBox.SetSensitive(playback)
+		switch {
+		case playback:
+			a.playbackBox.SetTooltipText("")
+		case !role.Allows("volume"):
+			a.playbackBox.SetTooltipText(roleTooltip(role))
+		default:
+			a.playbackBox.SetTooltipText(tr("This hub does not support playback control"))
+		}
+		return false
+	})
+}
+
+func roleTooltip(role protocol.Role) string {
+	return fmt.Sprintf(tr("Your role on this hub (%s) does not allow this"), role)
+}
+
+// applyRole must run on the GTK main loop.
+func (a *app) applyRole(role protocol.Role) {
+	if role != protocol.RoleAdmin {
+		a.logf("hub role: %s", role)
+	}
+	for _, g := range a.roleGated {
+		allowed := role.Allows(g.action)
+		g.widget.SetSensitive(allowed)
+		if allowed {
+			g.widget.SetTooltipText("")
+		} else {
+			g.widget.SetTooltipText(roleTooltip(role))
+		}
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	// chatHistoryLimit is how many messages a channel loads on connect.
+	chatHistoryLimit = 100
+	// chatTypingEvery spaces the typing notices this client sends.
+	chatTypingEvery = 3 * time.Second
+	// chatTypingShown is how long someone shows as typing after a notice.
+	chatTypingShown = 5 * time.Second
+)
+
+// chatPanel is the Chat tab: channels of short messages between peers,
+// with history from the hub, typing notices and an unread badge. All
+// fields are owned by the GTK main loop.
+type chatPanel struct {
+	host     *panelHost
+	channels *gtk.ComboBoxText
+	view     *gtk.TextView
+	buffer   *gtk.TextBuffer
+	entry    *gtk.Entry
+	typing   *gtk.Label
+
+	channel    string
+	messages   map[string][]hubclient.ChatMessage
+	unread     map[string]int
+	typers     map[string]time.Time
+	listed     map[string]bool
+	lastTyping time.Time
+}
+
+func init() { registerPanel(0, &chatPanel{}) }
+
+func (p *chatPanel) Title() string { return tr("Chat") }
+
+func (p *chatPanel) Build(host *panelHost) gtk.IWidget {
+	p.host = host
+	p.channel = protocol.DefaultChatChannel
+	p.messages = make(map[string][]hubclient.ChatMessage)
+	p.unread = make(map[string]int)
+	p.typers = make(map[string]time.Time)
+	p.listed = map[string]bool{protocol.DefaultChatChannel: true}
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+
+	bar, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	box.PackStart(bar, false, false, 0)
+	p.channels, _ = gtk.ComboBoxTextNewWithEntry()
+	p.channels.SetTooltipText(tr("Pick a channel, or type a new one and press Enter"))
+	p.channels.AppendText(protocol.DefaultChatChannel)
+	p.channels.SetActive(0)
+	p.channels.Connect("changed", func() {
+		if p.channels.GetActive() >= 0 {
+			p.switchChannel(p.channels.GetActiveText())
+		}
+	})
+	if child, err := p.channels.GetChild(); err == nil {
+		if entry, ok := child.(*gtk.Entry); ok {
+			entry.Connect("activate", func() { p.switchChannel(p.channels.GetActiveText()) })
+		}
+	}
+	bar.PackStart(mnemonicLabel(tr("C_hannel:"), p.channels), false, false, 0)
+	bar.PackStart(p.channels, false, false, 0)
+	p.typing, _ = gtk.LabelNew("")
+	addStyleClass(p.typing, "dim-label")
+	bar.PackEnd(p.typing, false, false, 0)
+
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	scroll.SetVExpand(true)
+	box.PackStart(scroll, true, true, 0)
+	p.view, _ = gtk.TextViewNew()
+	p.view.SetEditable(false)
+	p.view.SetCursorVisible(false)
+	p.view.SetWrapMode(gtk.WRAP_WORD_CHAR)
+	setAccessible(p.view, tr("Chat messages"), "")
+	scroll.Add(p.view)
+	p.buffer, _ = p.view.GetBuffer()
+
+	send, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	box.PackStart(send, false, false, 0)
+	host.GateOnRole("chat", send)
+	p.entry, _ = gtk.EntryNew()
+	p.entry.SetPlaceholderText(tr("Message"))
+	p.entry.SetMaxLength(protocol.MaxChatBytes)
+	setAccessible(p.entry, tr("Chat message"), "")
+	p.entry.Connect("changed", func() {
+		if text, _ := p.entry.GetText(); text != "" && time.Since(p.lastTyping) >= chatTypingEvery {
+			p.lastTyping = time.Now()
+			go p.sendTyping(p.channel)
+		}
+	})
+	sendBtn, _ := gtk.ButtonNewWithLabel(tr("Send"))
+	sendBtn.Connect("clicked", func() {
+		text, _ := p.entry.GetText()
+		if strings.TrimSpace(text) == "" {
+			return
+		}
+		p.entry.SetText("")
+		p.lastTyping = time.Time{}
+		go p.send(p.channel, text)
+	})
+	p.entry.Connect("activate", func() { sendBtn.Clicked() })
+	send.PackStart(p.entry, true, true, 0)
+	send.PackEnd(sendBtn, false, false, 0)
+	return box
+}
+
+func (p *chatPanel) Connected(client *hubclient.Client) {
+	if !client.Supports(protocol.CapChat) {
+		p.typing.SetText(tr("This hub has no chat"))
+		return
+	}
+	p.typing.SetText("")
+	for channel := range p.knownChannels() {
+		go p.loadHistory(client, channel)
+	}
+}
+
+func (p *chatPanel) Disconnected(error) {
+	p.typers = make(map[string]time.Time)
+	p.typing.SetText("")
+}
+
+func (p *chatPanel) Event(msg hubclient.Message) {
+	switch msg.Event {
+	case protocol.EventChat:
+		var m hubclient.ChatMessage
+		if err := json.Unmarshal(msg.JSONPayload(), &m); err != nil {
+			p.host.Logf("chat event parse error: %v", err)
+			return
+		}
+		p.add(m)
+	case protocol.EventChatTyping:
+		var t hubclient.ChatTyping
+		if err := json.Unmarshal(msg.JSONPayload(), &t); err != nil || t.Channel != p.channel {
+			return
+		}
+		p.typers[t.From] = time.Now()
+		p.showTyping()
+		glib.TimeoutAdd(uint(chatTypingShown/time.Millisecond), func() bool {
+			p.showTyping()
+			return false
+		})
+	}
+}
+
+func (p *chatPanel) Shown() {
+	p.unread[p.channel] = 0
+	p.showBadge()
+}
+
+// knownChannels is every channel this session has shown.
+func (p *chatPanel) knownChannels() map[string]bool {
+	out := map[string]bool{p.channel: true}
+	for channel := range p.messages {
+		out[channel] = true
+	}
+	return out
+}
+
+func (p *chatPanel) loadHistory(client *hubclient.Client, channel string) {
+	messages, err := client.ChatHistory(p.host.Context(), channel, chatHistoryLimit)
+	if err != nil {
+		p.host.ReportError("chat history", err, func() { p.loadHistory(p.host.Client(), channel) })
+		return
+	}
+	glib.IdleAdd(func() bool {
+		p.messages[channel] = messages
+		if channel == p.channel {
+			p.showMessages()
+		}
+		return false
+	})
+}
+
+func (p *chatPanel) send(channel, text string) {
+	if _, err := p.host.Client().Chat(p.host.Context(), channel, text); err != nil {
+		p.host.ReportError("chat", err, func() { p.send(channel, text) })
+	}
+}
+
+func (p *chatPanel) sendTyping(channel string) {
+	if client := p.host.Client(); client.Supports(protocol.CapChat) {
+		_ = client.ChatTyping(p.host.Context(), channel)
+	}
+}
+
+// add shows a message from a chat event, counting it unread unless its
+// channel is in front.
+func (p *chatPanel) add(m hubclient.ChatMessage) {
+	list := p.messages[m.Channel]
+	for _, old := range list {
+		if old.ID == m.ID {
+			return
+		}
+	}
+	p.messages[m.Channel] = append(list, m)
+	if len(p.messages[m.Channel]) > chatHistoryLimit {
+		p.messages[m.Channel] = p.messages[m.Channel][1:]
+	}
+	delete(p.typers, m.From)
+	p.showTyping()
+	p.listChannel(m.Channel)
+	if m.Channel == p.channel {
+		p.appendMessage(m)
+	}
+	if m.Channel != p.channel || !p.host.Showing(p) {
+		p.unread[m.Channel]++
+	}
+	p.showBadge()
+}
+
+func (p *chatPanel) switchChannel(channel string) {
+	channel = strings.TrimSpace(channel)
+	if channel == "" || channel == p.channel {
+		return
+	}
+	p.channel = channel
+	p.listChannel(channel)
+	p.unread[channel] = 0
+	p.typers = make(map[string]time.Time)
+	p.showTyping()
+	p.showBadge()
+	p.showMessages()
+	if _, ok := p.messages[channel]; !ok {
+		p.messages[channel] = nil
+		if client := p.host.Client(); client.Supports(protocol.CapChat) {
+			go p.loadHistory(client, channel)
+		}
+	}
+}
+
+// listChannel adds channel to the picker the first time it is seen.
+func (p *chatPanel) listChannel(channel string) {
+	if !p.listed[channel] {
+		p.listed[channel] = true
+		p.channels.AppendText(channel)
+	}
+}
+
+func (p *chatPanel) showMessages() {
+	p.buffer.SetText("")
+	for _, m := range p.messages[p.channel] {
+		p.appendMessage(m)
+	}
+}
+
+func (p *chatPanel) appendMessage(m hubclient.ChatMessage) {
+	stamp := m.Time
+	if t, err := time.Parse(time.RFC3339Nano, m.Time); err == nil {
+		stamp = t.Local().Format("15:04")
+	}
+	p.buffer.Insert(p.buffer.GetEndIter(), fmt.Sprintf("[%s] %s: %s\n", stamp, p.host.PeerName(m.From), m.Text))
+	p.view.ScrollToMark(p.buffer.GetInsert(), 0, false, 0, 1)
+}
+
+// showTyping lists who typed in the channel lately.
+func (p *chatPanel) showTyping() {
+	var names []string
+	for id, at := range p.typers {
+		if time.Since(at) >= chatTypingShown {
+			delete(p.typers, id)
+			continue
+		}
+		names = append(names, p.host.PeerName(id))
+	}
+	sort.Strings(names)
+	switch len(names) {
+	case 0:
+		p.typing.SetText("")
+	case 1:
+		p.typing.SetText(fmt.Sprintf(tr("%s is typing…"), names[0]))
+	default:
+		p.typing.SetText(fmt.Sprintf(tr("%s are typing…"), strings.Join(names, ", ")))
+	}
+}
+
+// showBadge counts unread messages on the tab and on other channels.
+func (p *chatPanel) showBadge() {
+	total := 0
+	for _, n := range p.unread {
+		total += n
+	}
+	p.host.SetBadge(p, total)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"brain/internal/hubclient"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+func fileSHA256(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(h.Sum(nil)), n, nil
+}
+
+// chooseVerifyTarget picks the local copy to compare against: the received
+// folder copy when there is one, otherwise whatever the user selects. Must
+// run on the GTK main loop.
+func (a *app) chooseVerifyTarget(name string) {
+	if dir, err := a.receiveDir(); err == nil {
+		local := filepath.Join(dir, filepath.Base(name))
+		if _, err := os.Stat(local); err == nil {
+			go a.verifyRemoteFile(name, local)
+			return
+		}
+	}
+	dialog, err := gtk.FileChooserDialogNewWith2Buttons(
+		fmt.Sprintf("Select local copy of %s", name),
+		a.win,
+		gtk.FILE_CHOOSER_ACTION_OPEN,
+		"Cancel", gtk.RESPONSE_CANCEL,
+		"Verify", gtk.RESPONSE_ACCEPT,
+	)
+	if err != nil {
+		a.logf("verify dialog error: %v", err)
+		return
+	}
+	defer dialog.Destroy()
+	if dialog.Run() == gtk.RESPONSE_ACCEPT {
+		go a.verifyRemoteFile(name, dialog.GetFilename())
+	}
+}
+
+func (a *app) verifyRemoteFile(name, local string) {
+	localSum, localSize, err := fileSHA256(local)
+	if err != nil {
+		a.reportError("verify", err, nil)
+		return
+	}
+	res, err := a.currentSocket().Hash(a.ctx, name)
+	if err != nil {
+		a.reportError("verify", err, func() { a.verifyRemoteFile(name, local) })
+		return
+	}
+	if res.SHA256 == "" {
+		a.reportError("verify", fmt.Errorf("hub returned no checksum for %s", name), nil)
+		return
+	}
+	if !strings.EqualFold(res.SHA256, localSum) {
+		err := fmt.Errorf("%w: %s is %s (%s) on the hub but %s (%s) locally", hubclient.ErrChecksumMismatch,
+			name, hubclient.ShortDigest(res.SHA256), formatBytes(res.Size), hubclient.ShortDigest(localSum), formatBytes(localSize))
+		a.reportError("verify", err, nil)
+		return
+	}
+	a.logf("verify ok: %s matches %s (sha256 %s)", name, local, hubclient.ShortDigest(localSum))
+}
+
+// warnUnverified flags an upload the hub stored without confirming its
+// digest, so it is not mistaken for a verified one.
+func (a *app) warnUnverified(res *hubclient.UploadResult) {
+	if res.Verified {
+		return
+	}
+	a.logf("upload of %s is unverified: the hub returned no checksum", res.Filename)
+	glib.IdleAdd(func() bool {
+		a.showToastType(gtk.MESSAGE_WARNING, fmt.Sprintf(tr("%s was uploaded, but the hub did not confirm its checksum"), res.Filename), nil, false)
+		return false
+	})
+}
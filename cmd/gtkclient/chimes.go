@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	// chimeGap stops a burst of events from stacking up the same sound.
+	chimeGap     = time.Second
+	chimeTimeout = 30 * time.Second
+)
+
+// chimeKind is an event that can play a local sound.
+type chimeKind struct {
+	id    string
+	title string
+}
+
+func chimeKinds() []chimeKind {
+	return []chimeKind{
+		{"hub-message", tr("Hub message")},
+		{"peer-join", tr("Peer joined")},
+		{"peer-leave", tr("Peer left")},
+		{"broadcast-play", tr("Broadcast from a peer")},
+	}
+}
+
+// chimeState throttles chimes per kind.
+type chimeState struct {
+	mu       sync.Mutex
+	last     map[string]time.Time
+	warnedGS bool
+}
+
+// hubMessageChime classifies a hub-message payload: the hub announces
+// peers joining and leaving as messages of type client-joined and
+// client-left.
+func hubMessageChime(payload any) string {
+	outer, _ := payload.(map[string]any)
+	inner, _ := outer["message"].(map[string]any)
+	switch inner["type"] {
+	case "client-joined":
+		return "peer-join"
+	case "client-left":
+		return "peer-leave"
+	}
+	return "hub-message"
+}
+
+func (a *app) chimesMuted() bool {
+	return a.profile() != nil && a.profile().Chimes != nil && a.profile().Chimes.Muted
+}
+
+// playChime plays the sound configured for kind on this machine only.
+func (a *app) playChime(kind string) {
+	if a.profile() == nil || a.profile().Chimes == nil || a.chimesMuted() || a.dndActive() {
+		return
+	}
+	path := a.profile().Chimes.Sounds[kind]
+	if path == "" {
+		return
+	}
+	c := &a.chimes
+	c.mu.Lock()
+	if c.last == nil {
+		c.last = make(map[string]time.Time)
+	}
+	if time.Since(c.last[kind]) < chimeGap {
+		c.mu.Unlock()
+		return
+	}
+	c.last[kind] = time.Now()
+	c.mu.Unlock()
+	go a.playLocalSound(path)
+}
+
+// playLocalSound plays a file through GStreamer's default output.
+func (a *app) playLocalSound(path string) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		a.logf("chime %s: %v", path, err)
+		return
+	}
+	uri := (&url.URL{Scheme: "file", Path: abs}).String()
+	ctx, cancel := context.WithTimeout(a.ctx, chimeTimeout)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, "gst-launch-1.0", "-q", "playbin", "uri="+uri).CombinedOutput()
+	if err == nil {
+		return
+	}
+	if errors.Is(err, exec.ErrNotFound) {
+		a.chimes.mu.Lock()
+		warned := a.chimes.warnedGS
+		a.chimes.warnedGS = true
+		a.chimes.mu.Unlock()
+		if !warned {
+			a.logf("chimes need gst-launch-1.0, which is not installed")
+		}
+		return
+	}
+	a.logf("chime %s failed: %v %s", filepath.Base(path), err, out)
+}
+
+// installChimeActions adds app.mute-chimes, a toggle shared by the tray
+// menu and the command palette.
+func (a *app) installChimeActions() {
+	mute := glib.SimpleActionNewStateful("mute-chimes", nil, glib.VariantFromBoolean(a.chimesMuted()))
+	mute.Connect("change-state", func(action *glib.SimpleAction, value *glib.Variant) {
+		a.setChimesMuted(value.GetBoolean())
+	})
+	a.gtkApp.AddAction(mute)
+	a.muteAction = mute
+}
+
+// setChimesMuted saves the mute toggle and reflects it in the tray. Must
+// run on the GTK main loop.
+func (a *app) setChimesMuted(muted bool) {
+	if a.chimesMuted() != muted {
+		a.updateProfile(func(p *profileConfig) {
+			if p.Chimes == nil {
+				p.Chimes = &chimeConfig{}
+			}
+			p.Chimes.Muted = muted
+		})
+		if err := a.config.save(); err != nil {
+			a.reportError("save chimes", err, nil)
+		}
+		if muted {
+			a.logf("chimes muted")
+		} else {
+			a.logf("chimes unmuted")
+		}
+	}
+	if a.muteAction != nil {
+		a.muteAction.SetState(glib.VariantFromBoolean(muted))
+	}
+	a.syncTrayMute()
+}
+
+func (a *app) toggleChimes() {
+	a.setChimesMuted(!a.chimesMuted())
+}
+
+// buildChimePreferences adds a sound chooser per event kind and returns
+// the function that stores the choices.
+func (a *app) buildChimePreferences(content *gtk.Box) func() {
+	frame, _ := gtk.FrameNew(tr("Chimes (played on this computer only)"))
+	content.PackStart(frame, false, false, 0)
+	grid, _ := gtk.GridNew()
+	grid.SetRowSpacing(4)
+	grid.SetColumnSpacing(6)
+	grid.SetBorderWidth(6)
+	frame.Add(grid)
+
+	current := map[string]string{}
+	muted := false
+	if c := a.profile().Chimes; c != nil {
+		current, muted = c.Sounds, c.Muted
+	}
+	choosers := make(map[string]*gtk.FileChooserButton)
+	kinds := chimeKinds()
+	for i, k := range kinds {
+		label, _ := gtk.LabelNew(k.title)
+		label.SetXAlign(0)
+		label.SetHExpand(true)
+		grid.Attach(label, 0, i, 1, 1)
+		chooser, _ := gtk.FileChooserButtonNew(k.title, gtk.FILE_CHOOSER_ACTION_OPEN)
+		filter, _ := gtk.FileFilterNew()
+		filter.SetName(tr("Sounds"))
+		filter.AddMimeType("audio/*")
+		chooser.AddFilter(filter)
+		if path := current[k.id]; path != "" {
+			chooser.SetFilename(path)
+		}
+		label.SetMnemonicWidget(chooser)
+		grid.Attach(chooser, 1, i, 1, 1)
+		test, _ := gtk.ButtonNewFromIconName("media-playback-start-symbolic", gtk.ICON_SIZE_BUTTON)
+		setAccessible(test, tr("Play this chime"), "")
+		test.SetTooltipText(tr("Play this chime"))
+		test.Connect("clicked", func() {
+			if path := chooser.GetFilename(); path != "" {
+				go a.playLocalSound(path)
+			}
+		})
+		grid.Attach(test, 2, i, 1, 1)
+		clear, _ := gtk.ButtonNewFromIconName("edit-clear-symbolic", gtk.ICON_SIZE_BUTTON)
+		setAccessible(clear, tr("No chime"), "")
+		clear.SetTooltipText(tr("No chime"))
+		clear.Connect("clicked", func() { chooser.UnselectAll() })
+		grid.Attach(clear, 3, i, 1, 1)
+		choosers[k.id] = chooser
+	}
+	muteCheck, _ := gtk.CheckButtonNewWithLabel(tr("Mute all chimes"))
+	muteCheck.SetActive(muted)
+	grid.Attach(muteCheck, 0, len(kinds), 4, 1)
+
+	return func() {
+		sounds := make(map[string]string)
+		for id, chooser := range choosers {
+			if path := chooser.GetFilename(); path != "" {
+				sounds[id] = path
+			}
+		}
+		var chimes *chimeConfig
+		if len(sounds) != 0 || muteCheck.GetActive() {
+			chimes = &chimeConfig{Muted: muteCheck.GetActive(), Sounds: sounds}
+		}
+		a.updateProfile(func(p *profileConfig) { p.Chimes = chimes })
+		a.setChimesMuted(muteCheck.GetActive())
+	}
+}
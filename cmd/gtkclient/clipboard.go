@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// broadcastClipboard shares whatever is on the clipboard: files (by URI)
+// and images are uploaded, text is broadcast as a message. Must run on
+// the GTK main loop since the clipboard is read synchronously.
+func (a *app) broadcastClipboard() {
+	clip, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD)
+	if err != nil {
+		a.logf("clipboard unavailable: %v", err)
+		return
+	}
+	opts := uploadOptions{BroadcastPlay: a.profile().ClipboardPlay}
+	if clip.WaitIsUrisAvailable() {
+		if data, err := clip.WaitForContents(gdk.GdkAtomIntern("text/uri-list", false)); err == nil {
+			if path := firstLocalPath(data.GetURIs()); path != "" {
+				a.logf("clipboard: uploading %s", path)
+				go a.runUpload(path, "", opts)
+				return
+			}
+		}
+	}
+	if clip.WaitIsImageAvailable() {
+		pixbuf, err := clip.WaitForImage()
+		if err != nil {
+			a.reportError("clipboard image", err, nil)
+			return
+		}
+		opts.BroadcastImage = a.currentSocket().Supports(protocol.CapBroadcastImage)
+		name := "clipboard-" + time.Now().Format("20060102-150405") + ".png"
+		path := filepath.Join(os.TempDir(), name)
+		if err := pixbuf.SavePNG(path, 6); err != nil {
+			a.reportError("clipboard image", err, nil)
+			return
+		}
+		a.logf("clipboard: uploading image as %s", name)
+		go func() {
+			a.runUpload(path, name, opts)
+			_ = os.Remove(path)
+		}()
+		return
+	}
+	text, err := clip.WaitForText()
+	text = strings.TrimSpace(text)
+	if err != nil || text == "" {
+		a.logf("clipboard is empty")
+		return
+	}
+	// some file managers only offer copied files as plain text
+	if path := firstLocalPath(strings.Fields(text)); path != "" {
+		a.logf("clipboard: uploading %s", path)
+		go a.runUpload(path, "", opts)
+		return
+	}
+	go a.invokeBroadcast(text)
+}
+
+// firstLocalPath returns the first file:// URI that names a regular file.
+func firstLocalPath(uris []string) string {
+	for _, raw := range uris {
+		u, err := url.Parse(strings.TrimSpace(raw))
+		if err != nil || u.Scheme != "file" {
+			continue
+		}
+		if info, err := os.Stat(u.Path); err == nil && info.Mode().IsRegular() {
+			return u.Path
+		}
+	}
+	return ""
+}
+
+// afterUpload broadcast-plays a finished upload when asked to and the file
+// is audio, or shows it to every peer when it is an image.
+func (a *app) afterUpload(filename string, opts uploadOptions) {
+	if opts.BroadcastImage && isImage(filename) {
+		a.invokeBroadcastImage(filename, "")
+		return
+	}
+	if !opts.BroadcastPlay {
+		return
+	}
+	if !strings.HasPrefix(hubclient.ContentType(filename), "audio/") {
+		a.logf("not broadcast-playing %s: not an audio file", filename)
+		return
+	}
+	a.invokeBroadcastPlay(filename)
+}
+
+// clipboardPreview is how much of shared clipboard text a toast shows.
+const clipboardPreview = 80
+
+// installClipboardActions adds app.clipboard-sync and starts watching the
+// clipboard for it.
+func (a *app) installClipboardActions() {
+	sync := glib.SimpleActionNewStateful("clipboard-sync", nil, glib.VariantFromBoolean(a.profile().ClipboardSync))
+	sync.Connect("change-state", func(action *glib.SimpleAction, value *glib.Variant) {
+		a.setClipboardSync(value.GetBoolean())
+	})
+	a.gtkApp.AddAction(sync)
+	a.clipboardSyncAction = sync
+	if clip, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD); err == nil {
+		clip.Connect("owner-change", func() {
+			if a.profile().ClipboardSync {
+				a.shareClipboardText(clip, true)
+			}
+		})
+	}
+}
+
+// buildClipboardControls adds the share button and the sync toggle to the
+// broadcast row.
+func (a *app) buildClipboardControls(box *gtk.Box) {
+	sync, _ := gtk.CheckButtonNewWithLabel(tr("Sync clipboard"))
+	sync.SetTooltipText(tr("Share clipboard text with peers whenever it changes"))
+	sync.SetActionName("app.clipboard-sync")
+	box.PackEnd(sync, false, false, 0)
+	share, _ := gtk.ButtonNewWithLabel(tr("Share Clipboard"))
+	share.SetTooltipText(tr("Offer the clipboard text to every peer's clipboard"))
+	share.Connect("clicked", func() { a.shareClipboard() })
+	box.PackEnd(share, false, false, 0)
+}
+
+// setClipboardSync saves the toggle. Must run on the GTK main loop.
+func (a *app) setClipboardSync(on bool) {
+	if a.profile().ClipboardSync != on {
+		a.updateProfile(func(p *profileConfig) { p.ClipboardSync = on })
+		if err := a.config.save(); err != nil {
+			a.reportError("save clipboard sync", err, nil)
+		}
+		if on {
+			a.logf("clipboard sync on")
+		} else {
+			a.logf("clipboard sync off")
+		}
+	}
+	if a.clipboardSyncAction != nil {
+		a.clipboardSyncAction.SetState(glib.VariantFromBoolean(on))
+	}
+}
+
+func (a *app) toggleClipboardSync() {
+	a.setClipboardSync(!a.profile().ClipboardSync)
+}
+
+// shareClipboard sends the clipboard text to the peers' clipboards. Must
+// run on the GTK main loop.
+func (a *app) shareClipboard() {
+	clip, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD)
+	if err != nil {
+		a.logf("clipboard unavailable: %v", err)
+		return
+	}
+	a.shareClipboardText(clip, false)
+}
+
+// shareClipboardText sends the text on clip unless it is empty or, when
+// auto is set, the text last shared or received.
+func (a *app) shareClipboardText(clip *gtk.Clipboard, auto bool) {
+	text, err := clip.WaitForText()
+	if err != nil || strings.TrimSpace(text) == "" {
+		if !auto {
+			a.logf("clipboard has no text")
+		}
+		return
+	}
+	if auto && (text == a.clipboardSeen || !a.currentSocket().Supports(protocol.CapClipboard)) {
+		return
+	}
+	a.clipboardSeen = text
+	go a.sendClipboard(text)
+}
+
+func (a *app) sendClipboard(text string) {
+	ctx := hubclient.WithIdempotencyKey(a.ctx, hubclient.NewIdempotencyKey())
+	n, err := a.currentSocket().Clipboard(ctx, text)
+	if err != nil {
+		a.reportError("share clipboard", err, func() { a.sendClipboard(text) })
+		return
+	}
+	a.logf("clipboard shared with %d peer(s) (%s)", n, formatBytes(int64(len(text))))
+}
+
+// handleClipboardEvent offers clipboard text from another peer with a
+// one-click copy.
+func (a *app) handleClipboardEvent(payload json.RawMessage) {
+	var data struct {
+		Text string `json:"text"`
+		From string `json:"from"`
+		Self bool   `json:"self"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		a.logf("clipboard event parse error: %v", err)
+		return
+	}
+	if data.Self {
+		return
+	}
+	from := data.From
+	if from == "" {
+		from = "unknown"
+	}
+	if a.dndActive() {
+		a.logf("clipboard from %s: %s (do not disturb)", from, formatBytes(int64(len(data.Text))))
+		return
+	}
+	a.logf("clipboard from %s: %s", from, formatBytes(int64(len(data.Text))))
+	preview := strings.Join(strings.Fields(data.Text), " ")
+	if r := []rune(preview); len(r) > clipboardPreview {
+		preview = string(r[:clipboardPreview]) + "…"
+	}
+	glib.IdleAdd(func() bool {
+		a.showOfferToast(fmt.Sprintf(tr("Clipboard from %s: %s"), from, preview), tr("Copy to My Clipboard"), func() {
+			clip, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD)
+			if err != nil {
+				a.logf("clipboard unavailable: %v", err)
+				return
+			}
+			// set before the owner-change it triggers, so sync does not echo it
+			a.clipboardSeen = data.Text
+			clip.SetText(data.Text)
+			a.logf("copied clipboard text from %s", from)
+		})
+		return false
+	})
+}
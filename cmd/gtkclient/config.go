@@ -0,0 +1,309 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+const (
+	configDirName  = "brain"
+	configFileName = "gtkclient.json"
+	defaultProfile = "default"
+)
+
+// clientConfig is persisted as JSON in the user config dir. Each profile
+// describes one hub and the client settings that go with it.
+type clientConfig struct {
+	Profile  string                    `json:"profile,omitempty"`
+	Profiles map[string]*profileConfig `json:"profiles,omitempty"`
+	// EventSetups are named snapshots spanning profiles, see eventSetup.
+	EventSetups map[string]*eventSetup `json:"eventSetups,omitempty"`
+	// Theme is "system" (the default), "light" or "dark".
+	Theme string `json:"theme,omitempty"`
+	// Language picks a translation catalog such as "de"; empty follows
+	// the locale.
+	Language string `json:"language,omitempty"`
+	// Panels records which panels are popped out into their own windows.
+	Panels map[string]*panelLayout `json:"panels,omitempty"`
+
+	// readOnly is set when an unparsable config file could not be moved
+	// aside; saving would overwrite it with whatever loaded.
+	readOnly bool
+}
+
+var errConfigReadOnly = errors.New("config file is unreadable; not overwriting it")
+
+type profileConfig struct {
+	ControlURL string          `json:"controlUrl,omitempty"`
+	Telemetry  telemetryConfig `json:"telemetry"`
+	// SharedFolder is exposed read-only to other peers via peer-files.
+	SharedFolder string `json:"sharedFolder,omitempty"`
+	// ReceiveDir holds direct transfers and archived broadcasts.
+	ReceiveDir        string `json:"receiveDir,omitempty"`
+	ArchiveBroadcasts bool   `json:"archiveBroadcasts,omitempty"`
+	// QueueOffline holds play/broadcast actions in an outbox while the
+	// socket is down.
+	QueueOffline bool `json:"queueOffline,omitempty"`
+	// UploadLimit caps socket upload bandwidth in bytes/sec; 0 is unlimited.
+	UploadLimit int64 `json:"uploadLimit,omitempty"`
+	// Timeouts overrides request timeouts in seconds, keyed by action;
+	// "default" covers actions without a built-in default.
+	Timeouts map[string]float64 `json:"timeouts,omitempty"`
+	// Retry re-sends timed-out requests that are safe to repeat.
+	Retry *retryConfig `json:"retry,omitempty"`
+	// Subscribe limits which events the hub pushes to this client.
+	Subscribe *subscriptionConfig `json:"subscribe,omitempty"`
+	// StatusPollSeconds fetches status when none has arrived for this
+	// long, for hubs that do not push it; 0 is off.
+	StatusPollSeconds int `json:"statusPollSeconds,omitempty"`
+	// Protocol selects the socket framing: "jsonrpc" uses JSON-RPC 2.0 when
+	// the hub advertises it; empty keeps the native format.
+	Protocol string `json:"protocol,omitempty"`
+	// Framing "newline" keeps newline-delimited messages even when the
+	// hub offers length-prefixed frames, which are used otherwise.
+	Framing string `json:"framing,omitempty"`
+	// Proxy reaches the hub socket through a socks5:// or http:// proxy;
+	// empty follows ALL_PROXY and NO_PROXY, "direct" ignores them.
+	Proxy string `json:"proxy,omitempty"`
+	// Codec "cbor" encodes socket messages as CBOR instead of JSON when
+	// the hub offers it, which is cheaper to parse on slow machines. It
+	// needs length-prefixed framing.
+	Codec string `json:"codec,omitempty"`
+	// LenientSchemas uses hub messages that do not match their schema
+	// instead of rejecting them, for older hubs.
+	LenientSchemas bool `json:"lenientSchemas,omitempty"`
+	// AudioSort orders the remote audio buttons: "newest", "duration",
+	// "plays" or empty for by name.
+	AudioSort string `json:"audioSort,omitempty"`
+	// Transcode converts audio uploads to "opus", "vorbis" or "mp3" at
+	// TranscodeKbps (128 when zero) when the upload row asks for it.
+	Transcode     string `json:"transcode,omitempty"`
+	TranscodeKbps int    `json:"transcodeKbps,omitempty"`
+	// FileTags are this client's tags by remote file name; "favorite" is
+	// the star. With SyncTags the hub's shared tags are shown instead.
+	FileTags map[string][]string `json:"fileTags,omitempty"`
+	SyncTags bool                `json:"syncTags,omitempty"`
+	// FavoritesOnly hides unstarred files in the audio grid, and
+	// NeverPlayedOnly those the hub counted a broadcast-play of.
+	FavoritesOnly   bool `json:"favoritesOnly,omitempty"`
+	NeverPlayedOnly bool `json:"neverPlayedOnly,omitempty"`
+	// RecentPlays are the latest broadcast-plays heard from any peer,
+	// newest first.
+	RecentPlays []recentPlay `json:"recentPlays,omitempty"`
+	// NormalizePlayback asks peers to apply each file's ReplayGain on Play
+	// and Broadcast Play, on hubs that keep loudness.
+	NormalizePlayback bool `json:"normalizePlayback,omitempty"`
+	// Soundboard maps GTK accelerators, e.g. "F1" or "<Control>1", to the
+	// remote file they broadcast-play.
+	Soundboard map[string]string `json:"soundboard,omitempty"`
+	// Macros are saved hub commands with {placeholders}, by name.
+	Macros map[string]*commandMacro `json:"macros,omitempty"`
+	// GlobalHotkeys maps accelerators to commands that run even while
+	// another application has focus: a command palette action such as
+	// "play:doorbell.mp3", or a script line such as
+	// `broadcast-play doorbell.mp3` or
+	// `volume {"volume": 0, "broadcast": true}` to mute every peer.
+	GlobalHotkeys map[string]string `json:"globalHotkeys,omitempty"`
+	// Chimes are sounds played on this computer when hub events arrive.
+	Chimes *chimeConfig `json:"chimes,omitempty"`
+	// Tray shows a status icon with the chime mute toggle; it is always
+	// shown in --daemon mode.
+	Tray bool `json:"tray,omitempty"`
+	// DoNotDisturb, and the QuietHours span each day, silence
+	// broadcast-play events from peers and make outgoing broadcasts ask
+	// first.
+	DoNotDisturb bool        `json:"doNotDisturb,omitempty"`
+	QuietHours   *quietHours `json:"quietHours,omitempty"`
+	// ConfirmBroadcasts asks, naming the peers, before a broadcast or
+	// broadcast-play goes out.
+	ConfirmBroadcasts bool `json:"confirmBroadcasts,omitempty"`
+	// FanOut names other profiles whose hubs get every broadcast and
+	// broadcast-play sent from this one.
+	FanOut []string `json:"fanOut,omitempty"`
+	// Traffic is cumulative socket traffic by action across sessions.
+	Traffic map[string]*trafficTotals `json:"traffic,omitempty"`
+	// Window is the main window's last geometry and pane positions.
+	Window *windowGeometry `json:"window,omitempty"`
+	// ClipboardPlay broadcast-plays audio files shared with Ctrl+Shift+V
+	// once they are uploaded.
+	ClipboardPlay bool `json:"clipboardPlay,omitempty"`
+	// ClipboardSync shares clipboard text with peers whenever it changes.
+	ClipboardSync bool `json:"clipboardSync,omitempty"`
+	// Webhooks post to HTTP endpoints on matching events, by rule name.
+	Webhooks map[string]*webhookRule `json:"webhooks,omitempty"`
+	// MetricsListen serves Prometheus metrics, including hub health, on
+	// /metrics at this address, e.g. 127.0.0.1:9320; empty disables it.
+	MetricsListen string `json:"metricsListen,omitempty"`
+	// GatewayListen serves the REST gateway (/status, /files, /play,
+	// /broadcast, /upload) through this client's socket at this address,
+	// e.g. 127.0.0.1:4460; empty disables it. GatewayToken, when set, is
+	// the bearer token callers must send.
+	GatewayListen string `json:"gatewayListen,omitempty"`
+	GatewayToken  string `json:"gatewayToken,omitempty"`
+	// MQTT bridges hub events and play/broadcast commands to a broker.
+	MQTT *mqttConfig `json:"mqtt,omitempty"`
+	// Downloader is the command Add from URL extracts audio from media
+	// pages with, such as video or podcast sites, split like a shell
+	// command line. {url} and {dir} in it are replaced by the page and a
+	// folder the command must leave the audio in, optionally with a yt-dlp
+	// style .info.json for its tags; {maxsize} is the size limit in bytes.
+	// Empty runs yt-dlp when it is installed.
+	Downloader string `json:"downloader,omitempty"`
+	// SyncFolder uploads a local folder's audio files as they change.
+	SyncFolder *syncFolderConfig `json:"syncFolder,omitempty"`
+}
+
+type retryConfig struct {
+	// Attempts includes the first try; 1 turns retrying off.
+	Attempts int `json:"attempts,omitempty"`
+	// BackoffSeconds is the first wait, doubled after each retry.
+	BackoffSeconds float64 `json:"backoffSeconds,omitempty"`
+}
+
+type subscriptionConfig struct {
+	// Events lists event types such as status, hub-message,
+	// broadcast-play and log; empty means all.
+	Events                []string `json:"events,omitempty"`
+	StatusIntervalSeconds float64  `json:"statusIntervalSeconds,omitempty"`
+}
+
+type mqttConfig struct {
+	// Broker is host[:port] or a tcp:// or mqtts:// URL; the bridge is
+	// off when empty.
+	Broker   string `json:"broker,omitempty"`
+	ClientID string `json:"clientId,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Prefix is prepended to relative topics; "brain" by default.
+	Prefix string `json:"prefix,omitempty"`
+	// Topics maps event types to topics, e.g. {"status": "state"}; empty
+	// publishes status, broadcast-play, hub-message and now-playing.
+	Topics map[string]string `json:"topics,omitempty"`
+	// CommandTopic receives play and broadcast commands; "command" by
+	// default.
+	CommandTopic string `json:"commandTopic,omitempty"`
+}
+
+type syncFolderConfig struct {
+	// Dir is the local folder; nothing is synced when empty.
+	Dir string `json:"dir,omitempty"`
+	// HubFolder is where its files go on the hub; empty is the top level.
+	HubFolder string `json:"hubFolder,omitempty"`
+	// MirrorDeletes deletes the hub copy of a file deleted from Dir.
+	MirrorDeletes bool `json:"mirrorDeletes,omitempty"`
+	Paused        bool `json:"paused,omitempty"`
+}
+
+type chimeConfig struct {
+	Muted bool `json:"muted,omitempty"`
+	// Sounds maps hub-message, peer-join, peer-leave and broadcast-play
+	// to local audio files.
+	Sounds map[string]string `json:"sounds,omitempty"`
+}
+
+type telemetryConfig struct {
+	// Endpoint is an OTLP/HTTP collector base URL such as
+	// http://collector:4318; telemetry is disabled when empty.
+	Endpoint    string            `json:"endpoint,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	ServiceName string            `json:"serviceName,omitempty"`
+}
+
+// clone deep-copies p through JSON; every profile field is plain data that
+// round-trips, so neither step can fail.
+func (p *profileConfig) clone() *profileConfig {
+	data, _ := json.Marshal(p)
+	c := &profileConfig{}
+	_ = json.Unmarshal(data, c)
+	return c
+}
+
+func configPath() (string, error) {
+	if path := os.Getenv("CLIENT_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configDirName, configFileName), nil
+}
+
+// loadConfig reads the config file, returning an empty config when none
+// exists yet. A file that fails to parse is renamed to config.json.bad so
+// later saves cannot clobber it; if that fails too, the config refuses to
+// save.
+func loadConfig() (*clientConfig, error) {
+	cfg := &clientConfig{}
+	path, err := configPath()
+	if err != nil {
+		return cfg, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		bad := path + ".bad"
+		if renameErr := os.Rename(path, bad); renameErr != nil {
+			cfg.readOnly = true
+			return cfg, fmt.Errorf("parse %s: %w", path, err)
+		}
+		return &clientConfig{}, fmt.Errorf("parse %s: %w (moved to %s)", path, err, bad)
+	}
+	return cfg, nil
+}
+
+func (c *clientConfig) save() error {
+	if c.readOnly {
+		return errConfigReadOnly
+	}
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// activeProfileName honours CLIENT_PROFILE, then the config default.
+func (c *clientConfig) activeProfileName() string {
+	if name := os.Getenv("CLIENT_PROFILE"); name != "" {
+		return name
+	}
+	if c.Profile != "" {
+		return c.Profile
+	}
+	return defaultProfile
+}
+
+// activeProfile returns the selected profile, creating it if missing.
+func (c *clientConfig) activeProfile() *profileConfig {
+	name := c.activeProfileName()
+	if c.Profiles == nil {
+		c.Profiles = make(map[string]*profileConfig)
+	}
+	p, ok := c.Profiles[name]
+	if !ok || p == nil {
+		p = &profileConfig{}
+		c.Profiles[name] = p
+	}
+	return p
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/metrics"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// connState is where the socket to the hub stands. Transitions come from
+// connectSocket, the hello handshake, request outcomes and the synthetic
+// disconnect event, never from parsing log lines.
+type connState int
+
+const (
+	stateOffline connState = iota
+	stateConnecting
+	// stateAuthenticating covers the handshake: the socket is open but the
+	// hub's hello, with its version and capabilities, has not arrived.
+	stateAuthenticating
+	stateConnected
+	// stateDegraded means connected but not healthy: requests time out,
+	// the hello never came or the hub reports itself disconnected.
+	stateDegraded
+	stateReconnecting
+)
+
+const (
+	reconnectMin = time.Second
+	reconnectMax = 30 * time.Second
+
+	metricConnState = "brain_client_connection_state"
+)
+
+var connStateNames = [...]string{"offline", "connecting", "authenticating", "connected", "degraded", "reconnecting"}
+
+func (s connState) String() string {
+	if int(s) < len(connStateNames) {
+		return connStateNames[s]
+	}
+	return fmt.Sprintf("state(%d)", int(s))
+}
+
+func (s connState) title() string {
+	switch s {
+	case stateConnecting:
+		return tr("Connecting…")
+	case stateAuthenticating:
+		return tr("Handshaking…")
+	case stateConnected:
+		return tr("Connected")
+	case stateDegraded:
+		return tr("Degraded")
+	case stateReconnecting:
+		return tr("Reconnecting…")
+	}
+	return tr("Offline")
+}
+
+// connection is the state machine's memory. Guarded by mu; the widgets are
+// owned by the GTK main loop.
+type connection struct {
+	mu        sync.Mutex
+	state     connState
+	since     time.Time // entered the current state
+	upSince   time.Time // last reached connected; zero while down
+	reason    string    // why the state is degraded or down
+	lastErr   string
+	lastErrAt time.Time
+	looping   bool
+
+	indicator *gtk.Label
+}
+
+// setConnState moves the machine to s. err, when set, becomes the last
+// error shown in the tooltip.
+func (a *app) setConnState(s connState, reason string, err error) {
+	c := &a.conn
+	c.mu.Lock()
+	prev := c.state
+	now := time.Now()
+	if err != nil {
+		c.lastErr = err.Error()
+		c.lastErrAt = now
+	}
+	c.state = s
+	c.reason = reason
+	if prev != s {
+		c.since = now
+	}
+	switch s {
+	case stateConnected:
+		if c.upSince.IsZero() {
+			c.upSince = now
+		}
+	case stateDegraded:
+	default:
+		c.upSince = time.Time{}
+	}
+	c.mu.Unlock()
+
+	if prev != s {
+		for i, name := range connStateNames {
+			v := 0.0
+			if i == int(s) {
+				v = 1
+			}
+			a.metrics.Set(metricConnState, metrics.Labels{"state": name}, v)
+		}
+		if reason != "" {
+			a.logf("connection: %s -> %s (%s)", prev, s, reason)
+		} else {
+			a.logf("connection: %s -> %s", prev, s)
+		}
+	}
+	glib.IdleAdd(func() bool {
+		a.refreshConnIndicator()
+		return false
+	})
+}
+
+func (a *app) connState() (connState, string) {
+	a.conn.mu.Lock()
+	defer a.conn.mu.Unlock()
+	return a.conn.state, a.conn.reason
+}
+
+// connFailed records a failed dial. A first connect goes offline; during
+// reconnectLoop the state stays reconnecting.
+func (a *app) connFailed(err error) {
+	state, reason := a.connState()
+	if state != stateReconnecting {
+		state, reason = stateOffline, ""
+	}
+	a.setConnState(state, reason, err)
+}
+
+// observeConnection folds request outcomes into the machine: a timeout
+// while connected degrades it, the next success restores it.
+func (a *app) observeConnection(err error) {
+	switch state, reason := a.connState(); {
+	case err == nil && state == stateDegraded && reason == reasonTimeouts:
+		a.setConnState(stateConnected, "", nil)
+	case errors.Is(err, hubclient.ErrTimeout) && state == stateConnected:
+		a.setConnState(stateDegraded, reasonTimeouts, err)
+	}
+}
+
+// Degraded reasons that clear on their own.
+const (
+	reasonTimeouts        = "requests are timing out"
+	reasonHubDisconnected = "hub reports connected=false"
+	reasonNoHello         = "no hello from hub"
+)
+
+// observeHubStatus degrades the connection while the hub says it is not
+// connected, and clears that once it recovers.
+func (a *app) observeHubStatus(connected bool) {
+	switch state, reason := a.connState(); {
+	case !connected && state == stateConnected:
+		a.setConnState(stateDegraded, reasonHubDisconnected, nil)
+	case connected && state == stateDegraded && reason == reasonHubDisconnected:
+		a.setConnState(stateConnected, "", nil)
+	}
+}
+
+// socketLost handles the disconnect event of connection gen. A socket the
+// client closed on purpose is already replaced or cleared, so only an
+// unexpected loss starts reconnecting.
+func (a *app) socketLost(gen int, cause error) {
+	a.socketMu.Lock()
+	if a.socket == nil || a.socketGen != gen {
+		a.socketMu.Unlock()
+		return
+	}
+	a.socket = nil
+	a.socketMu.Unlock()
+	a.setHubUp(false)
+	if a.ctx.Err() != nil {
+		a.setConnState(stateOffline, "", cause)
+		return
+	}
+	a.setConnState(stateReconnecting, "connection lost", cause)
+	go a.reconnectLoop()
+}
+
+// reconnectLoop dials with exponential backoff until a socket is up again,
+// the app closes or someone else reconnected first.
+func (a *app) reconnectLoop() {
+	a.conn.mu.Lock()
+	if a.conn.looping {
+		a.conn.mu.Unlock()
+		return
+	}
+	a.conn.looping = true
+	a.conn.mu.Unlock()
+	defer func() {
+		a.conn.mu.Lock()
+		a.conn.looping = false
+		a.conn.mu.Unlock()
+	}()
+	delay := reconnectMin
+	for attempt := 1; ; attempt++ {
+		timer := time.NewTimer(delay)
+		select {
+		case <-a.ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if a.currentSocket() != nil {
+			return
+		}
+		a.setConnState(stateReconnecting, fmt.Sprintf("attempt %d", attempt), nil)
+		if err := a.connectSocket(); err == nil {
+			go a.fetchStatus()
+			return
+		}
+		delay *= 2
+		if delay > reconnectMax {
+			delay = reconnectMax
+		}
+	}
+}
+
+func (a *app) buildConnIndicator(box *gtk.Box) {
+	dot, _ := gtk.LabelNew("●")
+	addStyleClass(dot, "conn-indicator")
+	box.PackStart(dot, false, false, 0)
+	a.conn.indicator = dot
+	a.refreshConnIndicator()
+	// uptime in the tooltip keeps ticking
+	glib.TimeoutAdd(uint(time.Second/time.Millisecond), func() bool {
+		if a.ctx.Err() != nil {
+			return false
+		}
+		a.refreshConnTooltip()
+		return true
+	})
+}
+
+// refreshConnIndicator must run on the GTK main loop.
+func (a *app) refreshConnIndicator() {
+	dot := a.conn.indicator
+	if dot == nil {
+		return
+	}
+	a.conn.mu.Lock()
+	state, reason := a.conn.state, a.conn.reason
+	a.conn.mu.Unlock()
+	if ctx, err := dot.GetStyleContext(); err == nil {
+		for _, name := range connStateNames {
+			ctx.RemoveClass(name)
+		}
+		ctx.AddClass(state.String())
+	}
+	a.hubMu.Lock()
+	host := a.hubHost
+	a.hubMu.Unlock()
+	text := state.title()
+	switch {
+	case state == stateConnected && host != "":
+		text = fmt.Sprintf(tr("Connected to %s"), host)
+	case state == stateReconnecting && reason != "":
+		text = fmt.Sprintf(tr("Reconnecting… (%s)"), reason)
+	case state == stateDegraded && reason != "":
+		text = fmt.Sprintf(tr("Degraded: %s"), reason)
+	}
+	a.statusLabel.SetText(text)
+	setAccessible(dot, text, "")
+	a.refreshConnTooltip()
+}
+
+func (a *app) refreshConnTooltip() {
+	if a.conn.indicator == nil {
+		return
+	}
+	c := &a.conn
+	c.mu.Lock()
+	state, since, upSince, lastErr, lastErrAt := c.state, c.since, c.upSince, c.lastErr, c.lastErrAt
+	c.mu.Unlock()
+	lines := []string{fmt.Sprintf(tr("State: %s for %s"), state.title(), roundDuration(time.Since(since)))}
+	if !upSince.IsZero() {
+		lines = append(lines, fmt.Sprintf(tr("Uptime: %s"), roundDuration(time.Since(upSince))))
+	}
+	if lastErr != "" {
+		lines = append(lines, fmt.Sprintf(tr("Last error (%s ago): %s"), roundDuration(time.Since(lastErrAt)), lastErr))
+	}
+	tooltip := strings.Join(lines, "\n")
+	a.conn.indicator.SetTooltipText(tooltip)
+	a.statusLabel.SetTooltipText(tooltip)
+}
+
+func roundDuration(d time.Duration) time.Duration {
+	if d < time.Minute {
+		return d.Round(time.Second)
+	}
+	return d.Round(time.Minute)
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/metrics"
+
+	"github.com/gotk3/gotk3/cairo"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	dashboardTick    = time.Second
+	dashboardHistory = 60
+
+	metricTransferBytes = "brain_client_transfer_bytes_total"
+	metricConnects      = "brain_client_connects_total"
+	metricDisconnects   = "brain_client_disconnects_total"
+)
+
+func newClientMetrics() *metrics.Registry {
+	r := metrics.NewRegistry()
+	hubclient.DescribeMetrics(r)
+	r.Describe(metricTransferBytes, metrics.KindCounter, "File bytes moved by direction and path (relay, chunked, direct, archive).")
+	r.Describe(metricConnects, metrics.KindCounter, "Socket connection attempts by outcome.")
+	r.Describe(metricDisconnects, metrics.KindCounter, "Socket disconnects.")
+	return r
+}
+
+// recordTransfer counts completed file bytes in both telemetry and the
+// local registry.
+func (a *app) recordTransfer(direction, path string, n int64) {
+	attrs := map[string]string{"direction": direction, "path": path}
+	a.telemetry.add("brain.client.transfer.bytes", n, attrs)
+	a.metrics.Add(metricTransferBytes, attrs, float64(n))
+}
+
+// metricsAddress honours CLIENT_METRICS_ADDR, then the profile setting.
+// Empty means the endpoint is off.
+func (a *app) metricsAddress() string {
+	if v := os.Getenv("CLIENT_METRICS_ADDR"); v != "" {
+		return v
+	}
+	if a.profile() != nil {
+		return a.profile().MetricsListen
+	}
+	return ""
+}
+
+// serveMetrics exposes the registry in the Prometheus text format on
+// /metrics until the app closes.
+func (a *app) serveMetrics() {
+	addr := a.metricsAddress()
+	if addr == "" {
+		return
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := a.metrics.WriteText(w); err != nil {
+			a.logf("metrics write error: %v", err)
+		}
+	})
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		a.logf("metrics endpoint disabled: %v", err)
+		return
+	}
+	srv := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-a.ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+	a.logf("metrics endpoint: http://%s/metrics", ln.Addr())
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			a.logf("metrics endpoint stopped: %v", err)
+		}
+	}()
+}
+
+// sparkline is one dashboard row: a rolling per-tick rate and its graph.
+type sparkline struct {
+	title  string
+	format func(float64) string
+	value  *gtk.Label
+	area   *gtk.DrawingArea
+	points []float64
+}
+
+func (s *sparkline) push(v float64) {
+	s.points = append(s.points, v)
+	if len(s.points) > dashboardHistory {
+		s.points = s.points[len(s.points)-dashboardHistory:]
+	}
+	s.value.SetText(s.format(v))
+	s.area.QueueDraw()
+}
+
+func (s *sparkline) draw(cr *cairo.Context, width, height float64) {
+	cr.SetSourceRGB(0.95, 0.95, 0.95)
+	cr.Rectangle(0, 0, width, height)
+	cr.Fill()
+	if len(s.points) < 2 {
+		return
+	}
+	peak := 0.0
+	for _, v := range s.points {
+		if v > peak {
+			peak = v
+		}
+	}
+	if peak == 0 {
+		peak = 1
+	}
+	step := width / float64(dashboardHistory-1)
+	x := width - step*float64(len(s.points)-1)
+	cr.SetSourceRGB(0.2, 0.45, 0.8)
+	cr.SetLineWidth(1.5)
+	for i, v := range s.points {
+		y := height - 2 - (height-4)*v/peak
+		if i == 0 {
+			cr.MoveTo(x, y)
+		} else {
+			cr.LineTo(x, y)
+		}
+		x += step
+	}
+	cr.Stroke()
+}
+
+// dashboardView is the "Metrics" tab. All fields are owned by the GTK main
+// loop.
+type dashboardView struct {
+	lines   []*sparkline
+	totals  *gtk.Label
+	actions *gtk.TextBuffer
+	last    dashboardSample
+}
+
+// dashboardSample is a snapshot of the cumulative counters the rates are
+// derived from.
+type dashboardSample struct {
+	requests, failures float64
+	rttCount           uint64
+	rttSum             float64
+	written, read      float64
+}
+
+func (a *app) sampleMetrics() dashboardSample {
+	r := a.metrics
+	count, sum := r.HistogramTotals(hubclient.MetricRequestTime, nil)
+	requests := r.Total(hubclient.MetricRequests, nil)
+	return dashboardSample{
+		requests: requests,
+		failures: requests - r.Total(hubclient.MetricRequests, metrics.Labels{"outcome": "ok"}),
+		rttCount: count,
+		rttSum:   sum,
+		written:  r.Total(hubclient.MetricBytesWritten, nil),
+		read:     r.Total(hubclient.MetricBytesRead, nil),
+	}
+}
+
+func (a *app) buildDashboardTab() gtk.IWidget {
+	d := &dashboardView{last: a.sampleMetrics()}
+	a.dashboard = d
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 8)
+	box.SetBorderWidth(6)
+
+	grid, _ := gtk.GridNew()
+	grid.SetColumnSpacing(12)
+	grid.SetRowSpacing(6)
+	box.PackStart(grid, false, false, 0)
+	perSec := func(v float64) string { return fmt.Sprintf("%.1f/s", v) }
+	bytesPerSec := func(v float64) string { return formatBytes(int64(v)) + "/s" }
+	d.lines = []*sparkline{
+		{title: tr("Requests"), format: perSec},
+		{title: tr("Failures"), format: perSec},
+		{title: tr("Avg RTT"), format: func(v float64) string { return fmt.Sprintf("%.0f ms", v) }},
+		{title: tr("Upload"), format: bytesPerSec},
+		{title: tr("Download"), format: bytesPerSec},
+	}
+	for i, s := range d.lines {
+		s := s
+		title, _ := gtk.LabelNew(s.title)
+		title.SetXAlign(0)
+		grid.Attach(title, 0, i, 1, 1)
+		s.value, _ = gtk.LabelNew("-")
+		s.value.SetXAlign(1)
+		s.value.SetWidthChars(12)
+		grid.Attach(s.value, 1, i, 1, 1)
+		s.area, _ = gtk.DrawingAreaNew()
+		s.area.SetSizeRequest(300, 32)
+		s.area.SetHExpand(true)
+		s.area.Connect("draw", func(da *gtk.DrawingArea, cr *cairo.Context) bool {
+			s.draw(cr, float64(da.GetAllocatedWidth()), float64(da.GetAllocatedHeight()))
+			return true
+		})
+		grid.Attach(s.area, 2, i, 1, 1)
+	}
+
+	d.totals, _ = gtk.LabelNew("")
+	d.totals.SetXAlign(0)
+	box.PackStart(d.totals, false, false, 0)
+
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	scroll.SetVExpand(true)
+	box.PackStart(scroll, true, true, 0)
+	view, _ := gtk.TextViewNew()
+	view.SetEditable(false)
+	view.SetMonospace(true)
+	scroll.Add(view)
+	d.actions, _ = view.GetBuffer()
+
+	glib.TimeoutAdd(uint(dashboardTick/time.Millisecond), func() bool {
+		if a.ctx.Err() != nil {
+			return false
+		}
+		a.refreshDashboard()
+		return true
+	})
+	return box
+}
+
+// refreshDashboard must run on the GTK main loop.
+func (a *app) refreshDashboard() {
+	d := a.dashboard
+	now := a.sampleMetrics()
+	prev := d.last
+	d.last = now
+	secs := dashboardTick.Seconds()
+	rtt := 0.0
+	if n := now.rttCount - prev.rttCount; n > 0 {
+		rtt = (now.rttSum - prev.rttSum) / float64(n) * 1000
+	}
+	rates := []float64{
+		(now.requests - prev.requests) / secs,
+		(now.failures - prev.failures) / secs,
+		rtt,
+		(now.written - prev.written) / secs,
+		(now.read - prev.read) / secs,
+	}
+	for i, s := range d.lines {
+		s.push(rates[i])
+	}
+	d.totals.SetText(fmt.Sprintf(tr("Totals: %.0f requests, %.0f failed, %s sent, %s received, %.0f disconnects, %d pending"),
+		now.requests, now.failures, formatBytes(int64(now.written)), formatBytes(int64(now.read)),
+		a.metrics.Total(metricDisconnects, nil), a.currentSocket().PendingCount()))
+	d.actions.SetText(a.actionSummary())
+}
+
+// actionSummary is a per-action table of request counts and mean RTT.
+func (a *app) actionSummary() string {
+	r := a.metrics
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-18s %8s %8s %10s\n", "action", "requests", "failed", "avg rtt")
+	for _, action := range r.LabelValues(hubclient.MetricRequests, "action") {
+		match := metrics.Labels{"action": action}
+		total := r.Total(hubclient.MetricRequests, match)
+		ok := r.Total(hubclient.MetricRequests, metrics.Labels{"action": action, "outcome": "ok"})
+		count, sum := r.HistogramTotals(hubclient.MetricRequestTime, match)
+		avg := "-"
+		if count > 0 {
+			avg = (time.Duration(sum / float64(count) * float64(time.Second))).Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(&b, "%-18s %8.0f %8.0f %10s\n", action, total, total-ok, avg)
+	}
+	return b.String()
+}
@@ -0,0 +1,239 @@
+package main
+
+// #include <stdlib.h>
+// #include <gio/gio.h>
+//
+// extern GDBusConnection *brain_dbus_app_connection(gpointer app);
+// extern guint brain_dbus_register(GDBusConnection *conn, const char *path, const char *xml, char **error);
+// extern guint brain_dbus_own_name(GDBusConnection *conn, const char *name);
+// extern char *brain_dbus_string_arg(GVariant *params, int index);
+// extern void brain_dbus_return_string(GDBusMethodInvocation *inv, const char *s);
+// extern void brain_dbus_return_bool(GDBusMethodInvocation *inv, int b);
+// extern void brain_dbus_return_strv(GDBusMethodInvocation *inv, const gchar *const *strv, int n);
+// extern void brain_dbus_return_empty(GDBusMethodInvocation *inv);
+// extern void brain_dbus_return_error(GDBusMethodInvocation *inv, const char *name, const char *message);
+// extern void brain_dbus_emit(GDBusConnection *conn, const char *path, const char *iface, const char *signal, const char *a, const char *b);
+import "C"
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"unsafe"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+)
+
+const (
+	dbusName      = "org.brain.Client"
+	dbusPath      = "/org/brain/Client"
+	dbusInterface = "org.brain.Client"
+)
+
+// dbusXML is the org.brain.Client interface, e.g.
+//
+//	busctl --user call org.brain.Client /org/brain/Client org.brain.Client Play s chime.wav
+//	busctl --user call org.brain.Client /org/brain/Client org.brain.Client Activate s palette
+//
+// Activate runs a command palette entry by its action name, which is how
+// media keys are bound. Event carries every hub event as JSON.
+const dbusXML = `<node>
+  <interface name="org.brain.Client">
+    <method name="Play"><arg name="filename" type="s" direction="in"/></method>
+    <method name="BroadcastPlay"><arg name="filename" type="s" direction="in"/></method>
+    <method name="Broadcast"><arg name="message" type="s" direction="in"/></method>
+    <method name="Status"><arg name="status" type="s" direction="out"/></method>
+    <method name="Files"><arg name="files" type="as" direction="out"/></method>
+    <method name="Activate">
+      <arg name="action" type="s" direction="in"/>
+      <arg name="found" type="b" direction="out"/>
+    </method>
+    <signal name="Event">
+      <arg name="event" type="s"/>
+      <arg name="payload" type="s"/>
+    </signal>
+  </interface>
+</node>`
+
+// dbusApp is the app method calls go to; cgo callbacks cannot carry Go
+// pointers.
+var dbusApp *app
+
+// dbusService is the registered object. A nil *dbusService emits nothing.
+type dbusService struct {
+	conn *C.GDBusConnection
+}
+
+// startDBus exports the service on the session bus connection the
+// application already holds. Without a session bus, as on Windows and
+// macOS, it does nothing.
+func (a *app) startDBus() {
+	conn := C.brain_dbus_app_connection(C.gpointer(unsafe.Pointer(a.gtkApp.Native())))
+	if conn == nil {
+		a.logf("D-Bus service unavailable: no session bus")
+		return
+	}
+	path := C.CString(dbusPath)
+	defer C.free(unsafe.Pointer(path))
+	xml := C.CString(dbusXML)
+	defer C.free(unsafe.Pointer(xml))
+	var cerr *C.char
+	if C.brain_dbus_register(conn, path, xml, &cerr) == 0 {
+		a.logf("D-Bus service disabled: %s", C.GoString(cerr))
+		C.g_free(C.gpointer(unsafe.Pointer(cerr)))
+		return
+	}
+	name := C.CString(dbusName)
+	defer C.free(unsafe.Pointer(name))
+	C.brain_dbus_own_name(conn, name)
+	dbusApp = a
+	a.dbus = &dbusService{conn: conn}
+	a.logf("D-Bus service: %s at %s", dbusName, dbusPath)
+	a.startMPRIS(conn)
+}
+
+// event emits the Event signal for a hub event.
+func (s *dbusService) event(msg hubclient.Message) {
+	if s == nil || msg.Event == "" {
+		return
+	}
+	payload := string(msg.JSONPayload())
+	if payload == "" {
+		payload = "{}"
+	}
+	path := C.CString(dbusPath)
+	defer C.free(unsafe.Pointer(path))
+	iface := C.CString(dbusInterface)
+	defer C.free(unsafe.Pointer(iface))
+	signal := C.CString("Event")
+	defer C.free(unsafe.Pointer(signal))
+	event := C.CString(msg.Event)
+	defer C.free(unsafe.Pointer(event))
+	data := C.CString(payload)
+	defer C.free(unsafe.Pointer(data))
+	C.brain_dbus_emit(s.conn, path, iface, signal, event, data)
+}
+
+// brainDBusMethodCall runs on the GTK main loop. Hub requests go to a
+// goroutine and answer the invocation from there, which GDBus allows.
+//
+//export brainDBusMethodCall
+func brainDBusMethodCall(conn *C.GDBusConnection, sender, method *C.char, params *C.GVariant, inv *C.GDBusMethodInvocation) {
+	a := dbusApp
+	name := C.GoString(method)
+	arg := func() string {
+		s := C.brain_dbus_string_arg(params, 0)
+		defer C.g_free(C.gpointer(unsafe.Pointer(s)))
+		return C.GoString(s)
+	}
+	a.logf("D-Bus: %s from %s", name, C.GoString(sender))
+	switch name {
+	case "Play", "BroadcastPlay", "Broadcast":
+		value := arg()
+		go func() {
+			ctx := hubclient.WithIdempotencyKey(a.ctx, hubclient.NewIdempotencyKey())
+			var err error
+			switch name {
+			case "Play":
+				err = a.currentSocket().Play(ctx, value)
+			case "BroadcastPlay":
+				err = a.currentSocket().BroadcastPlay(ctx, value)
+			default:
+				err = a.currentSocket().Broadcast(ctx, value)
+			}
+			dbusReturn(inv, err)
+		}()
+	case "Status":
+		go func() {
+			status, err := a.currentSocket().Status(a.ctx)
+			if err != nil {
+				dbusReturn(inv, err)
+				return
+			}
+			enc, _ := json.Marshal(status)
+			s := C.CString(string(enc))
+			defer C.free(unsafe.Pointer(s))
+			C.brain_dbus_return_string(inv, s)
+		}()
+	case "Files":
+		go func() {
+			files, err := a.currentSocket().Files(a.ctx)
+			if err != nil {
+				dbusReturn(inv, err)
+				return
+			}
+			names := make([]*C.gchar, len(files))
+			for i, f := range files {
+				names[i] = (*C.gchar)(C.CString(f.Name))
+			}
+			defer func() {
+				for _, n := range names {
+					C.free(unsafe.Pointer(n))
+				}
+			}()
+			var first **C.gchar
+			if len(names) > 0 {
+				first = &names[0]
+			}
+			C.brain_dbus_return_strv(inv, first, C.int(len(names)))
+		}()
+	case "Activate":
+		found := C.int(0)
+		if a.runRegistered(arg()) {
+			found = 1
+		}
+		C.brain_dbus_return_bool(inv, found)
+	default:
+		dbusReturn(inv, errors.New("unknown method "+name))
+	}
+}
+
+// dbusReturn answers an invocation with nothing or with err as a D-Bus
+// error named after its hub error code.
+func dbusReturn(inv *C.GDBusMethodInvocation, err error) {
+	if err == nil {
+		C.brain_dbus_return_empty(inv)
+		return
+	}
+	errName := "org.brain.Client.Error.Failed"
+	var hubErr *protocol.Error
+	switch {
+	case hubclient.IsConnectionError(err):
+		errName = "org.brain.Client.Error.NotConnected"
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, hubclient.ErrTimeout):
+		errName = "org.brain.Client.Error.Timeout"
+	case errors.As(err, &hubErr) && hubErr.Code != "":
+		errName = "org.brain.Client.Error." + dbusErrorName(string(hubErr.Code))
+	}
+	name := C.CString(errName)
+	defer C.free(unsafe.Pointer(name))
+	message := C.CString(protocol.Friendly(err))
+	defer C.free(unsafe.Pointer(message))
+	C.brain_dbus_return_error(inv, name, message)
+}
+
+// dbusErrorName turns a hub error code such as "not-found" into a D-Bus
+// error name element, "NotFound".
+func dbusErrorName(code string) string {
+	out := make([]byte, 0, len(code))
+	upper := true
+	for i := 0; i < len(code); i++ {
+		c := code[i]
+		switch {
+		case c == '-' || c == '_':
+			upper = true
+			continue
+		case upper && c >= 'a' && c <= 'z':
+			c -= 'a' - 'A'
+		case !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'):
+			continue
+		}
+		upper = false
+		out = append(out, c)
+	}
+	if len(out) == 0 || out[0] >= '0' && out[0] <= '9' {
+		return "Failed"
+	}
+	return string(out)
+}
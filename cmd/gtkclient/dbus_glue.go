@@ -0,0 +1,167 @@
+package main
+
+// C side of the D-Bus service and MPRIS player. It lives apart from
+// dbus.go and mpris.go because a file with //export may only declare C
+// functions, not define them.
+
+// #cgo pkg-config: gio-2.0
+// #include <stdlib.h>
+// #include <gio/gio.h>
+//
+// extern void brainDBusMethodCall(GDBusConnection*, char*, char*, GVariant*, GDBusMethodInvocation*);
+// extern void brainMPRISMethodCall(char*, char*, GVariant*, GDBusMethodInvocation*);
+// extern GVariant *brainMPRISGetProperty(char*, char*);
+// extern gboolean brainMPRISSetProperty(char*, char*, GVariant*);
+//
+// static void brain_dbus_method_call(GDBusConnection *conn, const gchar *sender,
+//     const gchar *path, const gchar *iface, const gchar *method,
+//     GVariant *params, GDBusMethodInvocation *inv, gpointer data) {
+//   brainDBusMethodCall(conn, (char*)sender, (char*)method, params, inv);
+// }
+//
+// static const GDBusInterfaceVTable brain_dbus_vtable = { brain_dbus_method_call, NULL, NULL };
+//
+// GDBusConnection *brain_dbus_app_connection(gpointer app) {
+//   return g_application_get_dbus_connection(G_APPLICATION(app));
+// }
+//
+// guint brain_dbus_register(GDBusConnection *conn, const char *path, const char *xml, char **error) {
+//   GError *err = NULL;
+//   GDBusNodeInfo *info = g_dbus_node_info_new_for_xml(xml, &err);
+//   if (info == NULL) {
+//     *error = g_strdup(err->message);
+//     g_error_free(err);
+//     return 0;
+//   }
+//   guint id = g_dbus_connection_register_object(conn, path, info->interfaces[0], &brain_dbus_vtable, NULL, NULL, &err);
+//   g_dbus_node_info_unref(info);
+//   if (id == 0) {
+//     *error = g_strdup(err->message);
+//     g_error_free(err);
+//   }
+//   return id;
+// }
+//
+// guint brain_dbus_own_name(GDBusConnection *conn, const char *name) {
+//   return g_bus_own_name_on_connection(conn, name, G_BUS_NAME_OWNER_FLAGS_NONE, NULL, NULL, NULL, NULL);
+// }
+//
+// char *brain_dbus_string_arg(GVariant *params, int index) {
+//   GVariant *v = g_variant_get_child_value(params, index);
+//   char *s = g_variant_dup_string(v, NULL);
+//   g_variant_unref(v);
+//   return s;
+// }
+//
+// void brain_dbus_return_string(GDBusMethodInvocation *inv, const char *s) {
+//   g_dbus_method_invocation_return_value(inv, g_variant_new("(s)", s));
+// }
+//
+// void brain_dbus_return_bool(GDBusMethodInvocation *inv, int b) {
+//   g_dbus_method_invocation_return_value(inv, g_variant_new("(b)", b));
+// }
+//
+// void brain_dbus_return_strv(GDBusMethodInvocation *inv, const gchar *const *strv, int n) {
+//   GVariant *v = g_variant_new_strv(strv, n);
+//   g_dbus_method_invocation_return_value(inv, g_variant_new_tuple(&v, 1));
+// }
+//
+// void brain_dbus_return_empty(GDBusMethodInvocation *inv) {
+//   g_dbus_method_invocation_return_value(inv, NULL);
+// }
+//
+// void brain_dbus_return_error(GDBusMethodInvocation *inv, const char *name, const char *message) {
+//   g_dbus_method_invocation_return_dbus_error(inv, name, message);
+// }
+//
+// void brain_dbus_emit(GDBusConnection *conn, const char *path, const char *iface,
+//     const char *signal, const char *a, const char *b) {
+//   g_dbus_connection_emit_signal(conn, NULL, path, iface, signal, g_variant_new("(ss)", a, b), NULL);
+// }
+//
+// static void brain_mpris_method_call(GDBusConnection *conn, const gchar *sender,
+//     const gchar *path, const gchar *iface, const gchar *method,
+//     GVariant *params, GDBusMethodInvocation *inv, gpointer data) {
+//   brainMPRISMethodCall((char*)iface, (char*)method, params, inv);
+// }
+//
+// static GVariant *brain_mpris_get_property(GDBusConnection *conn, const gchar *sender,
+//     const gchar *path, const gchar *iface, const gchar *prop, GError **error, gpointer data) {
+//   GVariant *v = brainMPRISGetProperty((char*)iface, (char*)prop);
+//   if (v == NULL) {
+//     g_set_error(error, G_DBUS_ERROR, G_DBUS_ERROR_UNKNOWN_PROPERTY, "no property %s", prop);
+//   }
+//   return v;
+// }
+//
+// static gboolean brain_mpris_set_property(GDBusConnection *conn, const gchar *sender,
+//     const gchar *path, const gchar *iface, const gchar *prop, GVariant *value,
+//     GError **error, gpointer data) {
+//   if (!brainMPRISSetProperty((char*)iface, (char*)prop, value)) {
+//     g_set_error(error, G_DBUS_ERROR, G_DBUS_ERROR_PROPERTY_READ_ONLY, "%s is read-only", prop);
+//     return FALSE;
+//   }
+//   return TRUE;
+// }
+//
+// static const GDBusInterfaceVTable brain_mpris_vtable = {
+//   brain_mpris_method_call, brain_mpris_get_property, brain_mpris_set_property
+// };
+//
+// gboolean brain_mpris_register(GDBusConnection *conn, const char *path, const char *xml, char **error) {
+//   GError *err = NULL;
+//   GDBusNodeInfo *info = g_dbus_node_info_new_for_xml(xml, &err);
+//   if (info == NULL) {
+//     *error = g_strdup(err->message);
+//     g_error_free(err);
+//     return FALSE;
+//   }
+//   for (int i = 0; info->interfaces[i] != NULL; i++) {
+//     if (g_dbus_connection_register_object(conn, path, info->interfaces[i], &brain_mpris_vtable, NULL, NULL, &err) == 0) {
+//       *error = g_strdup(err->message);
+//       g_error_free(err);
+//       g_dbus_node_info_unref(info);
+//       return FALSE;
+//     }
+//   }
+//   g_dbus_node_info_unref(info);
+//   return TRUE;
+// }
+//
+// GVariant *brain_mpris_metadata(const char *trackid, const char *title, const char *artist, gint64 length) {
+//   GVariantBuilder b;
+//   g_variant_builder_init(&b, G_VARIANT_TYPE("a{sv}"));
+//   g_variant_builder_add(&b, "{sv}", "mpris:trackid", g_variant_new_object_path(trackid));
+//   if (title[0] != 0) {
+//     g_variant_builder_add(&b, "{sv}", "xesam:title", g_variant_new_string(title));
+//   }
+//   if (artist[0] != 0) {
+//     const gchar *artists[] = { artist, NULL };
+//     g_variant_builder_add(&b, "{sv}", "xesam:artist", g_variant_new_strv(artists, -1));
+//   }
+//   if (length > 0) {
+//     g_variant_builder_add(&b, "{sv}", "mpris:length", g_variant_new_int64(length));
+//   }
+//   return g_variant_builder_end(&b);
+// }
+//
+// GVariant *brain_mpris_empty_strv(void) {
+//   return g_variant_new_strv(NULL, 0);
+// }
+//
+// void brain_mpris_emit_changed(GDBusConnection *conn, const char *path, const char *iface,
+//     const char *const *names, GVariant **values, int n) {
+//   GVariantBuilder b;
+//   g_variant_builder_init(&b, G_VARIANT_TYPE("a{sv}"));
+//   for (int i = 0; i < n; i++) {
+//     g_variant_builder_add(&b, "{sv}", names[i], values[i]);
+//   }
+//   g_dbus_connection_emit_signal(conn, NULL, path, "org.freedesktop.DBus.Properties", "PropertiesChanged",
+//       g_variant_new("(sa{sv}as)", iface, &b, NULL), NULL);
+// }
+//
+// void brain_mpris_emit_seeked(GDBusConnection *conn, const char *path, gint64 position) {
+//   g_dbus_connection_emit_signal(conn, NULL, path, "org.mpris.MediaPlayer2.Player", "Seeked",
+//       g_variant_new("(x)", position), NULL);
+// }
+import "C"
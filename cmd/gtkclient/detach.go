@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// panelLayout remembers whether a panel is popped out and where its window
+// was, so control-room layouts survive a restart.
+type panelLayout struct {
+	Detached bool `json:"detached,omitempty"`
+	X        int  `json:"x,omitempty"`
+	Y        int  `json:"y,omitempty"`
+	Width    int  `json:"width,omitempty"`
+	Height   int  `json:"height,omitempty"`
+}
+
+// panelDock is a panel that can leave the main window. home keeps its place
+// and shows placeholder while the panel lives in window.
+type panelDock struct {
+	name        string
+	title       string
+	panel       gtk.IWidget
+	home        *gtk.Box
+	placeholder *gtk.Box
+	window      *gtk.Window
+}
+
+// panelNames lists the detachable panels in menu order.
+var panelNames = []string{"log", "audio", "files", "peers"}
+
+// dockPanel wraps panel in a box that stays in the main window and
+// registers it for popping out. Must run on the GTK main loop.
+func (a *app) dockPanel(name, title string, panel gtk.IWidget) *gtk.Box {
+	home, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 0)
+	home.PackStart(panel, true, true, 0)
+
+	placeholder, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	placeholder.SetMarginStart(6)
+	placeholder.SetMarginTop(4)
+	placeholder.SetMarginBottom(4)
+	label, _ := gtk.LabelNew(fmt.Sprintf(tr("%s is shown in its own window"), title))
+	addStyleClass(label, "dim-label")
+	placeholder.PackStart(label, false, false, 0)
+	dockBtn, _ := gtk.ButtonNewWithLabel(tr("Dock"))
+	dockBtn.SetTooltipText(tr("Put the panel back into the main window"))
+	dockBtn.Connect("clicked", func() { a.setPanelDetached(name, false) })
+	placeholder.PackStart(dockBtn, false, false, 0)
+	label.Show()
+	dockBtn.Show()
+	placeholder.SetNoShowAll(true)
+	home.PackStart(placeholder, false, false, 0)
+
+	if a.docks == nil {
+		a.docks = make(map[string]*panelDock)
+	}
+	a.docks[name] = &panelDock{name: name, title: title, panel: panel, home: home, placeholder: placeholder}
+	return home
+}
+
+// installPanelActions adds app.panel-<name>, toggles for the app menu and
+// the command palette that pop each panel out or dock it again.
+func (a *app) installPanelActions() {
+	for _, name := range panelNames {
+		name := name
+		action := glib.SimpleActionNewStateful("panel-"+name, nil, glib.VariantFromBoolean(false))
+		action.Connect("change-state", func(action *glib.SimpleAction, value *glib.Variant) {
+			a.setPanelDetached(name, value.GetBoolean())
+		})
+		a.gtkApp.AddAction(action)
+		if a.panelActions == nil {
+			a.panelActions = make(map[string]*glib.SimpleAction)
+		}
+		a.panelActions[name] = action
+	}
+}
+
+func (a *app) panelDetached(name string) bool {
+	d := a.docks[name]
+	return d != nil && d.window != nil
+}
+
+func (a *app) togglePanel(name string) {
+	a.setPanelDetached(name, !a.panelDetached(name))
+}
+
+// setPanelDetached pops a panel out or docks it and remembers the choice.
+// Must run on the GTK main loop.
+func (a *app) setPanelDetached(name string, detached bool) {
+	d := a.docks[name]
+	if d == nil {
+		return
+	}
+	if detached {
+		a.popOut(d)
+	} else {
+		a.dock(d)
+	}
+	a.panelLayout(name).Detached = detached
+	if err := a.config.save(); err != nil {
+		a.reportError("save window layout", err, nil)
+	}
+}
+
+func (a *app) panelLayout(name string) *panelLayout {
+	if a.config.Panels == nil {
+		a.config.Panels = make(map[string]*panelLayout)
+	}
+	l := a.config.Panels[name]
+	if l == nil {
+		l = &panelLayout{}
+		a.config.Panels[name] = l
+	}
+	return l
+}
+
+func (a *app) popOut(d *panelDock) {
+	if d.window != nil {
+		d.window.Present()
+		return
+	}
+	win, err := gtk.WindowNew(gtk.WINDOW_TOPLEVEL)
+	if err != nil {
+		a.logf("pop out %s: %v", d.name, err)
+		return
+	}
+	win.SetTitle(fmt.Sprintf(tr("%s — Brain Hub"), d.title))
+	win.SetDefaultSize(480, 360)
+	if l := a.config.Panels[d.name]; l != nil && l.Width > 0 && l.Height > 0 {
+		win.SetDefaultSize(l.Width, l.Height)
+		win.Move(l.X, l.Y)
+	}
+	a.gtkApp.AddWindow(win)
+	d.home.Remove(d.panel)
+	win.Add(d.panel)
+	d.placeholder.Show()
+	d.window = win
+
+	win.Connect("configure-event", func() bool {
+		l := a.panelLayout(d.name)
+		l.X, l.Y = win.GetPosition()
+		l.Width, l.Height = win.GetSize()
+		return false
+	})
+	win.Connect("delete-event", func() bool {
+		a.setPanelDetached(d.name, false)
+		return true
+	})
+	win.ShowAll()
+	if action := a.panelActions[d.name]; action != nil {
+		action.SetState(glib.VariantFromBoolean(true))
+	}
+}
+
+func (a *app) dock(d *panelDock) {
+	if d.window == nil {
+		return
+	}
+	win := d.window
+	d.window = nil
+	win.Remove(d.panel)
+	d.home.PackStart(d.panel, true, true, 0)
+	d.home.ReorderChild(d.panel, 0)
+	d.placeholder.Hide()
+	win.Destroy()
+	if action := a.panelActions[d.name]; action != nil {
+		action.SetState(glib.VariantFromBoolean(false))
+	}
+}
+
+// restorePanels pops out the panels that were detached when the client last
+// ran. Must run on the GTK main loop after the main window is shown.
+func (a *app) restorePanels() {
+	for _, name := range panelNames {
+		if l := a.config.Panels[name]; l != nil && l.Detached {
+			if d := a.docks[name]; d != nil {
+				a.popOut(d)
+			}
+		}
+	}
+}
+
+// saveLayout writes the config at exit, keeping the main window's
+// geometry, panels still popped out and the folded traffic totals.
+func (a *app) saveLayout() {
+	if err := a.config.save(); err != nil {
+		fmt.Printf("save window layout: %v\n", err)
+	}
+}
+
+func (a *app) panelShortcuts() []shortcut {
+	titles := map[string][2]string{
+		"log":   {tr("Pop out the log"), tr("Dock the log")},
+		"audio": {tr("Pop out the audio grid"), tr("Dock the audio grid")},
+		"files": {tr("Pop out the files panel"), tr("Dock the files panel")},
+		"peers": {tr("Pop out the peers panel"), tr("Dock the peers panel")},
+	}
+	var list []shortcut
+	for _, name := range panelNames {
+		name := name
+		if a.docks[name] == nil {
+			continue
+		}
+		title := titles[name][0]
+		if a.panelDetached(name) {
+			title = titles[name][1]
+		}
+		list = append(list, shortcut{action: "panel-" + name, title: title, group: tr("Windows"), run: func(a *app) { a.togglePanel(name) }})
+	}
+	return list
+}
@@ -0,0 +1,751 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	directTransferMinSize = 32 * 1024 * 1024
+	// directAnswerTimeout leaves the peer time to read the accept dialog;
+	// directConnectTimeout only starts once they said yes.
+	directAnswerTimeout    = 2 * time.Minute
+	directConnectTimeout   = 15 * time.Second
+	directHandshakeTimeout = 5 * time.Second
+	directHandshakePrefix  = "brain-transfer"
+	// relayFolder holds files relayed through the hub, one folder per
+	// transfer. Hubs that can expire uploads drop them after relayTTL; the
+	// receiver accepts a relay for relayWait after saying yes.
+	relayFolder = "transfers"
+	relayTTL    = 24 * time.Hour
+	relayWait   = time.Hour
+)
+
+// directTransfer tracks one brokered peer-to-peer transfer. The hub only
+// relays the offer/answer exchange; file bytes flow over whichever TCP
+// connection between the two clients comes up first.
+type directTransfer struct {
+	id       string
+	token    string
+	peer     string
+	path     string
+	filename string
+	size     int64
+
+	listener net.Listener
+	conns    chan *directConn
+	answers  chan transferAnswer
+	done     chan struct{}
+	once     sync.Once
+
+	// open holds every connection handed to offer so close can drop the
+	// ones nobody picked.
+	mu     sync.Mutex
+	closed bool
+	open   []net.Conn
+}
+
+type directConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+type transferOffer struct {
+	TransferID  string   `json:"transferId"`
+	From        string   `json:"from"`
+	Filename    string   `json:"filename"`
+	Size        int64    `json:"size"`
+	ContentType string   `json:"contentType"`
+	Token       string   `json:"token"`
+	Endpoints   []string `json:"endpoints"`
+}
+
+type transferAnswer struct {
+	TransferID string   `json:"transferId"`
+	Accept     bool     `json:"accept"`
+	Endpoints  []string `json:"endpoints"`
+	Reason     string   `json:"reason"`
+}
+
+type transferOfferResponse struct {
+	TransferID string `json:"transferId"`
+}
+
+func newDirectTransfer() (*directTransfer, error) {
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	return &directTransfer{
+		listener: ln,
+		conns:    make(chan *directConn, 4),
+		answers:  make(chan transferAnswer, 1),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+func (t *directTransfer) close() {
+	t.once.Do(func() {
+		close(t.done)
+		_ = t.listener.Close()
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.closed = true
+		for _, conn := range t.open {
+			_ = conn.Close()
+		}
+		t.open = nil
+	})
+}
+
+// acceptLoop waits for the remote side to dial us and proves it knows the
+// transfer token before handing the connection over.
+func (t *directTransfer) acceptLoop() {
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			_ = conn.SetReadDeadline(time.Now().Add(directHandshakeTimeout))
+			reader := bufio.NewReader(conn)
+			line, err := reader.ReadString('\n')
+			if err != nil || strings.TrimSpace(line) != directHandshakePrefix+" "+t.token {
+				_ = conn.Close()
+				return
+			}
+			_ = conn.SetReadDeadline(time.Time{})
+			t.offer(&directConn{conn: conn, reader: reader})
+		}()
+	}
+}
+
+// dialEndpoints races connections to every advertised endpoint.
+func (t *directTransfer) dialEndpoints(endpoints []string) {
+	for _, endpoint := range endpoints {
+		endpoint := endpoint
+		go func() {
+			dialer := net.Dialer{Timeout: directHandshakeTimeout}
+			conn, err := dialer.Dial("tcp", endpoint)
+			if err != nil {
+				return
+			}
+			if _, err := fmt.Fprintf(conn, "%s %s\n", directHandshakePrefix, t.token); err != nil {
+				_ = conn.Close()
+				return
+			}
+			t.offer(&directConn{conn: conn, reader: bufio.NewReader(conn)})
+		}()
+	}
+}
+
+func (t *directTransfer) offer(dc *directConn) {
+	t.mu.Lock()
+	if t.closed {
+		t.mu.Unlock()
+		_ = dc.conn.Close()
+		return
+	}
+	t.open = append(t.open, dc.conn)
+	t.mu.Unlock()
+	select {
+	case <-t.done:
+	case t.conns <- dc:
+	}
+}
+
+func (t *directTransfer) endpoints() []string {
+	port := t.listener.Addr().(*net.TCPAddr).Port
+	return localEndpoints(port)
+}
+
+func localEndpoints(port int) []string {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return nil
+	}
+	endpoints := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		ipNet, ok := addr.(*net.IPNet)
+		if !ok || ipNet.IP.IsLoopback() || ipNet.IP.IsLinkLocalUnicast() {
+			continue
+		}
+		endpoints = append(endpoints, net.JoinHostPort(ipNet.IP.String(), strconv.Itoa(port)))
+	}
+	return endpoints
+}
+
+func newTransferToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func (a *app) registerTransfer(t *directTransfer) {
+	a.transfersMu.Lock()
+	defer a.transfersMu.Unlock()
+	if a.transfers == nil {
+		a.transfers = make(map[string]*directTransfer)
+	}
+	a.transfers[t.id] = t
+}
+
+func (a *app) unregisterTransfer(id string) {
+	a.transfersMu.Lock()
+	defer a.transfersMu.Unlock()
+	delete(a.transfers, id)
+}
+
+func (a *app) lookupTransfer(id string) *directTransfer {
+	a.transfersMu.Lock()
+	defer a.transfersMu.Unlock()
+	return a.transfers[id]
+}
+
+// setDirectTransferAvailable enables Send Direct when the hub brokers
+// direct transfers and the role may offer one. It must run on the GTK main
+// loop.
+func (a *app) setDirectTransferAvailable(ok bool, role protocol.Role) {
+	if a.directBtn == nil {
+		return
+	}
+	allowed := ok && role.Allows("transfer-offer")
+	a.directBtn.SetSensitive(allowed)
+	switch {
+	case allowed:
+		a.directBtn.SetTooltipText(tr("Send the chosen file straight to the peer above"))
+	case !ok:
+		a.directBtn.SetTooltipText(tr("This hub cannot broker direct transfers"))
+	default:
+		a.directBtn.SetTooltipText(roleTooltip(role))
+	}
+}
+
+// runDirectTransfer offers path to peer through the hub and, once the peer
+// accepts, streams it over a direct connection. Files below
+// directTransferMinSize, and any transfer whose direct connection fails,
+// are relayed: uploaded to the hub for the peer to download. A peer that
+// declines or never answers gets nothing.
+func (a *app) runDirectTransfer(path, remote, peer string) {
+	if path == "" {
+		a.logf("no upload file selected")
+		return
+	}
+	peer = strings.TrimSpace(peer)
+	if peer == "" {
+		a.logf("direct transfer peer missing")
+		return
+	}
+	remote = strings.TrimSpace(remote)
+	if remote == "" {
+		remote = filepath.Base(path)
+	}
+	if !a.currentSocket().Supports(protocol.CapDirectTransfer) {
+		a.reportError("direct transfer", fmt.Errorf("%w (needs %s)", hubclient.ErrUnsupported, protocol.CapDirectTransfer), nil)
+		return
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		a.reportError("direct transfer", err, nil)
+		return
+	}
+	retry := func() { a.runDirectTransfer(path, remote, peer) }
+
+	t, err := newDirectTransfer()
+	if err != nil {
+		a.reportError("direct transfer", err, retry)
+		return
+	}
+	defer t.close()
+	t.peer = peer
+	t.path = path
+	t.filename = remote
+	t.size = info.Size()
+	if t.token, err = newTransferToken(); err != nil {
+		a.reportError("direct transfer", err, retry)
+		return
+	}
+	// a small file is not worth a direct connection; it goes through the
+	// hub once the peer accepts
+	direct := t.size >= directTransferMinSize
+	endpoints := []string{}
+	if direct {
+		endpoints = t.endpoints()
+	}
+
+	var res transferOfferResponse
+	if err := a.socketRequest("transfer-offer", map[string]any{
+		"peer":        peer,
+		"filename":    remote,
+		"size":        t.size,
+		"contentType": hubclient.ContentType(remote),
+		"token":       t.token,
+		"endpoints":   endpoints,
+	}, &res); err != nil {
+		a.reportError("direct transfer", fmt.Errorf("offering %s to %s: %w", remote, peer, err), retry)
+		return
+	}
+	if res.TransferID == "" {
+		a.reportError("direct transfer", fmt.Errorf("offering %s to %s: hub returned no transfer id", remote, peer), nil)
+		return
+	}
+	t.id = res.TransferID
+	a.registerTransfer(t)
+	defer a.unregisterTransfer(t.id)
+	if direct {
+		go t.acceptLoop()
+	}
+	a.logf("direct transfer offered to %s: %s (%s)", peer, remote, formatBytes(t.size))
+
+	deadline := time.NewTimer(directAnswerTimeout)
+	defer deadline.Stop()
+	accepted := false
+	for {
+		select {
+		case answer := <-t.answers:
+			if !answer.Accept {
+				reason := answer.Reason
+				if reason == "" {
+					reason = "declined"
+				}
+				a.logf("direct transfer to %s declined: %s", peer, reason)
+				return
+			}
+			if !direct {
+				a.relayTransfer(t)
+				return
+			}
+			if !accepted {
+				accepted = true
+				if !deadline.Stop() {
+					select {
+					case <-deadline.C:
+					default:
+					}
+				}
+				deadline.Reset(directConnectTimeout)
+			}
+			t.dialEndpoints(answer.Endpoints)
+		case dc := <-t.conns:
+			err := a.sendDirect(t, dc)
+			if err == nil {
+				return
+			}
+			a.logf("direct transfer stream error: %v, relaying through the hub", err)
+			a.relayTransfer(t)
+			return
+		case <-t.done:
+			a.logf("direct transfer to %s cancelled by the peer", peer)
+			return
+		case <-deadline.C:
+			if accepted {
+				a.logf("direct transfer to %s could not connect, relaying through the hub", peer)
+				a.relayTransfer(t)
+				return
+			}
+			a.cancelTransfer(t.id, "", "no answer")
+			a.reportError("direct transfer", fmt.Errorf("%s did not answer the offer of %s; nothing was sent", peer, remote), retry)
+			return
+		}
+	}
+}
+
+// relayTransfer sends t's file through the hub: it is uploaded under
+// relayFolder, temporary where the hub allows, and a transfer-cancel with
+// fallback "relay" tells the peer to download it. Failing that, the peer
+// is told the transfer is off.
+func (a *app) relayTransfer(t *directTransfer) {
+	ctx, done := a.startOp("upload")
+	defer done()
+	name := relayFolder + "/" + t.id + "/" + filepath.Base(t.filename)
+	if err := a.uploadRelay(ctx, name, t); err != nil {
+		a.cancelTransfer(t.id, "", "relay failed")
+		a.reportError("direct transfer", fmt.Errorf("relaying %s to %s: %w", t.filename, t.peer, err), nil)
+		return
+	}
+	if err := a.socketRequest("transfer-cancel", map[string]any{
+		"transferId": t.id,
+		"fallback":   "relay",
+		"filename":   name,
+	}, nil); err != nil {
+		a.reportError("direct transfer", fmt.Errorf("%s is on the hub as %s, but %s could not be told: %w", t.filename, name, t.peer, err), nil)
+		return
+	}
+	a.logf("direct transfer relayed: %s to %s through the hub (%s)", t.filename, t.peer, formatBytes(t.size))
+}
+
+// uploadRelay uploads t's file as name, in chunks when the hub takes them.
+func (a *app) uploadRelay(ctx context.Context, name string, t *directTransfer) error {
+	hub := a.currentSocket()
+	var ttl time.Duration
+	temporary := hub.Supports(protocol.CapTemporary)
+	if temporary {
+		ttl = relayTTL
+	}
+	if !hub.Supports(protocol.CapChunkedUpload) {
+		if t.size > copyPlainMax {
+			return fmt.Errorf("the hub does not take chunked uploads, and %s is over the %s one upload can carry", formatBytes(t.size), formatBytes(copyPlainMax))
+		}
+		data, err := os.ReadFile(t.path)
+		if err != nil {
+			return err
+		}
+		res, err := hub.Upload(ctx, hubclient.UploadRequest{Filename: name, Data: data, Temporary: temporary, TTL: ttl})
+		if err != nil {
+			return err
+		}
+		a.recordTransfer("upload", "relay", int64(len(data)))
+		a.warnUnverified(res)
+		return nil
+	}
+	digest, hashed, err := fileSHA256(t.path)
+	if err != nil {
+		return err
+	}
+	if hashed != t.size {
+		return fmt.Errorf("%s changed while reading", t.path)
+	}
+	up, err := hub.UploadBegin(ctx, hubclient.UploadBeginRequest{Filename: name, Size: t.size, SHA256: digest, Temporary: temporary, TTL: ttl})
+	if err != nil {
+		return err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = hub.UploadCancel(a.ctx, up.UploadID)
+		}
+	}()
+	f, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	buf := make([]byte, chunkSizeFor(a.uploadLimit(), hub.BinaryFrames()))
+	offset := up.Offset
+	for offset < t.size {
+		n, err := f.ReadAt(buf[:min(int64(len(buf)), t.size-offset)], offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("%s shrank to %s", t.path, formatBytes(offset))
+		}
+		ack, err := hub.UploadChunk(ctx, up.UploadID, offset, buf[:n])
+		if err != nil {
+			return err
+		}
+		if ack.Offset != offset+int64(n) {
+			return fmt.Errorf("hub acknowledged offset %d after sending %d", ack.Offset, offset+int64(n))
+		}
+		a.recordTransfer("upload", "relay", int64(n))
+		offset = ack.Offset
+	}
+	res, err := hub.UploadCommit(ctx, up.UploadID, digest)
+	if err != nil {
+		return err
+	}
+	committed = true
+	if temporary {
+		if err := hubclient.CheckTemporary(res, ttl); err != nil {
+			return err
+		}
+	}
+	a.warnUnverified(res)
+	return nil
+}
+
+func (a *app) sendDirect(t *directTransfer, dc *directConn) (err error) {
+	defer dc.conn.Close()
+	_, span := a.telemetry.startSpan(a.ctx, "transfer.direct.send", map[string]any{"brain.filename": t.filename, "brain.peer": t.peer, "brain.bytes": t.size})
+	defer func() { span.end(err) }()
+	file, err := os.Open(t.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	started := time.Now()
+	if _, err := fmt.Fprintf(dc.conn, "go %d\n", t.size); err != nil {
+		return err
+	}
+	written, err := io.Copy(dc.conn, file)
+	if err != nil {
+		return err
+	}
+	if written != t.size {
+		return fmt.Errorf("short write: %d of %d bytes", written, t.size)
+	}
+	// wait for the receiver to confirm it stored every byte
+	_ = dc.conn.SetReadDeadline(time.Now().Add(directConnectTimeout))
+	line, err := dc.reader.ReadString('\n')
+	if err != nil {
+		return fmt.Errorf("no receipt from peer: %w", err)
+	}
+	if strings.TrimSpace(line) != "ok" {
+		return fmt.Errorf("peer rejected transfer: %s", strings.TrimSpace(line))
+	}
+	a.recordTransfer("upload", "direct", written)
+	a.logf("direct transfer complete: %s to %s via %s (%s in %s)", t.filename, t.peer, dc.conn.RemoteAddr(), formatBytes(written), time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+func (a *app) cancelTransfer(id, fallback, reason string) {
+	if err := a.socketRequest("transfer-cancel", map[string]any{
+		"transferId": id,
+		"fallback":   fallback,
+		"reason":     reason,
+	}, nil); err != nil {
+		a.logf("transfer cancel error: %v", err)
+	}
+}
+
+func (a *app) handleTransferOffer(payload json.RawMessage) {
+	var offer transferOffer
+	if err := json.Unmarshal(payload, &offer); err != nil {
+		a.logf("transfer-offer parse error: %v", err)
+		return
+	}
+	if offer.TransferID == "" || offer.Token == "" {
+		a.logf("transfer-offer missing id or token")
+		return
+	}
+	from := offer.From
+	if from == "" {
+		from = tr("unknown")
+	}
+	glib.IdleAdd(func() bool {
+		dialog := gtk.MessageDialogNew(a.win, gtk.DIALOG_MODAL, gtk.MESSAGE_QUESTION, gtk.BUTTONS_YES_NO,
+			"%s", fmt.Sprintf(tr("%s wants to send %s (%s) directly. Accept?"), from, filepath.Base(offer.Filename), formatBytes(offer.Size)))
+		response := dialog.Run()
+		dialog.Destroy()
+		go a.answerTransfer(offer, response == gtk.RESPONSE_YES)
+		return false
+	})
+}
+
+func (a *app) answerTransfer(offer transferOffer, accept bool) {
+	if !accept {
+		if err := a.socketRequest("transfer-answer", map[string]any{
+			"transferId": offer.TransferID,
+			"accept":     false,
+			"reason":     "declined by user",
+		}, nil); err != nil {
+			a.logf("transfer answer error: %v", err)
+		}
+		a.logf("direct transfer declined: %s", offer.Filename)
+		return
+	}
+
+	t, err := newDirectTransfer()
+	if err != nil {
+		a.logf("direct transfer listen error: %v", err)
+		return
+	}
+	defer t.close()
+	t.id = offer.TransferID
+	t.token = offer.Token
+	t.peer = offer.From
+	t.filename = filepath.Base(offer.Filename)
+	t.size = offer.Size
+	a.registerTransfer(t)
+	defer a.unregisterTransfer(t.id)
+	a.awaitRelay(offer)
+
+	if err := a.socketRequest("transfer-answer", map[string]any{
+		"transferId": offer.TransferID,
+		"accept":     true,
+		"endpoints":  t.endpoints(),
+	}, nil); err != nil {
+		a.logf("transfer answer error: %v", err)
+		return
+	}
+	go t.acceptLoop()
+	t.dialEndpoints(offer.Endpoints)
+
+	// Several candidate connections may come up; the sender picks one and
+	// announces it with a "go" line, the rest are dropped.
+	chosen := make(chan *directConn, 1)
+	deadline := time.NewTimer(directConnectTimeout)
+	defer deadline.Stop()
+	for {
+		select {
+		case dc := <-t.conns:
+			go func() {
+				_ = dc.conn.SetReadDeadline(time.Now().Add(directConnectTimeout))
+				line, err := dc.reader.ReadString('\n')
+				if err != nil || !strings.HasPrefix(line, "go ") {
+					_ = dc.conn.Close()
+					return
+				}
+				size, err := strconv.ParseInt(strings.TrimSpace(strings.TrimPrefix(line, "go ")), 10, 64)
+				if err != nil || size != t.size {
+					a.logf("direct transfer from %s announced %s, offer said %s; rejecting", t.peer, strings.TrimSpace(line), formatBytes(t.size))
+					_, _ = fmt.Fprintf(dc.conn, "error size mismatch\n")
+					_ = dc.conn.Close()
+					return
+				}
+				_ = dc.conn.SetReadDeadline(time.Time{})
+				select {
+				case chosen <- dc:
+				default:
+					_ = dc.conn.Close()
+				}
+			}()
+		case dc := <-chosen:
+			if err := a.receiveDirect(t, dc); err != nil {
+				a.logf("direct transfer receive error: %v", err)
+			}
+			return
+		case <-t.done:
+			a.logf("direct transfer cancelled by sender: %s", t.filename)
+			return
+		case <-deadline.C:
+			a.logf("direct transfer from %s timed out waiting for connection", t.peer)
+			return
+		}
+	}
+}
+
+func (a *app) receiveDirect(t *directTransfer, dc *directConn) (err error) {
+	defer dc.conn.Close()
+	_, span := a.telemetry.startSpan(a.ctx, "transfer.direct.receive", map[string]any{"brain.filename": t.filename, "brain.peer": t.peer, "brain.bytes": t.size})
+	defer func() { span.end(err) }()
+	dir, err := a.receiveDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, ".transfer-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	started := time.Now()
+	received, err := io.Copy(tmp, io.LimitReader(dc.reader, t.size))
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil && received != t.size {
+		err = fmt.Errorf("short read: %d of %d bytes", received, t.size)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(dc.conn, "error %v\n", err)
+		return err
+	}
+	target, err := placeUnique(tmp.Name(), dir, t.filename)
+	if err != nil {
+		_, _ = fmt.Fprintf(dc.conn, "error %v\n", err)
+		return err
+	}
+	_, _ = io.WriteString(dc.conn, "ok\n")
+	a.recordTransfer("download", "direct", received)
+	a.logf("direct transfer received: %s from %s (%s in %s)", target, t.peer, formatBytes(received), time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+func (a *app) handleTransferAnswer(payload json.RawMessage) {
+	var answer transferAnswer
+	if err := json.Unmarshal(payload, &answer); err != nil {
+		a.logf("transfer-answer parse error: %v", err)
+		return
+	}
+	t := a.lookupTransfer(answer.TransferID)
+	if t == nil {
+		return
+	}
+	select {
+	case t.answers <- answer:
+	default:
+	}
+}
+
+func (a *app) handleTransferCancel(payload json.RawMessage) {
+	var data struct {
+		TransferID string `json:"transferId"`
+		Fallback   string `json:"fallback"`
+		Filename   string `json:"filename"`
+		Reason     string `json:"reason"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		a.logf("transfer-cancel parse error: %v", err)
+		return
+	}
+	if t := a.lookupTransfer(data.TransferID); t != nil {
+		t.close()
+	}
+	offer, ok := a.takeRelay(data.TransferID)
+	if !ok {
+		return
+	}
+	if data.Fallback == "relay" && data.Filename != "" {
+		go a.receiveRelay(offer, data.Filename)
+		return
+	}
+	if data.Reason != "" {
+		a.logf("direct transfer of %s from %s called off: %s", offer.Filename, offer.From, data.Reason)
+	}
+}
+
+// awaitRelay remembers an accepted offer for relayWait, so the sender
+// can still deliver it through the hub after the direct connection fails.
+func (a *app) awaitRelay(offer transferOffer) {
+	a.transfersMu.Lock()
+	defer a.transfersMu.Unlock()
+	if a.relayWaits == nil {
+		a.relayWaits = make(map[string]transferOffer)
+	}
+	a.relayWaits[offer.TransferID] = offer
+	time.AfterFunc(relayWait, func() { a.takeRelay(offer.TransferID) })
+}
+
+func (a *app) takeRelay(id string) (transferOffer, bool) {
+	a.transfersMu.Lock()
+	defer a.transfersMu.Unlock()
+	offer, ok := a.relayWaits[id]
+	delete(a.relayWaits, id)
+	return offer, ok
+}
+
+// receiveRelay downloads the file the sender of offer uploaded instead of
+// streaming it, then removes it from the hub unless the hub expires it.
+func (a *app) receiveRelay(offer transferOffer, filename string) {
+	path, size, err := a.downloadHubFile(filename)
+	if err == nil && size != offer.Size {
+		_ = os.Remove(path)
+		err = fmt.Errorf("got %s, offer said %s", formatBytes(size), formatBytes(offer.Size))
+	}
+	if err != nil {
+		a.reportError("direct transfer", fmt.Errorf("fetching %s from %s through the hub: %w", offer.Filename, offer.From, err), nil)
+		return
+	}
+	a.logf("direct transfer received through the hub: %s from %s (%s)", path, offer.From, formatBytes(size))
+	hub := a.currentSocket()
+	if !hub.Supports(protocol.CapTemporary) && hub.Supports(protocol.CapDelete) && hub.Role().Allows("delete") {
+		if err := hub.Delete(a.ctx, filename); err != nil {
+			a.logf("direct transfer: could not remove relayed %s: %v", filename, err)
+		}
+	}
+}
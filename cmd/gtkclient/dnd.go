@@ -0,0 +1,188 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// dndTick is how often the status bar rechecks the quiet hours.
+const dndTick = 30 * time.Second
+
+// quietHours is a daily span, e.g. {"from": "22:00", "to": "07:00"},
+// that may run past midnight.
+type quietHours struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+func (q quietHours) String() string { return q.From + "–" + q.To }
+
+// parseClock parses an "HH:MM" time as minutes after midnight.
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time like 22:00", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func (q quietHours) valid() error {
+	if _, err := parseClock(q.From); err != nil {
+		return err
+	}
+	_, err := parseClock(q.To)
+	return err
+}
+
+// contains reports whether now falls in the quiet hours.
+func (q quietHours) contains(now time.Time) bool {
+	from, err1 := parseClock(q.From)
+	to, err2 := parseClock(q.To)
+	if err1 != nil || err2 != nil || from == to {
+		return false
+	}
+	m := now.Hour()*60 + now.Minute()
+	if from < to {
+		return m >= from && m < to
+	}
+	return m >= from || m < to
+}
+
+// dndState reports whether do not disturb is on and why, for the status
+// bar: the toggle, or the quiet hours.
+func (a *app) dndState() (on, quiet bool) {
+	if a.profile() == nil {
+		return false, false
+	}
+	if a.profile().DoNotDisturb {
+		return true, false
+	}
+	if q := a.profile().QuietHours; q != nil && q.contains(time.Now()) {
+		return true, true
+	}
+	return false, false
+}
+
+func (a *app) dndActive() bool {
+	on, _ := a.dndState()
+	return on
+}
+
+// installDNDActions adds app.do-not-disturb, a toggle shared by the status
+// bar button, the app menu and the command palette.
+func (a *app) installDNDActions() {
+	dnd := glib.SimpleActionNewStateful("do-not-disturb", nil, glib.VariantFromBoolean(a.profile().DoNotDisturb))
+	dnd.Connect("change-state", func(action *glib.SimpleAction, value *glib.Variant) {
+		a.setDoNotDisturb(value.GetBoolean())
+	})
+	a.gtkApp.AddAction(dnd)
+	a.dndAction = dnd
+}
+
+// setDoNotDisturb saves the toggle. Must run on the GTK main loop.
+func (a *app) setDoNotDisturb(on bool) {
+	if a.profile().DoNotDisturb != on {
+		a.updateProfile(func(p *profileConfig) { p.DoNotDisturb = on })
+		if err := a.config.save(); err != nil {
+			a.reportError("save do not disturb", err, nil)
+		}
+		if on {
+			a.logf("do not disturb on")
+		} else {
+			a.logf("do not disturb off")
+		}
+	}
+	if a.dndAction != nil {
+		a.dndAction.SetState(glib.VariantFromBoolean(on))
+	}
+	a.refreshDNDIndicator()
+}
+
+func (a *app) toggleDoNotDisturb() {
+	a.setDoNotDisturb(!a.profile().DoNotDisturb)
+}
+
+// buildDNDIndicator adds the do not disturb toggle to the status bar. It
+// also lights up during quiet hours with the toggle off.
+func (a *app) buildDNDIndicator(box *gtk.Box) {
+	btn, _ := gtk.ToggleButtonNew()
+	icon, _ := gtk.ImageNewFromIconName("notifications-disabled-symbolic", gtk.ICON_SIZE_BUTTON)
+	btn.SetImage(icon)
+	btn.SetAlwaysShowImage(true)
+	btn.SetActionName("app.do-not-disturb")
+	setAccessible(btn, tr("Do not disturb"), "")
+	box.PackEnd(btn, false, false, 0)
+	a.dndButton = btn
+	a.refreshDNDIndicator()
+	glib.TimeoutAdd(uint(dndTick/time.Millisecond), func() bool {
+		if a.ctx.Err() != nil {
+			return false
+		}
+		a.refreshDNDIndicator()
+		return true
+	})
+}
+
+// refreshDNDIndicator must run on the GTK main loop.
+func (a *app) refreshDNDIndicator() {
+	btn := a.dndButton
+	if btn == nil {
+		return
+	}
+	on, quiet := a.dndState()
+	switch {
+	case quiet:
+		btn.SetLabel(tr("Quiet hours"))
+		btn.SetTooltipText(fmt.Sprintf(tr("Quiet hours (%s): broadcasts from peers are silenced and yours ask first"), a.profile().QuietHours))
+	case on:
+		btn.SetLabel(tr("Do not disturb"))
+		btn.SetTooltipText(tr("Broadcasts from peers are silenced and yours ask first"))
+	default:
+		btn.SetLabel("")
+		btn.SetTooltipText(tr("Do not disturb"))
+	}
+}
+
+// buildDNDPreferences adds the quiet hours to the preferences and returns
+// the function that stores them.
+func (a *app) buildDNDPreferences(content *gtk.Box) func() {
+	row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	check, _ := gtk.CheckButtonNewWithMnemonic(tr("_Quiet hours from"))
+	row.PackStart(check, false, false, 0)
+	from, _ := gtk.EntryNew()
+	from.SetWidthChars(6)
+	from.SetPlaceholderText("22:00")
+	row.PackStart(from, false, false, 0)
+	toLabel, _ := gtk.LabelNew(tr("to"))
+	row.PackStart(toLabel, false, false, 0)
+	to, _ := gtk.EntryNew()
+	to.SetWidthChars(6)
+	to.SetPlaceholderText("07:00")
+	row.PackStart(to, false, false, 0)
+	content.PackStart(row, false, false, 0)
+	if q := a.profile().QuietHours; q != nil {
+		check.SetActive(true)
+		from.SetText(q.From)
+		to.SetText(q.To)
+	}
+
+	return func() {
+		if !check.GetActive() {
+			a.updateProfile(func(p *profileConfig) { p.QuietHours = nil })
+			a.refreshDNDIndicator()
+			return
+		}
+		f, _ := from.GetText()
+		t, _ := to.GetText()
+		q := &quietHours{From: f, To: t}
+		if err := q.valid(); err != nil {
+			a.logf("quiet hours not saved: %v", err)
+			return
+		}
+		a.updateProfile(func(p *profileConfig) { p.QuietHours = q })
+		a.refreshDNDIndicator()
+	}
+}
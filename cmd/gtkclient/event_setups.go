@@ -0,0 +1,661 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// eventSetup is a named operating context (movie night, weekly standup)
+// that can be loaded in one go before a recurring event. Nil fields are
+// left alone when the setup is applied.
+type eventSetup struct {
+	// Profile selects the hub to connect to.
+	Profile string `json:"profile,omitempty"`
+	// Volume is the playback slider; PeerVolumes are the levels the hub
+	// stores for each peer, by peer id, on hubs that keep them.
+	Volume            *int           `json:"volume,omitempty"`
+	PeerVolumes       map[string]int `json:"peerVolumes,omitempty"`
+	PlaybackAllPeers  *bool          `json:"playbackAllPeers,omitempty"`
+	ArchiveBroadcasts *bool          `json:"archiveBroadcasts,omitempty"`
+	DirectPeer        *string        `json:"directPeer,omitempty"`
+	// BroadcastZone limits broadcasts to one of the hub's zones; "" is
+	// every peer.
+	BroadcastZone *string `json:"broadcastZone,omitempty"`
+	// Soundboard replaces the profile's hotkey layout.
+	Soundboard map[string]string `json:"soundboard,omitempty"`
+	// DoNotDisturb and QuietHours override the profile's settings; quiet
+	// hours with no times clear them.
+	DoNotDisturb *bool          `json:"doNotDisturb,omitempty"`
+	QuietHours   *quietHours    `json:"quietHours,omitempty"`
+	Cues         []scheduledCue `json:"cues,omitempty"`
+}
+
+// scheduledCue fires an action at a wall-clock time after the setup is
+// applied, e.g. {"at":"19:55","action":"broadcast-play","target":"intro.mp3"}.
+type scheduledCue struct {
+	At     string `json:"at"`
+	Action string `json:"action"`
+	Target string `json:"target"`
+}
+
+// setupChange is one step of applying a setup. Changes marked hub talk to
+// the hub, so they wait until the client is connected to the setup's hub.
+type setupChange struct {
+	desc  string
+	apply func()
+	hub   bool
+}
+
+var cueActions = []string{"broadcast-play", "broadcast", "play"}
+
+func (c scheduledCue) String() string {
+	return fmt.Sprintf("%s %s %s", c.At, c.Action, c.Target)
+}
+
+// parseCues reads one "HH:MM action target" cue per line.
+func parseCues(text string) ([]scheduledCue, error) {
+	var cues []scheduledCue
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("cue line %d: want \"HH:MM action target\"", i+1)
+		}
+		cue := scheduledCue{At: fields[0], Action: fields[1], Target: strings.TrimSpace(fields[2])}
+		if err := cue.validate(); err != nil {
+			return nil, fmt.Errorf("cue line %d: %w", i+1, err)
+		}
+		cues = append(cues, cue)
+	}
+	return cues, nil
+}
+
+func (c scheduledCue) validate() error {
+	if _, err := time.Parse("15:04", c.At); err != nil {
+		return fmt.Errorf("bad time %q", c.At)
+	}
+	for _, action := range cueActions {
+		if c.Action == action {
+			return nil
+		}
+	}
+	return fmt.Errorf("unsupported action %q (want one of %s)", c.Action, strings.Join(cueActions, ", "))
+}
+
+// next returns the next occurrence of the cue's time after now.
+func (c scheduledCue) next(now time.Time) time.Time {
+	t, _ := time.Parse("15:04", c.At)
+	at := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, now.Location())
+	if !at.After(now) {
+		at = at.AddDate(0, 0, 1)
+	}
+	return at
+}
+
+func (a *app) runCue(c scheduledCue) {
+	a.logf("cue %s firing", c)
+	switch c.Action {
+	case "broadcast-play":
+		a.invokeBroadcastPlay(c.Target)
+	case "broadcast":
+		a.invokeBroadcast(c.Target)
+	case "play":
+		a.invokePlay(c.Target)
+	}
+}
+
+// scheduleCues replaces any cues armed by a previously applied setup.
+func (a *app) scheduleCues(cues []scheduledCue) {
+	a.cueMu.Lock()
+	defer a.cueMu.Unlock()
+	for _, t := range a.cueTimers {
+		t.Stop()
+	}
+	a.cueTimers = nil
+	now := time.Now()
+	for _, c := range cues {
+		c := c
+		a.cueTimers = append(a.cueTimers, time.AfterFunc(c.next(now).Sub(now), func() { a.runCue(c) }))
+	}
+}
+
+// captureEventSetup snapshots the current UI state. Must run on the GTK
+// main loop.
+func (a *app) captureEventSetup() *eventSetup {
+	volume := int(a.volumeScale.GetValue())
+	all := a.playbackAllCheck.GetActive()
+	archive := a.archiveCheck.GetActive()
+	peer, _ := a.directPeerEntry.GetText()
+	peer = strings.TrimSpace(peer)
+	zone := a.currentZone()
+	profile := a.profile()
+	soundboard := make(map[string]string, len(profile.Soundboard))
+	for accel, filename := range profile.Soundboard {
+		soundboard[accel] = filename
+	}
+	dnd := profile.DoNotDisturb
+	quiet := &quietHours{}
+	if profile.QuietHours != nil {
+		*quiet = *profile.QuietHours
+	}
+	return &eventSetup{
+		Profile:           a.profileName(),
+		Volume:            &volume,
+		PlaybackAllPeers:  &all,
+		ArchiveBroadcasts: &archive,
+		DirectPeer:        &peer,
+		BroadcastZone:     &zone,
+		Soundboard:        soundboard,
+		DoNotDisturb:      &dnd,
+		QuietHours:        quiet,
+	}
+}
+
+// planEventSetup validates the whole setup and lists what applying it would
+// change, so nothing is touched unless every part can be applied. current
+// holds the hub's peer volumes, nil when they are not known. Must run on the
+// GTK main loop.
+func (a *app) planEventSetup(s *eventSetup, current map[string]int) ([]setupChange, error) {
+	var changes []setupChange
+	// per-profile settings compare against the profile the setup ends on
+	target := a.profile()
+	switching := s.Profile != "" && s.Profile != a.profileName()
+	if switching {
+		profile, ok := a.config.Profiles[s.Profile]
+		if !ok || profile == nil {
+			return nil, fmt.Errorf("unknown profile %q", s.Profile)
+		}
+		ctrl := profile.ControlURL
+		if ctrl == "" {
+			ctrl = hubclient.DefaultControlURL
+		}
+		parsed, err := url.Parse(ctrl)
+		if err != nil {
+			return nil, fmt.Errorf("profile %q: %w", s.Profile, err)
+		}
+		name := s.Profile
+		target = profile
+		changes = append(changes, setupChange{
+			desc:  fmt.Sprintf(tr("Hub: %s (%s) → %s (%s)"), a.profileName(), a.controlURL(), name, parsed),
+			apply: func() { a.switchProfile(name, profile, parsed) },
+		})
+	}
+	if s.PlaybackAllPeers != nil && *s.PlaybackAllPeers != a.playbackAllCheck.GetActive() {
+		all := *s.PlaybackAllPeers
+		changes = append(changes, setupChange{
+			desc:  fmt.Sprintf(tr("Playback target: %s → %s"), playbackTarget(!all), playbackTarget(all)),
+			apply: func() { a.playbackAllCheck.SetActive(all) },
+		})
+	}
+	if s.Volume != nil {
+		level := *s.Volume
+		if level < 0 || level > 100 {
+			return nil, fmt.Errorf("volume out of range: %d", level)
+		}
+		if current := int(a.volumeScale.GetValue()); current != level {
+			changes = append(changes, setupChange{
+				desc:  fmt.Sprintf(tr("Volume: %d%% → %d%%"), current, level),
+				apply: func() { a.volumeScale.SetValue(float64(level)) },
+				hub:   true,
+			})
+		}
+	}
+	peers := make([]string, 0, len(s.PeerVolumes))
+	for peer := range s.PeerVolumes {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	for _, peer := range peers {
+		peer, level := peer, s.PeerVolumes[peer]
+		if level < 0 || level > protocol.MaxPeerVolume {
+			return nil, fmt.Errorf("volume of %s out of range: %d", peer, level)
+		}
+		desc := fmt.Sprintf(tr("Volume of %s: %d%%"), a.auditActor(peer), level)
+		if was, ok := current[peer]; ok {
+			if was == level {
+				continue
+			}
+			desc = fmt.Sprintf(tr("Volume of %s: %d%% → %d%%"), a.auditActor(peer), was, level)
+		}
+		changes = append(changes, setupChange{
+			desc:  desc,
+			apply: func() { go a.setPeerVolume(peer, level) },
+			hub:   true,
+		})
+	}
+	if s.ArchiveBroadcasts != nil && *s.ArchiveBroadcasts != a.archiveCheck.GetActive() {
+		enabled := *s.ArchiveBroadcasts
+		changes = append(changes, setupChange{
+			desc:  fmt.Sprintf(tr("Save broadcast audio locally: %s → %s"), onOffLabel(!enabled), onOffLabel(enabled)),
+			apply: func() { a.archiveCheck.SetActive(enabled) },
+		})
+	}
+	if s.DirectPeer != nil {
+		current, _ := a.directPeerEntry.GetText()
+		if strings.TrimSpace(current) != *s.DirectPeer {
+			peer := *s.DirectPeer
+			changes = append(changes, setupChange{
+				desc:  fmt.Sprintf(tr("Direct peer: %q → %q"), strings.TrimSpace(current), peer),
+				apply: func() { a.directPeerEntry.SetText(peer) },
+			})
+		}
+	}
+	if s.BroadcastZone != nil && (switching || *s.BroadcastZone != a.currentZone()) {
+		zone := *s.BroadcastZone
+		// zones belong to the hub; another profile's are only known once
+		// connected
+		if !switching && zone != "" && a.zones != nil {
+			if _, ok := a.zones[zone]; !ok {
+				return nil, fmt.Errorf("unknown zone %q", zone)
+			}
+		}
+		changes = append(changes, setupChange{
+			desc:  fmt.Sprintf(tr("Broadcast zone: %s → %s"), zoneLabel(a.currentZone()), zoneLabel(zone)),
+			apply: func() { a.selectZone(zone) },
+			hub:   true,
+		})
+	}
+	if s.Soundboard != nil && !sameBindings(s.Soundboard, target.Soundboard) {
+		layout := make(map[string]string, len(s.Soundboard))
+		for accel, filename := range s.Soundboard {
+			if key, mods := gtk.AcceleratorParse(accel); !soundboardUsable(key, mods) {
+				return nil, fmt.Errorf("soundboard: unusable key %q", accel)
+			}
+			layout[accel] = filename
+		}
+		changes = append(changes, setupChange{
+			desc: fmt.Sprintf(tr("Soundboard: %d → %d key(s)"), len(target.Soundboard), len(layout)),
+			apply: func() {
+				a.updateProfile(func(p *profileConfig) { p.Soundboard = layout })
+				a.saveSoundboard()
+			},
+		})
+	}
+	if s.DoNotDisturb != nil && *s.DoNotDisturb != target.DoNotDisturb {
+		on := *s.DoNotDisturb
+		changes = append(changes, setupChange{
+			desc:  fmt.Sprintf(tr("Do not disturb: %s → %s"), onOffLabel(!on), onOffLabel(on)),
+			apply: func() { a.setDoNotDisturb(on) },
+		})
+	}
+	if s.QuietHours != nil {
+		var quiet *quietHours
+		if s.QuietHours.From != "" || s.QuietHours.To != "" {
+			if err := s.QuietHours.valid(); err != nil {
+				return nil, fmt.Errorf("quiet hours: %w", err)
+			}
+			q := *s.QuietHours
+			quiet = &q
+		}
+		if !sameQuietHours(quiet, target.QuietHours) {
+			changes = append(changes, setupChange{
+				desc: fmt.Sprintf(tr("Quiet hours: %s → %s"), quietLabel(target.QuietHours), quietLabel(quiet)),
+				apply: func() {
+					a.updateProfile(func(p *profileConfig) { p.QuietHours = quiet })
+					a.refreshDNDIndicator()
+				},
+			})
+		}
+	}
+	for _, c := range s.Cues {
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
+	}
+	if len(s.Cues) > 0 {
+		cues := s.Cues
+		desc := []string{fmt.Sprintf(tr("Schedule %d cue(s), replacing any pending:"), len(cues))}
+		for _, c := range cues {
+			desc = append(desc, "    "+c.String())
+		}
+		changes = append(changes, setupChange{
+			desc:  strings.Join(desc, "\n"),
+			apply: func() { a.scheduleCues(cues) },
+		})
+	}
+	return changes, nil
+}
+
+func playbackTarget(all bool) string {
+	if all {
+		return tr("all peers")
+	}
+	return tr("this client")
+}
+
+func zoneLabel(zone string) string {
+	if zone == "" {
+		return tr("every peer")
+	}
+	return zone
+}
+
+func quietLabel(q *quietHours) string {
+	if q == nil {
+		return tr("off")
+	}
+	return q.String()
+}
+
+func onOffLabel(on bool) string {
+	if on {
+		return tr("on")
+	}
+	return tr("off")
+}
+
+func sameQuietHours(x, y *quietHours) bool {
+	if x == nil || y == nil {
+		return x == y
+	}
+	return *x == *y
+}
+
+func sameBindings(x, y map[string]string) bool {
+	if len(x) != len(y) {
+		return false
+	}
+	for accel, filename := range x {
+		if other, ok := y[accel]; !ok || other != filename {
+			return false
+		}
+	}
+	return true
+}
+
+// switchProfile points the client at another hub in one step; the caller
+// reconnects once everything else is in place. Must run on the GTK main
+// loop.
+func (a *app) switchProfile(name string, profile *profileConfig, ctrl *url.URL) {
+	a.foldTraffic()
+	a.setActive(name, profile, ctrl)
+	a.setTimeouts(profile.Timeouts)
+	a.setStatusPoll(profile.StatusPollSeconds)
+	a.updateSubtitle()
+	a.applyGlobalHotkeys()
+	a.setChimesMuted(a.chimesMuted())
+	a.setDoNotDisturb(profile.DoNotDisturb)
+	a.setClipboardSync(profile.ClipboardSync)
+	a.applySoundboard()
+	a.restoreGeometry()
+	a.refreshFanOutButton()
+	a.macroValues = nil
+	a.refreshMacroButtons()
+	a.logf("switched to profile %s (%s)", name, ctrl)
+}
+
+func (a *app) loadEventSetup(name string) {
+	s, ok := a.config.EventSetups[name]
+	if !ok || s == nil {
+		a.logf("event setup %q not found", name)
+		return
+	}
+	// peer volumes are only worth comparing on the hub they will be set on
+	if len(s.PeerVolumes) > 0 && (s.Profile == "" || s.Profile == a.profileName()) {
+		go func() {
+			current, err := a.fetchPeerVolumes()
+			if err != nil {
+				a.logf("event setup %s: current peer volumes unknown: %v", name, err)
+			}
+			glib.IdleAdd(func() bool {
+				a.previewEventSetup(name, s, current)
+				return false
+			})
+		}()
+		return
+	}
+	a.previewEventSetup(name, s, nil)
+}
+
+// previewEventSetup shows what loading s changes and applies it once
+// confirmed. Must run on the GTK main loop.
+func (a *app) previewEventSetup(name string, s *eventSetup, current map[string]int) {
+	changes, err := a.planEventSetup(s, current)
+	if err != nil {
+		a.reportError("event setup "+name, err, nil)
+		return
+	}
+	if len(changes) == 0 {
+		a.logf("event setup %s: already in effect", name)
+		return
+	}
+	lines := make([]string, 0, len(changes))
+	for _, c := range changes {
+		lines = append(lines, "• "+c.desc)
+	}
+	confirm := gtk.MessageDialogNew(a.win, gtk.DIALOG_MODAL, gtk.MESSAGE_QUESTION, gtk.BUTTONS_OK_CANCEL,
+		"%s", fmt.Sprintf(tr("Apply event setup %q?"), name))
+	confirm.FormatSecondaryText("%s", strings.Join(lines, "\n"))
+	response := confirm.Run()
+	confirm.Destroy()
+	if response != gtk.RESPONSE_OK {
+		return
+	}
+	a.applyEventSetup(name, changes)
+}
+
+// applyEventSetup makes every local change in one pass of the main loop,
+// so nothing observes a half-applied setup, then reconnects if the hub
+// changed and only afterwards sends what the hub needs to hear. Must run
+// on the GTK main loop.
+func (a *app) applyEventSetup(name string, changes []setupChange) {
+	before := a.controlURL()
+	var hub []setupChange
+	for _, c := range changes {
+		if c.hub {
+			hub = append(hub, c)
+			continue
+		}
+		c.apply()
+	}
+	if err := a.config.save(); err != nil {
+		a.logf("config save error: %v", err)
+	}
+	applyHub := func() {
+		for _, c := range hub {
+			c.apply()
+		}
+		a.logf("event setup %s applied (%d changes)", name, len(changes))
+	}
+	if a.controlURL() == before {
+		applyHub()
+		return
+	}
+	go func() {
+		a.reconnectSocket()
+		glib.IdleAdd(func() bool {
+			applyHub()
+			return false
+		})
+	}()
+}
+
+// saveEventSetup stores the current state under name, once the hub has
+// said what each peer's volume is, then calls saved on the GTK main loop.
+func (a *app) saveEventSetup(name string, cues []scheduledCue, saved func()) {
+	s := a.captureEventSetup()
+	s.Cues = cues
+	go func() {
+		volumes, err := a.fetchPeerVolumes()
+		if err != nil {
+			a.logf("event setup %s: peer volumes not captured: %v", name, err)
+		}
+		glib.IdleAdd(func() bool {
+			if len(volumes) > 0 {
+				s.PeerVolumes = volumes
+			}
+			if a.config.EventSetups == nil {
+				a.config.EventSetups = make(map[string]*eventSetup)
+			}
+			a.config.EventSetups[name] = s
+			if err := a.config.save(); err != nil {
+				a.reportError("save event setup", err, nil)
+				return false
+			}
+			a.logf("event setup %s saved", name)
+			saved()
+			return false
+		})
+	}()
+}
+
+// fetchPeerVolumes reads the volume the hub stores for each peer; it is
+// nil on hubs that keep none.
+func (a *app) fetchPeerVolumes() (map[string]int, error) {
+	client := a.currentSocket()
+	if !client.Supports(protocol.CapPeerConfig) {
+		return nil, nil
+	}
+	configs, err := client.PeerConfigs(a.ctx)
+	if err != nil {
+		return nil, err
+	}
+	volumes := make(map[string]int, len(configs))
+	for _, cfg := range configs {
+		if cfg.Volume != nil {
+			volumes[cfg.Peer] = *cfg.Volume
+		}
+	}
+	return volumes, nil
+}
+
+func (a *app) setPeerVolume(peer string, level int) {
+	if !a.currentSocket().Supports(protocol.CapPeerConfig) {
+		a.logf("peer %s volume not set: this hub does not store peer volumes", peer)
+		return
+	}
+	if _, err := a.currentSocket().SetPeerVolume(a.ctx, peer, level); err != nil {
+		a.reportError("peer volume", err, func() { a.setPeerVolume(peer, level) })
+		return
+	}
+	a.logf("peer %s volume %d%%", peer, level)
+}
+
+func (a *app) eventSetupNames() []string {
+	names := make([]string, 0, len(a.config.EventSetups))
+	for name := range a.config.EventSetups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (a *app) showEventSetups() {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		a.logf("event setups dialog error: %v", err)
+		return
+	}
+	dialog.SetTitle(tr("Event Setups"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetDefaultSize(480, 360)
+	dialog.AddButton(tr("Close"), gtk.RESPONSE_CLOSE)
+	dialog.Connect("response", func() { dialog.Destroy() })
+
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.SetBorderWidth(8)
+
+	pickBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	content.PackStart(pickBox, false, false, 0)
+	combo, _ := gtk.ComboBoxTextNew()
+	setAccessible(combo, tr("Saved setups"), "")
+	pickBox.PackStart(combo, true, true, 0)
+	loadBtn, _ := gtk.ButtonNewWithLabel(tr("Preview & Apply…"))
+	pickBox.PackStart(loadBtn, false, false, 0)
+	deleteBtn, _ := gtk.ButtonNewWithLabel(tr("Delete"))
+	pickBox.PackStart(deleteBtn, false, false, 0)
+
+	cuesLabel, _ := gtk.LabelNew(tr("Scheduled cues (one \"HH:MM action target\" per line; actions: ") + strings.Join(cueActions, ", ") + "):")
+	cuesLabel.SetXAlign(0)
+	cuesLabel.SetLineWrap(true)
+	content.PackStart(cuesLabel, false, false, 0)
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetVExpand(true)
+	content.PackStart(scroll, true, true, 0)
+	cuesView, _ := gtk.TextViewNew()
+	cuesView.SetMonospace(true)
+	scroll.Add(cuesView)
+	cuesBuf, _ := cuesView.GetBuffer()
+	cuesLabel.SetMnemonicWidget(cuesView)
+
+	saveBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	content.PackStart(saveBox, false, false, 0)
+	nameEntry, _ := gtk.EntryNew()
+	nameEntry.SetPlaceholderText(tr("setup name, e.g. movie night"))
+	setAccessible(nameEntry, tr("Setup name"), "")
+	saveBox.PackStart(nameEntry, true, true, 0)
+	saveBtn, _ := gtk.ButtonNewWithLabel(tr("Save Current"))
+	saveBtn.SetTooltipText(tr("Capture the hub, playback target, volume, each peer's volume, zone, soundboard, do not disturb and options in effect now, plus the cues above"))
+	saveBox.PackStart(saveBtn, false, false, 0)
+
+	refresh := func(active string) {
+		combo.RemoveAll()
+		for _, name := range a.eventSetupNames() {
+			combo.Append(name, name)
+		}
+		if active != "" {
+			combo.SetActiveID(active)
+		}
+	}
+	combo.Connect("changed", func() {
+		name := combo.GetActiveID()
+		s := a.config.EventSetups[name]
+		if s == nil {
+			return
+		}
+		nameEntry.SetText(name)
+		lines := make([]string, 0, len(s.Cues))
+		for _, c := range s.Cues {
+			lines = append(lines, c.String())
+		}
+		cuesBuf.SetText(strings.Join(lines, "\n"))
+	})
+	loadBtn.Connect("clicked", func() {
+		if name := combo.GetActiveID(); name != "" {
+			a.loadEventSetup(name)
+		}
+	})
+	deleteBtn.Connect("clicked", func() {
+		name := combo.GetActiveID()
+		if name == "" {
+			return
+		}
+		delete(a.config.EventSetups, name)
+		if err := a.config.save(); err != nil {
+			a.logf("config save error: %v", err)
+		}
+		a.logf("event setup %s deleted", name)
+		refresh("")
+	})
+	saveBtn.Connect("clicked", func() {
+		name, _ := nameEntry.GetText()
+		name = strings.TrimSpace(name)
+		if name == "" {
+			a.logf("event setup: name required")
+			return
+		}
+		text, _ := cuesBuf.GetText(cuesBuf.GetStartIter(), cuesBuf.GetEndIter(), false)
+		cues, err := parseCues(text)
+		if err != nil {
+			a.reportError("save event setup", err, nil)
+			return
+		}
+		a.saveEventSetup(name, cues, func() { refresh(name) })
+	})
+
+	refresh("")
+	dialog.ShowAll()
+}
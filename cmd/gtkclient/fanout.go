@@ -0,0 +1,240 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// fanOutTimeout bounds connecting to, and sending on, each other hub.
+const fanOutTimeout = 10 * time.Second
+
+// fanOutResult is how one hub took a fanned-out broadcast.
+type fanOutResult struct {
+	profile string
+	address string
+	took    time.Duration
+	err     error
+}
+
+// fanOutTargets lists the other profiles the current one also broadcasts
+// to, skipping any that no longer exist.
+func (a *app) fanOutTargets() []string {
+	var out []string
+	for _, name := range a.profile().FanOut {
+		if name != a.profileName() && a.config.Profiles[name] != nil {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// otherProfiles lists every profile but the current one, sorted.
+func (a *app) otherProfiles() []string {
+	var out []string
+	for name, p := range a.config.Profiles {
+		if name != a.profileName() && p != nil {
+			out = append(out, name)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// fanOut sends a broadcast or broadcast-play to this hub and every fan-out
+// target in parallel, then shows how each one went.
+func (a *app) fanOut(action, target string, targets []string) {
+	results := make([]fanOutResult, len(targets)+1)
+	var wg sync.WaitGroup
+	wg.Add(len(results))
+	go func() {
+		defer wg.Done()
+		addr, _ := a.socketAddress()
+		started := time.Now()
+		err := sendBroadcast(a.ctx, a.currentSocket(), action, target)
+		results[0] = fanOutResult{profile: a.profileName(), address: addr, took: time.Since(started), err: err}
+	}()
+	for i, name := range targets {
+		i, name := i, name
+		go func() {
+			defer wg.Done()
+			results[i+1] = a.fanOutTo(name, action, target)
+		}()
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			failed++
+			a.logf("fan-out %s %s to %s (%s): %v", action, target, r.profile, r.address, r.err)
+		} else {
+			a.logf("fan-out %s %s to %s (%s): sent in %v", action, target, r.profile, r.address, r.took.Round(time.Millisecond))
+		}
+	}
+	glib.IdleAdd(func() bool {
+		a.showFanOutResults(action, target, results, failed)
+		return false
+	})
+}
+
+// fanOutTo dials the hub of profile name just for this one broadcast.
+func (a *app) fanOutTo(name, action, target string) fanOutResult {
+	res := fanOutResult{profile: name}
+	started := time.Now()
+	defer func() { res.took = time.Since(started) }()
+	ctx, cancel := context.WithTimeout(a.ctx, fanOutTimeout)
+	defer cancel()
+	client, address, err := a.dialProfile(ctx, name)
+	res.address = address
+	if err != nil {
+		res.err = err
+		return res
+	}
+	defer client.Close()
+	res.err = sendBroadcast(ctx, client, action, target)
+	return res
+}
+
+// dialProfile opens a second socket to the hub of profile name, through
+// its proxy, and waits for the hello. The address is set even on error.
+func (a *app) dialProfile(ctx context.Context, name string) (*hubclient.Client, string, error) {
+	p := a.config.Profiles[name]
+	if p == nil {
+		return nil, "", fmt.Errorf("no profile %q", name)
+	}
+	ctrl := p.ControlURL
+	if ctrl == "" {
+		ctrl = hubclient.DefaultControlURL
+	}
+	control, err := url.Parse(ctrl)
+	if err != nil {
+		return nil, "", err
+	}
+	address, err := hubclient.SocketAddress(control)
+	if err != nil {
+		return nil, "", err
+	}
+	client, err := hubclient.DialProxy(address, profileProxy(p, address), nil)
+	if err != nil {
+		return nil, address, err
+	}
+	if client.WaitHello(ctx) == nil {
+		client.Close()
+		return nil, address, fmt.Errorf("no hello from hub")
+	}
+	return client, address, nil
+}
+
+func sendBroadcast(ctx context.Context, client *hubclient.Client, action, target string) error {
+	ctx = hubclient.WithIdempotencyKey(ctx, hubclient.NewIdempotencyKey())
+	if action == "broadcast-play" {
+		return client.BroadcastPlay(ctx, target)
+	}
+	return client.Broadcast(ctx, target)
+}
+
+// showFanOutResults must run on the GTK main loop.
+func (a *app) showFanOutResults(action, target string, results []fanOutResult, failed int) {
+	kind := gtk.MESSAGE_INFO
+	if failed > 0 {
+		kind = gtk.MESSAGE_WARNING
+	}
+	dialog := gtk.MessageDialogNew(a.win, gtk.DIALOG_DESTROY_WITH_PARENT, kind, gtk.BUTTONS_CLOSE,
+		fmt.Sprintf(tr("%s to %d hubs: %d sent, %d failed"), broadcastWhat(action, target, ""), len(results), len(results)-failed, failed))
+	lines := make([]string, 0, len(results))
+	for _, r := range results {
+		if r.err != nil {
+			lines = append(lines, fmt.Sprintf(tr("✗ %s (%s): %s"), r.profile, r.address, protocol.Friendly(r.err)))
+		} else {
+			lines = append(lines, fmt.Sprintf(tr("✓ %s (%s): sent in %v"), r.profile, r.address, r.took.Round(time.Millisecond)))
+		}
+	}
+	dialog.FormatSecondaryText("%s", strings.Join(lines, "\n"))
+	dialog.Connect("response", func() { dialog.Destroy() })
+	dialog.Show()
+}
+
+// buildFanOutButton adds the "also send to" hub picker to the broadcast
+// row. It lists the other profiles each time it opens.
+func (a *app) buildFanOutButton(box *gtk.Box) {
+	btn, _ := gtk.MenuButtonNew()
+	btn.SetLabel(tr("Hubs"))
+	btn.SetTooltipText(tr("Also send broadcasts to the hubs of other profiles"))
+	popover, _ := gtk.PopoverNew(btn)
+	btn.SetPopover(popover)
+	var list *gtk.Box
+	btn.Connect("toggled", func() {
+		if !btn.GetActive() {
+			return
+		}
+		if list != nil {
+			popover.Remove(list)
+		}
+		list, _ = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+		list.SetBorderWidth(6)
+		others := a.otherProfiles()
+		if len(others) == 0 {
+			none, _ := gtk.LabelNew(tr("No other profiles are configured"))
+			list.PackStart(none, false, false, 0)
+		}
+		selected := make(map[string]bool)
+		for _, name := range a.fanOutTargets() {
+			selected[name] = true
+		}
+		for _, name := range others {
+			name := name
+			check, _ := gtk.CheckButtonNewWithLabel(name)
+			check.SetActive(selected[name])
+			check.Connect("toggled", func() { a.setFanOut(name, check.GetActive()) })
+			list.PackStart(check, false, false, 0)
+		}
+		popover.Add(list)
+		list.ShowAll()
+	})
+	box.PackEnd(btn, false, false, 0)
+	a.fanOutButton = btn
+	a.refreshFanOutButton()
+}
+
+// setFanOut adds or removes profile name from the fan-out targets. Must
+// run on the GTK main loop.
+func (a *app) setFanOut(name string, on bool) {
+	targets := a.fanOutTargets()
+	kept := targets[:0]
+	for _, t := range targets {
+		if t != name {
+			kept = append(kept, t)
+		}
+	}
+	if on {
+		kept = append(kept, name)
+	}
+	a.updateProfile(func(p *profileConfig) { p.FanOut = kept })
+	if err := a.config.save(); err != nil {
+		a.reportError("save fan-out", err, nil)
+	}
+	a.refreshFanOutButton()
+}
+
+// refreshFanOutButton must run on the GTK main loop.
+func (a *app) refreshFanOutButton() {
+	if a.fanOutButton == nil {
+		return
+	}
+	if n := len(a.fanOutTargets()); n > 0 {
+		a.fanOutButton.SetLabel(fmt.Sprintf(tr("Hubs (+%d)"), n))
+	} else {
+		a.fanOutButton.SetLabel(tr("Hubs"))
+	}
+}
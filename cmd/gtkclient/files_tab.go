@@ -0,0 +1,459 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// Columns of the Files tab store. The raw size and time back the sort
+// order of the columns that show them formatted.
+const (
+	fileColName = iota
+	fileColType
+	fileColSize
+	fileColSizeRaw
+	fileColModified
+	fileColModifiedRaw
+)
+
+// filesView is the "Files" tab listing everything the hub stores. All
+// fields are owned by the GTK main loop.
+type filesView struct {
+	page      gtk.IWidget
+	store     *gtk.ListStore
+	selection *gtk.TreeSelection
+	summary   *gtk.Label
+	deleteBtn *gtk.Button
+	moveBtn   *gtk.Button
+	trashBtn  *gtk.Button
+	preview   *filePreview
+	usage     *gtk.ProgressBar
+	copyBox   *gtk.Box
+	copyBar   *gtk.ProgressBar
+}
+
+func (a *app) buildFilesTab() gtk.IWidget {
+	v := &filesView{}
+	a.filesView = v
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+	v.page = box
+
+	bar, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	box.PackStart(bar, false, false, 0)
+	refreshBtn, _ := gtk.ButtonNewWithLabel(tr("Refresh"))
+	setAccessible(refreshBtn, tr("Refresh hub files"), "")
+	refreshBtn.Connect("clicked", func() { go a.fetchFiles() })
+	bar.PackStart(refreshBtn, false, false, 0)
+	uploadBtn, _ := gtk.ButtonNewWithLabel(tr("Upload…"))
+	uploadBtn.SetTooltipText(tr("Upload any file to the hub"))
+	uploadBtn.Connect("clicked", func() { a.uploadAnyFile() })
+	bar.PackStart(uploadBtn, false, false, 0)
+	downloadBtn, _ := gtk.ButtonNewWithLabel(tr("Download"))
+	downloadBtn.SetTooltipText(tr("Download the selected file, or several as one zip"))
+	downloadBtn.Connect("clicked", func() { a.downloadHubFiles(v.selectedNames()) })
+	bar.PackStart(downloadBtn, false, false, 0)
+	v.deleteBtn, _ = gtk.ButtonNewWithLabel(tr("Delete"))
+	v.deleteBtn.Connect("clicked", func() { a.confirmDeleteHubFiles(v.selectedNames()) })
+	bar.PackStart(v.deleteBtn, false, false, 0)
+	v.moveBtn, _ = gtk.ButtonNewWithLabel(tr("Move…"))
+	v.moveBtn.Connect("clicked", func() { a.promptMoveHubFiles(v.selectedNames()) })
+	bar.PackStart(v.moveBtn, false, false, 0)
+	v.trashBtn, _ = gtk.ButtonNewWithLabel(tr("Trash…"))
+	v.trashBtn.Connect("clicked", func() { a.showTrash() })
+	bar.PackStart(v.trashBtn, false, false, 0)
+	v.summary, _ = gtk.LabelNew("")
+	bar.PackEnd(v.summary, false, false, 0)
+	v.usage, _ = gtk.ProgressBarNew()
+	v.usage.SetShowText(true)
+	v.usage.SetNoShowAll(true)
+	setAccessible(v.usage, tr("Hub storage use"), "")
+	box.PackStart(v.usage, false, false, 0)
+	a.buildCopyButton(bar, box, v)
+
+	paned, _ := gtk.PanedNew(gtk.ORIENTATION_HORIZONTAL)
+	paned.SetVExpand(true)
+	box.PackStart(paned, true, true, 0)
+	a.trackPane("files", paned)
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	paned.Pack1(scroll, true, false)
+	v.preview = newFilePreview()
+	paned.Pack2(v.preview.stack, false, true)
+	v.store, _ = gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_INT64, glib.TYPE_STRING, glib.TYPE_INT64)
+	view, _ := gtk.TreeViewNewWithModel(v.store)
+	view.SetSearchColumn(fileColName)
+	setAccessible(view, tr("Hub files"), tr("Activate a file to download it; Ctrl and Shift select several"))
+	for _, col := range []struct {
+		title       string
+		shown, sort int
+		expand      bool
+	}{
+		{tr("Name"), fileColName, fileColName, true},
+		{tr("Type"), fileColType, fileColType, false},
+		{tr("Size"), fileColSize, fileColSizeRaw, false},
+		{tr("Modified"), fileColModified, fileColModifiedRaw, false},
+	} {
+		renderer, _ := gtk.CellRendererTextNew()
+		column, err := gtk.TreeViewColumnNewWithAttribute(col.title, renderer, "text", col.shown)
+		if err != nil {
+			continue
+		}
+		column.SetResizable(true)
+		column.SetExpand(col.expand)
+		column.SetSortColumnID(col.sort)
+		view.AppendColumn(column)
+	}
+	view.Connect("row-activated", func() {
+		if name := v.selected(); name != "" {
+			go a.downloadHubFileLogged(name)
+		}
+	})
+	v.selection, _ = view.GetSelection()
+	v.selection.SetMode(gtk.SELECTION_MULTIPLE)
+	v.selection.Connect("changed", func() {
+		name, kind, size := v.selectedRow()
+		a.previewHubFile(name, kind, size)
+	})
+	scroll.Add(view)
+	a.setFilesDeletable(a.currentSocket().Supports(protocol.CapDelete) && a.currentSocket().Allows("delete"))
+	a.setFilesMovable(a.currentSocket().Supports(protocol.CapMove) && a.currentSocket().Allows("move"))
+	a.setTrashAvailable(a.currentSocket().Supports(protocol.CapTrash))
+	return box
+}
+
+// selected is the name of the highlighted file, or "" unless exactly one
+// is selected.
+func (v *filesView) selected() string {
+	name, _, _ := v.selectedRow()
+	return name
+}
+
+// selectedNames lists the selected files in the order shown.
+func (v *filesView) selectedNames() []string {
+	if v == nil || v.selection == nil {
+		return nil
+	}
+	var names []string
+	v.selection.SelectedForEach(func(_ *gtk.TreeModel, _ *gtk.TreePath, iter *gtk.TreeIter) {
+		if value, err := v.store.GetValue(iter, fileColName); err == nil {
+			if name, _ := value.GetString(); name != "" {
+				names = append(names, name)
+			}
+		}
+	})
+	return names
+}
+
+// selectedRow is the name, content type and size of the highlighted file
+// when exactly one is selected.
+func (v *filesView) selectedRow() (string, string, int64) {
+	if v == nil || v.selection == nil || v.selection.CountSelectedRows() != 1 {
+		return "", "", 0
+	}
+	var iter *gtk.TreeIter
+	v.selection.SelectedForEach(func(_ *gtk.TreeModel, _ *gtk.TreePath, it *gtk.TreeIter) {
+		iter = it
+	})
+	if iter == nil {
+		return "", "", 0
+	}
+	var name, kind string
+	var size int64
+	if value, err := v.store.GetValue(iter, fileColName); err == nil {
+		name, _ = value.GetString()
+	}
+	if value, err := v.store.GetValue(iter, fileColType); err == nil {
+		kind, _ = value.GetString()
+	}
+	if value, err := v.store.GetValue(iter, fileColSizeRaw); err == nil {
+		if goValue, err := value.GoValue(); err == nil {
+			size, _ = goValue.(int64)
+		}
+	}
+	return name, kind, size
+}
+
+func (v *filesView) show(files []hubclient.HubFile) {
+	v.store.Clear()
+	var total int64
+	for _, f := range files {
+		total += f.Size
+		size, modified := "", ""
+		if f.Size > 0 {
+			size = formatBytes(f.Size)
+		}
+		var modifiedRaw int64
+		if !f.Modified.IsZero() {
+			modified = f.Modified.Local().Format("2006-01-02 15:04")
+			modifiedRaw = f.Modified.Unix()
+		}
+		kind := f.ContentType
+		if kind == "" {
+			kind = hubclient.ContentType(f.Name)
+		}
+		v.store.Set(v.store.Append(),
+			[]int{fileColName, fileColType, fileColSize, fileColSizeRaw, fileColModified, fileColModifiedRaw},
+			[]interface{}{f.Name, kind, size, f.Size, modified, modifiedRaw})
+	}
+	v.summary.SetText(fmt.Sprintf(tr("%d file(s), %s"), len(files), formatBytes(total)))
+}
+
+// showUsage fills the storage bar; without a quota it only states the
+// total.
+func (v *filesView) showUsage(u *hubclient.StorageUsage) {
+	if u.Quota <= 0 {
+		v.usage.SetFraction(0)
+		v.usage.SetText(fmt.Sprintf(tr("%s stored, no quota"), formatBytes(u.Total)))
+	} else {
+		v.usage.SetFraction(min(float64(u.Used)/float64(u.Quota), 1))
+		v.usage.SetText(fmt.Sprintf(tr("%s of %s used (%s free)"), formatBytes(u.Used), formatBytes(u.Quota), formatBytes(u.Free())))
+	}
+	v.usage.Show()
+}
+
+// fetchStorage updates the Files tab's storage bar from the hub.
+func (a *app) fetchStorage() {
+	if !a.currentSocket().Supports(protocol.CapStorage) {
+		return
+	}
+	usage, err := a.currentSocket().Storage(a.ctx)
+	if err != nil {
+		a.reportError("storage", err, nil)
+		return
+	}
+	glib.IdleAdd(func() bool {
+		if a.filesView != nil {
+			a.filesView.showUsage(usage)
+		}
+		return false
+	})
+}
+
+// confirmQuota asks before an upload of size bytes as name that the hub's
+// last reported use says would go over its quota. The hub refuses such
+// uploads itself; asking first saves sending them.
+func (a *app) confirmQuota(ctx context.Context, name string, size int64) bool {
+	if !a.currentSocket().Supports(protocol.CapStorage) {
+		return true
+	}
+	usage, err := a.currentSocket().Storage(ctx)
+	if err != nil {
+		a.logf("storage check skipped: %v", err)
+		return true
+	}
+	if usage.Quota <= 0 {
+		return true
+	}
+	answer := make(chan bool, 1)
+	glib.IdleAdd(func() bool {
+		if a.filesView != nil {
+			a.filesView.showUsage(usage)
+		}
+		// replacing a file frees its space first
+		var replaced int64
+		for _, f := range a.audioFiles {
+			if f.Name == name && f.Size != nil {
+				replaced = *f.Size
+			}
+		}
+		after := usage.Used - replaced + size
+		if after <= usage.Quota {
+			answer <- true
+			return false
+		}
+		dialog := gtk.MessageDialogNew(a.win, gtk.DIALOG_MODAL, gtk.MESSAGE_WARNING, gtk.BUTTONS_NONE,
+			"%s", fmt.Sprintf(tr("%s would go over the hub's storage quota"), name))
+		dialog.FormatSecondaryText("%s", fmt.Sprintf(tr("The hub has %s of %s free and this upload needs %s. It will probably refuse the upload."),
+			formatBytes(usage.Free()), formatBytes(usage.Quota), formatBytes(size)))
+		dialog.AddButton(tr("Cancel"), gtk.RESPONSE_CANCEL)
+		dialog.AddButton(tr("Upload Anyway"), gtk.RESPONSE_ACCEPT)
+		dialog.SetDefaultResponse(gtk.RESPONSE_CANCEL)
+		response := dialog.Run()
+		dialog.Destroy()
+		answer <- response == gtk.RESPONSE_ACCEPT
+		return false
+	})
+	select {
+	case ok := <-answer:
+		return ok
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// setFilesDeletable offers Delete only to hubs that support it.
+func (a *app) setFilesDeletable(ok bool) {
+	tooltip := tr("Delete the selected files from the hub")
+	if !ok {
+		tooltip = tr("This hub does not support deleting files")
+	}
+	var buttons []*gtk.Button
+	if a.filesView != nil {
+		buttons = append(buttons, a.filesView.deleteBtn)
+	}
+	if a.audioBulk != nil {
+		buttons = append(buttons, a.audioBulk.deleteBtn)
+	}
+	for _, btn := range buttons {
+		btn.SetSensitive(ok)
+		btn.SetTooltipText(tooltip)
+	}
+}
+
+// setFilesMovable offers Move only to hubs that support it and roles that
+// allow it.
+func (a *app) setFilesMovable(ok bool) {
+	tooltip := tr("Move the selected files into another folder on the hub")
+	if !ok {
+		tooltip = tr("This hub does not let you move files")
+	}
+	var buttons []*gtk.Button
+	if a.filesView != nil {
+		buttons = append(buttons, a.filesView.moveBtn)
+	}
+	if a.audioBulk != nil {
+		buttons = append(buttons, a.audioBulk.moveBtn)
+	}
+	for _, btn := range buttons {
+		btn.SetSensitive(ok)
+		btn.SetTooltipText(tooltip)
+	}
+}
+
+// showFilesTab brings the Files tab forward and reloads it.
+func (a *app) showFilesTab() {
+	if a.filesView != nil {
+		if page := a.notebook.PageNum(a.filesView.page); page >= 0 {
+			a.notebook.SetCurrentPage(page)
+		}
+	}
+	go a.fetchFiles()
+}
+
+// uploadAnyFile picks a file and uploads it as it is, with no transcoding.
+func (a *app) uploadAnyFile() {
+	dialog, err := gtk.FileChooserDialogNewWith2Buttons(
+		tr("Select file to upload"),
+		a.win,
+		gtk.FILE_CHOOSER_ACTION_OPEN,
+		tr("Cancel"), gtk.RESPONSE_CANCEL,
+		tr("Upload"), gtk.RESPONSE_ACCEPT,
+	)
+	if err != nil {
+		a.logf("upload dialog error: %v", err)
+		return
+	}
+	response := dialog.Run()
+	path := dialog.GetFilename()
+	dialog.Destroy()
+	if response != gtk.RESPONSE_ACCEPT || path == "" {
+		return
+	}
+	opts := uploadOptions{}
+	if a.uploadFolderEntry != nil {
+		opts.Folder, _ = a.uploadFolderEntry.GetText()
+	}
+	go func() {
+		a.runUpload(path, filepath.Base(path), opts)
+		a.fetchFiles()
+	}()
+}
+
+func (a *app) downloadHubFileLogged(name string) {
+	path, size, err := a.downloadHubFile(name)
+	if err != nil {
+		a.reportError("download", err, func() { a.downloadHubFileLogged(name) })
+		return
+	}
+	a.logf("downloaded %s to %s (%s)", name, path, formatBytes(size))
+}
+
+// confirmDeleteHubFile deletes name, asking first unless the hub keeps a
+// trash to undo it from.
+func (a *app) confirmDeleteHubFile(name string) {
+	if !a.currentSocket().Supports(protocol.CapTrash) && !a.confirmDelete(fmt.Sprintf(tr("Delete %s from the hub?"), name)) {
+		return
+	}
+	go a.deleteHubFile(name)
+}
+
+// confirmDelete asks the question and reports whether the user agreed.
+func (a *app) confirmDelete(question string) bool {
+	dialog := gtk.MessageDialogNew(a.win, gtk.DIALOG_MODAL, gtk.MESSAGE_QUESTION, gtk.BUTTONS_NONE,
+		"%s", question)
+	dialog.FormatSecondaryText(tr("Every client loses access to it. This cannot be undone."))
+	dialog.AddButton(tr("Cancel"), gtk.RESPONSE_CANCEL)
+	dialog.AddButton(tr("Delete"), gtk.RESPONSE_ACCEPT)
+	dialog.SetDefaultResponse(gtk.RESPONSE_CANCEL)
+	response := dialog.Run()
+	dialog.Destroy()
+	return response == gtk.RESPONSE_ACCEPT
+}
+
+func (a *app) deleteHubFile(name string) {
+	client := a.currentSocket()
+	if err := client.Delete(a.ctx, name); err != nil {
+		a.reportError("delete", err, func() { a.deleteHubFile(name) })
+		return
+	}
+	trashed := client.Supports(protocol.CapTrash)
+	if trashed {
+		a.logf("moved %s to the hub's trash", name)
+	} else {
+		a.logf("deleted %s from the hub", name)
+	}
+	glib.IdleAdd(func() bool {
+		kept := a.forgetHubFiles([]string{name})
+		if trashed {
+			a.showUndoToast(fmt.Sprintf(tr("Moved %s to the trash"), name), func() {
+				go a.restoreHubFiles([]string{name}, kept)
+			})
+		}
+		return false
+	})
+	a.fetchFiles()
+	a.fetchStatus()
+}
+
+// forgetHubFiles drops the hotkeys and local tags of deleted files, which
+// would otherwise outlive them, and returns them for an undo. Must run on
+// the GTK main loop.
+func (a *app) forgetHubFiles(names []string) localFileState {
+	kept := localFileState{keys: make(map[string]string), tags: make(map[string][]string)}
+	bound, tagged := false, false
+	a.updateProfile(func(p *profileConfig) {
+		for _, name := range names {
+			for accel, f := range p.Soundboard {
+				if f == name {
+					kept.keys[accel] = f
+					delete(p.Soundboard, accel)
+					bound = true
+				}
+			}
+			if tags, ok := p.FileTags[name]; ok {
+				kept.tags[name] = tags
+				delete(p.FileTags, name)
+				tagged = true
+			}
+		}
+	})
+	if a.currentSocket().Supports(protocol.CapTrash) {
+		a.trashKept.add(kept)
+	}
+	if bound {
+		// saves the config as well
+		a.saveSoundboard()
+	} else if tagged {
+		if err := a.config.save(); err != nil {
+			a.logf("config save error: %v", err)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+// chunkSizeFor picks an upload chunk that takes roughly half a second on
+// the wire at the given limit, so a control request never waits long
+// behind the message being written. raw is set when chunks go out in
+// binary frames rather than as base64.
+func chunkSizeFor(bytesPerSec int64, raw bool) int {
+	if bytesPerSec <= 0 {
+		return uploadChunkSize
+	}
+	size := int(bytesPerSec / 2)
+	if !raw {
+		// base64 grows the payload by 4/3
+		size = size * 3 / 4
+	}
+	if size < 16<<10 {
+		size = 16 << 10
+	}
+	if size > uploadChunkSize {
+		size = uploadChunkSize
+	}
+	return size
+}
+
+// uploadLimit honours CLIENT_UPLOAD_LIMIT, then the profile setting, in
+// bytes per second.
+func (a *app) uploadLimit() int64 {
+	if v := os.Getenv("CLIENT_UPLOAD_LIMIT"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n
+		}
+		a.logf("invalid CLIENT_UPLOAD_LIMIT %q ignored", v)
+	}
+	return a.uploadRate.Load()
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"brain/internal/audiolist"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// Remote files have no real folders: a name like "sfx/doors/creak.mp3" is
+// shown as creak.mp3 inside sfx/doors.
+
+// folderGroup is a subfolder of the one being browsed with every file
+// beneath it.
+type folderGroup struct {
+	name  string // last segment
+	path  string // full prefix
+	files []audioFile
+}
+
+// splitFolder divides the files under folder into those directly in it
+// and groups for its immediate subfolders, sorted by name. Order within
+// each is kept.
+func splitFolder(files []audioFile, folder string) ([]audioFile, []folderGroup) {
+	prefix := ""
+	if folder != "" {
+		prefix = folder + "/"
+	}
+	var direct []audioFile
+	groups := make(map[string]*folderGroup)
+	for _, f := range files {
+		if !strings.HasPrefix(f.Name, prefix) {
+			continue
+		}
+		rest := f.Name[len(prefix):]
+		i := strings.Index(rest, "/")
+		if i <= 0 {
+			direct = append(direct, f)
+			continue
+		}
+		name := rest[:i]
+		g, ok := groups[name]
+		if !ok {
+			g = &folderGroup{name: name, path: prefix + name}
+			groups[name] = g
+		}
+		g.files = append(g.files, f)
+	}
+	out := make([]folderGroup, 0, len(groups))
+	for _, g := range groups {
+		out = append(out, *g)
+	}
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i].name) < strings.ToLower(out[j].name) })
+	return direct, out
+}
+
+// folderBase is the last segment of a remote file name.
+func folderBase(name string) string {
+	return name[strings.LastIndex(name, "/")+1:]
+}
+
+// inFolder places the remote name under folder.
+func inFolder(folder, name string) string {
+	if folder = audiolist.CleanFolder(folder); folder == "" {
+		return name
+	}
+	return folder + "/" + name
+}
+
+// browseFolder shows folder in the audio view, and makes it where uploads
+// go.
+func (a *app) browseFolder(folder string) {
+	a.audioFolder = audiolist.CleanFolder(folder)
+	if a.uploadFolderEntry != nil {
+		a.uploadFolderEntry.SetText(a.audioFolder)
+	}
+	if a.audioFiles != nil {
+		a.refreshAudioButtons(a.audioFiles, "")
+	} else {
+		a.updateBreadcrumb()
+	}
+}
+
+// updateBreadcrumb shows one button per segment of the current folder.
+func (a *app) updateBreadcrumb() {
+	if a.breadcrumb == nil {
+		return
+	}
+	if children := a.breadcrumb.GetChildren(); children != nil {
+		children.Foreach(func(item interface{}) {
+			if w, ok := item.(*gtk.Widget); ok {
+				w.Destroy()
+			}
+		})
+	}
+	add := func(label, target string, current bool) {
+		btn, err := gtk.ButtonNewWithLabel(label)
+		if err != nil {
+			return
+		}
+		btn.SetRelief(gtk.RELIEF_NONE)
+		btn.SetSensitive(!current)
+		btn.Connect("clicked", func() { a.browseFolder(target) })
+		a.breadcrumb.PackStart(btn, false, false, 0)
+	}
+	add(tr("All files"), "", a.audioFolder == "")
+	if a.audioFolder != "" {
+		parts := strings.Split(a.audioFolder, "/")
+		for i, part := range parts {
+			sep, _ := gtk.LabelNew("/")
+			a.breadcrumb.PackStart(sep, false, false, 0)
+			add(part, strings.Join(parts[:i+1], "/"), i == len(parts)-1)
+		}
+	}
+	a.breadcrumb.ShowAll()
+}
+
+// addFolderGroup adds an expander listing every file under g, with a
+// button to browse into it.
+func (a *app) addFolderGroup(g folderGroup) {
+	exp, err := gtk.ExpanderNew(fmt.Sprintf(tr("📁 %s (%d)"), g.name, len(g.files)))
+	if err != nil {
+		a.logf("folder group error: %v", err)
+		return
+	}
+	exp.SetExpanded(a.openFolders[g.path])
+	path := g.path
+	exp.Connect("notify::expanded", func() {
+		if a.openFolders == nil {
+			a.openFolders = make(map[string]bool)
+		}
+		a.openFolders[path] = exp.GetExpanded()
+	})
+	content, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+	content.SetMarginStart(12)
+	openBtn, _ := gtk.ButtonNewWithLabel(fmt.Sprintf(tr("Open %s"), g.name))
+	openBtn.SetHAlign(gtk.ALIGN_START)
+	openBtn.Connect("clicked", func() { a.browseFolder(path) })
+	content.PackStart(openBtn, false, false, 0)
+	flow, _ := gtk.FlowBoxNew()
+	flow.SetColumnSpacing(6)
+	flow.SetRowSpacing(6)
+	flow.SetMaxChildrenPerLine(3)
+	flow.SetSelectionMode(gtk.SELECTION_NONE)
+	flow.SetHomogeneous(false)
+	setAccessible(flow, fmt.Sprintf(tr("Audio files in %s"), g.path), "")
+	for _, f := range g.files {
+		// files deeper down keep the part of their path below this folder
+		if item := a.newAudioItem(f, strings.TrimPrefix(f.Name, g.path+"/")); item != nil {
+			flow.Add(item)
+		}
+	}
+	content.PackStart(flow, false, false, 0)
+	exp.Add(content)
+	a.audioFolderBox.PackStart(exp, false, false, 0)
+	exp.ShowAll()
+	a.audioFolderGroups = append(a.audioFolderGroups, exp)
+}
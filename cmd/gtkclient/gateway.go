@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"brain/internal/gateway"
+)
+
+// gatewayAddress honours CLIENT_GATEWAY_ADDR, then the profile setting.
+// Empty means the gateway is off.
+func (a *app) gatewayAddress() string {
+	if v := os.Getenv("CLIENT_GATEWAY_ADDR"); v != "" {
+		return v
+	}
+	if a.profile() != nil {
+		return a.profile().GatewayListen
+	}
+	return ""
+}
+
+// serveGateway exposes the REST gateway over this client's socket until
+// the app closes.
+func (a *app) serveGateway() {
+	addr := a.gatewayAddress()
+	if addr == "" {
+		return
+	}
+	token := ""
+	if a.profile() != nil {
+		token = a.profile().GatewayToken
+	}
+	handler := gateway.New(gateway.Config{
+		Client: a.currentSocket,
+		Token:  token,
+		Logf:   a.logf,
+	})
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		a.logf("REST gateway disabled: %v", err)
+		return
+	}
+	srv := &http.Server{Handler: handler, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-a.ctx.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	}()
+	if token == "" {
+		a.logf("REST gateway: http://%s (no token; anyone who can reach it can play and broadcast)", ln.Addr())
+	} else {
+		a.logf("REST gateway: http://%s", ln.Addr())
+	}
+	go func() {
+		if err := srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			a.logf("REST gateway stopped: %v", err)
+		}
+	}()
+}
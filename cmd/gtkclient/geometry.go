@@ -0,0 +1,100 @@
+package main
+
+import (
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// windowGeometry is where the main window was for a profile. Wayland does
+// not report or honor positions, so X and Y stay zero there and only the
+// size and maximized state come back.
+type windowGeometry struct {
+	X         int  `json:"x,omitempty"`
+	Y         int  `json:"y,omitempty"`
+	Width     int  `json:"width,omitempty"`
+	Height    int  `json:"height,omitempty"`
+	Maximized bool `json:"maximized,omitempty"`
+	// Panes are divider positions by pane name.
+	Panes map[string]int `json:"panes,omitempty"`
+}
+
+// updateGeometry applies change to the window geometry of a new copy of
+// the profile. Must run on the GTK main loop.
+func (a *app) updateGeometry(change func(g *windowGeometry)) {
+	a.updateProfile(func(p *profileConfig) {
+		if p.Window == nil {
+			p.Window = &windowGeometry{}
+		}
+		change(p.Window)
+	})
+}
+
+// trackWindow follows the main window's size, position and maximized state
+// into the profile; they are saved at exit. Must run on the GTK main loop.
+func (a *app) trackWindow(win *gtk.Window) {
+	win.Connect("configure-event", func() bool {
+		if a.restoringGeometry {
+			return false
+		}
+		a.updateGeometry(func(g *windowGeometry) {
+			g.Maximized = win.IsMaximized()
+			if !g.Maximized {
+				g.X, g.Y = win.GetPosition()
+				g.Width, g.Height = win.GetSize()
+			}
+		})
+		return false
+	})
+	win.Connect("window-state-event", func() bool {
+		if !a.restoringGeometry {
+			a.updateGeometry(func(g *windowGeometry) { g.Maximized = win.IsMaximized() })
+		}
+		return false
+	})
+}
+
+// trackPane remembers paned's divider under name.
+func (a *app) trackPane(name string, paned *gtk.Paned) {
+	if a.panes == nil {
+		a.panes = make(map[string]*gtk.Paned)
+	}
+	a.panes[name] = paned
+	paned.Connect("notify::position", func() {
+		if a.restoringGeometry {
+			return
+		}
+		a.updateGeometry(func(g *windowGeometry) {
+			if g.Panes == nil {
+				g.Panes = make(map[string]int)
+			}
+			g.Panes[name] = paned.GetPosition()
+		})
+	})
+}
+
+// restoreGeometry puts the main window and its panes where the current
+// profile left them. Must run on the GTK main loop.
+func (a *app) restoreGeometry() {
+	g := a.profile().Window
+	if g == nil || a.win == nil {
+		return
+	}
+	a.restoringGeometry = true
+	defer func() { a.restoringGeometry = false }()
+	if g.Width > 0 && g.Height > 0 {
+		a.win.SetDefaultSize(g.Width, g.Height)
+		a.win.Resize(g.Width, g.Height)
+	}
+	if g.X != 0 || g.Y != 0 {
+		a.win.Move(g.X, g.Y)
+	}
+	if g.Maximized {
+		a.win.Maximize()
+	} else if a.win.IsMaximized() {
+		a.win.Unmaximize()
+	}
+	for name, pos := range g.Panes {
+		if paned := a.panes[name]; paned != nil && pos > 0 {
+			paned.SetPosition(pos)
+		}
+	}
+}
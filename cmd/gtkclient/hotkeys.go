@@ -0,0 +1,228 @@
+package main
+
+// #include <stdlib.h>
+// #include <gtk/gtk.h>
+//
+// extern GDBusConnection *brain_dbus_app_connection(gpointer app);
+// extern int brain_hotkeys_x11(void);
+// extern int brain_hotkey_grab(guint keyval, GdkModifierType mods);
+// extern void brain_hotkey_ungrab_all(void);
+// extern void brain_portal_start(GDBusConnection *conn, char **ids, char **descriptions, char **triggers, int n);
+// extern void brain_portal_stop(GDBusConnection *conn);
+import "C"
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unsafe"
+
+	"brain/internal/script"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// hotkeyTimeout bounds a hotkey's script, retries and sleeps included.
+const hotkeyTimeout = time.Minute
+
+// hotkeyApp receives key presses from C; cgo callbacks cannot carry Go
+// pointers.
+var hotkeyApp *app
+
+// globalHotkey is one binding from the profile's GlobalHotkeys.
+type globalHotkey struct {
+	accel string
+	// command is a palette action name such as "palette" or
+	// "play:doorbell.mp3", or a script line such as
+	// "broadcast-play doorbell.mp3".
+	command string
+	steps   []script.Step
+}
+
+// parseGlobalHotkeys checks the profile's bindings, skipping any whose
+// accelerator or command does not parse. The result is sorted by
+// accelerator so indexes are stable.
+func parseGlobalHotkeys(bindings map[string]string) ([]globalHotkey, []error) {
+	var keys []globalHotkey
+	var errs []error
+	for accel, command := range bindings {
+		command = strings.TrimSpace(command)
+		if key, _ := gtk.AcceleratorParse(accel); key == 0 {
+			errs = append(errs, fmt.Errorf("%q is not a valid accelerator", accel))
+			continue
+		}
+		if command == "" {
+			errs = append(errs, fmt.Errorf("%s has no command", accel))
+			continue
+		}
+		hk := globalHotkey{accel: accel, command: command}
+		steps, err := script.Parse(strings.NewReader(command))
+		if err != nil && strings.Contains(command, " ") {
+			errs = append(errs, fmt.Errorf("%s: %w", accel, err))
+			continue
+		}
+		hk.steps = steps
+		keys = append(keys, hk)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].accel < keys[j].accel })
+	return keys, errs
+}
+
+// portalTrigger writes accel in the shortcut format the GlobalShortcuts
+// portal expects, e.g. "<Control><Alt>d" as "CTRL+ALT+d".
+func portalTrigger(accel string) string {
+	key, mods := gtk.AcceleratorParse(accel)
+	var parts []string
+	for _, m := range []struct {
+		mask gdk.ModifierType
+		name string
+	}{
+		{gdk.CONTROL_MASK, "CTRL"},
+		{gdk.MOD1_MASK, "ALT"},
+		{gdk.SHIFT_MASK, "SHIFT"},
+		{gdk.SUPER_MASK, "LOGO"},
+	} {
+		if mods&m.mask != 0 {
+			parts = append(parts, m.name)
+		}
+	}
+	name := C.gdk_keyval_name(C.guint(key))
+	if name == nil {
+		return strings.Join(append(parts, strconv.Itoa(int(key))), "+")
+	}
+	return strings.Join(append(parts, C.GoString(name)), "+")
+}
+
+// applyGlobalHotkeys grabs the profile's hotkeys, replacing any grabbed
+// before: on X11 directly, elsewhere through the desktop's GlobalShortcuts
+// portal, which may ask the user to confirm. Must run on the GTK main
+// loop.
+func (a *app) applyGlobalHotkeys() {
+	hotkeyApp = a
+	C.brain_hotkey_ungrab_all()
+	conn := C.brain_dbus_app_connection(C.gpointer(unsafe.Pointer(a.gtkApp.Native())))
+	keys, errs := parseGlobalHotkeys(a.profile().GlobalHotkeys)
+	for _, err := range errs {
+		a.logf("global hotkey skipped: %v", err)
+	}
+	a.hotkeys = keys
+	if len(keys) == 0 {
+		if conn != nil {
+			C.brain_portal_stop(conn)
+		}
+		return
+	}
+	if C.brain_hotkeys_x11() != 0 {
+		for i, hk := range keys {
+			key, mods := gtk.AcceleratorParse(hk.accel)
+			if index := C.brain_hotkey_grab(C.guint(key), C.GdkModifierType(mods)); index < 0 {
+				a.logf("global hotkey %s unavailable: another application holds it", hk.accel)
+				// keep C's grab indexes lined up with a.hotkeys
+				a.hotkeys[i].command = ""
+			}
+		}
+		a.hotkeys = compactHotkeys(a.hotkeys)
+		a.logf("global hotkeys: %d grabbed", len(a.hotkeys))
+		return
+	}
+	if conn == nil {
+		a.logf("global hotkeys unavailable: no X11 display or session bus")
+		return
+	}
+	n := len(keys)
+	ids := make([]*C.char, n)
+	descriptions := make([]*C.char, n)
+	triggers := make([]*C.char, n)
+	for i, hk := range keys {
+		ids[i] = C.CString(hotkeyID(i))
+		descriptions[i] = C.CString(hk.command)
+		triggers[i] = C.CString(portalTrigger(hk.accel))
+	}
+	defer func() {
+		for i := range ids {
+			C.free(unsafe.Pointer(ids[i]))
+			C.free(unsafe.Pointer(descriptions[i]))
+			C.free(unsafe.Pointer(triggers[i]))
+		}
+	}()
+	C.brain_portal_start(conn, &ids[0], &descriptions[0], &triggers[0], C.int(n))
+}
+
+// compactHotkeys drops bindings whose grab failed, so the rest keep the
+// indexes C assigned them.
+func compactHotkeys(keys []globalHotkey) []globalHotkey {
+	out := keys[:0]
+	for _, hk := range keys {
+		if hk.command != "" {
+			out = append(out, hk)
+		}
+	}
+	return out
+}
+
+func hotkeyID(index int) string {
+	return "hotkey-" + strconv.Itoa(index)
+}
+
+// runHotkey runs a binding's command: a palette action when one has that
+// name, else the script line. Must run on the GTK main loop.
+func (a *app) runHotkey(hk globalHotkey) {
+	a.logf("global hotkey %s: %s", hk.accel, hk.command)
+	if a.runRegistered(hk.command) {
+		return
+	}
+	if hk.steps == nil {
+		a.logf("global hotkey %s: no action %q", hk.accel, hk.command)
+		return
+	}
+	steps := hk.steps
+	go func() {
+		ctx, cancel := context.WithTimeout(a.ctx, hotkeyTimeout)
+		defer cancel()
+		runner := &script.Runner{Client: a.currentSocket()}
+		if err := runner.Run(ctx, steps); err != nil {
+			a.reportError("hotkey "+hk.accel, err, nil)
+		}
+	}()
+}
+
+//export brainHotkeyPressed
+func brainHotkeyPressed(index C.int) {
+	a := hotkeyApp
+	if a == nil || int(index) >= len(a.hotkeys) {
+		return
+	}
+	a.runHotkey(a.hotkeys[index])
+}
+
+//export brainHotkeyPortalActivated
+func brainHotkeyPortalActivated(id *C.char) {
+	a := hotkeyApp
+	if a == nil {
+		return
+	}
+	name := C.GoString(id)
+	for i, hk := range a.hotkeys {
+		if hotkeyID(i) == name {
+			a.runHotkey(hk)
+			return
+		}
+	}
+}
+
+//export brainHotkeyPortalReady
+func brainHotkeyPortalReady(errText *C.char) {
+	a := hotkeyApp
+	if a == nil {
+		return
+	}
+	if errText != nil {
+		a.logf("global hotkeys unavailable: %s", C.GoString(errText))
+		return
+	}
+	a.logf("global hotkeys: %d bound through the desktop portal", len(a.hotkeys))
+}
@@ -0,0 +1,256 @@
+package main
+
+// C side of the global hotkeys: key grabs on the X11 root window, and the
+// GlobalShortcuts portal elsewhere, which is how Wayland compositors hand
+// out shortcuts. It lives apart from hotkeys.go, which has //export.
+
+// #cgo pkg-config: gtk+-3.0
+// #cgo linux pkg-config: x11
+// #include <stdlib.h>
+// #include <string.h>
+// #include <gtk/gtk.h>
+// #ifdef GDK_WINDOWING_X11
+// #include <gdk/gdkx.h>
+// #include <X11/Xlib.h>
+// #endif
+//
+// extern void brainHotkeyPressed(int);
+// extern void brainHotkeyPortalReady(char*);
+// extern void brainHotkeyPortalActivated(char*);
+//
+// #ifdef GDK_WINDOWING_X11
+// typedef struct { int keycode; unsigned int mods; } brain_grab;
+// static brain_grab *brain_grabs = NULL;
+// static int brain_ngrabs = 0;
+// // NumLock and CapsLock must not stop a hotkey from firing.
+// static const unsigned int brain_lock_masks[] = { 0, LockMask, Mod2Mask, LockMask | Mod2Mask };
+//
+// static GdkFilterReturn brain_hotkey_filter(GdkXEvent *xevent, GdkEvent *event, gpointer data) {
+//   XEvent *xe = (XEvent *)xevent;
+//   if (xe->type != KeyPress) {
+//     return GDK_FILTER_CONTINUE;
+//   }
+//   unsigned int state = xe->xkey.state & (ShiftMask | ControlMask | Mod1Mask | Mod4Mask);
+//   for (int i = 0; i < brain_ngrabs; i++) {
+//     if (brain_grabs[i].keycode == (int)xe->xkey.keycode && brain_grabs[i].mods == state) {
+//       brainHotkeyPressed(i);
+//       return GDK_FILTER_REMOVE;
+//     }
+//   }
+//   return GDK_FILTER_CONTINUE;
+// }
+// #endif
+//
+// int brain_hotkeys_x11(void) {
+// #ifdef GDK_WINDOWING_X11
+//   return GDK_IS_X11_DISPLAY(gdk_display_get_default());
+// #else
+//   return 0;
+// #endif
+// }
+//
+// // brain_hotkey_grab returns the grab's index, or -1 if the key has no
+// // keycode or another client holds it.
+// int brain_hotkey_grab(guint keyval, GdkModifierType gdkmods) {
+// #ifdef GDK_WINDOWING_X11
+//   GdkDisplay *display = gdk_display_get_default();
+//   Display *dpy = GDK_DISPLAY_XDISPLAY(display);
+//   Window root = DefaultRootWindow(dpy);
+//   int keycode = XKeysymToKeycode(dpy, keyval);
+//   if (keycode == 0) {
+//     return -1;
+//   }
+//   unsigned int mods = 0;
+//   if (gdkmods & GDK_SHIFT_MASK) mods |= ShiftMask;
+//   if (gdkmods & GDK_CONTROL_MASK) mods |= ControlMask;
+//   if (gdkmods & GDK_MOD1_MASK) mods |= Mod1Mask;
+//   if (gdkmods & (GDK_SUPER_MASK | GDK_MOD4_MASK)) mods |= Mod4Mask;
+//   gdk_x11_display_error_trap_push(display);
+//   for (int i = 0; i < 4; i++) {
+//     XGrabKey(dpy, keycode, mods | brain_lock_masks[i], root, False, GrabModeAsync, GrabModeAsync);
+//   }
+//   if (gdk_x11_display_error_trap_pop(display) != 0) {
+//     gdk_x11_display_error_trap_push(display);
+//     for (int i = 0; i < 4; i++) {
+//       XUngrabKey(dpy, keycode, mods | brain_lock_masks[i], root);
+//     }
+//     gdk_x11_display_error_trap_pop_ignored(display);
+//     return -1;
+//   }
+//   if (brain_ngrabs == 0) {
+//     gdk_window_add_filter(gdk_get_default_root_window(), brain_hotkey_filter, NULL);
+//   }
+//   brain_grabs = realloc(brain_grabs, sizeof(brain_grab) * (brain_ngrabs + 1));
+//   brain_grabs[brain_ngrabs].keycode = keycode;
+//   brain_grabs[brain_ngrabs].mods = mods;
+//   return brain_ngrabs++;
+// #else
+//   return -1;
+// #endif
+// }
+//
+// void brain_hotkey_ungrab_all(void) {
+// #ifdef GDK_WINDOWING_X11
+//   if (brain_ngrabs == 0) {
+//     return;
+//   }
+//   GdkDisplay *display = gdk_display_get_default();
+//   Display *dpy = GDK_DISPLAY_XDISPLAY(display);
+//   Window root = DefaultRootWindow(dpy);
+//   gdk_x11_display_error_trap_push(display);
+//   for (int g = 0; g < brain_ngrabs; g++) {
+//     for (int i = 0; i < 4; i++) {
+//       XUngrabKey(dpy, brain_grabs[g].keycode, brain_grabs[g].mods | brain_lock_masks[i], root);
+//     }
+//   }
+//   gdk_x11_display_error_trap_pop_ignored(display);
+//   gdk_window_remove_filter(gdk_get_default_root_window(), brain_hotkey_filter, NULL);
+//   free(brain_grabs);
+//   brain_grabs = NULL;
+//   brain_ngrabs = 0;
+// #endif
+// }
+//
+// #define BRAIN_PORTAL_NAME "org.freedesktop.portal.Desktop"
+// #define BRAIN_PORTAL_PATH "/org/freedesktop/portal/desktop"
+// #define BRAIN_PORTAL_IFACE "org.freedesktop.portal.GlobalShortcuts"
+//
+// static char *brain_portal_session = NULL;
+// static guint brain_portal_activated = 0;
+//
+// // brain_portal_request_path is where the portal answers a request made
+// // with token, per the portal's Request convention.
+// static char *brain_portal_request_path(GDBusConnection *conn, const char *token) {
+//   char *sender = g_strdup(g_dbus_connection_get_unique_name(conn) + 1);
+//   for (char *p = sender; *p; p++) {
+//     if (*p == '.') *p = '_';
+//   }
+//   char *path = g_strdup_printf(BRAIN_PORTAL_PATH "/request/%s/%s", sender, token);
+//   g_free(sender);
+//   return path;
+// }
+//
+// static void brain_portal_on_activated(GDBusConnection *conn, const gchar *sender, const gchar *path,
+//     const gchar *iface, const gchar *signal, GVariant *params, gpointer data) {
+//   const gchar *session, *id;
+//   g_variant_get(params, "(&o&st@a{sv})", &session, &id, NULL, NULL);
+//   if (brain_portal_session != NULL && strcmp(session, brain_portal_session) == 0) {
+//     brainHotkeyPortalActivated((char *)id);
+//   }
+// }
+//
+// typedef struct {
+//   GDBusConnection *conn;
+//   guint sub;
+//   GVariant *shortcuts;
+// } brain_portal_state;
+//
+// static void brain_portal_done(brain_portal_state *st, const char *err) {
+//   if (st->sub != 0) {
+//     g_dbus_connection_signal_unsubscribe(st->conn, st->sub);
+//   }
+//   g_variant_unref(st->shortcuts);
+//   g_free(st);
+//   brainHotkeyPortalReady((char *)err);
+// }
+//
+// // brain_portal_call makes a portal request whose answer comes as a
+// // Response signal, handled by on_response.
+// static void brain_portal_call(brain_portal_state *st, const char *method, GVariant *args,
+//     const char *token, GDBusSignalCallback on_response) {
+//   char *request = brain_portal_request_path(st->conn, token);
+//   st->sub = g_dbus_connection_signal_subscribe(st->conn, BRAIN_PORTAL_NAME, "org.freedesktop.portal.Request",
+//       "Response", request, NULL, G_DBUS_SIGNAL_FLAGS_NO_MATCH_RULE, on_response, st, NULL);
+//   g_free(request);
+//   GError *err = NULL;
+//   GVariant *ret = g_dbus_connection_call_sync(st->conn, BRAIN_PORTAL_NAME, BRAIN_PORTAL_PATH, BRAIN_PORTAL_IFACE,
+//       method, args, NULL, G_DBUS_CALL_FLAGS_NONE, -1, NULL, &err);
+//   if (ret == NULL) {
+//     char *msg = g_strdup(err->message);
+//     g_error_free(err);
+//     brain_portal_done(st, msg);
+//     g_free(msg);
+//     return;
+//   }
+//   g_variant_unref(ret);
+// }
+//
+// static void brain_portal_on_bound(GDBusConnection *conn, const gchar *sender, const gchar *path,
+//     const gchar *iface, const gchar *signal, GVariant *params, gpointer data) {
+//   guint32 response;
+//   g_variant_get(params, "(u@a{sv})", &response, NULL);
+//   brain_portal_done(data, response == 0 ? NULL : "the desktop declined the shortcuts");
+// }
+//
+// static void brain_portal_on_session(GDBusConnection *conn, const gchar *sender, const gchar *path,
+//     const gchar *iface, const gchar *signal, GVariant *params, gpointer data) {
+//   brain_portal_state *st = data;
+//   g_dbus_connection_signal_unsubscribe(conn, st->sub);
+//   st->sub = 0;
+//   guint32 response;
+//   GVariant *results;
+//   g_variant_get(params, "(u@a{sv})", &response, &results);
+//   const gchar *session = NULL;
+//   if (response == 0) {
+//     g_variant_lookup(results, "session_handle", "&s", &session);
+//   }
+//   if (session == NULL) {
+//     g_variant_unref(results);
+//     brain_portal_done(st, "the desktop refused a shortcuts session");
+//     return;
+//   }
+//   g_free(brain_portal_session);
+//   brain_portal_session = g_strdup(session);
+//   g_variant_unref(results);
+//   if (brain_portal_activated == 0) {
+//     brain_portal_activated = g_dbus_connection_signal_subscribe(conn, BRAIN_PORTAL_NAME, BRAIN_PORTAL_IFACE,
+//         "Activated", BRAIN_PORTAL_PATH, NULL, G_DBUS_SIGNAL_FLAGS_NONE, brain_portal_on_activated, NULL, NULL);
+//   }
+//   GVariantBuilder options;
+//   g_variant_builder_init(&options, G_VARIANT_TYPE_VARDICT);
+//   g_variant_builder_add(&options, "{sv}", "handle_token", g_variant_new_string("brain_bind"));
+//   brain_portal_call(st, "BindShortcuts",
+//       g_variant_new("(o@a(sa{sv})sa{sv})", brain_portal_session, st->shortcuts, "", &options),
+//       "brain_bind", brain_portal_on_bound);
+// }
+//
+// // brain_portal_stop closes the current session, which drops its
+// // shortcuts.
+// void brain_portal_stop(GDBusConnection *conn) {
+//   if (brain_portal_session == NULL) {
+//     return;
+//   }
+//   g_dbus_connection_call(conn, BRAIN_PORTAL_NAME, brain_portal_session, "org.freedesktop.portal.Session",
+//       "Close", NULL, NULL, G_DBUS_CALL_FLAGS_NONE, -1, NULL, NULL, NULL);
+//   g_free(brain_portal_session);
+//   brain_portal_session = NULL;
+// }
+//
+// // brain_portal_start binds ids[i] to triggers[i], described by
+// // descriptions[i]. brainHotkeyPortalReady reports the outcome.
+// void brain_portal_start(GDBusConnection *conn, char **ids, char **descriptions, char **triggers, int n) {
+//   static int serial = 0;
+//   brain_portal_stop(conn);
+//   GVariantBuilder shortcuts;
+//   g_variant_builder_init(&shortcuts, G_VARIANT_TYPE("a(sa{sv})"));
+//   for (int i = 0; i < n; i++) {
+//     GVariantBuilder props;
+//     g_variant_builder_init(&props, G_VARIANT_TYPE_VARDICT);
+//     g_variant_builder_add(&props, "{sv}", "description", g_variant_new_string(descriptions[i]));
+//     g_variant_builder_add(&props, "{sv}", "preferred_trigger", g_variant_new_string(triggers[i]));
+//     g_variant_builder_add(&shortcuts, "(sa{sv})", ids[i], &props);
+//   }
+//   brain_portal_state *st = g_new0(brain_portal_state, 1);
+//   st->conn = conn;
+//   st->shortcuts = g_variant_ref_sink(g_variant_builder_end(&shortcuts));
+//   char *token = g_strdup_printf("brain_session_%d", ++serial);
+//   char *session_token = g_strdup_printf("brain_%d", serial);
+//   GVariantBuilder options;
+//   g_variant_builder_init(&options, G_VARIANT_TYPE_VARDICT);
+//   g_variant_builder_add(&options, "{sv}", "handle_token", g_variant_new_string(token));
+//   g_variant_builder_add(&options, "{sv}", "session_handle_token", g_variant_new_string(session_token));
+//   brain_portal_call(st, "CreateSession", g_variant_new("(a{sv})", &options), token, brain_portal_on_session);
+//   g_free(token);
+//   g_free(session_token);
+// }
+import "C"
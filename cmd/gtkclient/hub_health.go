@@ -0,0 +1,62 @@
+package main
+
+import (
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/metrics"
+)
+
+// Hub health as seen from this machine, for alerting when the hub becomes
+// unreachable or stops pushing status.
+const (
+	metricHubUp         = "brain_hub_up"
+	metricHubConnected  = "brain_hub_connected"
+	metricHubStatusAge  = "brain_hub_last_status_age_seconds"
+	metricHubPeers      = "brain_hub_peers"
+	metricHubAudioFiles = "brain_hub_audio_files"
+)
+
+func (a *app) describeHubHealth() {
+	r := a.metrics
+	r.Describe(metricHubUp, metrics.KindGauge, "1 while the client holds an open socket to the hub.")
+	r.Describe(metricHubConnected, metrics.KindGauge, "The connected flag from the hub's last status.")
+	r.Describe(metricHubStatusAge, metrics.KindGauge, "Seconds since the last status reached the client, or since startup if none has.")
+	r.Describe(metricHubPeers, metrics.KindGauge, "Peers listed by the hub.")
+	r.Describe(metricHubAudioFiles, metrics.KindGauge, "Audio files in the hub library.")
+	r.Set(metricHubUp, nil, 0)
+	a.lastStatus.Store(time.Now().UnixNano())
+	r.OnCollect(func() {
+		age := time.Since(time.Unix(0, a.lastStatus.Load()))
+		r.Set(metricHubStatusAge, nil, age.Seconds())
+	})
+}
+
+func (a *app) setHubUp(up bool) {
+	v := 0.0
+	if up {
+		v = 1
+	}
+	a.metrics.Set(metricHubUp, nil, v)
+}
+
+// recordHubStatus notes a status snapshot from either a status request or a
+// pushed status event. files is -1 when the audio list could not be read.
+func (a *app) recordHubStatus(status *hubclient.Status, files int) {
+	a.lastStatus.Store(time.Now().UnixNano())
+	connected := 0.0
+	if status.Connected {
+		connected = 1
+	}
+	a.metrics.Set(metricHubConnected, nil, connected)
+	if files >= 0 {
+		a.metrics.Set(metricHubAudioFiles, nil, float64(files))
+	}
+}
+
+func audioCount(files []audioFile, audioErr string) int {
+	if audioErr != "" {
+		return -1
+	}
+	return len(files)
+}
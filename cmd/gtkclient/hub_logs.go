@@ -0,0 +1,228 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	hubLogDefaultCount = 200
+	hubLogLimit        = 2000
+)
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+// hubLogView is the "Hub Logs" tab. All fields are owned by the GTK main
+// loop.
+type hubLogView struct {
+	buffer     *gtk.TextBuffer
+	view       *gtk.TextView
+	countSpin  *gtk.SpinButton
+	levelCombo *gtk.ComboBoxText
+	fetchBtn   *gtk.Button
+	pauseBtn   *gtk.ToggleButton
+	held       []hubclient.LogEntry
+}
+
+func logLevelRank(level string) int {
+	switch strings.ToLower(level) {
+	case "debug", "trace":
+		return 0
+	case "warn", "warning":
+		return 2
+	case "error", "fatal":
+		return 3
+	}
+	return 1
+}
+
+func formatLogEntry(e hubclient.LogEntry) string {
+	ts := e.Time
+	if t, err := time.Parse(time.RFC3339Nano, e.Time); err == nil {
+		ts = t.Local().Format("15:04:05")
+	}
+	parts := []string{}
+	if ts != "" {
+		parts = append(parts, ts)
+	}
+	if e.Level != "" {
+		parts = append(parts, strings.ToUpper(e.Level))
+	}
+	if e.Source != "" {
+		parts = append(parts, e.Source+":")
+	}
+	parts = append(parts, e.Message)
+	return strings.Join(parts, " ")
+}
+
+func (a *app) buildHubLogsTab() gtk.IWidget {
+	v := &hubLogView{}
+	a.hubLogs = v
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+
+	bar, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	box.PackStart(bar, false, false, 0)
+	countLabel, _ := gtk.LabelNew(tr("Last"))
+	bar.PackStart(countLabel, false, false, 0)
+	v.countSpin, _ = gtk.SpinButtonNewWithRange(10, hubLogLimit, 10)
+	v.countSpin.SetValue(hubLogDefaultCount)
+	countLabel.SetMnemonicWidget(v.countSpin)
+	bar.PackStart(v.countSpin, false, false, 0)
+	levelLabel, _ := gtk.LabelNew(tr("lines at level"))
+	bar.PackStart(levelLabel, false, false, 0)
+	v.levelCombo, _ = gtk.ComboBoxTextNew()
+	for _, level := range logLevels {
+		v.levelCombo.Append(level, level)
+	}
+	v.levelCombo.SetActiveID("info")
+	levelLabel.SetMnemonicWidget(v.levelCombo)
+	bar.PackStart(v.levelCombo, false, false, 0)
+	v.fetchBtn, _ = gtk.ButtonNewWithLabel(tr("Fetch"))
+	v.fetchBtn.Connect("clicked", func() {
+		count := v.countSpin.GetValueAsInt()
+		level := v.levelCombo.GetActiveID()
+		go a.fetchHubLogs(count, level)
+	})
+	bar.PackStart(v.fetchBtn, false, false, 0)
+	clearBtn, _ := gtk.ButtonNewWithLabel(tr("Clear"))
+	setAccessible(clearBtn, tr("Clear hub logs"), "")
+	clearBtn.Connect("clicked", func() {
+		v.buffer.SetText("")
+		v.held = nil
+	})
+	bar.PackEnd(clearBtn, false, false, 0)
+	v.pauseBtn, _ = gtk.ToggleButtonNewWithLabel(tr("Pause"))
+	v.pauseBtn.SetTooltipText(tr("Hold live log lines until resumed"))
+	v.pauseBtn.Connect("toggled", func() {
+		if v.pauseBtn.GetActive() {
+			v.pauseBtn.SetLabel(tr("Resume"))
+			return
+		}
+		v.pauseBtn.SetLabel(tr("Pause"))
+		held := v.held
+		v.held = nil
+		a.appendHubLogs(held)
+	})
+	bar.PackEnd(v.pauseBtn, false, false, 0)
+
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	scroll.SetVExpand(true)
+	box.PackStart(scroll, true, true, 0)
+	v.view, _ = gtk.TextViewNew()
+	v.view.SetEditable(false)
+	v.view.SetMonospace(true)
+	v.view.SetWrapMode(gtk.WRAP_WORD_CHAR)
+	addStyleClass(v.view, "hub-log")
+	scroll.Add(v.view)
+	v.buffer, _ = v.view.GetBuffer()
+	a.setHubLogsAvailable(a.currentSocket().Supports(protocol.CapLogs))
+	return box
+}
+
+// setHubLogsAvailable enables fetching log history when the hub answers
+// logs; pushed log lines still arrive without it. Must run on the GTK
+// main loop.
+func (a *app) setHubLogsAvailable(ok bool) {
+	v := a.hubLogs
+	if v == nil {
+		return
+	}
+	for _, w := range []gtk.IWidget{v.countSpin, v.levelCombo, v.fetchBtn} {
+		w.ToWidget().SetSensitive(ok)
+	}
+	if ok {
+		v.fetchBtn.SetTooltipText(tr("Replace the tab with the hub's recent log history"))
+	} else {
+		v.fetchBtn.SetTooltipText(tr("This hub keeps no log history; only live lines are shown"))
+	}
+}
+
+// fetchHubLogs replaces the tab contents with the hub's recent history.
+func (a *app) fetchHubLogs(count int, level string) {
+	lines, err := a.currentSocket().Logs(a.ctx, count, level)
+	if err != nil {
+		a.reportError("logs", err, func() { a.fetchHubLogs(count, level) })
+		return
+	}
+	a.showHubLogs(lines)
+}
+
+// loadHubLogHistory seeds the tab after connecting. Hubs without the logs
+// action only get a line in the client log.
+func (a *app) loadHubLogHistory() {
+	if !a.currentSocket().Supports(protocol.CapLogs) {
+		a.logf("hub log history unavailable: this hub does not offer logs")
+		return
+	}
+	lines, err := a.currentSocket().Logs(a.ctx, hubLogDefaultCount, "")
+	if err != nil {
+		a.logf("hub log history unavailable: %v", err)
+		return
+	}
+	a.showHubLogs(lines)
+}
+
+func (a *app) showHubLogs(lines []hubclient.LogEntry) {
+	glib.IdleAdd(func() bool {
+		if a.hubLogs == nil {
+			return false
+		}
+		a.hubLogs.buffer.SetText("")
+		a.hubLogs.held = nil
+		a.appendHubLogs(lines)
+		return false
+	})
+}
+
+// handleLogEvent live-tails a pushed hub log line into the tab.
+func (a *app) handleLogEvent(payload json.RawMessage) {
+	var entry hubclient.LogEntry
+	if err := json.Unmarshal(payload, &entry); err != nil || entry.Message == "" {
+		entry = hubclient.LogEntry{Message: strings.TrimSpace(string(payload))}
+	}
+	glib.IdleAdd(func() bool {
+		v := a.hubLogs
+		if v == nil {
+			return false
+		}
+		if v.pauseBtn.GetActive() {
+			if len(v.held) < hubLogLimit {
+				v.held = append(v.held, entry)
+			}
+			v.pauseBtn.SetLabel(fmt.Sprintf(tr("Resume (%d)"), len(v.held)))
+			return false
+		}
+		a.appendHubLogs([]hubclient.LogEntry{entry})
+		return false
+	})
+}
+
+// appendHubLogs must run on the GTK main loop.
+func (a *app) appendHubLogs(entries []hubclient.LogEntry) {
+	v := a.hubLogs
+	minRank := logLevelRank(v.levelCombo.GetActiveID())
+	for _, e := range entries {
+		if e.Level != "" && logLevelRank(e.Level) < minRank {
+			continue
+		}
+		v.buffer.Insert(v.buffer.GetEndIter(), formatLogEntry(e)+"\n")
+	}
+	for v.buffer.GetLineCount() > hubLogLimit {
+		start := v.buffer.GetStartIter()
+		next := v.buffer.GetIterAtLine(1)
+		v.buffer.Delete(start, next)
+	}
+	if mark := v.buffer.CreateMark("", v.buffer.GetEndIter(), false); mark != nil {
+		v.view.ScrollMarkOnscreen(mark)
+		v.buffer.DeleteMark(mark)
+	}
+}
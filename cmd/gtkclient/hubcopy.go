@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+var errCopyCancelled = errors.New("copy cancelled")
+
+// copyProgressInterval spaces progress updates in the log.
+const copyProgressInterval = 5 * time.Second
+
+// copyPlainMax bounds a copy to a hub without chunked uploads, which has
+// to take the whole file in one upload message.
+const copyPlainMax = protocol.MaxFrameSize / 2
+
+// copyToHub streams filename from this hub's HTTP endpoint into a chunked
+// upload on the hub of profile name, one chunk in memory at a time. Hubs
+// without chunked uploads get a plain upload of files up to copyPlainMax.
+func (a *app) copyToHub(filename, name string) {
+	ctx, done := a.startOp("copy")
+	defer done()
+	a.setCopyProgress(fmt.Sprintf(tr("Copying %s to %s…"), filename, name), 0)
+	defer a.setCopyProgress("", -1)
+	started := time.Now()
+	size, err := a.copyStream(ctx, filename, name)
+	if err != nil {
+		if context.Cause(ctx) == errCopyCancelled {
+			a.logf("copy of %s to %s cancelled", filename, name)
+			return
+		}
+		a.reportError("copy to hub", fmt.Errorf("%s to %s: %w", filename, name, err), func() { a.copyToHub(filename, name) })
+		return
+	}
+	a.logf("copied %s to %s (%s in %v)", filename, name, formatBytes(size), time.Since(started).Round(time.Millisecond))
+}
+
+func (a *app) copyStream(ctx context.Context, filename, name string) (int64, error) {
+	src, err := a.hubAudioURL(filename)
+	if err != nil {
+		return 0, err
+	}
+	source := a.currentSocket()
+	var size int64 = -1
+	var digest string
+	if source.Supports(protocol.CapHash) {
+		h, err := source.Hash(ctx, filename)
+		if err != nil {
+			return 0, err
+		}
+		size, digest = h.Size, h.SHA256
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, fanOutTimeout)
+	dest, address, err := a.dialProfile(dialCtx, name)
+	cancel()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", address, err)
+	}
+	defer dest.Close()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := archiveHTTPClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if size < 0 {
+		size = resp.ContentLength
+	}
+	if size < 0 {
+		return 0, fmt.Errorf("source hub sent %s without a length", filename)
+	}
+	if !dest.Supports(protocol.CapChunkedUpload) {
+		return a.copyPlain(ctx, dest, address, resp.Body, filename, size, digest)
+	}
+
+	up, err := dest.UploadBegin(ctx, hubclient.UploadBeginRequest{Filename: filename, Size: size, SHA256: digest})
+	if err != nil {
+		return 0, err
+	}
+	if up.Offset != 0 {
+		// a stale upload of the same file; the stream cannot seek, so start over
+		_ = dest.UploadCancel(ctx, up.UploadID)
+		if up, err = dest.UploadBegin(ctx, hubclient.UploadBeginRequest{Filename: filename, Size: size, SHA256: digest}); err != nil {
+			return 0, err
+		}
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			_ = dest.UploadCancel(a.ctx, up.UploadID)
+		}
+	}()
+
+	sum := sha256.New()
+	body := io.TeeReader(resp.Body, sum)
+	buf := make([]byte, chunkSizeFor(a.uploadLimit(), dest.BinaryFrames()))
+	var offset int64
+	lastLog := time.Now()
+	for offset < size {
+		n, err := io.ReadFull(body, buf[:min(int64(len(buf)), size-offset)])
+		if err != nil {
+			return offset, fmt.Errorf("reading from source hub at %s: %w", formatBytes(offset), err)
+		}
+		ack, err := dest.UploadChunk(ctx, up.UploadID, offset, buf[:n])
+		if err != nil {
+			return offset, err
+		}
+		if ack.Offset != offset+int64(n) {
+			return offset, fmt.Errorf("hub acknowledged offset %d after sending %d", ack.Offset, offset+int64(n))
+		}
+		offset = ack.Offset
+		a.recordTransfer("upload", "copy", int64(n))
+		fraction := float64(offset) / float64(size)
+		a.setCopyProgress(fmt.Sprintf(tr("Copying %s to %s: %s of %s"), filename, name, formatBytes(offset), formatBytes(size)), fraction)
+		if time.Since(lastLog) >= copyProgressInterval {
+			lastLog = time.Now()
+			a.logf("copy %s to %s: %s of %s (%.0f%%)", filename, name, formatBytes(offset), formatBytes(size), fraction*100)
+		}
+	}
+	if digest == "" {
+		digest = hex.EncodeToString(sum.Sum(nil))
+	}
+	if _, err := dest.UploadCommit(ctx, up.UploadID, digest); err != nil {
+		return offset, err
+	}
+	committed = true
+	return offset, nil
+}
+
+// copyPlain copies to a hub without chunked uploads: the file is read
+// whole from body, checked against the source hub's digest when there is
+// one, and sent as one upload.
+func (a *app) copyPlain(ctx context.Context, dest *hubclient.Client, address string, body io.Reader, filename string, size int64, digest string) (int64, error) {
+	if size > copyPlainMax {
+		return 0, fmt.Errorf("%s does not take chunked uploads, and %s is over the %s one upload can carry", address, formatBytes(size), formatBytes(copyPlainMax))
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(body, data); err != nil {
+		return 0, fmt.Errorf("reading from source hub: %w", err)
+	}
+	if digest != "" {
+		if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != digest {
+			return 0, fmt.Errorf("source hub sent %s with a different checksum than it reported", filename)
+		}
+	}
+	res, err := dest.Upload(ctx, hubclient.UploadRequest{Filename: filename, Data: data})
+	if err != nil {
+		return 0, err
+	}
+	a.recordTransfer("upload", "copy", size)
+	a.warnUnverified(res)
+	return size, nil
+}
+
+// setCopyProgress shows the copy bar at fraction, or hides it when
+// fraction is negative.
+func (a *app) setCopyProgress(text string, fraction float64) {
+	glib.IdleAdd(func() bool {
+		v := a.filesView
+		if v == nil || v.copyBar == nil {
+			return false
+		}
+		if fraction < 0 {
+			if a.runningOps("copy") == 0 {
+				v.copyBox.Hide()
+			}
+			return false
+		}
+		v.copyBar.SetFraction(fraction)
+		v.copyBar.SetText(text)
+		v.copyBox.ShowAll()
+		return false
+	})
+}
+
+// buildCopyButton adds the "Copy to Hub" picker and the copy progress row
+// to the Files tab.
+func (a *app) buildCopyButton(bar, box *gtk.Box, v *filesView) {
+	btn, _ := gtk.MenuButtonNew()
+	btn.SetLabel(tr("Copy to Hub"))
+	btn.SetTooltipText(tr("Copy the selected file to the hub of another profile"))
+	popover, _ := gtk.PopoverNew(btn)
+	btn.SetPopover(popover)
+	var list *gtk.Box
+	btn.Connect("toggled", func() {
+		if !btn.GetActive() {
+			return
+		}
+		if list != nil {
+			popover.Remove(list)
+		}
+		list, _ = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 2)
+		list.SetBorderWidth(6)
+		others := a.otherProfiles()
+		if len(others) == 0 {
+			none, _ := gtk.LabelNew(tr("No other profiles are configured"))
+			list.PackStart(none, false, false, 0)
+		}
+		for _, name := range others {
+			name := name
+			item, _ := gtk.ButtonNewWithLabel(name)
+			item.SetRelief(gtk.RELIEF_NONE)
+			item.Connect("clicked", func() {
+				popover.Hide()
+				if file := v.selected(); file != "" {
+					go a.copyToHub(file, name)
+				}
+			})
+			list.PackStart(item, false, false, 0)
+		}
+		popover.Add(list)
+		list.ShowAll()
+	})
+	bar.PackStart(btn, false, false, 0)
+
+	v.copyBox, _ = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	v.copyBox.SetNoShowAll(true)
+	v.copyBar, _ = gtk.ProgressBarNew()
+	v.copyBar.SetShowText(true)
+	setAccessible(v.copyBar, tr("Copy progress"), "")
+	v.copyBox.PackStart(v.copyBar, true, true, 0)
+	cancelBtn, _ := gtk.ButtonNewWithLabel(tr("Cancel"))
+	setAccessible(cancelBtn, tr("Cancel copy"), "")
+	cancelBtn.Connect("clicked", func() {
+		if n := a.cancelOps("copy", errCopyCancelled); n == 0 {
+			a.logf("no copy in progress")
+		}
+	})
+	v.copyBox.PackEnd(cancelBtn, false, false, 0)
+	box.PackStart(v.copyBox, false, false, 0)
+}
@@ -0,0 +1,21 @@
+package main
+
+import "brain/internal/i18n"
+
+// tr marks a UI string for translation; go generate ./internal/i18n
+// collects every literal passed to it into the template.
+func tr(msgid string) string {
+	return i18n.T(msgid)
+}
+
+// initLanguage loads the configured language, or the locale's, before any
+// widget is built. Log lines stay in English.
+func (a *app) initLanguage() {
+	lang, err := i18n.Init(a.config.Language)
+	switch {
+	case err != nil:
+		a.logf("translations disabled: %v", err)
+	case lang != "":
+		a.logf("language: %s", lang)
+	}
+}
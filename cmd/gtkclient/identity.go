@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// whoami is what the hub's status says about this client. Hubs differ in
+// what they put there; fields not recognised are kept as Extra.
+type whoami struct {
+	ID           string
+	Name         string
+	Capabilities []string
+	Addresses    []string
+	Error        string
+	Extra        [][2]string
+}
+
+func parseWhoami(raw any) whoami {
+	var w whoami
+	m, ok := raw.(map[string]any)
+	if !ok {
+		if s, ok := raw.(string); ok {
+			w.Extra = append(w.Extra, [2]string{"whoami", s})
+		}
+		return w
+	}
+	first := func(keys ...string) string {
+		for _, k := range keys {
+			if s, ok := m[k].(string); ok && s != "" {
+				return s
+			}
+		}
+		return ""
+	}
+	w.ID = first("id", "peerId", "clientId")
+	w.Name = first("name", "hostname")
+	w.Error = first("error")
+	w.Capabilities = stringList(m["capabilities"])
+	w.Addresses = stringList(m["addresses"])
+	known := map[string]bool{
+		"id": true, "peerId": true, "clientId": true, "name": true, "hostname": true,
+		"error": true, "capabilities": true, "addresses": true, "command": true,
+	}
+	for k, v := range m {
+		if known[k] {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			w.Extra = append(w.Extra, [2]string{k, v})
+		case float64, bool:
+			w.Extra = append(w.Extra, [2]string{k, fmt.Sprint(v)})
+		case []any:
+			if list := stringList(v); len(list) > 0 {
+				w.Extra = append(w.Extra, [2]string{k, strings.Join(list, ", ")})
+			}
+		}
+	}
+	sort.Slice(w.Extra, func(i, j int) bool { return w.Extra[i][0] < w.Extra[j][0] })
+	return w
+}
+
+// stringList keeps the strings and numbers of a JSON array as text.
+func stringList(raw any) []string {
+	items, _ := raw.([]any)
+	var out []string
+	for _, item := range items {
+		switch v := item.(type) {
+		case string:
+			out = append(out, v)
+		case float64:
+			out = append(out, fmt.Sprint(v))
+		}
+	}
+	return out
+}
+
+// rows is what the Identity section shows, in order.
+func (w whoami) rows() [][2]string {
+	var rows [][2]string
+	add := func(label, value string) {
+		if value != "" {
+			rows = append(rows, [2]string{label, value})
+		}
+	}
+	add(tr("Peer ID"), w.ID)
+	add(tr("Name"), w.Name)
+	add(tr("Addresses"), strings.Join(w.Addresses, ", "))
+	add(tr("Capabilities"), strings.Join(w.Capabilities, ", "))
+	add(tr("Error"), w.Error)
+	return append(rows, w.Extra...)
+}
+
+// identityView is the Identity expander in the status area. All fields
+// are owned by the GTK main loop.
+type identityView struct {
+	expander *gtk.Expander
+	grid     *gtk.Grid
+	copyBtn  *gtk.Button
+	id       string
+	// shown is the last rendering, to skip rebuilding the same rows on
+	// every status
+	shown string
+}
+
+func (a *app) buildIdentity() gtk.IWidget {
+	v := &identityView{}
+	a.identity = v
+	v.expander, _ = gtk.ExpanderNew(tr("Identity"))
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+	box.SetMarginStart(12)
+	v.grid, _ = gtk.GridNew()
+	v.grid.SetColumnSpacing(12)
+	v.grid.SetRowSpacing(2)
+	box.PackStart(v.grid, false, false, 0)
+	v.copyBtn, _ = gtk.ButtonNewWithLabel(tr("Copy Peer ID"))
+	v.copyBtn.SetHAlign(gtk.ALIGN_START)
+	v.copyBtn.SetTooltipText(tr("Copy this client's peer ID for use in targeted commands"))
+	v.copyBtn.SetSensitive(false)
+	v.copyBtn.Connect("clicked", func() { a.copyPeerID() })
+	box.PackStart(v.copyBtn, false, false, 0)
+	v.expander.Add(box)
+	v.show(whoami{})
+	return v.expander
+}
+
+// show replaces the rows with w's.
+func (v *identityView) show(w whoami) {
+	rows := w.rows()
+	var sig strings.Builder
+	for _, r := range rows {
+		sig.WriteString(r[0] + "\x00" + r[1] + "\x00")
+	}
+	if sig.String() == v.shown && v.shown != "" {
+		return
+	}
+	v.shown = sig.String()
+	v.id = w.ID
+	v.copyBtn.SetSensitive(w.ID != "")
+	if children := v.grid.GetChildren(); children != nil {
+		children.Foreach(func(item interface{}) {
+			if w, ok := item.(*gtk.Widget); ok {
+				w.Destroy()
+			}
+		})
+	}
+	if len(rows) == 0 {
+		rows = [][2]string{{tr("Identity"), tr("The hub has not said who this client is yet")}}
+	}
+	for i, r := range rows {
+		key, _ := gtk.LabelNew(r[0])
+		key.SetXAlign(0)
+		key.SetYAlign(0)
+		addStyleClass(key, "dim-label")
+		v.grid.Attach(key, 0, i, 1, 1)
+		value, _ := gtk.LabelNew(r[1])
+		value.SetXAlign(0)
+		value.SetSelectable(true)
+		value.SetLineWrap(true)
+		value.SetHExpand(true)
+		v.grid.Attach(value, 1, i, 1, 1)
+	}
+	v.grid.ShowAll()
+	if w.ID != "" {
+		v.expander.SetLabel(fmt.Sprintf(tr("Identity: %s"), w.ID))
+	}
+}
+
+// showWhoami renders the whoami member of a status. Must run on the GTK
+// main loop.
+func (a *app) showWhoami(raw any) {
+	if a.identity == nil || raw == nil {
+		return
+	}
+	a.identity.show(parseWhoami(raw))
+}
+
+func (a *app) copyPeerID() {
+	if a.identity == nil || a.identity.id == "" {
+		return
+	}
+	clip, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD)
+	if err != nil {
+		a.logf("clipboard error: %v", err)
+		return
+	}
+	clip.SetText(a.identity.id)
+	a.showToastType(gtk.MESSAGE_INFO, tr("Peer ID copied"), nil, false)
+}
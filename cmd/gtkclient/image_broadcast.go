@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// imageThumbSize bounds the thumbnails shown in the log.
+const imageThumbSize = 240
+
+// invokeBroadcastImage shows an uploaded image to every peer.
+func (a *app) invokeBroadcastImage(filename, caption string) {
+	key := hubclient.NewIdempotencyKey()
+	n, err := a.currentSocket().BroadcastImage(hubclient.WithIdempotencyKey(a.ctx, key), filename, caption)
+	if err != nil {
+		a.reportError("broadcast image", err, func() { a.invokeBroadcastImage(filename, caption) })
+		return
+	}
+	a.logf("image %s sent to %d peers", filename, n)
+}
+
+// chooseBroadcastImage picks an image to upload and show to every peer.
+// Must run on the GTK main loop.
+func (a *app) chooseBroadcastImage() {
+	if !a.currentSocket().Supports(protocol.CapBroadcastImage) {
+		a.showToastType(gtk.MESSAGE_WARNING, tr("This hub cannot broadcast images"), nil, false)
+		return
+	}
+	dialog, err := gtk.FileChooserDialogNewWith2Buttons(tr("Send Image"), a.win, gtk.FILE_CHOOSER_ACTION_OPEN,
+		tr("Cancel"), gtk.RESPONSE_CANCEL, tr("Send"), gtk.RESPONSE_ACCEPT)
+	if err != nil {
+		a.logf("image dialog error: %v", err)
+		return
+	}
+	defer dialog.Destroy()
+	filter, _ := gtk.FileFilterNew()
+	filter.SetName(tr("Images"))
+	filter.AddPixbufFormats()
+	dialog.AddFilter(filter)
+	if dialog.Run() == gtk.RESPONSE_ACCEPT {
+		path := dialog.GetFilename()
+		go a.runUpload(path, "", uploadOptions{BroadcastImage: true})
+	}
+}
+
+// handleImageEvent puts a thumbnail of an image a peer broadcast in the
+// log; clicking it opens the full image.
+func (a *app) handleImageEvent(payload json.RawMessage) {
+	var data struct {
+		Filename string `json:"filename"`
+		Caption  string `json:"caption"`
+		Size     int64  `json:"size"`
+		From     string `json:"from"`
+		Self     bool   `json:"self"`
+	}
+	if err := json.Unmarshal(payload, &data); err != nil {
+		a.logf("image event parse error: %v", err)
+		return
+	}
+	from := data.From
+	if data.Self {
+		from = "you"
+	} else if from == "" {
+		from = "unknown"
+	}
+	line := fmt.Sprintf("image from %s: %s", from, data.Filename)
+	if data.Caption != "" {
+		line += " — " + data.Caption
+	}
+	if data.Size > previewImageLimit {
+		a.logf("%s (%s, too large to show)", line, formatBytes(data.Size))
+		return
+	}
+	body, truncated, err := a.fetchHubFile(data.Filename, previewImageLimit)
+	if err != nil || truncated {
+		if truncated {
+			err = fmt.Errorf("over %s", formatBytes(previewImageLimit))
+		}
+		a.logf("%s (cannot fetch: %v)", line, err)
+		return
+	}
+	ts := time.Now().Format("15:04:05")
+	glib.IdleAdd(func() bool {
+		pixbuf, err := pixbufFromBytes(body)
+		if err != nil {
+			a.logf("%s (not an image: %v)", line, err)
+			return false
+		}
+		a.logImage(ts, line, data.Filename, pixbuf)
+		return false
+	})
+}
+
+// logImage adds a line and a clickable thumbnail to the log. Must run on
+// the GTK main loop.
+func (a *app) logImage(ts, line, name string, pixbuf *gdk.Pixbuf) {
+	if a.textBuffer == nil || a.textView == nil {
+		return
+	}
+	thumb, _ := gtk.ImageNewFromPixbuf(scalePixbuf(pixbuf, imageThumbSize))
+	thumb.SetTooltipText(fmt.Sprintf(tr("%s, %d×%d; click to enlarge"), name, pixbuf.GetWidth(), pixbuf.GetHeight()))
+	box, _ := gtk.EventBoxNew()
+	box.Add(thumb)
+	box.Connect("button-press-event", func() { a.showImage(name, pixbuf) })
+	a.textBuffer.Insert(a.textBuffer.GetEndIter(), fmt.Sprintf("[%s] %s\n", ts, line))
+	anchor, err := a.textBuffer.CreateChildAnchor(a.textBuffer.GetEndIter())
+	if err != nil {
+		return
+	}
+	a.textBuffer.Insert(a.textBuffer.GetEndIter(), "\n")
+	a.textView.AddChildAtAnchor(box, anchor)
+	box.ShowAll()
+}
+
+// showImage opens an image at full size, scaled down to fit the main
+// window.
+func (a *app) showImage(name string, pixbuf *gdk.Pixbuf) {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		return
+	}
+	dialog.SetTitle(name)
+	dialog.SetTransientFor(a.win)
+	dialog.AddButton(tr("Close"), gtk.RESPONSE_CLOSE)
+	w, h := a.win.GetSize()
+	limit := max(min(w, h)*9/10, previewMaxSize)
+	scaled := scalePixbuf(pixbuf, limit)
+	image, _ := gtk.ImageNewFromPixbuf(scaled)
+	setAccessible(image, name, "")
+	content, _ := dialog.GetContentArea()
+	content.PackStart(image, true, true, 0)
+	dialog.Connect("response", func() { dialog.Destroy() })
+	dialog.ShowAll()
+}
+
+// scalePixbuf shrinks pixbuf to fit in size×size, keeping its shape.
+func scalePixbuf(pixbuf *gdk.Pixbuf, size int) *gdk.Pixbuf {
+	w, h := pixbuf.GetWidth(), pixbuf.GetHeight()
+	if w <= size && h <= size {
+		return pixbuf
+	}
+	scale := float64(size) / float64(max(w, h))
+	scaled, err := pixbuf.ScaleSimple(max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale)), gdk.INTERP_BILINEAR)
+	if err != nil {
+		return pixbuf
+	}
+	return scaled
+}
+
+// isImage reports whether the hub will take filename for broadcast-image.
+func isImage(filename string) bool {
+	return strings.HasPrefix(hubclient.ContentType(filename), "image/")
+}
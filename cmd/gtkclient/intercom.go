@@ -0,0 +1,384 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// Intercom audio travels as raw 16 kHz mono S16LE PCM: trivially decodable
+// mid-stream, and small enough for a LAN at ~32 KB/s.
+const (
+	intercomRate     = 16000
+	intercomChannels = 1
+	intercomChunk    = intercomRate * intercomChannels * 2 / 10 // 100ms
+
+	// Events are dispatched concurrently, so chunks can arrive out of order.
+	// Up to intercomReorderWindow chunks are held back waiting for a gap to
+	// fill; a stream whose start never shows up is dropped after
+	// intercomStartWait.
+	intercomReorderWindow = 10
+	intercomStartWait     = 5 * time.Second
+)
+
+type intercomFormat struct {
+	Encoding string `json:"encoding"`
+	Rate     int    `json:"rate"`
+	Channels int    `json:"channels"`
+}
+
+type audioStreamChunk struct {
+	StreamID string          `json:"streamId"`
+	From     string          `json:"from"`
+	Self     bool            `json:"self"`
+	Seq      int             `json:"seq"`
+	Phase    string          `json:"phase"`
+	Format   *intercomFormat `json:"format,omitempty"`
+	Base64   string          `json:"base64,omitempty"`
+}
+
+// intercom owns the local capture pipeline and one playback pipeline per
+// incoming stream. Incoming chunks are replayed in sequence order.
+type intercom struct {
+	mu        sync.Mutex
+	talking   bool
+	capture   *exec.Cmd
+	streamID  string
+	playbacks map[string]*intercomPlayback
+}
+
+type intercomPlayback struct {
+	cmd     *exec.Cmd // nil until the start chunk arrives
+	stdin   io.WriteCloser
+	nextSeq int
+	from    string
+	pending map[int]audioStreamChunk
+	created time.Time
+}
+
+func (a *app) buildIntercomControls(box *gtk.Box) {
+	talkBtn, _ := gtk.ButtonNewWithLabel(tr("Hold to Talk"))
+	a.talkBtn = talkBtn
+	talkBtn.Connect("button-press-event", func() bool {
+		a.intercom.mu.Lock()
+		a.intercom.talking = true
+		a.intercom.mu.Unlock()
+		go a.startTalking()
+		return false
+	})
+	talkBtn.Connect("button-release-event", func() bool {
+		go a.stopTalking()
+		return false
+	})
+	// holding Space or Enter on the focused button talks too; key repeat
+	// is harmless since startTalking ignores a running capture
+	talkBtn.Connect("key-press-event", func(_ *gtk.Button, ev *gdk.Event) bool {
+		if !isActivateKey(ev) {
+			return false
+		}
+		a.intercom.mu.Lock()
+		a.intercom.talking = true
+		a.intercom.mu.Unlock()
+		go a.startTalking()
+		return true
+	})
+	talkBtn.Connect("key-release-event", func(_ *gtk.Button, ev *gdk.Event) bool {
+		if !isActivateKey(ev) {
+			return false
+		}
+		go a.stopTalking()
+		return true
+	})
+	box.PackStart(talkBtn, false, false, 0)
+	a.setIntercomAvailable(a.currentSocket().Supports(protocol.CapAudioStream), a.currentSocket().Role())
+}
+
+// setIntercomAvailable enables Hold to Talk when the hub relays
+// audio-stream and the role allows sending it. Must run on the GTK main
+// loop.
+func (a *app) setIntercomAvailable(ok bool, role protocol.Role) {
+	if a.talkBtn == nil {
+		return
+	}
+	allowed := ok && role.Allows("audio-stream")
+	a.talkBtn.SetSensitive(allowed)
+	switch {
+	case allowed:
+		a.talkBtn.SetTooltipText(tr("Capture the microphone and stream it live to every peer while held"))
+	case !ok:
+		a.talkBtn.SetTooltipText(tr("This hub cannot relay live audio"))
+	default:
+		a.talkBtn.SetTooltipText(roleTooltip(role))
+	}
+}
+
+func (a *app) startTalking() {
+	ic := &a.intercom
+	ic.mu.Lock()
+	// the button may already be released by the time we get here
+	if ic.capture != nil || !ic.talking {
+		ic.mu.Unlock()
+		return
+	}
+	cmd := exec.Command("gst-launch-1.0", "-q",
+		"autoaudiosrc", "!", "audioconvert", "!", "audioresample", "!",
+		fmt.Sprintf("audio/x-raw,format=S16LE,rate=%d,channels=%d,layout=interleaved", intercomRate, intercomChannels),
+		"!", "fdsink", "fd=1", "sync=false")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		ic.mu.Unlock()
+		a.logf("intercom capture error: %v", err)
+		return
+	}
+	if err := cmd.Start(); err != nil {
+		ic.mu.Unlock()
+		a.reportError("intercom capture (is gst-launch-1.0 installed?)", err, nil)
+		return
+	}
+	streamID := "talk-" + randomHex(6)
+	ic.capture = cmd
+	ic.streamID = streamID
+	ic.mu.Unlock()
+
+	format := &intercomFormat{Encoding: "s16le", Rate: intercomRate, Channels: intercomChannels}
+	a.sendAudioChunk(audioStreamChunk{StreamID: streamID, Seq: 0, Phase: "start", Format: format})
+	a.logf("intercom: talking (%s)", streamID)
+
+	seq := 1
+	buf := make([]byte, intercomChunk)
+	for {
+		n, err := io.ReadFull(stdout, buf)
+		if n > 0 {
+			a.sendAudioChunk(audioStreamChunk{
+				StreamID: streamID,
+				Seq:      seq,
+				Phase:    "data",
+				Base64:   base64.StdEncoding.EncodeToString(buf[:n]),
+			})
+			seq++
+		}
+		if err != nil {
+			break
+		}
+	}
+	_ = cmd.Wait()
+	a.sendAudioChunk(audioStreamChunk{StreamID: streamID, Seq: seq, Phase: "end"})
+	a.logf("intercom: stopped after %s", formatSeconds(float64(seq-1)/10))
+}
+
+func (a *app) stopTalking() {
+	ic := &a.intercom
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	ic.talking = false
+	if ic.capture == nil {
+		return
+	}
+	if ic.capture.Process != nil {
+		// closing the pipeline ends the read loop in startTalking, which
+		// then sends the end marker
+		_ = ic.capture.Process.Kill()
+	}
+	ic.capture = nil
+	ic.streamID = ""
+}
+
+func (a *app) sendAudioChunk(chunk audioStreamChunk) {
+	payload := map[string]any{
+		"streamId": chunk.StreamID,
+		"seq":      chunk.Seq,
+		"phase":    chunk.Phase,
+	}
+	if chunk.Format != nil {
+		payload["format"] = chunk.Format
+	}
+	if chunk.Base64 != "" {
+		payload["base64"] = chunk.Base64
+	}
+	sock := a.currentSocket()
+	if sock == nil {
+		return
+	}
+	// chunks are fire-and-forget: waiting for a round trip per 100ms of
+	// audio would stall capture
+	if err := sock.Send("audio-stream", payload); err != nil {
+		a.logf("intercom send error: %v", err)
+	}
+}
+
+func (a *app) handleAudioStream(payload json.RawMessage) {
+	var chunk audioStreamChunk
+	if err := json.Unmarshal(payload, &chunk); err != nil {
+		a.logf("audio-stream parse error: %v", err)
+		return
+	}
+	if chunk.Self || chunk.StreamID == "" {
+		return
+	}
+	ic := &a.intercom
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	if ic.playbacks == nil {
+		ic.playbacks = make(map[string]*intercomPlayback)
+	}
+	a.pruneIntercomStreams()
+	pb := ic.playbacks[chunk.StreamID]
+	if pb == nil {
+		pb = &intercomPlayback{pending: make(map[int]audioStreamChunk), created: time.Now()}
+		ic.playbacks[chunk.StreamID] = pb
+	}
+	if chunk.Phase == "start" {
+		if pb.cmd != nil {
+			return
+		}
+		format := chunk.Format
+		if format == nil {
+			format = &intercomFormat{Encoding: "s16le", Rate: intercomRate, Channels: intercomChannels}
+		}
+		cmd, stdin, err := startIntercomPlayback(format)
+		if err != nil {
+			delete(ic.playbacks, chunk.StreamID)
+			a.logf("intercom playback error: %v", err)
+			return
+		}
+		pb.cmd, pb.stdin = cmd, stdin
+		pb.from = chunk.From
+		pb.nextSeq = chunk.Seq + 1
+		for seq := range pb.pending {
+			if seq < pb.nextSeq {
+				delete(pb.pending, seq)
+			}
+		}
+		a.logf("intercom: %s is talking", labelOrUnknown(chunk.From))
+	} else {
+		if pb.cmd != nil && chunk.Seq < pb.nextSeq {
+			return
+		}
+		pb.pending[chunk.Seq] = chunk
+		if pb.cmd == nil {
+			// buffered until start arrives
+			return
+		}
+	}
+	a.drainIntercomStream(chunk.StreamID, pb)
+}
+
+// drainIntercomStream plays buffered chunks in sequence order, skipping a
+// gap once the reorder window is full. Callers hold ic.mu.
+func (a *app) drainIntercomStream(streamID string, pb *intercomPlayback) {
+	ic := &a.intercom
+	for len(pb.pending) > 0 {
+		chunk, ok := pb.pending[pb.nextSeq]
+		if !ok {
+			if len(pb.pending) < intercomReorderWindow {
+				return
+			}
+			next := -1
+			for seq := range pb.pending {
+				if next < 0 || seq < next {
+					next = seq
+				}
+			}
+			a.logf("intercom: %d chunks lost from %s", next-pb.nextSeq, labelOrUnknown(pb.from))
+			pb.nextSeq = next
+			continue
+		}
+		delete(pb.pending, pb.nextSeq)
+		pb.nextSeq++
+		switch chunk.Phase {
+		case "data":
+			data, err := base64.StdEncoding.DecodeString(chunk.Base64)
+			if err != nil {
+				continue
+			}
+			if _, err := pb.stdin.Write(data); err != nil {
+				a.logf("intercom playback write error: %v", err)
+				pb.close()
+				delete(ic.playbacks, streamID)
+				return
+			}
+		case "end":
+			pb.close()
+			delete(ic.playbacks, streamID)
+			a.logf("intercom: %s stopped talking", labelOrUnknown(pb.from))
+			return
+		}
+	}
+}
+
+// pruneIntercomStreams drops buffered streams whose start never arrived.
+// Callers hold ic.mu.
+func (a *app) pruneIntercomStreams() {
+	for id, pb := range a.intercom.playbacks {
+		if pb.cmd == nil && time.Since(pb.created) > intercomStartWait {
+			delete(a.intercom.playbacks, id)
+		}
+	}
+}
+
+func startIntercomPlayback(format *intercomFormat) (*exec.Cmd, io.WriteCloser, error) {
+	if format.Encoding != "s16le" {
+		return nil, nil, fmt.Errorf("unsupported intercom encoding %q", format.Encoding)
+	}
+	cmd := exec.Command("gst-launch-1.0", "-q",
+		"fdsrc", "fd=0", "!",
+		"rawaudioparse", "use-sink-caps=false", "format=pcm", "pcm-format=s16le",
+		"sample-rate="+strconv.Itoa(format.Rate), "num-channels="+strconv.Itoa(format.Channels), "!",
+		"audioconvert", "!", "audioresample", "!", "autoaudiosink", "sync=false")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, nil, err
+	}
+	return cmd, stdin, nil
+}
+
+func (pb *intercomPlayback) close() {
+	if pb.cmd == nil {
+		return
+	}
+	_ = pb.stdin.Close()
+	go func() {
+		done := make(chan struct{})
+		go func() {
+			_ = pb.cmd.Wait()
+			close(done)
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			_ = pb.cmd.Process.Kill()
+		}
+	}()
+}
+
+// closeIntercom tears down capture and any live playback pipelines.
+func (a *app) closeIntercom() {
+	a.stopTalking()
+	ic := &a.intercom
+	ic.mu.Lock()
+	defer ic.mu.Unlock()
+	for id, pb := range ic.playbacks {
+		pb.close()
+		delete(ic.playbacks, id)
+	}
+}
+
+func labelOrUnknown(label string) string {
+	if label == "" {
+		return "unknown"
+	}
+	return label
+}
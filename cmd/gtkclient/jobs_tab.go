@@ -0,0 +1,245 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// jobsRefresh is how often the Jobs tab reloads while it is in front.
+const jobsRefresh = 2 * time.Second
+
+const (
+	jobsColKind = iota
+	jobsColTitle
+	jobsColState
+	jobsColPriority
+	jobsColProgress
+	jobsColAge
+	jobsColID
+	jobsColCreated
+)
+
+// jobsPanel is the Jobs tab: the hub's pending and running work, with
+// cancel and reprioritise. All fields are owned by the GTK main loop.
+type jobsPanel struct {
+	host    *panelHost
+	store   *gtk.ListStore
+	view    *gtk.TreeView
+	summary *gtk.Label
+	actions *gtk.Box
+	jobs    map[string]hubclient.Job
+	// polling is set while a refresh timer runs
+	polling bool
+}
+
+func init() { registerPanel(10, &jobsPanel{}) }
+
+func (p *jobsPanel) Title() string { return tr("Jobs") }
+
+func (p *jobsPanel) Build(host *panelHost) gtk.IWidget {
+	p.host = host
+	p.jobs = make(map[string]hubclient.Job)
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+
+	bar, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	box.PackStart(bar, false, false, 0)
+	refreshBtn, _ := gtk.ButtonNewWithLabel(tr("Refresh"))
+	setAccessible(refreshBtn, tr("Refresh the job list"), "")
+	refreshBtn.Connect("clicked", func() { go p.fetch(p.host.Client()) })
+	bar.PackStart(refreshBtn, false, false, 0)
+	p.actions, _ = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	host.GateOnRole("job-cancel", p.actions)
+	bar.PackStart(p.actions, false, false, 0)
+	cancelBtn, _ := gtk.ButtonNewWithLabel(tr("Cancel Job"))
+	cancelBtn.Connect("clicked", func() {
+		if job, ok := p.selected(); ok {
+			go p.cancel(job)
+		}
+	})
+	p.actions.PackStart(cancelBtn, false, false, 0)
+	upBtn, _ := gtk.ButtonNewWithLabel(tr("Raise Priority"))
+	upBtn.Connect("clicked", func() {
+		if job, ok := p.selected(); ok {
+			go p.setPriority(job, job.Priority+1)
+		}
+	})
+	p.actions.PackStart(upBtn, false, false, 0)
+	downBtn, _ := gtk.ButtonNewWithLabel(tr("Lower Priority"))
+	downBtn.Connect("clicked", func() {
+		if job, ok := p.selected(); ok {
+			go p.setPriority(job, job.Priority-1)
+		}
+	})
+	p.actions.PackStart(downBtn, false, false, 0)
+	p.summary, _ = gtk.LabelNew("")
+	bar.PackEnd(p.summary, false, false, 0)
+
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	scroll.SetVExpand(true)
+	box.PackStart(scroll, true, true, 0)
+	p.store, _ = gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_INT,
+		glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
+	p.view, _ = gtk.TreeViewNewWithModel(p.store)
+	p.view.SetSearchColumn(jobsColTitle)
+	setAccessible(p.view, tr("Hub jobs"), tr("Select a job to cancel it or change its priority"))
+	for _, col := range []struct {
+		title       string
+		shown, sort int
+		expand      bool
+	}{
+		{tr("Kind"), jobsColKind, jobsColKind, false},
+		{tr("Job"), jobsColTitle, jobsColTitle, true},
+		{tr("State"), jobsColState, jobsColState, false},
+		{tr("Priority"), jobsColPriority, jobsColPriority, false},
+		{tr("Progress"), jobsColProgress, jobsColProgress, false},
+		{tr("Age"), jobsColAge, jobsColCreated, false},
+	} {
+		renderer, _ := gtk.CellRendererTextNew()
+		column, err := gtk.TreeViewColumnNewWithAttribute(col.title, renderer, "text", col.shown)
+		if err != nil {
+			continue
+		}
+		column.SetResizable(true)
+		column.SetExpand(col.expand)
+		column.SetSortColumnID(col.sort)
+		p.view.AppendColumn(column)
+	}
+	scroll.Add(p.view)
+	return box
+}
+
+func (p *jobsPanel) Connected(client *hubclient.Client) {
+	if !client.Supports(protocol.CapJobs) {
+		p.store.Clear()
+		p.summary.SetText(tr("This hub does not list its jobs"))
+		return
+	}
+	go p.fetch(client)
+}
+
+func (p *jobsPanel) Disconnected(error) {
+	p.store.Clear()
+	p.jobs = make(map[string]hubclient.Job)
+	p.summary.SetText(tr("Not connected"))
+}
+
+// Event reloads when a started command ends, as it leaves the queue.
+func (p *jobsPanel) Event(msg hubclient.Message) {
+	if msg.Event == protocol.EventCommandDone && p.host.Showing(p) {
+		go p.fetch(p.host.Client())
+	}
+}
+
+// Shown reloads, and keeps reloading while the tab stays in front.
+func (p *jobsPanel) Shown() {
+	go p.fetch(p.host.Client())
+	if p.polling {
+		return
+	}
+	p.polling = true
+	glib.TimeoutAdd(uint(jobsRefresh/time.Millisecond), func() bool {
+		if !p.host.Showing(p) {
+			p.polling = false
+			return false
+		}
+		go p.fetch(p.host.Client())
+		return true
+	})
+}
+
+func (p *jobsPanel) fetch(client *hubclient.Client) {
+	if !client.Supports(protocol.CapJobs) {
+		return
+	}
+	jobs, err := client.Jobs(p.host.Context())
+	if err != nil {
+		p.host.ReportError("jobs", err, func() { p.fetch(p.host.Client()) })
+		return
+	}
+	glib.IdleAdd(func() bool {
+		p.show(jobs)
+		return false
+	})
+}
+
+// show fills the table, keeping the selected job selected.
+func (p *jobsPanel) show(jobs []hubclient.Job) {
+	keep, _ := p.selected()
+	p.store.Clear()
+	p.jobs = make(map[string]hubclient.Job, len(jobs))
+	pending := 0
+	for _, job := range jobs {
+		p.jobs[job.ID] = job
+		if job.State == "pending" {
+			pending++
+		}
+		progress := ""
+		if job.Progress > 0 {
+			progress = fmt.Sprintf("%.0f%%", job.Progress*100)
+		}
+		age := ""
+		if t, err := time.Parse(time.RFC3339, job.CreatedAt); err == nil {
+			age = time.Since(t).Round(time.Second).String()
+		}
+		iter := p.store.Append()
+		p.store.Set(iter,
+			[]int{jobsColKind, jobsColTitle, jobsColState, jobsColPriority, jobsColProgress, jobsColAge, jobsColID, jobsColCreated},
+			[]interface{}{job.Kind, job.Title, job.State, job.Priority, progress, age, job.ID, job.CreatedAt})
+		if job.ID == keep.ID {
+			if sel, err := p.view.GetSelection(); err == nil {
+				sel.SelectIter(iter)
+			}
+		}
+	}
+	p.summary.SetText(fmt.Sprintf(tr("%d jobs, %d waiting"), len(jobs), pending))
+}
+
+func (p *jobsPanel) selected() (hubclient.Job, bool) {
+	sel, err := p.view.GetSelection()
+	if err != nil {
+		return hubclient.Job{}, false
+	}
+	model, iter, ok := sel.GetSelected()
+	if !ok {
+		return hubclient.Job{}, false
+	}
+	v, err := model.ToTreeModel().GetValue(iter, jobsColID)
+	if err != nil {
+		return hubclient.Job{}, false
+	}
+	id, _ := v.GetString()
+	job, ok := p.jobs[id]
+	return job, ok
+}
+
+func (p *jobsPanel) cancel(job hubclient.Job) {
+	client := p.host.Client()
+	cancelled, err := client.CancelJob(p.host.Context(), job.ID)
+	if err != nil {
+		p.host.ReportError("cancel job", err, func() { p.cancel(job) })
+		return
+	}
+	if cancelled {
+		p.host.Logf("job cancelled: %s", job.Title)
+	} else {
+		p.host.Logf("job already finished: %s", job.Title)
+	}
+	p.fetch(client)
+}
+
+func (p *jobsPanel) setPriority(job hubclient.Job, priority int) {
+	client := p.host.Client()
+	if _, err := client.SetJobPriority(p.host.Context(), job.ID, priority); err != nil {
+		p.host.ReportError("job priority", err, nil)
+		return
+	}
+	p.host.Logf("job %s priority %d", job.Title, priority)
+	p.fetch(client)
+}
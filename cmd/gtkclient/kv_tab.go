@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	kvColKey = iota
+	kvColValue
+	kvColBy
+	kvColUpdated
+	kvColExpires
+)
+
+// kvView is the "Shared State" tab: the hub's key-value state, kept
+// current by kv events. All fields are owned by the GTK main loop.
+type kvView struct {
+	store     *gtk.ListStore
+	selection *gtk.TreeSelection
+	search    *gtk.SearchEntry
+	key       *gtk.Entry
+	value     *gtk.Entry
+	ttl       *gtk.SpinButton
+	summary   *gtk.Label
+	entries   map[string]hubclient.KVEntry
+}
+
+func (a *app) buildKVTab() gtk.IWidget {
+	v := &kvView{entries: make(map[string]hubclient.KVEntry)}
+	a.kv = v
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+
+	bar, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	box.PackStart(bar, false, false, 0)
+	refreshBtn, _ := gtk.ButtonNewWithLabel(tr("Refresh"))
+	setAccessible(refreshBtn, tr("Reload the shared state"), "")
+	refreshBtn.Connect("clicked", func() { go a.watchKV() })
+	bar.PackStart(refreshBtn, false, false, 0)
+	v.search, _ = gtk.SearchEntryNew()
+	v.search.SetPlaceholderText(tr("Filter by key or value"))
+	v.search.Connect("search-changed", func() { a.showKV() })
+	bar.PackStart(v.search, true, true, 0)
+	v.summary, _ = gtk.LabelNew("")
+	bar.PackEnd(v.summary, false, false, 0)
+
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	scroll.SetVExpand(true)
+	box.PackStart(scroll, true, true, 0)
+	v.store, _ = gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
+	view, _ := gtk.TreeViewNewWithModel(v.store)
+	view.SetSearchColumn(kvColKey)
+	setAccessible(view, tr("Shared key-value state"), "")
+	for _, col := range []struct {
+		title  string
+		index  int
+		expand bool
+	}{
+		{tr("Key"), kvColKey, false},
+		{tr("Value"), kvColValue, true},
+		{tr("Set by"), kvColBy, false},
+		{tr("Updated"), kvColUpdated, false},
+		{tr("Expires"), kvColExpires, false},
+	} {
+		renderer, _ := gtk.CellRendererTextNew()
+		column, err := gtk.TreeViewColumnNewWithAttribute(col.title, renderer, "text", col.index)
+		if err != nil {
+			continue
+		}
+		column.SetResizable(true)
+		column.SetExpand(col.expand)
+		column.SetSortColumnID(col.index)
+		view.AppendColumn(column)
+	}
+	scroll.Add(view)
+	v.selection, _ = view.GetSelection()
+	v.selection.Connect("changed", func() {
+		if e, ok := v.entries[v.selected()]; ok {
+			v.key.SetText(e.Key)
+			v.value.SetText(e.Value)
+		}
+	})
+
+	edit, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	box.PackStart(edit, false, false, 0)
+	a.gateOnRole("kv-set", edit)
+	v.key, _ = gtk.EntryNew()
+	v.key.SetPlaceholderText(tr("house/mode"))
+	edit.PackStart(mnemonicLabel(tr("_Key:"), v.key), false, false, 0)
+	edit.PackStart(v.key, false, false, 0)
+	v.value, _ = gtk.EntryNew()
+	edit.PackStart(mnemonicLabel(tr("_Value:"), v.value), false, false, 0)
+	edit.PackStart(v.value, true, true, 0)
+	v.ttl, _ = gtk.SpinButtonNewWithRange(0, 7*24*3600, 60)
+	v.ttl.SetTooltipText(tr("Seconds until the key expires; 0 keeps it"))
+	edit.PackStart(mnemonicLabel(tr("_TTL:"), v.ttl), false, false, 0)
+	edit.PackStart(v.ttl, false, false, 0)
+	setBtn, _ := gtk.ButtonNewWithLabel(tr("Set"))
+	setBtn.Connect("clicked", func() {
+		key, _ := v.key.GetText()
+		value, _ := v.value.GetText()
+		ttl := time.Duration(v.ttl.GetValueAsInt()) * time.Second
+		if key = strings.TrimSpace(key); key != "" {
+			go a.setKV(key, value, ttl)
+		}
+	})
+	v.value.Connect("activate", func() { setBtn.Clicked() })
+	edit.PackEnd(setBtn, false, false, 0)
+	deleteBtn, _ := gtk.ButtonNewWithLabel(tr("Delete"))
+	deleteBtn.SetTooltipText(tr("Delete the selected key for every client"))
+	deleteBtn.Connect("clicked", func() {
+		if key := v.selected(); key != "" {
+			go a.deleteKV(key)
+		}
+	})
+	edit.PackEnd(deleteBtn, false, false, 0)
+	return box
+}
+
+func (v *kvView) selected() string {
+	_, iter, ok := v.selection.GetSelected()
+	if !ok {
+		return ""
+	}
+	val, err := v.store.GetValue(iter, kvColKey)
+	if err != nil {
+		return ""
+	}
+	key, _ := val.GetString()
+	return key
+}
+
+// watchKV loads every key and has the hub report changes for the life of
+// the socket.
+func (a *app) watchKV() {
+	hub := a.currentSocket()
+	if !hub.Supports(protocol.CapKV) {
+		return
+	}
+	entries, err := hub.KVWatch(a.ctx, "")
+	if err != nil {
+		a.reportError("shared state", err, a.watchKV)
+		return
+	}
+	glib.IdleAdd(func() bool {
+		if v := a.kv; v != nil {
+			v.entries = make(map[string]hubclient.KVEntry, len(entries))
+			for _, e := range entries {
+				v.entries[e.Key] = e
+			}
+			a.showKV()
+		}
+		return false
+	})
+}
+
+func (a *app) setKV(key, value string, ttl time.Duration) {
+	if _, err := a.currentSocket().KVSet(a.ctx, key, value, ttl); err != nil {
+		a.reportError("set "+key, err, func() { a.setKV(key, value, ttl) })
+		return
+	}
+	a.logf("shared state: %s = %q", key, value)
+}
+
+func (a *app) deleteKV(key string) {
+	if err := a.currentSocket().KVDelete(a.ctx, key); err != nil {
+		a.reportError("delete "+key, err, func() { a.deleteKV(key) })
+		return
+	}
+	a.logf("shared state: %s deleted", key)
+}
+
+// handleKVEvent applies a change to a watched key.
+func (a *app) handleKVEvent(payload json.RawMessage) {
+	var e hubclient.KVEntry
+	if err := json.Unmarshal(payload, &e); err != nil {
+		a.logf("kv event parse error: %v", err)
+		return
+	}
+	glib.IdleAdd(func() bool {
+		v := a.kv
+		if v == nil {
+			return false
+		}
+		if e.Deleted {
+			delete(v.entries, e.Key)
+		} else {
+			v.entries[e.Key] = e
+		}
+		a.showKV()
+		return false
+	})
+}
+
+// showKV fills the table with the keys that match the filter, sorted.
+// Must run on the GTK main loop.
+func (a *app) showKV() {
+	v := a.kv
+	if v == nil {
+		return
+	}
+	query, _ := v.search.GetText()
+	query = strings.ToLower(strings.TrimSpace(query))
+	keys := make([]string, 0, len(v.entries))
+	now := time.Now()
+	for key, e := range v.entries {
+		if t, err := time.Parse(time.RFC3339Nano, e.ExpiresAt); err == nil && !now.Before(t) {
+			delete(v.entries, key)
+			continue
+		}
+		if query == "" || strings.Contains(strings.ToLower(key+" "+e.Value), query) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	v.store.Clear()
+	for _, key := range keys {
+		e := v.entries[key]
+		v.store.Set(v.store.Append(),
+			[]int{kvColKey, kvColValue, kvColBy, kvColUpdated, kvColExpires},
+			[]interface{}{e.Key, e.Value, a.auditActor(e.By), localTime(e.UpdatedAt), localTime(e.ExpiresAt)})
+	}
+	v.summary.SetText(fmt.Sprintf(tr("%d of %d keys"), len(keys), len(v.entries)))
+}
+
+// localTime shows an RFC 3339 time in the local zone, or raw as it came.
+func localTime(raw string) string {
+	if t, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return t.Local().Format("2006-01-02 15:04:05")
+	}
+	return raw
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os/exec"
+	"time"
+)
+
+const (
+	loudnessRate    = 48000
+	loudnessTimeout = 2 * time.Minute
+	// loudness is measured over 400 ms blocks overlapping by 75%, built
+	// from 100 ms steps
+	loudnessStep  = loudnessRate / 10
+	loudnessBlock = 4
+)
+
+// kWeighting holds the two BS.1770 biquads at 48 kHz: a high shelf for
+// the head, then a high-pass.
+var kWeighting = [2]biquad{
+	{b0: 1.53512485958697, b1: -2.69169618940638, b2: 1.19839281085285, a1: -1.69065929318241, a2: 0.73248077421585},
+	{b0: 1.0, b1: -2.0, b2: 1.0, a1: -1.99004745483398, a2: 0.99007225036621},
+}
+
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) filter(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// measureLoudness decodes path to stereo PCM with GStreamer and returns
+// its integrated loudness in LUFS, per EBU R128. Mono files are measured
+// as played, on both speakers.
+func measureLoudness(ctx context.Context, path string) (float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, loudnessTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "gst-launch-1.0", "-q",
+		"filesrc", "location="+path, "!", "decodebin", "!", "audioconvert", "!", "audioresample", "!",
+		fmt.Sprintf("audio/x-raw,format=S16LE,rate=%d,channels=2", loudnessRate),
+		"!", "fdsink", "fd=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return 0, err
+	}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	steps, readErr := readLoudnessSteps(stdout, 2)
+	if err := cmd.Wait(); err != nil {
+		return 0, err
+	}
+	if readErr != nil {
+		return 0, readErr
+	}
+	return integratedLoudness(steps)
+}
+
+// readLoudnessSteps reads interleaved S16LE frames of channels samples,
+// K-weights them and returns the summed mean square of each 100 ms step.
+func readLoudnessSteps(r io.Reader, channels int) ([]float64, error) {
+	filters := make([][2]biquad, channels)
+	for i := range filters {
+		filters[i] = kWeighting
+	}
+	var steps []float64
+	sum, frames, ch := 0.0, 0, 0
+	buf := make([]byte, 8192)
+	for {
+		n, err := io.ReadFull(r, buf)
+		for i := 0; i+1 < n; i += 2 {
+			v := float64(int16(binary.LittleEndian.Uint16(buf[i:]))) / 32768
+			f := &filters[ch]
+			v = f[1].filter(f[0].filter(v))
+			sum += v * v
+			if ch++; ch < channels {
+				continue
+			}
+			ch = 0
+			if frames++; frames == loudnessStep {
+				steps = append(steps, sum/loudnessStep)
+				sum, frames = 0, 0
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return steps, nil
+}
+
+// integratedLoudness gates the 400 ms blocks made of steps: blocks under
+// -70 LUFS are dropped, then those 10 LU under the loudness of the rest.
+func integratedLoudness(steps []float64) (float64, error) {
+	if len(steps) < loudnessBlock {
+		return 0, fmt.Errorf("under %d ms of audio decoded", loudnessBlock*100)
+	}
+	lufs := func(power float64) float64 { return -0.691 + 10*math.Log10(power) }
+	var blocks []float64
+	for i := 0; i+loudnessBlock <= len(steps); i++ {
+		power := 0.0
+		for _, s := range steps[i : i+loudnessBlock] {
+			power += s
+		}
+		if power /= loudnessBlock; power > 0 && lufs(power) > -70 {
+			blocks = append(blocks, power)
+		}
+	}
+	mean := func(threshold float64) (float64, int) {
+		total, n := 0.0, 0
+		for _, p := range blocks {
+			if lufs(p) > threshold {
+				total += p
+				n++
+			}
+		}
+		if n == 0 {
+			return 0, 0
+		}
+		return total / float64(n), n
+	}
+	ungated, n := mean(-70)
+	if n == 0 {
+		return 0, fmt.Errorf("only silence decoded")
+	}
+	gated, _ := mean(lufs(ungated) - 10)
+	return lufs(gated), nil
+}
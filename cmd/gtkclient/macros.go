@@ -0,0 +1,292 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// commandMacro is a saved hub command whose {placeholders} are asked for
+// each time it runs.
+type commandMacro struct {
+	Command string `json:"command"`
+	// Button also shows the macro under the command entry; every macro
+	// is in the command palette.
+	Button bool `json:"button,omitempty"`
+}
+
+// macroParam matches a placeholder; JSON objects such as {"volume": 0}
+// are left alone because a quote follows their brace.
+var macroParam = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_-]*)\}`)
+
+// macroParams lists the placeholders in command, first use first.
+func macroParams(command string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range macroParam.FindAllStringSubmatch(command, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// fillMacro replaces each placeholder with its value.
+func fillMacro(command string, values map[string]string) string {
+	return macroParam.ReplaceAllStringFunc(command, func(m string) string {
+		return values[m[1:len(m)-1]]
+	})
+}
+
+func (a *app) macroNames() []string {
+	names := make([]string, 0, len(a.profile().Macros))
+	for name := range a.profile().Macros {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (a *app) macroShortcuts() []shortcut {
+	var list []shortcut
+	for _, name := range a.macroNames() {
+		name := name
+		list = append(list, shortcut{
+			action: "macro:" + name,
+			title:  fmt.Sprintf(tr("Run macro %s — %s"), name, a.profile().Macros[name].Command),
+			group:  tr("Macros"),
+			run:    func(a *app) { a.runMacro(name) },
+		})
+	}
+	return list
+}
+
+// runMacro sends the named macro, first asking for its parameters. Must
+// run on the GTK main loop.
+func (a *app) runMacro(name string) {
+	m := a.profile().Macros[name]
+	if m == nil {
+		return
+	}
+	params := macroParams(m.Command)
+	if len(params) == 0 {
+		a.logf("macro %s: %s", name, m.Command)
+		go a.execCommand(m.Command)
+		return
+	}
+	values, ok := a.askMacroParams(name, m.Command, params)
+	if !ok {
+		return
+	}
+	command := fillMacro(m.Command, values)
+	a.logf("macro %s: %s", name, command)
+	go a.execCommand(command)
+}
+
+// askMacroParams prompts for each parameter, offering the values used
+// last time.
+func (a *app) askMacroParams(name, command string, params []string) (map[string]string, bool) {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		a.logf("macro dialog error: %v", err)
+		return nil, false
+	}
+	defer dialog.Destroy()
+	dialog.SetTitle(fmt.Sprintf(tr("Run %s"), name))
+	dialog.SetTransientFor(a.win)
+	dialog.SetModal(true)
+	dialog.AddButton(tr("Cancel"), gtk.RESPONSE_CANCEL)
+	dialog.AddButton(tr("Send"), gtk.RESPONSE_ACCEPT)
+	dialog.SetDefaultResponse(gtk.RESPONSE_ACCEPT)
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.SetBorderWidth(12)
+	template, _ := gtk.LabelNew(command)
+	template.SetSelectable(true)
+	template.SetXAlign(0)
+	addStyleClass(template, "dim-label")
+	content.PackStart(template, false, false, 0)
+	grid, _ := gtk.GridNew()
+	grid.SetRowSpacing(6)
+	grid.SetColumnSpacing(8)
+	content.PackStart(grid, false, false, 0)
+	if a.macroValues == nil {
+		a.macroValues = make(map[string]map[string]string)
+	}
+	last := a.macroValues[name]
+	entries := make([]*gtk.Entry, len(params))
+	for i, param := range params {
+		entry, _ := gtk.EntryNew()
+		entry.SetText(last[param])
+		entry.SetHExpand(true)
+		entry.SetActivatesDefault(true)
+		entries[i] = entry
+		label, _ := gtk.LabelNew(param + ":")
+		label.SetXAlign(1)
+		label.SetMnemonicWidget(entry)
+		grid.Attach(label, 0, i, 1, 1)
+		grid.Attach(entry, 1, i, 1, 1)
+	}
+	dialog.ShowAll()
+	if dialog.Run() != gtk.RESPONSE_ACCEPT {
+		return nil, false
+	}
+	values := make(map[string]string, len(params))
+	for i, param := range params {
+		values[param], _ = entries[i].GetText()
+	}
+	a.macroValues[name] = values
+	return values, true
+}
+
+// refreshMacroButtons shows a button for each macro marked for one. Must
+// run on the GTK main loop.
+func (a *app) refreshMacroButtons() {
+	if a.macroBox == nil {
+		return
+	}
+	if children := a.macroBox.GetChildren(); children != nil {
+		children.Foreach(func(item interface{}) {
+			if w, ok := item.(*gtk.Widget); ok {
+				w.Destroy()
+			}
+		})
+	}
+	shown := false
+	for _, name := range a.macroNames() {
+		name := name
+		m := a.profile().Macros[name]
+		if !m.Button {
+			continue
+		}
+		btn, err := gtk.ButtonNewWithLabel(name)
+		if err != nil {
+			continue
+		}
+		btn.SetTooltipText(m.Command)
+		btn.Connect("clicked", func() { a.runMacro(name) })
+		a.macroBox.PackStart(btn, false, false, 0)
+		btn.Show()
+		shown = true
+	}
+	a.macroBox.SetVisible(shown)
+}
+
+// showMacros edits the current profile's command macros, starting from
+// the command entry's text.
+func (a *app) showMacros() {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		a.logf("macros dialog error: %v", err)
+		return
+	}
+	dialog.SetTitle(tr("Command Macros"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetDefaultSize(480, -1)
+	dialog.AddButton(tr("Close"), gtk.RESPONSE_CLOSE)
+	dialog.Connect("response", func() { dialog.Destroy() })
+
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.SetBorderWidth(8)
+
+	pickBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	content.PackStart(pickBox, false, false, 0)
+	combo, _ := gtk.ComboBoxTextNew()
+	setAccessible(combo, tr("Saved macros"), "")
+	pickBox.PackStart(combo, true, true, 0)
+	deleteBtn, _ := gtk.ButtonNewWithLabel(tr("Delete"))
+	pickBox.PackStart(deleteBtn, false, false, 0)
+
+	grid, _ := gtk.GridNew()
+	grid.SetRowSpacing(6)
+	grid.SetColumnSpacing(8)
+	content.PackStart(grid, false, false, 0)
+	nameEntry, _ := gtk.EntryNew()
+	nameEntry.SetPlaceholderText(tr("macro name, e.g. tag file"))
+	nameEntry.SetHExpand(true)
+	commandEntry, _ := gtk.EntryNew()
+	commandEntry.SetPlaceholderText(tr("e.g. put {key} {value} 3600"))
+	commandEntry.SetHExpand(true)
+	if text, _ := a.commandEntry.GetText(); text != "" {
+		commandEntry.SetText(strings.TrimSpace(text))
+	}
+	buttonCheck, _ := gtk.CheckButtonNewWithMnemonic(tr("Show as a _button"))
+	grid.Attach(mnemonicLabel(tr("_Name:"), nameEntry), 0, 0, 1, 1)
+	grid.Attach(nameEntry, 1, 0, 1, 1)
+	grid.Attach(mnemonicLabel(tr("C_ommand:"), commandEntry), 0, 1, 1, 1)
+	grid.Attach(commandEntry, 1, 1, 1, 1)
+	grid.Attach(buttonCheck, 1, 2, 1, 1)
+	hint, _ := gtk.LabelNew(tr("Words in braces, like {file}, are asked for each time the macro runs."))
+	hint.SetLineWrap(true)
+	hint.SetXAlign(0)
+	addStyleClass(hint, "dim-label")
+	content.PackStart(hint, false, false, 0)
+
+	saveBtn, _ := gtk.ButtonNewWithLabel(tr("Save Macro"))
+	content.PackStart(saveBtn, false, false, 0)
+
+	refresh := func(active string) {
+		combo.RemoveAll()
+		for _, name := range a.macroNames() {
+			combo.Append(name, name)
+		}
+		if active != "" {
+			combo.SetActiveID(active)
+		}
+	}
+	save := func() {
+		if err := a.config.save(); err != nil {
+			a.logf("config save error: %v", err)
+		}
+		a.refreshMacroButtons()
+	}
+	combo.Connect("changed", func() {
+		name := combo.GetActiveID()
+		m := a.profile().Macros[name]
+		if m == nil {
+			return
+		}
+		nameEntry.SetText(name)
+		commandEntry.SetText(m.Command)
+		buttonCheck.SetActive(m.Button)
+	})
+	saveBtn.Connect("clicked", func() {
+		name, _ := nameEntry.GetText()
+		name = strings.TrimSpace(name)
+		command, _ := commandEntry.GetText()
+		command = strings.TrimSpace(command)
+		if name == "" || command == "" {
+			a.reportError("save macro", fmt.Errorf("name and command are required"), nil)
+			return
+		}
+		macro := &commandMacro{Command: command, Button: buttonCheck.GetActive()}
+		a.updateProfile(func(p *profileConfig) {
+			if p.Macros == nil {
+				p.Macros = make(map[string]*commandMacro)
+			}
+			p.Macros[name] = macro
+		})
+		save()
+		a.logf("macro %s saved: %s", name, command)
+		refresh(name)
+	})
+	deleteBtn.Connect("clicked", func() {
+		name := combo.GetActiveID()
+		if name == "" {
+			return
+		}
+		a.updateProfile(func(p *profileConfig) { delete(p.Macros, name) })
+		delete(a.macroValues, name)
+		save()
+		a.logf("macro %s deleted", name)
+		refresh("")
+	})
+
+	refresh("")
+	dialog.ShowAll()
+}
@@ -1,82 +1,300 @@
 package main
 
 import (
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"fmt"
-	"net"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"brain/internal/audiolist"
+	"brain/internal/automation"
+	"brain/internal/hubclient"
+	"brain/internal/metrics"
+	"brain/internal/mqtt"
+	"brain/internal/protocol"
+	"brain/internal/syncdir"
+
 	"github.com/gotk3/gotk3/glib"
 	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
 )
 
 const (
-	defaultControlURL  = "http://127.0.0.1:4455"
-	defaultControlPort = 4455
-	requestTimeout     = 6 * time.Second
-	logLimit           = 500
+	appID    = "org.brain.GtkClient"
+	logLimit = 500
 )
 
 type app struct {
-	controlURL *url.URL
+	ctx    context.Context
+	cancel context.CancelFunc
+	ops    operations
+
+	// active is the selected profile and its hub, swapped as a whole so
+	// goroutines never see one profile's name with another's settings.
+	// Read it through profile, profileName and controlURL.
+	active     atomic.Pointer[activeProfile]
+	config     *clientConfig
+	telemetry  *telemetry
+	metrics    *metrics.Registry
+	dashboard  *dashboardView
+	lastStatus atomic.Int64
+	// statusPoll is the poll interval as a time.Duration; 0 is off
+	statusPoll atomic.Int64
+
+	timeoutsMu sync.RWMutex
+	timeouts   map[string]float64
 
-	statusLabel *gtk.Label
+	gtkApp          *gtk.Application
+	win             *gtk.Window
+	headerBar       *gtk.HeaderBar
+	menuButton      *gtk.MenuButton
+	theme           themeState
+	statusLabel     *gtk.Label
+	nowPlayingLabel *gtk.Label
 
-	commandEntry    *gtk.Entry
-	playEntry       *gtk.Entry
-	broadcastEntry  *gtk.Entry
-	uploadNameEntry *gtk.Entry
+	commandEntry         *gtk.Entry
+	macroBox             *gtk.Box
+	playEntry            *gtk.Entry
+	broadcastEntry       *gtk.Entry
+	uploadNameEntry      *gtk.Entry
+	uploadTempCheck      *gtk.CheckButton
+	uploadTranscodeCheck *gtk.CheckButton
+	uploadFolderEntry    *gtk.Entry
+	uploadTempCombo      *gtk.ComboBoxText
+	directPeerEntry      *gtk.Entry
+	archiveCheck         *gtk.CheckButton
 
 	uploadFilePath string
+	uploads        *uploadStore
 
-	textBuffer *gtk.TextBuffer
-	textView   *gtk.TextView
+	volumeScale      *gtk.Scale
+	volumeTimer      *time.Timer
+	seekSpin         *gtk.SpinButton
+	playbackAllCheck *gtk.CheckButton
+	playbackBox      *gtk.Box
 
-	audioFlow        *gtk.FlowBox
-	audioButtons     []*gtk.Button
-	audioPlaceholder *gtk.Label
+	textBuffer   *gtk.TextBuffer
+	textView     *gtk.TextView
+	notebook     *gtk.Notebook
+	hubLogs      *hubLogView
+	protocolView *protocolView
+	filesView    *filesView
+	audit        *auditView
+	kv           *kvView
+	results      *resultsView
+	panels       []panel
+	panelTabs    map[panel]panelTab
+	identity     *identityView
 
-	socket *socketClient
-}
+	// scripts are the user's Starlark files; scriptRuns times recent
+	// handler runs. Both are owned by the GTK main loop.
+	scripts    []*automation.Script
+	scriptRuns []time.Time
+	// macroValues are the parameters each macro last ran with, by macro
+	// name; owned by the GTK main loop.
+	macroValues map[string]map[string]string
 
-type statusResponse struct {
-	Host      string      `json:"host"`
-	Connected bool        `json:"connected"`
-	Timestamp string      `json:"timestamp"`
-	Whoami    interface{} `json:"whoami"`
-	AudioList interface{} `json:"audioList"`
-}
+	audioFlow  *gtk.FlowBox
+	audioItems []*gtk.Box
+	// audioFolder is the prefix being browsed, without a trailing slash;
+	// its subfolders are expanders in audioFolderBox
+	audioFolder       string
+	audioFolderBox    *gtk.Box
+	audioFolderGroups []*gtk.Expander
+	openFolders       map[string]bool
+	breadcrumb        *gtk.Box
+	audioPlaceholder  *gtk.Label
+	// audioFiles is the last listing, kept to re-sort without asking the hub
+	audioFiles []audioFile
+	// audioFilter is the text typed into the audio filter entry
+	audioFilter string
+	// audioSelecting turns the grid's buttons into checkboxes for the
+	// files in audioSelected
+	audioSelecting bool
+	audioSelected  map[string]bool
+	audioBulk      *audioBulkBar
+	// soundboardTargets are the detailed actions given accelerators
+	soundboardTargets []string
 
-type filesResponse struct {
-	Files []string `json:"files"`
-}
+	peerList        *gtk.ListBox
+	peerRows        map[string]*peerRow
+	peerOrder       []string
+	peers           map[string]*peerInfo
+	nowPlaying      map[string]*nowPlaying
+	nowPlayingTimer glib.SourceHandle
+	// peerRestartBtn and peerUpdateBtn act on the selected peer
+	peerRestartBtn, peerUpdateBtn *gtk.Button
+	// peerBrowseBtn lists the selected peer's shared folder
+	peerBrowseBtn *gtk.Button
+	// peerControl is the last restart or update phase shown for each peer
+	peerControl map[string]string
 
-type commandResponse struct {
-	Result interface{} `json:"result"`
-}
+	hubMu          sync.Mutex
+	hubHost        string
+	archiveEnabled atomic.Bool
+
+	socketMu     sync.Mutex
+	socket       *hubclient.Client
+	socketGen    int
+	connectCount int
+	conn         connection
+
+	toastBox     *gtk.Box
+	toasts       []*gtk.InfoBar
+	errorsMu     sync.Mutex
+	recentErrors []string
+
+	intercom intercom
+	talkBtn  *gtk.Button
+
+	transfersMu sync.Mutex
+	transfers   map[string]*directTransfer
+	// relayWaits are accepted offers whose sender may still relay them
+	// through the hub, by transferId
+	relayWaits map[string]transferOffer
+	directBtn  *gtk.Button
+
+	cueMu     sync.Mutex
+	cueTimers []*time.Timer
+
+	outboxMu       sync.Mutex
+	outbox         []outboxItem
+	outboxNext     int
+	outboxEnabled  atomic.Bool
+	outboxFlushing atomic.Bool
+	outboxButton   *gtk.Button
+
+	recorder     atomic.Pointer[sessionRecorder]
+	recordAction *glib.SimpleAction
+	replaying    atomic.Bool
+	replayMu     sync.Mutex
+	replayCancel context.CancelFunc
 
-type uploadResponse struct {
-	Filename    string `json:"filename"`
-	Size        int    `json:"size"`
-	ContentType string `json:"contentType"`
+	mqttBridge *mqtt.Bridge
+	dbus       *dbusService
+	mpris      *mprisService
+
+	chimes     chimeState
+	muteAction *glib.SimpleAction
+	tray       *trayIcon
+
+	dndAction *glib.SimpleAction
+	dndButton *gtk.ToggleButton
+	// clipboardSeen is the clipboard text last shared or taken from a
+	// peer, so auto-sync does not send it back. Owned by the GTK main loop.
+	clipboardSeen       string
+	clipboardSyncAction *glib.SimpleAction
+	// dryRun makes broadcasts show who they would reach instead.
+	dryRun atomic.Bool
+	// broadcastZone is the zone picked in zoneCombo; zones are the hub's
+	// zones by name, owned by the GTK main loop.
+	broadcastZone atomic.Pointer[string]
+	zoneCombo     *gtk.ComboBoxText
+	zones         map[string][]string
+	// pendingZone is a zone chosen before the hub listed its zones.
+	pendingZone *string
+	// syncPlay starts broadcast-play on every peer together.
+	syncPlay      atomic.Bool
+	syncPlayCheck *gtk.CheckButton
+	// loopPlay repeats Play and Broadcast Play until Stop All.
+	loopPlay   atomic.Bool
+	loopCheck  *gtk.CheckButton
+	stopAllBtn *gtk.Button
+	// normalizePlay mirrors profile.NormalizePlayback for goroutines.
+	normalizePlay atomic.Bool
+	// uploadRate mirrors profile.UploadLimit for goroutines.
+	uploadRate atomic.Int64
+	// recentList is the open Recently Played list, or nil.
+	recentList *gtk.ListBox
+	// trashList is the open Trash list, or nil; trashOpen mirrors it for
+	// goroutines
+	trashList *gtk.ListBox
+	trashOpen atomic.Bool
+	// trashKept are the hotkeys and tags of files this client sent to the
+	// trash, given back if one is restored
+	trashKept localFileState
+	// syncer runs the Sync tab's folder until syncStop; nil when off.
+	// Main loop only.
+	syncer   *syncdir.Syncer
+	syncStop context.CancelFunc
+	syncView *syncView
+	// playCounts are broadcast-plays by file, from the hub's stats when
+	// playCountsKnown and otherwise this session's; main loop only.
+	playCounts       map[string]int
+	playCountsKnown  bool
+	neverPlayedCheck *gtk.CheckButton
+	// quality grades the link from heartbeats and reconnects.
+	quality linkQuality
+	// trafficBase is the session traffic already added to the profile.
+	trafficBase map[string]trafficTotals
+	// fanOutButton picks the other hubs broadcasts also go to.
+	fanOutButton *gtk.MenuButton
+
+	// roleGated are controls disabled when the hub's role for this client
+	// does not allow their action.
+	roleGated []roleGate
+
+	// docks are the panels that can pop out into their own windows.
+	docks        map[string]*panelDock
+	panelActions map[string]*glib.SimpleAction
+	// panes are the dividers whose positions the profile remembers.
+	panes             map[string]*gtk.Paned
+	restoringGeometry bool
+
+	hotkeys []globalHotkey
+	// daemon keeps the window hidden until the app is launched again,
+	// leaving the hub to global hotkeys and the D-Bus service.
+	daemon      bool
+	windowShown bool
+	// firstRun shows the connection wizard before the first connect.
+	firstRun bool
+	// configErr is shown once the window is up; see loadConfig.
+	configErr error
 }
 
-type audioFile struct {
-	Name     string
-	Size     *int64
-	Uploaded string
+// uploadOptions carries the per-upload choices from the upload row.
+type uploadOptions struct {
+	// Temporary uploads are deleted by the hub after TTL, or when this
+	// client disconnects if TTL is zero.
+	Temporary bool
+	TTL       time.Duration
+	// BroadcastPlay plays the upload on every peer once it completes.
+	BroadcastPlay bool
+	// BroadcastImage shows the upload to every peer once it completes.
+	BroadcastImage bool
+	// Transcode converts audio to the Preferences format first.
+	Transcode bool
+	// Folder is the prefix the remote name is placed under.
+	Folder string
+	// Meta holds tags known from elsewhere, used where the file has none.
+	Meta *hubclient.AudioMeta
 }
 
+// audioFile is one remote file as the hub listed it.
+type audioFile = audiolist.File
+
 func main() {
+	cfg, configErr := loadConfig()
+	if configErr != nil {
+		fmt.Fprintf(os.Stderr, "config error: %v\n", configErr)
+	}
+	// with nothing configured anywhere, activate asks for the hub
+	firstRun := configErr == nil && len(cfg.Profiles) == 0 && os.Getenv("CLIENT_CONTROL_URL") == ""
+	profile := cfg.activeProfile()
+
 	ctrl := os.Getenv("CLIENT_CONTROL_URL")
 	if ctrl == "" {
-		ctrl = defaultControlURL
+		ctrl = profile.ControlURL
+	}
+	if ctrl == "" {
+		ctrl = hubclient.DefaultControlURL
 	}
 	parsed, err := url.Parse(ctrl)
 	if err != nil {
@@ -84,41 +302,109 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := gtk.InitCheck(nil); err != nil {
+	// --daemon is ours; GApplication would reject it
+	daemon := false
+	args := make([]string, 0, len(os.Args))
+	for _, arg := range os.Args {
+		if arg == "--daemon" {
+			daemon = true
+			continue
+		}
+		args = append(args, arg)
+	}
+
+	gtkApp, err := gtk.ApplicationNew(appID, glib.APPLICATION_FLAGS_NONE)
+	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to init gtk: %v\n", err)
 		os.Exit(1)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	a := &app{
-		controlURL: parsed,
+		ctx:       ctx,
+		cancel:    cancel,
+		config:    cfg,
+		uploads:   newUploadStore(),
+		timeouts:  profile.Timeouts,
+		telemetry: newTelemetry(profile.Telemetry, cfg.activeProfileName()),
+		metrics:   newClientMetrics(),
+		gtkApp:    gtkApp,
+		daemon:    daemon,
+		firstRun:  firstRun,
+		configErr: configErr,
 	}
 
+	a.setActive(cfg.activeProfileName(), profile, parsed)
+	a.conn.since = time.Now()
+	a.describeHubHealth()
+	// a second launch only activates this primary instance, which
+	// raises the existing window
+	gtkApp.Connect("startup", a.installActions)
+	gtkApp.Connect("activate", a.activate)
+	gtkApp.Connect("shutdown", a.shutdown)
+	os.Exit(gtkApp.Run(args))
+}
+
+func (a *app) activate() {
+	if a.win != nil {
+		a.showWindow()
+		return
+	}
+	a.initLanguage()
+	a.applyTheme()
 	if err := a.buildUI(); err != nil {
 		fmt.Fprintf(os.Stderr, "ui error: %v\n", err)
-		os.Exit(1)
+		a.gtkApp.Quit()
+		return
 	}
 
-	a.logf("Control URL: %s", parsed.String())
+	if a.configErr != nil {
+		a.showToastType(gtk.MESSAGE_WARNING, tr("Settings could not be loaded: ")+a.configErr.Error(), nil, false)
+	}
+	a.logf("Control URL: %s", a.controlURL().String())
+	a.serveMetrics()
+	a.serveGateway()
+	a.startMQTT()
+	a.startSyncFolder()
+	a.startDBus()
+	a.applyGlobalHotkeys()
+	a.loadScripts()
+	if a.daemon || a.profile().Tray {
+		a.startTray()
+	}
+	a.sweepTranscoded()
+	a.setStatusPoll(a.profile().StatusPollSeconds)
+	go a.runStatusPoll()
+	go a.runHeartbeat()
+	if a.firstRun && !a.daemon {
+		a.runWizard()
+	}
 	if err := a.connectSocket(); err != nil {
-		a.logf("socket connect error: %v", err)
+		a.reportError("socket connect", err, a.reconnectSocket)
 	} else {
 		go a.fetchStatus()
 	}
-
-	gtk.Main()
 }
 
 func (a *app) buildUI() error {
-	win, err := gtk.WindowNew(gtk.WINDOW_TOPLEVEL)
+	appWin, err := gtk.ApplicationWindowNew(a.gtkApp)
 	if err != nil {
 		return err
 	}
-	win.SetTitle("Brain Hub (GTK)")
+	win := &appWin.Window
+	a.win = win
+	win.SetTitle(tr("Brain Hub (GTK)"))
 	win.SetDefaultSize(900, 600)
-	win.Connect("destroy", func() {
-		a.closeSocket()
-		gtk.MainQuit()
+	a.trackWindow(win)
+	win.Connect("delete-event", func() bool {
+		if a.daemon {
+			win.Hide()
+			return true
+		}
+		a.requestQuit()
+		return true
 	})
+	a.buildHeaderBar(win)
 
 	vbox, err := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 8)
 	if err != nil {
@@ -127,130 +413,324 @@ func (a *app) buildUI() error {
 	vbox.SetBorderWidth(12)
 	win.Add(vbox)
 
+	a.toastBox, _ = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+	vbox.PackStart(a.toastBox, false, false, 0)
+
 	statusBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 8)
 	vbox.PackStart(statusBox, false, false, 0)
 
-	a.statusLabel, _ = gtk.LabelNew("Status: pending...")
+	a.statusLabel, _ = gtk.LabelNew("")
+	a.statusLabel.SetXAlign(0)
+	addStyleClass(a.statusLabel, "hub-status")
+	a.buildConnIndicator(statusBox)
 	statusBox.PackStart(a.statusLabel, true, true, 0)
+	a.buildLinkIndicator(statusBox)
 
-	refreshBtn, _ := gtk.ButtonNewWithLabel("Refresh Status")
+	refreshBtn, _ := gtk.ButtonNewWithMnemonic(tr("_Refresh Status"))
 	refreshBtn.Connect("clicked", func() { go a.fetchStatus() })
 	statusBox.PackEnd(refreshBtn, false, false, 0)
+	setupsBtn, _ := gtk.ButtonNewWithMnemonic(tr("_Event Setups…"))
+	setupsBtn.SetTooltipText(tr("Save or load a named setup for a recurring event"))
+	setupsBtn.Connect("clicked", func() { a.showEventSetups() })
+	statusBox.PackEnd(setupsBtn, false, false, 0)
+	prefsBtn, _ := gtk.ButtonNewWithMnemonic(tr("_Preferences…"))
+	prefsBtn.Connect("clicked", func() { a.showPreferences() })
+	statusBox.PackEnd(prefsBtn, false, false, 0)
+	a.outboxButton, _ = gtk.ButtonNewWithMnemonic(tr("_Outbox (0)"))
+	a.outboxButton.SetTooltipText(tr("Actions queued while disconnected"))
+	a.outboxButton.SetNoShowAll(true)
+	a.outboxButton.Connect("clicked", func() { a.showOutbox() })
+	statusBox.PackEnd(a.outboxButton, false, false, 0)
+	a.buildDNDIndicator(statusBox)
 
-	filesBtn, _ := gtk.ButtonNewWithLabel("List Files")
-	filesBtn.Connect("clicked", func() { go a.fetchFiles() })
+	vbox.PackStart(a.buildIdentity(), false, false, 0)
+
+	a.nowPlayingLabel, _ = gtk.LabelNew(tr("Now playing: nothing"))
+	a.nowPlayingLabel.SetXAlign(0)
+	a.nowPlayingLabel.SetEllipsize(pango.ELLIPSIZE_END)
+	addStyleClass(a.nowPlayingLabel, "now-playing")
+	// shown once the hub's hello says its peers report playback
+	a.nowPlayingLabel.SetNoShowAll(true)
+	vbox.PackStart(a.nowPlayingLabel, false, false, 0)
+
+	filesBtn, _ := gtk.ButtonNewWithMnemonic(tr("List _Files"))
+	filesBtn.Connect("clicked", func() { a.showFilesTab() })
 	vbox.PackStart(filesBtn, false, false, 0)
 
-	peersBtn, _ := gtk.ButtonNewWithLabel("Show Peers")
+	peersBtn, _ := gtk.ButtonNewWithMnemonic(tr("S_how Peers"))
 	peersBtn.Connect("clicked", func() {
 		a.logf("peers command requested")
-		go a.execCommand("peers")
+		go a.fetchPeers()
 	})
 	vbox.PackStart(peersBtn, false, false, 0)
 
 	commandBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
 	vbox.PackStart(commandBox, false, false, 0)
-	commandLabel, _ := gtk.LabelNew("Command:")
-	commandBox.PackStart(commandLabel, false, false, 0)
 	a.commandEntry, _ = gtk.EntryNew()
-	a.commandEntry.SetPlaceholderText("e.g. audio list")
+	a.commandEntry.SetPlaceholderText(tr("e.g. audio list"))
+	commandBox.PackStart(mnemonicLabel(tr("_Command:"), a.commandEntry), false, false, 0)
 	commandBox.PackStart(a.commandEntry, true, true, 0)
-	commandBtn, _ := gtk.ButtonNewWithLabel("Send")
+	commandBtn, _ := gtk.ButtonNewWithMnemonic(tr("_Send"))
 	commandBtn.Connect("clicked", func() {
 		text, _ := a.commandEntry.GetText()
 		go a.execCommand(strings.TrimSpace(text))
 	})
+	a.commandEntry.Connect("activate", func() { commandBtn.Clicked() })
 	commandBox.PackEnd(commandBtn, false, false, 0)
+	a.macroBox, _ = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	setAccessible(a.macroBox, tr("Command macros"), "")
+	vbox.PackStart(a.macroBox, false, false, 0)
+	a.macroBox.SetNoShowAll(true)
+	a.refreshMacroButtons()
 
 	playBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
 	vbox.PackStart(playBox, false, false, 0)
-	playLabel, _ := gtk.LabelNew("Play filename:")
-	playBox.PackStart(playLabel, false, false, 0)
 	a.playEntry, _ = gtk.EntryNew()
+	playBox.PackStart(mnemonicLabel(tr("P_lay filename:"), a.playEntry), false, false, 0)
 	playBox.PackStart(a.playEntry, true, true, 0)
-	playBtn, _ := gtk.ButtonNewWithLabel("Play")
+	playBtn, _ := gtk.ButtonNewWithMnemonic(tr("Pl_ay"))
+	a.gateOnRole("play", playBtn)
 	playBtn.Connect("clicked", func() {
 		name, _ := a.playEntry.GetText()
 		go a.invokePlay(strings.TrimSpace(name))
 	})
+	a.playEntry.Connect("activate", func() { playBtn.Clicked() })
 	playBox.PackEnd(playBtn, false, false, 0)
+	a.buildStopControls(playBox)
 
 	broadcastBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
 	vbox.PackStart(broadcastBox, false, false, 0)
-	broadcastLabel, _ := gtk.LabelNew("Broadcast message:")
-	broadcastBox.PackStart(broadcastLabel, false, false, 0)
+	a.gateOnRole("broadcast", broadcastBox)
 	a.broadcastEntry, _ = gtk.EntryNew()
+	broadcastBox.PackStart(mnemonicLabel(tr("_Broadcast message:"), a.broadcastEntry), false, false, 0)
 	broadcastBox.PackStart(a.broadcastEntry, true, true, 0)
-	broadcastBtn, _ := gtk.ButtonNewWithLabel("Broadcast")
+	broadcastBtn, _ := gtk.ButtonNewWithMnemonic(tr("Broadcas_t"))
 	broadcastBtn.Connect("clicked", func() {
 		msg, _ := a.broadcastEntry.GetText()
 		go a.invokeBroadcast(strings.TrimSpace(msg))
 	})
-	broadcastPlayBtn, _ := gtk.ButtonNewWithLabel("Broadcast Play")
+	a.broadcastEntry.Connect("activate", func() { broadcastBtn.Clicked() })
+	broadcastPlayBtn, _ := gtk.ButtonNewWithMnemonic(tr("Broadcast Pla_y"))
+	broadcastPlayBtn.SetTooltipText(tr("Play the file named above on every peer"))
 	broadcastPlayBtn.Connect("clicked", func() {
 		name, _ := a.playEntry.GetText()
 		go a.invokeBroadcastPlay(strings.TrimSpace(name))
 	})
+	dryRun, _ := gtk.CheckButtonNewWithMnemonic(tr("Dry _run"))
+	dryRun.SetTooltipText(tr("Show which peers a broadcast would reach instead of sending it"))
+	dryRun.Connect("toggled", func() { a.dryRun.Store(dryRun.GetActive()) })
+	broadcastBox.PackEnd(dryRun, false, false, 0)
 	broadcastBox.PackEnd(broadcastPlayBtn, false, false, 0)
 	broadcastBox.PackEnd(broadcastBtn, false, false, 0)
+	a.buildSyncPlayToggle(broadcastBox)
+	a.buildZoneControls(broadcastBox)
+	a.buildFanOutButton(broadcastBox)
+	a.buildClipboardControls(broadcastBox)
+	imageBtn, _ := gtk.ButtonNewWithLabel(tr("Send Image…"))
+	imageBtn.Connect("clicked", func() { a.chooseBroadcastImage() })
+	a.gateOnRole("broadcast-image", imageBtn)
+	broadcastBox.PackEnd(imageBtn, false, false, 0)
+	shotBtn, _ := gtk.ButtonNewWithLabel(tr("Share Screenshot"))
+	shotBtn.SetTooltipText(tr("Pick a region or window to show every peer; Ctrl+Alt+S shares the whole screen"))
+	shotBtn.Connect("clicked", func() { a.shareScreenshotRegion() })
+	broadcastBox.PackEnd(shotBtn, false, false, 0)
+	a.buildIntercomControls(broadcastBox)
+
+	a.buildPlaybackControls(vbox)
 
 	uploadBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
 	vbox.PackStart(uploadBox, false, false, 0)
-	chooseBtn, _ := gtk.ButtonNewWithLabel("Choose File")
+	a.gateOnRole("upload", uploadBox)
+	chooseBtn, _ := gtk.ButtonNewWithMnemonic(tr("Choose F_ile"))
 	chooseBtn.Connect("clicked", func() { a.chooseUploadFile() })
 	uploadBox.PackStart(chooseBtn, false, false, 0)
-	remoteLabel, _ := gtk.LabelNew("Remote name:")
-	uploadBox.PackStart(remoteLabel, false, false, 0)
+	urlBtn, _ := gtk.ButtonNewWithLabel(tr("From URL…"))
+	urlBtn.SetTooltipText(tr("Download an audio file from the web and upload it"))
+	urlBtn.Connect("clicked", func() { a.showAddFromURL() })
+	uploadBox.PackStart(urlBtn, false, false, 0)
 	a.uploadNameEntry, _ = gtk.EntryNew()
-	a.uploadNameEntry.SetPlaceholderText("leave blank to use file name")
+	a.uploadNameEntry.SetPlaceholderText(tr("leave blank to use file name"))
+	uploadBox.PackStart(mnemonicLabel(tr("Remote _name:"), a.uploadNameEntry), false, false, 0)
 	uploadBox.PackStart(a.uploadNameEntry, true, true, 0)
-	uploadBtn, _ := gtk.ButtonNewWithLabel("Upload")
+	a.uploadFolderEntry, _ = gtk.EntryNew()
+	a.uploadFolderEntry.SetPlaceholderText(tr("folder (optional)"))
+	a.uploadFolderEntry.SetWidthChars(12)
+	a.uploadFolderEntry.SetTooltipText(tr("Upload into this folder, e.g. sfx/doors"))
+	setAccessible(a.uploadFolderEntry, tr("Upload folder"), "")
+	uploadBox.PackStart(a.uploadFolderEntry, false, false, 0)
+	a.uploadTempCheck, _ = gtk.CheckButtonNewWithMnemonic(tr("Te_mporary"))
+	a.uploadTempCheck.SetTooltipText(tr("Let the hub delete this upload automatically"))
+	uploadBox.PackStart(a.uploadTempCheck, false, false, 0)
+	a.uploadTempCombo, _ = gtk.ComboBoxTextNew()
+	a.uploadTempCombo.Append("0", tr("until I disconnect"))
+	a.uploadTempCombo.Append("1", tr("for 1 hour"))
+	a.uploadTempCombo.Append("4", tr("for 4 hours"))
+	a.uploadTempCombo.Append("24", tr("for 24 hours"))
+	a.uploadTempCombo.SetActiveID("0")
+	a.uploadTempCombo.SetSensitive(false)
+	a.uploadTempCheck.Connect("toggled", func() {
+		a.uploadTempCombo.SetSensitive(a.uploadTempCheck.GetActive())
+	})
+	setAccessible(a.uploadTempCombo, tr("Temporary upload lifetime"), "")
+	uploadBox.PackStart(a.uploadTempCombo, false, false, 0)
+	a.setTemporaryAvailable(a.currentSocket().Supports(protocol.CapTemporary))
+	a.uploadTranscodeCheck, _ = gtk.CheckButtonNewWithLabel(tr("Transcode"))
+	a.updateTranscodeCheck()
+	uploadBox.PackStart(a.uploadTranscodeCheck, false, false, 0)
+	uploadBtn, _ := gtk.ButtonNewWithMnemonic(tr("_Upload"))
 	uploadBtn.Connect("clicked", func() {
 		path := a.uploadFilePath
 		remote, _ := a.uploadNameEntry.GetText()
-		go a.runUpload(path, remote)
+		opts := a.currentUploadOptions()
+		go a.runUpload(path, remote, opts)
+	})
+	cancelUploadBtn, _ := gtk.ButtonNewWithLabel(tr("Cancel"))
+	cancelUploadBtn.SetTooltipText(tr("Abort uploads in progress"))
+	setAccessible(cancelUploadBtn, tr("Cancel upload"), "")
+	cancelUploadBtn.Connect("clicked", func() {
+		if n := a.cancelOps("upload", errUploadCancelled); n == 0 {
+			a.logf("no upload in progress")
+		}
 	})
+	uploadBox.PackEnd(cancelUploadBtn, false, false, 0)
 	uploadBox.PackEnd(uploadBtn, false, false, 0)
 
-	audioFrame, _ := gtk.FrameNew("Remote Audio Files")
+	directBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	vbox.PackStart(directBox, false, false, 0)
+	a.directPeerEntry, _ = gtk.EntryNew()
+	a.directPeerEntry.SetPlaceholderText(tr("peer id (large files stream peer-to-peer)"))
+	directBox.PackStart(mnemonicLabel(tr("_Direct to peer:"), a.directPeerEntry), false, false, 0)
+	directBox.PackStart(a.directPeerEntry, true, true, 0)
+	a.directBtn, _ = gtk.ButtonNewWithLabel(tr("Send Direct"))
+	a.directBtn.Connect("clicked", func() {
+		path := a.uploadFilePath
+		remote, _ := a.uploadNameEntry.GetText()
+		peer, _ := a.directPeerEntry.GetText()
+		go a.runDirectTransfer(path, remote, peer)
+	})
+	directBox.PackEnd(a.directBtn, false, false, 0)
+	a.setDirectTransferAvailable(a.currentSocket().Supports(protocol.CapDirectTransfer), a.currentSocket().Role())
+
+	a.buildPeerPanel(vbox)
+
+	a.archiveCheck, _ = gtk.CheckButtonNewWithLabel(tr("Save broadcast audio locally"))
+	a.archiveCheck.SetTooltipText(tr("Download every broadcast-played file into the local received folder"))
+	a.archiveCheck.SetActive(a.profile().ArchiveBroadcasts)
+	a.archiveEnabled.Store(a.profile().ArchiveBroadcasts)
+	a.archiveCheck.Connect("toggled", func() {
+		enabled := a.archiveCheck.GetActive()
+		a.archiveEnabled.Store(enabled)
+		a.updateProfile(func(p *profileConfig) { p.ArchiveBroadcasts = enabled })
+		if err := a.config.save(); err != nil {
+			a.logf("config save error: %v", err)
+		}
+	})
+	vbox.PackStart(a.archiveCheck, false, false, 0)
+
+	outboxCheck, _ := gtk.CheckButtonNewWithLabel(tr("Queue play/broadcast while offline"))
+	outboxCheck.SetTooltipText(tr("Hold actions made while disconnected and send them in order after reconnecting"))
+	outboxCheck.SetActive(a.profile().QueueOffline)
+	a.outboxEnabled.Store(a.profile().QueueOffline)
+	a.normalizePlay.Store(a.profile().NormalizePlayback)
+	outboxCheck.Connect("toggled", func() {
+		enabled := outboxCheck.GetActive()
+		a.outboxEnabled.Store(enabled)
+		a.updateProfile(func(p *profileConfig) { p.QueueOffline = enabled })
+		if err := a.config.save(); err != nil {
+			a.logf("config save error: %v", err)
+		}
+	})
+	vbox.PackStart(outboxCheck, false, false, 0)
+
+	audioFrame, _ := gtk.FrameNew(tr("Remote Audio Files"))
 	audioFrame.SetShadowType(gtk.SHADOW_IN)
 	audioFrame.SetLabelAlign(0, 0.5)
-	vbox.PackStart(audioFrame, false, false, 0)
+	vbox.PackStart(a.dockPanel("audio", tr("Remote Audio Files"), audioFrame), false, false, 0)
 
 	audioScroll, _ := gtk.ScrolledWindowNew(nil, nil)
 	audioScroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
 	audioScroll.SetHExpand(true)
-	audioFrame.Add(audioScroll)
+	audioBox, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+	audioFrame.Add(audioBox)
+	audioBox.PackStart(a.buildAudioToolbar(), false, false, 0)
+	audioBox.PackStart(a.buildAudioBulkBar(), false, false, 0)
+	a.breadcrumb, _ = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 0)
+	a.breadcrumb.SetMarginStart(4)
+	setAccessible(a.breadcrumb, tr("Current folder"), "")
+	audioBox.PackStart(a.breadcrumb, false, false, 0)
+	audioBox.PackStart(audioScroll, true, true, 0)
 
 	a.audioFlow, _ = gtk.FlowBoxNew()
 	a.audioFlow.SetColumnSpacing(6)
 	a.audioFlow.SetRowSpacing(6)
 	a.audioFlow.SetMaxChildrenPerLine(3)
 	a.audioFlow.SetSelectionMode(gtk.SELECTION_NONE)
+	a.gateOnRole("broadcast-play", a.audioFlow)
 	a.audioFlow.SetHomogeneous(false)
 	a.audioFlow.SetActivateOnSingleClick(true)
-	audioScroll.Add(a.audioFlow)
-	if err := a.setAudioPlaceholder("Loading audio files..."); err != nil {
+	setAccessible(a.audioFlow, tr("Remote audio files"), tr("Activate a file to play it on every peer; the context menu key offers more actions"))
+	a.audioFolderBox, _ = gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 2)
+	audioContent, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+	audioContent.PackStart(a.audioFolderBox, false, false, 0)
+	audioContent.PackStart(a.audioFlow, false, false, 0)
+	audioScroll.Add(audioContent)
+	if err := a.setAudioPlaceholder(tr("Loading audio files...")); err != nil {
 		a.logf("audio placeholder error: %v", err)
 	}
 
+	a.notebook, _ = gtk.NotebookNew()
+	vbox.PackStart(a.notebook, true, true, 0)
+
 	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
 	scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
 	scroll.SetVExpand(true)
 	scroll.SetHExpand(true)
-	vbox.PackStart(scroll, true, true, 0)
+	a.addTab(tr("Log"), a.dockPanel("log", tr("Log"), scroll))
 
 	textView, _ := gtk.TextViewNew()
 	textView.SetEditable(false)
 	textView.SetWrapMode(gtk.WRAP_WORD_CHAR)
+	addStyleClass(textView, "client-log")
+	setAccessible(textView, tr("Client log"), "")
 	scroll.Add(textView)
 	a.textView = textView
 	a.textBuffer, _ = textView.GetBuffer()
 
-	win.ShowAll()
+	a.addTab(tr("Files"), a.dockPanel("files", tr("Files"), a.buildFilesTab()))
+	a.addTab(tr("Sync"), a.buildSyncTab())
+	a.addTab(tr("Hub Logs"), a.buildHubLogsTab())
+	a.addTab(tr("Audit"), a.buildAuditTab())
+	a.addTab(tr("Shared State"), a.buildKVTab())
+	a.addTab(tr("Results"), a.buildResultsTab())
+	a.addTab(tr("Metrics"), a.buildDashboardTab())
+	a.addTab(tr("Protocol"), a.buildProtocolTab())
+	a.buildPanels()
+	a.restoreGeometry()
+
+	if a.daemon {
+		a.logf("running in the background; launch the client again to show the window")
+		return nil
+	}
+	a.showWindow()
 	return nil
 }
 
+// showWindow shows the main window, realizing it the first time.
+func (a *app) showWindow() {
+	if !a.windowShown {
+		a.win.ShowAll()
+		a.windowShown = true
+		a.restorePanels()
+	}
+	a.win.Present()
+}
+
+func (a *app) addTab(title string, child gtk.IWidget) *gtk.Label {
+	label, _ := gtk.LabelNew(title)
+	a.notebook.AppendPage(child, label)
+	return label
+}
+
 func (a *app) logf(format string, args ...interface{}) {
 	msg := fmt.Sprintf(format, args...)
 	ts := time.Now().Format("15:04:05")
@@ -278,48 +758,60 @@ func (a *app) logf(format string, args ...interface{}) {
 }
 
 func (a *app) fetchStatus() {
-	var res statusResponse
-	if err := a.socketRequest("status", nil, &res); err != nil {
-		a.logf("status error: %v", err)
+	res, err := a.currentSocket().Status(a.ctx)
+	if err != nil {
+		a.reportError("status", err, a.fetchStatus)
 		return
 	}
-	files, audioErr := parseAudioList(res.AudioList)
-	glib.IdleAdd(func() bool {
-		if a.statusLabel != nil {
-			a.statusLabel.SetText(fmt.Sprintf("Status: %s (connected=%v)", res.Host, res.Connected))
+	files, audioErr := a.applyStatus(res)
+	a.logf("status ok: host=%s connected=%v", res.Host, res.Connected)
+	switch {
+	case audioErr != "":
+		a.logf("audio list error: %s", audioErr)
+	case len(files) == 0:
+		a.logf("audio list empty")
+	default:
+		preview := make([]string, len(files))
+		for i, file := range files {
+			preview[i] = file.Name
 		}
-		a.logf("status ok: host=%s connected=%v", res.Host, res.Connected)
-		a.refreshAudioButtons(files, audioErr)
-		switch {
-		case audioErr != "":
-			a.logf("audio list error: %s", audioErr)
-		case len(files) == 0:
-			a.logf("audio list empty")
-		default:
-			preview := make([]string, len(files))
-			for i, file := range files {
-				preview[i] = file.Name
-			}
-			if len(preview) > 6 {
-				preview = preview[:6]
-			}
-			a.logf("audio list (%d): %s", len(files), strings.Join(preview, ", "))
+		if len(preview) > 6 {
+			preview = preview[:6]
 		}
+		a.logf("audio list (%d): %s", len(files), strings.Join(preview, ", "))
+	}
+}
+
+// applyStatus shows a status answer and returns its audio list.
+func (a *app) applyStatus(res *hubclient.Status) ([]audioFile, string) {
+	a.setHubHost(res.Host)
+	files, audioErr := audiolist.Parse(res.AudioList)
+	a.recordHubStatus(res, audioCount(files, audioErr))
+	a.observeHubStatus(res.Connected)
+	glib.IdleAdd(func() bool {
+		a.refreshConnIndicator()
+		a.refreshAudioButtons(files, audioErr)
+		a.applyStatusPeers(res)
+		a.showWhoami(res.Whoami)
 		return false
 	})
+	return files, audioErr
 }
 
 func (a *app) fetchFiles() {
-	var res filesResponse
-	if err := a.socketRequest("files", nil, &res); err != nil {
-		a.logf("files error: %v", err)
+	files, err := a.currentSocket().Files(a.ctx)
+	if err != nil {
+		a.reportError("files", err, a.fetchFiles)
 		return
 	}
-	preview := res.Files
-	if len(preview) > 12 {
-		preview = preview[:12]
-	}
-	a.logf("files (%d): %s", len(res.Files), strings.Join(preview, ", "))
+	a.logf("files: %d on the hub", len(files))
+	go a.fetchStorage()
+	glib.IdleAdd(func() bool {
+		if a.filesView != nil {
+			a.filesView.show(files)
+		}
+		return false
+	})
 }
 
 func (a *app) execCommand(command string) {
@@ -327,13 +819,17 @@ func (a *app) execCommand(command string) {
 		a.logf("command empty")
 		return
 	}
-	var res commandResponse
-	if err := a.socketRequest("command", map[string]any{"command": command}, &res); err != nil {
-		a.logf("command error: %v", err)
+	hub := a.currentSocket()
+	if hub.Supports(protocol.CapCommandStream) {
+		a.streamCommand(hub, command)
 		return
 	}
-	enc, _ := json.Marshal(res.Result)
-	a.logf("command result: %s", enc)
+	result, err := hub.Command(a.ctx, command)
+	if err != nil {
+		a.reportError("command", err, func() { a.execCommand(command) })
+		return
+	}
+	a.commandResult(command, "", result)
 }
 
 func (a *app) invokePlay(filename string) {
@@ -341,8 +837,12 @@ func (a *app) invokePlay(filename string) {
 		a.logf("play filename missing")
 		return
 	}
-	if err := a.socketRequest("play", map[string]any{"filename": filename}, nil); err != nil {
-		a.logf("play error: %v", err)
+	it := outboxItem{action: "play", arg: filename, loop: a.loopPlay.Load(), normalize: a.normalizePlay.Load(), key: hubclient.NewIdempotencyKey()}
+	if err := a.sendOutboxItem(it); err != nil {
+		if a.queueIfOffline(it, err) {
+			return
+		}
+		a.reportError("play", err, func() { a.invokePlay(filename) })
 		return
 	}
 	a.logf("play invoked: %s", filename)
@@ -353,8 +853,21 @@ func (a *app) invokeBroadcast(message string) {
 		a.logf("broadcast message missing")
 		return
 	}
-	if err := a.socketRequest("broadcast", map[string]any{"message": message}, nil); err != nil {
-		a.logf("broadcast error: %v", err)
+	zone := a.currentZone()
+	if !a.confirmBroadcast("broadcast", message, zone) {
+		return
+	}
+	// zones belong to this hub, so a zoned broadcast is not fanned out
+	if targets := a.fanOutTargets(); len(targets) > 0 && zone == "" {
+		a.fanOut("broadcast", message, targets)
+		return
+	}
+	key := hubclient.NewIdempotencyKey()
+	if err := a.currentSocket().BroadcastTo(hubclient.WithIdempotencyKey(a.ctx, key), message, zone); err != nil {
+		if a.queueIfOffline(outboxItem{action: "broadcast", arg: message, zone: zone, key: key}, err) {
+			return
+		}
+		a.reportError("broadcast", err, func() { a.invokeBroadcast(message) })
 		return
 	}
 	a.logf("broadcast sent")
@@ -365,8 +878,24 @@ func (a *app) invokeBroadcastPlay(filename string) {
 		a.logf("broadcast play filename missing")
 		return
 	}
-	if err := a.socketRequest("broadcast-play", map[string]any{"filename": filename}, nil); err != nil {
-		a.logf("broadcast play error: %v", err)
+	zone := a.currentZone()
+	if !a.confirmBroadcast("broadcast-play", filename, zone) {
+		return
+	}
+	if targets := a.fanOutTargets(); len(targets) > 0 && zone == "" {
+		a.fanOut("broadcast-play", filename, targets)
+		return
+	}
+	it := outboxItem{
+		action: "broadcast-play", arg: filename, zone: zone,
+		sync: a.syncPlay.Load(), loop: a.loopPlay.Load(), normalize: a.normalizePlay.Load(),
+		key: hubclient.NewIdempotencyKey(),
+	}
+	if err := a.sendOutboxItem(it); err != nil {
+		if a.queueIfOffline(it, err) {
+			return
+		}
+		a.reportError("broadcast play", err, func() { a.invokeBroadcastPlay(filename) })
 		return
 	}
 	a.logf("broadcast play sent: %s", filename)
@@ -397,7 +926,40 @@ func (a *app) chooseUploadFile() {
 	}
 }
 
-func (a *app) runUpload(path, remote string) {
+// currentUploadOptions reads the upload row. Must run on the GTK main loop.
+// setTemporaryAvailable enables temporary uploads when the hub can expire
+// them. It must run on the GTK main loop.
+func (a *app) setTemporaryAvailable(ok bool) {
+	if a.uploadTempCheck == nil {
+		return
+	}
+	a.uploadTempCheck.SetSensitive(ok)
+	if ok {
+		a.uploadTempCheck.SetTooltipText(tr("Let the hub delete this upload automatically"))
+		return
+	}
+	// unchecking also greys out the lifetime
+	a.uploadTempCheck.SetActive(false)
+	a.uploadTempCheck.SetTooltipText(tr("This hub cannot delete uploads automatically"))
+}
+
+func (a *app) currentUploadOptions() uploadOptions {
+	var opts uploadOptions
+	opts.Transcode = a.uploadTranscodeCheck != nil && a.uploadTranscodeCheck.GetActive()
+	if a.uploadFolderEntry != nil {
+		opts.Folder, _ = a.uploadFolderEntry.GetText()
+	}
+	if a.uploadTempCheck == nil || !a.uploadTempCheck.GetActive() {
+		return opts
+	}
+	opts.Temporary = true
+	if hours, err := strconv.Atoi(a.uploadTempCombo.GetActiveID()); err == nil && hours > 0 {
+		opts.TTL = time.Duration(hours) * time.Hour
+	}
+	return opts
+}
+
+func (a *app) runUpload(path, remote string, opts uploadOptions) {
 	if path == "" {
 		a.logf("no upload file selected")
 		return
@@ -406,22 +968,69 @@ func (a *app) runUpload(path, remote string) {
 	if remote == "" {
 		remote = filepath.Base(path)
 	}
-	data, err := os.ReadFile(path)
+	ctx, done := a.startOp("upload")
+	defer done()
+	if !a.waitForLink(ctx, "upload of "+remote) {
+		return
+	}
+	retry := func() { a.runUpload(path, remote, opts) }
+	src, name := path, inFolder(opts.Folder, remote)
+	if opts.Transcode {
+		out, outName, err := a.transcodeForUpload(ctx, path, name)
+		if err != nil {
+			a.reportError("transcode", err, retry)
+			return
+		}
+		if out != "" {
+			src, name = out, outName
+			defer a.releaseTranscoded(out)
+		}
+	}
+	if info, err := os.Stat(src); err == nil && !a.confirmQuota(ctx, name, info.Size()) {
+		a.logf("upload of %s cancelled: over the hub's storage quota", name)
+		return
+	}
+	if info, err := os.Stat(src); err == nil && a.shouldChunkUpload(info.Size()) && a.currentSocket().Supports(protocol.CapChunkedUpload) {
+		a.runChunkedUpload(ctx, src, name, info.Size(), opts, retry)
+		return
+	}
+	data, err := os.ReadFile(src)
 	if err != nil {
-		a.logf("read error: %v", err)
+		a.reportError("upload", err, nil)
 		return
 	}
-	var res uploadResponse
-	if err := a.socketRequest("upload", map[string]any{
-		"filename":    remote,
-		"base64":      base64.StdEncoding.EncodeToString(data),
-		"contentType": detectContentType(remote),
-	}, &res); err != nil {
-		a.logf("upload error: %v", err)
+	ctx, span := a.telemetry.startSpan(ctx, "transfer.upload", map[string]any{"brain.filename": name, "brain.bytes": int64(len(data))})
+	res, err := a.currentSocket().Upload(ctx, hubclient.UploadRequest{
+		Filename:  name,
+		Data:      data,
+		Temporary: opts.Temporary,
+		TTL:       opts.TTL,
+		Meta:      withTags(a.readAudioMeta(src), opts.Meta),
+	})
+	span.end(err)
+	if err != nil {
+		a.reportError("upload", err, retry)
 		return
 	}
-	a.logf("upload complete: %s (%d bytes)", res.Filename, res.Size)
+	a.recordTransfer("upload", "relay", int64(len(data)))
+	a.warnUnverified(res)
+	a.logUploaded(res)
 	go a.fetchStatus()
+	go a.cacheWaveform(src, res.Filename)
+	a.afterUpload(res.Filename, opts)
+}
+
+// logUploaded reports a finished upload and, for a temporary one, when
+// the hub removes it.
+func (a *app) logUploaded(res *hubclient.UploadResult) {
+	switch {
+	case res.ExpiresAt != "":
+		a.logf("upload complete: %s (%d bytes, temporary until %s)", res.Filename, res.Size, res.ExpiresAt)
+	case res.DeleteOnDisconnect:
+		a.logf("upload complete: %s (%d bytes, removed when this client disconnects)", res.Filename, res.Size)
+	default:
+		a.logf("upload complete: %s (%d bytes)", res.Filename, res.Size)
+	}
 }
 
 func (a *app) connectSocket() error {
@@ -429,77 +1038,149 @@ func (a *app) connectSocket() error {
 	if err != nil {
 		return err
 	}
-	client, err := newSocketClient(addr, a.handleSocketEvent)
+	a.socketMu.Lock()
+	reconnect := a.connectCount > 0
+	a.connectCount++
+	gen := a.connectCount
+	a.socketMu.Unlock()
+	if state, _ := a.connState(); state != stateReconnecting {
+		a.setConnState(stateConnecting, "", nil)
+	}
+	_, span := a.telemetry.startSpan(a.ctx, "socket.connect", map[string]any{"brain.address": addr, "brain.reconnect": reconnect})
+	client, err := hubclient.DialProxy(addr, a.proxyFor(addr), func(msg hubclient.Message) {
+		a.recordEvent(msg)
+		a.mqttBridge.Event(msg)
+		a.dbus.event(msg)
+		a.fireWebhooks(msg)
+		a.runScriptHandlers(msg)
+		a.panelsEvent(msg)
+		a.handleSocketEvent(msg)
+		if msg.Event == "disconnect" {
+			var cause error
+			if msg.Error != nil {
+				cause = msg.Error
+			}
+			a.socketLost(gen, cause)
+		}
+	})
+	span.end(err)
+	outcome := "ok"
 	if err != nil {
+		outcome = "error"
+	}
+	a.telemetry.add("brain.client.connects", 1, map[string]string{"outcome": outcome, "reconnect": strconv.FormatBool(reconnect)})
+	a.metrics.Add(metricConnects, metrics.Labels{"outcome": outcome}, 1)
+	if err != nil {
+		a.connFailed(err)
 		return err
 	}
+	client.Observe = func(ctx context.Context, action string, started time.Time, err error) {
+		a.telemetry.observeRequest(ctx, action, started, err)
+		a.observeConnection(err)
+	}
+	client.SetMetrics(a.metrics)
+	a.setHubUp(true)
+	client.Timeout = a.timeoutFor
+	client.Sent = a.recordSent
+	client.SetRetry(a.retryPolicy())
+	client.PreferJSONRPC(a.profile() != nil && a.profile().Protocol == "jsonrpc")
+	client.SetValidation(a.schemaValidation())
+	client.SetRateLimit(a.uploadLimit())
+	a.socketMu.Lock()
 	a.socket = client
-	a.logf("socket connected: %s", addr)
+	a.socketGen = gen
+	a.socketMu.Unlock()
+	if reconnect {
+		a.noteReconnect()
+	}
+	if remote := client.RemoteAddr(); remote != addr {
+		a.logf("socket connected: %s via %s", addr, remote)
+	} else {
+		a.logf("socket connected: %s", addr)
+	}
+	a.setConnState(stateAuthenticating, "", nil)
+	go a.afterHello(client)
 	return nil
 }
 
 func (a *app) closeSocket() {
+	a.socketMu.Lock()
+	defer a.socketMu.Unlock()
 	if a.socket != nil {
 		_ = a.socket.Close()
 		a.socket = nil
 	}
+	a.setHubUp(false)
+	a.setConnState(stateOffline, "", nil)
+}
+
+type activeProfile struct {
+	name       string
+	profile    *profileConfig
+	controlURL *url.URL
+}
+
+func (a *app) setActive(name string, profile *profileConfig, ctrl *url.URL) {
+	a.active.Store(&activeProfile{name: name, profile: profile, controlURL: ctrl})
+	a.uploadRate.Store(profile.UploadLimit)
+}
+
+func (a *app) profile() *profileConfig { return a.active.Load().profile }
+
+func (a *app) profileName() string { return a.active.Load().name }
+
+func (a *app) controlURL() *url.URL { return a.active.Load().controlURL }
+
+// updateProfile publishes a changed copy of the active profile, so a
+// goroutine still holding the old one never sees it change underneath it.
+// Must run on the GTK main loop.
+func (a *app) updateProfile(change func(p *profileConfig)) {
+	cur := a.active.Load()
+	p := cur.profile.clone()
+	change(p)
+	a.config.Profiles[cur.name] = p
+	a.setActive(cur.name, p, cur.controlURL)
+}
+
+// currentSocket may return nil; hubclient methods then fail with
+// ErrNotConnected.
+func (a *app) currentSocket() *hubclient.Client {
+	a.socketMu.Lock()
+	defer a.socketMu.Unlock()
+	return a.socket
 }
 
 func (a *app) socketAddress() (string, error) {
-	host := a.controlURL.Hostname()
-	if host == "" {
-		host = "127.0.0.1"
-	}
-	if portStr := os.Getenv("CLIENT_SOCKET_PORT"); portStr != "" {
-		port, err := strconv.Atoi(portStr)
-		if err != nil {
-			return "", fmt.Errorf("invalid CLIENT_SOCKET_PORT: %w", err)
-		}
-		return net.JoinHostPort(host, strconv.Itoa(port)), nil
-	}
-	portStr := a.controlURL.Port()
-	port := defaultControlPort
-	if portStr != "" {
-		p, err := strconv.Atoi(portStr)
-		if err != nil {
-			return "", fmt.Errorf("invalid control port: %w", err)
-		}
-		port = p
-	}
-	return net.JoinHostPort(host, strconv.Itoa(port+1)), nil
+	return hubclient.SocketAddress(a.controlURL())
 }
 
 func (a *app) socketRequest(action string, payload map[string]any, out interface{}) error {
-	if a.socket == nil {
-		return fmt.Errorf("socket not connected")
-	}
-	resp, err := a.socket.request(action, payload)
-	if err != nil {
-		return err
-	}
-	if out != nil && len(resp.Data) > 0 {
-		if err := json.Unmarshal(resp.Data, out); err != nil {
-			return err
-		}
-	}
-	return nil
+	return a.socketRequestCtx(a.ctx, action, payload, out)
+}
+
+func (a *app) socketRequestCtx(ctx context.Context, action string, payload map[string]any, out interface{}) error {
+	return a.currentSocket().Call(ctx, action, payload, out)
 }
 
-func (a *app) handleSocketEvent(msg socketMessage) {
+func (a *app) handleSocketEvent(msg hubclient.Message) {
 	switch msg.Event {
 	case "hello":
+		if a.currentSocket().JSONRPC() {
+			a.logf("socket framing: %s", hubclient.ProtocolJSONRPC)
+		}
 		if len(msg.Payload) > 0 {
 			var info map[string]interface{}
-			if err := json.Unmarshal(msg.Payload, &info); err == nil {
+			if err := msg.DecodePayload(&info); err == nil {
 				h, _ := info["host"].(string)
 				ts, _ := info["connectedAt"].(string)
 				if h != "" {
+					a.setHubHost(h)
 					a.logf("socket hello from %s (since %s)", h, ts)
 				} else {
-					a.logf("socket hello: %s", strings.TrimSpace(string(msg.Payload)))
+					a.logf("socket hello: %s", strings.TrimSpace(string(msg.JSONPayload())))
 				}
 			} else {
-				a.logf("socket hello: %s", strings.TrimSpace(string(msg.Payload)))
+				a.logf("socket hello: %s", strings.TrimSpace(string(msg.JSONPayload())))
 			}
 		} else {
 			a.logf("socket hello")
@@ -508,17 +1189,20 @@ func (a *app) handleSocketEvent(msg socketMessage) {
 		if len(msg.Payload) == 0 {
 			return
 		}
-		var status statusResponse
-		if err := json.Unmarshal(msg.Payload, &status); err != nil {
+		var status hubclient.Status
+		if err := msg.DecodePayload(&status); err != nil {
 			a.logf("socket status parse error: %v", err)
 			return
 		}
-		files, audioErr := parseAudioList(status.AudioList)
+		a.setHubHost(status.Host)
+		files, audioErr := audiolist.Parse(status.AudioList)
+		a.recordHubStatus(&status, audioCount(files, audioErr))
+		a.observeHubStatus(status.Connected)
 		glib.IdleAdd(func() bool {
-			if a.statusLabel != nil {
-				a.statusLabel.SetText(fmt.Sprintf("Status: %s (connected=%v)", status.Host, status.Connected))
-			}
+			a.refreshConnIndicator()
 			a.refreshAudioButtons(files, audioErr)
+			a.applyStatusPeers(&status)
+			a.showWhoami(status.Whoami)
 			return false
 		})
 		if len(files) > 0 {
@@ -539,12 +1223,13 @@ func (a *app) handleSocketEvent(msg socketMessage) {
 			return
 		}
 		var payload interface{}
-		if err := json.Unmarshal(msg.Payload, &payload); err != nil {
+		if err := msg.DecodePayload(&payload); err != nil {
 			a.logf("hub message decode error: %v", err)
 			return
 		}
 		encoded, _ := json.Marshal(payload)
 		a.logf("hub message: %s", encoded)
+		a.playChime(hubMessageChime(payload))
 	case "broadcast-play":
 		if len(msg.Payload) == 0 {
 			a.logf("broadcast-play event (no payload)")
@@ -556,7 +1241,7 @@ func (a *app) handleSocketEvent(msg socketMessage) {
 			Timestamp string `json:"timestamp"`
 			Self      bool   `json:"self"`
 		}
-		if err := json.Unmarshal(msg.Payload, &data); err != nil {
+		if err := msg.DecodePayload(&data); err != nil {
 			a.logf("broadcast-play parse error: %v", err)
 			return
 		}
@@ -564,25 +1249,67 @@ func (a *app) handleSocketEvent(msg socketMessage) {
 		if label == "" {
 			label = "unknown"
 		}
+		a.recordRecentPlay(data.Filename, data.From, data.Timestamp, data.Self)
+		a.countPlay(data.Filename)
 		if data.Self {
 			a.logf("broadcast play acknowledged: %s (self)", data.Filename)
+		} else if a.dndActive() {
+			a.logf("broadcast play from %s: %s (do not disturb)", label, data.Filename)
+			return
 		} else {
 			a.logf("broadcast play from %s: %s", label, data.Filename)
+			a.playChime("broadcast-play")
 		}
+		if a.archiveEnabled.Load() && data.Filename != "" {
+			go a.archiveBroadcast(data.Filename)
+		}
+	case "clipboard":
+		a.handleClipboardEvent(msg.JSONPayload())
+	case "kv":
+		a.handleKVEvent(msg.JSONPayload())
+	case "broadcast-image":
+		go a.handleImageEvent(msg.JSONPayload())
+	case "command-output", "command-done":
+		a.handleCommandEvent(msg)
+	case "peer-control":
+		a.handlePeerControlEvent(msg.JSONPayload())
+	case "zone":
+		a.handleZoneEvent(msg.JSONPayload())
+	case "broadcast-stop":
+		a.handleBroadcastStopEvent(msg.JSONPayload())
+	case "now-playing":
+		a.handleNowPlaying(msg.JSONPayload())
+	case "peer-files-request":
+		a.handlePeerFilesRequest(msg.JSONPayload())
+	case "peer-upload-request":
+		a.handlePeerUploadRequest(msg.JSONPayload())
+	case "audio-stream":
+		a.handleAudioStream(msg.JSONPayload())
+	case "transfer-offer":
+		a.handleTransferOffer(msg.JSONPayload())
+	case "transfer-answer":
+		a.handleTransferAnswer(msg.JSONPayload())
+	case "transfer-cancel":
+		a.handleTransferCancel(msg.JSONPayload())
 	case "log":
 		if len(msg.Payload) == 0 {
-			a.logf("log event received")
 			return
 		}
-		a.logf("log event: %s", strings.TrimSpace(string(msg.Payload)))
+		a.handleLogEvent(msg.JSONPayload())
 	case "error":
-		if msg.Error != "" {
+		if msg.Error != nil {
 			a.logf("socket error event: %s", msg.Error)
 		} else {
 			a.logf("socket error event")
 		}
+	case hubclient.EventSchemaViolation:
+		a.handleSchemaViolation(msg.Payload)
 	case "disconnect":
-		if msg.Error != "" {
+		a.telemetry.add("brain.client.disconnects", 1, nil)
+		a.metrics.Add(metricDisconnects, nil, 1)
+		a.setHubUp(false)
+		a.streamLost()
+		if msg.Error != nil {
 			a.logf("socket disconnected: %s", msg.Error)
 		} else {
 			a.logf("socket disconnected")
@@ -598,55 +1325,123 @@ func (a *app) refreshAudioButtons(files []audioFile, errMsg string) {
 	}
 	a.clearAudioButtons()
 	if errMsg != "" {
-		if err := a.setAudioPlaceholder(fmt.Sprintf("Audio error: %s", errMsg)); err != nil {
+		if err := a.setAudioPlaceholder(fmt.Sprintf(tr("Audio error: %s"), errMsg)); err != nil {
 			a.logf("audio placeholder error: %v", err)
 		}
 		return
 	}
+	a.audioFiles = files
+	a.updateBreadcrumb()
 	if len(files) == 0 {
-		if err := a.setAudioPlaceholder("No audio files found"); err != nil {
+		if err := a.setAudioPlaceholder(tr("No audio files found")); err != nil {
 			a.logf("audio placeholder error: %v", err)
 		}
 		return
 	}
-	for _, f := range files {
-		label := formatAudioButtonLabel(f)
-		btn, err := gtk.ButtonNewWithLabel(label)
-		if err != nil {
-			a.logf("audio button create error: %v", err)
-			continue
+	neverPlayed := a.profile().NeverPlayedOnly && a.playCountsKnown
+	shown := filterAudioFiles(sortAudioFiles(a.withPlayCounts(a.withTags(files)), a.profile().AudioSort), a.profile().FavoritesOnly, neverPlayed, a.audioFilter)
+	direct, subfolders := splitFolder(shown, a.audioFolder)
+	for _, sub := range subfolders {
+		a.addFolderGroup(sub)
+	}
+	if len(direct) == 0 && len(subfolders) == 0 {
+		if err := a.setAudioPlaceholder(tr("No matching audio files")); err != nil {
+			a.logf("audio placeholder error: %v", err)
+		}
+		return
+	}
+	for _, f := range direct {
+		if item := a.newAudioItem(f, folderBase(f.Name)); item != nil {
+			a.audioFlow.Add(item)
+			item.ShowAll()
+			a.audioItems = append(a.audioItems, item)
 		}
-		btn.SetTooltipText(fmt.Sprintf("Broadcast play %s", f.Name))
-		filename := f.Name
-		btn.SetHExpand(false)
-		btn.SetVExpand(false)
-		btn.SetHAlign(gtk.ALIGN_FILL)
-		btn.SetVAlign(gtk.ALIGN_CENTER)
-		btn.SetMarginStart(4)
-		btn.SetMarginEnd(4)
-		btn.SetMarginTop(2)
-		btn.SetMarginBottom(2)
-		btn.SetSizeRequest(220, 36)
-		btn.Connect("clicked", func() {
-			a.logf("broadcast play requested: %s", filename)
-			go a.invokeBroadcastPlay(filename)
-		})
-		a.audioFlow.Add(btn)
-		btn.ShowAll()
-		a.audioButtons = append(a.audioButtons, btn)
 	}
 	a.audioFlow.ShowAll()
 }
 
+// newAudioItem is the star and broadcast-play button for f, labelled with
+// shown in place of its full name.
+func (a *app) newAudioItem(f audioFile, shown string) *gtk.Box {
+	labelled := f
+	labelled.Name = shown
+	label := formatAudioButtonLabel(labelled)
+	if keys := a.soundboardLabel(f.Name); keys != "" {
+		label = "[" + keys + "] " + label
+	}
+	btn, err := newAudioButton(label, a.cachedWaveform(f.Name))
+	if err != nil {
+		a.logf("audio button create error: %v", err)
+		return nil
+	}
+	tooltip := fmt.Sprintf(tr("Broadcast play %s"), f.Name)
+	if details := audioTagDetails(f); details != "" {
+		tooltip += "\n" + details
+	}
+	if tags := visibleTags(f.Tags); len(tags) > 0 {
+		tooltip += "\n" + fmt.Sprintf(tr("Tags: %s"), strings.Join(tags, ", "))
+	}
+	if f.ExpiresAt != "" {
+		tooltip += "\n" + fmt.Sprintf(tr("Temporary: expires %s"), f.ExpiresAt)
+	}
+	btn.SetTooltipText(tooltip)
+	// the label packs size and date after the name; screen readers
+	// hear the action first and get the details as a description
+	setAccessible(btn, fmt.Sprintf(tr("Broadcast play %s"), f.Name), label)
+	addStyleClass(btn, "audio-button")
+	if f.ExpiresAt != "" {
+		addStyleClass(btn, "temporary")
+	}
+	filename := f.Name
+	btn.SetHExpand(false)
+	btn.SetVExpand(false)
+	btn.SetHAlign(gtk.ALIGN_FILL)
+	btn.SetVAlign(gtk.ALIGN_CENTER)
+	btn.SetMarginStart(4)
+	btn.SetMarginEnd(4)
+	btn.SetMarginTop(2)
+	btn.SetMarginBottom(2)
+	btn.SetSizeRequest(220, 36)
+	a.attachAudioMenu(btn, f)
+	var check *gtk.CheckButton
+	if a.audioSelecting {
+		check = a.newAudioSelectCheck(filename)
+	}
+	btn.Connect("clicked", func() {
+		if check != nil {
+			check.SetActive(!check.GetActive())
+			return
+		}
+		a.logf("broadcast play requested: %s", filename)
+		go a.invokeBroadcastPlay(filename)
+	})
+	item, err := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 0)
+	if err != nil {
+		a.logf("audio button create error: %v", err)
+		return nil
+	}
+	if check != nil {
+		item.PackStart(check, false, false, 0)
+	}
+	item.PackStart(a.newFavoriteToggle(f), false, false, 0)
+	item.PackStart(btn, true, true, 0)
+	return item
+}
+
 func (a *app) clearAudioButtons() {
 	if a.audioFlow == nil {
 		return
 	}
-	for _, btn := range a.audioButtons {
-		a.audioFlow.Remove(btn)
-		btn.Destroy()
+	for _, item := range a.audioItems {
+		a.audioFlow.Remove(item)
+		item.Destroy()
+	}
+	a.audioItems = nil
+	for _, group := range a.audioFolderGroups {
+		a.audioFolderBox.Remove(group)
+		group.Destroy()
 	}
-	a.audioButtons = nil
+	a.audioFolderGroups = nil
 	if a.audioPlaceholder != nil {
 		a.audioFlow.Remove(a.audioPlaceholder)
 		a.audioPlaceholder.Destroy()
@@ -679,107 +1474,11 @@ func (a *app) setAudioPlaceholder(message string) error {
 	return nil
 }
 
-func parseAudioList(raw interface{}) ([]audioFile, string) {
-	if raw == nil {
-		return nil, ""
-	}
-	switch val := raw.(type) {
-	case map[string]interface{}:
-		if errText, ok := val["error"].(string); ok && errText != "" {
-			return nil, errText
-		}
-		if result, ok := val["result"]; ok {
-			return parseAudioList(result)
-		}
-		if filesVal, ok := val["files"]; ok {
-			return parseAudioList(filesVal)
-		}
-		if name, ok := val["name"].(string); ok && name != "" {
-			file := audioFile{Name: name}
-			if sizePtr := parseAudioSize(val["size"]); sizePtr != nil {
-				file.Size = sizePtr
-			}
-			if uploaded, ok := val["uploaded"].(string); ok {
-				file.Uploaded = uploaded
-			}
-			return []audioFile{file}, ""
-		}
-		if key, ok := val["key"].(string); ok && key != "" {
-			file := audioFile{Name: key}
-			if sizePtr := parseAudioSize(val["size"]); sizePtr != nil {
-				file.Size = sizePtr
-			}
-			if uploaded, ok := val["uploaded"].(string); ok {
-				file.Uploaded = uploaded
-			}
-			return []audioFile{file}, ""
-		}
-		return nil, ""
-	case []interface{}:
-		files := make([]audioFile, 0, len(val))
-		for _, item := range val {
-			switch entry := item.(type) {
-			case string:
-				if entry != "" {
-					files = append(files, audioFile{Name: entry})
-				}
-			case map[string]interface{}:
-				name, _ := entry["name"].(string)
-				if name == "" {
-					name, _ = entry["key"].(string)
-				}
-				if name == "" {
-					continue
-				}
-				file := audioFile{Name: name}
-				if sizePtr := parseAudioSize(entry["size"]); sizePtr != nil {
-					file.Size = sizePtr
-				}
-				if uploaded, ok := entry["uploaded"].(string); ok {
-					file.Uploaded = uploaded
-				}
-				files = append(files, file)
-			}
-		}
-		return files, ""
-	default:
-		return nil, ""
-	}
-}
-
-func parseAudioSize(value interface{}) *int64 {
-	switch n := value.(type) {
-	case float64:
-		size := int64(n)
-		return &size
-	case float32:
-		size := int64(n)
-		return &size
-	case int:
-		size := int64(n)
-		return &size
-	case int64:
-		size := n
-		return &size
-	case int32:
-		size := int64(n)
-		return &size
-	case uint64:
-		size := int64(n)
-		return &size
-	case uint32:
-		size := int64(n)
-		return &size
-	case json.Number:
-		if parsed, err := n.Int64(); err == nil {
-			return &parsed
-		}
-	}
-	return nil
-}
-
 func formatAudioButtonLabel(file audioFile) string {
-	parts := []string{file.Name}
+	parts := []string{audioDisplayName(file)}
+	if file.Duration > 0 {
+		parts = append(parts, fmt.Sprintf("[%d:%02d]", file.Duration/60, file.Duration%60))
+	}
 	if file.Size != nil && *file.Size > 0 {
 		parts = append(parts, fmt.Sprintf("(%s)", formatBytes(*file.Size)))
 	}
@@ -790,6 +1489,12 @@ func formatAudioButtonLabel(file audioFile) string {
 			parts = append(parts, fmt.Sprintf("@ %s", file.Uploaded))
 		}
 	}
+	if file.ExpiresAt != "" {
+		parts = append(parts, "⏳")
+	}
+	if file.Plays > 0 {
+		parts = append(parts, fmt.Sprintf("▶%d", file.Plays))
+	}
 	return strings.Join(parts, " ")
 }
 
@@ -810,21 +1515,3 @@ func formatBytes(size int64) string {
 	}
 	return fmt.Sprintf("%.*f %s", precision, value, units[unit])
 }
-
-func detectContentType(name string) string {
-	lower := strings.ToLower(name)
-	switch {
-	case strings.HasSuffix(lower, ".mp3"):
-		return "audio/mpeg"
-	case strings.HasSuffix(lower, ".wav"):
-		return "audio/wav"
-	case strings.HasSuffix(lower, ".ogg"):
-		return "audio/ogg"
-	case strings.HasSuffix(lower, ".flac"):
-		return "audio/flac"
-	case strings.HasSuffix(lower, ".m4a"):
-		return "audio/mp4"
-	default:
-		return "application/octet-stream"
-	}
-}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"brain/internal/hubclient"
+)
+
+// defaultDownloader extracts a page's audio as MP3 with yt-dlp, writing
+// the page's description beside it for the tags.
+var defaultDownloader = []string{
+	"yt-dlp", "--no-playlist", "--newline", "--extract-audio", "--audio-format", "mp3",
+	"--max-filesize", "{maxsize}", "--write-info-json", "-o", "{dir}/%(title)s.%(ext)s", "{url}",
+}
+
+var downloadPercent = regexp.MustCompile(`(\d+(?:\.\d+)?)%`)
+
+// mediaInfo is what Add from URL reads from a yt-dlp style .info.json.
+type mediaInfo struct {
+	Title    string  `json:"title"`
+	Track    string  `json:"track"`
+	Artist   string  `json:"artist"`
+	Creator  string  `json:"creator"`
+	Uploader string  `json:"uploader"`
+	Channel  string  `json:"channel"`
+	Album    string  `json:"album"`
+	Duration float64 `json:"duration"`
+}
+
+// downloaderCommand is the profile's media downloader, or yt-dlp, and
+// whether it is installed.
+func (a *app) downloaderCommand() ([]string, bool) {
+	args := defaultDownloader
+	if custom, err := splitCommand(a.profile().Downloader); err == nil && len(custom) > 0 {
+		args = custom
+	}
+	_, err := exec.LookPath(args[0])
+	return args, err == nil
+}
+
+// splitCommand splits a command line into words the way a POSIX shell
+// would, honouring single and double quotes and backslash escapes, so
+// paths with spaces survive.
+func splitCommand(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+	for _, r := range line {
+		switch {
+		case escaped:
+			word.WriteRune(r)
+			escaped = false
+		case r == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				word.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inWord = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote", quote)
+	}
+	if escaped {
+		return nil, fmt.Errorf("trailing backslash")
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// extractURLAudio runs the media downloader on raw and returns the audio
+// file it left, moved to the upload cache, with the name it gave it and
+// the tags from its .info.json, if any. progress gets the download's
+// fraction, or -1 while the downloader converts.
+func (a *app) extractURLAudio(ctx context.Context, raw string, progress func(float64)) (string, string, *hubclient.AudioMeta, error) {
+	args, ok := a.downloaderCommand()
+	if !ok {
+		return "", "", nil, fmt.Errorf("no media downloader: install %s or set one in Preferences", args[0])
+	}
+	base, err := transcodeDir()
+	if err != nil {
+		return "", "", nil, err
+	}
+	if err := os.MkdirAll(base, 0o755); err != nil {
+		return "", "", nil, err
+	}
+	dir, err := os.MkdirTemp(base, "extract-*")
+	if err != nil {
+		return "", "", nil, err
+	}
+	defer os.RemoveAll(dir)
+	fill := strings.NewReplacer("{url}", raw, "{dir}", dir, "{maxsize}", strconv.Itoa(urlImportMaxSize))
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = fill.Replace(arg)
+	}
+	a.logf("extracting audio from %s with %s", raw, args[0])
+	cmd := exec.CommandContext(ctx, expanded[0], expanded[1:]...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", "", nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", "", nil, err
+	}
+	lines := bufio.NewScanner(stdout)
+	for lines.Scan() {
+		line := lines.Text()
+		switch {
+		case strings.HasPrefix(line, "[download]"):
+			if m := downloadPercent.FindStringSubmatch(line); m != nil {
+				if pct, err := strconv.ParseFloat(m[1], 64); err == nil {
+					progress(pct / 100)
+				}
+			}
+		case strings.HasPrefix(line, "[ExtractAudio]"), strings.HasPrefix(line, "[Metadata]"):
+			progress(-1)
+		}
+	}
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return "", "", nil, ctx.Err()
+		}
+		msg := strings.TrimSpace(stderr.String())
+		if i := strings.LastIndexByte(msg, '\n'); i >= 0 {
+			msg = msg[i+1:]
+		}
+		if msg != "" {
+			return "", "", nil, fmt.Errorf("%s: %w: %s", args[0], err, msg)
+		}
+		return "", "", nil, fmt.Errorf("%s: %w", args[0], err)
+	}
+
+	// the largest audio file is the one wanted; thumbnails and the like
+	// are left behind
+	var audio string
+	var size int64
+	var meta *hubclient.AudioMeta
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.Type().IsRegular() {
+			return err
+		}
+		if strings.HasSuffix(p, ".info.json") {
+			if m := readMediaInfo(p); m != nil {
+				meta = m
+			}
+			return nil
+		}
+		info, err := d.Info()
+		if err == nil && strings.HasPrefix(hubclient.ContentType(p), "audio/") && info.Size() > size {
+			audio, size = p, info.Size()
+		}
+		return nil
+	})
+	if audio == "" {
+		return "", "", nil, fmt.Errorf("%s left no audio file for %s", args[0], raw)
+	}
+	if size > urlImportMaxSize {
+		return "", "", nil, fmt.Errorf("audio from %s is %s, over the %s limit", raw, formatBytes(size), formatBytes(urlImportMaxSize))
+	}
+	out, err := os.CreateTemp(base, "*"+filepath.Ext(audio))
+	if err != nil {
+		return "", "", nil, err
+	}
+	out.Close()
+	if err := os.Rename(audio, out.Name()); err != nil {
+		os.Remove(out.Name())
+		return "", "", nil, err
+	}
+	a.recordTransfer("download", "extract", size)
+	return out.Name(), filepath.Base(audio), meta, nil
+}
+
+// readMediaInfo turns a .info.json into tags, or nil if it has none.
+func readMediaInfo(path string) *hubclient.AudioMeta {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var info mediaInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil
+	}
+	first := func(values ...string) string {
+		for _, v := range values {
+			if v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	meta := &hubclient.AudioMeta{
+		Title:    first(info.Track, info.Title),
+		Artist:   first(info.Artist, info.Creator, info.Uploader, info.Channel),
+		Album:    info.Album,
+		Duration: info.Duration,
+	}
+	if *meta == (hubclient.AudioMeta{}) {
+		return nil
+	}
+	return meta
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+)
+
+// mixerStrip is one peer's slider in the Mixer tab.
+type mixerStrip struct {
+	scale *gtk.Scale
+	state *gtk.Label
+	timer *time.Timer
+}
+
+// mixerPanel is the Mixer tab: one slider per peer setting the volume the
+// hub stores for it, which broadcast-play uses. All fields are owned by the
+// GTK main loop.
+type mixerPanel struct {
+	host    *panelHost
+	summary *gtk.Label
+	strips  *gtk.Box
+	byPeer  map[string]*mixerStrip
+	// syncing is set while a slider moves to a value the hub sent, so the
+	// move is not sent back
+	syncing bool
+}
+
+func init() { registerPanel(30, &mixerPanel{}) }
+
+func (p *mixerPanel) Title() string { return tr("Mixer") }
+
+func (p *mixerPanel) Build(host *panelHost) gtk.IWidget {
+	p.host = host
+	p.byPeer = make(map[string]*mixerStrip)
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+	bar, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	box.PackStart(bar, false, false, 0)
+	refreshBtn, _ := gtk.ButtonNewWithLabel(tr("Refresh"))
+	setAccessible(refreshBtn, tr("Reload peers and their volumes"), "")
+	refreshBtn.Connect("clicked", func() { go p.fetch(p.host.Client()) })
+	bar.PackStart(refreshBtn, false, false, 0)
+	p.summary, _ = gtk.LabelNew(tr("Not connected"))
+	bar.PackEnd(p.summary, false, false, 0)
+
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_NEVER)
+	scroll.SetVExpand(true)
+	box.PackStart(scroll, true, true, 0)
+	p.strips, _ = gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 12)
+	p.strips.SetBorderWidth(6)
+	host.GateOnRole("peer-config-set", p.strips)
+	scroll.Add(p.strips)
+	hint, _ := gtk.LabelNew(tr("Each peer plays broadcasts at its own level; peers never set use their player's volume."))
+	hint.SetXAlign(0)
+	hint.SetLineWrap(true)
+	addStyleClass(hint, "dim-label")
+	box.PackStart(hint, false, false, 0)
+	return box
+}
+
+func (p *mixerPanel) Connected(client *hubclient.Client) {
+	p.clear()
+	if !client.Supports(protocol.CapPeerConfig) {
+		p.summary.SetText(tr("This hub does not store peer volumes"))
+		return
+	}
+	go p.fetch(client)
+}
+
+func (p *mixerPanel) Disconnected(error) {
+	p.clear()
+	p.summary.SetText(tr("Not connected"))
+}
+
+// Event moves a slider when anyone changes that peer's volume.
+func (p *mixerPanel) Event(msg hubclient.Message) {
+	if msg.Event != protocol.EventPeerConfig {
+		return
+	}
+	var cfg hubclient.PeerConfig
+	if err := json.Unmarshal(msg.JSONPayload(), &cfg); err != nil {
+		p.host.Logf("peer-config event parse error: %v", err)
+		return
+	}
+	if p.byPeer[cfg.Peer] == nil {
+		p.addStrip(peerInfo{ID: cfg.Peer})
+	}
+	p.showConfig(cfg)
+}
+
+func (p *mixerPanel) clear() {
+	for _, s := range p.byPeer {
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+	}
+	p.byPeer = make(map[string]*mixerStrip)
+	if children := p.strips.GetChildren(); children != nil {
+		children.Foreach(func(item interface{}) {
+			if w, ok := item.(*gtk.Widget); ok {
+				w.Destroy()
+			}
+		})
+	}
+}
+
+func (p *mixerPanel) fetch(client *hubclient.Client) {
+	if !client.Supports(protocol.CapPeerConfig) {
+		return
+	}
+	result, err := client.Command(p.host.Context(), "peers")
+	if err != nil {
+		p.host.ReportError("peers", err, func() { p.fetch(p.host.Client()) })
+		return
+	}
+	configs, err := client.PeerConfigs(p.host.Context())
+	if err != nil {
+		p.host.ReportError("peer volumes", err, func() { p.fetch(p.host.Client()) })
+		return
+	}
+	peers := parsePeerList(result)
+	glib.IdleAdd(func() bool {
+		p.clear()
+		for _, peer := range peers {
+			p.addStrip(peer)
+		}
+		for _, cfg := range configs {
+			if p.byPeer[cfg.Peer] == nil {
+				p.addStrip(peerInfo{ID: cfg.Peer})
+			}
+			p.showConfig(cfg)
+		}
+		p.strips.ShowAll()
+		p.summary.SetText(fmt.Sprintf(tr("%d peers, %d with a stored volume"), len(p.byPeer), len(configs)))
+		return false
+	})
+}
+
+func (p *mixerPanel) addStrip(peer peerInfo) {
+	strip, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+	name, _ := gtk.LabelNew(peerTitle(peer))
+	name.SetTooltipText(peer.ID)
+	name.SetMaxWidthChars(12)
+	name.SetEllipsize(pango.ELLIPSIZE_END)
+	strip.PackStart(name, false, false, 0)
+	scale, _ := gtk.ScaleNewWithRange(gtk.ORIENTATION_VERTICAL, 0, protocol.MaxPeerVolume, 1)
+	scale.SetInverted(true)
+	scale.SetValue(protocol.MaxPeerVolume)
+	scale.SetVExpand(true)
+	scale.SetSizeRequest(-1, 160)
+	setAccessible(scale, fmt.Sprintf(tr("Volume of %s"), peerTitle(peer)), "")
+	strip.PackStart(scale, true, true, 0)
+	state, _ := gtk.LabelNew(tr("not set"))
+	addStyleClass(state, "dim-label")
+	strip.PackStart(state, false, false, 0)
+	p.strips.PackStart(strip, false, false, 0)
+	strip.ShowAll()
+
+	s := &mixerStrip{scale: scale, state: state}
+	p.byPeer[peer.ID] = s
+	id := peer.ID
+	scale.Connect("value-changed", func() {
+		if p.syncing {
+			return
+		}
+		// only send the value the slider settles on
+		if s.timer != nil {
+			s.timer.Stop()
+		}
+		level := int(scale.GetValue())
+		s.timer = time.AfterFunc(volumeDebounce, func() { p.setVolume(id, level) })
+	})
+}
+
+// showConfig moves a peer's slider to its stored volume.
+func (p *mixerPanel) showConfig(cfg hubclient.PeerConfig) {
+	s := p.byPeer[cfg.Peer]
+	if s == nil || cfg.Volume == nil {
+		return
+	}
+	p.syncing = true
+	s.scale.SetValue(float64(*cfg.Volume))
+	p.syncing = false
+	s.state.SetText(fmt.Sprintf("%d%%", *cfg.Volume))
+	if cfg.UpdatedBy != "" {
+		s.state.SetTooltipText(fmt.Sprintf(tr("Set by %s"), p.host.PeerName(cfg.UpdatedBy)))
+	}
+}
+
+func (p *mixerPanel) setVolume(peer string, level int) {
+	if _, err := p.host.Client().SetPeerVolume(p.host.Context(), peer, level); err != nil {
+		p.host.ReportError("peer volume", err, func() { p.setVolume(peer, level) })
+		return
+	}
+	p.host.Logf("peer %s volume %d%%", peer, level)
+}
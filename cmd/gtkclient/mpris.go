@@ -0,0 +1,369 @@
+package main
+
+// #include <stdlib.h>
+// #include <gio/gio.h>
+//
+// extern gboolean brain_mpris_register(GDBusConnection *conn, const char *path, const char *xml, char **error);
+// extern guint brain_dbus_own_name(GDBusConnection *conn, const char *name);
+// extern char *brain_dbus_string_arg(GVariant *params, int index);
+// extern void brain_dbus_return_empty(GDBusMethodInvocation *inv);
+// extern void brain_dbus_return_error(GDBusMethodInvocation *inv, const char *name, const char *message);
+// extern GVariant *brain_mpris_metadata(const char *trackid, const char *title, const char *artist, gint64 length);
+// extern GVariant *brain_mpris_empty_strv(void);
+// extern void brain_mpris_emit_changed(GDBusConnection *conn, const char *path, const char *iface, const char *const *names, GVariant **values, int n);
+// extern void brain_mpris_emit_seeked(GDBusConnection *conn, const char *path, gint64 position);
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"unsafe"
+)
+
+const (
+	mprisName   = "org.mpris.MediaPlayer2.brain"
+	mprisPath   = "/org/mpris/MediaPlayer2"
+	mprisRoot   = "org.mpris.MediaPlayer2"
+	mprisPlayer = "org.mpris.MediaPlayer2.Player"
+	// mprisSeekSlack is how far a reported position may drift from the
+	// extrapolated one before it counts as a seek.
+	mprisSeekSlack = 1.5
+)
+
+const mprisXML = `<node>
+  <interface name="org.mpris.MediaPlayer2">
+    <method name="Raise"/>
+    <method name="Quit"/>
+    <property name="CanQuit" type="b" access="read"/>
+    <property name="CanRaise" type="b" access="read"/>
+    <property name="HasTrackList" type="b" access="read"/>
+    <property name="Identity" type="s" access="read"/>
+    <property name="DesktopEntry" type="s" access="read"/>
+    <property name="SupportedUriSchemes" type="as" access="read"/>
+    <property name="SupportedMimeTypes" type="as" access="read"/>
+  </interface>
+  <interface name="org.mpris.MediaPlayer2.Player">
+    <method name="Next"/>
+    <method name="Previous"/>
+    <method name="Pause"/>
+    <method name="PlayPause"/>
+    <method name="Stop"/>
+    <method name="Play"/>
+    <method name="Seek"><arg name="Offset" type="x" direction="in"/></method>
+    <method name="SetPosition">
+      <arg name="TrackId" type="o" direction="in"/>
+      <arg name="Position" type="x" direction="in"/>
+    </method>
+    <method name="OpenUri"><arg name="Uri" type="s" direction="in"/></method>
+    <signal name="Seeked"><arg name="Position" type="x"/></signal>
+    <property name="PlaybackStatus" type="s" access="read"/>
+    <property name="Rate" type="d" access="readwrite"/>
+    <property name="Metadata" type="a{sv}" access="read"/>
+    <property name="Volume" type="d" access="readwrite"/>
+    <property name="Position" type="x" access="read"/>
+    <property name="MinimumRate" type="d" access="read"/>
+    <property name="MaximumRate" type="d" access="read"/>
+    <property name="CanGoNext" type="b" access="read"/>
+    <property name="CanGoPrevious" type="b" access="read"/>
+    <property name="CanPlay" type="b" access="read"/>
+    <property name="CanPause" type="b" access="read"/>
+    <property name="CanSeek" type="b" access="read"/>
+    <property name="CanControl" type="b" access="read"/>
+  </interface>
+</node>`
+
+// mprisService presents the hub's playback as a media player so desktop
+// media controls and play/pause keys reach it. Only the GTK main loop
+// touches it.
+type mprisService struct {
+	conn *C.GDBusConnection
+	// owner is the bus name's ownership id, taken once a track is known.
+	owner C.guint
+
+	track   *nowPlaying
+	trackID string
+	seq     int
+	// sent holds the last value of each property signalled as changed.
+	sent map[string]string
+}
+
+// startMPRIS exports the player on conn. The bus name, which makes
+// desktops show it, is only claimed once something plays.
+func (a *app) startMPRIS(conn *C.GDBusConnection) {
+	path := C.CString(mprisPath)
+	defer C.free(unsafe.Pointer(path))
+	xml := C.CString(mprisXML)
+	defer C.free(unsafe.Pointer(xml))
+	var cerr *C.char
+	if C.brain_mpris_register(conn, path, xml, &cerr) == 0 {
+		a.logf("MPRIS player disabled: %s", C.GoString(cerr))
+		C.g_free(C.gpointer(unsafe.Pointer(cerr)))
+		return
+	}
+	a.mpris = &mprisService{conn: conn, sent: make(map[string]string)}
+}
+
+// mprisTrack picks the track media controls act on: this client's own
+// playback, else the one most recently reported.
+func (a *app) mprisTrack() *nowPlaying {
+	var latest *nowPlaying
+	for _, np := range a.nowPlaying {
+		if np.Self {
+			return np
+		}
+		if latest == nil || np.received.After(latest.received) {
+			latest = np
+		}
+	}
+	return latest
+}
+
+// updateMPRIS follows a.nowPlaying, claiming the bus name on the first
+// track and signalling what changed. Must run on the GTK main loop.
+func (a *app) updateMPRIS() {
+	m := a.mpris
+	if m == nil {
+		return
+	}
+	track := a.mprisTrack()
+	if track != nil && m.owner == 0 {
+		name := C.CString(mprisName)
+		defer C.free(unsafe.Pointer(name))
+		m.owner = C.brain_dbus_own_name(m.conn, name)
+		a.logf("MPRIS player: %s", mprisName)
+	}
+	if track != nil && m.track != nil && peerLabel(*track) == peerLabel(*m.track) && track.Filename == m.track.Filename {
+		if track != m.track && math.Abs(track.Position-m.track.currentPosition()) > mprisSeekSlack {
+			m.emitSeeked(track.currentPosition())
+		}
+	} else if track != nil {
+		m.seq++
+		m.trackID = fmt.Sprintf("/org/brain/track/%d", m.seq)
+	}
+	if track != nil {
+		m.track = track
+	} else if m.track != nil {
+		// keep the last title for the stopped state
+		stopped := *m.track
+		stopped.State = "stopped"
+		m.track = &stopped
+	}
+	if m.owner == 0 {
+		return
+	}
+	var names []string
+	for _, name := range []string{"PlaybackStatus", "Metadata", "Volume", "CanPlay", "CanPause", "CanSeek"} {
+		value := a.mprisProperty(mprisPlayer, name)
+		if value == nil {
+			continue
+		}
+		printed := C.g_variant_print(value, 0)
+		text := C.GoString((*C.char)(printed))
+		C.g_free(C.gpointer(unsafe.Pointer(printed)))
+		C.g_variant_unref(C.g_variant_ref_sink(value))
+		if m.sent[name] != text {
+			m.sent[name] = text
+			names = append(names, name)
+		}
+	}
+	m.emitChanged(a, names)
+}
+
+func (m *mprisService) emitChanged(a *app, names []string) {
+	if len(names) == 0 {
+		return
+	}
+	path := C.CString(mprisPath)
+	defer C.free(unsafe.Pointer(path))
+	iface := C.CString(mprisPlayer)
+	defer C.free(unsafe.Pointer(iface))
+	cnames := C.malloc(C.size_t(len(names)) * C.size_t(unsafe.Sizeof(uintptr(0))))
+	defer C.free(cnames)
+	cvalues := C.malloc(C.size_t(len(names)) * C.size_t(unsafe.Sizeof(uintptr(0))))
+	defer C.free(cvalues)
+	nameSlice := unsafe.Slice((**C.char)(cnames), len(names))
+	valueSlice := unsafe.Slice((**C.GVariant)(cvalues), len(names))
+	for i, name := range names {
+		nameSlice[i] = C.CString(name)
+		defer C.free(unsafe.Pointer(nameSlice[i]))
+		valueSlice[i] = a.mprisProperty(mprisPlayer, name)
+	}
+	C.brain_mpris_emit_changed(m.conn, path, iface, (**C.char)(cnames), (**C.GVariant)(cvalues), C.int(len(names)))
+}
+
+func (m *mprisService) emitSeeked(position float64) {
+	path := C.CString(mprisPath)
+	defer C.free(unsafe.Pointer(path))
+	C.brain_mpris_emit_seeked(m.conn, path, C.gint64(position*1e6))
+}
+
+func mprisStatus(np *nowPlaying) string {
+	switch {
+	case np == nil:
+		return "Stopped"
+	case np.State == "paused":
+		return "Paused"
+	case np.State == "stopped" || np.State == "ended":
+		return "Stopped"
+	}
+	return "Playing"
+}
+
+// mprisProperty returns a new floating GVariant, or nil for an unknown
+// property.
+func (a *app) mprisProperty(iface, name string) *C.GVariant {
+	m := a.mpris
+	boolean := func(b bool) *C.GVariant {
+		if b {
+			return C.g_variant_new_boolean(1)
+		}
+		return C.g_variant_new_boolean(0)
+	}
+	str := func(s string) *C.GVariant {
+		cs := C.CString(s)
+		defer C.free(unsafe.Pointer(cs))
+		return C.g_variant_new_string(cs)
+	}
+	active := m != nil && m.track != nil && mprisStatus(m.track) != "Stopped"
+	switch iface + "." + name {
+	case mprisRoot + ".CanQuit", mprisRoot + ".HasTrackList":
+		return boolean(false)
+	case mprisRoot + ".CanRaise":
+		return boolean(true)
+	case mprisRoot + ".Identity":
+		return str(tr("Brain Hub"))
+	case mprisRoot + ".DesktopEntry":
+		return str(appID)
+	case mprisRoot + ".SupportedUriSchemes", mprisRoot + ".SupportedMimeTypes":
+		return C.brain_mpris_empty_strv()
+	case mprisPlayer + ".PlaybackStatus":
+		var track *nowPlaying
+		if m != nil {
+			track = m.track
+		}
+		return str(mprisStatus(track))
+	case mprisPlayer + ".Rate", mprisPlayer + ".MinimumRate", mprisPlayer + ".MaximumRate":
+		return C.g_variant_new_double(1)
+	case mprisPlayer + ".Metadata":
+		trackID, title, artist, length := "/org/mpris/MediaPlayer2/TrackList/NoTrack", "", "", int64(0)
+		if m != nil && m.track != nil {
+			trackID, title, length = m.trackID, m.track.Filename, int64(m.track.Duration*1e6)
+			artist = peerLabel(*m.track)
+		}
+		ctrack := C.CString(trackID)
+		defer C.free(unsafe.Pointer(ctrack))
+		ctitle := C.CString(title)
+		defer C.free(unsafe.Pointer(ctitle))
+		cartist := C.CString(artist)
+		defer C.free(unsafe.Pointer(cartist))
+		return C.brain_mpris_metadata(ctrack, ctitle, cartist, C.gint64(length))
+	case mprisPlayer + ".Volume":
+		volume := 1.0
+		if a.volumeScale != nil {
+			volume = a.volumeScale.GetValue() / 100
+		}
+		return C.g_variant_new_double(C.gdouble(volume))
+	case mprisPlayer + ".Position":
+		position := 0.0
+		if active {
+			position = m.track.currentPosition()
+		}
+		return C.g_variant_new_int64(C.gint64(position * 1e6))
+	case mprisPlayer + ".CanGoNext", mprisPlayer + ".CanGoPrevious":
+		return boolean(false)
+	case mprisPlayer + ".CanPlay", mprisPlayer + ".CanPause", mprisPlayer + ".CanSeek":
+		return boolean(active)
+	case mprisPlayer + ".CanControl":
+		return boolean(true)
+	}
+	return nil
+}
+
+//export brainMPRISGetProperty
+func brainMPRISGetProperty(iface, name *C.char) *C.GVariant {
+	return dbusApp.mprisProperty(C.GoString(iface), C.GoString(name))
+}
+
+//export brainMPRISSetProperty
+func brainMPRISSetProperty(iface, name *C.char, value *C.GVariant) C.gboolean {
+	a := dbusApp
+	switch C.GoString(iface) + "." + C.GoString(name) {
+	case mprisPlayer + ".Volume":
+		if a.volumeScale != nil {
+			// the slider's handler sends the level to the hub
+			a.volumeScale.SetValue(math.Max(0, math.Min(1, float64(C.g_variant_get_double(value)))) * 100)
+		}
+		return 1
+	case mprisPlayer + ".Rate":
+		// only 1.0 is supported; other rates are ignored as the spec allows
+		return 1
+	}
+	return 0
+}
+
+// brainMPRISMethodCall runs on the GTK main loop. Transport methods act on
+// this client's player when it is the one playing, else on every peer.
+//
+//export brainMPRISMethodCall
+func brainMPRISMethodCall(iface, method *C.char, params *C.GVariant, inv *C.GDBusMethodInvocation) {
+	a := dbusApp
+	m := a.mpris
+	name := C.GoString(method)
+	track := (*nowPlaying)(nil)
+	if m != nil {
+		track = m.track
+	}
+	all := track == nil || !track.Self
+	control := func(action string, payload map[string]any) {
+		a.logf("MPRIS: %s", name)
+		go a.invokePlaybackControl(action, payload, all)
+	}
+	switch name {
+	case "Raise":
+		if a.win != nil {
+			a.showWindow()
+		}
+	case "Quit", "Next", "Previous":
+		// CanQuit, CanGoNext and CanGoPrevious are false
+	case "Pause":
+		control("pause", nil)
+	case "Play":
+		control("resume", nil)
+	case "PlayPause":
+		if mprisStatus(track) == "Playing" {
+			control("pause", nil)
+		} else {
+			control("resume", nil)
+		}
+	case "Stop":
+		control("stop", nil)
+	case "Seek":
+		if track != nil {
+			v := C.g_variant_get_child_value(params, 0)
+			offset := float64(C.g_variant_get_int64(v)) / 1e6
+			C.g_variant_unref(v)
+			control("seek", map[string]any{"position": math.Max(0, track.currentPosition()+offset)})
+		}
+	case "SetPosition":
+		if track != nil {
+			idArg := C.brain_dbus_string_arg(params, 0)
+			trackID := C.GoString(idArg)
+			C.g_free(C.gpointer(unsafe.Pointer(idArg)))
+			v := C.g_variant_get_child_value(params, 1)
+			position := float64(C.g_variant_get_int64(v)) / 1e6
+			C.g_variant_unref(v)
+			// a stale track id means the track changed since the caller looked
+			if trackID == m.trackID && position >= 0 && (track.Duration == 0 || position <= track.Duration) {
+				control("seek", map[string]any{"position": position})
+			}
+		}
+	case "OpenUri":
+		errName := C.CString("org.mpris.MediaPlayer2.Error.NotSupported")
+		defer C.free(unsafe.Pointer(errName))
+		message := C.CString("opening URIs is not supported")
+		defer C.free(unsafe.Pointer(message))
+		C.brain_dbus_return_error(inv, errName, message)
+		return
+	}
+	C.brain_dbus_return_empty(inv)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"os"
+
+	"brain/internal/mqtt"
+)
+
+// startMQTT runs the MQTT bridge when the profile names a broker, or
+// CLIENT_MQTT_BROKER does, until the app closes. It must run before the
+// socket connects.
+func (a *app) startMQTT() {
+	cfg := mqttConfig{}
+	if a.profile() != nil && a.profile().MQTT != nil {
+		cfg = *a.profile().MQTT
+	}
+	if v := os.Getenv("CLIENT_MQTT_BROKER"); v != "" {
+		cfg.Broker = v
+	}
+	if cfg.Broker == "" {
+		return
+	}
+	if _, _, err := mqtt.BrokerAddress(cfg.Broker); err != nil {
+		a.logf("MQTT bridge disabled: %v", err)
+		return
+	}
+	a.mqttBridge = mqtt.NewBridge(mqtt.BridgeConfig{
+		Options: mqtt.Options{
+			Broker:   cfg.Broker,
+			ClientID: cfg.ClientID,
+			Username: cfg.Username,
+			Password: cfg.Password,
+		},
+		Prefix:       cfg.Prefix,
+		Topics:       cfg.Topics,
+		CommandTopic: cfg.CommandTopic,
+		Client:       a.currentSocket,
+		Logf:         a.logf,
+	})
+	go a.mqttBridge.Run(a.ctx)
+}
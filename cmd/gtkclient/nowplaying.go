@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+
+	"github.com/gotk3/gotk3/glib"
+)
+
+const nowPlayingTick = 1000
+
+type nowPlaying struct {
+	hubclient.NowPlaying
+
+	received time.Time
+}
+
+// currentPosition extrapolates the reported position while the track is
+// still playing so the display keeps moving between hub updates.
+func (np *nowPlaying) currentPosition() float64 {
+	pos := np.Position
+	if np.State == "" || np.State == "playing" {
+		pos += time.Since(np.received).Seconds()
+	}
+	if np.Duration > 0 && pos > np.Duration {
+		pos = np.Duration
+	}
+	return pos
+}
+
+func formatNowPlaying(np *nowPlaying) string {
+	parts := make([]string, 0, 4)
+	switch np.State {
+	case "paused":
+		parts = append(parts, "⏸")
+	default:
+		parts = append(parts, "▶")
+	}
+	parts = append(parts, np.Filename)
+	if np.Duration > 0 {
+		parts = append(parts, fmt.Sprintf("%s/%s", formatSeconds(np.currentPosition()), formatSeconds(np.Duration)))
+	} else {
+		parts = append(parts, formatSeconds(np.currentPosition()))
+	}
+	if np.TriggeredBy != "" {
+		parts = append(parts, fmt.Sprintf("(by %s)", np.TriggeredBy))
+	}
+	return strings.Join(parts, " ")
+}
+
+func (a *app) handleNowPlaying(payload json.RawMessage) {
+	if len(payload) == 0 {
+		return
+	}
+	var np nowPlaying
+	if err := json.Unmarshal(payload, &np); err != nil {
+		a.logf("now-playing parse error: %v", err)
+		return
+	}
+	np.received = time.Now()
+	glib.IdleAdd(func() bool {
+		a.applyNowPlaying([]nowPlaying{np}, false)
+		return false
+	})
+	switch np.State {
+	case "stopped", "ended":
+		a.logf("now playing on %s: stopped", peerLabel(np))
+	default:
+		a.logf("now playing on %s: %s", peerLabel(np), formatNowPlaying(&np))
+	}
+}
+
+// applyNowPlaying records playback state per peer. A full status snapshot
+// replaces everything; single events only touch their peer. Must run on the
+// GTK main loop.
+func (a *app) applyNowPlaying(entries []nowPlaying, snapshot bool) {
+	if a.nowPlaying == nil || snapshot {
+		a.nowPlaying = make(map[string]*nowPlaying)
+	}
+	now := time.Now()
+	for _, np := range entries {
+		np := np
+		if np.received.IsZero() {
+			np.received = now
+		}
+		key := peerLabel(np)
+		if np.State == "stopped" || np.State == "ended" || np.Filename == "" {
+			delete(a.nowPlaying, key)
+		} else {
+			a.nowPlaying[key] = &np
+		}
+		if !np.Self {
+			a.ensurePeer(key)
+		}
+	}
+	a.renderNowPlaying()
+	a.updateMPRIS()
+	if a.nowPlayingTimer == 0 && len(a.nowPlaying) > 0 {
+		a.nowPlayingTimer = glib.TimeoutAdd(nowPlayingTick, func() bool {
+			for key, np := range a.nowPlaying {
+				// no stop event is guaranteed once a track runs out
+				if np.Duration > 0 && np.currentPosition() >= np.Duration {
+					delete(a.nowPlaying, key)
+				}
+			}
+			a.renderNowPlaying()
+			a.updateMPRIS()
+			if len(a.nowPlaying) == 0 {
+				a.nowPlayingTimer = 0
+				return false
+			}
+			return true
+		})
+	}
+}
+
+func (a *app) renderNowPlaying() {
+	for id := range a.peerRows {
+		a.renderPeerRow(id)
+	}
+	if a.nowPlayingLabel == nil {
+		return
+	}
+	if len(a.nowPlaying) == 0 {
+		a.nowPlayingLabel.SetText(tr("Now playing: nothing"))
+		return
+	}
+	keys := make([]string, 0, len(a.nowPlaying))
+	for k := range a.nowPlaying {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys))
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s: %s", k, formatNowPlaying(a.nowPlaying[k])))
+	}
+	a.nowPlayingLabel.SetText(tr("Now playing: ") + strings.Join(parts, " · "))
+}
+
+func peerLabel(np nowPlaying) string {
+	if np.Self {
+		return "this client"
+	}
+	if np.Peer == "" {
+		return "unknown"
+	}
+	return np.Peer
+}
+
+// applyStatusPeers folds the optional peers and nowPlaying fields of a status
+// snapshot into the peer panel. Must run on the GTK main loop.
+func (a *app) applyStatusPeers(status *hubclient.Status) {
+	if status.Peers != nil {
+		a.updatePeers(parsePeerList(status.Peers))
+	}
+	if status.NowPlaying != nil {
+		entries := make([]nowPlaying, len(status.NowPlaying))
+		for i, np := range status.NowPlaying {
+			entries[i] = nowPlaying{NowPlaying: np}
+		}
+		a.applyNowPlaying(entries, true)
+	}
+}
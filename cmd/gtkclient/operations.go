@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var errUploadCancelled = errors.New("upload cancelled")
+
+// operations tracks in-flight user actions by kind so the UI can cancel
+// them. Every operation derives from the app context, which is cancelled
+// when the window closes.
+type operations struct {
+	mu   sync.Mutex
+	next int
+	ops  map[string]map[int]context.CancelCauseFunc
+}
+
+// startOp returns a context for one operation of the given kind; done must
+// be called when it finishes.
+func (a *app) startOp(kind string) (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(a.ctx)
+	a.ops.mu.Lock()
+	if a.ops.ops == nil {
+		a.ops.ops = make(map[string]map[int]context.CancelCauseFunc)
+	}
+	if a.ops.ops[kind] == nil {
+		a.ops.ops[kind] = make(map[int]context.CancelCauseFunc)
+	}
+	a.ops.next++
+	id := a.ops.next
+	a.ops.ops[kind][id] = cancel
+	a.ops.mu.Unlock()
+	return ctx, func() {
+		a.ops.mu.Lock()
+		delete(a.ops.ops[kind], id)
+		a.ops.mu.Unlock()
+		cancel(nil)
+	}
+}
+
+// runningOps counts the operations of kind still in flight.
+func (a *app) runningOps(kind string) int {
+	a.ops.mu.Lock()
+	defer a.ops.mu.Unlock()
+	return len(a.ops.ops[kind])
+}
+
+// cancelOps cancels every running operation of kind with cause and reports
+// how many there were.
+func (a *app) cancelOps(kind string, cause error) int {
+	a.ops.mu.Lock()
+	defer a.ops.mu.Unlock()
+	n := len(a.ops.ops[kind])
+	for _, cancel := range a.ops.ops[kind] {
+		cancel(cause)
+	}
+	return n
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// outboxItem is a play/broadcast action made while the socket was down,
+// waiting to be sent in order once it reconnects. key is the idempotency
+// key of the first try, so a hub that did see it does not act twice.
+type outboxItem struct {
+	id     int
+	action string
+	arg    string
+	zone   string
+	// sync starts a broadcast-play on every peer together; loop repeats
+	// a play or broadcast-play until a broadcast-stop; normalize applies
+	// the file's ReplayGain where the hub keeps it
+	sync, loop, normalize bool
+	key                   string
+	queued                time.Time
+}
+
+func (it outboxItem) String() string {
+	if it.zone != "" {
+		return fmt.Sprintf("[%s] %s %q to %s", it.queued.Format("15:04:05"), it.action, it.arg, it.zone)
+	}
+	return fmt.Sprintf("[%s] %s %q", it.queued.Format("15:04:05"), it.action, it.arg)
+}
+
+// queueIfOffline parks it in the outbox when the outbox is enabled and err
+// means the hub never saw the request. It reports whether it did.
+func (a *app) queueIfOffline(it outboxItem, err error) bool {
+	if !a.outboxEnabled.Load() || !hubclient.IsConnectionError(err) {
+		return false
+	}
+	a.outboxMu.Lock()
+	a.outboxNext++
+	it.id = a.outboxNext
+	it.queued = time.Now()
+	a.outbox = append(a.outbox, it)
+	n := len(a.outbox)
+	a.outboxMu.Unlock()
+	a.logf("offline: queued %s %q (%d pending)", it.action, it.arg, n)
+	a.updateOutboxButton()
+	return true
+}
+
+func (a *app) sendOutboxItem(it outboxItem) error {
+	hub := a.currentSocket()
+	ctx := hubclient.WithIdempotencyKey(a.ctx, it.key)
+	// normalizing is a preference, so hubs without it still play
+	normalize := it.normalize && hub.Supports(protocol.CapNormalize)
+	switch it.action {
+	case "play":
+		return hub.PlayWith(ctx, it.arg, hubclient.PlayOptions{Loop: it.loop, Normalize: normalize})
+	case "broadcast":
+		return hub.BroadcastTo(ctx, it.arg, it.zone)
+	case "broadcast-play":
+		_, err := hub.BroadcastPlayWith(ctx, it.arg, hubclient.PlayOptions{Zone: it.zone, Sync: it.sync, Loop: it.loop, Normalize: normalize})
+		return err
+	}
+	return fmt.Errorf("unknown outbox action %q", it.action)
+}
+
+// flushOutbox sends queued items oldest first, stopping at the first one
+// that fails for connection reasons so order is kept for the next attempt.
+func (a *app) flushOutbox() {
+	if !a.outboxFlushing.CompareAndSwap(false, true) {
+		return
+	}
+	defer a.outboxFlushing.Store(false)
+	sent := 0
+	for {
+		a.outboxMu.Lock()
+		if len(a.outbox) == 0 {
+			a.outboxMu.Unlock()
+			break
+		}
+		it := a.outbox[0]
+		a.outboxMu.Unlock()
+		err := a.sendOutboxItem(it)
+		if err != nil && hubclient.IsConnectionError(err) {
+			a.logf("outbox flush paused: %v", err)
+			break
+		}
+		a.dropOutboxItem(it.id)
+		if err != nil {
+			a.reportError("queued "+it.action, err, nil)
+			continue
+		}
+		sent++
+	}
+	if sent > 0 {
+		a.logf("outbox: sent %d queued action(s)", sent)
+	}
+}
+
+func (a *app) dropOutboxItem(id int) {
+	a.outboxMu.Lock()
+	for i, it := range a.outbox {
+		if it.id == id {
+			a.outbox = append(a.outbox[:i], a.outbox[i+1:]...)
+			break
+		}
+	}
+	a.outboxMu.Unlock()
+	a.updateOutboxButton()
+}
+
+func (a *app) outboxSnapshot() []outboxItem {
+	a.outboxMu.Lock()
+	defer a.outboxMu.Unlock()
+	return append([]outboxItem(nil), a.outbox...)
+}
+
+func (a *app) updateOutboxButton() {
+	n := len(a.outboxSnapshot())
+	glib.IdleAdd(func() bool {
+		if a.outboxButton == nil {
+			return false
+		}
+		a.outboxButton.SetLabel(fmt.Sprintf(tr("_Outbox (%d)"), n))
+		a.outboxButton.SetVisible(n > 0)
+		return false
+	})
+}
+
+func (a *app) showOutbox() {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		return
+	}
+	dialog.SetTitle(tr("Offline Outbox"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetDefaultSize(460, 300)
+	dialog.AddButton(tr("Drop All"), gtk.RESPONSE_REJECT)
+	dialog.AddButton(tr("Close"), gtk.RESPONSE_CLOSE)
+	content, _ := dialog.GetContentArea()
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetVExpand(true)
+	content.PackStart(scroll, true, true, 0)
+	list, _ := gtk.ListBoxNew()
+	list.SetSelectionMode(gtk.SELECTION_NONE)
+	scroll.Add(list)
+
+	items := a.outboxSnapshot()
+	if len(items) == 0 {
+		empty, _ := gtk.LabelNew(tr("Nothing queued"))
+		list.Add(empty)
+	}
+	for _, it := range items {
+		it := it
+		row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+		row.SetMarginStart(6)
+		row.SetMarginEnd(6)
+		label, _ := gtk.LabelNew(it.String())
+		label.SetXAlign(0)
+		row.PackStart(label, true, true, 0)
+		dropBtn, _ := gtk.ButtonNewWithLabel(tr("Drop"))
+		setAccessible(dropBtn, fmt.Sprintf(tr("Drop %s"), it), "")
+		dropBtn.Connect("clicked", func() {
+			a.dropOutboxItem(it.id)
+			row.Destroy()
+		})
+		row.PackEnd(dropBtn, false, false, 0)
+		list.Add(row)
+	}
+	dialog.Connect("response", func(_ *gtk.Dialog, response gtk.ResponseType) {
+		if response == gtk.RESPONSE_REJECT {
+			a.outboxMu.Lock()
+			n := len(a.outbox)
+			a.outbox = nil
+			a.outboxMu.Unlock()
+			a.updateOutboxButton()
+			a.logf("outbox: dropped %d queued action(s)", n)
+		}
+		dialog.Destroy()
+	})
+	dialog.ShowAll()
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const paletteMaxRows = 50
+
+// hubCommand is a command the hub's command entry understands. Those with
+// arguments are put in the entry to finish rather than sent.
+type hubCommand struct {
+	name  string
+	args  string
+	title string
+}
+
+func hubCommands() []hubCommand {
+	return []hubCommand{
+		{"help", "", tr("List the hub's commands")},
+		{"storage", "", tr("Show the hub's stored keys")},
+		{"put", "<key> <value> [ttl]", tr("Store a value")},
+		{"get", "<key>", tr("Read a stored value")},
+		{"delete", "<key>", tr("Delete a stored value")},
+		{"keys", "", tr("List stored keys")},
+		{"expire", "<key> <seconds>", tr("Set a key's expiry")},
+		{"ttl", "<key>", tr("Show a key's time to live")},
+		{"peers", "", tr("List connected peers")},
+		{"whoami", "", tr("Show this client as the hub sees it")},
+		{"benchmark", "", tr("Measure how fast peers run a workload")},
+		{"broadcast", "<message>", tr("Send a message to every peer")},
+		{"audio list", "", tr("List the hub's audio files")},
+		{"audio get", "<file>", tr("Show an audio file's details")},
+		{"audio delete", "<file>", tr("Delete a hub file")},
+		{"tags list", "", tr("List every file's tags")},
+		{"mapreduce", "<start|report|status|cancel> ...", tr("Run or inspect a map-reduce job")},
+	}
+}
+
+// commandRegistry is every action the client can take right now: the
+// shortcut table, session recording, macros, the tabs, the hub's commands and one broadcast-play per
+// audio file. Must run on the GTK main loop.
+func (a *app) commandRegistry() []shortcut {
+	list := append(appShortcuts(), a.sessionShortcuts()...)
+	list = append(list, a.macroShortcuts()...)
+	if a.notebook != nil {
+		for i := 0; i < a.notebook.GetNPages(); i++ {
+			child, err := a.notebook.GetNthPage(i)
+			if err != nil {
+				continue
+			}
+			title, _ := a.notebook.GetTabLabelText(child)
+			page := i
+			list = append(list, shortcut{
+				action: "tab:" + title,
+				title:  fmt.Sprintf(tr("Show the %s tab"), title),
+				group:  tr("Tabs"),
+				run:    func(a *app) { a.notebook.SetCurrentPage(page) },
+			})
+		}
+	}
+	for _, c := range hubCommands() {
+		c := c
+		title := c.name
+		if c.args != "" {
+			title += " " + c.args
+		}
+		list = append(list, shortcut{
+			action: "hub:" + c.name,
+			title:  title + " — " + c.title,
+			group:  tr("Hub command"),
+			run:    func(a *app) { a.hubCommandShortcut(c) },
+		})
+	}
+	keys := make(map[string]string)
+	for accel, filename := range a.profile().Soundboard {
+		keys[filename] = accel
+	}
+	for _, f := range a.audioFiles {
+		filename := f.Name
+		list = append(list, shortcut{
+			action: "play:" + filename,
+			accel:  keys[filename],
+			title:  fmt.Sprintf(tr("Broadcast-play %s"), filename),
+			group:  tr("Audio"),
+			run:    func(a *app) { go a.invokeBroadcastPlay(filename) },
+		})
+	}
+	return list
+}
+
+// runRegistered runs the registry entry named action, reporting whether
+// there was one. Must run on the GTK main loop.
+func (a *app) runRegistered(action string) bool {
+	for _, s := range a.commandRegistry() {
+		if s.action == action && s.run != nil {
+			s.run(a)
+			return true
+		}
+	}
+	return false
+}
+
+func (a *app) hubCommandShortcut(c hubCommand) {
+	if c.args == "" {
+		a.logf("command: %s", c.name)
+		go a.execCommand(c.name)
+		return
+	}
+	a.commandEntry.SetText(c.name + " ")
+	a.commandEntry.GrabFocus()
+	a.commandEntry.SetPosition(-1)
+}
+
+// fuzzyScore matches the letters of query in order within text, ignoring
+// case. Runs of adjacent letters and letters starting a word score higher.
+func fuzzyScore(query, text string) (int, bool) {
+	q := []rune(strings.ToLower(strings.TrimSpace(query)))
+	if len(q) == 0 {
+		return 0, true
+	}
+	t := []rune(strings.ToLower(text))
+	score, qi, last := 0, 0, -1
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if unicode.IsSpace(q[qi]) {
+			qi++
+			if qi == len(q) {
+				break
+			}
+		}
+		if t[ti] != q[qi] {
+			continue
+		}
+		score++
+		if last == ti-1 {
+			score += 4
+		}
+		if ti == 0 || !unicode.IsLetter(t[ti-1]) && !unicode.IsDigit(t[ti-1]) {
+			score += 3
+		}
+		if last >= 0 {
+			score -= min(ti-last-1, 3)
+		}
+		last = ti
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+	return score, true
+}
+
+type paletteMatch struct {
+	entry shortcut
+	score int
+}
+
+func filterPalette(list []shortcut, query string) []paletteMatch {
+	var out []paletteMatch
+	for i, s := range list {
+		if s.run == nil {
+			continue
+		}
+		score, ok := fuzzyScore(query, s.title+" "+s.group)
+		if !ok {
+			continue
+		}
+		// earlier entries win ties so the table's order shows through
+		out = append(out, paletteMatch{s, score*1000 - i})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].score > out[j].score })
+	if len(out) > paletteMaxRows {
+		out = out[:paletteMaxRows]
+	}
+	return out
+}
+
+// showPalette opens the command palette over the main window.
+func (a *app) showPalette() {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		a.logf("command palette error: %v", err)
+		return
+	}
+	dialog.SetTitle(tr("Command Palette"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(560, 420)
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.SetBorderWidth(12)
+	search, _ := gtk.SearchEntryNew()
+	search.SetPlaceholderText(tr("Type to search actions and hub commands"))
+	setAccessible(search, tr("Search commands"), "")
+	content.PackStart(search, false, false, 0)
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_NEVER, gtk.POLICY_AUTOMATIC)
+	scroll.SetVExpand(true)
+	content.PackStart(scroll, true, true, 0)
+	rows, _ := gtk.ListBoxNew()
+	rows.SetSelectionMode(gtk.SELECTION_BROWSE)
+	setAccessible(rows, tr("Matching commands"), "")
+	scroll.Add(rows)
+
+	registry := a.commandRegistry()
+	var matches []paletteMatch
+	run := func(index int) {
+		if index < 0 || index >= len(matches) {
+			return
+		}
+		entry := matches[index].entry
+		dialog.Destroy()
+		a.logf("palette: %s", entry.action)
+		entry.run(a)
+	}
+	fill := func() {
+		text, _ := search.GetText()
+		matches = filterPalette(registry, text)
+		if children := rows.GetChildren(); children != nil {
+			children.Foreach(func(item interface{}) {
+				if w, ok := item.(*gtk.Widget); ok {
+					w.Destroy()
+				}
+			})
+		}
+		for _, m := range matches {
+			rows.Add(paletteRow(m.entry))
+		}
+		if len(matches) == 0 {
+			empty, _ := gtk.LabelNew(tr("No matching commands"))
+			addStyleClass(empty, "dim-label")
+			rows.Add(empty)
+		}
+		rows.ShowAll()
+		if first := rows.GetRowAtIndex(0); first != nil && len(matches) > 0 {
+			rows.SelectRow(first)
+		}
+	}
+	move := func(by int) {
+		index := 0
+		if row := rows.GetSelectedRow(); row != nil {
+			index = row.GetIndex() + by
+		}
+		if index < 0 || index >= len(matches) {
+			return
+		}
+		if row := rows.GetRowAtIndex(index); row != nil {
+			rows.SelectRow(row)
+			row.GrabFocus()
+			search.GrabFocusWithoutSelecting()
+		}
+	}
+	search.Connect("search-changed", fill)
+	search.Connect("activate", func() {
+		if row := rows.GetSelectedRow(); row != nil {
+			run(row.GetIndex())
+		}
+	})
+	search.Connect("key-press-event", func(_ *gtk.SearchEntry, ev *gdk.Event) bool {
+		switch gdk.EventKeyNewFromEvent(ev).KeyVal() {
+		case gdk.KEY_Down:
+			move(1)
+			return true
+		case gdk.KEY_Up:
+			move(-1)
+			return true
+		}
+		return false
+	})
+	rows.Connect("row-activated", func(_ *gtk.ListBox, row *gtk.ListBoxRow) {
+		run(row.GetIndex())
+	})
+	dialog.Connect("response", func() { dialog.Destroy() })
+	fill()
+	dialog.ShowAll()
+	search.GrabFocus()
+}
+
+func paletteRow(s shortcut) gtk.IWidget {
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 12)
+	box.SetMarginStart(6)
+	box.SetMarginEnd(6)
+	box.SetMarginTop(3)
+	box.SetMarginBottom(3)
+	title, _ := gtk.LabelNew(s.title)
+	title.SetXAlign(0)
+	title.SetHExpand(true)
+	box.PackStart(title, true, true, 0)
+	if s.accel != "" {
+		accel, _ := gtk.LabelNew(accelLabel(s.accel))
+		addStyleClass(accel, "dim-label")
+		box.PackEnd(accel, false, false, 0)
+	}
+	group, _ := gtk.LabelNew(s.group)
+	addStyleClass(group, "dim-label")
+	box.PackEnd(group, false, false, 0)
+	return box
+}
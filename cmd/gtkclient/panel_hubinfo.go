@@ -0,0 +1,54 @@
+//go:build panel_hubinfo
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"brain/internal/hubclient"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// hubInfoPanel is a sample panel, built with -tags panel_hubinfo, showing
+// what the hub said in its hello.
+type hubInfoPanel struct {
+	host  *panelHost
+	label *gtk.Label
+}
+
+func init() { registerPanel(100, &hubInfoPanel{}) }
+
+func (p *hubInfoPanel) Title() string { return tr("Hub Info") }
+
+func (p *hubInfoPanel) Build(host *panelHost) gtk.IWidget {
+	p.host = host
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	p.label, _ = gtk.LabelNew(tr("Not connected"))
+	p.label.SetXAlign(0)
+	p.label.SetYAlign(0)
+	p.label.SetSelectable(true)
+	p.label.SetLineWrap(true)
+	p.label.SetMarginStart(8)
+	p.label.SetMarginTop(8)
+	setAccessible(p.label, tr("Hub hello"), "")
+	scroll.Add(p.label)
+	return scroll
+}
+
+func (p *hubInfoPanel) Connected(client *hubclient.Client) {
+	hello := client.Hello()
+	if hello == nil {
+		p.label.SetText(tr("The hub sent no hello"))
+		return
+	}
+	p.label.SetText(fmt.Sprintf(tr("Profile: %s\nHost: %s\nProtocol version: %d\nRole: %s\nCapabilities: %s\nCodecs: %s"),
+		p.host.Profile(), hello.Host, hello.Version, hello.Role,
+		strings.Join(hello.Capabilities, ", "), strings.Join(hello.Codecs, ", ")))
+}
+
+func (p *hubInfoPanel) Disconnected(cause error) {
+	p.label.SetText(fmt.Sprintf(tr("Disconnected: %v"), cause))
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"brain/internal/hubclient"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// panel is an extra tab compiled into the client. A panel lives in its own
+// file, usually behind a build tag, and adds itself from init with
+// registerPanel, so main.go never names it. Every method runs on the GTK
+// main loop.
+type panel interface {
+	// Title labels the tab.
+	Title() string
+	// Build makes the tab's widget, once, when the window is built.
+	Build(host *panelHost) gtk.IWidget
+	// Connected runs after each hello from the hub.
+	Connected(client *hubclient.Client)
+	// Disconnected runs when that socket closes, with why.
+	Disconnected(cause error)
+}
+
+// eventPanel is a panel that also wants every event from the socket.
+type eventPanel interface {
+	panel
+	Event(msg hubclient.Message)
+}
+
+// shownPanel is a panel told when its tab comes to the front, say to
+// clear a badge.
+type shownPanel interface {
+	panel
+	Shown()
+}
+
+// registeredPanels are added in order of their order key, then title.
+var registeredPanels []registeredPanel
+
+type registeredPanel struct {
+	order int
+	panel panel
+}
+
+// registerPanel adds p to every window; call it from init. Panels with a
+// lower order come first, after the built-in tabs.
+func registerPanel(order int, p panel) {
+	registeredPanels = append(registeredPanels, registeredPanel{order: order, panel: p})
+}
+
+// panelHost is what the client lends a panel.
+type panelHost struct {
+	a *app
+}
+
+// Client is the current socket, or nil between connections; its methods
+// then fail with hubclient.ErrNotConnected.
+func (h *panelHost) Client() *hubclient.Client { return h.a.currentSocket() }
+
+// Context ends when the client quits.
+func (h *panelHost) Context() context.Context { return h.a.ctx }
+
+// GateOnRole makes w insensitive when the hub's role for this client does
+// not allow action.
+func (h *panelHost) GateOnRole(action string, w gtk.IWidget) { h.a.gateOnRole(action, w) }
+
+// Logf writes to the client log.
+func (h *panelHost) Logf(format string, args ...any) { h.a.logf(format, args...) }
+
+// ReportError shows err as a toast, with Retry when retry is set.
+func (h *panelHost) ReportError(action string, err error, retry func()) {
+	h.a.reportError(action, err, retry)
+}
+
+// Profile names the active profile.
+func (h *panelHost) Profile() string { return h.a.profileName() }
+
+// Window is the main window, for dialogs.
+func (h *panelHost) Window() *gtk.Window { return h.a.win }
+
+// PeerName shows a peer id with the name the hub knows it by.
+func (h *panelHost) PeerName(id string) string { return h.a.auditActor(id) }
+
+// Showing reports whether p's tab is in front in the active window.
+func (h *panelHost) Showing(p panel) bool {
+	tab := h.a.panelTabs[p]
+	return tab.page != nil && h.a.win.IsActive() && h.a.notebook.GetCurrentPage() == h.a.notebook.PageNum(tab.page)
+}
+
+// SetBadge shows count after p's tab title, or just the title when it is
+// zero.
+func (h *panelHost) SetBadge(p panel, count int) {
+	tab := h.a.panelTabs[p]
+	if tab.label == nil {
+		return
+	}
+	if count > 0 {
+		tab.label.SetText(fmt.Sprintf("%s (%d)", p.Title(), count))
+	} else {
+		tab.label.SetText(p.Title())
+	}
+}
+
+// panelTab is where a panel sits in the notebook.
+type panelTab struct {
+	page  gtk.IWidget
+	label *gtk.Label
+}
+
+// buildPanels adds a tab for every registered panel. Must run on the GTK
+// main loop.
+func (a *app) buildPanels() {
+	sort.SliceStable(registeredPanels, func(i, j int) bool {
+		pi, pj := registeredPanels[i], registeredPanels[j]
+		if pi.order != pj.order {
+			return pi.order < pj.order
+		}
+		return pi.panel.Title() < pj.panel.Title()
+	})
+	host := &panelHost{a: a}
+	a.panelTabs = make(map[panel]panelTab)
+	for _, r := range registeredPanels {
+		w := r.panel.Build(host)
+		if w == nil {
+			continue
+		}
+		a.panelTabs[r.panel] = panelTab{page: w, label: a.addTab(r.panel.Title(), w)}
+		a.panels = append(a.panels, r.panel)
+	}
+	show := func() {
+		for _, p := range a.panels {
+			if sp, ok := p.(shownPanel); ok && host.Showing(p) {
+				sp.Shown()
+			}
+		}
+	}
+	a.notebook.Connect("switch-page", func() { glib.IdleAdd(func() bool { show(); return false }) })
+	a.win.Connect("notify::is-active", show)
+}
+
+// panelsConnected tells every panel the socket is up.
+func (a *app) panelsConnected(client *hubclient.Client) {
+	glib.IdleAdd(func() bool {
+		if a.currentSocket() != client {
+			return false
+		}
+		for _, p := range a.panels {
+			p.Connected(client)
+		}
+		return false
+	})
+}
+
+// panelsEvent passes a socket event to the panels that take events, and
+// a disconnect to all of them.
+func (a *app) panelsEvent(msg hubclient.Message) {
+	if msg.Type != "event" {
+		return
+	}
+	glib.IdleAdd(func() bool {
+		for _, p := range a.panels {
+			if ep, ok := p.(eventPanel); ok {
+				ep.Event(msg)
+			}
+			if msg.Event == "disconnect" {
+				p.Disconnected(msg.Error)
+			}
+		}
+		return false
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// setPeerControllable offers Restart and Update only to hubs that relay
+// them and roles that may send them. Must run on the GTK main loop.
+func (a *app) setPeerControllable(ok bool, role protocol.Role) {
+	if a.peerRestartBtn == nil {
+		return
+	}
+	for _, b := range []struct {
+		btn    *gtk.Button
+		action string
+		tip    string
+	}{
+		{a.peerRestartBtn, "peer-restart", tr("Restart the selected peer's client")},
+		{a.peerUpdateBtn, "peer-update", tr("Update the selected peer's client, then restart it")},
+	} {
+		allowed := ok && role.Allows(b.action)
+		b.btn.SetSensitive(allowed)
+		switch {
+		case allowed:
+			b.btn.SetTooltipText(b.tip)
+		case !ok:
+			b.btn.SetTooltipText(tr("This hub cannot restart or update peers"))
+		default:
+			b.btn.SetTooltipText(roleTooltip(role))
+		}
+	}
+}
+
+// confirmPeerControl asks before restarting or updating peer. Must run on
+// the GTK main loop.
+func (a *app) confirmPeerControl(action, peer string) {
+	if peer == "" {
+		a.showToastType(gtk.MESSAGE_INFO, tr("Select a peer first"), nil, false)
+		return
+	}
+	name := a.auditActor(peer)
+	title, detail, button := fmt.Sprintf(tr("Restart %s?"), name),
+		tr("Its client goes offline for a moment; anything it is playing stops."), tr("Restart")
+	if action == "update" {
+		title, detail, button = fmt.Sprintf(tr("Update %s?"), name),
+			tr("Its client fetches the latest version and restarts; anything it is playing stops."), tr("Update")
+	}
+	dialog := gtk.MessageDialogNew(a.win, gtk.DIALOG_MODAL, gtk.MESSAGE_QUESTION, gtk.BUTTONS_NONE, "%s", title)
+	dialog.FormatSecondaryText("%s", detail)
+	dialog.AddButton(tr("Cancel"), gtk.RESPONSE_CANCEL)
+	dialog.AddButton(button, gtk.RESPONSE_ACCEPT)
+	dialog.SetDefaultResponse(gtk.RESPONSE_CANCEL)
+	response := dialog.Run()
+	dialog.Destroy()
+	if response == gtk.RESPONSE_ACCEPT {
+		go a.controlPeer(action, peer)
+	}
+}
+
+func (a *app) controlPeer(action, peer string) {
+	client := a.currentSocket()
+	run := client.RestartPeer
+	if action == "update" {
+		run = client.UpdatePeer
+	}
+	id, err := run(a.ctx, peer)
+	if err != nil {
+		a.reportError("peer "+action, err, func() { a.controlPeer(action, peer) })
+		return
+	}
+	a.logf("peer %s %s requested (%s)", action, peer, id)
+}
+
+// handlePeerControlEvent shows a restart or update's progress on the
+// peer's row, and how it ended as a toast.
+func (a *app) handlePeerControlEvent(payload json.RawMessage) {
+	var ev hubclient.PeerControl
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		a.logf("peer-control event parse error: %v", err)
+		return
+	}
+	if ev.Message != "" {
+		a.logf("peer %s %s: %s — %s", ev.Action, ev.Peer, ev.Phase, ev.Message)
+	} else {
+		a.logf("peer %s %s: %s", ev.Action, ev.Peer, ev.Phase)
+	}
+	glib.IdleAdd(func() bool {
+		if a.peerControl == nil {
+			a.peerControl = make(map[string]string)
+		}
+		name := a.auditActor(ev.Peer)
+		done, failed := tr("%s restarted"), tr("Restarting %s failed: %s")
+		if ev.Action == "update" {
+			done, failed = tr("%s updated and restarted"), tr("Updating %s failed: %s")
+		}
+		switch ev.Phase {
+		case "done":
+			delete(a.peerControl, ev.Peer)
+			a.showToastType(gtk.MESSAGE_INFO, fmt.Sprintf(done, name), nil, false)
+		case "failed":
+			delete(a.peerControl, ev.Peer)
+			a.showToast(fmt.Sprintf(failed, name, ev.Message), nil, false)
+		default:
+			a.peerControl[ev.Peer] = ev.Phase
+		}
+		a.renderPeerRow(ev.Peer)
+		return false
+	})
+}
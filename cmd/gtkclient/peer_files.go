@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const peerFilesMaxEntries = 1000
+
+// peerRelayRequest is what the hub forwards to us when another client
+// browses our shared folder or asks us to push one of its files.
+type peerRelayRequest struct {
+	RequestID string `json:"requestId"`
+	From      string `json:"from"`
+	Path      string `json:"path"`
+	Filename  string `json:"filename"`
+}
+
+// setPeerFilesAvailable enables browsing peers' shared folders when the
+// hub relays peer-files. Must run on the GTK main loop.
+func (a *app) setPeerFilesAvailable(ok bool) {
+	if a.peerBrowseBtn == nil {
+		return
+	}
+	a.peerBrowseBtn.SetSensitive(ok)
+	if ok {
+		a.peerBrowseBtn.SetTooltipText(tr("List the selected peer's shared folder"))
+	} else {
+		a.peerBrowseBtn.SetTooltipText(tr("This hub cannot browse peers' shared folders"))
+	}
+}
+
+func (a *app) browsePeerFiles(peer, path string) {
+	if peer == "" {
+		a.logf("peer-files: no peer selected")
+		return
+	}
+	res, err := a.currentSocket().PeerFiles(a.ctx, peer, path)
+	if err != nil {
+		a.reportError("peer-files", err, func() { a.browsePeerFiles(peer, path) })
+		return
+	}
+	a.logf("peer-files %s:%s (%d entries)", peer, displayPeerPath(res.Path), len(res.Files))
+	glib.IdleAdd(func() bool {
+		a.showPeerFilesDialog(peer, res)
+		return false
+	})
+}
+
+func (a *app) requestPeerUpload(peer, filename string) {
+	if err := a.currentSocket().PeerUpload(a.ctx, peer, filename); err != nil {
+		a.reportError("peer-upload", err, func() { a.requestPeerUpload(peer, filename) })
+		return
+	}
+	a.logf("peer-upload requested: %s from %s", filename, peer)
+	go a.fetchStatus()
+}
+
+func (a *app) showPeerFilesDialog(peer string, res *hubclient.PeerListing) {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		a.logf("peer-files dialog error: %v", err)
+		return
+	}
+	dialog.SetTitle(fmt.Sprintf(tr("Files on %s:%s"), peer, displayPeerPath(res.Path)))
+	dialog.SetTransientFor(a.win)
+	dialog.SetDefaultSize(520, 420)
+	dialog.AddButton(tr("Close"), gtk.RESPONSE_CLOSE)
+	dialog.Connect("response", func() { dialog.Destroy() })
+
+	content, _ := dialog.GetContentArea()
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_NEVER, gtk.POLICY_AUTOMATIC)
+	scroll.SetVExpand(true)
+	content.PackStart(scroll, true, true, 0)
+
+	list, _ := gtk.ListBoxNew()
+	list.SetSelectionMode(gtk.SELECTION_NONE)
+	scroll.Add(list)
+
+	if res.Path != "" {
+		parent := filepath.ToSlash(filepath.Dir(res.Path))
+		if parent == "." {
+			parent = ""
+		}
+		upBtn, _ := gtk.ButtonNewWithLabel(tr("⬑ .."))
+		upBtn.SetRelief(gtk.RELIEF_NONE)
+		setAccessible(upBtn, tr("Parent folder"), "")
+		upBtn.SetHAlign(gtk.ALIGN_START)
+		upBtn.Connect("clicked", func() {
+			dialog.Destroy()
+			go a.browsePeerFiles(peer, parent)
+		})
+		list.Add(upBtn)
+	}
+
+	if len(res.Files) == 0 {
+		empty, _ := gtk.LabelNew(tr("Shared folder is empty"))
+		list.Add(empty)
+	}
+	for _, f := range res.Files {
+		row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+		row.SetMarginStart(6)
+		row.SetMarginEnd(6)
+		name := f.Name
+		full := name
+		if res.Path != "" {
+			full = res.Path + "/" + name
+		}
+		if f.Dir {
+			btn, _ := gtk.ButtonNewWithLabel(name + "/")
+			btn.SetRelief(gtk.RELIEF_NONE)
+			setAccessible(btn, fmt.Sprintf(tr("Open folder %s"), name), "")
+			btn.Connect("clicked", func() {
+				dialog.Destroy()
+				go a.browsePeerFiles(peer, full)
+			})
+			row.PackStart(btn, true, true, 0)
+		} else {
+			label, _ := gtk.LabelNew(formatPeerFile(f))
+			label.SetXAlign(0)
+			label.SetSelectable(true)
+			row.PackStart(label, true, true, 0)
+			uploadBtn, _ := gtk.ButtonNewWithLabel(tr("Upload to hub"))
+			if role := a.currentSocket().Role(); role.Allows("peer-upload") {
+				uploadBtn.SetTooltipText(fmt.Sprintf(tr("Ask %s to upload %s into the hub library"), peer, full))
+			} else {
+				uploadBtn.SetSensitive(false)
+				uploadBtn.SetTooltipText(roleTooltip(role))
+			}
+			setAccessible(uploadBtn, fmt.Sprintf(tr("Upload %s to hub"), name), "")
+			uploadBtn.Connect("clicked", func() { go a.requestPeerUpload(peer, full) })
+			row.PackEnd(uploadBtn, false, false, 0)
+		}
+		list.Add(row)
+	}
+	dialog.ShowAll()
+}
+
+func formatPeerFile(f hubclient.PeerFile) string {
+	parts := []string{f.Name, fmt.Sprintf("(%s)", formatBytes(f.Size))}
+	if f.Modified != "" {
+		if ts, err := time.Parse(time.RFC3339, f.Modified); err == nil {
+			parts = append(parts, "@ "+ts.Local().Format("2006-01-02 15:04"))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+func displayPeerPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return "/" + path
+}
+
+// handlePeerFilesRequest answers a relayed listing request for our shared
+// folder. The folder is only ever read.
+func (a *app) handlePeerFilesRequest(payload json.RawMessage) {
+	var req peerRelayRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		a.logf("peer-files-request parse error: %v", err)
+		return
+	}
+	reply := map[string]any{"requestId": req.RequestID}
+	files, rel, err := a.listSharedFolder(req.Path)
+	if err != nil {
+		reply["error"] = err.Error()
+	} else {
+		reply["path"] = rel
+		reply["files"] = files
+	}
+	if err := a.socketRequest("peer-files-response", reply, nil); err != nil {
+		a.logf("peer-files-response error: %v", err)
+		return
+	}
+	a.logf("shared folder listed for %s: %s", req.From, displayPeerPath(rel))
+}
+
+// handlePeerUploadRequest pushes a file from our shared folder into the hub
+// library on behalf of another client.
+func (a *app) handlePeerUploadRequest(payload json.RawMessage) {
+	var req peerRelayRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		a.logf("peer-upload-request parse error: %v", err)
+		return
+	}
+	reply := map[string]any{"requestId": req.RequestID}
+	res, err := a.uploadSharedFile(req.Filename)
+	if err != nil {
+		reply["error"] = err.Error()
+		a.logf("peer-upload for %s failed: %v", req.From, err)
+	} else {
+		reply["upload"] = res
+		a.logf("peer-upload for %s: %s (%d bytes)", req.From, res.Filename, res.Size)
+	}
+	if err := a.socketRequest("peer-upload-response", reply, nil); err != nil {
+		a.logf("peer-upload-response error: %v", err)
+	}
+}
+
+func (a *app) uploadSharedFile(name string) (*hubclient.UploadResult, error) {
+	path, _, err := a.resolveSharedPath(name)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", name)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return a.currentSocket().Upload(a.ctx, hubclient.UploadRequest{Filename: filepath.Base(path), Data: data, Meta: a.readAudioMeta(path)})
+}
+
+func (a *app) listSharedFolder(rel string) ([]hubclient.PeerFile, string, error) {
+	dir, clean, err := a.resolveSharedPath(rel)
+	if err != nil {
+		return nil, "", err
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	files := make([]hubclient.PeerFile, 0, len(entries))
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, hubclient.PeerFile{
+			Name:     entry.Name(),
+			Size:     info.Size(),
+			Modified: info.ModTime().UTC().Format(time.RFC3339),
+			Dir:      entry.IsDir(),
+		})
+		if len(files) >= peerFilesMaxEntries {
+			break
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Dir != files[j].Dir {
+			return files[i].Dir
+		}
+		return files[i].Name < files[j].Name
+	})
+	return files, clean, nil
+}
+
+// resolveSharedPath maps a peer-supplied relative path onto the configured
+// shared folder, refusing anything that escapes it.
+func (a *app) resolveSharedPath(rel string) (string, string, error) {
+	root := ""
+	if a.profile() != nil {
+		root = a.profile().SharedFolder
+	}
+	if root == "" {
+		return "", "", fmt.Errorf("no shared folder configured")
+	}
+	clean := filepath.Clean("/" + filepath.FromSlash(rel))
+	clean = strings.TrimPrefix(clean, string(filepath.Separator))
+	full := filepath.Join(root, clean)
+	resolved, err := filepath.EvalSymlinks(full)
+	if err != nil {
+		return "", "", err
+	}
+	rootResolved, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", "", err
+	}
+	if resolved != rootResolved && !strings.HasPrefix(resolved, rootResolved+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("path outside shared folder")
+	}
+	return resolved, filepath.ToSlash(clean), nil
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// peerPingWorkers bounds the pings in flight while the matrix fills.
+const peerPingWorkers = 4
+
+// peerHealthPanel is the Peer Health tab: a matrix of peer-pings, from
+// this client and from every peer to every peer, refreshed on demand.
+// All fields are owned by the GTK main loop.
+type peerHealthPanel struct {
+	host    *panelHost
+	pingBtn *gtk.Button
+	summary *gtk.Label
+	scroll  *gtk.ScrolledWindow
+	grid    *gtk.Grid
+	// cells are the matrix labels by source then target; "" is this client
+	cells map[string]map[string]*gtk.Label
+	// round counts refreshes so a late answer cannot land in a newer matrix
+	round int
+}
+
+func init() { registerPanel(20, &peerHealthPanel{}) }
+
+func (p *peerHealthPanel) Title() string { return tr("Peer Health") }
+
+func (p *peerHealthPanel) Build(host *panelHost) gtk.IWidget {
+	p.host = host
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+	bar, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	box.PackStart(bar, false, false, 0)
+	p.pingBtn, _ = gtk.ButtonNewWithMnemonic(tr("_Ping All Peers"))
+	p.pingBtn.SetTooltipText(tr("Ping every peer from this client and from each other peer"))
+	p.pingBtn.Connect("clicked", p.pingAll)
+	bar.PackStart(p.pingBtn, false, false, 0)
+	p.summary, _ = gtk.LabelNew(tr("Not connected"))
+	bar.PackEnd(p.summary, false, false, 0)
+
+	p.scroll, _ = gtk.ScrolledWindowNew(nil, nil)
+	p.scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	p.scroll.SetVExpand(true)
+	box.PackStart(p.scroll, true, true, 0)
+	hint, _ := gtk.LabelNew(tr("Rows ping, columns answer; times are round trips through the hub."))
+	hint.SetXAlign(0)
+	addStyleClass(hint, "dim-label")
+	box.PackStart(hint, false, false, 0)
+	return box
+}
+
+func (p *peerHealthPanel) Connected(client *hubclient.Client) {
+	p.clear()
+	ok := client.Supports(protocol.CapPeerPing)
+	p.pingBtn.SetSensitive(ok)
+	if ok {
+		p.summary.SetText(tr("Press Ping All Peers to check the network"))
+	} else {
+		p.summary.SetText(tr("This hub cannot ping peers"))
+	}
+}
+
+func (p *peerHealthPanel) Disconnected(error) {
+	p.clear()
+	p.pingBtn.SetSensitive(false)
+	p.summary.SetText(tr("Not connected"))
+}
+
+func (p *peerHealthPanel) clear() {
+	p.round++
+	if p.grid != nil {
+		p.grid.Destroy()
+		p.grid = nil
+	}
+	p.cells = nil
+}
+
+// pingAll lists the peers, lays out an empty matrix and fills it in as
+// the pings come back.
+func (p *peerHealthPanel) pingAll() {
+	client := p.host.Client()
+	p.pingBtn.SetSensitive(false)
+	p.summary.SetText(tr("Listing peers…"))
+	go func() {
+		result, err := client.Command(p.host.Context(), "peers")
+		if err != nil {
+			glib.IdleAdd(func() bool {
+				p.pingBtn.SetSensitive(true)
+				p.summary.SetText("")
+				return false
+			})
+			p.host.ReportError("peers", err, nil)
+			return
+		}
+		peers := parsePeerList(result)
+		glib.IdleAdd(func() bool {
+			p.layout(peers)
+			go p.ping(client, p.round, peers)
+			return false
+		})
+	}()
+}
+
+func (p *peerHealthPanel) layout(peers []peerInfo) {
+	p.clear()
+	p.grid, _ = gtk.GridNew()
+	p.grid.SetRowSpacing(4)
+	p.grid.SetColumnSpacing(12)
+	p.grid.SetBorderWidth(6)
+	p.cells = make(map[string]map[string]*gtk.Label)
+	sources := append([]peerInfo{{ID: ""}}, peers...)
+	for col, target := range peers {
+		head, _ := gtk.LabelNew(peerTitle(target))
+		head.SetAngle(30)
+		head.SetTooltipText(target.ID)
+		p.grid.Attach(head, col+1, 0, 1, 1)
+	}
+	for row, source := range sources {
+		title := tr("This client")
+		if source.ID != "" {
+			title = peerTitle(source)
+		}
+		head, _ := gtk.LabelNew(title)
+		head.SetXAlign(0)
+		head.SetTooltipText(source.ID)
+		p.grid.Attach(head, 0, row+1, 1, 1)
+		p.cells[source.ID] = make(map[string]*gtk.Label)
+		for col, target := range peers {
+			text := "…"
+			if source.ID == target.ID {
+				text = "—"
+			}
+			cell, _ := gtk.LabelNew(text)
+			addStyleClass(cell, "peer-health")
+			p.grid.Attach(cell, col+1, row+1, 1, 1)
+			p.cells[source.ID][target.ID] = cell
+		}
+	}
+	p.scroll.Add(p.grid)
+	p.grid.ShowAll()
+	p.summary.SetText(fmt.Sprintf(tr("Pinging %d peers…"), len(peers)))
+}
+
+func peerTitle(peer peerInfo) string {
+	if peer.Name != "" {
+		return peer.Name
+	}
+	return peer.ID
+}
+
+func (p *peerHealthPanel) ping(client *hubclient.Client, round int, peers []peerInfo) {
+	sources := []string{""}
+	for _, peer := range peers {
+		sources = append(sources, peer.ID)
+	}
+	var (
+		wg          sync.WaitGroup
+		mu          sync.Mutex
+		failed, all int
+	)
+	sem := make(chan struct{}, peerPingWorkers)
+	for _, from := range sources {
+		for _, target := range peers {
+			if from == target.ID {
+				continue
+			}
+			from, to := from, target.ID
+			all++
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer func() { <-sem; wg.Done() }()
+				res, err := client.PingPeer(p.host.Context(), from, to)
+				if err != nil {
+					res = &hubclient.PeerPing{Peer: to, From: from, Error: err.Error()}
+				}
+				if !res.Reachable {
+					mu.Lock()
+					failed++
+					mu.Unlock()
+				}
+				glib.IdleAdd(func() bool {
+					if round == p.round {
+						p.showPing(from, to, res)
+					}
+					return false
+				})
+			}()
+		}
+	}
+	wg.Wait()
+	p.host.Logf("peer health: %d of %d pings answered", all-failed, all)
+	glib.IdleAdd(func() bool {
+		if round != p.round {
+			return false
+		}
+		p.pingBtn.SetSensitive(true)
+		if failed == 0 {
+			p.summary.SetText(fmt.Sprintf(tr("All %d pings answered"), all))
+		} else {
+			p.summary.SetText(fmt.Sprintf(tr("%d of %d pings unanswered"), failed, all))
+		}
+		return false
+	})
+}
+
+// showPing fills one cell, coloured like the link indicator.
+func (p *peerHealthPanel) showPing(from, to string, res *hubclient.PeerPing) {
+	cell := p.cells[from][to]
+	if cell == nil {
+		return
+	}
+	level := linkGood
+	latency := time.Duration(res.LatencyMs * float64(time.Millisecond))
+	switch {
+	case !res.Reachable || latency > time.Second:
+		level = linkPoor
+	case latency > 300*time.Millisecond:
+		level = linkDegraded
+	}
+	if res.Reachable {
+		cell.SetText(fmt.Sprintf(tr("%.0f ms"), res.LatencyMs))
+		cell.SetTooltipText(fmt.Sprintf(tr("%s answered in %.1f ms"), p.host.PeerName(to), res.LatencyMs))
+	} else {
+		cell.SetText("✕")
+		cell.SetTooltipText(fmt.Sprintf(tr("%s did not answer: %s"), p.host.PeerName(to), res.Error))
+	}
+	if ctx, err := cell.GetStyleContext(); err == nil {
+		for _, name := range linkLevelNames {
+			ctx.RemoveClass(name)
+		}
+		ctx.AddClass(level.String())
+	}
+}
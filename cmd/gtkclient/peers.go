@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+type peerInfo struct {
+	ID       string
+	Name     string
+	JoinedAt string
+}
+
+type peerRow struct {
+	row   *gtk.ListBoxRow
+	label *gtk.Label
+}
+
+func (a *app) buildPeerPanel(vbox *gtk.Box) {
+	panel, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 6)
+	vbox.PackStart(a.dockPanel("peers", tr("Peers"), panel), false, false, 0)
+
+	peerFrame, _ := gtk.FrameNew(tr("Peers"))
+	peerFrame.SetShadowType(gtk.SHADOW_IN)
+	peerFrame.SetLabelAlign(0, 0.5)
+	panel.PackStart(peerFrame, true, true, 0)
+
+	peerScroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	peerScroll.SetPolicy(gtk.POLICY_NEVER, gtk.POLICY_AUTOMATIC)
+	peerScroll.SetSizeRequest(-1, 96)
+	peerFrame.Add(peerScroll)
+
+	a.peerList, _ = gtk.ListBoxNew()
+	a.peerList.SetSelectionMode(gtk.SELECTION_SINGLE)
+	setAccessible(a.peerList, tr("Peers"), tr("Select a peer, then browse its shared files"))
+	placeholder, _ := gtk.LabelNew(tr("No peers known yet"))
+	placeholder.Show()
+	a.peerList.SetPlaceholder(placeholder)
+	peerScroll.Add(a.peerList)
+
+	peerActions, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	panel.PackStart(peerActions, false, false, 0)
+	a.peerBrowseBtn, _ = gtk.ButtonNewWithMnemonic(tr("Bro_wse Peer Files"))
+	a.peerBrowseBtn.Connect("clicked", func() {
+		peer := a.selectedPeer()
+		go a.browsePeerFiles(peer, "")
+	})
+	peerActions.PackStart(a.peerBrowseBtn, false, false, 0)
+	a.setPeerFilesAvailable(a.currentSocket().Supports(protocol.CapPeerFiles))
+	a.peerRestartBtn, _ = gtk.ButtonNewWithMnemonic(tr("Re_start"))
+	a.peerRestartBtn.Connect("clicked", func() { a.confirmPeerControl("restart", a.selectedPeer()) })
+	peerActions.PackStart(a.peerRestartBtn, false, false, 0)
+	a.peerUpdateBtn, _ = gtk.ButtonNewWithMnemonic(tr("_Update"))
+	a.peerUpdateBtn.Connect("clicked", func() { a.confirmPeerControl("update", a.selectedPeer()) })
+	peerActions.PackStart(a.peerUpdateBtn, false, false, 0)
+	a.setPeerControllable(a.currentSocket().Supports(protocol.CapPeerControl), a.currentSocket().Role())
+}
+
+// selectedPeer returns the id of the highlighted peer row, or "". Must run
+// on the GTK main loop.
+func (a *app) selectedPeer() string {
+	if a.peerList == nil {
+		return ""
+	}
+	row := a.peerList.GetSelectedRow()
+	if row == nil {
+		return ""
+	}
+	idx := row.GetIndex()
+	if idx < 0 || idx >= len(a.peerOrder) {
+		return ""
+	}
+	return a.peerOrder[idx]
+}
+
+func (a *app) fetchPeers() {
+	result, err := a.currentSocket().Command(a.ctx, "peers")
+	if err != nil {
+		a.reportError("peers", err, a.fetchPeers)
+		return
+	}
+	enc, _ := json.Marshal(result)
+	a.logf("command result: %s", enc)
+	peers := parsePeerList(result)
+	glib.IdleAdd(func() bool {
+		a.updatePeers(peers)
+		return false
+	})
+}
+
+// updatePeers merges a fresh peer listing into the panel. Must run on the
+// GTK main loop.
+func (a *app) updatePeers(peers []peerInfo) {
+	if a.peers == nil {
+		a.peers = make(map[string]*peerInfo)
+	}
+	seen := make(map[string]bool, len(peers))
+	for _, p := range peers {
+		p := p
+		seen[p.ID] = true
+		a.peers[p.ID] = &p
+	}
+	for id := range a.peers {
+		if !seen[id] && a.nowPlaying[id] == nil {
+			delete(a.peers, id)
+		}
+	}
+	a.metrics.Set(metricHubPeers, nil, float64(len(peers)))
+	a.renderPeerList()
+}
+
+// ensurePeer makes sure id has a row even if it only showed up through an
+// event. Must run on the GTK main loop.
+func (a *app) ensurePeer(id string) {
+	if id == "" {
+		return
+	}
+	if a.peers == nil {
+		a.peers = make(map[string]*peerInfo)
+	}
+	if _, ok := a.peers[id]; !ok {
+		a.peers[id] = &peerInfo{ID: id}
+		a.renderPeerList()
+	}
+}
+
+func (a *app) renderPeerList() {
+	if a.peerList == nil {
+		return
+	}
+	for _, r := range a.peerRows {
+		a.peerList.Remove(r.row)
+		r.row.Destroy()
+	}
+	a.peerRows = make(map[string]*peerRow, len(a.peers))
+	ids := make([]string, 0, len(a.peers))
+	for id := range a.peers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	a.peerOrder = a.peerOrder[:0]
+	for _, id := range ids {
+		row, err := gtk.ListBoxRowNew()
+		if err != nil {
+			a.logf("peer row create error: %v", err)
+			continue
+		}
+		label, err := gtk.LabelNew("")
+		if err != nil {
+			a.logf("peer row create error: %v", err)
+			continue
+		}
+		label.SetXAlign(0)
+		label.SetSelectable(false)
+		label.SetMarginStart(6)
+		label.SetMarginEnd(6)
+		label.SetMarginTop(2)
+		label.SetMarginBottom(2)
+		row.Add(label)
+		a.peerList.Add(row)
+		row.ShowAll()
+		a.peerRows[id] = &peerRow{row: row, label: label}
+		a.peerOrder = append(a.peerOrder, id)
+		a.renderPeerRow(id)
+	}
+}
+
+func (a *app) renderPeerRow(id string) {
+	r, ok := a.peerRows[id]
+	if !ok {
+		return
+	}
+	p := a.peers[id]
+	text := id
+	if p != nil && p.Name != "" && p.Name != id {
+		text = fmt.Sprintf("%s (%s)", p.Name, id)
+	}
+	if np := a.nowPlaying[id]; np != nil {
+		text = fmt.Sprintf("%s — %s", text, formatNowPlaying(np))
+	}
+	if phase := a.peerControl[id]; phase != "" {
+		text = fmt.Sprintf("%s [%s]", text, phase)
+	}
+	r.label.SetText(text)
+}
+
+func parsePeerList(raw interface{}) []peerInfo {
+	switch val := raw.(type) {
+	case map[string]interface{}:
+		for _, key := range []string{"result", "peers", "clients"} {
+			if nested, ok := val[key]; ok {
+				return parsePeerList(nested)
+			}
+		}
+		if p, ok := parsePeerEntry(val); ok {
+			return []peerInfo{p}
+		}
+		return nil
+	case []interface{}:
+		peers := make([]peerInfo, 0, len(val))
+		for _, item := range val {
+			switch entry := item.(type) {
+			case string:
+				if entry = strings.TrimSpace(entry); entry != "" {
+					peers = append(peers, peerInfo{ID: entry})
+				}
+			case map[string]interface{}:
+				if p, ok := parsePeerEntry(entry); ok {
+					peers = append(peers, p)
+				}
+			}
+		}
+		return peers
+	case string:
+		// some hubs answer with one peer id per line
+		var peers []peerInfo
+		for _, line := range strings.Split(val, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				peers = append(peers, peerInfo{ID: line})
+			}
+		}
+		return peers
+	default:
+		return nil
+	}
+}
+
+func parsePeerEntry(entry map[string]interface{}) (peerInfo, bool) {
+	id, _ := entry["id"].(string)
+	if id == "" {
+		id, _ = entry["clientId"].(string)
+	}
+	if id == "" {
+		return peerInfo{}, false
+	}
+	p := peerInfo{ID: id}
+	p.Name, _ = entry["name"].(string)
+	p.JoinedAt, _ = entry["joinedAt"].(string)
+	return p, true
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+)
+
+// fetchPlayStats loads the hub's play counts for the audio grid. Hubs
+// without them leave the counts to the broadcast-plays seen this session.
+func (a *app) fetchPlayStats() {
+	client := a.currentSocket()
+	if !client.Supports(protocol.CapStats) {
+		glib.IdleAdd(func() bool {
+			a.playCounts, a.playCountsKnown = nil, false
+			a.setNeverPlayedAvailable(false)
+			return false
+		})
+		return
+	}
+	stats, err := client.Stats(a.ctx)
+	if err != nil {
+		a.reportError("stats", err, a.fetchPlayStats)
+		return
+	}
+	glib.IdleAdd(func() bool {
+		a.playCounts = make(map[string]int, len(stats))
+		for _, s := range stats {
+			a.playCounts[s.Name] = s.Plays
+		}
+		a.playCountsKnown = true
+		a.setNeverPlayedAvailable(true)
+		if a.audioFiles != nil {
+			a.refreshAudioButtons(a.audioFiles, "")
+		}
+		return false
+	})
+}
+
+// countPlay adds a broadcast-play event to the counts.
+func (a *app) countPlay(filename string) {
+	if filename == "" {
+		return
+	}
+	glib.IdleAdd(func() bool {
+		if a.playCounts == nil {
+			a.playCounts = make(map[string]int)
+		}
+		a.playCounts[filename]++
+		if a.audioFiles != nil {
+			a.refreshAudioButtons(a.audioFiles, "")
+		}
+		return false
+	})
+}
+
+// withPlayCounts fills in Plays. Must run on the GTK main loop.
+func (a *app) withPlayCounts(files []audioFile) []audioFile {
+	out := make([]audioFile, len(files))
+	for i, f := range files {
+		f.Plays = a.playCounts[f.Name]
+		out[i] = f
+	}
+	return out
+}
+
+// setNeverPlayedAvailable offers the Never played filter only once the
+// hub's counts are known, since a session's alone would list nearly every
+// file. Must run on the GTK main loop.
+func (a *app) setNeverPlayedAvailable(ok bool) {
+	if a.neverPlayedCheck == nil {
+		return
+	}
+	a.neverPlayedCheck.SetSensitive(ok)
+	if ok {
+		a.neverPlayedCheck.SetTooltipText(tr("Show only files nobody has broadcast-played, to help prune the library"))
+	} else {
+		a.neverPlayedCheck.SetTooltipText(tr("This hub does not count plays"))
+	}
+}
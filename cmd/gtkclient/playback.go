@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const volumeDebounce = 250 * time.Millisecond
+
+func (a *app) buildPlaybackControls(vbox *gtk.Box) {
+	playbackBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	vbox.PackStart(playbackBox, false, false, 0)
+	a.playbackBox = playbackBox
+
+	a.volumeScale, _ = gtk.ScaleNewWithRange(gtk.ORIENTATION_HORIZONTAL, 0, 100, 1)
+	playbackBox.PackStart(mnemonicLabel(tr("_Volume:"), a.volumeScale), false, false, 0)
+	a.volumeScale.SetValue(100)
+	a.volumeScale.SetSizeRequest(160, -1)
+	a.volumeScale.Connect("value-changed", func() {
+		// the slider fires continuously while dragging; only send the
+		// value it settles on
+		if a.volumeTimer != nil {
+			a.volumeTimer.Stop()
+		}
+		a.updateMPRIS()
+		level := int(a.volumeScale.GetValue())
+		all := a.playbackAllCheck.GetActive()
+		a.volumeTimer = time.AfterFunc(volumeDebounce, func() {
+			a.invokeVolume(level, all)
+		})
+	})
+	playbackBox.PackStart(a.volumeScale, true, true, 0)
+
+	pauseBtn, _ := gtk.ButtonNewWithLabel(tr("Pause"))
+	pauseBtn.Connect("clicked", func() {
+		all := a.playbackAllCheck.GetActive()
+		go a.invokePlaybackControl("pause", nil, all)
+	})
+	playbackBox.PackStart(pauseBtn, false, false, 0)
+
+	resumeBtn, _ := gtk.ButtonNewWithLabel(tr("Resume"))
+	resumeBtn.Connect("clicked", func() {
+		all := a.playbackAllCheck.GetActive()
+		go a.invokePlaybackControl("resume", nil, all)
+	})
+	playbackBox.PackStart(resumeBtn, false, false, 0)
+
+	stopBtn, _ := gtk.ButtonNewWithLabel(tr("Stop"))
+	stopBtn.Connect("clicked", func() {
+		all := a.playbackAllCheck.GetActive()
+		go a.invokePlaybackControl("stop", nil, all)
+	})
+	playbackBox.PackStart(stopBtn, false, false, 0)
+
+	a.seekSpin, _ = gtk.SpinButtonNewWithRange(0, 24*60*60, 1)
+	playbackBox.PackStart(mnemonicLabel(tr("See_k (s):"), a.seekSpin), false, false, 0)
+	playbackBox.PackStart(a.seekSpin, false, false, 0)
+	seekBtn, _ := gtk.ButtonNewWithLabel(tr("Seek"))
+	setAccessible(seekBtn, tr("Seek to position"), "")
+	seekBtn.Connect("clicked", func() {
+		position := a.seekSpin.GetValue()
+		all := a.playbackAllCheck.GetActive()
+		go a.invokePlaybackControl("seek", map[string]any{"position": position}, all)
+	})
+	playbackBox.PackStart(seekBtn, false, false, 0)
+
+	a.playbackAllCheck, _ = gtk.CheckButtonNewWithLabel(tr("All peers"))
+	a.playbackAllCheck.SetTooltipText(tr("Apply playback controls to every connected peer"))
+	playbackBox.PackEnd(a.playbackAllCheck, false, false, 0)
+}
+
+func (a *app) invokeVolume(level int, all bool) {
+	if level < 0 || level > 100 {
+		a.logf("volume out of range: %d", level)
+		return
+	}
+	a.invokePlaybackControl("volume", map[string]any{"volume": level}, all)
+}
+
+// invokePlaybackControl sends one of the transport actions (volume, pause,
+// resume, stop, seek). With all set the hub fans it out to every peer
+// instead of only this client's player.
+func (a *app) invokePlaybackControl(action string, payload map[string]any, all bool) {
+	if err := a.currentSocket().Playback(a.ctx, action, payload, all); err != nil {
+		a.reportError(action, err, func() { a.invokePlaybackControl(action, payload, all) })
+		return
+	}
+	switch action {
+	case "volume":
+		a.logf("volume set: %v%%", payload["volume"])
+	case "seek":
+		a.logf("seek sent: %s", formatPlaybackPosition(payload["position"]))
+	default:
+		a.logf("%s sent", action)
+	}
+}
+
+func formatPlaybackPosition(value any) string {
+	seconds, ok := value.(float64)
+	if !ok {
+		return fmt.Sprint(value)
+	}
+	return formatSeconds(seconds)
+}
+
+func formatSeconds(seconds float64) string {
+	if seconds < 0 {
+		seconds = 0
+	}
+	d := time.Duration(seconds * float64(time.Second))
+	return fmt.Sprintf("%d:%02d", int(d.Minutes()), int(d.Seconds())%60)
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/i18n"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+func builtinTimeout(action string) time.Duration {
+	if d, ok := defaultTimeouts[action]; ok {
+		return d
+	}
+	return hubclient.DefaultTimeout
+}
+
+// showPreferences edits the per-action timeouts and the upload limit of the
+// active profile.
+func (a *app) showPreferences() {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		a.logf("preferences dialog error: %v", err)
+		return
+	}
+	dialog.SetTitle(tr("Preferences"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetDefaultSize(420, 480)
+	dialog.AddButton(tr("Cancel"), gtk.RESPONSE_CANCEL)
+	dialog.AddButton(tr("Save"), gtk.RESPONSE_OK)
+
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.SetBorderWidth(8)
+
+	limitBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	content.PackStart(limitBox, false, false, 0)
+	limitLabel, _ := gtk.LabelNew(tr("Upload limit (KiB/s, 0 = unlimited):"))
+	limitBox.PackStart(limitLabel, false, false, 0)
+	limitSpin, _ := gtk.SpinButtonNewWithRange(0, 1<<20, 64)
+	limitSpin.SetValue(float64(a.profile().UploadLimit / 1024))
+	limitLabel.SetMnemonicWidget(limitSpin)
+	limitBox.PackEnd(limitSpin, false, false, 0)
+
+	pollBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	content.PackStart(pollBox, false, false, 0)
+	pollLabel, _ := gtk.LabelNew(tr("Refresh status every (seconds, 0 = off):"))
+	pollBox.PackStart(pollLabel, false, false, 0)
+	pollSpin, _ := gtk.SpinButtonNewWithRange(0, 3600, 5)
+	pollSpin.SetValue(float64(a.profile().StatusPollSeconds))
+	pollLabel.SetMnemonicWidget(pollSpin)
+	pollBox.SetTooltipText(tr("Fetches status when the hub has not sent any for this long; hubs that push status are not polled"))
+	pollBox.PackEnd(pollSpin, false, false, 0)
+
+	clipPlayCheck, _ := gtk.CheckButtonNewWithLabel(tr("Broadcast-play audio shared from the clipboard (Ctrl+Shift+V)"))
+	clipPlayCheck.SetActive(a.profile().ClipboardPlay)
+	content.PackStart(clipPlayCheck, false, false, 0)
+	confirmCheck, _ := gtk.CheckButtonNewWithLabel(tr("Ask before broadcasting to every peer"))
+	confirmCheck.SetActive(a.profile().ConfirmBroadcasts)
+	content.PackStart(confirmCheck, false, false, 0)
+	normalizeCheck, _ := gtk.CheckButtonNewWithLabel(tr("Play files at the same loudness"))
+	normalizeCheck.SetActive(a.profile().NormalizePlayback)
+	normalizeCheck.SetTooltipText(tr("Peers apply the ReplayGain measured at upload; needs a hub that keeps loudness"))
+	content.PackStart(normalizeCheck, false, false, 0)
+
+	saveTranscode := a.buildTranscodePreferences(content)
+	saveChimes := a.buildChimePreferences(content)
+	saveDND := a.buildDNDPreferences(content)
+	saveProxy := a.buildProxyPreferences(content)
+
+	downloaderBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	content.PackStart(downloaderBox, false, false, 0)
+	downloaderEntry, _ := gtk.EntryNew()
+	downloaderEntry.SetText(a.profile().Downloader)
+	downloaderEntry.SetPlaceholderText(strings.Join(defaultDownloader, " "))
+	downloaderBox.SetTooltipText(tr("Extracts audio from video and podcast pages for Add from URL; {url} and {dir} are filled in, and the audio must be left in {dir}"))
+	downloaderBox.PackStart(mnemonicLabel(tr("Media _downloader:"), downloaderEntry), false, false, 0)
+	downloaderBox.PackStart(downloaderEntry, true, true, 0)
+
+	syncTagsCheck, _ := gtk.CheckButtonNewWithLabel(tr("Share tags and favorites with everyone on the hub"))
+	syncTagsCheck.SetActive(a.profile().SyncTags)
+	syncTagsCheck.SetTooltipText(tr("Needs a hub that stores tags; otherwise they stay on this computer"))
+	content.PackStart(syncTagsCheck, false, false, 0)
+
+	themeBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	content.PackStart(themeBox, false, false, 0)
+	themeLabel, _ := gtk.LabelNew(tr("Theme:"))
+	themeBox.PackStart(themeLabel, false, false, 0)
+	themeCombo, _ := gtk.ComboBoxTextNew()
+	for _, t := range themes {
+		themeCombo.Append(t, t)
+	}
+	if !themeCombo.SetActiveID(a.config.Theme) {
+		themeCombo.SetActiveID("system")
+	}
+	themeLabel.SetMnemonicWidget(themeCombo)
+	themeBox.PackStart(themeCombo, false, false, 0)
+	if path, err := userCSSPath(); err == nil {
+		themeBox.SetTooltipText(tr("Custom CSS is read from ") + path)
+	}
+
+	langBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	content.PackStart(langBox, false, false, 0)
+	langLabel, _ := gtk.LabelNew(tr("Language:"))
+	langBox.PackStart(langLabel, false, false, 0)
+	langCombo, _ := gtk.ComboBoxTextNew()
+	langCombo.Append("system", tr("System locale"))
+	for _, l := range i18n.Languages() {
+		langCombo.Append(l, l)
+	}
+	if !langCombo.SetActiveID(a.config.Language) {
+		langCombo.SetActiveID("system")
+	}
+	langCombo.SetTooltipText(tr("Takes effect after a restart"))
+	langLabel.SetMnemonicWidget(langCombo)
+	langBox.PackStart(langCombo, false, false, 0)
+
+	timeoutsLabel, _ := gtk.LabelNew(tr("Request timeouts (seconds):"))
+	timeoutsLabel.SetXAlign(0)
+	content.PackStart(timeoutsLabel, false, false, 0)
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_NEVER, gtk.POLICY_AUTOMATIC)
+	scroll.SetVExpand(true)
+	content.PackStart(scroll, true, true, 0)
+	grid, _ := gtk.GridNew()
+	grid.SetRowSpacing(4)
+	grid.SetColumnSpacing(12)
+	scroll.Add(grid)
+
+	a.timeoutsMu.RLock()
+	current := make(map[string]float64, len(a.timeouts))
+	for k, v := range a.timeouts {
+		current[k] = v
+	}
+	a.timeoutsMu.RUnlock()
+
+	spins := make(map[string]*gtk.SpinButton)
+	for i, action := range timeoutActions(current) {
+		label, _ := gtk.LabelNew(action)
+		label.SetXAlign(0)
+		label.SetHExpand(true)
+		grid.Attach(label, 0, i, 1, 1)
+		spin, _ := gtk.SpinButtonNewWithRange(1, 3600, 1)
+		label.SetMnemonicWidget(spin)
+		builtin := builtinTimeout(action)
+		spin.SetTooltipText(fmt.Sprintf(tr("Built-in default: %s"), builtin))
+		value := builtin.Seconds()
+		if secs, ok := current[action]; ok && secs > 0 {
+			value = secs
+		}
+		spin.SetValue(value)
+		grid.Attach(spin, 1, i, 1, 1)
+		spins[action] = spin
+	}
+
+	dialog.ShowAll()
+	response := dialog.Run()
+	if response == gtk.RESPONSE_OK {
+		// only values that differ from the built-in defaults are stored, so
+		// later default changes still reach untouched actions
+		overrides := make(map[string]float64)
+		for action, spin := range spins {
+			secs := spin.GetValue()
+			if secs != builtinTimeout(action).Seconds() {
+				overrides[action] = secs
+			}
+		}
+		a.setTimeouts(overrides)
+		limit := int64(limitSpin.GetValue()) * 1024
+		normalize := normalizeCheck.GetActive()
+		poll := pollSpin.GetValueAsInt()
+		a.updateProfile(func(p *profileConfig) {
+			p.UploadLimit = limit
+			p.ClipboardPlay = clipPlayCheck.GetActive()
+			p.ConfirmBroadcasts = confirmCheck.GetActive()
+			p.NormalizePlayback = normalize
+			p.StatusPollSeconds = poll
+		})
+		a.uploadRate.Store(limit)
+		a.normalizePlay.Store(normalize)
+		a.setStatusPoll(poll)
+		saveTranscode()
+		saveChimes()
+		saveDND()
+		saveProxy()
+		downloader, _ := downloaderEntry.GetText()
+		if _, err := splitCommand(downloader); err != nil {
+			a.logf("media downloader not saved: %v", err)
+		} else {
+			a.updateProfile(func(p *profileConfig) { p.Downloader = strings.TrimSpace(downloader) })
+		}
+		if syncTags := syncTagsCheck.GetActive(); syncTags != a.profile().SyncTags {
+			a.updateProfile(func(p *profileConfig) { p.SyncTags = syncTags })
+			if syncTags && a.tagsSynced() {
+				local := make(map[string][]string, len(a.profile().FileTags))
+				for name, tags := range a.profile().FileTags {
+					local[name] = tags
+				}
+				go a.pushLocalTags(local)
+			}
+			if a.audioFiles != nil {
+				a.refreshAudioButtons(a.audioFiles, "")
+			}
+		}
+		a.config.Theme = themeCombo.GetActiveID()
+		if a.config.Theme == "system" {
+			a.config.Theme = ""
+		}
+		a.applyTheme()
+		a.config.Language = langCombo.GetActiveID()
+		if a.config.Language == "system" {
+			a.config.Language = ""
+		}
+		a.currentSocket().SetRateLimit(a.uploadLimit())
+		if err := a.config.save(); err != nil {
+			a.reportError("save preferences", err, nil)
+		} else {
+			a.logf("preferences saved")
+		}
+	}
+	dialog.Destroy()
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	// previewImageLimit is the largest image fetched for a preview.
+	previewImageLimit = 8 << 20
+	// previewTextLimit is how much of a text file is shown.
+	previewTextLimit = 256 << 10
+	previewMaxSize   = 480
+)
+
+// textExtensions are previewed as text whatever content type the hub
+// reports for them.
+var textExtensions = map[string]bool{
+	".txt": true, ".md": true, ".log": true, ".csv": true, ".json": true,
+	".yaml": true, ".yml": true, ".toml": true, ".ini": true, ".conf": true,
+	".xml": true, ".srt": true, ".vtt": true, ".lrc": true, ".m3u": true,
+	".m3u8": true, ".cue": true, ".pls": true,
+}
+
+// previewKind is "image" or "text" for files the preview pane can show,
+// and "" for the rest.
+func previewKind(name, contentType string) string {
+	contentType = strings.ToLower(contentType)
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		return "image"
+	case strings.HasPrefix(contentType, "text/"),
+		strings.HasPrefix(contentType, "application/json"),
+		strings.HasPrefix(contentType, "application/xml"),
+		textExtensions[strings.ToLower(path.Ext(name))]:
+		return "text"
+	}
+	return ""
+}
+
+// filePreview is the pane beside the Files table. All fields are owned by
+// the GTK main loop.
+type filePreview struct {
+	stack   *gtk.Stack
+	message *gtk.Label
+	image   *gtk.Image
+	text    *gtk.TextBuffer
+	// shown counts selections so a slow fetch cannot replace a newer one
+	shown int
+}
+
+func newFilePreview() *filePreview {
+	p := &filePreview{}
+	p.stack, _ = gtk.StackNew()
+	p.stack.SetSizeRequest(previewMaxSize/2, -1)
+	p.message, _ = gtk.LabelNew(tr("Select an image or text file to preview it"))
+	p.message.SetLineWrap(true)
+	p.stack.AddNamed(p.message, "message")
+
+	imageScroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	imageScroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	p.image, _ = gtk.ImageNew()
+	setAccessible(p.image, tr("Image preview"), "")
+	imageScroll.Add(p.image)
+	p.stack.AddNamed(imageScroll, "image")
+
+	textScroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	textScroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	view, _ := gtk.TextViewNew()
+	view.SetEditable(false)
+	view.SetMonospace(true)
+	setAccessible(view, tr("Text preview"), "")
+	textScroll.Add(view)
+	p.text, _ = view.GetBuffer()
+	p.stack.AddNamed(textScroll, "text")
+	return p
+}
+
+func (p *filePreview) showMessage(text string) {
+	p.message.SetText(text)
+	p.stack.SetVisibleChildName("message")
+}
+
+// previewHubFile fetches name into the preview pane when it is an image
+// or text. Must run on the GTK main loop.
+func (a *app) previewHubFile(name, contentType string, size int64) {
+	p := a.filesView.preview
+	p.shown++
+	shown := p.shown
+	kind := previewKind(name, contentType)
+	switch {
+	case name == "":
+		p.showMessage(tr("Select an image or text file to preview it"))
+		return
+	case kind == "":
+		p.showMessage(fmt.Sprintf(tr("No preview for %s"), contentType))
+		return
+	case kind == "image" && size > previewImageLimit:
+		p.showMessage(fmt.Sprintf(tr("%s is too large to preview (%s)"), name, formatBytes(size)))
+		return
+	}
+	p.showMessage(fmt.Sprintf(tr("Loading %s…"), name))
+	limit := int64(previewTextLimit)
+	if kind == "image" {
+		limit = previewImageLimit
+	}
+	go func() {
+		data, truncated, err := a.fetchHubFile(name, limit)
+		glib.IdleAdd(func() bool {
+			if p.shown != shown {
+				return false
+			}
+			if err != nil {
+				p.showMessage(fmt.Sprintf(tr("Preview failed: %v"), err))
+				return false
+			}
+			if kind == "image" {
+				a.showImagePreview(p, name, data, truncated)
+			} else {
+				showTextPreview(p, data, truncated)
+			}
+			return false
+		})
+	}()
+}
+
+func (a *app) showImagePreview(p *filePreview, name string, data []byte, truncated bool) {
+	if truncated {
+		p.showMessage(fmt.Sprintf(tr("%s is too large to preview"), name))
+		return
+	}
+	pixbuf, err := pixbufFromBytes(data)
+	if err != nil {
+		a.logf("preview error for %s: %v", name, err)
+		p.showMessage(fmt.Sprintf(tr("Cannot show %s as an image"), name))
+		return
+	}
+	w, h := pixbuf.GetWidth(), pixbuf.GetHeight()
+	p.image.SetFromPixbuf(scalePixbuf(pixbuf, previewMaxSize))
+	p.image.SetTooltipText(fmt.Sprintf(tr("%s, %d×%d"), name, w, h))
+	p.stack.SetVisibleChildName("image")
+}
+
+func pixbufFromBytes(data []byte) (*gdk.Pixbuf, error) {
+	loader, err := gdk.PixbufLoaderNew()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := loader.Write(data); err != nil {
+		loader.Close()
+		return nil, err
+	}
+	if err := loader.Close(); err != nil {
+		return nil, err
+	}
+	return loader.GetPixbuf()
+}
+
+func showTextPreview(p *filePreview, data []byte, truncated bool) {
+	if truncated {
+		// the cut may have split the last character
+		for i := 1; i < utf8.UTFMax && len(data) > 0 && !utf8.Valid(data); i++ {
+			data = data[:len(data)-1]
+		}
+	}
+	if !utf8.Valid(data) {
+		p.showMessage(tr("This file is not UTF-8 text"))
+		return
+	}
+	text := string(data)
+	if truncated {
+		text += "\n" + fmt.Sprintf(tr("[preview stops after %s]"), formatBytes(int64(len(data))))
+	}
+	p.text.SetText(text)
+	p.stack.SetVisibleChildName("text")
+}
+
+// fetchHubFile reads up to limit bytes of a hub file, and reports whether
+// there was more.
+func (a *app) fetchHubFile(filename string, limit int64) ([]byte, bool, error) {
+	src, err := a.hubAudioURL(filename)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := archiveHTTPClient.Get(src)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	a.recordTransfer("download", "preview", int64(len(data)))
+	if int64(len(data)) > limit {
+		return data[:limit], true, nil
+	}
+	return data, false, nil
+}
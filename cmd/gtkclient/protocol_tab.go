@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const protocolLogLimit = 1000
+
+// protocolView is the "Protocol" tab listing hub messages that did not
+// match their schema. All fields are owned by the GTK main loop.
+type protocolView struct {
+	buffer   *gtk.TextBuffer
+	view     *gtk.TextView
+	summary  *gtk.Label
+	used     int
+	rejected int
+}
+
+func (a *app) schemaValidation() hubclient.Validation {
+	if a.profile() != nil && a.profile().LenientSchemas {
+		return hubclient.ValidateLenient
+	}
+	return hubclient.ValidateStrict
+}
+
+func (a *app) buildProtocolTab() gtk.IWidget {
+	v := &protocolView{}
+	a.protocolView = v
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+
+	bar, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	box.PackStart(bar, false, false, 0)
+	lenientCheck, _ := gtk.CheckButtonNewWithLabel(tr("Lenient mode"))
+	lenientCheck.SetTooltipText(tr("Use hub messages that do not match their schema instead of rejecting them; needed for some older hubs"))
+	lenientCheck.SetActive(a.profile().LenientSchemas)
+	lenientCheck.Connect("toggled", func() {
+		lenient := lenientCheck.GetActive()
+		a.updateProfile(func(p *profileConfig) { p.LenientSchemas = lenient })
+		a.currentSocket().SetValidation(a.schemaValidation())
+		if err := a.config.save(); err != nil {
+			a.logf("config save error: %v", err)
+		}
+	})
+	bar.PackStart(lenientCheck, false, false, 0)
+	v.summary, _ = gtk.LabelNew("")
+	bar.PackStart(v.summary, false, false, 0)
+	clearBtn, _ := gtk.ButtonNewWithLabel(tr("Clear"))
+	setAccessible(clearBtn, tr("Clear protocol diagnostics"), "")
+	clearBtn.Connect("clicked", func() {
+		v.buffer.SetText("")
+		v.used, v.rejected = 0, 0
+		v.summary.SetText("")
+	})
+	bar.PackEnd(clearBtn, false, false, 0)
+
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	scroll.SetVExpand(true)
+	box.PackStart(scroll, true, true, 0)
+	v.view, _ = gtk.TextViewNew()
+	v.view.SetEditable(false)
+	v.view.SetMonospace(true)
+	v.view.SetWrapMode(gtk.WRAP_WORD_CHAR)
+	setAccessible(v.view, tr("Schema mismatches"), "")
+	scroll.Add(v.view)
+	v.buffer, _ = v.view.GetBuffer()
+	return box
+}
+
+// handleSchemaViolation records a hub message that failed its schema. A
+// rejected one also goes to the client log, since something the user
+// asked for may not have happened.
+func (a *app) handleSchemaViolation(payload json.RawMessage) {
+	var report protocol.SchemaError
+	if err := json.Unmarshal(payload, &report); err != nil {
+		a.logf("schema report parse error: %v", err)
+		return
+	}
+	if report.Rejected {
+		a.logf("rejected hub message: %v", &report)
+	}
+	ts := time.Now().Format("15:04:05")
+	glib.IdleAdd(func() bool {
+		v := a.protocolView
+		if v == nil {
+			return false
+		}
+		outcome := tr("used anyway")
+		if report.Rejected {
+			outcome = tr("rejected")
+			v.rejected++
+		} else {
+			v.used++
+		}
+		text := fmt.Sprintf("[%s] %s %s %s\n", ts, report.Name, report.Kind, outcome)
+		for _, violation := range report.Violations {
+			text += "    " + violation.String() + "\n"
+		}
+		v.buffer.Insert(v.buffer.GetEndIter(), text)
+		for v.buffer.GetLineCount() > protocolLogLimit {
+			v.buffer.Delete(v.buffer.GetStartIter(), v.buffer.GetIterAtLine(1))
+		}
+		v.summary.SetText(fmt.Sprintf(tr("%d rejected, %d used anyway"), v.rejected, v.used))
+		if mark := v.buffer.CreateMark("", v.buffer.GetEndIter(), false); mark != nil {
+			v.view.ScrollMarkOnscreen(mark)
+		}
+		return false
+	})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+
+	"brain/internal/hubclient"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// proxyFor picks the proxy for the socket at addr; "" dials directly.
+func (a *app) proxyFor(addr string) string {
+	return profileProxy(a.profile(), addr)
+}
+
+func profileProxy(p *profileConfig, addr string) string {
+	switch proxy := p.Proxy; proxy {
+	case "":
+		return hubclient.ProxyFromEnvironment(addr)
+	case "direct":
+		return ""
+	default:
+		return proxy
+	}
+}
+
+func validProxy(proxy string) bool {
+	if proxy == "" || proxy == "direct" {
+		return true
+	}
+	u, err := url.Parse(proxy)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+		return true
+	}
+	return false
+}
+
+func (a *app) buildProxyPreferences(content *gtk.Box) func() {
+	row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	entry, _ := gtk.EntryNew()
+	entry.SetText(a.profile().Proxy)
+	entry.SetPlaceholderText(tr("ALL_PROXY, or direct"))
+	entry.SetHExpand(true)
+	row.PackStart(mnemonicLabel(tr("Pro_xy:"), entry), false, false, 0)
+	row.PackStart(entry, true, true, 0)
+	row.SetTooltipText(tr("socks5://host:1080 or http://host:3128 for the hub socket; \"direct\" ignores ALL_PROXY"))
+	content.PackStart(row, false, false, 0)
+
+	return func() {
+		proxy, _ := entry.GetText()
+		proxy = strings.TrimSpace(proxy)
+		if proxy == a.profile().Proxy {
+			return
+		}
+		if !validProxy(proxy) {
+			a.logf("proxy not saved: %q is not a socks5:// or http:// URL", proxy)
+			return
+		}
+		a.updateProfile(func(p *profileConfig) { p.Proxy = proxy })
+		a.logf("proxy changed; reconnecting")
+		go a.reconnectSocket()
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	// heartbeatInterval spaces the status requests that measure the link.
+	heartbeatInterval = 10 * time.Second
+	heartbeatTimeout  = 3 * time.Second
+	// rttWindow is how many heartbeat round trips jitter is taken over.
+	rttWindow = 12
+	// reconnectWindow is how far back reconnects count against the link.
+	reconnectWindow = 10 * time.Minute
+	// poorTimeoutFactor stretches request timeouts while the link is poor.
+	poorTimeoutFactor = 3
+	// linkWaitCheck is how often deferred work looks at the link again.
+	linkWaitCheck = 2 * time.Second
+)
+
+type linkLevel int
+
+const (
+	linkGood linkLevel = iota
+	linkDegraded
+	linkPoor
+)
+
+var linkLevelNames = [...]string{"good", "degraded", "poor"}
+
+func (l linkLevel) String() string { return linkLevelNames[l] }
+
+func (l linkLevel) title() string {
+	switch l {
+	case linkDegraded:
+		return tr("Link: degraded")
+	case linkPoor:
+		return tr("Link: poor")
+	}
+	return tr("Link: good")
+}
+
+// linkQuality folds heartbeat round trips, missed heartbeats and
+// reconnects into a level. Guarded by mu; indicator is owned by the GTK
+// main loop.
+type linkQuality struct {
+	mu         sync.Mutex
+	rtts       []time.Duration
+	missed     int // consecutive
+	reconnects []time.Time
+	level      linkLevel
+
+	indicator *gtk.Label
+}
+
+// stats returns the mean round trip and the mean change between
+// consecutive ones. Callers hold mu.
+func (q *linkQuality) stats() (mean, jitter time.Duration) {
+	if len(q.rtts) == 0 {
+		return 0, 0
+	}
+	var sum, diffs time.Duration
+	for i, rtt := range q.rtts {
+		sum += rtt
+		if i > 0 {
+			d := rtt - q.rtts[i-1]
+			if d < 0 {
+				d = -d
+			}
+			diffs += d
+		}
+	}
+	mean = sum / time.Duration(len(q.rtts))
+	if len(q.rtts) > 1 {
+		jitter = diffs / time.Duration(len(q.rtts)-1)
+	}
+	return mean, jitter
+}
+
+// recentReconnects drops reconnects older than reconnectWindow and counts
+// the rest. Callers hold mu.
+func (q *linkQuality) recentReconnects(now time.Time) int {
+	keep := q.reconnects[:0]
+	for _, t := range q.reconnects {
+		if now.Sub(t) < reconnectWindow {
+			keep = append(keep, t)
+		}
+	}
+	q.reconnects = keep
+	return len(keep)
+}
+
+// assess recomputes the level. Callers hold mu.
+func (q *linkQuality) assess(now time.Time) linkLevel {
+	mean, jitter := q.stats()
+	reconnects := q.recentReconnects(now)
+	switch {
+	case q.missed >= 2 || reconnects >= 3 || mean > time.Second || jitter > 500*time.Millisecond:
+		return linkPoor
+	case q.missed == 1 || reconnects >= 1 || mean > 300*time.Millisecond || jitter > 100*time.Millisecond:
+		return linkDegraded
+	}
+	return linkGood
+}
+
+func (a *app) linkLevel() linkLevel {
+	a.quality.mu.Lock()
+	defer a.quality.mu.Unlock()
+	return a.quality.level
+}
+
+// updateLink applies change under the lock, reassesses and reports a new
+// level.
+func (a *app) updateLink(change func(q *linkQuality)) {
+	q := &a.quality
+	q.mu.Lock()
+	change(q)
+	prev := q.level
+	q.level = q.assess(time.Now())
+	level := q.level
+	q.mu.Unlock()
+	if level != prev {
+		switch level {
+		case linkPoor:
+			a.logf("link quality %s -> %s: longer timeouts, status refresh paused, uploads deferred", prev, level)
+		default:
+			a.logf("link quality %s -> %s", prev, level)
+		}
+	}
+	glib.IdleAdd(func() bool {
+		a.refreshLinkIndicator()
+		return false
+	})
+}
+
+func (a *app) noteReconnect() {
+	a.updateLink(func(q *linkQuality) { q.reconnects = append(q.reconnects, time.Now()) })
+}
+
+// runHeartbeat times a status request every heartbeatInterval while the
+// socket is up.
+func (a *app) runHeartbeat() {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if state, _ := a.connState(); state != stateConnected && state != stateDegraded {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(a.ctx, heartbeatTimeout)
+		started := time.Now()
+		_, err := a.currentSocket().Status(ctx)
+		cancel()
+		rtt := time.Since(started)
+		a.updateLink(func(q *linkQuality) {
+			if err != nil {
+				q.missed++
+				return
+			}
+			q.missed = 0
+			q.rtts = append(q.rtts, rtt)
+			if len(q.rtts) > rttWindow {
+				q.rtts = q.rtts[len(q.rtts)-rttWindow:]
+			}
+		})
+	}
+}
+
+// waitForLink holds deferred work while the link is poor. It reports
+// false when ctx ends first.
+func (a *app) waitForLink(ctx context.Context, what string) bool {
+	if a.linkLevel() != linkPoor {
+		return true
+	}
+	a.logf("%s deferred until the link improves", what)
+	ticker := time.NewTicker(linkWaitCheck)
+	defer ticker.Stop()
+	for a.linkLevel() == linkPoor {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	a.logf("%s resuming", what)
+	return true
+}
+
+func (a *app) buildLinkIndicator(box *gtk.Box) {
+	label, _ := gtk.LabelNew("")
+	addStyleClass(label, "link-quality")
+	box.PackStart(label, false, false, 0)
+	a.quality.indicator = label
+	a.refreshLinkIndicator()
+}
+
+// refreshLinkIndicator must run on the GTK main loop.
+func (a *app) refreshLinkIndicator() {
+	label := a.quality.indicator
+	if label == nil {
+		return
+	}
+	q := &a.quality
+	q.mu.Lock()
+	level, missed := q.level, q.missed
+	mean, jitter := q.stats()
+	reconnects := q.recentReconnects(time.Now())
+	measured := len(q.rtts) > 0
+	q.mu.Unlock()
+	if ctx, err := label.GetStyleContext(); err == nil {
+		for _, name := range linkLevelNames {
+			ctx.RemoveClass(name)
+		}
+		ctx.AddClass(level.String())
+	}
+	label.SetText(level.title())
+	var lines []string
+	if measured {
+		lines = append(lines, fmt.Sprintf(tr("Round trip: %s (jitter %s)"), mean.Round(time.Millisecond), jitter.Round(time.Millisecond)))
+	} else {
+		lines = append(lines, tr("Round trip: not measured yet"))
+	}
+	lines = append(lines,
+		fmt.Sprintf(tr("Missed heartbeats: %d"), missed),
+		fmt.Sprintf(tr("Reconnects in the last 10 minutes: %d"), reconnects))
+	if level == linkPoor {
+		lines = append(lines, tr("Timeouts are longer, status refresh is paused and uploads wait"))
+	}
+	label.SetTooltipText(strings.Join(lines, "\n"))
+}
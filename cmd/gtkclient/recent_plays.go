@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+)
+
+// recentPlaysLimit bounds the recently played list kept in the profile.
+const recentPlaysLimit = 50
+
+// recentPlay is one broadcast-play heard from the hub, by any peer.
+type recentPlay struct {
+	Filename string `json:"filename"`
+	From     string `json:"from,omitempty"`
+	Self     bool   `json:"self,omitempty"`
+	// Time is RFC 3339 in UTC.
+	Time string `json:"time"`
+}
+
+func (p recentPlay) when() string {
+	t, err := time.Parse(time.RFC3339, p.Time)
+	if err != nil {
+		return p.Time
+	}
+	t = t.Local()
+	if t.Format("2006-01-02") == time.Now().Format("2006-01-02") {
+		return t.Format("15:04:05")
+	}
+	return t.Format("Jan 2 15:04")
+}
+
+// recordRecentPlay adds a broadcast-play to the front of the list and
+// saves the profile.
+func (a *app) recordRecentPlay(filename, from, timestamp string, self bool) {
+	if filename == "" {
+		return
+	}
+	at, err := time.Parse(time.RFC3339, timestamp)
+	if err != nil {
+		at = time.Now()
+	}
+	play := recentPlay{Filename: filename, From: from, Self: self, Time: at.UTC().Format(time.RFC3339)}
+	glib.IdleAdd(func() bool {
+		plays := append([]recentPlay{play}, a.profile().RecentPlays...)
+		if len(plays) > recentPlaysLimit {
+			plays = plays[:recentPlaysLimit]
+		}
+		a.updateProfile(func(p *profileConfig) { p.RecentPlays = plays })
+		if err := a.config.save(); err != nil {
+			a.logf("config save error: %v", err)
+		}
+		if a.recentList != nil {
+			a.fillRecentPlays()
+		}
+		return false
+	})
+}
+
+// showRecentPlays lists the recently played files, newest first, each
+// with a button to broadcast-play it again.
+func (a *app) showRecentPlays() {
+	if a.recentList != nil {
+		if top, err := a.recentList.GetToplevel(); err == nil {
+			if w, ok := top.(*gtk.Window); ok {
+				w.Present()
+			}
+		}
+		return
+	}
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		a.logf("recently played dialog error: %v", err)
+		return
+	}
+	dialog.SetTitle(tr("Recently Played"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetDefaultSize(460, 360)
+	dialog.AddButton(tr("Clear"), gtk.RESPONSE_REJECT)
+	dialog.AddButton(tr("Close"), gtk.RESPONSE_CLOSE)
+	content, _ := dialog.GetContentArea()
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetVExpand(true)
+	content.PackStart(scroll, true, true, 0)
+	a.recentList, _ = gtk.ListBoxNew()
+	a.recentList.SetSelectionMode(gtk.SELECTION_NONE)
+	scroll.Add(a.recentList)
+	a.fillRecentPlays()
+	dialog.Connect("response", func(_ *gtk.Dialog, response gtk.ResponseType) {
+		if response == gtk.RESPONSE_REJECT {
+			a.updateProfile(func(p *profileConfig) { p.RecentPlays = nil })
+			if err := a.config.save(); err != nil {
+				a.logf("config save error: %v", err)
+			}
+			a.fillRecentPlays()
+			return
+		}
+		dialog.Destroy()
+	})
+	dialog.Connect("destroy", func() { a.recentList = nil })
+	dialog.ShowAll()
+}
+
+// fillRecentPlays rebuilds the open list. Must run on the GTK main loop.
+func (a *app) fillRecentPlays() {
+	if children := a.recentList.GetChildren(); children != nil {
+		children.Foreach(func(item interface{}) {
+			if w, ok := item.(*gtk.Widget); ok {
+				w.Destroy()
+			}
+		})
+	}
+	// rows are rebuilt on every play, so the role is checked here, not gated
+	role := a.currentSocket().Role()
+	if len(a.profile().RecentPlays) == 0 {
+		empty, _ := gtk.LabelNew(tr("Nothing played yet"))
+		a.recentList.Add(empty)
+	}
+	for _, p := range a.profile().RecentPlays {
+		filename := p.Filename
+		row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+		row.SetMarginStart(6)
+		row.SetMarginEnd(6)
+		who := tr("you")
+		if !p.Self {
+			who = a.auditActor(p.From)
+			if who == "" {
+				who = tr("unknown")
+			}
+		}
+		label, _ := gtk.LabelNew(fmt.Sprintf(tr("%s  %s, by %s"), p.when(), filename, who))
+		label.SetXAlign(0)
+		label.SetEllipsize(pango.ELLIPSIZE_END)
+		label.SetTooltipText(filename)
+		row.PackStart(label, true, true, 0)
+		replayBtn, _ := gtk.ButtonNewWithLabel(tr("Replay"))
+		replayBtn.SetTooltipText(tr("Broadcast-play it again"))
+		setAccessible(replayBtn, fmt.Sprintf(tr("Replay %s"), filename), "")
+		replayBtn.Connect("clicked", func() { go a.invokeBroadcastPlay(filename) })
+		if !role.Allows("broadcast-play") {
+			replayBtn.SetSensitive(false)
+			replayBtn.SetTooltipText(roleTooltip(role))
+		}
+		row.PackEnd(replayBtn, false, false, 0)
+		a.recentList.Add(row)
+	}
+	a.recentList.ShowAll()
+}
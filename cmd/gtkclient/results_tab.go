@@ -0,0 +1,506 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+)
+
+// resultTable is a command result laid out as rows of named cells.
+type resultTable struct {
+	columns []string
+	rows    [][]string
+	// numeric marks columns whose every cell is a number, so they sort
+	// by value
+	numeric []bool
+}
+
+// tableOf lays out result as a table when it is an array of objects, or
+// an object holding exactly one such array. Nested values become compact
+// JSON in their cell.
+func tableOf(result any) (*resultTable, bool) {
+	list, ok := result.([]any)
+	if !ok {
+		obj, isObj := result.(map[string]any)
+		if !isObj {
+			return nil, false
+		}
+		found := 0
+		for _, v := range obj {
+			if l, isList := v.([]any); isList && len(l) > 0 {
+				list = l
+				found++
+			}
+		}
+		if found != 1 {
+			return nil, false
+		}
+	}
+	if len(list) == 0 {
+		return nil, false
+	}
+	t := &resultTable{}
+	index := map[string]int{}
+	for _, item := range list {
+		obj, isObj := item.(map[string]any)
+		if !isObj {
+			return nil, false
+		}
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			if _, seen := index[k]; !seen {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			index[k] = len(t.columns)
+			t.columns = append(t.columns, k)
+			t.numeric = append(t.numeric, true)
+		}
+	}
+	for _, item := range list {
+		obj := item.(map[string]any)
+		row := make([]string, len(t.columns))
+		for i, k := range t.columns {
+			v, present := obj[k]
+			if !present {
+				continue
+			}
+			if _, isNum := v.(float64); !isNum {
+				t.numeric[i] = false
+			}
+			row[i] = cellText(v)
+		}
+		t.rows = append(t.rows, row)
+	}
+	return t, true
+}
+
+func cellText(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	enc, _ := json.Marshal(v)
+	return string(enc)
+}
+
+// writeCSV writes the table with a header row of column names.
+func (t *resultTable) writeCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(t.columns); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(t.rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// resultsView is the "Results" tab: the last command's result as a
+// sortable table when it is tabular, with the raw JSON a toggle away. A
+// streamed command's output shows as it arrives. All fields are owned by
+// the GTK main loop.
+type resultsView struct {
+	page    gtk.IWidget
+	stack   *gtk.Stack
+	scroll  *gtk.ScrolledWindow
+	raw     *gtk.TextBuffer
+	rawBtn  *gtk.ToggleButton
+	export  *gtk.Button
+	cancel  *gtk.Button
+	summary *gtk.Label
+	table   *resultTable
+	command string
+
+	// runKey is the idempotency key of the streamed command being
+	// shown, and runID its id once command-start answers; events that
+	// beat the answer wait in early.
+	runKey string
+	runID  string
+	early  []commandEvent
+	output strings.Builder
+}
+
+// commandEvent is a command-output or, with done set, a command-done
+// event.
+type commandEvent struct {
+	hubclient.CommandDone
+	Text string `json:"text"`
+	done bool
+}
+
+// resultsEarlyLimit bounds the events kept before command-start answers.
+const resultsEarlyLimit = 1000
+
+func (a *app) buildResultsTab() gtk.IWidget {
+	v := &resultsView{}
+	a.results = v
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+	v.page = box
+
+	bar, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	box.PackStart(bar, false, false, 0)
+	v.summary, _ = gtk.LabelNew(tr("Send a command to see its result here"))
+	v.summary.SetEllipsize(pango.ELLIPSIZE_END)
+	bar.PackStart(v.summary, false, false, 0)
+	v.export, _ = gtk.ButtonNewWithLabel(tr("Export CSV…"))
+	v.export.SetSensitive(false)
+	v.export.Connect("clicked", func() { a.exportResults() })
+	bar.PackEnd(v.export, false, false, 0)
+	v.cancel, _ = gtk.ButtonNewWithLabel(tr("Cancel"))
+	v.cancel.SetSensitive(false)
+	setAccessible(v.cancel, tr("Cancel the running command"), "")
+	v.cancel.Connect("clicked", func() {
+		if v.runID != "" {
+			go a.cancelCommand(v.runID)
+		}
+	})
+	bar.PackEnd(v.cancel, false, false, 0)
+	v.rawBtn, _ = gtk.ToggleButtonNewWithLabel(tr("Raw JSON"))
+	v.rawBtn.SetSensitive(false)
+	v.rawBtn.Connect("toggled", func() { a.showResultsPage() })
+	bar.PackEnd(v.rawBtn, false, false, 0)
+
+	v.stack, _ = gtk.StackNew()
+	v.stack.SetVExpand(true)
+	box.PackStart(v.stack, true, true, 0)
+	v.scroll, _ = gtk.ScrolledWindowNew(nil, nil)
+	v.scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	v.stack.AddNamed(v.scroll, "table")
+	rawScroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	rawScroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	rawView, _ := gtk.TextViewNew()
+	rawView.SetEditable(false)
+	rawView.SetMonospace(true)
+	setAccessible(rawView, tr("Raw command result"), "")
+	rawScroll.Add(rawView)
+	v.raw, _ = rawView.GetBuffer()
+	v.stack.AddNamed(rawScroll, "raw")
+	return box
+}
+
+// showResult puts a command's result in the Results tab after any output
+// it streamed, bringing the tab forward when the result is a table. Must
+// run on the GTK main loop.
+func (a *app) showResult(command, output string, result any) {
+	v := a.results
+	if v == nil {
+		return
+	}
+	v.command = command
+	pretty, _ := json.MarshalIndent(result, "", "  ")
+	v.raw.SetText(output + string(pretty))
+	v.table, _ = tableOf(result)
+	if old, err := v.scroll.GetChild(); err == nil && old != nil {
+		old.ToWidget().Destroy()
+	}
+	if v.table == nil {
+		v.summary.SetText(fmt.Sprintf(tr("%s: not a table"), command))
+		v.rawBtn.SetActive(true)
+		v.rawBtn.SetSensitive(false)
+		v.export.SetSensitive(false)
+		a.showResultsPage()
+		return
+	}
+	v.scroll.Add(v.table.treeView())
+	v.scroll.ShowAll()
+	v.summary.SetText(fmt.Sprintf(tr("%s: %d rows"), command, len(v.table.rows)))
+	v.rawBtn.SetSensitive(true)
+	v.rawBtn.SetActive(false)
+	v.export.SetSensitive(true)
+	a.showResultsPage()
+	if page := a.notebook.PageNum(v.page); page >= 0 {
+		a.notebook.SetCurrentPage(page)
+	}
+}
+
+// commandResult logs a command's result briefly and shows it in full in
+// the Results tab.
+func (a *app) commandResult(command, output string, result any) {
+	if t, ok := tableOf(result); ok {
+		a.logf("command result: %d rows, shown in Results", len(t.rows))
+	} else {
+		enc, _ := json.Marshal(result)
+		a.logf("command result: %s", enc)
+	}
+	glib.IdleAdd(func() bool {
+		a.showResult(command, output, result)
+		return false
+	})
+}
+
+// streamCommand runs command with command-start, showing its output in
+// the Results tab as it arrives and its result when it is done.
+func (a *app) streamCommand(hub *hubclient.Client, command string) {
+	key := hubclient.NewIdempotencyKey()
+	glib.IdleAdd(func() bool {
+		a.startStream(command, key)
+		return false
+	})
+	id, err := hub.CommandStart(hubclient.WithIdempotencyKey(a.ctx, key), command)
+	if err != nil {
+		glib.IdleAdd(func() bool {
+			a.endStream(key, fmt.Sprintf(tr("%s: failed"), command))
+			return false
+		})
+		a.reportError("command", err, func() { a.execCommand(command) })
+		return
+	}
+	glib.IdleAdd(func() bool {
+		v := a.results
+		if v == nil || v.runKey != key {
+			return false
+		}
+		v.runID = id
+		v.cancel.SetSensitive(true)
+		early := v.early
+		v.early = nil
+		for _, e := range early {
+			if e.ID == id {
+				a.streamEvent(e)
+			}
+		}
+		return false
+	})
+}
+
+// startStream clears the Results tab for a streamed command. Must run on
+// the GTK main loop.
+func (a *app) startStream(command, key string) {
+	v := a.results
+	if v == nil {
+		return
+	}
+	v.runKey, v.runID, v.early = key, "", nil
+	v.output.Reset()
+	v.command = command
+	v.table = nil
+	if old, err := v.scroll.GetChild(); err == nil && old != nil {
+		old.ToWidget().Destroy()
+	}
+	v.raw.SetText("")
+	v.summary.SetText(fmt.Sprintf(tr("%s: running…"), command))
+	v.rawBtn.SetActive(true)
+	v.rawBtn.SetSensitive(false)
+	v.export.SetSensitive(false)
+	a.showResultsPage()
+	if page := a.notebook.PageNum(v.page); page >= 0 {
+		a.notebook.SetCurrentPage(page)
+	}
+}
+
+// endStream stops showing the streamed command started with key, if it
+// is still the one shown. Must run on the GTK main loop.
+func (a *app) endStream(key, summary string) {
+	v := a.results
+	if v == nil || v.runKey != key {
+		return
+	}
+	v.runKey, v.runID, v.early = "", "", nil
+	v.cancel.SetSensitive(false)
+	if summary != "" {
+		v.summary.SetText(summary)
+	}
+}
+
+// handleCommandEvent passes a command-output or command-done event to the
+// Results tab.
+func (a *app) handleCommandEvent(msg hubclient.Message) {
+	var e commandEvent
+	if err := json.Unmarshal(msg.JSONPayload(), &e); err != nil {
+		a.logf("%s event parse error: %v", msg.Event, err)
+		return
+	}
+	e.done = msg.Event == protocol.EventCommandDone
+	glib.IdleAdd(func() bool {
+		v := a.results
+		switch {
+		case v == nil || v.runKey == "":
+		case v.runID == "":
+			if len(v.early) < resultsEarlyLimit {
+				v.early = append(v.early, e)
+			}
+		case e.ID == v.runID:
+			a.streamEvent(e)
+		}
+		return false
+	})
+}
+
+// streamEvent shows one event of the streamed command. Must run on the
+// GTK main loop.
+func (a *app) streamEvent(e commandEvent) {
+	v := a.results
+	if !e.done {
+		v.output.WriteString(e.Text)
+		v.raw.Insert(v.raw.GetEndIter(), e.Text)
+		return
+	}
+	command := v.command
+	switch {
+	case e.Cancelled:
+		a.endStream(v.runKey, fmt.Sprintf(tr("%s: cancelled"), command))
+		a.logf("command cancelled: %s", command)
+	case e.Error != "":
+		a.endStream(v.runKey, command+": "+e.Error)
+		a.logf("command failed: %s: %s", command, e.Error)
+	default:
+		a.endStream(v.runKey, "")
+		a.commandResult(command, v.output.String(), e.Result)
+	}
+}
+
+// streamLost ends a streamed command whose connection dropped.
+func (a *app) streamLost() {
+	glib.IdleAdd(func() bool {
+		if v := a.results; v != nil && v.runKey != "" {
+			a.endStream(v.runKey, fmt.Sprintf(tr("%s: connection lost"), v.command))
+		}
+		return false
+	})
+}
+
+func (a *app) cancelCommand(id string) {
+	if _, err := a.currentSocket().CommandCancel(a.ctx, id); err != nil {
+		a.reportError("cancel command", err, nil)
+	}
+}
+
+func (a *app) showResultsPage() {
+	if v := a.results; v.rawBtn.GetActive() || v.table == nil {
+		v.stack.SetVisibleChildName("raw")
+	} else {
+		v.stack.SetVisibleChildName("table")
+	}
+}
+
+// treeView shows the table with a string column per field and, for
+// numeric fields, a hidden column to sort by value.
+func (t *resultTable) treeView() *gtk.TreeView {
+	types := make([]glib.Type, 0, len(t.columns)*2)
+	for range t.columns {
+		types = append(types, glib.TYPE_STRING)
+	}
+	sortCol := make([]int, len(t.columns))
+	for i, numeric := range t.numeric {
+		sortCol[i] = i
+		if numeric {
+			sortCol[i] = len(types)
+			types = append(types, glib.TYPE_DOUBLE)
+		}
+	}
+	store, _ := gtk.ListStoreNew(types...)
+	cols := make([]int, len(types))
+	for i := range cols {
+		cols[i] = i
+	}
+	for _, row := range t.rows {
+		values := make([]interface{}, 0, len(types))
+		for _, cell := range row {
+			values = append(values, cell)
+		}
+		for i, numeric := range t.numeric {
+			if numeric {
+				n, _ := strconv.ParseFloat(row[i], 64)
+				values = append(values, n)
+			}
+		}
+		if err := store.Set(store.Append(), cols, values); err != nil {
+			break
+		}
+	}
+	view, _ := gtk.TreeViewNewWithModel(store)
+	view.SetSearchColumn(0)
+	setAccessible(view, tr("Command result"), "")
+	for i, title := range t.columns {
+		renderer, _ := gtk.CellRendererTextNew()
+		if t.numeric[i] {
+			renderer.SetProperty("xalign", float32(1))
+		}
+		column, err := gtk.TreeViewColumnNewWithAttribute(title, renderer, "text", i)
+		if err != nil {
+			continue
+		}
+		column.SetResizable(true)
+		column.SetSortColumnID(sortCol[i])
+		view.AppendColumn(column)
+	}
+	return view
+}
+
+// exportResults saves the table shown in the Results tab as CSV. Must run
+// on the GTK main loop.
+func (a *app) exportResults() {
+	v := a.results
+	if v == nil || v.table == nil {
+		return
+	}
+	dialog, err := gtk.FileChooserDialogNewWith2Buttons(tr("Export CSV"), a.win, gtk.FILE_CHOOSER_ACTION_SAVE,
+		tr("Cancel"), gtk.RESPONSE_CANCEL, tr("Save"), gtk.RESPONSE_ACCEPT)
+	if err != nil {
+		a.logf("export dialog error: %v", err)
+		return
+	}
+	defer dialog.Destroy()
+	dialog.SetDoOverwriteConfirmation(true)
+	dialog.SetCurrentName(csvName(v.command))
+	if dialog.Run() != gtk.RESPONSE_ACCEPT {
+		return
+	}
+	path := dialog.GetFilename()
+	f, err := os.Create(path)
+	if err == nil {
+		err = v.table.writeCSV(f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		a.reportError("export csv", err, nil)
+		return
+	}
+	a.logf("exported %d rows to %s", len(v.table.rows), path)
+}
+
+// csvName suggests a file name for a command's result.
+func csvName(command string) string {
+	name := []rune{}
+	for _, r := range command {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			name = append(name, r)
+		case len(name) > 0 && name[len(name)-1] != '-':
+			name = append(name, '-')
+		}
+		if len(name) >= 40 {
+			break
+		}
+	}
+	for len(name) > 0 && name[len(name)-1] == '-' {
+		name = name[:len(name)-1]
+	}
+	if len(name) == 0 {
+		return "result.csv"
+	}
+	return string(name) + ".csv"
+}
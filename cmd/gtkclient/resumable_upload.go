@@ -0,0 +1,327 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+)
+
+const (
+	// files at least this large go through upload-begin/chunk/commit so a
+	// dropped socket only costs the chunk in flight
+	chunkedUploadMinSize = 4 << 20
+	uploadChunkSize      = 1 << 20
+	pendingUploadsFile   = "uploads.json"
+)
+
+// pendingUpload is the on-disk record of a chunked upload that has not been
+// committed yet. Offset is the last byte count the hub acknowledged.
+type pendingUpload struct {
+	UploadID  string        `json:"uploadId"`
+	Path      string        `json:"path"`
+	Remote    string        `json:"remote"`
+	Size      int64         `json:"size"`
+	SHA256    string        `json:"sha256"`
+	Offset    int64         `json:"offset"`
+	Temporary bool          `json:"temporary,omitempty"`
+	TTL       time.Duration `json:"ttl,omitempty"`
+	Started   time.Time     `json:"started"`
+	// BroadcastPlay survives restarts so a resumed upload still plays.
+	BroadcastPlay bool `json:"broadcastPlay,omitempty"`
+	// BroadcastImage likewise still shows a resumed image.
+	BroadcastImage bool `json:"broadcastImage,omitempty"`
+}
+
+// uploadStore persists pending uploads next to the config file. Methods are
+// safe for concurrent use.
+type uploadStore struct {
+	mu      sync.Mutex
+	path    string
+	uploads map[string]*pendingUpload
+	running map[string]bool
+}
+
+func newUploadStore() *uploadStore {
+	s := &uploadStore{uploads: make(map[string]*pendingUpload), running: make(map[string]bool)}
+	cfgPath, err := configPath()
+	if err != nil {
+		return s
+	}
+	s.path = filepath.Join(filepath.Dir(cfgPath), pendingUploadsFile)
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return s
+	}
+	var list []*pendingUpload
+	if json.Unmarshal(data, &list) == nil {
+		for _, u := range list {
+			if u != nil && u.UploadID != "" {
+				s.uploads[u.UploadID] = u
+			}
+		}
+	}
+	return s
+}
+
+func (s *uploadStore) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+	list := make([]*pendingUpload, 0, len(s.uploads))
+	for _, u := range s.uploads {
+		list = append(list, u)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Started.Before(list[j].Started) })
+	if len(list) == 0 {
+		err := os.Remove(s.path)
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+func (s *uploadStore) put(u pendingUpload) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.uploads[u.UploadID] = &u
+	return s.saveLocked()
+}
+
+func (s *uploadStore) remove(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.uploads, id)
+	return s.saveLocked()
+}
+
+func (s *uploadStore) list() []pendingUpload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]pendingUpload, 0, len(s.uploads))
+	for _, u := range s.uploads {
+		out = append(out, *u)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Started.Before(out[j].Started) })
+	return out
+}
+
+// claim marks an upload as being driven by a goroutine so a reconnect does
+// not start a second copy of it.
+func (s *uploadStore) claim(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[id] {
+		return false
+	}
+	s.running[id] = true
+	return true
+}
+
+func (s *uploadStore) release(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, id)
+}
+
+// shouldChunkUpload also sends smaller files in chunks when a bandwidth
+// limit is set, so one upload line never holds the socket for long.
+func (a *app) shouldChunkUpload(size int64) bool {
+	if size >= chunkedUploadMinSize {
+		return true
+	}
+	limit := a.uploadLimit()
+	return limit > 0 && size > int64(chunkSizeFor(limit, a.currentSocket().BinaryFrames()))
+}
+
+// runChunkedUpload starts a resumable upload of a large file. retry starts
+// the whole upload over if the hub refuses to begin it.
+func (a *app) runChunkedUpload(ctx context.Context, path, remote string, size int64, opts uploadOptions, retry func()) {
+	digest, hashed, err := fileSHA256(path)
+	if err != nil {
+		a.reportError("upload", err, nil)
+		return
+	}
+	if hashed != size {
+		a.reportError("upload", fmt.Errorf("%s changed while reading", path), nil)
+		return
+	}
+	begin, err := a.currentSocket().UploadBegin(ctx, hubclient.UploadBeginRequest{
+		Filename:  remote,
+		Size:      size,
+		SHA256:    digest,
+		Temporary: opts.Temporary,
+		TTL:       opts.TTL,
+		Meta:      withTags(a.readAudioMeta(path), opts.Meta),
+	})
+	if err != nil {
+		a.reportError("upload", err, retry)
+		return
+	}
+	u := pendingUpload{
+		UploadID:  begin.UploadID,
+		Path:      path,
+		Remote:    remote,
+		Size:      size,
+		SHA256:    digest,
+		Offset:    begin.Offset,
+		Temporary: opts.Temporary,
+		TTL:       opts.TTL,
+		Started:   time.Now(),
+
+		BroadcastPlay:  opts.BroadcastPlay,
+		BroadcastImage: opts.BroadcastImage,
+	}
+	if err := a.uploads.put(u); err != nil {
+		a.logf("upload state save error: %v", err)
+	}
+	a.logf("upload started: %s (%s, id %s)", remote, formatBytes(size), u.UploadID)
+	a.driveUpload(u)
+}
+
+// resumePendingUploads picks up every persisted upload after (re)connecting.
+func (a *app) resumePendingUploads() {
+	if !a.currentSocket().Supports(protocol.CapChunkedUpload) {
+		if n := len(a.uploads.list()); n > 0 {
+			a.logf("hub does not support chunked upload; keeping %d pending upload(s)", n)
+		}
+		return
+	}
+	if len(a.uploads.list()) > 0 && !a.waitForLink(a.ctx, "resuming pending uploads") {
+		return
+	}
+	for _, u := range a.uploads.list() {
+		u := u
+		res, err := a.currentSocket().UploadResume(a.ctx, u.UploadID, u.SHA256)
+		if err != nil {
+			if hubclient.IsConnectionError(err) {
+				return
+			}
+			if errors.Is(err, protocol.ErrBusy) {
+				a.logf("upload-resume %s: hub busy, will retry on next connect", u.Remote)
+				continue
+			}
+			// the hub no longer knows the upload (expired or restarted);
+			// starting over is the only option
+			a.logf("upload-resume %s (%s) rejected: %v; dropping", u.Remote, u.UploadID, err)
+			_ = a.uploads.remove(u.UploadID)
+			continue
+		}
+		if info, err := os.Stat(u.Path); err != nil || info.Size() != u.Size {
+			a.logf("upload %s: local file changed or missing; dropping", u.Remote)
+			_ = a.currentSocket().UploadCancel(a.ctx, u.UploadID)
+			_ = a.uploads.remove(u.UploadID)
+			continue
+		}
+		u.Offset = res.Offset
+		a.logf("resuming upload %s at %s of %s", u.Remote, formatBytes(u.Offset), formatBytes(u.Size))
+		go a.driveUpload(u)
+	}
+}
+
+// driveUpload sends the remaining chunks from the last acknowledged offset
+// and commits. State is persisted after every acknowledged chunk.
+func (a *app) driveUpload(u pendingUpload) {
+	if !a.uploads.claim(u.UploadID) {
+		return
+	}
+	defer a.uploads.release(u.UploadID)
+	if dir, err := transcodeDir(); err == nil && filepath.Dir(u.Path) == dir {
+		defer a.releaseTranscoded(u.Path)
+	}
+	ctx, done := a.startOp("upload")
+	defer done()
+	ctx, span := a.telemetry.startSpan(ctx, "transfer.upload", map[string]any{
+		"brain.filename": u.Remote, "brain.bytes": u.Size, "brain.resume_offset": u.Offset,
+	})
+	res, sent, err := a.sendUploadChunks(ctx, &u)
+	span.end(err)
+	a.recordTransfer("upload", "chunked", sent)
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			if context.Cause(ctx) != errUploadCancelled {
+				// the window is closing; keep the state to resume next time
+				return
+			}
+			_ = a.currentSocket().UploadCancel(a.ctx, u.UploadID)
+			_ = a.uploads.remove(u.UploadID)
+			a.logf("upload cancelled: %s at %s of %s", u.Remote, formatBytes(u.Offset), formatBytes(u.Size))
+			return
+		}
+		if hubclient.IsConnectionError(err) {
+			a.reportError("upload", fmt.Errorf("%s paused at %s of %s: %w", u.Remote, formatBytes(u.Offset), formatBytes(u.Size), err), nil)
+			return
+		}
+		_ = a.uploads.remove(u.UploadID)
+		a.reportError("upload", err, nil)
+		return
+	}
+	if err := a.uploads.remove(u.UploadID); err != nil {
+		a.logf("upload state save error: %v", err)
+	}
+	a.logUploaded(res)
+	a.warnUnverified(res)
+	go a.fetchStatus()
+	go a.cacheWaveform(u.Path, res.Filename)
+	a.afterUpload(res.Filename, uploadOptions{BroadcastPlay: u.BroadcastPlay, BroadcastImage: u.BroadcastImage})
+}
+
+func (a *app) sendUploadChunks(ctx context.Context, u *pendingUpload) (*hubclient.UploadResult, int64, error) {
+	f, err := os.Open(u.Path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer f.Close()
+	hub := a.currentSocket()
+	var sent int64
+	buf := make([]byte, chunkSizeFor(a.uploadLimit(), hub.BinaryFrames()))
+	for u.Offset < u.Size {
+		n, err := f.ReadAt(buf, u.Offset)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, sent, err
+		}
+		if n == 0 {
+			return nil, sent, fmt.Errorf("%s shrank to %s", u.Path, formatBytes(u.Offset))
+		}
+		ack, err := hub.UploadChunk(ctx, u.UploadID, u.Offset, buf[:n])
+		if err != nil {
+			return nil, sent, err
+		}
+		if ack.Offset <= u.Offset || ack.Offset > u.Size {
+			return nil, sent, fmt.Errorf("hub acknowledged offset %d after sending %d", ack.Offset, u.Offset+int64(n))
+		}
+		sent += ack.Offset - u.Offset
+		u.Offset = ack.Offset
+		if err := a.uploads.put(*u); err != nil {
+			a.logf("upload state save error: %v", err)
+		}
+	}
+	res, err := hub.UploadCommit(ctx, u.UploadID, u.SHA256)
+	if err == nil && u.Temporary {
+		err = hubclient.CheckTemporary(res, u.TTL)
+	}
+	return res, sent, err
+}
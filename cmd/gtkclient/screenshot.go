@@ -0,0 +1,81 @@
+package main
+
+// #include <gio/gio.h>
+//
+// extern GDBusConnection *brain_dbus_app_connection(gpointer app);
+// extern void brain_screenshot(GDBusConnection *conn, int interactive);
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"time"
+	"unsafe"
+
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// screenshotFolder is where shared screenshots go on the hub.
+const screenshotFolder = "screenshots"
+
+var errNoSessionBus = errors.New("no session bus for the desktop portal")
+
+// screenshotApp receives the portal's answer from C, which cannot carry
+// Go pointers.
+var screenshotApp *app
+
+func (a *app) shareScreenshot()       { a.takeScreenshot(false) }
+func (a *app) shareScreenshotRegion() { a.takeScreenshot(true) }
+
+// takeScreenshot asks the desktop for a screenshot, of a region or window
+// the user picks when interactive, to upload and show to every peer. Must
+// run on the GTK main loop.
+func (a *app) takeScreenshot(interactive bool) {
+	if !a.currentSocket().Supports(protocol.CapBroadcastImage) {
+		a.showToastType(gtk.MESSAGE_WARNING, tr("This hub cannot broadcast images"), nil, false)
+		return
+	}
+	conn := C.brain_dbus_app_connection(C.gpointer(unsafe.Pointer(a.gtkApp.Native())))
+	if conn == nil {
+		a.reportError("screenshot", errNoSessionBus, nil)
+		return
+	}
+	screenshotApp = a
+	mode := C.int(0)
+	if interactive {
+		mode = 1
+	}
+	C.brain_screenshot(conn, mode)
+}
+
+//export brainScreenshotTaken
+func brainScreenshotTaken(uri, errText *C.char) {
+	a := screenshotApp
+	if a == nil {
+		return
+	}
+	if errText != nil {
+		if msg := C.GoString(errText); msg == "cancelled" {
+			a.logf("screenshot cancelled")
+		} else {
+			a.reportError("screenshot", errors.New(msg), nil)
+		}
+		return
+	}
+	u, err := url.Parse(C.GoString(uri))
+	if err != nil || u.Scheme != "file" {
+		a.reportError("screenshot", fmt.Errorf("the desktop saved it somewhere unreadable: %s", C.GoString(uri)), nil)
+		return
+	}
+	ext := path.Ext(u.Path)
+	if ext == "" {
+		ext = ".png"
+	}
+	remote := "screenshot-" + time.Now().Format("20060102-150405") + ext
+	a.logf("screenshot: sharing %s as %s", u.Path, remote)
+	go a.runUpload(u.Path, remote, uploadOptions{Folder: screenshotFolder, BroadcastImage: true})
+}
@@ -0,0 +1,81 @@
+package main
+
+// C side of screenshots, taken through the desktop's Screenshot portal so
+// they work on Wayland too. It lives apart from screenshot.go, which has
+// //export.
+
+// #cgo pkg-config: gio-2.0
+// #include <stdlib.h>
+// #include <gio/gio.h>
+//
+// extern void brainScreenshotTaken(char*, char*);
+//
+// #define BRAIN_SHOT_NAME "org.freedesktop.portal.Desktop"
+// #define BRAIN_SHOT_PATH "/org/freedesktop/portal/desktop"
+//
+// typedef struct {
+//   GDBusConnection *conn;
+//   guint sub;
+// } brain_shot_state;
+//
+// static void brain_shot_on_response(GDBusConnection *conn, const gchar *sender, const gchar *path,
+//     const gchar *iface, const gchar *signal, GVariant *params, gpointer data) {
+//   brain_shot_state *st = data;
+//   g_dbus_connection_signal_unsubscribe(conn, st->sub);
+//   g_free(st);
+//   guint32 response;
+//   GVariant *results;
+//   g_variant_get(params, "(u@a{sv})", &response, &results);
+//   const gchar *uri = NULL;
+//   if (response == 0) {
+//     g_variant_lookup(results, "uri", "&s", &uri);
+//   }
+//   if (uri != NULL) {
+//     brainScreenshotTaken((char *)uri, NULL);
+//   } else if (response == 1) {
+//     brainScreenshotTaken(NULL, "cancelled");
+//   } else {
+//     brainScreenshotTaken(NULL, "the desktop did not take a screenshot");
+//   }
+//   g_variant_unref(results);
+// }
+//
+// // brain_screenshot asks the portal for a screenshot; with interactive
+// // set the desktop lets the user pick a region or window first.
+// // brainScreenshotTaken gets the file's URI or an error.
+// void brain_screenshot(GDBusConnection *conn, int interactive) {
+//   static int serial = 0;
+//   char *token = g_strdup_printf("brain_shot_%d", ++serial);
+//   char *sender = g_strdup(g_dbus_connection_get_unique_name(conn) + 1);
+//   for (char *p = sender; *p; p++) {
+//     if (*p == '.') *p = '_';
+//   }
+//   char *request = g_strdup_printf(BRAIN_SHOT_PATH "/request/%s/%s", sender, token);
+//   brain_shot_state *st = g_new0(brain_shot_state, 1);
+//   st->conn = conn;
+//   st->sub = g_dbus_connection_signal_subscribe(conn, BRAIN_SHOT_NAME, "org.freedesktop.portal.Request",
+//       "Response", request, NULL, G_DBUS_SIGNAL_FLAGS_NO_MATCH_RULE, brain_shot_on_response, st, NULL);
+//   GVariantBuilder options;
+//   g_variant_builder_init(&options, G_VARIANT_TYPE_VARDICT);
+//   g_variant_builder_add(&options, "{sv}", "handle_token", g_variant_new_string(token));
+//   g_variant_builder_add(&options, "{sv}", "interactive", g_variant_new_boolean(interactive));
+//   g_variant_builder_add(&options, "{sv}", "modal", g_variant_new_boolean(TRUE));
+//   GError *err = NULL;
+//   GVariant *ret = g_dbus_connection_call_sync(conn, BRAIN_SHOT_NAME, BRAIN_SHOT_PATH,
+//       "org.freedesktop.portal.Screenshot", "Screenshot", g_variant_new("(sa{sv})", "", &options),
+//       NULL, G_DBUS_CALL_FLAGS_NONE, -1, NULL, &err);
+//   g_free(token);
+//   g_free(sender);
+//   g_free(request);
+//   if (ret == NULL) {
+//     g_dbus_connection_signal_unsubscribe(conn, st->sub);
+//     g_free(st);
+//     char *msg = g_strdup(err->message);
+//     g_error_free(err);
+//     brainScreenshotTaken(NULL, msg);
+//     g_free(msg);
+//     return;
+//   }
+//   g_variant_unref(ret);
+// }
+import "C"
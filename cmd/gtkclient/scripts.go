@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"brain/internal/automation"
+	"brain/internal/hubclient"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	// scriptTimeout bounds a script's top level or one handler run, sleeps
+	// included.
+	scriptTimeout = time.Minute
+	// scriptRunsPerMinute caps handler runs so a script that broadcasts on
+	// hub-message cannot feed itself forever.
+	scriptRunsPerMinute = 30
+	// scriptConnected is the event scripts get after every hello; its text
+	// is the profile name.
+	scriptConnected = "connected"
+)
+
+// scriptsDir holds the user's automation scripts.
+func scriptsDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configDirName, "scripts"), nil
+}
+
+// loadScripts runs every .star file in the scripts directory, skipping any
+// that fail, then swaps them in for the loaded ones. Top levels may talk to
+// the hub, so they run off the main loop.
+func (a *app) loadScripts() {
+	dir, err := scriptsDir()
+	if err != nil {
+		a.logf("scripts: %v", err)
+		return
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.star"))
+	sort.Strings(paths)
+	go func() {
+		var scripts []*automation.Script
+		handlers := 0
+		for _, path := range paths {
+			s, err := a.loadScript(path)
+			if err != nil {
+				a.logf("script %s: %v", filepath.Base(path), err)
+				continue
+			}
+			scripts = append(scripts, s)
+			handlers += len(s.Handlers)
+		}
+		glib.IdleAdd(func() bool {
+			a.scripts = scripts
+			if len(scripts) > 0 {
+				a.logf("loaded %d scripts with %d event handlers from %s", len(scripts), handlers, dir)
+			}
+			return false
+		})
+	}()
+}
+
+func (a *app) loadScript(path string) (*automation.Script, error) {
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(a.ctx, scriptTimeout)
+	defer cancel()
+	return automation.Load(ctx, filepath.Base(path), src, automation.Config{
+		Client:  a.currentSocket,
+		Actions: a.scriptActions(),
+		Print: func(name, msg string) {
+			a.logf("script %s: %s", name, msg)
+		},
+	})
+}
+
+// runScriptHandlers runs the handlers of an event from the socket, which
+// get its text, peer and payload fields.
+func (a *app) runScriptHandlers(msg hubclient.Message) {
+	if msg.Type != "event" {
+		return
+	}
+	data, names := webhookEventsFor(msg)
+	fields := map[string]any{}
+	if payload, ok := data.Payload.(map[string]any); ok {
+		for k, v := range payload {
+			fields[k] = v
+		}
+	}
+	fields["text"] = data.Text
+	fields["peer"] = data.Peer
+	glib.IdleAdd(func() bool {
+		for _, event := range names {
+			a.dispatchScriptEvent(event, data.Text, fields)
+		}
+		return false
+	})
+}
+
+// dispatchScriptEvent starts each handler of event whose match fits text.
+// Must run on the GTK main loop.
+func (a *app) dispatchScriptEvent(event, text string, fields map[string]any) {
+	for _, s := range a.scripts {
+		for _, h := range s.Handlers {
+			if !h.Handles(event, text) {
+				continue
+			}
+			if !a.allowScriptRun() {
+				a.logf("script %s: over %d runs a minute, skipping on %s", h, scriptRunsPerMinute, event)
+				continue
+			}
+			ev := make(map[string]any, len(fields)+2)
+			for k, v := range fields {
+				ev[k] = v
+			}
+			ev["event"] = event
+			ev["profile"] = a.profileName()
+			go a.runScriptHandler(s, h, ev)
+		}
+	}
+}
+
+func (a *app) runScriptHandler(s *automation.Script, h automation.Handler, event map[string]any) {
+	ctx, cancel := context.WithTimeout(a.ctx, scriptTimeout)
+	defer cancel()
+	if err := s.Run(ctx, h, event); err != nil {
+		a.reportError("script "+s.Name, err, nil)
+	}
+}
+
+// allowScriptRun counts a handler run against the per-minute cap. Must run
+// on the GTK main loop.
+func (a *app) allowScriptRun() bool {
+	cutoff := time.Now().Add(-time.Minute)
+	kept := a.scriptRuns[:0]
+	for _, t := range a.scriptRuns {
+		if t.After(cutoff) {
+			kept = append(kept, t)
+		}
+	}
+	a.scriptRuns = kept
+	if len(kept) >= scriptRunsPerMinute {
+		return false
+	}
+	a.scriptRuns = append(a.scriptRuns, time.Now())
+	return true
+}
+
+// scriptActions are the client's own actions a script can call beside the
+// hub's.
+func (a *app) scriptActions() map[string]func(context.Context, ...string) error {
+	return map[string]func(context.Context, ...string) error{
+		// upload(path, remote="")
+		"upload": func(_ context.Context, args ...string) error {
+			if len(args) == 0 || len(args) > 2 || args[0] == "" {
+				return errors.New("want upload(path, remote)")
+			}
+			remote := ""
+			if len(args) == 2 {
+				remote = args[1]
+			}
+			a.runUpload(expandHome(args[0]), remote, uploadOptions{})
+			return nil
+		},
+		// notify(text) shows a toast.
+		"notify": func(_ context.Context, args ...string) error {
+			text := strings.Join(args, " ")
+			glib.IdleAdd(func() bool {
+				a.showToastType(gtk.MESSAGE_INFO, text, nil, false)
+				return false
+			})
+			return nil
+		},
+	}
+}
+
+// expandHome turns a leading ~/ into the home directory.
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
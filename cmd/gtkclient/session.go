@@ -0,0 +1,342 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// replayMaxGap caps the pause between replayed events so long idle
+// stretches of a recording do not stall a demo.
+const replayMaxGap = 5 * time.Second
+
+// replaySkip are events a replay does not feed to the handlers because
+// they answer other peers through the hub.
+var replaySkip = map[string]bool{
+	"disconnect":          true,
+	"peer-files-request":  true,
+	"peer-upload-request": true,
+	"transfer-offer":      true,
+	"transfer-answer":     true,
+	"transfer-cancel":     true,
+}
+
+// sessionEntry is one line of a session recording: an event from the hub
+// ("in") or a request to it ("out").
+type sessionEntry struct {
+	Time    time.Time       `json:"time"`
+	Dir     string          `json:"dir"`
+	Event   string          `json:"event,omitempty"`
+	ID      string          `json:"id,omitempty"`
+	Action  string          `json:"action,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Error   *protocol.Error `json:"error,omitempty"`
+	// Binary is the size of binary frame data, which is not recorded.
+	Binary int `json:"binary,omitempty"`
+}
+
+// sessionRecorder appends entries to a JSONL file.
+type sessionRecorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	path  string
+	count int
+}
+
+func (r *sessionRecorder) write(e sessionEntry) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return
+	}
+	if _, err := r.file.Write(append(line, '\n')); err == nil {
+		r.count++
+	}
+}
+
+func (r *sessionRecorder) close() (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return r.count, nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return r.count, err
+}
+
+func sessionDir() (string, error) {
+	path, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(path), "sessions"), nil
+}
+
+func (a *app) startRecording() error {
+	dir, err := sessionDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, "session-"+time.Now().Format("20060102-150405")+".jsonl")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if old := a.recorder.Swap(&sessionRecorder{file: file, path: path}); old != nil {
+		old.close()
+	}
+	a.logf("session recording to %s", path)
+	return nil
+}
+
+func (a *app) stopRecording() {
+	r := a.recorder.Swap(nil)
+	if r == nil {
+		return
+	}
+	n, err := r.close()
+	if err != nil {
+		a.logf("session recording error: %v", err)
+	}
+	a.logf("session recording stopped: %d entries in %s", n, r.path)
+}
+
+// recordEvent is called with every event from the hub.
+func (a *app) recordEvent(msg hubclient.Message) {
+	r := a.recorder.Load()
+	if r == nil {
+		return
+	}
+	r.write(sessionEntry{
+		Time:    time.Now(),
+		Dir:     "in",
+		Event:   msg.Event,
+		Payload: msg.JSONPayload(),
+		Error:   msg.Error,
+		Binary:  len(msg.Binary),
+	})
+}
+
+// recordSent is the socket's Sent hook.
+func (a *app) recordSent(id, action string, payload map[string]any) {
+	r := a.recorder.Load()
+	if r == nil {
+		return
+	}
+	e := sessionEntry{Time: time.Now(), Dir: "out", ID: id, Action: action}
+	if len(payload) > 0 {
+		e.Payload, _ = json.Marshal(recordablePayload(payload))
+	}
+	r.write(e)
+}
+
+// recordablePayload replaces byte slices, such as upload chunks, with
+// their size.
+func recordablePayload(payload map[string]any) map[string]any {
+	out := make(map[string]any, len(payload))
+	for k, v := range payload {
+		if b, ok := v.([]byte); ok {
+			v = fmt.Sprintf("<%d bytes>", len(b))
+		}
+		out[k] = v
+	}
+	return out
+}
+
+func readSession(path string) ([]sessionEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []sessionEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64<<10), protocol.MaxFrameSize)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e sessionEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// replaySession feeds a recording's events to the event handlers with
+// their original spacing. Requests are only logged.
+func (a *app) replaySession(path string) {
+	entries, err := readSession(path)
+	if err != nil {
+		a.reportError("replay", err, nil)
+		return
+	}
+	if !a.replaying.CompareAndSwap(false, true) {
+		a.logf("replay: already replaying a session")
+		return
+	}
+	defer a.replaying.Store(false)
+	a.logf("replay: %d entries from %s", len(entries), path)
+	ctx, cancel := context.WithCancel(a.ctx)
+	a.replayMu.Lock()
+	a.replayCancel = cancel
+	a.replayMu.Unlock()
+	defer cancel()
+	events := 0
+	var last time.Time
+	for _, e := range entries {
+		if !last.IsZero() {
+			gap := min(max(e.Time.Sub(last), 0), replayMaxGap)
+			select {
+			case <-ctx.Done():
+				a.logf("replay stopped after %d events", events)
+				return
+			case <-time.After(gap):
+			}
+		}
+		last = e.Time
+		if e.Dir == "out" {
+			a.logf("replay: request %s %s", e.Action, e.Payload)
+			continue
+		}
+		if replaySkip[e.Event] {
+			continue
+		}
+		a.handleSocketEvent(hubclient.Message{Type: "event", Event: e.Event, Payload: e.Payload, Error: e.Error})
+		events++
+	}
+	a.logf("replay finished: %d events", events)
+}
+
+func (a *app) stopReplay() {
+	a.replayMu.Lock()
+	defer a.replayMu.Unlock()
+	if a.replayCancel != nil {
+		a.replayCancel()
+		a.replayCancel = nil
+	}
+}
+
+// installSessionActions adds app.record-session, a toggle, and
+// app.replay-session.
+func (a *app) installSessionActions() {
+	record := glib.SimpleActionNewStateful("record-session", nil, glib.VariantFromBoolean(false))
+	record.Connect("change-state", func(action *glib.SimpleAction, value *glib.Variant) {
+		on := value.GetBoolean()
+		if on {
+			if err := a.startRecording(); err != nil {
+				a.reportError("record", err, nil)
+				return
+			}
+		} else {
+			a.stopRecording()
+		}
+		action.SetState(value)
+		a.updateSubtitle()
+	})
+	a.gtkApp.AddAction(record)
+	a.recordAction = record
+
+	replay := glib.SimpleActionNew("replay-session", nil)
+	replay.Connect("activate", func() { a.chooseReplaySession() })
+	a.gtkApp.AddAction(replay)
+}
+
+// toggleRecording flips app.record-session, for the palette.
+func (a *app) toggleRecording() {
+	if a.recordAction != nil {
+		a.recordAction.ChangeState(glib.VariantFromBoolean(a.recorder.Load() == nil))
+	}
+}
+
+func (a *app) sessionShortcuts() []shortcut {
+	record := tr("Start recording the session")
+	if a.recorder.Load() != nil {
+		record = tr("Stop recording the session")
+	}
+	list := []shortcut{
+		{action: "record-session", title: record, group: tr("General"), run: (*app).toggleRecording},
+		{action: "replay-session", title: tr("Replay a recorded session"), group: tr("General"), run: (*app).chooseReplaySession},
+	}
+	mute := tr("Mute chimes")
+	if a.chimesMuted() {
+		mute = tr("Unmute chimes")
+	}
+	list = append(list, shortcut{action: "mute-chimes", title: mute, group: tr("General"), run: (*app).toggleChimes})
+	dnd := tr("Turn on do not disturb")
+	if a.profile().DoNotDisturb {
+		dnd = tr("Turn off do not disturb")
+	}
+	list = append(list, shortcut{action: "do-not-disturb", title: dnd, group: tr("General"), run: (*app).toggleDoNotDisturb})
+	sync := tr("Turn on clipboard sync")
+	if a.profile().ClipboardSync {
+		sync = tr("Turn off clipboard sync")
+	}
+	list = append(list, shortcut{action: "clipboard-sync", title: sync, group: tr("Sharing"), run: (*app).toggleClipboardSync})
+	if a.replaying.Load() {
+		list = append(list, shortcut{action: "stop-replay", title: tr("Stop the session replay"), group: tr("General"), run: (*app).stopReplay})
+	}
+	return append(list, a.panelShortcuts()...)
+}
+
+func (a *app) chooseReplaySession() {
+	dialog, err := gtk.FileChooserDialogNewWith2Buttons(
+		tr("Replay session"),
+		a.win,
+		gtk.FILE_CHOOSER_ACTION_OPEN,
+		tr("Cancel"), gtk.RESPONSE_CANCEL,
+		tr("Replay"), gtk.RESPONSE_ACCEPT,
+	)
+	if err != nil {
+		a.logf("replay dialog error: %v", err)
+		return
+	}
+	if dir, err := sessionDir(); err == nil {
+		dialog.SetCurrentFolder(dir)
+	}
+	filter, _ := gtk.FileFilterNew()
+	filter.SetName(tr("Session recordings"))
+	filter.AddPattern("*.jsonl")
+	dialog.AddFilter(filter)
+	response := dialog.Run()
+	path := dialog.GetFilename()
+	dialog.Destroy()
+	if response != gtk.RESPONSE_ACCEPT || path == "" {
+		return
+	}
+	go a.replaySession(path)
+}
+
+// updateSubtitle shows the profile in the header bar, and whether the
+// session is being recorded.
+func (a *app) updateSubtitle() {
+	if a.headerBar == nil {
+		return
+	}
+	if a.recorder.Load() != nil {
+		a.headerBar.SetSubtitle(fmt.Sprintf(tr("%s (recording)"), a.profileName()))
+		return
+	}
+	a.headerBar.SetSubtitle(a.profileName())
+}
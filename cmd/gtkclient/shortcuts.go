@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// shortcut is an application action with its accelerator, if any. The
+// same table registers the actions and fills the shortcuts window.
+type shortcut struct {
+	action string
+	accel  string
+	title  string
+	group  string
+	run    func(a *app)
+}
+
+func appShortcuts() []shortcut {
+	return []shortcut{
+		{"refresh", "<Control>r", tr("Refresh status"), tr("Hub"), func(a *app) { go a.fetchStatus() }},
+		{"focus-command", "<Control>l", tr("Focus command entry"), tr("Hub"), func(a *app) { a.commandEntry.GrabFocus() }},
+		{"upload", "<Control>u", tr("Upload the chosen file, or choose one"), tr("Sharing"), (*app).uploadShortcut},
+		{"add-from-url", "", tr("Upload audio from a URL"), tr("Sharing"), (*app).showAddFromURL},
+		{"broadcast", "<Control>b", tr("Broadcast the message entry"), tr("Sharing"), (*app).broadcastShortcut},
+		{"broadcast-clipboard", "<Control><Shift>v", tr("Broadcast clipboard text or upload clipboard file"), tr("Sharing"), (*app).broadcastClipboard},
+		{"broadcast-image", "<Control><Shift>i", tr("Send an image to every peer"), tr("Sharing"), (*app).chooseBroadcastImage},
+		{"share-screenshot", "<Control><Alt>s", tr("Share a screenshot with every peer"), tr("Sharing"), (*app).shareScreenshot},
+		{"share-screenshot-region", "<Control><Alt><Shift>s", tr("Share a screenshot of a region or window"), tr("Sharing"), (*app).shareScreenshotRegion},
+		{"recent-plays", "<Control>h", tr("Recently played"), tr("Sharing"), (*app).showRecentPlays},
+		{"stop-all", "<Control>period", tr("Stop playback on every peer"), tr("Sharing"), func(a *app) { go a.invokeStopAll() }},
+		{"share-clipboard", "<Control><Alt>c", tr("Share clipboard text to peers' clipboards"), tr("Sharing"), (*app).shareClipboard},
+		{"clear-log", "<Control>k", tr("Clear the log"), tr("General"), func(a *app) { a.textBuffer.SetText("") }},
+		{"palette", "<Control>p", tr("Command palette"), tr("General"), (*app).showPalette},
+		{"shortcuts", "<Control>question", tr("Keyboard shortcuts"), tr("General"), (*app).showShortcuts},
+		{"preferences", "<Control>comma", tr("Preferences"), tr("General"), (*app).showPreferences},
+		{"event-setups", "", tr("Event setups"), tr("General"), (*app).showEventSetups},
+		{"macros", "", tr("Command macros"), tr("Hub"), (*app).showMacros},
+		{"zones", "", tr("Edit zones"), tr("Hub"), (*app).showZones},
+		{"trash", "", tr("Restore or purge deleted files"), tr("Hub"), (*app).showTrash},
+		{"webhooks", "", tr("Webhooks"), tr("General"), (*app).showWebhooks},
+		{"reload-scripts", "", tr("Reload scripts"), tr("General"), (*app).loadScripts},
+		{"diagnostics", "", tr("Diagnostics"), tr("General"), (*app).showDiagnostics},
+		{"statistics", "", tr("Traffic statistics"), tr("General"), (*app).showStatistics},
+		{"menu", "F10", tr("Open the main menu"), tr("General"), func(a *app) {
+			if a.menuButton != nil {
+				a.menuButton.SetActive(!a.menuButton.GetActive())
+			}
+		}},
+		{"quit", "<Control>q", tr("Quit"), tr("General"), (*app).requestQuit},
+	}
+}
+
+// installActions registers every shortcut as an app.* action with its
+// accelerator.
+func (a *app) installActions() {
+	for _, s := range appShortcuts() {
+		s := s
+		action := glib.SimpleActionNew(s.action, nil)
+		action.Connect("activate", func() { s.run(a) })
+		a.gtkApp.AddAction(action)
+		if s.accel != "" {
+			a.gtkApp.SetAccelsForAction("app."+s.action, []string{s.accel})
+		}
+	}
+	a.installSoundboard()
+	a.installSessionActions()
+	a.installChimeActions()
+	a.installDNDActions()
+	a.installClipboardActions()
+	a.installPanelActions()
+}
+
+func (a *app) uploadShortcut() {
+	if a.uploadFilePath == "" {
+		a.chooseUploadFile()
+		return
+	}
+	remote, _ := a.uploadNameEntry.GetText()
+	opts := a.currentUploadOptions()
+	go a.runUpload(a.uploadFilePath, remote, opts)
+}
+
+func (a *app) broadcastShortcut() {
+	msg, _ := a.broadcastEntry.GetText()
+	msg = strings.TrimSpace(msg)
+	if msg == "" {
+		a.broadcastEntry.GrabFocus()
+		return
+	}
+	go a.invokeBroadcast(msg)
+}
+
+// shortcutsUI renders the table as GtkBuilder XML, the only way to build a
+// GtkShortcutsWindow.
+func shortcutsUI(list []shortcut) string {
+	var b strings.Builder
+	b.WriteString(`<interface><object class="GtkShortcutsWindow" id="shortcuts"><property name="modal">1</property>`)
+	b.WriteString(`<child><object class="GtkShortcutsSection"><property name="visible">1</property><property name="section-name">main</property>`)
+	var groups []string
+	byGroup := make(map[string][]shortcut)
+	for _, s := range list {
+		if _, ok := byGroup[s.group]; !ok {
+			groups = append(groups, s.group)
+		}
+		if s.accel != "" {
+			byGroup[s.group] = append(byGroup[s.group], s)
+		}
+	}
+	for _, g := range groups {
+		fmt.Fprintf(&b, `<child><object class="GtkShortcutsGroup"><property name="visible">1</property><property name="title">%s</property>`, html.EscapeString(g))
+		for _, s := range byGroup[g] {
+			fmt.Fprintf(&b, `<child><object class="GtkShortcutsShortcut"><property name="visible">1</property><property name="accelerator">%s</property><property name="title">%s</property></object></child>`,
+				html.EscapeString(s.accel), html.EscapeString(s.title))
+		}
+		b.WriteString(`</object></child>`)
+	}
+	b.WriteString(`</object></child></object></interface>`)
+	return b.String()
+}
+
+func (a *app) showShortcuts() {
+	builder, err := gtk.BuilderNewFromString(shortcutsUI(append(appShortcuts(), a.soundboardShortcuts()...)))
+	if err != nil {
+		a.logf("shortcuts window error: %v", err)
+		return
+	}
+	obj, err := builder.GetObject("shortcuts")
+	if err != nil {
+		a.logf("shortcuts window error: %v", err)
+		return
+	}
+	win, ok := obj.(*gtk.ShortcutsWindow)
+	if !ok {
+		a.logf("shortcuts window error: unexpected %T", obj)
+		return
+	}
+	win.SetTransientFor(a.win)
+	win.ShowAll()
+}
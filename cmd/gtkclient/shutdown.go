@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	// shutdownDrain bounds how long quitting waits for requests already on
+	// the wire to be answered.
+	shutdownDrain = 2 * time.Second
+	byeTimeout    = 500 * time.Millisecond
+
+	quitResponseWait = gtk.ResponseType(1)
+)
+
+// requestQuit is the way out for both closing the window and app.quit. A
+// running upload asks first. Must run on the GTK main loop.
+func (a *app) requestQuit() {
+	n := a.runningOps("upload")
+	if n == 0 {
+		a.gtkApp.Quit()
+		return
+	}
+	dialog := gtk.MessageDialogNew(a.win, gtk.DIALOG_MODAL, gtk.MESSAGE_QUESTION, gtk.BUTTONS_NONE,
+		fmt.Sprintf(tr("Still uploading %d file(s). Quit anyway?"), n))
+	dialog.FormatSecondaryText(tr("Chunked uploads resume from where they stopped the next time the client connects."))
+	dialog.AddButton(tr("Keep Running"), gtk.RESPONSE_CANCEL)
+	dialog.AddButton(tr("Quit When Done"), quitResponseWait)
+	dialog.AddButton(tr("Quit Anyway"), gtk.RESPONSE_ACCEPT)
+	dialog.SetDefaultResponse(gtk.RESPONSE_CANCEL)
+	response := dialog.Run()
+	dialog.Destroy()
+	switch response {
+	case gtk.RESPONSE_ACCEPT:
+		a.gtkApp.Quit()
+	case quitResponseWait:
+		a.logf("quitting once uploads finish")
+		glib.TimeoutAdd(500, func() bool {
+			if a.runningOps("upload") > 0 {
+				return true
+			}
+			a.gtkApp.Quit()
+			return false
+		})
+	}
+}
+
+// shutdown runs once when the application exits, however that happens. It
+// lets requests already sent finish, says bye and only then cancels the
+// rest.
+func (a *app) shutdown() {
+	if client := a.currentSocket(); client != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownDrain)
+		if n := client.Drain(ctx); n > 0 {
+			fmt.Fprintf(os.Stderr, "shutdown: abandoning %d pending request(s)\n", n)
+		}
+		cancel()
+		ctx, cancel = context.WithTimeout(context.Background(), byeTimeout)
+		_ = client.Bye(ctx, "quit")
+		cancel()
+	}
+	a.cancel()
+	a.foldTraffic()
+	a.saveLayout()
+	a.stopRecording()
+	a.closeIntercom()
+	a.closeSocket()
+	a.telemetry.shutdown()
+}
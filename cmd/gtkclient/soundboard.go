@@ -0,0 +1,197 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// soundboardAction broadcast-plays the file named by its string parameter.
+// Each binding is an accelerator for the action with that file as target.
+const soundboardAction = "soundboard-play"
+
+// soundboardTarget is the detailed action name for filename, quoted as a
+// GVariant string.
+func soundboardTarget(filename string) string {
+	quoted := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(filename)
+	return fmt.Sprintf("app.%s('%s')", soundboardAction, quoted)
+}
+
+func (a *app) installSoundboard() {
+	action := glib.SimpleActionNew(soundboardAction, glib.VARIANT_TYPE_STRING)
+	action.Connect("activate", func(_ *glib.SimpleAction, param *glib.Variant) {
+		if param == nil {
+			return
+		}
+		filename := param.GetString()
+		a.logf("soundboard: broadcast play %s", filename)
+		go a.invokeBroadcastPlay(filename)
+	})
+	a.gtkApp.AddAction(action)
+	a.applySoundboard()
+}
+
+// applySoundboard replaces the registered accelerators with the profile's
+// bindings. Must run on the GTK main loop.
+func (a *app) applySoundboard() {
+	for _, target := range a.soundboardTargets {
+		a.gtkApp.SetAccelsForAction(target, nil)
+	}
+	a.soundboardTargets = nil
+	byFile := make(map[string][]string)
+	for accel, filename := range a.profile().Soundboard {
+		byFile[filename] = append(byFile[filename], accel)
+	}
+	for filename, accels := range byFile {
+		target := soundboardTarget(filename)
+		sort.Strings(accels)
+		a.gtkApp.SetAccelsForAction(target, accels)
+		a.soundboardTargets = append(a.soundboardTargets, target)
+	}
+}
+
+// soundboardKeys lists the accelerators bound to filename, sorted.
+func (a *app) soundboardKeys(filename string) []string {
+	var accels []string
+	for accel, f := range a.profile().Soundboard {
+		if f == filename {
+			accels = append(accels, accel)
+		}
+	}
+	sort.Strings(accels)
+	return accels
+}
+
+func accelLabel(accel string) string {
+	key, mods := gtk.AcceleratorParse(accel)
+	return gtk.AcceleratorGetLabel(key, mods)
+}
+
+// soundboardLabel is the button badge for filename's hotkeys, or "".
+func (a *app) soundboardLabel(filename string) string {
+	accels := a.soundboardKeys(filename)
+	for i, accel := range accels {
+		accels[i] = accelLabel(accel)
+	}
+	return strings.Join(accels, ", ")
+}
+
+func (a *app) soundboardShortcuts() []shortcut {
+	var list []shortcut
+	for accel, filename := range a.profile().Soundboard {
+		list = append(list, shortcut{accel: accel, title: filename, group: tr("Soundboard")})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].title < list[j].title })
+	return list
+}
+
+// soundboardUsable rejects keys that would stop the window taking text:
+// application accelerators win over the focused entry, so plain letters
+// need a modifier. Function keys work alone.
+func soundboardUsable(key uint, mods gdk.ModifierType) bool {
+	if !gtk.AcceleratorValid(key, mods) {
+		return false
+	}
+	if key >= gdk.KEY_F1 && key <= gdk.KEY_F35 {
+		return true
+	}
+	return mods&(gdk.CONTROL_MASK|gdk.MOD1_MASK|gdk.SUPER_MASK) != 0
+}
+
+// appShortcutFor names the built-in shortcut already using accel, if any.
+func appShortcutFor(accel string) string {
+	key, mods := gtk.AcceleratorParse(accel)
+	for _, s := range appShortcuts() {
+		if s.accel == "" {
+			continue
+		}
+		if k, m := gtk.AcceleratorParse(s.accel); k == key && m == mods {
+			return s.title
+		}
+	}
+	return ""
+}
+
+func (a *app) setSoundboardKey(accel, filename string) {
+	if previous, ok := a.profile().Soundboard[accel]; ok && previous != filename {
+		a.logf("soundboard: %s moved from %s to %s", accelLabel(accel), previous, filename)
+	}
+	a.updateProfile(func(p *profileConfig) {
+		if p.Soundboard == nil {
+			p.Soundboard = make(map[string]string)
+		}
+		p.Soundboard[accel] = filename
+	})
+	a.saveSoundboard()
+}
+
+func (a *app) clearSoundboardKeys(filename string) {
+	a.updateProfile(func(p *profileConfig) {
+		for accel, f := range p.Soundboard {
+			if f == filename {
+				delete(p.Soundboard, accel)
+			}
+		}
+	})
+	a.saveSoundboard()
+}
+
+func (a *app) saveSoundboard() {
+	a.applySoundboard()
+	if err := a.config.save(); err != nil {
+		a.logf("config save error: %v", err)
+	}
+	if a.audioFiles != nil {
+		a.refreshAudioButtons(a.audioFiles, "")
+	}
+}
+
+// assignSoundboardKey asks for a key combination to broadcast-play
+// filename with.
+func (a *app) assignSoundboardKey(filename string) {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		a.logf("soundboard dialog error: %v", err)
+		return
+	}
+	dialog.SetTitle(tr("Assign Hotkey"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetModal(true)
+	dialog.AddButton(tr("Cancel"), gtk.RESPONSE_CANCEL)
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.SetBorderWidth(12)
+	prompt, _ := gtk.LabelNew(fmt.Sprintf(tr("Press a key combination to broadcast-play %s.\nFunction keys work alone; other keys need Ctrl, Alt or Super."), filename))
+	prompt.SetLineWrap(true)
+	content.PackStart(prompt, false, false, 0)
+	status, _ := gtk.LabelNew("")
+	content.PackStart(status, false, false, 0)
+	dialog.Connect("key-press-event", func(_ *gtk.Dialog, ev *gdk.Event) bool {
+		keyEv := gdk.EventKeyNewFromEvent(ev)
+		key := keyEv.KeyVal()
+		mods := gdk.ModifierType(keyEv.State()) & gtk.AcceleratorGetDefaultModMask()
+		if key == gdk.KEY_Escape && mods == 0 {
+			return false
+		}
+		if !soundboardUsable(key, mods) {
+			// modifiers on their own arrive first; wait for the real key
+			return true
+		}
+		accel := gtk.AcceleratorName(key, mods)
+		if title := appShortcutFor(accel); title != "" {
+			status.SetText(fmt.Sprintf(tr("%s is already used for %s"), accelLabel(accel), title))
+			return true
+		}
+		a.setSoundboardKey(accel, filename)
+		a.logf("soundboard: %s plays %s", accelLabel(accel), filename)
+		dialog.Response(gtk.RESPONSE_OK)
+		return true
+	})
+	dialog.ShowAll()
+	dialog.Run()
+	dialog.Destroy()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+)
+
+// statusPollCheck is how often the poller looks at the age of the last
+// status. Status that arrives by itself, pushed or fetched, pushes the
+// next poll back, so hubs that push often are never polled.
+const statusPollCheck = time.Second
+
+// setStatusPoll sets how old status may get before it is fetched again;
+// zero turns polling off.
+func (a *app) setStatusPoll(seconds int) {
+	a.statusPoll.Store(int64(time.Duration(seconds) * time.Second))
+}
+
+func (a *app) runStatusPoll() {
+	ticker := time.NewTicker(statusPollCheck)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-a.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		interval := time.Duration(a.statusPoll.Load())
+		if interval <= 0 || time.Since(time.Unix(0, a.lastStatus.Load())) < interval {
+			continue
+		}
+		if state, _ := a.connState(); state != stateConnected && state != stateDegraded {
+			continue
+		}
+		if a.linkLevel() == linkPoor {
+			continue
+		}
+		a.pollStatus()
+	}
+}
+
+// pollStatus is fetchStatus without the log lines and toasts, which would
+// repeat every interval.
+func (a *app) pollStatus() {
+	res, err := a.currentSocket().Status(a.ctx)
+	if err != nil {
+		// the next status that arrives resets the clock; until then wait a
+		// full interval rather than retrying every check
+		a.lastStatus.Store(time.Now().UnixNano())
+		a.logf("status poll error: %v", err)
+		return
+	}
+	a.applyStatus(res)
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// buildStopControls adds the Loop toggle for Play and Broadcast Play, and
+// the Stop All button that ends them.
+func (a *app) buildStopControls(box *gtk.Box) {
+	a.stopAllBtn, _ = gtk.ButtonNewWithMnemonic(tr("Stop _All"))
+	addStyleClass(a.stopAllBtn, "destructive-action")
+	a.stopAllBtn.Connect("clicked", func() { go a.invokeStopAll() })
+	box.PackEnd(a.stopAllBtn, false, false, 0)
+	a.loopCheck, _ = gtk.CheckButtonNewWithLabel(tr("Loop"))
+	a.loopCheck.Connect("toggled", func() { a.loopPlay.Store(a.loopCheck.GetActive()) })
+	box.PackEnd(a.loopCheck, false, false, 0)
+	a.setStopAvailable(false, protocol.RoleAdmin)
+}
+
+// setStopAvailable offers Loop and Stop All only to hubs that can stop
+// every peer and roles that may. Must run on the GTK main loop.
+func (a *app) setStopAvailable(ok bool, role protocol.Role) {
+	if a.stopAllBtn == nil {
+		return
+	}
+	allowed := ok && role.Allows("broadcast-stop")
+	a.stopAllBtn.SetSensitive(allowed)
+	a.loopCheck.SetSensitive(allowed)
+	switch {
+	case allowed:
+		a.stopAllBtn.SetTooltipText(tr("Stop playback on every peer, ending any loop"))
+		a.loopCheck.SetTooltipText(tr("Repeat Play and Broadcast Play until Stop All"))
+	case !ok:
+		a.loopCheck.SetActive(false)
+		a.stopAllBtn.SetTooltipText(tr("This hub cannot stop every peer"))
+		a.loopCheck.SetTooltipText(tr("This hub cannot stop every peer"))
+	default:
+		a.loopCheck.SetActive(false)
+		a.stopAllBtn.SetTooltipText(roleTooltip(role))
+		a.loopCheck.SetTooltipText(roleTooltip(role))
+	}
+}
+
+func (a *app) invokeStopAll() {
+	n, err := a.currentSocket().BroadcastStop(a.ctx)
+	if err != nil {
+		a.reportError("stop all", err, a.invokeStopAll)
+		return
+	}
+	a.logf("stop all sent to %d peers", n)
+}
+
+// handleBroadcastStopEvent says who stopped playback, when it was not this
+// client.
+func (a *app) handleBroadcastStopEvent(payload json.RawMessage) {
+	var ev struct {
+		From string `json:"from"`
+		Self bool   `json:"self"`
+	}
+	if err := json.Unmarshal(payload, &ev); err != nil {
+		a.logf("broadcast-stop event parse error: %v", err)
+		return
+	}
+	if ev.Self {
+		return
+	}
+	a.logf("playback stopped by %s", ev.From)
+	glib.IdleAdd(func() bool {
+		a.showToastType(gtk.MESSAGE_INFO, fmt.Sprintf(tr("Playback stopped by %s"), a.auditActor(ev.From)), nil, false)
+		return false
+	})
+}
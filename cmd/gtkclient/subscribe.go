@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+)
+
+// applySubscription narrows the events the hub pushes to the profile's
+// subscription, if one is configured. Relay requests from other peers are
+// always kept so shared folders and direct transfers keep working.
+func (a *app) applySubscription() {
+	cfg := a.profile().Subscribe
+	if cfg == nil || (len(cfg.Events) == 0 && cfg.StatusIntervalSeconds <= 0) {
+		return
+	}
+	if !a.currentSocket().Supports(protocol.CapSubscribe) {
+		// older hubs do not know subscribe and keep sending everything
+		a.logf("subscribe: this hub does not offer it; every event still arrives")
+		return
+	}
+	sub := hubclient.Subscription{
+		StatusInterval: time.Duration(cfg.StatusIntervalSeconds * float64(time.Second)),
+	}
+	if len(cfg.Events) > 0 {
+		seen := make(map[string]bool)
+		for _, name := range append(append([]string{}, cfg.Events...), protocol.RelayEvents...) {
+			if !seen[name] {
+				seen[name] = true
+				sub.Events = append(sub.Events, name)
+			}
+		}
+	}
+	res, err := a.currentSocket().Subscribe(a.ctx, sub)
+	if err != nil {
+		var hubErr *hubclient.HubError
+		if errors.As(err, &hubErr) {
+			a.logf("subscribe refused by hub: %v", err)
+			return
+		}
+		a.reportError("subscribe", err, a.applySubscription)
+		return
+	}
+	events := "all events"
+	if len(res.Events) > 0 {
+		events = strings.Join(res.Events, ", ")
+	}
+	if res.StatusIntervalSeconds > 0 {
+		a.logf("subscribed to %s (status every %gs)", events, res.StatusIntervalSeconds)
+	} else {
+		a.logf("subscribed to %s", events)
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+	"brain/internal/syncdir"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	syncColFile = iota
+	syncColState
+	syncColRemote
+	syncColDetail
+	syncColTime
+)
+
+// syncView is the Sync tab. All fields are owned by the GTK main loop.
+type syncView struct {
+	chooser *gtk.FileChooserButton
+	folder  *gtk.Entry
+	mirror  *gtk.CheckButton
+	pause   *gtk.ToggleButton
+	now     *gtk.Button
+	summary *gtk.Label
+	store   *gtk.ListStore
+	// loading is set while the tab is filled from the profile, so the
+	// widgets' signals do not restart the syncer
+	loading bool
+}
+
+func (a *app) buildSyncTab() gtk.IWidget {
+	v := &syncView{loading: true}
+	a.syncView = v
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 4)
+
+	bar, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	box.PackStart(bar, false, false, 0)
+	dirLabel, _ := gtk.LabelNewWithMnemonic(tr("_Folder:"))
+	bar.PackStart(dirLabel, false, false, 0)
+	v.chooser, _ = gtk.FileChooserButtonNew(tr("Folder to sync"), gtk.FILE_CHOOSER_ACTION_SELECT_FOLDER)
+	v.chooser.SetTooltipText(tr("Audio files added or changed here are uploaded to the hub"))
+	dirLabel.SetMnemonicWidget(v.chooser)
+	v.chooser.Connect("file-set", a.applySyncSettings)
+	bar.PackStart(v.chooser, false, false, 0)
+	folderLabel, _ := gtk.LabelNewWithMnemonic(tr("_Hub folder:"))
+	bar.PackStart(folderLabel, false, false, 0)
+	v.folder, _ = gtk.EntryNew()
+	v.folder.SetPlaceholderText(tr("top level"))
+	v.folder.SetTooltipText(tr("Press Enter to apply"))
+	folderLabel.SetMnemonicWidget(v.folder)
+	v.folder.Connect("activate", a.applySyncSettings)
+	bar.PackStart(v.folder, false, false, 0)
+	v.mirror, _ = gtk.CheckButtonNewWithLabel(tr("Mirror deletions"))
+	v.mirror.SetTooltipText(tr("Delete a file's hub copy when it is deleted from the folder, unless the hub copy changed since"))
+	v.mirror.Connect("toggled", a.applySyncSettings)
+	bar.PackStart(v.mirror, false, false, 0)
+	v.summary, _ = gtk.LabelNew("")
+	bar.PackEnd(v.summary, false, false, 0)
+	v.now, _ = gtk.ButtonNewWithLabel(tr("Sync Now"))
+	setAccessible(v.now, tr("Look over the whole folder again"), "")
+	v.now.Connect("clicked", func() {
+		if a.syncer != nil {
+			a.syncer.SyncNow()
+		}
+	})
+	bar.PackEnd(v.now, false, false, 0)
+	v.pause, _ = gtk.ToggleButtonNewWithLabel(tr("Pause"))
+	v.pause.SetTooltipText(tr("Stop watching the folder until resumed"))
+	v.pause.Connect("toggled", a.applySyncSettings)
+	bar.PackEnd(v.pause, false, false, 0)
+
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_AUTOMATIC, gtk.POLICY_AUTOMATIC)
+	scroll.SetVExpand(true)
+	box.PackStart(scroll, true, true, 0)
+	v.store, _ = gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
+	view, _ := gtk.TreeViewNewWithModel(v.store)
+	view.SetSearchColumn(syncColFile)
+	setAccessible(view, tr("Synced files"), "")
+	for _, col := range []struct {
+		title  string
+		id     int
+		expand bool
+	}{
+		{tr("File"), syncColFile, true},
+		{tr("State"), syncColState, false},
+		{tr("Hub file"), syncColRemote, true},
+		{tr("Details"), syncColDetail, true},
+		{tr("Time"), syncColTime, false},
+	} {
+		renderer, _ := gtk.CellRendererTextNew()
+		column, err := gtk.TreeViewColumnNewWithAttribute(col.title, renderer, "text", col.id)
+		if err != nil {
+			continue
+		}
+		column.SetResizable(true)
+		column.SetExpand(col.expand)
+		column.SetSortColumnID(col.id)
+		view.AppendColumn(column)
+	}
+	scroll.Add(view)
+
+	if cfg := a.profile().SyncFolder; cfg != nil {
+		if cfg.Dir != "" {
+			v.chooser.SetFilename(cfg.Dir)
+		}
+		v.folder.SetText(cfg.HubFolder)
+		v.mirror.SetActive(cfg.MirrorDeletes)
+		v.pause.SetActive(cfg.Paused)
+	}
+	v.loading = false
+	return box
+}
+
+// applySyncSettings saves the Sync tab's settings and restarts the syncer
+// with them.
+func (a *app) applySyncSettings() {
+	v := a.syncView
+	if v == nil || v.loading {
+		return
+	}
+	folder, _ := v.folder.GetText()
+	cfg := &syncFolderConfig{
+		Dir:           v.chooser.GetFilename(),
+		HubFolder:     strings.Trim(strings.TrimSpace(folder), "/"),
+		MirrorDeletes: v.mirror.GetActive(),
+		Paused:        v.pause.GetActive(),
+	}
+	if *cfg == (syncFolderConfig{}) {
+		cfg = nil
+	}
+	a.updateProfile(func(p *profileConfig) { p.SyncFolder = cfg })
+	if err := a.config.save(); err != nil {
+		a.logf("config save error: %v", err)
+	}
+	a.startSyncFolder()
+}
+
+// startSyncFolder (re)starts syncing the profile's folder, unless none is
+// set or it is paused. Must run on the GTK main loop.
+func (a *app) startSyncFolder() {
+	if a.syncStop != nil {
+		a.syncStop()
+		a.syncStop = nil
+	}
+	a.syncer = nil
+	cfg := a.profile().SyncFolder
+	if cfg == nil || cfg.Dir == "" || cfg.Paused {
+		a.refreshSyncTab()
+		return
+	}
+	state := ""
+	if cfgPath, err := configPath(); err == nil {
+		// the record of what was synced only holds for this folder going to
+		// this hub folder; another pairing must not inherit its deletions
+		sum := sha256.Sum256([]byte(a.profileName() + "\x00" + cfg.Dir + "\x00" + cfg.HubFolder))
+		state = filepath.Join(filepath.Dir(cfgPath), "sync-"+hex.EncodeToString(sum[:6])+".json")
+	}
+	syncer := syncdir.New(syncdir.Config{
+		Dir:           cfg.Dir,
+		Folder:        cfg.HubFolder,
+		MirrorDeletes: cfg.MirrorDeletes,
+		StateFile:     state,
+		Client:        a.currentSocket,
+		Upload:        a.syncUpload,
+		OnChange:      a.syncChanged,
+		Logf:          a.logf,
+	})
+	ctx, stop := context.WithCancel(a.ctx)
+	a.syncer, a.syncStop = syncer, stop
+	go func() {
+		if err := syncer.Run(ctx); err != nil {
+			a.reportError("sync folder", err, nil)
+		}
+	}()
+	a.refreshSyncTab()
+}
+
+// syncChanged shows an entry's change; conflicts also get a toast.
+func (a *app) syncChanged(e syncdir.Entry) {
+	glib.IdleAdd(func() bool {
+		a.refreshSyncTab()
+		if e.Status == syncdir.Conflict {
+			a.showToastType(gtk.MESSAGE_WARNING, fmt.Sprintf(tr("%s changed on the hub too; this copy was uploaded as %s"), e.Path, e.Remote), nil, false)
+		}
+		return false
+	})
+}
+
+// syncUpload sends one synced file, in chunks when it is large. Failures
+// go back to the syncer, which shows and retries them.
+func (a *app) syncUpload(ctx context.Context, local, remote string) error {
+	client := a.currentSocket()
+	info, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	if !a.shouldChunkUpload(info.Size()) || !client.Supports(protocol.CapChunkedUpload) {
+		data, err := os.ReadFile(local)
+		if err != nil {
+			return err
+		}
+		res, err := client.Upload(ctx, hubclient.UploadRequest{Filename: remote, Data: data, Meta: a.readAudioMeta(local)})
+		if err != nil {
+			return err
+		}
+		a.recordTransfer("upload", "relay", int64(len(data)))
+		if !res.Verified {
+			a.logf("sync: %s is unverified: the hub returned no checksum", res.Filename)
+		}
+		go a.cacheWaveform(local, res.Filename)
+		go a.fetchStatus()
+		return nil
+	}
+	digest, size, err := fileSHA256(local)
+	if err != nil {
+		return err
+	}
+	begin, err := client.UploadBegin(ctx, hubclient.UploadBeginRequest{Filename: remote, Size: size, SHA256: digest, Meta: a.readAudioMeta(local)})
+	if err != nil {
+		return err
+	}
+	// the syncer starts over rather than resuming, so the upload is
+	// forgotten however it ends
+	u := pendingUpload{UploadID: begin.UploadID, Path: local, Remote: remote, Size: size, SHA256: digest, Offset: begin.Offset, Started: time.Now()}
+	res, sent, err := a.sendUploadChunks(ctx, &u)
+	a.recordTransfer("upload", "chunked", sent)
+	_ = a.uploads.remove(u.UploadID)
+	if err != nil {
+		_ = client.UploadCancel(a.ctx, u.UploadID)
+		return err
+	}
+	if !res.Verified {
+		a.logf("sync: %s is unverified: the hub returned no checksum", res.Filename)
+	}
+	go a.cacheWaveform(local, res.Filename)
+	go a.fetchStatus()
+	return nil
+}
+
+// refreshSyncTab shows the syncer's files. Must run on the GTK main loop.
+func (a *app) refreshSyncTab() {
+	v := a.syncView
+	if v == nil {
+		return
+	}
+	v.store.Clear()
+	v.now.SetSensitive(a.syncer != nil)
+	switch cfg := a.profile().SyncFolder; {
+	case cfg == nil || cfg.Dir == "":
+		v.summary.SetText(tr("Choose a folder to sync"))
+		return
+	case a.syncer == nil:
+		v.summary.SetText(tr("Paused"))
+		return
+	}
+	counts := make(map[syncdir.Status]int)
+	for _, e := range a.syncer.Entries() {
+		counts[e.Status]++
+		at := ""
+		if !e.Time.IsZero() {
+			at = e.Time.Local().Format("Jan 2 15:04:05")
+		}
+		v.store.Set(v.store.Append(),
+			[]int{syncColFile, syncColState, syncColRemote, syncColDetail, syncColTime},
+			[]interface{}{e.Path, syncStatusText(e.Status), e.Remote, e.Detail, at})
+	}
+	text := fmt.Sprintf(tr("%d synced"), counts[syncdir.Synced])
+	if n := counts[syncdir.Uploading]; n > 0 {
+		text += ", " + fmt.Sprintf(tr("%d uploading"), n)
+	}
+	if n := counts[syncdir.Conflict]; n > 0 {
+		text += ", " + fmt.Sprintf(tr("%d in conflict"), n)
+	}
+	if n := counts[syncdir.Failed]; n > 0 {
+		text += ", " + fmt.Sprintf(tr("%d failed"), n)
+	}
+	v.summary.SetText(text)
+}
+
+func syncStatusText(s syncdir.Status) string {
+	switch s {
+	case syncdir.Uploading:
+		return tr("Uploading")
+	case syncdir.Synced:
+		return tr("Synced")
+	case syncdir.Conflict:
+		return tr("Conflict")
+	case syncdir.Failed:
+		return tr("Failed")
+	case syncdir.Deleted:
+		return tr("Deleted")
+	}
+	return string(s)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// buildSyncPlayToggle adds the Synchronized toggle for broadcast-play.
+func (a *app) buildSyncPlayToggle(box *gtk.Box) {
+	a.syncPlayCheck, _ = gtk.CheckButtonNewWithLabel(tr("Synchronized"))
+	a.syncPlayCheck.Connect("toggled", func() { a.syncPlay.Store(a.syncPlayCheck.GetActive()) })
+	box.PackEnd(a.syncPlayCheck, false, false, 0)
+	a.setSyncPlayAvailable(false)
+}
+
+// setSyncPlayAvailable offers the toggle only on hubs that can start peers
+// together. Must run on the GTK main loop.
+func (a *app) setSyncPlayAvailable(ok bool) {
+	if a.syncPlayCheck == nil {
+		return
+	}
+	a.syncPlayCheck.SetSensitive(ok)
+	if ok {
+		a.syncPlayCheck.SetTooltipText(tr("Start Broadcast Play on every peer at the same moment"))
+		return
+	}
+	a.syncPlayCheck.SetActive(false)
+	a.syncPlayCheck.SetTooltipText(tr("This hub cannot synchronize playback"))
+}
+
+// measureHubClock logs how far this client's hub runs from the clock it
+// follows, and shows it on the toggle.
+func (a *app) measureHubClock() {
+	client := a.currentSocket()
+	if !client.Supports(protocol.CapSyncPlay) {
+		return
+	}
+	clock, err := client.Clock(a.ctx)
+	if err != nil {
+		a.logf("hub clock: %v", err)
+		return
+	}
+	offset, rtt := clock.UpstreamOffset, clock.UpstreamRTT
+	a.logf("hub clock offset %v (round trip %v)", offset.Round(time.Millisecond), rtt.Round(time.Millisecond))
+	glib.IdleAdd(func() bool {
+		if a.syncPlayCheck != nil && a.syncPlayCheck.GetSensitive() {
+			a.syncPlayCheck.SetTooltipText(fmt.Sprintf(tr("Start Broadcast Play on every peer at the same moment; this computer's clock is %d ms off the hub's"),
+				offset.Milliseconds()))
+		}
+		return false
+	})
+}
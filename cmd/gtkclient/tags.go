@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// favoriteTag is the tag behind the star on each audio button.
+const favoriteTag = "favorite"
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// visibleTags leaves out the favorite tag, which the star already shows.
+func visibleTags(tags []string) []string {
+	var out []string
+	for _, t := range tags {
+		if t != favoriteTag {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// normalizeTags trims, drops empty and duplicate tags, and sorts, the same
+// way the hub stores them.
+func normalizeTags(tags []string) []string {
+	seen := make(map[string]bool)
+	var out []string
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" || seen[t] {
+			continue
+		}
+		seen[t] = true
+		out = append(out, t)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// tagsSynced reports whether tags live on the hub rather than in the
+// profile.
+func (a *app) tagsSynced() bool {
+	return a.profile().SyncTags && a.currentSocket().Supports(protocol.CapTags)
+}
+
+// withTags returns a copy of files carrying the tags to show: the hub's
+// when synced, this profile's otherwise.
+func (a *app) withTags(files []audioFile) []audioFile {
+	if a.tagsSynced() {
+		return files
+	}
+	out := make([]audioFile, len(files))
+	for i, f := range files {
+		f.Tags = a.profile().FileTags[f.Name]
+		out[i] = f
+	}
+	return out
+}
+
+// filterAudioFiles keeps favorites when favoritesOnly is set, unplayed
+// files when neverPlayed is, and files whose name, title, artist or a tag
+// contains text.
+func filterAudioFiles(files []audioFile, favoritesOnly, neverPlayed bool, text string) []audioFile {
+	text = strings.ToLower(strings.TrimSpace(text))
+	var out []audioFile
+	for _, f := range files {
+		if favoritesOnly && !hasTag(f.Tags, favoriteTag) {
+			continue
+		}
+		if neverPlayed && f.Plays > 0 {
+			continue
+		}
+		if text != "" && !audioFileMatches(f, text) {
+			continue
+		}
+		out = append(out, f)
+	}
+	return out
+}
+
+func audioFileMatches(f audioFile, text string) bool {
+	for _, s := range append([]string{f.Name, f.Title, f.Artist}, f.Tags...) {
+		if strings.Contains(strings.ToLower(s), text) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *app) newFavoriteToggle(f audioFile) *gtk.ToggleButton {
+	star, _ := gtk.ToggleButtonNewWithLabel("☆")
+	starred := hasTag(f.Tags, favoriteTag)
+	if starred {
+		star.SetLabel("★")
+	}
+	star.SetActive(starred)
+	star.SetRelief(gtk.RELIEF_NONE)
+	star.SetVAlign(gtk.ALIGN_CENTER)
+	star.SetTooltipText(tr("Favorite"))
+	setAccessible(star, fmt.Sprintf(tr("Favorite %s"), f.Name), "")
+	addStyleClass(star, "favorite-toggle")
+	name, tags := f.Name, f.Tags
+	star.Connect("toggled", func() {
+		next := visibleTags(tags)
+		if star.GetActive() {
+			next = append(next, favoriteTag)
+		}
+		a.setFileTags(name, next)
+	})
+	return star
+}
+
+// setFileTags replaces the tags of the remote file name, on the hub when
+// synced. Must run on the GTK main loop.
+func (a *app) setFileTags(name string, tags []string) {
+	tags = normalizeTags(tags)
+	if a.tagsSynced() {
+		go func() {
+			if err := a.currentSocket().SetTags(a.ctx, name, tags); err != nil {
+				a.reportError("tags", err, func() { glib.IdleAdd(func() bool { a.setFileTags(name, tags); return false }) })
+				// put the star back the way the hub has it
+				glib.IdleAdd(func() bool {
+					a.refreshAudioButtons(a.audioFiles, "")
+					return false
+				})
+				return
+			}
+			glib.IdleAdd(func() bool {
+				for i := range a.audioFiles {
+					if a.audioFiles[i].Name == name {
+						a.audioFiles[i].Tags = tags
+					}
+				}
+				a.refreshAudioButtons(a.audioFiles, "")
+				return false
+			})
+		}()
+		return
+	}
+	a.updateProfile(func(p *profileConfig) {
+		if p.FileTags == nil {
+			p.FileTags = make(map[string][]string)
+		}
+		if len(tags) == 0 {
+			delete(p.FileTags, name)
+		} else {
+			p.FileTags[name] = tags
+		}
+	})
+	if err := a.config.save(); err != nil {
+		a.logf("config save error: %v", err)
+	}
+	// the star that called this is among the widgets a refresh destroys
+	glib.IdleAdd(func() bool {
+		if a.audioFiles != nil {
+			a.refreshAudioButtons(a.audioFiles, "")
+		}
+		return false
+	})
+}
+
+// editTags asks for the comma-separated tags of a remote file.
+func (a *app) editTags(f audioFile) {
+	var current []string
+	for _, shown := range a.withTags(a.audioFiles) {
+		if shown.Name == f.Name {
+			current = shown.Tags
+		}
+	}
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		a.logf("tags dialog error: %v", err)
+		return
+	}
+	dialog.SetTitle(fmt.Sprintf(tr("Tags for %s"), f.Name))
+	dialog.SetTransientFor(a.win)
+	dialog.AddButton(tr("Cancel"), gtk.RESPONSE_CANCEL)
+	dialog.AddButton(tr("Save"), gtk.RESPONSE_OK)
+	dialog.SetDefaultResponse(gtk.RESPONSE_OK)
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.SetBorderWidth(12)
+	entry, _ := gtk.EntryNew()
+	entry.SetText(strings.Join(visibleTags(current), ", "))
+	entry.SetActivatesDefault(true)
+	entry.SetPlaceholderText(tr("comma-separated, e.g. intro, loud"))
+	content.PackStart(mnemonicLabel(tr("_Tags:"), entry), false, false, 0)
+	content.PackStart(entry, false, false, 0)
+	dialog.ShowAll()
+	if dialog.Run() == gtk.RESPONSE_OK {
+		text, _ := entry.GetText()
+		tags := strings.Split(text, ",")
+		if hasTag(current, favoriteTag) {
+			tags = append(tags, favoriteTag)
+		}
+		a.setFileTags(f.Name, tags)
+	}
+	dialog.Destroy()
+}
+
+// pushLocalTags copies local, this profile's tags, to the hub for files
+// the hub has none for, when tag sync is first turned on.
+func (a *app) pushLocalTags(local map[string][]string) {
+	if len(local) == 0 {
+		return
+	}
+	hub, err := a.currentSocket().Tags(a.ctx)
+	if err != nil {
+		a.reportError("tags", err, nil)
+		return
+	}
+	pushed := 0
+	for name, tags := range local {
+		if len(hub[name]) > 0 {
+			continue
+		}
+		if err := a.currentSocket().SetTags(a.ctx, name, tags); err != nil {
+			a.reportError("tags", err, nil)
+			return
+		}
+		pushed++
+	}
+	a.logf("tags: shared %d file(s) with the hub", pushed)
+	a.fetchStatus()
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	telemetryFlushInterval = 10 * time.Second
+	telemetryMaxBatch      = 256
+	telemetryScope         = "brain/gtkclient"
+)
+
+// telemetryExporter ships finished spans and metric snapshots somewhere.
+// otlpExporter is the only implementation today; tests or other backends can
+// plug in their own.
+type telemetryExporter interface {
+	exportSpans(spans []*telemetrySpan) error
+	exportMetrics(points []metricPoint, start, now time.Time) error
+}
+
+// telemetry collects spans and counters and flushes them periodically. A nil
+// *telemetry is valid and records nothing, so call sites never need to check
+// whether export is configured.
+type telemetry struct {
+	exporter telemetryExporter
+	started  time.Time
+
+	mu       sync.Mutex
+	spans    []*telemetrySpan
+	counters map[string]*metricPoint
+
+	stop chan struct{}
+	once sync.Once
+}
+
+type telemetrySpan struct {
+	t        *telemetry
+	traceID  string
+	spanID   string
+	parentID string
+	name     string
+	start    time.Time
+	finished time.Time
+	attrs    map[string]any
+	err      error
+}
+
+type metricPoint struct {
+	name  string
+	attrs map[string]string
+	value int64
+}
+
+func newTelemetry(cfg telemetryConfig, profile string) *telemetry {
+	if cfg.Endpoint == "" {
+		return nil
+	}
+	service := cfg.ServiceName
+	if service == "" {
+		service = "brain-gtkclient"
+	}
+	t := &telemetry{
+		exporter: &otlpExporter{
+			endpoint: strings.TrimRight(cfg.Endpoint, "/"),
+			headers:  cfg.Headers,
+			resource: map[string]any{"service.name": service, "brain.profile": profile},
+			client:   &http.Client{Timeout: 5 * time.Second},
+		},
+		started:  time.Now(),
+		counters: make(map[string]*metricPoint),
+		stop:     make(chan struct{}),
+	}
+	go t.loop()
+	return t
+}
+
+func (t *telemetry) loop() {
+	ticker := time.NewTicker(telemetryFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			t.flush()
+		case <-t.stop:
+			return
+		}
+	}
+}
+
+type spanKey struct{}
+
+// startSpan begins a span; call end on the result when the work finishes.
+// A span already carried by ctx becomes the parent, so hub requests made
+// with the returned context land in the same trace.
+func (t *telemetry) startSpan(ctx context.Context, name string, attrs map[string]any) (context.Context, *telemetrySpan) {
+	if t == nil {
+		return ctx, nil
+	}
+	if attrs == nil {
+		attrs = make(map[string]any)
+	}
+	s := &telemetrySpan{
+		t:       t,
+		traceID: randomHex(16),
+		spanID:  randomHex(8),
+		name:    name,
+		start:   time.Now(),
+		attrs:   attrs,
+	}
+	if parent, ok := ctx.Value(spanKey{}).(*telemetrySpan); ok {
+		s.traceID = parent.traceID
+		s.parentID = parent.spanID
+	}
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+func (s *telemetrySpan) end(err error) {
+	if s == nil {
+		return
+	}
+	s.finished = time.Now()
+	s.err = err
+	t := s.t
+	t.mu.Lock()
+	t.spans = append(t.spans, s)
+	full := len(t.spans) >= telemetryMaxBatch
+	t.mu.Unlock()
+	if full {
+		go t.flush()
+	}
+}
+
+// add increments a monotonic counter.
+func (t *telemetry) add(name string, value int64, attrs map[string]string) {
+	if t == nil {
+		return
+	}
+	key := metricKey(name, attrs)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	p, ok := t.counters[key]
+	if !ok {
+		p = &metricPoint{name: name, attrs: attrs}
+		t.counters[key] = p
+	}
+	p.value += value
+}
+
+// observeRequest is installed as the hub client's Observe hook to record every request.
+func (t *telemetry) observeRequest(ctx context.Context, action string, started time.Time, err error) {
+	if t == nil {
+		return
+	}
+	_, span := t.startSpan(ctx, "socket."+action, map[string]any{"brain.action": action})
+	span.start = started
+	span.end(err)
+	outcome := "ok"
+	if err != nil {
+		outcome = "error"
+	}
+	t.add("brain.client.requests", 1, map[string]string{"action": action, "outcome": outcome})
+}
+
+func (t *telemetry) flush() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	spans := t.spans
+	t.spans = nil
+	points := make([]metricPoint, 0, len(t.counters))
+	for _, p := range t.counters {
+		points = append(points, *p)
+	}
+	t.mu.Unlock()
+	if len(spans) > 0 {
+		if err := t.exporter.exportSpans(spans); err != nil {
+			fmt.Printf("telemetry span export error: %v\n", err)
+		}
+	}
+	if len(points) > 0 {
+		if err := t.exporter.exportMetrics(points, t.started, time.Now()); err != nil {
+			fmt.Printf("telemetry metric export error: %v\n", err)
+		}
+	}
+}
+
+// shutdown flushes anything buffered and stops the export loop.
+func (t *telemetry) shutdown() {
+	if t == nil {
+		return
+	}
+	t.once.Do(func() {
+		close(t.stop)
+		t.flush()
+	})
+}
+
+func metricKey(name string, attrs map[string]string) string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteString("|" + k + "=" + attrs[k])
+	}
+	return b.String()
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// otlpExporter speaks OTLP/HTTP with the JSON encoding, which every
+// collector accepts and needs no generated protobuf code.
+type otlpExporter struct {
+	endpoint string
+	headers  map[string]string
+	resource map[string]any
+	client   *http.Client
+}
+
+func (e *otlpExporter) exportSpans(spans []*telemetrySpan) error {
+	out := make([]map[string]any, 0, len(spans))
+	for _, s := range spans {
+		status := map[string]any{"code": 1}
+		if s.err != nil {
+			status = map[string]any{"code": 2, "message": s.err.Error()}
+		}
+		span := map[string]any{
+			"traceId":           s.traceID,
+			"spanId":            s.spanID,
+			"name":              s.name,
+			"kind":              3,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.finished.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attrs),
+			"status":            status,
+		}
+		if s.parentID != "" {
+			span["parentSpanId"] = s.parentID
+		}
+		out = append(out, span)
+	}
+	body := map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource": map[string]any{"attributes": otlpAttributes(e.resource)},
+			"scopeSpans": []any{map[string]any{
+				"scope": map[string]any{"name": telemetryScope},
+				"spans": out,
+			}},
+		}},
+	}
+	return e.post("/v1/traces", body)
+}
+
+func (e *otlpExporter) exportMetrics(points []metricPoint, start, now time.Time) error {
+	byName := make(map[string][]map[string]any)
+	names := make([]string, 0)
+	for _, p := range points {
+		attrs := make(map[string]any, len(p.attrs))
+		for k, v := range p.attrs {
+			attrs[k] = v
+		}
+		if _, ok := byName[p.name]; !ok {
+			names = append(names, p.name)
+		}
+		byName[p.name] = append(byName[p.name], map[string]any{
+			"asInt":             strconv.FormatInt(p.value, 10),
+			"startTimeUnixNano": strconv.FormatInt(start.UnixNano(), 10),
+			"timeUnixNano":      strconv.FormatInt(now.UnixNano(), 10),
+			"attributes":        otlpAttributes(attrs),
+		})
+	}
+	sort.Strings(names)
+	metrics := make([]map[string]any, 0, len(names))
+	for _, name := range names {
+		metrics = append(metrics, map[string]any{
+			"name": name,
+			"sum": map[string]any{
+				"dataPoints":             byName[name],
+				"aggregationTemporality": 2,
+				"isMonotonic":            true,
+			},
+		})
+	}
+	body := map[string]any{
+		"resourceMetrics": []any{map[string]any{
+			"resource": map[string]any{"attributes": otlpAttributes(e.resource)},
+			"scopeMetrics": []any{map[string]any{
+				"scope":   map[string]any{"name": telemetryScope},
+				"metrics": metrics,
+			}},
+		}},
+	}
+	return e.post("/v1/metrics", body)
+}
+
+func (e *otlpExporter) post(path string, body any) error {
+	encoded, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.endpoint+path, bytes.NewReader(encoded))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: HTTP %d", path, resp.StatusCode)
+	}
+	return nil
+}
+
+func otlpAttributes(attrs map[string]any) []map[string]any {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	out := make([]map[string]any, 0, len(keys))
+	for _, k := range keys {
+		var value map[string]any
+		switch v := attrs[k].(type) {
+		case string:
+			value = map[string]any{"stringValue": v}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		out = append(out, map[string]any{"key": k, "value": value})
+	}
+	return out
+}
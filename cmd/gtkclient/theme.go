@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const userCSSFile = "style.css"
+
+var themes = []string{"system", "light", "dark"}
+
+// builtinCSS styles the classes the client puts on its widgets. A
+// style.css next to the config file is loaded after it and can override
+// any of these:
+//
+//	.audio-button, .audio-button.temporary, .client-log, .hub-log,
+//	.hub-status, .now-playing, .conn-indicator and its state classes
+//	(.offline, .connecting, .authenticating, .connected, .degraded,
+//	.reconnecting), .link-quality and the .peer-health cells and their
+//	levels (.good, .degraded, .poor)
+const builtinCSS = `
+.audio-button.temporary { font-style: italic; }
+.conn-indicator { color: #9e9e9e; }
+.conn-indicator.connecting, .conn-indicator.authenticating { color: #1e88e5; }
+.conn-indicator.connected { color: #43a047; }
+.conn-indicator.degraded, .conn-indicator.reconnecting { color: #fb8c00; }
+.conn-indicator.offline { color: #e53935; }
+.link-quality.degraded { color: #fb8c00; }
+.link-quality.poor { color: #e53935; }
+.peer-health.good { color: #43a047; }
+.peer-health.degraded { color: #fb8c00; }
+.peer-health.poor { color: #e53935; }
+.client-log, .hub-log { padding: 4px; }
+.now-playing { font-weight: bold; }
+`
+
+// themeState is owned by the GTK main loop.
+type themeState struct {
+	systemDark bool
+	captured   bool
+	user       *gtk.CssProvider
+}
+
+func userCSSPath() (string, error) {
+	cfgPath, err := configPath()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(cfgPath), userCSSFile), nil
+}
+
+// applyTheme sets the dark-theme preference and (re)loads the built-in and
+// user stylesheets. Must run on the GTK main loop.
+func (a *app) applyTheme() {
+	settings, err := gtk.SettingsGetDefault()
+	if err != nil {
+		a.logf("theme: %v", err)
+		return
+	}
+	if !a.theme.captured {
+		// remember what the desktop asked for so "system" can restore it
+		if v, err := settings.GetProperty("gtk-application-prefer-dark-theme"); err == nil {
+			a.theme.systemDark, _ = v.(bool)
+		}
+		a.theme.captured = true
+	}
+	dark := a.theme.systemDark
+	switch a.config.Theme {
+	case "light":
+		dark = false
+	case "dark":
+		dark = true
+	}
+	if err := settings.SetProperty("gtk-application-prefer-dark-theme", dark); err != nil {
+		a.logf("theme: %v", err)
+	}
+
+	screen, err := gdk.ScreenGetDefault()
+	if err != nil {
+		a.logf("theme: %v", err)
+		return
+	}
+	if a.theme.user == nil {
+		builtin, err := gtk.CssProviderNew()
+		if err != nil {
+			a.logf("theme: %v", err)
+			return
+		}
+		if err := builtin.LoadFromData(builtinCSS); err != nil {
+			a.logf("theme: built-in css: %v", err)
+		}
+		gtk.AddProviderForScreen(screen, builtin, uint(gtk.STYLE_PROVIDER_PRIORITY_APPLICATION))
+		a.theme.user, err = gtk.CssProviderNew()
+		if err != nil {
+			a.logf("theme: %v", err)
+			return
+		}
+		gtk.AddProviderForScreen(screen, a.theme.user, uint(gtk.STYLE_PROVIDER_PRIORITY_USER))
+	}
+	path, err := userCSSPath()
+	if err != nil {
+		return
+	}
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		_ = a.theme.user.LoadFromData("")
+		return
+	}
+	if err := a.theme.user.LoadFromPath(path); err != nil {
+		a.logf("theme: %s: %v", path, err)
+		return
+	}
+	a.logf("theme: loaded %s", path)
+}
+
+// addStyleClass tags a widget for the stylesheets.
+func addStyleClass(w interface {
+	GetStyleContext() (*gtk.StyleContext, error)
+}, classes ...string) {
+	ctx, err := w.GetStyleContext()
+	if err != nil {
+		return
+	}
+	for _, c := range classes {
+		ctx.AddClass(c)
+	}
+}
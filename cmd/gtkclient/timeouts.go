@@ -0,0 +1,96 @@
+package main
+
+import (
+	"sort"
+	"time"
+
+	"brain/internal/hubclient"
+)
+
+// defaultTimeouts are used for actions the config does not override. Quick
+// queries fail fast; anything moving file data gets minutes.
+var defaultTimeouts = map[string]time.Duration{
+	"status":        3 * time.Second,
+	"files":         5 * time.Second,
+	"peers":         5 * time.Second,
+	"command":       30 * time.Second,
+	"upload":        5 * time.Minute,
+	"upload-begin":  15 * time.Second,
+	"upload-chunk":  time.Minute,
+	"upload-commit": 2 * time.Minute,
+	"upload-resume": 15 * time.Second,
+	"hash":          time.Minute,
+	"peer-files":    15 * time.Second,
+	"peer-upload":   5 * time.Minute,
+}
+
+// timeoutFor is baseTimeout, stretched while the link is poor.
+func (a *app) timeoutFor(action string) time.Duration {
+	d := a.baseTimeout(action)
+	if a.linkLevel() == linkPoor {
+		d *= poorTimeoutFactor
+	}
+	return d
+}
+
+// baseTimeout resolves an action's timeout: the profile override, then the
+// built-in default for that action, then the profile's "default" entry,
+// then hubclient.DefaultTimeout.
+func (a *app) baseTimeout(action string) time.Duration {
+	a.timeoutsMu.RLock()
+	defer a.timeoutsMu.RUnlock()
+	if secs, ok := a.timeouts[action]; ok && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	if d, ok := defaultTimeouts[action]; ok {
+		return d
+	}
+	if secs, ok := a.timeouts["default"]; ok && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	return hubclient.DefaultTimeout
+}
+
+// setTimeouts replaces the overrides the socket reads and stores them in
+// the profile.
+func (a *app) setTimeouts(overrides map[string]float64) {
+	a.timeoutsMu.Lock()
+	a.timeouts = overrides
+	a.timeoutsMu.Unlock()
+	a.updateProfile(func(p *profileConfig) { p.Timeouts = overrides })
+}
+
+// timeoutActions lists every action shown in Preferences, defaults first.
+func timeoutActions(overrides map[string]float64) []string {
+	seen := map[string]bool{"default": true}
+	names := []string{"default"}
+	for name := range defaultTimeouts {
+		seen[name] = true
+		names = append(names, name)
+	}
+	for name := range overrides {
+		if !seen[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names[1:])
+	return names
+}
+
+// retryPolicy is the profile's retry setting laid over the client default.
+func (a *app) retryPolicy() hubclient.RetryPolicy {
+	p := hubclient.DefaultRetry
+	if a.profile() == nil || a.profile().Retry == nil {
+		return p
+	}
+	if n := a.profile().Retry.Attempts; n > 0 {
+		p.Attempts = n
+	}
+	if secs := a.profile().Retry.BackoffSeconds; secs > 0 {
+		p.Backoff = time.Duration(secs * float64(time.Second))
+		if p.MaxBackoff < p.Backoff {
+			p.MaxBackoff = p.Backoff
+		}
+	}
+	return p
+}
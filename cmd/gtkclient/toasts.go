@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	toastTimeout   = 20 * time.Second
+	toastMaxShown  = 3
+	recentErrorCap = 20
+	// undoTimeout is how long an Undo toast offers to take a deletion back
+	undoTimeout = 10 * time.Second
+)
+
+const (
+	toastResponseRetry gtk.ResponseType = iota + 1
+	toastResponseReconnect
+	toastResponseDiagnostics
+)
+
+// reportError logs a failed user action and raises a non-modal toast with
+// the buttons that make sense for the failure. retry may be nil when the
+// action cannot simply be repeated.
+func (a *app) reportError(action string, err error, retry func()) {
+	if errors.Is(err, context.Canceled) {
+		a.logf("%s cancelled", action)
+		return
+	}
+	a.logf("%s error: %v", action, err)
+	a.recordError(fmt.Sprintf("%s: %v", action, err))
+	reconnect := hubclient.IsConnectionError(err)
+	if !protocol.Retryable(err) || errors.Is(err, hubclient.ErrUnsupported) {
+		retry = nil
+	}
+	glib.IdleAdd(func() bool {
+		a.showToast(fmt.Sprintf(tr("%s failed: %s"), action, protocol.Friendly(err)), retry, reconnect)
+		return false
+	})
+}
+
+func (a *app) recordError(entry string) {
+	a.errorsMu.Lock()
+	defer a.errorsMu.Unlock()
+	a.recentErrors = append(a.recentErrors, fmt.Sprintf("[%s] %s", time.Now().Format("15:04:05"), entry))
+	if len(a.recentErrors) > recentErrorCap {
+		a.recentErrors = a.recentErrors[len(a.recentErrors)-recentErrorCap:]
+	}
+}
+
+func (a *app) showToast(message string, retry func(), reconnect bool) {
+	a.showToastType(gtk.MESSAGE_ERROR, message, retry, reconnect)
+}
+
+func (a *app) showToastType(kind gtk.MessageType, message string, retry func(), reconnect bool) {
+	bar := a.newToast(kind, message)
+	if bar == nil {
+		return
+	}
+	if retry != nil {
+		bar.AddButton(tr("Retry"), toastResponseRetry)
+	}
+	if reconnect {
+		bar.AddButton(tr("Reconnect"), toastResponseReconnect)
+	}
+	bar.AddButton(tr("Open diagnostics"), toastResponseDiagnostics)
+	bar.Connect("response", func(_ *gtk.InfoBar, response gtk.ResponseType) {
+		a.dismissToast(bar)
+		switch response {
+		case toastResponseRetry:
+			go retry()
+		case toastResponseReconnect:
+			go a.reconnectSocket()
+		case toastResponseDiagnostics:
+			a.showDiagnostics()
+		}
+	})
+	a.addToast(bar)
+}
+
+// showOfferToast raises an info toast with one button that runs accept
+// on the GTK main loop.
+func (a *app) showOfferToast(message, button string, accept func()) {
+	bar := a.newToast(gtk.MESSAGE_INFO, message)
+	if bar == nil {
+		return
+	}
+	bar.AddButton(button, gtk.RESPONSE_ACCEPT)
+	bar.Connect("response", func(_ *gtk.InfoBar, response gtk.ResponseType) {
+		a.dismissToast(bar)
+		if response == gtk.RESPONSE_ACCEPT {
+			accept()
+		}
+	})
+	a.addToast(bar)
+}
+
+// showUndoToast raises an info toast whose Undo button runs undo on the
+// GTK main loop, for undoTimeout only.
+func (a *app) showUndoToast(message string, undo func()) {
+	bar := a.newToast(gtk.MESSAGE_INFO, message)
+	if bar == nil {
+		return
+	}
+	bar.AddButton(tr("Undo"), gtk.RESPONSE_ACCEPT)
+	bar.Connect("response", func(_ *gtk.InfoBar, response gtk.ResponseType) {
+		a.dismissToast(bar)
+		if response == gtk.RESPONSE_ACCEPT {
+			undo()
+		}
+	})
+	a.addToastFor(bar, undoTimeout)
+}
+
+// newToast makes room for, and builds, a toast without buttons.
+func (a *app) newToast(kind gtk.MessageType, message string) *gtk.InfoBar {
+	if a.toastBox == nil {
+		return nil
+	}
+	for len(a.toasts) >= toastMaxShown {
+		a.dismissToast(a.toasts[0])
+	}
+	bar, err := gtk.InfoBarNew()
+	if err != nil {
+		return nil
+	}
+	bar.SetMessageType(kind)
+	bar.SetShowCloseButton(true)
+	content, _ := bar.GetContentArea()
+	label, _ := gtk.LabelNew(message)
+	label.SetXAlign(0)
+	label.SetLineWrap(true)
+	label.SetSelectable(true)
+	content.PackStart(label, true, true, 0)
+	setAccessible(bar, "", message)
+	return bar
+}
+
+func (a *app) addToast(bar *gtk.InfoBar) {
+	a.addToastFor(bar, toastTimeout)
+}
+
+func (a *app) addToastFor(bar *gtk.InfoBar, timeout time.Duration) {
+	a.toastBox.PackStart(bar, false, false, 0)
+	bar.ShowAll()
+	a.toasts = append(a.toasts, bar)
+	glib.TimeoutAdd(uint(timeout/time.Millisecond), func() bool {
+		a.dismissToast(bar)
+		return false
+	})
+}
+
+func (a *app) dismissToast(bar *gtk.InfoBar) {
+	for i, t := range a.toasts {
+		if t == bar {
+			a.toasts = append(a.toasts[:i], a.toasts[i+1:]...)
+			a.toastBox.Remove(bar)
+			bar.Destroy()
+			return
+		}
+	}
+}
+
+// reconnectSocket drops the current connection and dials again.
+func (a *app) reconnectSocket() {
+	a.closeSocket()
+	if err := a.connectSocket(); err != nil {
+		a.reportError("reconnect", err, a.reconnectSocket)
+		return
+	}
+	a.fetchStatus()
+}
+
+func (a *app) showDiagnostics() {
+	lines := []string{fmt.Sprintf("Control URL: %s", a.controlURL())}
+	if addr, err := a.socketAddress(); err == nil {
+		lines = append(lines, fmt.Sprintf("Socket address: %s", addr))
+	} else {
+		lines = append(lines, fmt.Sprintf("Socket address: %v", err))
+	}
+	state, reason := a.connState()
+	if reason != "" {
+		lines = append(lines, fmt.Sprintf("Connection: %s (%s)", state, reason))
+	} else {
+		lines = append(lines, fmt.Sprintf("Connection: %s", state))
+	}
+	lines = append(lines, fmt.Sprintf("Link quality: %s", a.linkLevel()))
+	if sock := a.currentSocket(); sock != nil {
+		lines = append(lines, "Socket: connected", fmt.Sprintf("Pending requests: %d", sock.PendingCount()))
+	} else {
+		lines = append(lines, "Socket: not connected")
+	}
+	if limit := a.uploadLimit(); limit > 0 {
+		lines = append(lines, fmt.Sprintf("Upload limit: %s/s", formatBytes(limit)))
+	} else {
+		lines = append(lines, "Upload limit: none")
+	}
+	if hello := a.currentSocket().Hello(); hello != nil {
+		lines = append(lines, fmt.Sprintf("Hub: %s", hello))
+	}
+	a.socketMu.Lock()
+	attempts := a.connectCount
+	a.socketMu.Unlock()
+	lines = append(lines, fmt.Sprintf("Connection attempts: %d", attempts), "", "Recent errors:")
+	a.errorsMu.Lock()
+	if len(a.recentErrors) == 0 {
+		lines = append(lines, "  (none)")
+	}
+	for _, e := range a.recentErrors {
+		lines = append(lines, "  "+e)
+	}
+	a.errorsMu.Unlock()
+
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		return
+	}
+	dialog.SetTitle(tr("Diagnostics"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetDefaultSize(560, 360)
+	dialog.AddButton(tr("Close"), gtk.RESPONSE_CLOSE)
+	dialog.Connect("response", func() { dialog.Destroy() })
+	content, _ := dialog.GetContentArea()
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetVExpand(true)
+	content.PackStart(scroll, true, true, 0)
+	view, _ := gtk.TextViewNew()
+	view.SetEditable(false)
+	view.SetMonospace(true)
+	buf, _ := view.GetBuffer()
+	buf.SetText(strings.Join(lines, "\n"))
+	scroll.Add(view)
+	dialog.ShowAll()
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"sort"
+
+	"brain/internal/hubclient"
+	"brain/internal/metrics"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// trafficTotals is socket traffic for one action, or "event:<name>" for
+// events the hub pushed, in bytes.
+type trafficTotals struct {
+	Sent     int64 `json:"sent,omitempty"`
+	Received int64 `json:"received,omitempty"`
+}
+
+// sessionTraffic reads this run's traffic by action from the metrics.
+func (a *app) sessionTraffic() map[string]trafficTotals {
+	out := make(map[string]trafficTotals)
+	for _, action := range a.metrics.LabelValues(hubclient.MetricBytesWritten, "action") {
+		t := out[action]
+		t.Sent = int64(a.metrics.Total(hubclient.MetricBytesWritten, metrics.Labels{"action": action}))
+		out[action] = t
+	}
+	for _, action := range a.metrics.LabelValues(hubclient.MetricBytesRead, "action") {
+		t := out[action]
+		t.Received = int64(a.metrics.Total(hubclient.MetricBytesRead, metrics.Labels{"action": action}))
+		out[action] = t
+	}
+	return out
+}
+
+// foldTraffic adds what the session moved since the last fold to the
+// profile's cumulative totals. Must run on the GTK main loop.
+func (a *app) foldTraffic() {
+	session := a.sessionTraffic()
+	if a.trafficBase == nil {
+		a.trafficBase = make(map[string]trafficTotals)
+	}
+	a.updateProfile(func(p *profileConfig) {
+		if p.Traffic == nil {
+			p.Traffic = make(map[string]*trafficTotals)
+		}
+		for action, now := range session {
+			base := a.trafficBase[action]
+			t := p.Traffic[action]
+			if t == nil {
+				t = &trafficTotals{}
+				p.Traffic[action] = t
+			}
+			t.Sent += now.Sent - base.Sent
+			t.Received += now.Received - base.Received
+			a.trafficBase[action] = now
+		}
+	})
+}
+
+const (
+	trafficColAction = iota
+	trafficColSent
+	trafficColReceived
+	trafficColTotalSent
+	trafficColTotalReceived
+)
+
+// showStatistics lists bytes sent and received by action for this session
+// and, cumulatively, for the profile.
+func (a *app) showStatistics() {
+	a.foldTraffic()
+	session := a.sessionTraffic()
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		return
+	}
+	dialog.SetTitle(tr("Traffic Statistics"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetDefaultSize(620, 420)
+	dialog.AddButton(tr("Reset Profile Totals"), gtk.RESPONSE_REJECT)
+	dialog.AddButton(tr("Close"), gtk.RESPONSE_CLOSE)
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.SetBorderWidth(8)
+
+	store, _ := gtk.ListStoreNew(glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING, glib.TYPE_STRING)
+	fill := func() {
+		store.Clear()
+		actions := make([]string, 0, len(a.profile().Traffic))
+		for action := range a.profile().Traffic {
+			actions = append(actions, action)
+		}
+		sort.Slice(actions, func(i, j int) bool {
+			ti, tj := a.profile().Traffic[actions[i]], a.profile().Traffic[actions[j]]
+			return ti.Sent+ti.Received > tj.Sent+tj.Received
+		})
+		var sum, total trafficTotals
+		for _, action := range actions {
+			s, t := session[action], a.profile().Traffic[action]
+			sum.Sent += s.Sent
+			sum.Received += s.Received
+			total.Sent += t.Sent
+			total.Received += t.Received
+			store.Set(store.Append(),
+				[]int{trafficColAction, trafficColSent, trafficColReceived, trafficColTotalSent, trafficColTotalReceived},
+				[]interface{}{action, formatBytes(s.Sent), formatBytes(s.Received), formatBytes(t.Sent), formatBytes(t.Received)})
+		}
+		store.Set(store.Append(),
+			[]int{trafficColAction, trafficColSent, trafficColReceived, trafficColTotalSent, trafficColTotalReceived},
+			[]interface{}{tr("All"), formatBytes(sum.Sent), formatBytes(sum.Received), formatBytes(total.Sent), formatBytes(total.Received)})
+	}
+	fill()
+
+	view, _ := gtk.TreeViewNewWithModel(store)
+	setAccessible(view, tr("Traffic by action"), "")
+	for _, col := range []struct {
+		title string
+		index int
+	}{
+		{tr("Action"), trafficColAction},
+		{tr("Sent"), trafficColSent},
+		{tr("Received"), trafficColReceived},
+		{tr("Profile sent"), trafficColTotalSent},
+		{tr("Profile received"), trafficColTotalReceived},
+	} {
+		renderer, _ := gtk.CellRendererTextNew()
+		column, err := gtk.TreeViewColumnNewWithAttribute(col.title, renderer, "text", col.index)
+		if err != nil {
+			continue
+		}
+		column.SetResizable(true)
+		column.SetExpand(col.index == trafficColAction)
+		view.AppendColumn(column)
+	}
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetVExpand(true)
+	scroll.Add(view)
+	content.PackStart(scroll, true, true, 0)
+	note, _ := gtk.LabelNew(tr("Sent and Received cover this session; the profile columns add up every session on this profile. Events pushed by the hub are listed as event:<name>."))
+	note.SetLineWrap(true)
+	note.SetXAlign(0)
+	content.PackStart(note, false, false, 0)
+
+	dialog.Connect("response", func(_ *gtk.Dialog, response gtk.ResponseType) {
+		if response != gtk.RESPONSE_REJECT {
+			dialog.Destroy()
+			return
+		}
+		session = a.sessionTraffic()
+		a.trafficBase = session
+		totals := make(map[string]*trafficTotals, len(session))
+		for action := range session {
+			totals[action] = &trafficTotals{}
+		}
+		a.updateProfile(func(p *profileConfig) { p.Traffic = totals })
+		if err := a.config.save(); err != nil {
+			a.reportError("reset traffic totals", err, nil)
+		}
+		a.logf("traffic totals reset for profile %s", a.profileName())
+		fill()
+	})
+	dialog.ShowAll()
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"brain/internal/hubclient"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const defaultTranscodeKbps = 128
+
+// transcodeFormat is an upload format GStreamer can encode to.
+type transcodeFormat struct {
+	id, name, ext string
+	// encoder is the pipeline between audioresample and the filesink
+	encoder func(kbps int) []string
+}
+
+var transcodeFormats = []transcodeFormat{
+	{id: "opus", name: "Opus", ext: ".opus", encoder: func(kbps int) []string {
+		return []string{"opusenc", fmt.Sprintf("bitrate=%d", kbps*1000), "!", "oggmux"}
+	}},
+	{id: "vorbis", name: "Ogg Vorbis", ext: ".ogg", encoder: func(kbps int) []string {
+		return []string{"vorbisenc", fmt.Sprintf("bitrate=%d", kbps*1000), "!", "oggmux"}
+	}},
+	{id: "mp3", name: "MP3", ext: ".mp3", encoder: func(kbps int) []string {
+		return []string{"lamemp3enc", "target=bitrate", "cbr=true", fmt.Sprintf("bitrate=%d", kbps), "!", "id3v2mux"}
+	}},
+}
+
+func findTranscodeFormat(id string) (transcodeFormat, bool) {
+	for _, f := range transcodeFormats {
+		if f.id == id {
+			return f, true
+		}
+	}
+	return transcodeFormat{}, false
+}
+
+func (a *app) transcodeKbps() int {
+	if a.profile().TranscodeKbps > 0 {
+		return a.profile().TranscodeKbps
+	}
+	return defaultTranscodeKbps
+}
+
+// transcodeDir holds converted files until their upload finishes. Chunked
+// uploads keep theirs across restarts so they can resume.
+func transcodeDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, configDirName, "transcoded"), nil
+}
+
+// transcodeForUpload converts path to the format chosen in Preferences and
+// returns the converted file and the remote name with its extension
+// swapped. It returns "" when the file is better uploaded as it is: not
+// audio, or no smaller once converted.
+func (a *app) transcodeForUpload(ctx context.Context, path, remote string) (string, string, error) {
+	format, ok := findTranscodeFormat(a.profile().Transcode)
+	if !ok {
+		return "", "", nil
+	}
+	if !strings.HasPrefix(hubclient.ContentType(path), "audio/") {
+		a.logf("not transcoding %s: not an audio file", filepath.Base(path))
+		return "", "", nil
+	}
+	dir, err := transcodeDir()
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", err
+	}
+	out, err := os.CreateTemp(dir, "*"+format.ext)
+	if err != nil {
+		return "", "", err
+	}
+	out.Close()
+	kbps := a.transcodeKbps()
+	args := []string{"-q", "filesrc", "location=" + path, "!", "decodebin", "!", "audioconvert", "!", "audioresample", "!"}
+	args = append(args, format.encoder(kbps)...)
+	args = append(args, "!", "filesink", "location="+out.Name())
+	a.logf("transcoding %s to %s at %d kbps", filepath.Base(path), format.name, kbps)
+	cmd := exec.CommandContext(ctx, "gst-launch-1.0", args...)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		os.Remove(out.Name())
+		if errors.Is(err, exec.ErrNotFound) {
+			return "", "", fmt.Errorf("transcoding needs gst-launch-1.0: %w", err)
+		}
+		if msg := strings.TrimSpace(string(output)); msg != "" {
+			return "", "", fmt.Errorf("%w: %s", err, msg)
+		}
+		return "", "", err
+	}
+	before, err := os.Stat(path)
+	if err != nil {
+		os.Remove(out.Name())
+		return "", "", err
+	}
+	after, err := os.Stat(out.Name())
+	if err != nil {
+		os.Remove(out.Name())
+		return "", "", err
+	}
+	if after.Size() == 0 || after.Size() >= before.Size() {
+		os.Remove(out.Name())
+		a.logf("not transcoding %s: %s would not be smaller", filepath.Base(path), format.name)
+		return "", "", nil
+	}
+	a.logf("transcoded %s: %s -> %s", filepath.Base(path), formatBytes(before.Size()), formatBytes(after.Size()))
+	return out.Name(), strings.TrimSuffix(remote, filepath.Ext(remote)) + format.ext, nil
+}
+
+// releaseTranscoded removes a converted file once its upload is over,
+// unless a paused chunked upload still needs it.
+func (a *app) releaseTranscoded(path string) {
+	for _, u := range a.uploads.list() {
+		if u.Path == path {
+			return
+		}
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		a.logf("transcode cleanup error: %v", err)
+	}
+}
+
+// sweepTranscoded removes converted files left behind by a crash.
+func (a *app) sweepTranscoded() {
+	dir, err := transcodeDir()
+	if err != nil {
+		return
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		a.releaseTranscoded(filepath.Join(dir, e.Name()))
+	}
+}
+
+// updateTranscodeCheck enables the upload row's Transcode option when a
+// format is set in Preferences.
+func (a *app) updateTranscodeCheck() {
+	if a.uploadTranscodeCheck == nil {
+		return
+	}
+	format, ok := findTranscodeFormat(a.profile().Transcode)
+	a.uploadTranscodeCheck.SetSensitive(ok)
+	a.uploadTranscodeCheck.SetActive(ok)
+	if !ok {
+		a.uploadTranscodeCheck.SetTooltipText(tr("Choose a transcoding format in Preferences first"))
+		return
+	}
+	a.uploadTranscodeCheck.SetTooltipText(fmt.Sprintf(tr("Convert audio to %s at %d kbps before uploading"), format.name, a.transcodeKbps()))
+}
+
+// buildTranscodePreferences adds the format and bitrate rows to the
+// Preferences dialog and returns a function that stores them.
+func (a *app) buildTranscodePreferences(content *gtk.Box) func() {
+	box, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	content.PackStart(box, false, false, 0)
+	label, _ := gtk.LabelNew(tr("Transcode uploads to:"))
+	box.PackStart(label, false, false, 0)
+	combo, _ := gtk.ComboBoxTextNew()
+	combo.Append("none", tr("Off"))
+	for _, f := range transcodeFormats {
+		combo.Append(f.id, f.name)
+	}
+	if !combo.SetActiveID(a.profile().Transcode) {
+		combo.SetActiveID("none")
+	}
+	label.SetMnemonicWidget(combo)
+	box.PackStart(combo, false, false, 0)
+	kbpsSpin, _ := gtk.SpinButtonNewWithRange(32, 320, 16)
+	kbpsSpin.SetValue(float64(a.transcodeKbps()))
+	setAccessible(kbpsSpin, tr("Transcode bitrate (kbps)"), "")
+	box.PackStart(kbpsSpin, false, false, 0)
+	kbpsLabel, _ := gtk.LabelNew(tr("kbps"))
+	box.PackStart(kbpsLabel, false, false, 0)
+	box.SetTooltipText(tr("Converting lossless sources to a compressed format before uploading makes uploads much smaller; needs GStreamer"))
+	return func() {
+		format := combo.GetActiveID()
+		if format == "none" {
+			format = ""
+		}
+		kbps := int(kbpsSpin.GetValue())
+		if kbps == defaultTranscodeKbps {
+			kbps = 0
+		}
+		a.updateProfile(func(p *profileConfig) {
+			p.Transcode = format
+			p.TranscodeKbps = kbps
+		})
+		a.updateTranscodeCheck()
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+	"github.com/gotk3/gotk3/pango"
+)
+
+// localFileState is what this client keeps about hub files of its own:
+// hotkeys, by accelerator, and tags, by file.
+type localFileState struct {
+	keys map[string]string
+	tags map[string][]string
+}
+
+// add merges more into s.
+func (s *localFileState) add(more localFileState) {
+	if s.keys == nil {
+		s.keys = make(map[string]string)
+		s.tags = make(map[string][]string)
+	}
+	for accel, f := range more.keys {
+		s.keys[accel] = f
+	}
+	for f, tags := range more.tags {
+		s.tags[f] = tags
+	}
+}
+
+// drop forgets what s holds for the files in names.
+func (s *localFileState) drop(names map[string]bool) {
+	for accel, f := range s.keys {
+		if names[f] {
+			delete(s.keys, accel)
+		}
+	}
+	for f := range s.tags {
+		if names[f] {
+			delete(s.tags, f)
+		}
+	}
+}
+
+// restoreHubFiles takes names out of the hub's trash and gives them back
+// the hotkeys and tags kept from their deletion.
+func (a *app) restoreHubFiles(names []string, kept localFileState) {
+	client := a.currentSocket()
+	var restored []string
+	for _, name := range names {
+		if err := client.Restore(a.ctx, name); err != nil {
+			a.reportError("restore", fmt.Errorf("%s: %w", name, err), nil)
+			continue
+		}
+		restored = append(restored, name)
+	}
+	if len(restored) == 0 {
+		return
+	}
+	a.logf("restored %s from the hub's trash", strings.Join(restored, ", "))
+	glib.IdleAdd(func() bool {
+		a.rememberHubFiles(restored, kept)
+		return false
+	})
+	a.fetchFiles()
+	a.fetchStatus()
+	a.fetchPlayStats()
+	a.fetchTrash()
+}
+
+// rememberHubFiles puts back the kept hotkeys and tags of names, leaving
+// any hotkey reassigned since. Must run on the GTK main loop.
+func (a *app) rememberHubFiles(names []string, kept localFileState) {
+	back := make(map[string]bool, len(names))
+	for _, name := range names {
+		back[name] = true
+	}
+	a.trashKept.drop(back)
+	bound, tagged := false, false
+	a.updateProfile(func(p *profileConfig) {
+		for accel, f := range kept.keys {
+			if _, taken := p.Soundboard[accel]; back[f] && !taken {
+				if p.Soundboard == nil {
+					p.Soundboard = make(map[string]string)
+				}
+				p.Soundboard[accel] = f
+				bound = true
+			}
+		}
+		for f, tags := range kept.tags {
+			if back[f] {
+				if p.FileTags == nil {
+					p.FileTags = make(map[string][]string)
+				}
+				p.FileTags[f] = tags
+				tagged = true
+			}
+		}
+	})
+	if bound {
+		a.saveSoundboard()
+	} else if tagged {
+		if err := a.config.save(); err != nil {
+			a.logf("config save error: %v", err)
+		}
+	}
+}
+
+// showTrash lists the files in the hub's trash, each with buttons to
+// restore it or delete it for good.
+func (a *app) showTrash() {
+	if a.trashList != nil {
+		if top, err := a.trashList.GetToplevel(); err == nil {
+			if w, ok := top.(*gtk.Window); ok {
+				w.Present()
+			}
+		}
+		go a.fetchTrash()
+		return
+	}
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		a.logf("trash dialog error: %v", err)
+		return
+	}
+	dialog.SetTitle(tr("Trash"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetDefaultSize(520, 360)
+	emptyBtn, _ := dialog.AddButton(tr("Empty Trash"), gtk.RESPONSE_REJECT)
+	dialog.AddButton(tr("Close"), gtk.RESPONSE_CLOSE)
+	if role := a.currentSocket().Role(); !role.Allows("purge") {
+		emptyBtn.SetSensitive(false)
+		emptyBtn.SetTooltipText(roleTooltip(role))
+	}
+	content, _ := dialog.GetContentArea()
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetVExpand(true)
+	content.PackStart(scroll, true, true, 0)
+	a.trashList, _ = gtk.ListBoxNew()
+	a.trashOpen.Store(true)
+	a.trashList.SetSelectionMode(gtk.SELECTION_NONE)
+	setAccessible(a.trashList, tr("Deleted files"), "")
+	scroll.Add(a.trashList)
+	a.fillTrash(nil, tr("Loading…"))
+	dialog.Connect("response", func(_ *gtk.Dialog, response gtk.ResponseType) {
+		if response == gtk.RESPONSE_REJECT {
+			if a.confirmDelete(tr("Delete every file in the trash for good?")) {
+				go a.purgeTrash("")
+			}
+			return
+		}
+		dialog.Destroy()
+	})
+	dialog.Connect("destroy", func() {
+		a.trashList = nil
+		a.trashOpen.Store(false)
+	})
+	dialog.ShowAll()
+	go a.fetchTrash()
+}
+
+// fetchTrash reloads the open trash list, if any.
+func (a *app) fetchTrash() {
+	if !a.trashOpen.Load() {
+		return
+	}
+	client := a.currentSocket()
+	var files []hubclient.TrashedFile
+	message := ""
+	if !client.Supports(protocol.CapTrash) {
+		message = tr("This hub deletes files at once; it has no trash")
+	} else {
+		var err error
+		if files, err = client.Trash(a.ctx); err != nil {
+			a.logf("trash error: %v", err)
+			message = fmt.Sprintf(tr("Could not load the trash: %s"), protocol.Friendly(err))
+		} else if len(files) == 0 {
+			message = tr("The trash is empty")
+		}
+	}
+	glib.IdleAdd(func() bool {
+		if a.trashList != nil {
+			a.fillTrash(files, message)
+		}
+		return false
+	})
+}
+
+// fillTrash rebuilds the open list. Must run on the GTK main loop.
+func (a *app) fillTrash(files []hubclient.TrashedFile, message string) {
+	if children := a.trashList.GetChildren(); children != nil {
+		children.Foreach(func(item interface{}) {
+			if w, ok := item.(*gtk.Widget); ok {
+				w.Destroy()
+			}
+		})
+	}
+	if message != "" {
+		label, _ := gtk.LabelNew(message)
+		a.trashList.Add(label)
+	}
+	// rows are rebuilt on every change, so the role is checked here
+	role := a.currentSocket().Role()
+	for _, f := range files {
+		name := f.Name
+		row, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+		row.SetMarginStart(6)
+		row.SetMarginEnd(6)
+		details := formatBytes(f.Size)
+		if at, err := time.Parse(time.RFC3339, f.DeletedAt); err == nil {
+			details += ", " + fmt.Sprintf(tr("deleted %s"), at.Local().Format("Jan 2 15:04"))
+		}
+		if who := a.auditActor(f.DeletedBy); who != "" {
+			details += " " + fmt.Sprintf(tr("by %s"), who)
+		}
+		label, _ := gtk.LabelNew(fmt.Sprintf("%s  (%s)", name, details))
+		label.SetXAlign(0)
+		label.SetEllipsize(pango.ELLIPSIZE_MIDDLE)
+		label.SetTooltipText(name)
+		row.PackStart(label, true, true, 0)
+		purgeBtn, _ := gtk.ButtonNewWithLabel(tr("Delete Forever"))
+		setAccessible(purgeBtn, fmt.Sprintf(tr("Delete %s forever"), name), "")
+		purgeBtn.Connect("clicked", func() {
+			if a.confirmDelete(fmt.Sprintf(tr("Delete %s for good?"), name)) {
+				go a.purgeTrash(name)
+			}
+		})
+		row.PackEnd(purgeBtn, false, false, 0)
+		restoreBtn, _ := gtk.ButtonNewWithLabel(tr("Restore"))
+		restoreBtn.SetTooltipText(tr("Put the file back under its old name"))
+		setAccessible(restoreBtn, fmt.Sprintf(tr("Restore %s"), name), "")
+		restoreBtn.Connect("clicked", func() { go a.restoreHubFiles([]string{name}, a.trashKept) })
+		row.PackEnd(restoreBtn, false, false, 0)
+		for action, btn := range map[string]*gtk.Button{"restore": restoreBtn, "purge": purgeBtn} {
+			if !role.Allows(action) {
+				btn.SetSensitive(false)
+				btn.SetTooltipText(roleTooltip(role))
+			}
+		}
+		a.trashList.Add(row)
+	}
+	a.trashList.ShowAll()
+}
+
+// purgeTrash deletes filename from the trash for good, or everything in
+// it when filename is "".
+func (a *app) purgeTrash(filename string) {
+	n, err := a.currentSocket().Purge(a.ctx, filename)
+	if err != nil {
+		a.reportError("purge", err, nil)
+		return
+	}
+	a.logf("purged %d file(s) from the hub's trash", n)
+	glib.IdleAdd(func() bool {
+		if filename == "" {
+			a.trashKept = localFileState{}
+		} else {
+			a.trashKept.drop(map[string]bool{filename: true})
+		}
+		return false
+	})
+	a.fetchTrash()
+	a.fetchStatus()
+}
+
+// setTrashAvailable offers the Files tab's Trash button only to hubs that
+// keep one.
+func (a *app) setTrashAvailable(ok bool) {
+	if a.filesView == nil {
+		return
+	}
+	a.filesView.trashBtn.SetSensitive(ok)
+	if ok {
+		a.filesView.trashBtn.SetTooltipText(tr("Restore or purge deleted files"))
+	} else {
+		a.filesView.trashBtn.SetTooltipText(tr("This hub deletes files at once; it has no trash"))
+	}
+}
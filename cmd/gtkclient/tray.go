@@ -0,0 +1,105 @@
+package main
+
+// #include <stdlib.h>
+// #include <gtk/gtk.h>
+//
+// extern GtkStatusIcon *brain_tray_new(const char *icon, const char *tooltip);
+// extern void brain_tray_set_icon(GtkStatusIcon *tray, const char *icon);
+// extern void brain_tray_popup_menu(GtkStatusIcon *tray, GtkMenu *menu, guint button, guint32 time);
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// trayApp receives tray clicks from C.
+var trayApp *app
+
+// trayIcon is the notification-area icon: a click shows the window and
+// the menu carries the chime mute toggle.
+type trayIcon struct {
+	icon *C.GtkStatusIcon
+	menu *gtk.Menu
+	mute *gtk.CheckMenuItem
+	// syncing is set while mute is updated from the action, so its
+	// toggled handler does not feed the change back.
+	syncing bool
+}
+
+func trayIconName(muted bool) string {
+	if muted {
+		return "audio-volume-muted-symbolic"
+	}
+	return "audio-volume-high-symbolic"
+}
+
+// startTray adds the tray icon. Must run on the GTK main loop.
+func (a *app) startTray() {
+	if a.tray != nil {
+		return
+	}
+	trayApp = a
+	menu, err := gtk.MenuNew()
+	if err != nil {
+		a.logf("tray unavailable: %v", err)
+		return
+	}
+	show, _ := gtk.MenuItemNewWithLabel(tr("Show Window"))
+	show.Connect("activate", func() { a.showWindow() })
+	menu.Append(show)
+	mute, _ := gtk.CheckMenuItemNewWithLabel(tr("Mute Chimes"))
+	mute.SetActive(a.chimesMuted())
+	menu.Append(mute)
+	sep, _ := gtk.SeparatorMenuItemNew()
+	menu.Append(sep)
+	quit, _ := gtk.MenuItemNewWithLabel(tr("Quit"))
+	quit.Connect("activate", func() { a.requestQuit() })
+	menu.Append(quit)
+	menu.ShowAll()
+
+	name := C.CString(trayIconName(a.chimesMuted()))
+	defer C.free(unsafe.Pointer(name))
+	tooltip := C.CString(tr("Brain Hub"))
+	defer C.free(unsafe.Pointer(tooltip))
+	t := &trayIcon{icon: C.brain_tray_new(name, tooltip), menu: menu, mute: mute}
+	mute.Connect("toggled", func() {
+		if !t.syncing {
+			a.setChimesMuted(mute.GetActive())
+		}
+	})
+	a.tray = t
+}
+
+// syncTrayMute shows the mute state on the tray icon and menu.
+func (a *app) syncTrayMute() {
+	t := a.tray
+	if t == nil {
+		return
+	}
+	muted := a.chimesMuted()
+	t.syncing = true
+	t.mute.SetActive(muted)
+	t.syncing = false
+	name := C.CString(trayIconName(muted))
+	defer C.free(unsafe.Pointer(name))
+	C.brain_tray_set_icon(t.icon, name)
+}
+
+//export brainTrayActivate
+func brainTrayActivate() {
+	if a := trayApp; a != nil {
+		a.showWindow()
+	}
+}
+
+//export brainTrayPopup
+func brainTrayPopup(button C.guint, activateTime C.guint32) {
+	a := trayApp
+	if a == nil || a.tray == nil {
+		return
+	}
+	t := a.tray
+	C.brain_tray_popup_menu(t.icon, (*C.GtkMenu)(unsafe.Pointer(t.menu.Native())), button, activateTime)
+}
@@ -0,0 +1,38 @@
+package main
+
+// C side of the tray icon. gotk3 only wraps GtkStatusIcon under the
+// gtk_deprecated build tag, and tray.go has //export, so it lives here.
+
+// #cgo pkg-config: gtk+-3.0
+// #include <gtk/gtk.h>
+//
+// extern void brainTrayActivate(void);
+// extern void brainTrayPopup(guint, guint32);
+//
+// static void brain_tray_activate(GtkStatusIcon *icon, gpointer data) {
+//   brainTrayActivate();
+// }
+//
+// static void brain_tray_popup(GtkStatusIcon *icon, guint button, guint32 time, gpointer data) {
+//   brainTrayPopup(button, time);
+// }
+//
+// G_GNUC_BEGIN_IGNORE_DEPRECATIONS
+// GtkStatusIcon *brain_tray_new(const char *icon, const char *tooltip) {
+//   GtkStatusIcon *tray = gtk_status_icon_new_from_icon_name(icon);
+//   gtk_status_icon_set_tooltip_text(tray, tooltip);
+//   gtk_status_icon_set_title(tray, tooltip);
+//   g_signal_connect(tray, "activate", G_CALLBACK(brain_tray_activate), NULL);
+//   g_signal_connect(tray, "popup-menu", G_CALLBACK(brain_tray_popup), NULL);
+//   return tray;
+// }
+//
+// void brain_tray_set_icon(GtkStatusIcon *tray, const char *icon) {
+//   gtk_status_icon_set_from_icon_name(tray, icon);
+// }
+//
+// void brain_tray_popup_menu(GtkStatusIcon *tray, GtkMenu *menu, guint button, guint32 time) {
+//   gtk_menu_popup(menu, NULL, NULL, gtk_status_icon_position_menu, tray, button, time);
+// }
+// G_GNUC_END_IGNORE_DEPRECATIONS
+import "C"
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+
+	"github.com/gotk3/gotk3/gdk"
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// urlImportMaxSize caps what Add from URL downloads.
+const urlImportMaxSize = 200 << 20
+
+var (
+	errImportCancelled = errors.New("import cancelled")
+	// errNotAudio is a download that turned out to be something else,
+	// usually the page a media player sits on
+	errNotAudio = errors.New("not audio")
+)
+
+// importExtensions name files whose URL gives no audio extension.
+var importExtensions = map[string]string{
+	"audio/mpeg":      ".mp3",
+	"audio/mp3":       ".mp3",
+	"audio/wav":       ".wav",
+	"audio/wave":      ".wav",
+	"audio/x-wav":     ".wav",
+	"audio/ogg":       ".ogg",
+	"application/ogg": ".ogg",
+	"audio/opus":      ".opus",
+	"audio/flac":      ".flac",
+	"audio/x-flac":    ".flac",
+	"audio/mp4":       ".m4a",
+	"audio/x-m4a":     ".m4a",
+	"audio/webm":      ".webm",
+}
+
+// showAddFromURL asks for an audio URL and the name to upload it as, then
+// downloads and uploads it.
+func (a *app) showAddFromURL() {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		a.logf("add from URL dialog error: %v", err)
+		return
+	}
+	dialog.SetTitle(tr("Add from URL"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetDefaultSize(480, -1)
+	dialog.AddButton(tr("Cancel"), gtk.RESPONSE_CANCEL)
+	addBtn, _ := dialog.AddButton(tr("Add"), gtk.RESPONSE_OK)
+	dialog.SetDefaultResponse(gtk.RESPONSE_OK)
+	content, _ := dialog.GetContentArea()
+	content.SetBorderWidth(8)
+	grid, _ := gtk.GridNew()
+	grid.SetRowSpacing(6)
+	grid.SetColumnSpacing(6)
+	content.PackStart(grid, true, true, 0)
+
+	urlEntry, _ := gtk.EntryNew()
+	urlEntry.SetPlaceholderText("https://example.com/doorbell.mp3")
+	urlEntry.SetHExpand(true)
+	urlEntry.SetActivatesDefault(true)
+	grid.Attach(mnemonicLabel(tr("_URL:"), urlEntry), 0, 0, 1, 1)
+	grid.Attach(urlEntry, 1, 0, 1, 1)
+	nameEntry, _ := gtk.EntryNew()
+	nameEntry.SetActivatesDefault(true)
+	grid.Attach(mnemonicLabel(tr("Remote _name:"), nameEntry), 0, 1, 1, 1)
+	grid.Attach(nameEntry, 1, 1, 1, 1)
+	folderEntry, _ := gtk.EntryNew()
+	folderEntry.SetPlaceholderText(tr("folder (optional)"))
+	folderEntry.SetActivatesDefault(true)
+	if a.uploadFolderEntry != nil {
+		folder, _ := a.uploadFolderEntry.GetText()
+		folderEntry.SetText(folder)
+	}
+	grid.Attach(mnemonicLabel(tr("_Folder:"), folderEntry), 0, 2, 1, 1)
+	grid.Attach(folderEntry, 1, 2, 1, 1)
+	extractCheck, _ := gtk.CheckButtonNewWithMnemonic(tr("_Extract the audio from a media page"))
+	downloader, canExtract := a.downloaderCommand()
+	extractCheck.SetSensitive(canExtract)
+	if canExtract {
+		extractCheck.SetTooltipText(fmt.Sprintf(tr("For video and podcast pages; runs %s"), strings.Join(downloader, " ")))
+	} else {
+		extractCheck.SetTooltipText(tr("Install yt-dlp or set a media downloader in Preferences"))
+	}
+	grid.Attach(extractCheck, 1, 3, 1, 1)
+	note, _ := gtk.LabelNew(fmt.Sprintf(tr("HTTP and HTTPS audio files up to %s"), formatBytes(urlImportMaxSize)))
+	note.SetXAlign(0)
+	addStyleClass(note, "dim-label")
+	grid.Attach(note, 1, 4, 1, 1)
+
+	// the check follows the URL until it is clicked
+	extractChosen, following := false, false
+	extractCheck.Connect("toggled", func() { extractChosen = extractChosen || !following })
+	urlEntry.Connect("changed", func() {
+		raw, _ := urlEntry.GetText()
+		u, err := parseImportURL(raw)
+		addBtn.SetSensitive(err == nil)
+		if err != nil {
+			nameEntry.SetPlaceholderText(tr("from the URL"))
+			return
+		}
+		if canExtract && !extractChosen {
+			following = true
+			extractCheck.SetActive(!strings.HasPrefix(hubclient.ContentType(u.Path), "audio/"))
+			following = false
+		}
+		if extractCheck.GetActive() {
+			nameEntry.SetPlaceholderText(tr("from the media's title"))
+		} else {
+			nameEntry.SetPlaceholderText(importName(u, ""))
+		}
+	})
+	addBtn.SetSensitive(false)
+	// a URL just copied is the likely one
+	if clip, err := gtk.ClipboardGet(gdk.SELECTION_CLIPBOARD); err == nil {
+		if text, err := clip.WaitForText(); err == nil {
+			if _, err := parseImportURL(text); err == nil {
+				urlEntry.SetText(strings.TrimSpace(text))
+			}
+		}
+	}
+
+	dialog.ShowAll()
+	response := dialog.Run()
+	raw, _ := urlEntry.GetText()
+	remote, _ := nameEntry.GetText()
+	folder, _ := folderEntry.GetText()
+	extract := extractCheck.GetActive()
+	dialog.Destroy()
+	if response != gtk.RESPONSE_OK {
+		return
+	}
+	opts := a.currentUploadOptions()
+	opts.Folder = folder
+	go a.importURL(strings.TrimSpace(raw), strings.TrimSpace(remote), opts, extract)
+}
+
+// parseImportURL accepts absolute http and https URLs.
+func parseImportURL(raw string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%s is not an http or https URL", raw)
+	}
+	return u, nil
+}
+
+// importURL downloads an audio URL behind a progress dialog and uploads it
+// like a chosen file, named remote or else after the download. With
+// extract, or when the URL turns out to be a page, the media downloader
+// fetches the audio instead.
+func (a *app) importURL(raw, remote string, opts uploadOptions, extract bool) {
+	opCtx, done := a.startOp("upload")
+	ctx, cancel := context.WithCancelCause(opCtx)
+	p := &bulkProgress{}
+	glib.IdleAdd(func() bool {
+		p.open(a.win, tr("Add from URL"), func() { cancel(errImportCancelled) })
+		p.label.SetText(raw)
+		p.bar.SetPulseStep(0.1)
+		return false
+	})
+	var last time.Time
+	// show sets the bar, or pulses it for a negative fraction
+	show := func(text string, fraction float64, final bool) {
+		if time.Since(last) < 100*time.Millisecond && !final {
+			return
+		}
+		last = time.Now()
+		glib.IdleAdd(func() bool {
+			if fraction >= 0 {
+				p.bar.SetFraction(fraction)
+			} else {
+				p.bar.Pulse()
+			}
+			p.bar.SetText(text)
+			return false
+		})
+	}
+	var local, name string
+	var err error
+	if !extract {
+		local, name, err = a.fetchURLAudio(ctx, raw, func(n, total int64) {
+			if total > 0 {
+				show(fmt.Sprintf(tr("%s of %s"), formatBytes(n), formatBytes(total)), float64(n)/float64(total), n == total)
+			} else {
+				show(formatBytes(n), -1, false)
+			}
+		})
+		if _, ok := a.downloaderCommand(); ok && errors.Is(err, errNotAudio) {
+			a.logf("%v; trying the media downloader", err)
+			extract = true
+		}
+	}
+	if extract {
+		glib.IdleAdd(func() bool {
+			p.label.SetText(fmt.Sprintf(tr("Extracting the audio from %s"), raw))
+			return false
+		})
+		local, name, opts.Meta, err = a.extractURLAudio(ctx, raw, func(fraction float64) {
+			if fraction >= 0 {
+				show(fmt.Sprintf("%.0f%%", fraction*100), fraction, fraction == 1)
+			} else {
+				show(tr("Converting…"), -1, false)
+			}
+		})
+	}
+	glib.IdleAdd(func() bool {
+		p.dialog.Destroy()
+		return false
+	})
+	cancelled := context.Cause(ctx) == errImportCancelled
+	cancel(nil)
+	done()
+	if err != nil {
+		if cancelled {
+			a.logf("import of %s cancelled", raw)
+			return
+		}
+		a.reportError("import", err, func() { a.importURL(raw, remote, opts, extract) })
+		return
+	}
+	defer a.releaseTranscoded(local)
+	if remote == "" {
+		remote = name
+	}
+	a.logf("downloaded %s for upload as %s", raw, remote)
+	a.runUpload(local, remote, opts)
+}
+
+// fetchURLAudio downloads raw into the upload cache, refusing anything
+// that is not audio or is over urlImportMaxSize. It returns the file and
+// the name the server gave it.
+func (a *app) fetchURLAudio(ctx context.Context, raw string, progress func(n, total int64)) (string, string, error) {
+	u, err := parseImportURL(raw)
+	if err != nil {
+		return "", "", err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", "", err
+	}
+	req.Header.Set("Accept", "audio/*")
+	resp, err := archiveHTTPClient.Do(req)
+	if err != nil {
+		return "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("%s: %s", raw, resp.Status)
+	}
+	if resp.ContentLength > urlImportMaxSize {
+		return "", "", fmt.Errorf("%s is %s, over the %s limit", raw, formatBytes(resp.ContentLength), formatBytes(urlImportMaxSize))
+	}
+	// the name comes from where any redirects ended up
+	name := importName(resp.Request.URL, resp.Header.Get("Content-Disposition"))
+	name, err = checkImportType(name, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", raw, err)
+	}
+	dir, err := transcodeDir()
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", "", err
+	}
+	f, err := os.CreateTemp(dir, "*"+path.Ext(name))
+	if err != nil {
+		return "", "", err
+	}
+	var n int64
+	buf := make([]byte, 64<<10)
+	body := io.LimitReader(resp.Body, urlImportMaxSize+1)
+	for {
+		m, rerr := body.Read(buf)
+		if m > 0 {
+			if _, err = f.Write(buf[:m]); err != nil {
+				break
+			}
+			n += int64(m)
+			progress(n, resp.ContentLength)
+		}
+		if rerr != nil {
+			if !errors.Is(rerr, io.EOF) {
+				err = rerr
+			}
+			break
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil && n > urlImportMaxSize {
+		err = fmt.Errorf("%s is over the %s limit", raw, formatBytes(urlImportMaxSize))
+	}
+	if err == nil && n == 0 {
+		err = fmt.Errorf("%s is empty", raw)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", "", err
+	}
+	a.recordTransfer("download", "url", n)
+	return f.Name(), name, nil
+}
+
+// importName is the file name a download goes by: the server's
+// Content-Disposition filename, or else the last part of the URL path.
+func importName(u *url.URL, disposition string) string {
+	name := ""
+	if _, params, err := mime.ParseMediaType(disposition); err == nil {
+		name = params["filename"]
+	}
+	if name == "" {
+		name = path.Base(u.Path)
+	}
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || name == "/" || strings.HasPrefix(name, ".") {
+		name = "download" + name
+	}
+	return name
+}
+
+// checkImportType refuses downloads that are not audio, such as an HTML
+// page where a file was expected, and gives name an extension matching
+// the content when it lacks one.
+func checkImportType(name, contentType string) (string, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	audioName := strings.HasPrefix(hubclient.ContentType(name), "audio/")
+	switch {
+	case strings.HasPrefix(mediaType, "audio/") || mediaType == "application/ogg":
+		if audioName {
+			return name, nil
+		}
+		if ext, ok := importExtensions[mediaType]; ok {
+			return name + ext, nil
+		}
+		if exts, _ := mime.ExtensionsByType(mediaType); len(exts) > 0 {
+			return name + exts[0], nil
+		}
+		return name, nil
+	case audioName && (mediaType == "" || mediaType == "application/octet-stream" || mediaType == "binary/octet-stream"):
+		// plain file servers send no better type
+		return name, nil
+	case mediaType == "":
+		return "", fmt.Errorf("%w: the server gave no content type", errNotAudio)
+	}
+	return "", fmt.Errorf("%w: the server sent %s", errNotAudio, mediaType)
+}
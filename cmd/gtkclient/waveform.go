@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+const (
+	waveformBars    = 60
+	waveformWidth   = waveformBars * 3
+	waveformHeight  = 28
+	waveformRate    = 8000
+	waveformTimeout = 2 * time.Minute
+	// waveformMaxBlocks bounds the peaks kept while decoding; past it,
+	// neighbouring blocks are merged so any length fits in fixed memory.
+	waveformMaxBlocks = 4096
+)
+
+var (
+	waveformColor = color.NRGBA{R: 0x88, G: 0x88, B: 0x88, A: 0xFF}
+	// one decoder at a time; a batch of uploads should not pin every core
+	waveformSlot = make(chan struct{}, 1)
+)
+
+// waveformPath is where the thumbnail for a hub file is cached. Files are
+// keyed by profile as well as name, since two hubs may both have a
+// "doorbell.mp3".
+func (a *app) waveformPath(filename string) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(a.profileName() + "\x00" + filename))
+	return filepath.Join(dir, configDirName, "waveforms", hex.EncodeToString(sum[:16])+".png"), nil
+}
+
+// cachedWaveform returns the cached thumbnail for filename, or "".
+func (a *app) cachedWaveform(filename string) string {
+	path, err := a.waveformPath(filename)
+	if err != nil {
+		return ""
+	}
+	if _, err := os.Stat(path); err != nil {
+		return ""
+	}
+	return path
+}
+
+// cacheWaveform renders the thumbnail for local, a copy of the hub file
+// filename, and redraws the audio buttons to show it.
+func (a *app) cacheWaveform(local, filename string) {
+	if !strings.HasPrefix(hubclient.ContentType(filename), "audio/") {
+		return
+	}
+	target, err := a.waveformPath(filename)
+	if err != nil {
+		a.logf("waveform error: %v", err)
+		return
+	}
+	select {
+	case waveformSlot <- struct{}{}:
+	case <-a.ctx.Done():
+		return
+	}
+	peaks, err := decodePeaks(a.ctx, local, waveformBars)
+	<-waveformSlot
+	if err != nil {
+		if errors.Is(err, exec.ErrNotFound) {
+			a.logf("waveform skipped for %s: gst-launch-1.0 is not installed", filename)
+		} else {
+			a.logf("waveform error for %s: %v", filename, err)
+		}
+		return
+	}
+	if err := writeWaveform(target, peaks); err != nil {
+		a.logf("waveform save error: %v", err)
+		return
+	}
+	glib.IdleAdd(func() bool {
+		if a.audioFiles != nil {
+			a.refreshAudioButtons(a.audioFiles, "")
+		}
+		return false
+	})
+}
+
+// decodePeaks decodes path to mono PCM with GStreamer and returns the
+// loudest sample of each of n equal slices, scaled to 0..1.
+func decodePeaks(ctx context.Context, path string, n int) ([]float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, waveformTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, "gst-launch-1.0", "-q",
+		"filesrc", "location="+path, "!", "decodebin", "!", "audioconvert", "!", "audioresample", "!",
+		fmt.Sprintf("audio/x-raw,format=S16LE,rate=%d,channels=1", waveformRate),
+		"!", "fdsink", "fd=1")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	blocks, readErr := readPeaks(stdout, waveformRate/10)
+	if err := cmd.Wait(); err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	if len(blocks) == 0 {
+		return nil, fmt.Errorf("no audio decoded")
+	}
+	return resamplePeaks(blocks, n), nil
+}
+
+// readPeaks reads S16LE samples and keeps the peak of every block of
+// samples, doubling the block size whenever waveformMaxBlocks is reached.
+func readPeaks(r io.Reader, block int) ([]float64, error) {
+	var blocks []float64
+	peak, count := 0.0, 0
+	buf := make([]byte, 8192)
+	for {
+		n, err := io.ReadFull(r, buf)
+		for i := 0; i+1 < n; i += 2 {
+			v := float64(int16(binary.LittleEndian.Uint16(buf[i:]))) / 32768
+			peak = max(peak, v, -v)
+			count++
+			if count < block {
+				continue
+			}
+			blocks = append(blocks, peak)
+			peak, count = 0, 0
+			if len(blocks) == waveformMaxBlocks {
+				for j := 0; j < len(blocks)/2; j++ {
+					blocks[j] = max(blocks[2*j], blocks[2*j+1])
+				}
+				blocks = blocks[:len(blocks)/2]
+				block *= 2
+			}
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if count > 0 {
+		blocks = append(blocks, peak)
+	}
+	return blocks, nil
+}
+
+// resamplePeaks reduces or stretches blocks to n peaks, normalised so the
+// loudest is 1.
+func resamplePeaks(blocks []float64, n int) []float64 {
+	peaks := make([]float64, n)
+	loudest := 0.0
+	for i := range peaks {
+		lo := i * len(blocks) / n
+		hi := (i + 1) * len(blocks) / n
+		if hi <= lo {
+			hi = lo + 1
+		}
+		for _, v := range blocks[lo:hi] {
+			peaks[i] = max(peaks[i], v)
+		}
+		loudest = max(loudest, peaks[i])
+	}
+	if loudest > 0 {
+		for i := range peaks {
+			peaks[i] /= loudest
+		}
+	}
+	return peaks
+}
+
+// renderWaveform draws peaks as bars mirrored around the middle line.
+func renderWaveform(peaks []float64) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, waveformWidth, waveformHeight))
+	mid := waveformHeight / 2
+	for i, p := range peaks {
+		half := int(p*float64(mid-1)) + 1
+		for x := i * 3; x < i*3+2 && x < waveformWidth; x++ {
+			for y := mid - half; y < mid+half; y++ {
+				img.SetNRGBA(x, y, waveformColor)
+			}
+		}
+	}
+	return img
+}
+
+func writeWaveform(path string, peaks []float64) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".waveform-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	err = png.Encode(tmp, renderWaveform(peaks))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// newAudioButton is a button showing label, with the waveform thumbnail
+// above it when one is cached.
+func newAudioButton(label, waveform string) (*gtk.Button, error) {
+	if waveform == "" {
+		return gtk.ButtonNewWithLabel(label)
+	}
+	btn, err := gtk.ButtonNew()
+	if err != nil {
+		return nil, err
+	}
+	box, err := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 2)
+	if err != nil {
+		return nil, err
+	}
+	if img, err := gtk.ImageNewFromFile(waveform); err == nil {
+		box.PackStart(img, false, false, 0)
+	}
+	text, err := gtk.LabelNew(label)
+	if err != nil {
+		return nil, err
+	}
+	box.PackStart(text, false, false, 0)
+	btn.Add(box)
+	return btn, nil
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"brain/internal/hubclient"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// webhookTimeout bounds one delivery.
+const webhookTimeout = 10 * time.Second
+
+var webhookHTTPClient = &http.Client{Timeout: webhookTimeout}
+
+// webhookEvents are offered in the editor; any socket event name works.
+// peer-joined and peer-left come from the hub's client-joined and
+// client-left messages.
+var webhookEvents = []string{"peer-joined", "peer-left", "disconnect", "hub-message", "broadcast-play", "clipboard", "kv"}
+
+const defaultWebhookBody = `{"event": {{json .Event}}, "text": {{json .Text}}, "profile": {{json .Profile}}, "time": {{json .Time}}}`
+
+// webhookRule posts a templated body to URL when Event happens and, if
+// Match is set, the event's text matches it.
+type webhookRule struct {
+	Event string `json:"event"`
+	// Match is a regular expression tested against the event text.
+	Match  string `json:"match,omitempty"`
+	URL    string `json:"url"`
+	Method string `json:"method,omitempty"`
+	// Headers are sent as given; Content-Type defaults to JSON.
+	Headers map[string]string `json:"headers,omitempty"`
+	// Body is a text/template over webhookData; json quotes a value.
+	Body     string `json:"body,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+}
+
+// webhookData is what a body template sees.
+type webhookData struct {
+	Event   string
+	Time    string
+	Profile string
+	Hub     string
+	// Text is the message of a hub-message, the error of a disconnect,
+	// the peer id of peer-joined and peer-left, else the payload as JSON.
+	Text    string
+	Peer    string
+	Payload any
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+// compile checks the rule and returns its matcher and template.
+func (r *webhookRule) compile() (*regexp.Regexp, *template.Template, error) {
+	if r.Event == "" {
+		return nil, nil, fmt.Errorf("event is required")
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, nil, fmt.Errorf("URL must be an http or https URL")
+	}
+	var re *regexp.Regexp
+	if r.Match != "" {
+		if re, err = regexp.Compile(r.Match); err != nil {
+			return nil, nil, fmt.Errorf("match: %w", err)
+		}
+	}
+	body := r.Body
+	if body == "" {
+		body = defaultWebhookBody
+	}
+	tmpl, err := template.New("body").Funcs(webhookFuncs).Parse(body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("body: %w", err)
+	}
+	return re, tmpl, nil
+}
+
+func (r *webhookRule) contentType() string {
+	for k, v := range r.Headers {
+		if strings.EqualFold(k, "Content-Type") {
+			return v
+		}
+	}
+	return "application/json"
+}
+
+// webhookEventsFor names the rule events msg stands for: its own name and,
+// for peer announcements, peer-joined or peer-left.
+func webhookEventsFor(msg hubclient.Message) (webhookData, []string) {
+	data := webhookData{Event: msg.Event, Time: time.Now().UTC().Format(time.RFC3339)}
+	names := []string{msg.Event}
+	if msg.Event == "disconnect" {
+		if msg.Error != nil {
+			data.Text = msg.Error.Error()
+		}
+		return data, names
+	}
+	raw := msg.JSONPayload()
+	_ = json.Unmarshal(raw, &data.Payload)
+	data.Text = string(raw)
+	if msg.Event != "hub-message" {
+		return data, names
+	}
+	outer, _ := data.Payload.(map[string]any)
+	switch inner := outer["message"].(type) {
+	case string:
+		data.Text = inner
+	case map[string]any:
+		if text, ok := inner["message"].(string); ok {
+			data.Text = text
+		}
+		client, _ := inner["client"].(map[string]any)
+		peer, _ := client["id"].(string)
+		switch inner["type"] {
+		case "client-joined":
+			names = append(names, "peer-joined")
+			data.Peer, data.Text = peer, peer
+		case "client-left":
+			names = append(names, "peer-left")
+			data.Peer, data.Text = peer, peer
+		}
+	}
+	return data, names
+}
+
+// fireWebhooks runs the rules matching an event from the socket.
+func (a *app) fireWebhooks(msg hubclient.Message) {
+	if msg.Type != "event" {
+		return
+	}
+	data, names := webhookEventsFor(msg)
+	glib.IdleAdd(func() bool {
+		if len(a.profile().Webhooks) == 0 {
+			return false
+		}
+		data.Profile = a.profileName()
+		a.hubMu.Lock()
+		data.Hub = a.hubHost
+		a.hubMu.Unlock()
+		for _, event := range names {
+			for name, rule := range a.profile().Webhooks {
+				if rule.Disabled || rule.Event != event {
+					continue
+				}
+				re, tmpl, err := rule.compile()
+				if err != nil {
+					a.logf("webhook %s: %v", name, err)
+					continue
+				}
+				if re != nil && !re.MatchString(data.Text) {
+					continue
+				}
+				d := data
+				d.Event = event
+				name, rule := name, *rule
+				go func() {
+					if err := a.postWebhook(rule, tmpl, d); err != nil {
+						a.logf("webhook %s (%s): %v", name, event, err)
+						return
+					}
+					a.logf("webhook %s sent for %s", name, event)
+				}()
+			}
+		}
+		return false
+	})
+}
+
+func (a *app) postWebhook(rule webhookRule, tmpl *template.Template, data webhookData) error {
+	var body bytes.Buffer
+	if err := tmpl.Execute(&body, data); err != nil {
+		return err
+	}
+	contentType := rule.contentType()
+	if strings.Contains(contentType, "json") && !json.Valid(body.Bytes()) {
+		return fmt.Errorf("body is not valid JSON: %s", body.String())
+	}
+	method := rule.Method
+	if method == "" {
+		method = http.MethodPost
+	}
+	req, err := http.NewRequestWithContext(a.ctx, method, rule.URL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for k, v := range rule.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := webhookHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+// parseHeaders reads one "Name: value" header per line.
+func parseHeaders(text string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("header line %d: want \"Name: value\"", i+1)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	return headers, nil
+}
+
+func formatHeaders(headers map[string]string) string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	lines := make([]string, len(names))
+	for i, name := range names {
+		lines[i] = name + ": " + headers[name]
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (a *app) webhookNames() []string {
+	names := make([]string, 0, len(a.profile().Webhooks))
+	for name := range a.profile().Webhooks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// showWebhooks edits the current profile's webhook rules.
+func (a *app) showWebhooks() {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		a.logf("webhooks dialog error: %v", err)
+		return
+	}
+	dialog.SetTitle(tr("Webhooks"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetDefaultSize(560, 480)
+	dialog.AddButton(tr("Close"), gtk.RESPONSE_CLOSE)
+	dialog.Connect("response", func() { dialog.Destroy() })
+
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.SetBorderWidth(8)
+
+	pickBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	content.PackStart(pickBox, false, false, 0)
+	combo, _ := gtk.ComboBoxTextNew()
+	setAccessible(combo, tr("Saved webhooks"), "")
+	pickBox.PackStart(combo, true, true, 0)
+	testBtn, _ := gtk.ButtonNewWithLabel(tr("Send Test"))
+	testBtn.SetTooltipText(tr("Post the rule once with sample data"))
+	pickBox.PackStart(testBtn, false, false, 0)
+	deleteBtn, _ := gtk.ButtonNewWithLabel(tr("Delete"))
+	pickBox.PackStart(deleteBtn, false, false, 0)
+
+	grid, _ := gtk.GridNew()
+	grid.SetRowSpacing(6)
+	grid.SetColumnSpacing(8)
+	content.PackStart(grid, false, false, 0)
+	nameEntry, _ := gtk.EntryNew()
+	nameEntry.SetPlaceholderText(tr("rule name, e.g. slack peers"))
+	eventCombo, _ := gtk.ComboBoxTextNewWithEntry()
+	for _, event := range webhookEvents {
+		eventCombo.AppendText(event)
+	}
+	eventCombo.SetActive(0)
+	matchEntry, _ := gtk.EntryNew()
+	matchEntry.SetPlaceholderText(tr("optional regular expression, e.g. (?i)doorbell"))
+	urlEntry, _ := gtk.EntryNew()
+	urlEntry.SetPlaceholderText("https://hooks.slack.com/services/…")
+	methodCombo, _ := gtk.ComboBoxTextNew()
+	for _, m := range []string{http.MethodPost, http.MethodPut} {
+		methodCombo.Append(m, m)
+	}
+	methodCombo.SetActiveID(http.MethodPost)
+	enabledCheck, _ := gtk.CheckButtonNewWithMnemonic(tr("_Enabled"))
+	enabledCheck.SetActive(true)
+	for i, row := range []struct {
+		label  string
+		widget gtk.IWidget
+	}{
+		{tr("_Name:"), nameEntry},
+		{tr("_Event:"), eventCombo},
+		{tr("_Match:"), matchEntry},
+		{tr("_URL:"), urlEntry},
+		{tr("Me_thod:"), methodCombo},
+	} {
+		grid.Attach(mnemonicLabel(row.label, row.widget), 0, i, 1, 1)
+		if w, ok := row.widget.(interface{ SetHExpand(bool) }); ok {
+			w.SetHExpand(true)
+		}
+		grid.Attach(row.widget, 1, i, 1, 1)
+	}
+	grid.Attach(enabledCheck, 1, 5, 1, 1)
+
+	headersLabel, _ := gtk.LabelNewWithMnemonic(tr("_Headers (one \"Name: value\" per line):"))
+	headersLabel.SetXAlign(0)
+	content.PackStart(headersLabel, false, false, 0)
+	headersView, _ := gtk.TextViewNew()
+	headersView.SetMonospace(true)
+	headersLabel.SetMnemonicWidget(headersView)
+	headersBuf, _ := headersView.GetBuffer()
+	content.PackStart(headersView, false, false, 0)
+
+	bodyLabel, _ := gtk.LabelNewWithMnemonic(tr("_Body template ({{.Event}}, {{.Text}}, {{.Peer}}, {{.Profile}}, {{.Hub}}, {{.Time}}; {{json .Text}} quotes a value):"))
+	bodyLabel.SetXAlign(0)
+	bodyLabel.SetLineWrap(true)
+	content.PackStart(bodyLabel, false, false, 0)
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetVExpand(true)
+	content.PackStart(scroll, true, true, 0)
+	bodyView, _ := gtk.TextViewNew()
+	bodyView.SetMonospace(true)
+	bodyView.SetWrapMode(gtk.WRAP_WORD_CHAR)
+	scroll.Add(bodyView)
+	bodyLabel.SetMnemonicWidget(bodyView)
+	bodyBuf, _ := bodyView.GetBuffer()
+	bodyBuf.SetText(defaultWebhookBody)
+
+	saveBtn, _ := gtk.ButtonNewWithLabel(tr("Save Rule"))
+	content.PackStart(saveBtn, false, false, 0)
+
+	// form reads the editor into a rule and checks it.
+	form := func() (string, *webhookRule, error) {
+		name, _ := nameEntry.GetText()
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return "", nil, fmt.Errorf("name is required")
+		}
+		event := strings.TrimSpace(eventCombo.GetActiveText())
+		match, _ := matchEntry.GetText()
+		target, _ := urlEntry.GetText()
+		headersText, _ := headersBuf.GetText(headersBuf.GetStartIter(), headersBuf.GetEndIter(), false)
+		headers, err := parseHeaders(headersText)
+		if err != nil {
+			return "", nil, err
+		}
+		body, _ := bodyBuf.GetText(bodyBuf.GetStartIter(), bodyBuf.GetEndIter(), false)
+		if strings.TrimSpace(body) == defaultWebhookBody {
+			body = ""
+		}
+		rule := &webhookRule{
+			Event:    event,
+			Match:    match,
+			URL:      strings.TrimSpace(target),
+			Method:   methodCombo.GetActiveID(),
+			Headers:  headers,
+			Body:     body,
+			Disabled: !enabledCheck.GetActive(),
+		}
+		if rule.Method == http.MethodPost {
+			rule.Method = ""
+		}
+		if _, _, err := rule.compile(); err != nil {
+			return "", nil, err
+		}
+		return name, rule, nil
+	}
+	refresh := func(active string) {
+		combo.RemoveAll()
+		for _, name := range a.webhookNames() {
+			combo.Append(name, name)
+		}
+		if active != "" {
+			combo.SetActiveID(active)
+		}
+	}
+	combo.Connect("changed", func() {
+		name := combo.GetActiveID()
+		r := a.profile().Webhooks[name]
+		if r == nil {
+			return
+		}
+		nameEntry.SetText(name)
+		if entry, err := eventCombo.GetEntry(); err == nil {
+			entry.SetText(r.Event)
+		}
+		matchEntry.SetText(r.Match)
+		urlEntry.SetText(r.URL)
+		if r.Method == "" {
+			methodCombo.SetActiveID(http.MethodPost)
+		} else {
+			methodCombo.SetActiveID(r.Method)
+		}
+		enabledCheck.SetActive(!r.Disabled)
+		headersBuf.SetText(formatHeaders(r.Headers))
+		if r.Body == "" {
+			bodyBuf.SetText(defaultWebhookBody)
+		} else {
+			bodyBuf.SetText(r.Body)
+		}
+	})
+	saveBtn.Connect("clicked", func() {
+		name, rule, err := form()
+		if err != nil {
+			a.reportError("save webhook", err, nil)
+			return
+		}
+		a.updateProfile(func(p *profileConfig) {
+			if p.Webhooks == nil {
+				p.Webhooks = make(map[string]*webhookRule)
+			}
+			p.Webhooks[name] = rule
+		})
+		if err := a.config.save(); err != nil {
+			a.reportError("save webhook", err, nil)
+			return
+		}
+		a.logf("webhook %s saved: %s -> %s", name, rule.Event, rule.URL)
+		refresh(name)
+	})
+	deleteBtn.Connect("clicked", func() {
+		name := combo.GetActiveID()
+		if name == "" {
+			return
+		}
+		a.updateProfile(func(p *profileConfig) { delete(p.Webhooks, name) })
+		if err := a.config.save(); err != nil {
+			a.logf("config save error: %v", err)
+		}
+		a.logf("webhook %s deleted", name)
+		refresh("")
+	})
+	testBtn.Connect("clicked", func() {
+		name, rule, err := form()
+		if err != nil {
+			a.reportError("test webhook", err, nil)
+			return
+		}
+		_, tmpl, _ := rule.compile()
+		data := webhookData{
+			Event:   rule.Event,
+			Time:    time.Now().UTC().Format(time.RFC3339),
+			Profile: a.profileName(),
+			Text:    "test from the brain client",
+			Peer:    "test-peer",
+		}
+		a.hubMu.Lock()
+		data.Hub = a.hubHost
+		a.hubMu.Unlock()
+		go func() {
+			if err := a.postWebhook(*rule, tmpl, data); err != nil {
+				a.reportError("test webhook "+name, err, nil)
+				return
+			}
+			a.logf("webhook %s test sent", name)
+		}()
+	})
+
+	refresh("")
+	dialog.ShowAll()
+}
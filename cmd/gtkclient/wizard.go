@@ -0,0 +1,292 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// probeTimeout bounds each stage of the connection test.
+const probeTimeout = 4 * time.Second
+
+// Connection test stages, in the order they run.
+const (
+	probeDNS = iota
+	probeTCP
+	probeHandshake
+	probeAuth
+	probeStages
+)
+
+func probeStageTitle(stage int) string {
+	switch stage {
+	case probeDNS:
+		return tr("Resolve host name")
+	case probeTCP:
+		return tr("Open socket connection")
+	case probeHandshake:
+		return tr("Protocol handshake")
+	default:
+		return tr("Authorization")
+	}
+}
+
+// probeHub walks the stages of connecting to the hub behind control, via
+// proxy when set, and reports each one as it finishes. It stops at the
+// first failure and returns it.
+func probeHub(ctx context.Context, control *url.URL, proxy func(addr string) string, report func(stage int, err error, detail string)) error {
+	host := control.Hostname()
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	addr, err := hubclient.SocketAddress(control)
+	if err != nil {
+		report(probeDNS, err, "")
+		return err
+	}
+	via := proxy(addr)
+	if via != "" {
+		report(probeDNS, nil, fmt.Sprintf(tr("left to the proxy %s"), via))
+	} else {
+		stageCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+		addrs, err := net.DefaultResolver.LookupHost(stageCtx, host)
+		cancel()
+		if err != nil {
+			report(probeDNS, err, "")
+			return err
+		}
+		report(probeDNS, nil, strings.Join(addrs, ", "))
+	}
+
+	client, err := hubclient.DialProxy(addr, via, nil)
+	if err != nil {
+		report(probeTCP, err, addr)
+		return err
+	}
+	defer client.Close()
+	report(probeTCP, nil, addr)
+
+	stageCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	hello := client.WaitHello(stageCtx)
+	cancel()
+	if hello == nil {
+		err := errors.New("the hub did not say hello; is this a brain hub socket?")
+		report(probeHandshake, err, "")
+		return err
+	}
+	detail := hello.String()
+	if warn := hello.Compatibility(); warn != "" {
+		detail += "; " + warn
+	}
+	report(probeHandshake, nil, detail)
+
+	stageCtx, cancel = context.WithTimeout(ctx, probeTimeout)
+	_, err = client.Status(stageCtx)
+	cancel()
+	if err != nil {
+		report(probeAuth, err, "")
+		return err
+	}
+	role := hello.Role
+	if role == "" {
+		role = protocol.RoleAdmin
+	}
+	report(probeAuth, nil, fmt.Sprintf(tr("role %s"), role))
+	return nil
+}
+
+type probeRow struct {
+	icon   *gtk.Image
+	detail *gtk.Label
+}
+
+// runWizard asks for the hub on first run, lets the user test the
+// connection stage by stage and saves it as a profile. Skipping keeps the
+// default hub for this run only. Must run on the GTK main loop.
+func (a *app) runWizard() {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		return
+	}
+	dialog.SetTitle(tr("Connect to a hub"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetModal(true)
+	dialog.SetDefaultSize(480, -1)
+	dialog.AddButton(tr("Skip"), gtk.RESPONSE_CANCEL)
+	dialog.AddButton(tr("Save and Connect"), gtk.RESPONSE_ACCEPT)
+	dialog.SetDefaultResponse(gtk.RESPONSE_ACCEPT)
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(8)
+	content.SetMarginStart(12)
+	content.SetMarginEnd(12)
+	content.SetMarginTop(12)
+
+	intro, _ := gtk.LabelNew(tr("No hub is configured yet. Enter where the hub runs, test the connection and save it as a profile."))
+	intro.SetLineWrap(true)
+	intro.SetXAlign(0)
+	content.PackStart(intro, false, false, 0)
+
+	grid, _ := gtk.GridNew()
+	grid.SetRowSpacing(6)
+	grid.SetColumnSpacing(8)
+	content.PackStart(grid, false, false, 0)
+	nameEntry, _ := gtk.EntryNew()
+	nameEntry.SetText(a.profileName())
+	nameEntry.SetHExpand(true)
+	grid.Attach(mnemonicLabel(tr("_Profile name:"), nameEntry), 0, 0, 1, 1)
+	grid.Attach(nameEntry, 1, 0, 1, 1)
+	hostEntry, _ := gtk.EntryNew()
+	hostEntry.SetText(a.controlURL().Hostname())
+	hostEntry.SetPlaceholderText("127.0.0.1")
+	hostEntry.SetActivatesDefault(true)
+	grid.Attach(mnemonicLabel(tr("Hub _host:"), hostEntry), 0, 1, 1, 1)
+	grid.Attach(hostEntry, 1, 1, 1, 1)
+	portSpin, _ := gtk.SpinButtonNewWithRange(1, 65534, 1)
+	portSpin.SetValue(hubclient.DefaultControlPort)
+	if p, err := strconv.Atoi(a.controlURL().Port()); err == nil {
+		portSpin.SetValue(float64(p))
+	}
+	portSpin.SetTooltipText(tr("The hub's control port; the socket listens one port above it"))
+	grid.Attach(mnemonicLabel(tr("Control p_ort:"), portSpin), 0, 2, 1, 1)
+	grid.Attach(portSpin, 1, 2, 1, 1)
+
+	controlURL := func() (*url.URL, error) {
+		host, _ := hostEntry.GetText()
+		host = strings.TrimSpace(host)
+		if host == "" {
+			host = "127.0.0.1"
+		}
+		return url.Parse("http://" + net.JoinHostPort(host, strconv.Itoa(portSpin.GetValueAsInt())))
+	}
+
+	stages, _ := gtk.GridNew()
+	stages.SetRowSpacing(4)
+	stages.SetColumnSpacing(8)
+	rows := make([]probeRow, probeStages)
+	for i := range rows {
+		icon, _ := gtk.ImageNew()
+		title, _ := gtk.LabelNew(probeStageTitle(i))
+		title.SetXAlign(0)
+		detail, _ := gtk.LabelNew("")
+		detail.SetXAlign(0)
+		detail.SetLineWrap(true)
+		detail.SetSelectable(true)
+		detail.SetHExpand(true)
+		addStyleClass(detail, "dim-label")
+		stages.Attach(icon, 0, i, 1, 1)
+		stages.Attach(title, 1, i, 1, 1)
+		stages.Attach(detail, 2, i, 1, 1)
+		rows[i] = probeRow{icon: icon, detail: detail}
+	}
+	testBtn, _ := gtk.ButtonNewWithMnemonic(tr("_Test Connection"))
+	testBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	testBox.PackStart(testBtn, false, false, 0)
+	content.PackStart(testBox, false, false, 0)
+	content.PackStart(stages, false, false, 0)
+
+	ctx, cancel := context.WithCancel(a.ctx)
+	defer cancel()
+	generation := 0
+	testBtn.Connect("clicked", func() {
+		control, err := controlURL()
+		if err != nil {
+			rows[probeDNS].icon.SetFromIconName("dialog-error-symbolic", gtk.ICON_SIZE_MENU)
+			rows[probeDNS].detail.SetText(err.Error())
+			return
+		}
+		generation++
+		gen := generation
+		for i, row := range rows {
+			row.detail.SetText("")
+			if i == 0 {
+				row.icon.SetFromIconName("content-loading-symbolic", gtk.ICON_SIZE_MENU)
+			} else {
+				row.icon.Clear()
+			}
+		}
+		testBtn.SetSensitive(false)
+		go func() {
+			err := probeHub(ctx, control, a.proxyFor, func(stage int, err error, detail string) {
+				glib.IdleAdd(func() bool {
+					if gen != generation {
+						return false
+					}
+					row := rows[stage]
+					if err != nil {
+						row.icon.SetFromIconName("dialog-error-symbolic", gtk.ICON_SIZE_MENU)
+						row.detail.SetText(protocol.Friendly(err))
+						return false
+					}
+					row.icon.SetFromIconName("emblem-ok-symbolic", gtk.ICON_SIZE_MENU)
+					row.detail.SetText(detail)
+					if stage+1 < probeStages {
+						rows[stage+1].icon.SetFromIconName("content-loading-symbolic", gtk.ICON_SIZE_MENU)
+					}
+					return false
+				})
+			})
+			glib.IdleAdd(func() bool {
+				if gen == generation {
+					testBtn.SetSensitive(true)
+				}
+				return false
+			})
+			if err != nil {
+				a.logf("connection test %s: %v", control, err)
+			} else {
+				a.logf("connection test %s: ok", control)
+			}
+		}()
+	})
+
+	dialog.ShowAll()
+	response := dialog.Run()
+	control, urlErr := controlURL()
+	name, _ := nameEntry.GetText()
+	dialog.Destroy()
+	if response != gtk.RESPONSE_ACCEPT {
+		a.logf("setup skipped; using %s", a.controlURL())
+		return
+	}
+	if urlErr != nil {
+		a.reportError("save hub", urlErr, nil)
+		return
+	}
+	a.saveWizardProfile(strings.TrimSpace(name), control)
+}
+
+// saveWizardProfile stores control in the current profile, renamed to
+// name, and makes it the default.
+func (a *app) saveWizardProfile(name string, control *url.URL) {
+	if name == "" {
+		name = a.profileName()
+	}
+	renamed := name != a.profileName()
+	profile := a.profile().clone()
+	profile.ControlURL = control.String()
+	if renamed {
+		delete(a.config.Profiles, a.profileName())
+	}
+	a.config.Profiles[name] = profile
+	a.config.Profile = name
+	a.setActive(name, profile, control)
+	if renamed {
+		a.updateSubtitle()
+	}
+	if err := a.config.save(); err != nil {
+		a.reportError("save profile", err, nil)
+		return
+	}
+	a.logf("saved profile %s for %s", name, control)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/gotk3/gotk3/glib"
+	"github.com/gotk3/gotk3/gtk"
+)
+
+// currentZone is the zone broadcasts are limited to, or "" for every peer.
+func (a *app) currentZone() string {
+	if z := a.broadcastZone.Load(); z != nil {
+		return *z
+	}
+	return ""
+}
+
+// buildZoneControls adds the zone selector to the broadcast controls.
+func (a *app) buildZoneControls(box *gtk.Box) {
+	a.zoneCombo, _ = gtk.ComboBoxTextNew()
+	setAccessible(a.zoneCombo, tr("Broadcast zone"), "")
+	a.zoneCombo.Connect("changed", func() {
+		zone := a.zoneCombo.GetActiveID()
+		a.broadcastZone.Store(&zone)
+	})
+	box.PackEnd(a.zoneCombo, false, false, 0)
+	a.refreshZoneCombo()
+	a.setZonesAvailable(false)
+}
+
+// setZonesAvailable offers the zone selector only on hubs that keep zones.
+// Must run on the GTK main loop.
+func (a *app) setZonesAvailable(ok bool) {
+	if a.zoneCombo == nil {
+		return
+	}
+	a.zoneCombo.SetSensitive(ok)
+	if ok {
+		a.zoneCombo.SetTooltipText(tr("Send broadcasts only to the peers in this zone"))
+		return
+	}
+	a.zones = nil
+	a.refreshZoneCombo()
+	a.zoneCombo.SetTooltipText(tr("This hub does not keep zones"))
+}
+
+// refreshZoneCombo lists the known zones, keeping the selection while its
+// zone still exists. Must run on the GTK main loop.
+func (a *app) refreshZoneCombo() {
+	if a.zoneCombo == nil {
+		return
+	}
+	active := a.currentZone()
+	a.zoneCombo.RemoveAll()
+	a.zoneCombo.Append("", tr("Every peer"))
+	for _, name := range a.zoneNames() {
+		a.zoneCombo.Append(name, name)
+	}
+	if _, ok := a.zones[active]; !ok {
+		active = ""
+	}
+	a.zoneCombo.SetActiveID(active)
+}
+
+// selectZone picks the broadcast zone, waiting for the hub's zone list if
+// it has not arrived yet. Must run on the GTK main loop.
+func (a *app) selectZone(zone string) {
+	if _, ok := a.zones[zone]; zone != "" && !ok {
+		a.pendingZone = &zone
+		return
+	}
+	a.pendingZone = nil
+	a.broadcastZone.Store(&zone)
+	if a.zoneCombo != nil {
+		a.zoneCombo.SetActiveID(zone)
+	}
+}
+
+func (a *app) zoneNames() []string {
+	names := make([]string, 0, len(a.zones))
+	for name := range a.zones {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// fetchZones loads the hub's zones into the selector.
+func (a *app) fetchZones() {
+	client := a.currentSocket()
+	if !client.Supports(protocol.CapZones) {
+		return
+	}
+	zones, err := client.Zones(a.ctx)
+	if err != nil {
+		a.reportError("zones", err, a.fetchZones)
+		return
+	}
+	glib.IdleAdd(func() bool {
+		a.zones = make(map[string][]string, len(zones))
+		for _, z := range zones {
+			a.zones[z.Name] = z.Peers
+		}
+		a.refreshZoneCombo()
+		if zone := a.pendingZone; zone != nil {
+			a.pendingZone = nil
+			if _, ok := a.zones[*zone]; ok {
+				a.selectZone(*zone)
+			} else {
+				a.logf("zone %s not found on this hub", *zone)
+			}
+		}
+		return false
+	})
+}
+
+// handleZoneEvent keeps the selector in step when anyone changes a zone.
+func (a *app) handleZoneEvent(payload json.RawMessage) {
+	var z hubclient.Zone
+	if err := json.Unmarshal(payload, &z); err != nil {
+		a.logf("zone event parse error: %v", err)
+		return
+	}
+	if z.Deleted {
+		a.logf("zone %s deleted", z.Name)
+	} else {
+		a.logf("zone %s: %s", z.Name, strings.Join(z.Peers, ", "))
+	}
+	glib.IdleAdd(func() bool {
+		if a.zones == nil {
+			a.zones = make(map[string][]string)
+		}
+		if z.Deleted {
+			delete(a.zones, z.Name)
+		} else {
+			a.zones[z.Name] = z.Peers
+		}
+		a.refreshZoneCombo()
+		return false
+	})
+}
+
+// showZones edits the hub's zones. The peer list comes from the hub, so
+// the dialog opens once it has answered.
+func (a *app) showZones() {
+	client := a.currentSocket()
+	if !client.Supports(protocol.CapZones) {
+		a.showToastType(gtk.MESSAGE_INFO, tr("This hub does not keep zones"), nil, false)
+		return
+	}
+	go func() {
+		result, err := client.Command(a.ctx, "peers")
+		if err != nil {
+			a.reportError("peers", err, nil)
+			return
+		}
+		peers := parsePeerList(result)
+		glib.IdleAdd(func() bool {
+			a.buildZonesDialog(client, peers)
+			return false
+		})
+	}()
+}
+
+func (a *app) buildZonesDialog(client *hubclient.Client, peers []peerInfo) {
+	dialog, err := gtk.DialogNew()
+	if err != nil {
+		a.logf("zones dialog error: %v", err)
+		return
+	}
+	dialog.SetTitle(tr("Zones"))
+	dialog.SetTransientFor(a.win)
+	dialog.SetDefaultSize(400, -1)
+	dialog.AddButton(tr("Close"), gtk.RESPONSE_CLOSE)
+	dialog.Connect("response", func() { dialog.Destroy() })
+
+	content, _ := dialog.GetContentArea()
+	content.SetSpacing(6)
+	content.SetBorderWidth(8)
+
+	pickBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 6)
+	content.PackStart(pickBox, false, false, 0)
+	combo, _ := gtk.ComboBoxTextNew()
+	setAccessible(combo, tr("Saved zones"), "")
+	pickBox.PackStart(combo, true, true, 0)
+	deleteBtn, _ := gtk.ButtonNewWithLabel(tr("Delete"))
+	pickBox.PackStart(deleteBtn, false, false, 0)
+
+	nameEntry, _ := gtk.EntryNew()
+	nameEntry.SetPlaceholderText(tr("zone name, e.g. downstairs"))
+	nameEntry.SetHExpand(true)
+	nameBox, _ := gtk.BoxNew(gtk.ORIENTATION_HORIZONTAL, 8)
+	nameBox.PackStart(mnemonicLabel(tr("_Name:"), nameEntry), false, false, 0)
+	nameBox.PackStart(nameEntry, true, true, 0)
+	content.PackStart(nameBox, false, false, 0)
+
+	// members not connected now still get a box, so saving keeps them
+	known := make(map[string]bool, len(peers))
+	for _, p := range peers {
+		known[p.ID] = true
+	}
+	for _, name := range a.zoneNames() {
+		for _, id := range a.zones[name] {
+			if !known[id] {
+				known[id] = true
+				peers = append(peers, peerInfo{ID: id})
+			}
+		}
+	}
+	checks := make(map[string]*gtk.CheckButton, len(peers))
+	list, _ := gtk.BoxNew(gtk.ORIENTATION_VERTICAL, 2)
+	for _, p := range peers {
+		check, _ := gtk.CheckButtonNewWithLabel(peerTitle(p))
+		check.SetTooltipText(p.ID)
+		checks[p.ID] = check
+		list.PackStart(check, false, false, 0)
+	}
+	if len(peers) == 0 {
+		none, _ := gtk.LabelNew(tr("No peers are connected."))
+		list.PackStart(none, false, false, 0)
+	}
+	scroll, _ := gtk.ScrolledWindowNew(nil, nil)
+	scroll.SetPolicy(gtk.POLICY_NEVER, gtk.POLICY_AUTOMATIC)
+	scroll.SetSizeRequest(-1, 180)
+	scroll.Add(list)
+	content.PackStart(scroll, true, true, 0)
+
+	saveBtn, _ := gtk.ButtonNewWithLabel(tr("Save Zone"))
+	content.PackStart(saveBtn, false, false, 0)
+	// the dialog is short-lived, so its role is checked once, not gated
+	if role := client.Role(); !role.Allows("zone-set") {
+		for _, w := range []gtk.IWidget{deleteBtn, saveBtn, list} {
+			w.ToWidget().SetSensitive(false)
+		}
+		saveBtn.SetTooltipText(roleTooltip(role))
+	}
+
+	refresh := func(active string) {
+		combo.RemoveAll()
+		for _, name := range a.zoneNames() {
+			combo.Append(name, name)
+		}
+		if active != "" {
+			combo.SetActiveID(active)
+		}
+	}
+	combo.Connect("changed", func() {
+		name := combo.GetActiveID()
+		members, ok := a.zones[name]
+		if !ok {
+			return
+		}
+		nameEntry.SetText(name)
+		in := make(map[string]bool, len(members))
+		for _, id := range members {
+			in[id] = true
+		}
+		for id, check := range checks {
+			check.SetActive(in[id])
+		}
+	})
+	saveBtn.Connect("clicked", func() {
+		name, _ := nameEntry.GetText()
+		name = strings.TrimSpace(name)
+		if name == "" {
+			a.reportError("save zone", fmt.Errorf("a zone name is required"), nil)
+			return
+		}
+		var members []string
+		for _, p := range peers {
+			if checks[p.ID].GetActive() {
+				members = append(members, p.ID)
+			}
+		}
+		go func() {
+			if _, err := client.SetZone(a.ctx, name, members); err != nil {
+				a.reportError("save zone", err, nil)
+				return
+			}
+			a.logf("zone %s saved with %d peers", name, len(members))
+			glib.IdleAdd(func() bool {
+				if a.zones == nil {
+					a.zones = make(map[string][]string)
+				}
+				a.zones[name] = members
+				a.refreshZoneCombo()
+				refresh(name)
+				return false
+			})
+		}()
+	})
+	deleteBtn.Connect("clicked", func() {
+		name := combo.GetActiveID()
+		if name == "" {
+			return
+		}
+		go func() {
+			if err := client.DeleteZone(a.ctx, name); err != nil {
+				a.reportError("delete zone", err, nil)
+				return
+			}
+			glib.IdleAdd(func() bool {
+				delete(a.zones, name)
+				a.refreshZoneCombo()
+				refresh("")
+				nameEntry.SetText("")
+				return false
+			})
+		}()
+	})
+
+	refresh(a.currentZone())
+	dialog.ShowAll()
+}
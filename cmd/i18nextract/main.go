@@ -0,0 +1,113 @@
+// Command i18nextract writes a gettext template of the UI strings in Go
+// packages: the string literal arguments of tr(...) and i18n.T(...).
+//
+//	i18nextract [-o brain.pot] dir...
+package main
+
+import (
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"brain/internal/i18n"
+)
+
+func main() {
+	out := flag.String("o", "", "write the template here instead of stdout")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: i18nextract [-o file.pot] dir...")
+		os.Exit(2)
+	}
+	refs := make(map[string][]string)
+	var msgids []string
+	fset := token.NewFileSet()
+	for _, dir := range flag.Args() {
+		files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+		if err != nil {
+			fatal(err)
+		}
+		sort.Strings(files)
+		for _, path := range files {
+			if strings.HasSuffix(path, "_test.go") {
+				continue
+			}
+			file, err := parser.ParseFile(fset, path, nil, 0)
+			if err != nil {
+				fatal(err)
+			}
+			ast.Inspect(file, func(n ast.Node) bool {
+				call, ok := n.(*ast.CallExpr)
+				if !ok || len(call.Args) != 1 || !isTranslateCall(call.Fun) {
+					return true
+				}
+				lit, ok := call.Args[0].(*ast.BasicLit)
+				if !ok || lit.Kind != token.STRING {
+					return true
+				}
+				id, err := strconv.Unquote(lit.Value)
+				if err != nil || id == "" {
+					return true
+				}
+				if _, ok := refs[id]; !ok {
+					msgids = append(msgids, id)
+				}
+				pos := fset.Position(lit.Pos())
+				refs[id] = append(refs[id], fmt.Sprintf("%s:%d", filepath.ToSlash(relative(pos.Filename)), pos.Line))
+				return true
+			})
+		}
+	}
+
+	var w io.Writer = os.Stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := i18n.WritePOT(w, msgids, refs); err != nil {
+		fatal(err)
+	}
+}
+
+func isTranslateCall(fun ast.Expr) bool {
+	switch f := fun.(type) {
+	case *ast.Ident:
+		return f.Name == "tr"
+	case *ast.SelectorExpr:
+		pkg, ok := f.X.(*ast.Ident)
+		return ok && pkg.Name == "i18n" && f.Sel.Name == "T"
+	}
+	return false
+}
+
+// relative keeps references stable across checkouts by trimming everything
+// up to the cmd/ or internal/ directory.
+func relative(path string) string {
+	path = filepath.ToSlash(filepath.Clean(path))
+	for _, root := range []string{"cmd/", "internal/"} {
+		if i := strings.LastIndex(path, "/"+root); i >= 0 {
+			return path[i+1:]
+		}
+		if strings.HasPrefix(path, root) {
+			return path
+		}
+	}
+	return path
+}
+
+func fatal(err error) {
+	fmt.Fprintln(os.Stderr, "i18nextract:", err)
+	os.Exit(1)
+}
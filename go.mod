@@ -2,4 +2,10 @@ module brain
 
 go 1.22
 
-require github.com/gotk3/gotk3 v0.6.0
+require (
+	github.com/fsnotify/fsnotify v1.9.0
+	github.com/gotk3/gotk3 v0.6.0
+	go.starlark.net v0.0.0-20190702223751-32f345186213
+)
+
+require golang.org/x/sys v0.13.0 // indirect
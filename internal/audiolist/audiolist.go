@@ -0,0 +1,204 @@
+// Package audiolist reads the audio listings hubs send, in "audio list"
+// results, status payloads and files responses. Hubs disagree on the shape:
+// a list may be bare names, objects named by "name" or "key", an object
+// with "files" and "folders", or any of these wrapped in "result".
+package audiolist
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+)
+
+// File is one remote audio file.
+type File struct {
+	Name      string
+	Size      *int64
+	Uploaded  string
+	ExpiresAt string
+	// Duration is in whole seconds and Bitrate in bits per second; both are
+	// zero when the uploader could not read them.
+	Duration int64
+	Bitrate  int64
+	Title    string
+	Artist   string
+	Album    string
+	// Loudness is in LUFS; zero when the uploader did not measure it.
+	Loudness float64
+	// Plays counts broadcast-plays; listings leave it for the client.
+	Plays int
+	// Tags come from the hub listing.
+	Tags []string
+}
+
+// Parse reads a listing as decoded from JSON or CBOR. The string is the
+// hub's error, when the listing is one.
+func Parse(raw interface{}) ([]File, string) {
+	if raw == nil {
+		return nil, ""
+	}
+	switch val := raw.(type) {
+	case map[string]interface{}:
+		if errText, ok := val["error"].(string); ok && errText != "" {
+			return nil, errText
+		}
+		if result, ok := val["result"]; ok {
+			return Parse(result)
+		}
+		_, hasFiles := val["files"]
+		_, hasFolders := val["folders"]
+		if hasFiles || hasFolders {
+			files, _ := Parse(val["files"])
+			nested, _ := Parse(val["folders"])
+			return append(files, nested...), ""
+		}
+		if file, ok := fileFrom(val); ok {
+			return []File{file}, ""
+		}
+		return nil, ""
+	case []interface{}:
+		files := make([]File, 0, len(val))
+		for _, item := range val {
+			switch entry := item.(type) {
+			case string:
+				if entry != "" {
+					files = append(files, File{Name: entry})
+				}
+			case map[string]interface{}:
+				if nested, ok := folderEntry(entry); ok {
+					files = append(files, nested...)
+				} else if file, ok := fileFrom(entry); ok {
+					files = append(files, file)
+				}
+			}
+		}
+		return files, ""
+	default:
+		return nil, ""
+	}
+}
+
+// fileFrom reads one listing entry, named by "name" or "key".
+func fileFrom(entry map[string]interface{}) (File, bool) {
+	name, _ := entry["name"].(string)
+	if name == "" {
+		name, _ = entry["key"].(string)
+	}
+	if name == "" {
+		return File{}, false
+	}
+	file := File{Name: name}
+	if sizePtr := Size(entry["size"]); sizePtr != nil {
+		file.Size = sizePtr
+	}
+	if uploaded, ok := entry["uploaded"].(string); ok {
+		file.Uploaded = uploaded
+	}
+	if expires, ok := entry["expiresAt"].(string); ok {
+		file.ExpiresAt = expires
+	}
+	if seconds := Size(entry["duration"]); seconds != nil {
+		file.Duration = *seconds
+	}
+	if bitrate := Size(entry["bitrate"]); bitrate != nil {
+		file.Bitrate = *bitrate
+	}
+	file.Title, _ = entry["title"].(string)
+	file.Artist, _ = entry["artist"].(string)
+	file.Album, _ = entry["album"].(string)
+	file.Loudness, _ = entry["loudness"].(float64)
+	if tags, ok := entry["tags"].([]interface{}); ok {
+		for _, tag := range tags {
+			if s, ok := tag.(string); ok && s != "" {
+				file.Tags = append(file.Tags, s)
+			}
+		}
+	}
+	return file, true
+}
+
+// folderEntry reads a nested folder from a listing, {"name": "sfx",
+// "files": [...], "folders": [...]}, prefixing the folder name to every
+// file beneath it.
+func folderEntry(entry map[string]interface{}) ([]File, bool) {
+	var files []File
+	found := false
+	for _, key := range []string{"files", "children", "folders"} {
+		if children, ok := entry[key]; ok {
+			nested, _ := Parse(children)
+			files = append(files, nested...)
+			found = true
+		}
+	}
+	if !found {
+		return nil, false
+	}
+	name, _ := entry["name"].(string)
+	if name == "" {
+		name, _ = entry["prefix"].(string)
+	}
+	if name = CleanFolder(name); name != "" {
+		for i := range files {
+			files[i].Name = name + "/" + files[i].Name
+		}
+	}
+	return files, true
+}
+
+// Size accepts any numeric size a hub sends; negative, non-finite or
+// out-of-range values count as unknown.
+func Size(value interface{}) *int64 {
+	var size int64
+	switch n := value.(type) {
+	case float64:
+		if !(n >= 0 && n < math.MaxInt64) {
+			return nil
+		}
+		size = int64(n)
+	case float32:
+		return Size(float64(n))
+	case int:
+		size = int64(n)
+	case int64:
+		size = n
+	case int32:
+		size = int64(n)
+	case uint64:
+		if n > math.MaxInt64 {
+			return nil
+		}
+		size = int64(n)
+	case uint32:
+		size = int64(n)
+	case json.Number:
+		parsed, err := n.Int64()
+		if err != nil {
+			f, ferr := n.Float64()
+			if ferr != nil {
+				return nil
+			}
+			return Size(f)
+		}
+		size = parsed
+	default:
+		return nil
+	}
+	if size < 0 {
+		return nil
+	}
+	return &size
+}
+
+// CleanFolder turns what was typed as a folder into a prefix without
+// empty, "." or ".." segments or surrounding slashes.
+func CleanFolder(folder string) string {
+	var parts []string
+	for _, part := range strings.Split(folder, "/") {
+		part = strings.TrimSpace(part)
+		if part == "" || part == "." || part == ".." {
+			continue
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "/")
+}
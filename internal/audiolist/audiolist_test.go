@@ -0,0 +1,96 @@
+package audiolist
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"brain/internal/protocol"
+)
+
+func TestParse(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		names []string
+		err   string
+	}{
+		{`["a.mp3","",{"name":"b.wav"}]`, []string{"a.mp3", "b.wav"}, ""},
+		{`{"result":{"files":[{"key":"c.ogg"}]}}`, []string{"c.ogg"}, ""},
+		{`[{"name":"/sfx/./","files":["door.wav"],"folders":[{"name":"x","files":["y.mp3"]}]}]`, []string{"sfx/door.wav", "sfx/x/y.mp3"}, ""},
+		{`{"error":"bucket unavailable"}`, nil, "bucket unavailable"},
+		{`{"name":7}`, nil, ""},
+	} {
+		var raw any
+		if err := json.Unmarshal([]byte(tc.in), &raw); err != nil {
+			t.Fatal(err)
+		}
+		files, errText := Parse(raw)
+		var names []string
+		for _, file := range files {
+			names = append(names, file.Name)
+		}
+		if errText != tc.err || len(names) != len(tc.names) {
+			t.Errorf("Parse(%s) = %q, %q; want %q, %q", tc.in, names, errText, tc.names, tc.err)
+			continue
+		}
+		for i := range names {
+			if names[i] != tc.names[i] {
+				t.Errorf("Parse(%s) = %q; want %q", tc.in, names, tc.names)
+				break
+			}
+		}
+	}
+}
+
+func TestSize(t *testing.T) {
+	for _, tc := range []struct {
+		in   any
+		want int64
+		ok   bool
+	}{
+		{float64(1024), 1024, true},
+		{json.Number("12.5"), 12, true},
+		{json.Number("-3"), 0, false},
+		{float64(1e300), 0, false},
+		{uint64(1 << 63), 0, false},
+		{"12", 0, false},
+	} {
+		got := Size(tc.in)
+		if (got != nil) != tc.ok || (got != nil && *got != tc.want) {
+			t.Errorf("Size(%#v) = %v; want %d, %v", tc.in, got, tc.want, tc.ok)
+		}
+	}
+}
+
+// FuzzParse runs arbitrary hub audio listings, as JSON and as CBOR,
+// through Parse. It must not panic, and what it returns must be drawable:
+// every file named and no negative sizes.
+func FuzzParse(f *testing.F) {
+	for _, seed := range []string{
+		`["a.mp3","",{"name":"b.wav","size":1024,"uploaded":"2026-10-01T10:00:00Z"}]`,
+		`{"files":[{"key":"c.ogg","size":12.5,"expiresAt":"2026-11-01T00:00:00Z"}]}`,
+		`{"result":{"files":{"name":"d.flac","size":-3}}}`,
+		`{"error":"bucket unavailable"}`,
+		`{"key":"e.mp3","size":1e300}`,
+		`[null,1,true,[],{"name":7}]`,
+	} {
+		f.Add([]byte(seed))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var raw any
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.UseNumber()
+		if dec.Decode(&raw) != nil && protocol.UnmarshalCBOR(data, &raw) != nil {
+			return
+		}
+		files, _ := Parse(raw)
+		for _, file := range files {
+			if file.Name == "" {
+				t.Fatalf("unnamed file in %q", data)
+			}
+			if file.Size != nil && *file.Size < 0 {
+				t.Fatalf("%s: negative size %d from %q", file.Name, *file.Size, data)
+			}
+		}
+	})
+}
@@ -0,0 +1,135 @@
+// Package audiotag reads the duration, bitrate and title/artist/album tags
+// of local audio files from their headers, without decoding any audio. It
+// understands MP3 (ID3v1, ID3v2.2-2.4, Xing/Info and VBRI headers), WAV,
+// FLAC and Ogg Vorbis/Opus.
+package audiotag
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// Info is what could be read from a file. Zero members are unknown.
+type Info struct {
+	// Format is "mp3", "wav", "flac" or "ogg".
+	Format   string
+	Duration time.Duration
+	// Bitrate is the average over the whole file, in bits per second.
+	Bitrate int
+	Title   string
+	Artist  string
+	Album   string
+}
+
+// ErrUnknownFormat is returned for files none of the readers recognise.
+var ErrUnknownFormat = errors.New("audiotag: unknown audio format")
+
+// maxBlock bounds any single tag or metadata block read into memory, so a
+// corrupt length cannot ask for gigabytes. Embedded cover art is the only
+// thing that legitimately gets near it.
+const maxBlock = 16 << 20
+
+// ReadFile reads the file at path.
+func ReadFile(path string) (*Info, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return Read(f, st.Size())
+}
+
+// Read reads an audio file of size bytes from r.
+func Read(r io.ReaderAt, size int64) (*Info, error) {
+	head := make([]byte, 12)
+	n, _ := r.ReadAt(head, 0)
+	head = head[:n]
+	var info *Info
+	var err error
+	switch {
+	case bytes.HasPrefix(head, []byte("fLaC")):
+		info, err = readFLAC(r, size, 0)
+	case bytes.HasPrefix(head, []byte("OggS")):
+		info, err = readOgg(r, size)
+	case len(head) >= 12 && string(head[:4]) == "RIFF" && string(head[8:12]) == "WAVE":
+		info, err = readWAV(r, size)
+	case bytes.HasPrefix(head, []byte("ID3")):
+		// FLAC files are sometimes written with an ID3v2 tag in front
+		if end := id3Size(head); end > 0 {
+			magic := make([]byte, 4)
+			if _, err := r.ReadAt(magic, end); err == nil && string(magic) == "fLaC" {
+				return readFLAC(r, size, end)
+			}
+		}
+		info, err = readMP3(r, size)
+	case len(head) >= 2 && isFrameSync(head):
+		info, err = readMP3(r, size)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	info.Title = clean(info.Title)
+	info.Artist = clean(info.Artist)
+	info.Album = clean(info.Album)
+	return info, nil
+}
+
+// averageBitrate derives a bitrate from the bytes of audio and how long
+// they play.
+func averageBitrate(audioBytes int64, d time.Duration) int {
+	if audioBytes <= 0 || d <= 0 {
+		return 0
+	}
+	return int(float64(audioBytes) * 8 / d.Seconds())
+}
+
+// seconds converts s to a Duration, or 0 when a corrupt header claims a
+// length a Duration cannot hold.
+func seconds(s float64) time.Duration {
+	if !(s > 0 && s < math.MaxInt64/float64(time.Second)) {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
+
+func readFull(r io.ReaderAt, off int64, n int) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, off); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+func clean(s string) string {
+	return strings.TrimSpace(strings.Trim(s, "\x00"))
+}
+
+// setTag fills the Info member for a Vorbis-comment or RIFF style key,
+// keeping the first value seen.
+func (i *Info) setTag(key, value string) {
+	var dst *string
+	switch strings.ToUpper(key) {
+	case "TITLE", "INAM":
+		dst = &i.Title
+	case "ARTIST", "IART":
+		dst = &i.Artist
+	case "ALBUM", "IPRD":
+		dst = &i.Album
+	default:
+		return
+	}
+	if *dst == "" {
+		*dst = value
+	}
+}
@@ -0,0 +1,347 @@
+package audiotag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+// The fixtures below are just enough header for each reader: real tags and
+// frame headers around zeroed audio.
+
+// id3v2 builds an ID3v2 tag of the given major version from id/text
+// pairs, every frame Latin-1 encoded.
+func id3v2(major byte, frames ...string) []byte {
+	var body []byte
+	for i := 0; i+1 < len(frames); i += 2 {
+		data := append([]byte{0}, frames[i+1]...)
+		body = append(body, id3Frame(major, frames[i], data)...)
+	}
+	return id3Tag(major, body)
+}
+
+func id3Frame(major byte, id string, data []byte) []byte {
+	frame := []byte(id)
+	n := len(data)
+	switch major {
+	case 2:
+		frame = append(frame, byte(n>>16), byte(n>>8), byte(n))
+	case 4:
+		frame = append(frame, syncsafeBytes(n)...)
+		frame = append(frame, 0, 0)
+	default:
+		frame = binary.BigEndian.AppendUint32(frame, uint32(n))
+		frame = append(frame, 0, 0)
+	}
+	return append(frame, data...)
+}
+
+func id3Tag(major byte, body []byte) []byte {
+	tag := []byte{'I', 'D', '3', major, 0, 0}
+	tag = append(tag, syncsafeBytes(len(body))...)
+	return append(tag, body...)
+}
+
+func syncsafeBytes(n int) []byte {
+	return []byte{byte(n>>21) & 0x7F, byte(n>>14) & 0x7F, byte(n>>7) & 0x7F, byte(n) & 0x7F}
+}
+
+// mpegFrames is count MPEG-1 layer III frames at 128 kbit/s, 44.1 kHz,
+// 417 bytes each.
+func mpegFrames(count int) []byte {
+	frame := make([]byte, 417)
+	copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+	return bytes.Repeat(frame, count)
+}
+
+// xingFrames is mpegFrames with a Xing header claiming frames frames.
+func xingFrames(count int, frames uint32) []byte {
+	b := mpegFrames(count)
+	off := 4 + 32
+	copy(b[off:], "Xing")
+	binary.BigEndian.PutUint32(b[off+4:], 1)
+	binary.BigEndian.PutUint32(b[off+8:], frames)
+	return b
+}
+
+func id3v1(title, artist, album string) []byte {
+	tag := make([]byte, 128)
+	copy(tag, "TAG")
+	copy(tag[3:33], title)
+	copy(tag[33:63], artist)
+	copy(tag[63:93], album)
+	return tag
+}
+
+func vorbisComment(comments ...string) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, 4)
+	b = append(b, "test"...)
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(comments)))
+	for _, c := range comments {
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(c)))
+		b = append(b, c...)
+	}
+	return b
+}
+
+func wav(byteRate uint32, dataSize int, chunks ...[]byte) []byte {
+	fmtChunk := make([]byte, 16)
+	binary.LittleEndian.PutUint16(fmtChunk[0:], 1)
+	binary.LittleEndian.PutUint16(fmtChunk[2:], 2)
+	binary.LittleEndian.PutUint32(fmtChunk[4:], byteRate/4)
+	binary.LittleEndian.PutUint32(fmtChunk[8:], byteRate)
+	binary.LittleEndian.PutUint16(fmtChunk[12:], 4)
+	binary.LittleEndian.PutUint16(fmtChunk[14:], 16)
+	body := []byte("WAVE")
+	body = append(body, riffChunk("fmt ", fmtChunk)...)
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	body = append(body, riffChunk("data", make([]byte, dataSize))...)
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+func riffChunk(id string, data []byte) []byte {
+	b := append([]byte(id), binary.LittleEndian.AppendUint32(nil, uint32(len(data)))...)
+	b = append(b, data...)
+	if len(data)&1 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+func riffInfo(pairs ...string) []byte {
+	list := []byte("INFO")
+	for i := 0; i+1 < len(pairs); i += 2 {
+		list = append(list, riffChunk(pairs[i], append([]byte(pairs[i+1]), 0))...)
+	}
+	return riffChunk("LIST", list)
+}
+
+func flac(rate uint32, samples uint64, audio int, comments ...string) []byte {
+	si := make([]byte, 34)
+	si[10] = byte(rate >> 12)
+	si[11] = byte(rate >> 4)
+	si[12] = byte(rate<<4) | 1<<1 // stereo
+	si[13] = 0xF0 | byte(samples>>32)&0x0F
+	binary.BigEndian.PutUint32(si[14:], uint32(samples))
+	b := []byte("fLaC")
+	b = append(b, flacBlock(flacStreamInfo, len(comments) == 0, si)...)
+	if len(comments) > 0 {
+		b = append(b, flacBlock(flacVorbisComment, true, vorbisComment(comments...))...)
+	}
+	return append(b, make([]byte, audio)...)
+}
+
+func flacBlock(kind byte, last bool, body []byte) []byte {
+	if last {
+		kind |= 0x80
+	}
+	n := len(body)
+	return append([]byte{kind, byte(n >> 16), byte(n >> 8), byte(n)}, body...)
+}
+
+// oggPage wraps packets, each under 255 bytes, in one page.
+func oggPage(granule uint64, packets ...[]byte) []byte {
+	head := make([]byte, 27)
+	copy(head, "OggS")
+	binary.LittleEndian.PutUint64(head[6:], granule)
+	binary.LittleEndian.PutUint32(head[14:], 7)
+	head[26] = byte(len(packets))
+	var body []byte
+	for _, p := range packets {
+		head = append(head, byte(len(p)))
+		body = append(body, p...)
+	}
+	return append(head, body...)
+}
+
+func vorbisID(rate uint32) []byte {
+	id := make([]byte, 30)
+	copy(id, "\x01vorbis")
+	id[11] = 2
+	binary.LittleEndian.PutUint32(id[12:], rate)
+	return id
+}
+
+func opusHead(preSkip uint16) []byte {
+	id := make([]byte, 19)
+	copy(id, "OpusHead")
+	id[8], id[9] = 1, 2
+	binary.LittleEndian.PutUint16(id[10:], preSkip)
+	binary.LittleEndian.PutUint32(id[12:], 48000)
+	return id
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+var fixtures = []struct {
+	name string
+	file []byte
+	want Info
+}{
+	{
+		"mp3 id3v2.3 cbr",
+		concat(id3v2(3, "TIT2", "Song", "TPE1", "Band", "TALB", "Record"), mpegFrames(100)),
+		Info{Format: "mp3", Duration: 2606250 * time.Microsecond, Bitrate: 128000, Title: "Song", Artist: "Band", Album: "Record"},
+	},
+	{
+		"mp3 id3v2.2",
+		concat(id3v2(2, "TT2", "Old", "TP1", "Timer", "TAL", "Tape"), mpegFrames(10)),
+		Info{Format: "mp3", Duration: 260625 * time.Microsecond, Bitrate: 128000, Title: "Old", Artist: "Timer", Album: "Tape"},
+	},
+	{
+		"mp3 id3v2.4 utf-16 and TLEN",
+		concat(id3Tag(4, concat(
+			id3Frame(4, "TIT2", append([]byte{1}, utf16le("Grüße")...)),
+			id3Frame(4, "TLEN", []byte("\x005000")),
+		)), mpegFrames(2)),
+		Info{Format: "mp3", Duration: 52125 * time.Microsecond, Bitrate: 128000, Title: "Grüße"},
+	},
+	{
+		"mp3 xing vbr",
+		xingFrames(3, 1000),
+		Info{Format: "mp3", Duration: seconds(1000 * 1152 / 44100.0), Bitrate: averageBitrate(3*417, seconds(1000*1152/44100.0))},
+	},
+	{
+		"mp3 id3v1 only",
+		concat(mpegFrames(10), id3v1("Trailing", "Tagger", "Footer")),
+		Info{Format: "mp3", Duration: 260625 * time.Microsecond, Bitrate: 128000, Title: "Trailing", Artist: "Tagger", Album: "Footer"},
+	},
+	{
+		"mp3 id3v2 wins over id3v1",
+		concat(id3v2(3, "TIT2", "Front"), mpegFrames(10), id3v1("Back", "", "")),
+		Info{Format: "mp3", Duration: 260625 * time.Microsecond, Bitrate: 128000, Title: "Front"},
+	},
+	{
+		"wav list info",
+		wav(176400, 176400, riffInfo("INAM", "Take", "IART", "Mic", "IPRD", "Session")),
+		Info{Format: "wav", Duration: time.Second, Bitrate: 1411200, Title: "Take", Artist: "Mic", Album: "Session"},
+	},
+	{
+		"wav id3 chunk",
+		wav(8000, 4000, riffChunk("id3 ", id3v2(3, "TIT2", "Memo"))),
+		Info{Format: "wav", Duration: 500 * time.Millisecond, Bitrate: 64000, Title: "Memo"},
+	},
+	{
+		"flac",
+		flac(44100, 441000, 1000, "TITLE=Lossless", "artist=Quiet", "ALBUM=Box", "TITLE=Ignored"),
+		Info{Format: "flac", Duration: 10 * time.Second, Bitrate: 800, Title: "Lossless", Artist: "Quiet", Album: "Box"},
+	},
+	{
+		"flac behind id3",
+		concat(id3v2(3, "TIT2", "Wrapped"), flac(48000, 96000, 0)),
+		Info{Format: "flac", Duration: 2 * time.Second},
+	},
+	{
+		"ogg vorbis",
+		concat(
+			oggPage(0, vorbisID(44100)),
+			oggPage(0, append([]byte("\x03vorbis"), vorbisComment("TITLE=Open", "ARTIST=Xiph")...)),
+			oggPage(3*44100),
+		),
+		Info{Format: "ogg", Duration: 3 * time.Second, Title: "Open", Artist: "Xiph"},
+	},
+	{
+		"ogg opus",
+		concat(
+			oggPage(0, opusHead(312)),
+			oggPage(0, append([]byte("OpusTags"), vorbisComment("ALBUM=Voice")...)),
+			oggPage(2*48000+312),
+		),
+		Info{Format: "ogg", Duration: 2 * time.Second, Album: "Voice"},
+	},
+}
+
+func utf16le(s string) []byte {
+	b := []byte{0xFF, 0xFE}
+	for _, u := range utf16.Encode([]rune(s)) {
+		b = binary.LittleEndian.AppendUint16(b, u)
+	}
+	return append(b, 0, 0)
+}
+
+func TestRead(t *testing.T) {
+	for _, tc := range fixtures {
+		got, err := Read(bytes.NewReader(tc.file), int64(len(tc.file)))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		want := tc.want
+		if want.Format == "ogg" {
+			// Ogg bitrates average over the whole tiny file
+			want.Bitrate = averageBitrate(int64(len(tc.file)), want.Duration)
+		}
+		if *got != want {
+			t.Errorf("%s:\n got %+v\nwant %+v", tc.name, *got, want)
+		}
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		file []byte
+		want error
+	}{
+		{"empty", nil, ErrUnknownFormat},
+		{"text", []byte("just some text, not audio"), ErrUnknownFormat},
+		{"ogg theora", oggPage(0, []byte("\x80theora")), ErrUnknownFormat},
+		{"wav without data", wav(176400, 0)[:36], nil},
+		{"flac without streaminfo", concat([]byte("fLaC"), flacBlock(flacVorbisComment, true, vorbisComment())), nil},
+		{"mp3 tag without frames", concat(id3v2(3, "TALB", "Nothing"), make([]byte, 100)), nil},
+	} {
+		info, err := Read(bytes.NewReader(tc.file), int64(len(tc.file)))
+		if err == nil {
+			t.Errorf("%s: got %+v, want an error", tc.name, info)
+			continue
+		}
+		if tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+func TestID3Text(t *testing.T) {
+	for _, tc := range []struct {
+		data []byte
+		want string
+	}{
+		{nil, ""},
+		{[]byte("\x00caf\xe9"), "café"},
+		{[]byte("\x03caf\xc3\xa9\x00second"), "café"},
+		{append([]byte{1}, utf16le("ok")...), "ok"},
+		{[]byte{2, 0, 'h', 0, 'i'}, "hi"},
+	} {
+		if got := id3Text(tc.data); got != tc.want {
+			t.Errorf("id3Text(%q) = %q, want %q", tc.data, got, tc.want)
+		}
+	}
+}
+
+// FuzzParse feeds arbitrary bytes to Read. Files come from anywhere, so a
+// corrupt header must yield an error or partial Info, never a panic or a
+// runaway allocation.
+func FuzzParse(f *testing.F) {
+	for _, tc := range fixtures {
+		f.Add(tc.file)
+	}
+	f.Add([]byte("ID3\x04\x00\x40\x00\x00\x00\x10\x7f\x7f\x7f\x7f"))
+	f.Add([]byte("RIFF\x00\x00\x00\x00WAVELIST\xff\xff\xff\x7f"))
+	f.Add([]byte("fLaC\x04\xff\xff\xff"))
+	f.Fuzz(func(t *testing.T, file []byte) {
+		info, err := Read(bytes.NewReader(file), int64(len(file)))
+		if (info == nil) == (err == nil) {
+			t.Fatalf("Read returned %+v, %v", info, err)
+		}
+		if info != nil && (info.Duration < 0 || info.Bitrate < 0) {
+			t.Fatalf("negative duration or bitrate: %+v", info)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package audiotag
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+)
+
+const (
+	flacStreamInfo    = 0
+	flacVorbisComment = 4
+)
+
+// readFLAC reads the metadata blocks following the "fLaC" marker at start.
+func readFLAC(r io.ReaderAt, size, start int64) (*Info, error) {
+	info := &Info{Format: "flac"}
+	var rate uint32
+	var samples uint64
+	off := start + 4
+	for {
+		head, err := readFull(r, off, 4)
+		if err != nil {
+			return nil, err
+		}
+		last := head[0]&0x80 != 0
+		kind := head[0] & 0x7F
+		n := int64(head[1])<<16 | int64(head[2])<<8 | int64(head[3])
+		body := off + 4
+		switch kind {
+		case flacStreamInfo:
+			if si, err := readFull(r, body, 18); err == nil {
+				rate = uint32(si[10])<<12 | uint32(si[11])<<4 | uint32(si[12])>>4
+				samples = uint64(si[13]&0x0F)<<32 | uint64(binary.BigEndian.Uint32(si[14:18]))
+			}
+		case flacVorbisComment:
+			if n <= maxBlock {
+				if block, err := readFull(r, body, int(n)); err == nil {
+					readVorbisComment(block, info)
+				}
+			}
+		}
+		off = body + n
+		if last || off >= size {
+			break
+		}
+	}
+	if rate == 0 {
+		return nil, errors.New("audiotag: FLAC file without STREAMINFO")
+	}
+	if samples > 0 {
+		info.Duration = seconds(float64(samples) / float64(rate))
+		info.Bitrate = averageBitrate(size-off, info.Duration)
+	}
+	return info, nil
+}
+
+// readVorbisComment reads the little-endian comment structure shared by
+// FLAC, Ogg Vorbis and Opus.
+func readVorbisComment(b []byte, info *Info) {
+	next := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return nil, false
+		}
+		field := b[4 : 4+n]
+		b = b[4+n:]
+		return field, true
+	}
+	if _, ok := next(); !ok { // vendor
+		return
+	}
+	if len(b) < 4 {
+		return
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	for i := uint32(0); i < count; i++ {
+		field, ok := next()
+		if !ok {
+			return
+		}
+		if key, value, found := strings.Cut(string(field), "="); found {
+			info.setTag(key, value)
+		}
+	}
+}
@@ -0,0 +1,296 @@
+package audiotag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// syncScan is how far past the tags the first MPEG frame is looked for.
+const syncScan = 64 << 10
+
+var (
+	// kbit/s by [version is MPEG-1][layer 1..3][index]
+	bitratesV1 = [3][15]int{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	}
+	bitratesV2 = [3][15]int{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+	// Hz by version bits 0 (2.5), 2 (2) and 3 (1)
+	sampleRates = map[byte][3]int{
+		0: {11025, 12000, 8000},
+		2: {22050, 24000, 16000},
+		3: {44100, 48000, 32000},
+	}
+)
+
+// mpegFrame is a parsed MPEG audio frame header.
+type mpegFrame struct {
+	v1         bool
+	layer      int // 1, 2 or 3
+	bitrate    int // bits per second
+	sampleRate int
+	mono       bool
+	length     int // bytes, header included
+	samples    int // per frame
+}
+
+func isFrameSync(b []byte) bool {
+	return b[0] == 0xFF && b[1]&0xE0 == 0xE0
+}
+
+func parseFrame(h []byte) (mpegFrame, bool) {
+	if len(h) < 4 || !isFrameSync(h) {
+		return mpegFrame{}, false
+	}
+	version := (h[1] >> 3) & 3
+	layerBits := (h[1] >> 1) & 3
+	rateIdx := h[2] >> 4
+	srIdx := (h[2] >> 2) & 3
+	rates, ok := sampleRates[version]
+	if !ok || layerBits == 0 || rateIdx == 0 || rateIdx == 15 || srIdx == 3 {
+		return mpegFrame{}, false
+	}
+	f := mpegFrame{v1: version == 3, layer: int(4 - layerBits), sampleRate: rates[srIdx], mono: h[3]>>6 == 3}
+	table := bitratesV2
+	if f.v1 {
+		table = bitratesV1
+	}
+	f.bitrate = table[f.layer-1][rateIdx] * 1000
+	padding := int(h[2]>>1) & 1
+	switch {
+	case f.layer == 1:
+		f.samples = 384
+		f.length = (12*f.bitrate/f.sampleRate + padding) * 4
+	case f.layer == 3 && !f.v1:
+		f.samples = 576
+		f.length = 72*f.bitrate/f.sampleRate + padding
+	default:
+		f.samples = 1152
+		f.length = 144*f.bitrate/f.sampleRate + padding
+	}
+	return f, f.length > 4
+}
+
+// sideInfo is the size of the layer III side information, which the Xing
+// header follows.
+func (f mpegFrame) sideInfo() int {
+	switch {
+	case f.v1 && f.mono:
+		return 17
+	case f.v1:
+		return 32
+	case f.mono:
+		return 9
+	}
+	return 17
+}
+
+func readMP3(r io.ReaderAt, size int64) (*Info, error) {
+	info := &Info{Format: "mp3"}
+	start := int64(0)
+	if head, err := readFull(r, 0, 10); err == nil {
+		if n := id3Size(head); n > 0 {
+			tagLen := n
+			if tagLen > maxBlock {
+				tagLen = maxBlock
+			}
+			if tag, err := readFull(r, 0, int(tagLen)); err == nil {
+				parseID3v2(tag, info)
+			}
+			start = n
+		}
+	}
+	end := size
+	if size >= 128 {
+		if v1, err := readFull(r, size-128, 128); err == nil && string(v1[:3]) == "TAG" {
+			end -= 128
+			info.setTag("TITLE", latin1(v1[3:33]))
+			info.setTag("ARTIST", latin1(v1[33:63]))
+			info.setTag("ALBUM", latin1(v1[63:93]))
+		}
+	}
+
+	scan := make([]byte, syncScan)
+	n, _ := r.ReadAt(scan, start)
+	scan = scan[:n]
+	for i := 0; i+4 <= len(scan); i++ {
+		f, ok := parseFrame(scan[i:])
+		if !ok {
+			continue
+		}
+		// a real frame is followed by another; this skips stray 0xFF bytes
+		if next := i + f.length; next+4 <= len(scan) {
+			if _, ok := parseFrame(scan[next:]); !ok {
+				continue
+			}
+		}
+		frameStart := start + int64(i)
+		audio := end - frameStart
+		if frames := vbrFrames(scan[i:], f); frames > 0 {
+			info.Duration = seconds(float64(frames) * float64(f.samples) / float64(f.sampleRate))
+			info.Bitrate = averageBitrate(audio, info.Duration)
+		} else {
+			info.Bitrate = f.bitrate
+			info.Duration = seconds(float64(audio) * 8 / float64(f.bitrate))
+		}
+		return info, nil
+	}
+	if info.Duration > 0 || info.Title != "" || info.Artist != "" {
+		return info, nil
+	}
+	return nil, errors.New("audiotag: no MPEG audio frame found")
+}
+
+// vbrFrames reads the frame count from a Xing/Info or VBRI header in the
+// first frame, or returns 0.
+func vbrFrames(frame []byte, f mpegFrame) uint32 {
+	if off := 4 + f.sideInfo(); off+12 <= len(frame) {
+		tag := string(frame[off : off+4])
+		if (tag == "Xing" || tag == "Info") && frame[off+7]&1 != 0 {
+			return binary.BigEndian.Uint32(frame[off+8:])
+		}
+	}
+	if off := 36; off+18 <= len(frame) && string(frame[off:off+4]) == "VBRI" {
+		return binary.BigEndian.Uint32(frame[off+14:])
+	}
+	return 0
+}
+
+// id3Size returns the length of the ID3v2 tag head starts, header and
+// footer included, or 0.
+func id3Size(head []byte) int64 {
+	if len(head) < 10 || string(head[:3]) != "ID3" {
+		return 0
+	}
+	n := int64(syncsafe(head[6:10])) + 10
+	if head[5]&0x10 != 0 {
+		n += 10
+	}
+	return n
+}
+
+func syncsafe(b []byte) uint32 {
+	return uint32(b[0]&0x7F)<<21 | uint32(b[1]&0x7F)<<14 | uint32(b[2]&0x7F)<<7 | uint32(b[3]&0x7F)
+}
+
+// parseID3v2 reads the text frames of a whole ID3v2 tag, header included.
+func parseID3v2(tag []byte, info *Info) {
+	if len(tag) < 10 {
+		return
+	}
+	major, flags := tag[3], tag[5]
+	body := tag[10:]
+	if flags&0x80 != 0 && major < 4 {
+		body = bytes.ReplaceAll(body, []byte{0xFF, 0x00}, []byte{0xFF})
+	}
+	if flags&0x40 != 0 && len(body) >= 4 {
+		skip := int(binary.BigEndian.Uint32(body))
+		if major == 3 {
+			skip += 4
+		} else if major == 4 {
+			skip = int(syncsafe(body))
+		}
+		if skip < 0 || skip > len(body) {
+			return
+		}
+		body = body[skip:]
+	}
+	idLen, headLen := 4, 10
+	if major == 2 {
+		idLen, headLen = 3, 6
+	}
+	for len(body) >= headLen && body[0] != 0 {
+		id := string(body[:idLen])
+		var size int
+		switch major {
+		case 2:
+			size = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+		case 4:
+			size = int(syncsafe(body[4:8]))
+		default:
+			size = int(binary.BigEndian.Uint32(body[4:8]))
+		}
+		if size < 0 || size > len(body)-headLen {
+			return
+		}
+		data := body[headLen : headLen+size]
+		body = body[headLen+size:]
+		switch id {
+		case "TIT2", "TT2":
+			info.setTag("TITLE", id3Text(data))
+		case "TPE1", "TP1":
+			info.setTag("ARTIST", id3Text(data))
+		case "TALB", "TAL":
+			info.setTag("ALBUM", id3Text(data))
+		case "TLEN", "TLE":
+			if ms, err := strconv.ParseInt(strings.TrimSpace(id3Text(data)), 10, 64); err == nil && ms > 0 {
+				info.Duration = seconds(float64(ms) / 1000)
+			}
+		}
+	}
+}
+
+// id3Text decodes a text frame, keeping the first of several values.
+func id3Text(data []byte) string {
+	if len(data) == 0 {
+		return ""
+	}
+	enc, text := data[0], data[1:]
+	var s string
+	switch enc {
+	case 1, 2:
+		s = utf16Text(text, enc == 2)
+	case 3:
+		s = string(text)
+	default:
+		s = latin1(text)
+	}
+	if i := strings.IndexByte(s, 0); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+func utf16Text(b []byte, bigEndian bool) string {
+	if len(b) >= 2 {
+		switch {
+		case b[0] == 0xFE && b[1] == 0xFF:
+			bigEndian, b = true, b[2:]
+		case b[0] == 0xFF && b[1] == 0xFE:
+			bigEndian, b = false, b[2:]
+		}
+	}
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u := binary.LittleEndian.Uint16(b[i:])
+		if bigEndian {
+			u = binary.BigEndian.Uint16(b[i:])
+		}
+		if u == 0 {
+			break
+		}
+		units = append(units, u)
+	}
+	return string(utf16.Decode(units))
+}
+
+func latin1(b []byte) string {
+	if i := bytes.IndexByte(b, 0); i >= 0 {
+		b = b[:i]
+	}
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return strings.TrimRight(string(runes), " ")
+}
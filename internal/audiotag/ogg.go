@@ -0,0 +1,125 @@
+package audiotag
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// oggTail is how much of the end of the file is searched for the last
+// page, whose granule position gives the length.
+const oggTail = 64 << 10
+
+// readOgg reads the identification and comment packets of the first
+// logical stream, Vorbis or Opus, and the granule position of the last
+// page.
+func readOgg(r io.ReaderAt, size int64) (*Info, error) {
+	info := &Info{Format: "ogg"}
+	packets, err := oggPackets(r, size, 2)
+	if err != nil {
+		return nil, err
+	}
+	var rate, preSkip uint64
+	id := packets[0]
+	switch {
+	case len(id) >= 16 && string(id[:7]) == "\x01vorbis":
+		rate = uint64(binary.LittleEndian.Uint32(id[12:16]))
+		if len(packets) > 1 && bytes.HasPrefix(packets[1], []byte("\x03vorbis")) {
+			readVorbisComment(packets[1][7:], info)
+		}
+	case len(id) >= 19 && string(id[:8]) == "OpusHead":
+		// Opus granules always count 48 kHz samples
+		rate = 48000
+		preSkip = uint64(binary.LittleEndian.Uint16(id[10:12]))
+		if len(packets) > 1 && bytes.HasPrefix(packets[1], []byte("OpusTags")) {
+			readVorbisComment(packets[1][8:], info)
+		}
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if rate == 0 {
+		return info, nil
+	}
+	if granule := lastGranule(r, size); granule > preSkip {
+		info.Duration = seconds(float64(granule-preSkip) / float64(rate))
+		info.Bitrate = averageBitrate(size, info.Duration)
+	}
+	return info, nil
+}
+
+// oggPackets reassembles the first n packets of the stream the first page
+// belongs to.
+func oggPackets(r io.ReaderAt, size int64, n int) ([][]byte, error) {
+	var packets [][]byte
+	var partial []byte
+	var serial uint32
+	read := 0
+	for off := int64(0); off+27 <= size && len(packets) < n && read < maxBlock; {
+		head, err := readFull(r, off, 27)
+		if err != nil {
+			return nil, err
+		}
+		if string(head[:4]) != "OggS" {
+			break
+		}
+		pageSerial := binary.LittleEndian.Uint32(head[14:18])
+		if off == 0 {
+			serial = pageSerial
+		}
+		segs, err := readFull(r, off+27, int(head[26]))
+		if err != nil {
+			return nil, err
+		}
+		bodyLen := 0
+		for _, s := range segs {
+			bodyLen += int(s)
+		}
+		body, err := readFull(r, off+27+int64(len(segs)), bodyLen)
+		if err != nil {
+			return nil, err
+		}
+		off += 27 + int64(len(segs)) + int64(bodyLen)
+		read += bodyLen
+		if pageSerial != serial {
+			continue
+		}
+		for _, s := range segs {
+			partial = append(partial, body[:s]...)
+			body = body[s:]
+			if s < 255 {
+				packets = append(packets, partial)
+				partial = nil
+			}
+		}
+	}
+	if len(packets) == 0 {
+		return nil, ErrUnknownFormat
+	}
+	return packets, nil
+}
+
+// lastGranule returns the granule position of the last page that has
+// one, or 0.
+func lastGranule(r io.ReaderAt, size int64) uint64 {
+	start := size - oggTail
+	if start < 0 {
+		start = 0
+	}
+	tail, err := readFull(r, start, int(size-start))
+	if err != nil {
+		return 0
+	}
+	for end := len(tail); end > 0; {
+		i := bytes.LastIndex(tail[:end], []byte("OggS"))
+		if i < 0 {
+			return 0
+		}
+		if i+14 <= len(tail) {
+			if g := binary.LittleEndian.Uint64(tail[i+6:]); g != ^uint64(0) {
+				return g
+			}
+		}
+		end = i
+	}
+	return 0
+}
@@ -0,0 +1,70 @@
+package audiotag
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// readWAV walks the RIFF chunks for the format, the size of the sample
+// data and LIST/INFO or embedded ID3 tags.
+func readWAV(r io.ReaderAt, size int64) (*Info, error) {
+	info := &Info{Format: "wav"}
+	var byteRate uint32
+	var dataSize int64 = -1
+	for off := int64(12); off+8 <= size; {
+		head, err := readFull(r, off, 8)
+		if err != nil {
+			break
+		}
+		id := string(head[:4])
+		n := int64(binary.LittleEndian.Uint32(head[4:]))
+		body := off + 8
+		switch id {
+		case "fmt ":
+			if fmtChunk, err := readFull(r, body, 16); err == nil {
+				byteRate = binary.LittleEndian.Uint32(fmtChunk[8:12])
+			}
+		case "data":
+			// streamed files leave the size at zero or 0xFFFFFFFF
+			dataSize = n
+			if n == 0 || n == 0xFFFFFFFF || body+n > size {
+				dataSize = size - body
+			}
+		case "LIST":
+			if n >= 4 && n <= maxBlock {
+				if list, err := readFull(r, body, int(n)); err == nil && string(list[:4]) == "INFO" {
+					readRIFFInfo(list[4:], info)
+				}
+			}
+		case "id3 ", "ID3 ":
+			if n >= 10 && n <= maxBlock {
+				if tag, err := readFull(r, body, int(n)); err == nil && id3Size(tag) > 0 {
+					parseID3v2(tag, info)
+				}
+			}
+		}
+		off = body + n + n&1
+	}
+	if byteRate == 0 || dataSize < 0 {
+		return nil, errors.New("audiotag: WAV file without format or data")
+	}
+	info.Bitrate = int(byteRate) * 8
+	info.Duration = seconds(float64(dataSize) / float64(byteRate))
+	return info, nil
+}
+
+func readRIFFInfo(b []byte, info *Info) {
+	for len(b) >= 8 {
+		id := string(b[:4])
+		n := int(binary.LittleEndian.Uint32(b[4:8]))
+		if n < 0 || n > len(b)-8 {
+			return
+		}
+		info.setTag(id, latin1(b[8:8+n]))
+		b = b[8+n:]
+		if n&1 == 1 && len(b) > 0 {
+			b = b[1:]
+		}
+	}
+}
@@ -0,0 +1,371 @@
+// Package automation runs the user's Starlark scripts. A script's top level
+// runs once when it loads and registers event handlers with on:
+//
+//	def doorbell(ev):
+//	    play("doorbell.wav")
+//	    broadcast("door: " + ev["text"])
+//
+//	on("hub-message", doorbell, match = "(?i)doorbell")
+//
+// A handler gets the event as a dict of its payload fields plus event,
+// text and peer. Scripts may call play, broadcast_play and broadcast;
+// call(action, payload) sends any hub action and returns its response;
+// sleep(seconds) waits; print goes to the host's log. The host adds its
+// own actions, such as upload, through Config.Actions.
+//
+// Starlark has no while loops or recursion, so every handler finishes; a
+// run's context stops its hub actions and sleeps, not its own loops.
+package automation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"time"
+
+	"brain/internal/hubclient"
+
+	"go.starlark.net/resolve"
+	"go.starlark.net/starlark"
+)
+
+func init() {
+	// scripts are small programs rather than configuration, so allow
+	// floats for sleep, lambdas and nested defs for handlers, and if and
+	// for at the top level
+	resolve.AllowFloat = true
+	resolve.AllowLambda = true
+	resolve.AllowNestedDef = true
+	resolve.AllowGlobalReassign = true
+}
+
+// thread-local keys
+const (
+	ctxKey     = "ctx"
+	loadingKey = "loading"
+)
+
+type Config struct {
+	// Client returns the connection hub actions go to; it may return nil
+	// while disconnected.
+	Client func() *hubclient.Client
+	// Actions are the host's own functions, callable from scripts with
+	// string arguments, e.g. upload("~/a.wav", "a.wav").
+	Actions map[string]func(ctx context.Context, args ...string) error
+	// Print receives print output with the script's name; nil discards it.
+	Print func(script, msg string)
+}
+
+// Script is one loaded file and the handlers its top level registered.
+type Script struct {
+	Name     string
+	Handlers []Handler
+	cfg      Config
+}
+
+// Handler is one on() registration.
+type Handler struct {
+	Event string
+	// Match, when set, must match the event's text.
+	Match *regexp.Regexp
+	fn    starlark.Callable
+	pos   string
+}
+
+// Handles reports whether h runs for event with the given text.
+func (h Handler) Handles(event, text string) bool {
+	return h.Event == event && (h.Match == nil || h.Match.MatchString(text))
+}
+
+// String is where the handler's function is defined, e.g. "door.star:1:5".
+func (h Handler) String() string { return h.pos }
+
+// Load runs src's top level under ctx. Any error, syntax or runtime, fails
+// the whole file so a broken script registers nothing.
+func Load(ctx context.Context, name string, src []byte, cfg Config) (*Script, error) {
+	s := &Script{Name: name, cfg: cfg}
+	thread := s.thread(ctx)
+	thread.SetLocal(loadingKey, true)
+	globals, err := starlark.ExecFile(thread, name, src, s.builtins())
+	if err != nil {
+		return nil, scriptError(err)
+	}
+	// handlers run concurrently; frozen values may be shared by threads
+	globals.Freeze()
+	for _, h := range s.Handlers {
+		h.fn.Freeze()
+	}
+	return s, nil
+}
+
+// Run calls h with the event's fields, which may be strings, numbers,
+// bools, nil, and slices and maps of those as decoded from JSON.
+func (s *Script) Run(ctx context.Context, h Handler, event map[string]any) error {
+	ev, err := toStarlark(event)
+	if err != nil {
+		return err
+	}
+	if _, err := starlark.Call(s.thread(ctx), h.fn, starlark.Tuple{ev}, nil); err != nil {
+		return scriptError(err)
+	}
+	return nil
+}
+
+func (s *Script) thread(ctx context.Context) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: s.Name,
+		Print: func(_ *starlark.Thread, msg string) {
+			if s.cfg.Print != nil {
+				s.cfg.Print(s.Name, msg)
+			}
+		},
+	}
+	thread.SetLocal(ctxKey, ctx)
+	return thread
+}
+
+// scriptError keeps the script position a Starlark runtime error carries,
+// which its message alone leaves out.
+func scriptError(err error) error {
+	var evalErr *starlark.EvalError
+	if !errors.As(err, &evalErr) {
+		return err
+	}
+	// the innermost frames may be builtins, which have no position
+	for i := range evalErr.CallStack {
+		if frame := evalErr.CallStack.At(i); frame.Pos.Line > 0 {
+			return fmt.Errorf("%s: %s", frame.Pos, evalErr.Msg)
+		}
+	}
+	return err
+}
+
+func threadContext(thread *starlark.Thread) context.Context {
+	if ctx, ok := thread.Local(ctxKey).(context.Context); ok {
+		return ctx
+	}
+	return context.Background()
+}
+
+type builtinFunc = func(*starlark.Thread, *starlark.Builtin, starlark.Tuple, []starlark.Tuple) (starlark.Value, error)
+
+func (s *Script) builtins() starlark.StringDict {
+	b := starlark.StringDict{
+		"on":             starlark.NewBuiltin("on", s.on),
+		"call":           starlark.NewBuiltin("call", s.call),
+		"play":           starlark.NewBuiltin("play", s.hubAction("play", "filename")),
+		"broadcast_play": starlark.NewBuiltin("broadcast_play", s.hubAction("broadcast-play", "filename")),
+		"broadcast":      starlark.NewBuiltin("broadcast", s.hubAction("broadcast", "message")),
+		"sleep":          starlark.NewBuiltin("sleep", sleepBuiltin),
+	}
+	for name, action := range s.cfg.Actions {
+		b[name] = starlark.NewBuiltin(name, hostAction(action))
+	}
+	return b
+}
+
+// on(event, fn, match=None) registers fn for event, only while the top
+// level runs.
+func (s *Script) on(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	if thread.Local(loadingKey) == nil {
+		return nil, errors.New("on: handlers can only be registered at the top level")
+	}
+	var event, match string
+	var fn starlark.Callable
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "event", &event, "fn", &fn, "match?", &match); err != nil {
+		return nil, err
+	}
+	if event == "" {
+		return nil, errors.New("on: event is empty")
+	}
+	h := Handler{Event: event, fn: fn, pos: s.Name}
+	if f, ok := fn.(*starlark.Function); ok {
+		h.pos = f.Position().String()
+	}
+	if match != "" {
+		re, err := regexp.Compile(match)
+		if err != nil {
+			return nil, fmt.Errorf("on: match: %w", err)
+		}
+		h.Match = re
+	}
+	s.Handlers = append(s.Handlers, h)
+	return starlark.None, nil
+}
+
+// call(action, payload=None) sends a hub action and returns its response.
+func (s *Script) call(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var action string
+	var payload starlark.Value = starlark.None
+	if err := starlark.UnpackArgs(b.Name(), args, kwargs, "action", &action, "payload?", &payload); err != nil {
+		return nil, err
+	}
+	body := map[string]any{}
+	if payload != starlark.None {
+		v, err := fromStarlark(payload)
+		if err != nil {
+			return nil, fmt.Errorf("call: payload: %w", err)
+		}
+		m, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("call: payload is %s, want dict", payload.Type())
+		}
+		body = m
+	}
+	var res any
+	if err := s.cfg.Client().Call(threadContext(thread), action, body, &res); err != nil {
+		return nil, fmt.Errorf("%s: %w", action, err)
+	}
+	return toStarlark(res)
+}
+
+// hubAction sends action with its one string argument as field.
+func (s *Script) hubAction(action, field string) builtinFunc {
+	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var arg string
+		if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &arg); err != nil {
+			return nil, err
+		}
+		if err := s.cfg.Client().Call(threadContext(thread), action, map[string]any{field: arg}, nil); err != nil {
+			return nil, fmt.Errorf("%s: %w", action, err)
+		}
+		return starlark.None, nil
+	}
+}
+
+func hostAction(action func(context.Context, ...string) error) builtinFunc {
+	return func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		if len(kwargs) > 0 {
+			return nil, fmt.Errorf("%s: unexpected keyword argument %s", b.Name(), kwargs[0][0])
+		}
+		strs := make([]string, len(args))
+		for i, v := range args {
+			str, ok := starlark.AsString(v)
+			if !ok {
+				return nil, fmt.Errorf("%s: argument %d is %s, want string", b.Name(), i+1, v.Type())
+			}
+			strs[i] = str
+		}
+		if err := action(threadContext(thread), strs...); err != nil {
+			return nil, fmt.Errorf("%s: %w", b.Name(), err)
+		}
+		return starlark.None, nil
+	}
+}
+
+func sleepBuiltin(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+	var v starlark.Value
+	if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &v); err != nil {
+		return nil, err
+	}
+	secs, ok := starlark.AsFloat(v)
+	if !ok || secs < 0 {
+		return nil, fmt.Errorf("sleep: want seconds, got %s", v)
+	}
+	t := time.NewTimer(time.Duration(secs * float64(time.Second)))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return starlark.None, nil
+	case <-threadContext(thread).Done():
+		return nil, threadContext(thread).Err()
+	}
+}
+
+// toStarlark converts a value decoded from JSON. Whole numbers become ints
+// so scripts can index and compare them as such.
+func toStarlark(v any) (starlark.Value, error) {
+	switch v := v.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case int:
+		return starlark.MakeInt(v), nil
+	case int64:
+		return starlark.MakeInt64(v), nil
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return starlark.MakeInt64(int64(v)), nil
+		}
+		return starlark.Float(v), nil
+	case []any:
+		elems := make([]starlark.Value, len(v))
+		for i, e := range v {
+			sv, err := toStarlark(e)
+			if err != nil {
+				return nil, err
+			}
+			elems[i] = sv
+		}
+		return starlark.NewList(elems), nil
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		d := starlark.NewDict(len(v))
+		for _, k := range keys {
+			sv, err := toStarlark(v[k])
+			if err != nil {
+				return nil, err
+			}
+			if err := d.SetKey(starlark.String(k), sv); err != nil {
+				return nil, err
+			}
+		}
+		return d, nil
+	}
+	return nil, fmt.Errorf("cannot pass %T to a script", v)
+}
+
+// fromStarlark converts a script value for a JSON payload.
+func fromStarlark(v starlark.Value) (any, error) {
+	switch v := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Int:
+		n, ok := v.Int64()
+		if !ok {
+			return nil, fmt.Errorf("int %s out of range", v)
+		}
+		return n, nil
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.Indexable:
+		out := make([]any, v.Len())
+		for i := range out {
+			e, err := fromStarlark(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			out[i] = e
+		}
+		return out, nil
+	case *starlark.Dict:
+		out := make(map[string]any, v.Len())
+		for _, item := range v.Items() {
+			k, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, fmt.Errorf("dict key %s is not a string", item[0])
+			}
+			e, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			out[k] = e
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cannot send %s", v.Type())
+}
@@ -0,0 +1,404 @@
+package fakehub
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"brain/internal/protocol"
+)
+
+// CannedPeers are the peers a default Server reports.
+func CannedPeers() []Peer {
+	return []Peer{
+		{ID: "peer-kitchen", Name: "kitchen"},
+		{ID: "peer-studio", Name: "studio"},
+		{ID: "peer-garage", Name: "garage"},
+	}
+}
+
+// CannedFiles are a few short tones, a text file and an image, enough to
+// exercise playing, previews and folders.
+func CannedFiles() []File {
+	return []File{
+		{Name: "chime.wav", ContentType: "audio/wav", Data: Tone(880, 0.4)},
+		{Name: "doorbell.wav", ContentType: "audio/wav", Data: Tone(660, 0.8)},
+		{Name: "sfx/alarm.wav", ContentType: "audio/wav", Data: Tone(1200, 1.2)},
+		{Name: "sfx/low-hum.wav", ContentType: "audio/wav", Data: Tone(110, 2)},
+		{Name: "notes/readme.txt", ContentType: "text/plain; charset=utf-8", Data: []byte("Files served by fakehub, the brain hub simulator.\n")},
+		{Name: "images/cover.png", ContentType: "image/png", Data: gradientPNG(64, 64)},
+	}
+}
+
+// Tone is a mono 16-bit 22.05 kHz WAV of a sine at freq Hz.
+func Tone(freq, seconds float64) []byte {
+	const rate = 22050
+	samples := int(seconds * rate)
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	b.WriteString("RIFF")
+	binary.Write(&b, le, uint32(36+samples*2))
+	b.WriteString("WAVEfmt ")
+	binary.Write(&b, le, uint32(16))
+	binary.Write(&b, le, uint16(1)) // PCM
+	binary.Write(&b, le, uint16(1))
+	binary.Write(&b, le, uint32(rate))
+	binary.Write(&b, le, uint32(rate*2))
+	binary.Write(&b, le, uint16(2))
+	binary.Write(&b, le, uint16(16))
+	b.WriteString("data")
+	binary.Write(&b, le, uint32(samples*2))
+	for i := 0; i < samples; i++ {
+		// fade the ends so the tone does not click
+		env := math.Min(1, math.Min(float64(i), float64(samples-i))/(rate/50))
+		v := int16(env * 0.3 * math.MaxInt16 * math.Sin(2*math.Pi*freq*float64(i)/rate))
+		binary.Write(&b, le, v)
+	}
+	return b.Bytes()
+}
+
+func gradientPNG(w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * 255 / w), uint8(y * 255 / h), 160, 255})
+		}
+	}
+	var b bytes.Buffer
+	png.Encode(&b, img)
+	return b.Bytes()
+}
+
+var commands = []string{"help", "put", "get", "delete", "keys", "peers", "whoami", "benchmark", "audio", "tags"}
+
+// benchmarkStep is how long each simulated peer takes to report.
+const benchmarkStep = 150 * time.Millisecond
+
+// command answers a hub console command the way the hub does, as an
+// object naming the command with either its result or an error.
+func (s *Server) command(line string) map[string]any {
+	parts := strings.Fields(line)
+	if len(parts) == 0 {
+		return map[string]any{"error": "empty command"}
+	}
+	cmd := strings.ToLower(parts[0])
+	usage := func(text string) map[string]any {
+		return map[string]any{"command": cmd, "error": "Usage: " + text}
+	}
+	switch cmd {
+	case "help":
+		return map[string]any{"command": "help", "data": commands}
+	case "put":
+		if len(parts) < 3 {
+			return usage("put <key> <value>")
+		}
+		s.mu.Lock()
+		s.keys[parts[1]] = strings.Join(parts[2:], " ")
+		s.mu.Unlock()
+		return map[string]any{"command": "put", "key": parts[1], "success": true}
+	case "get":
+		if len(parts) < 2 {
+			return usage("get <key>")
+		}
+		s.mu.Lock()
+		value, ok := s.keys[parts[1]]
+		s.mu.Unlock()
+		if !ok {
+			return map[string]any{"command": "get", "key": parts[1], "value": nil}
+		}
+		return map[string]any{"command": "get", "key": parts[1], "value": value}
+	case "delete":
+		if len(parts) < 2 {
+			return usage("delete <key>")
+		}
+		s.mu.Lock()
+		_, ok := s.keys[parts[1]]
+		delete(s.keys, parts[1])
+		s.mu.Unlock()
+		return map[string]any{"command": "delete", "key": parts[1], "deleted": ok}
+	case "keys":
+		s.mu.Lock()
+		keys := make([]string, 0, len(s.keys))
+		for k := range s.keys {
+			keys = append(keys, k)
+		}
+		s.mu.Unlock()
+		sort.Strings(keys)
+		return map[string]any{"command": "keys", "keys": keys, "count": len(keys)}
+	case "peers":
+		return map[string]any{"command": "peers", "peers": s.cfg.Peers}
+	case "whoami":
+		return map[string]any{"command": "whoami", "id": s.cfg.ID}
+	case "benchmark":
+		results := make([]map[string]any, 0, len(s.cfg.Peers))
+		for i := range s.cfg.Peers {
+			results = append(results, s.benchmarkResult(i))
+		}
+		return benchmarkSummary(results)
+	case "audio":
+		if len(parts) < 2 {
+			return usage("audio <list|get|delete|usage> [filename]")
+		}
+		switch strings.ToLower(parts[1]) {
+		case "list":
+			return map[string]any{"command": "audio", "files": s.fileList()}
+		case "get":
+			if len(parts) < 3 {
+				return usage("audio get <filename>")
+			}
+			info, err := s.fileInfo(parts[2])
+			if err != nil {
+				return map[string]any{"command": "audio", "exists": false, "filename": parts[2]}
+			}
+			info["command"] = "audio"
+			return info
+		case "delete":
+			if len(parts) < 3 {
+				return usage("audio delete <filename>")
+			}
+			s.mu.Lock()
+			_, ok := s.files[parts[2]]
+			delete(s.files, parts[2])
+			delete(s.tags, parts[2])
+			s.mu.Unlock()
+			if !ok {
+				return map[string]any{"command": "audio", "error": fmt.Sprintf("%s not found", parts[2])}
+			}
+			return map[string]any{"command": "audio", "deleted": parts[2]}
+		case "usage":
+			used, count := s.usage()
+			return map[string]any{"command": "audio", "used": used, "total": used, "quota": s.cfg.Quota, "files": count}
+		}
+		return usage("audio <list|get|delete|usage> [filename]")
+	case "tags":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		all := make(map[string][]string, len(s.tags))
+		for k, v := range s.tags {
+			all[k] = v
+		}
+		return map[string]any{"command": "tags", "action": "list", "tags": all}
+	}
+	return map[string]any{"command": cmd, "error": "Unknown command: " + cmd, "available": commands}
+}
+
+// benchmarkResult is the canned report of the i'th peer.
+func (s *Server) benchmarkResult(i int) map[string]any {
+	p := s.cfg.Peers[i]
+	ms := 40 + 15*float64(i)
+	return map[string]any{"clientId": p.ID, "name": p.Name, "durationMs": ms, "iterations": 50000, "opsPerSecond": math.Round(50000 / ms * 1000)}
+}
+
+// pingPeer answers a peer-ping with a canned round trip that grows with
+// the peers' places in the list; offline or unknown peers do not answer.
+func (s *Server) pingPeer(from, peer string) map[string]any {
+	res := map[string]any{"peer": peer}
+	if from != "" && from != s.cfg.ID {
+		res["from"] = from
+	}
+	hops := 0
+	for _, id := range []string{from, peer} {
+		if id == "" || id == s.cfg.ID {
+			continue
+		}
+		i := s.peerIndex(id)
+		if i < 0 || s.cfg.Peers[i].Offline {
+			res["reachable"] = false
+			res["error"] = fmt.Sprintf("%s is not connected", id)
+			return res
+		}
+		hops += i + 1
+	}
+	res["reachable"] = true
+	res["latencyMs"] = 12 + 9*float64(hops)
+	return res
+}
+
+// peerShare is what every online canned peer shares: a tone in its top
+// folder and two more under music/.
+var peerShare = map[string][]File{
+	"":      {{Name: "music", Modified: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}, {Name: "hello.wav", Data: Tone(440, 0.5)}},
+	"music": {{Name: "ding.wav", Data: Tone(990, 0.3)}, {Name: "drone.wav", Data: Tone(220, 1.5)}},
+}
+
+// peerFiles lists path in peer's share the way a peer's client answers
+// peer-files; ok is false when there is no such folder.
+func peerFiles(path string) (files []map[string]any, ok bool) {
+	share, ok := peerShare[strings.Trim(path, "/")]
+	for _, f := range share {
+		if _, dir := peerShare[f.Name]; dir {
+			files = append(files, map[string]any{"name": f.Name, "dir": true, "modified": f.Modified.Format(time.RFC3339)})
+			continue
+		}
+		files = append(files, map[string]any{"name": f.Name, "size": len(f.Data)})
+	}
+	return files, ok
+}
+
+// peerFile is filename from a peer's share, for peer-upload.
+func peerFile(filename string) (*File, bool) {
+	dir, name := "", strings.Trim(filename, "/")
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		dir, name = name[:i], name[i+1:]
+	}
+	for _, f := range peerShare[dir] {
+		if f.Name == name && f.Data != nil {
+			return &f, true
+		}
+	}
+	return nil, false
+}
+
+// peerControlStep is how long each phase of a simulated peer restart or
+// update takes.
+const peerControlStep = 100 * time.Millisecond
+
+// controlPeer plays out a restart or update of peer as peer-control
+// events, one phase per step.
+func (s *Server) controlPeer(action, peer string) string {
+	s.mu.Lock()
+	s.nextID++
+	id := fmt.Sprintf("peer-%s-%d", action, s.nextID)
+	s.mu.Unlock()
+	phases := [][2]string{{"requested", ""}}
+	if action == "update" {
+		phases = append(phases, [2]string{"updating", "fetching the latest client"}, [2]string{"updating", "installing"})
+	}
+	phases = append(phases, [2]string{"restarting", ""}, [2]string{"done", "back online"})
+	go func() {
+		for i, phase := range phases {
+			if i > 0 {
+				select {
+				case <-s.done:
+					return
+				case <-time.After(peerControlStep):
+				}
+			}
+			event := map[string]any{"operationId": id, "peer": peer, "action": action, "phase": phase[0]}
+			if phase[1] != "" {
+				event["message"] = phase[1]
+			}
+			s.Emit(protocol.EventPeerControl, event)
+		}
+	}()
+	return id
+}
+
+// transferAnswerDelay is how long a simulated peer takes to accept a
+// direct transfer.
+const transferAnswerDelay = 50 * time.Millisecond
+
+// offerTransfer brokers a direct transfer to a simulated peer, which
+// accepts it without endpoints: it cannot be dialled, so the sender has to
+// fall back to the relay.
+func (s *Server) offerTransfer(c *conn, req map[string]any) (any, error) {
+	peer, err := stringArg(req, "peer")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := stringArg(req, "filename"); err != nil {
+		return nil, err
+	}
+	if _, err := stringArg(req, "token"); err != nil {
+		return nil, err
+	}
+	if i := s.peerIndex(peer); i < 0 || s.cfg.Peers[i].Offline {
+		return nil, hubError(protocol.CodeNotFound, "%s is not connected", peer)
+	}
+	s.mu.Lock()
+	s.nextID++
+	id := fmt.Sprintf("transfer-%d", s.nextID)
+	s.transfers[id] = peer
+	s.mu.Unlock()
+	time.AfterFunc(transferAnswerDelay, func() {
+		c.event(protocol.EventTransferAnswer, map[string]any{"transferId": id, "from": peer, "accept": true, "endpoints": []string{}})
+	})
+	return map[string]any{"transferId": id}, nil
+}
+
+// cancelTransfer ends a brokered transfer. With fallback "relay" the
+// simulated peer fetches the named file, which has to be on the hub.
+func (s *Server) cancelTransfer(req map[string]any) (any, error) {
+	id, err := stringArg(req, "transferId")
+	if err != nil {
+		return nil, err
+	}
+	filename, _ := req["filename"].(string)
+	relay := req["fallback"] == "relay"
+	s.mu.Lock()
+	peer, ok := s.transfers[id]
+	_, stored := s.files[filename]
+	if ok && (!relay || stored) {
+		delete(s.transfers, id)
+	}
+	s.mu.Unlock()
+	switch {
+	case !ok:
+		return nil, hubError(protocol.CodeNotFound, "unknown transfer %s", id)
+	case relay && !stored:
+		return nil, hubError(protocol.CodeInvalid, "relayed file %q is not on the hub", filename)
+	case relay:
+		s.logf("info", "%s fetched %s relayed for transfer %s", peer, filename, id)
+	}
+	return map[string]any{}, nil
+}
+
+// syncPlayLead is how far ahead a synchronized broadcast-play starts,
+// time enough for every peer to have the file.
+const syncPlayLead = 200 * time.Millisecond
+
+// playAt starts filename on every peer at once when start comes, unless
+// a broadcast-stop came after stops were counted.
+func (s *Server) playAt(start time.Time, stops int, peers []Peer, filename string, loop bool) {
+	select {
+	case <-s.done:
+		return
+	case <-time.After(time.Until(start)):
+	}
+	s.mu.Lock()
+	stopped := s.stops != stops
+	s.mu.Unlock()
+	if stopped {
+		return
+	}
+	for _, p := range peers {
+		s.startPlaying(p.ID, filename, loop)
+	}
+}
+
+// stopAll is broadcast-stop: every peer's playback ends, loops included.
+func (s *Server) stopAll() {
+	s.mu.Lock()
+	s.stops++
+	now := time.Now()
+	var stopped []nowPlaying
+	for peer, np := range s.playing {
+		np.State = "stopped"
+		stopped = append(stopped, np.at(now))
+		delete(s.playing, peer)
+	}
+	s.mu.Unlock()
+	for _, np := range stopped {
+		s.Emit(protocol.EventNowPlaying, np)
+	}
+}
+
+func (s *Server) peerIndex(id string) int {
+	for i, p := range s.cfg.Peers {
+		if p.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func benchmarkSummary(results []map[string]any) map[string]any {
+	return map[string]any{"command": "benchmark", "participants": len(results), "responded": len(results), "results": results}
+}
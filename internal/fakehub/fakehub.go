@@ -0,0 +1,1843 @@
+// Package fakehub simulates the hub's socket interface with canned peers,
+// files and events, so clients can be run and tested without a real hub.
+package fakehub
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"brain/internal/protocol"
+)
+
+// Capabilities are what the simulator advertises in its hello.
+var Capabilities = []string{
+	protocol.CapChunkedUpload,
+	protocol.CapPlayback,
+	protocol.CapNowPlaying,
+	protocol.CapHash,
+	protocol.CapPeerFiles,
+	protocol.CapSubscribe,
+	protocol.CapLogs,
+	protocol.CapTags,
+	protocol.CapDelete,
+	protocol.CapStorage,
+	protocol.CapBroadcastPlan,
+	protocol.CapAudit,
+	protocol.CapClipboard,
+	protocol.CapKV,
+	protocol.CapChat,
+	protocol.CapBroadcastImage,
+	protocol.CapCommandStream,
+	protocol.CapJobs,
+	protocol.CapPeerPing,
+	protocol.CapPeerControl,
+	protocol.CapPeerConfig,
+	protocol.CapZones,
+	protocol.CapSyncPlay,
+	protocol.CapBroadcastStop,
+	protocol.CapNormalize,
+	protocol.CapStats,
+	protocol.CapMove,
+	protocol.CapTrash,
+	protocol.CapAudioStream,
+	protocol.CapTemporary,
+	protocol.CapDirectTransfer,
+}
+
+// Config sets up a Server. The zero value serves the canned peers and
+// files with no periodic events.
+type Config struct {
+	// ID is the simulated client's own peer id.
+	ID    string
+	Peers []Peer
+	Files []File
+	// EventInterval is how often a canned event is pushed; zero turns
+	// them off.
+	EventInterval time.Duration
+	// Quota limits the bytes stored; zero is unlimited.
+	Quota int64
+	// Role is sent in the hello and enforced; empty sends none, which
+	// clients treat as admin.
+	Role protocol.Role
+	// Without leaves these Capabilities out of the hello, to stand in
+	// for an older hub.
+	Without []string
+	// Logf receives the simulator's own log lines; nil discards them.
+	Logf func(format string, args ...any)
+}
+
+type Peer struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Offline peers are listed but never answer a peer-ping.
+	Offline bool `json:"-"`
+}
+
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+	Modified    time.Time
+	// Loudness, in LUFS, and ReplayGain, in dB, are what the uploader
+	// measured; both are zero when it did not.
+	Loudness   float64
+	ReplayGain float64
+
+	// expires is when a temporary upload is removed, and owner the
+	// client whose disconnect removes one with no TTL.
+	expires time.Time
+	owner   *conn
+}
+
+// Server is a running simulator. Its methods are safe for concurrent use.
+type Server struct {
+	cfg Config
+
+	mu       sync.Mutex
+	files    map[string]*File
+	tags     map[string][]string
+	keys     map[string]string
+	uploads  map[string]*pendingUpload
+	logs     []logEntry
+	conns    map[*conn]bool
+	playing  map[string]*nowPlaying
+	nextID   int
+	httpHost string
+	tick     int
+	requests []Request
+	audit    []auditEntry
+	kv       map[string]kvEntry
+	chat     []chatMessage
+	// peerConfigs are the stored peer settings, by peer id
+	peerConfigs map[string]peerConfig
+	// zones are the stored peer groups, by name
+	zones map[string]zone
+	// plays are the broadcast-play counts, by file name
+	plays map[string]*playStats
+	// trash holds deleted files until they are restored or purged, by
+	// their old name
+	trash map[string]*trashed
+	// stops counts broadcast-stops, so a synchronized start still
+	// waiting when one comes never begins
+	stops int
+	// commands are the started commands by id, waiting or running
+	commands map[string]*startedCommand
+	// transfers are the direct transfers offered to simulated peers, by
+	// transferId, with the peer each went to
+	transfers map[string]string
+
+	socket    net.Listener
+	http      *http.Server
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Request is a request as the simulator received it.
+type Request struct {
+	Action  string
+	Payload map[string]any
+	// Error is the error it was answered with, if any.
+	Error string
+}
+
+// maxRequests bounds the request log, and maxAudit the audit trail.
+const (
+	maxRequests = 1000
+	maxAudit    = 500
+)
+
+// Requests returns the requests received so far, oldest first.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+func (s *Server) logRequest(action string, req map[string]any, err error) {
+	r := Request{Action: action, Payload: req}
+	if err != nil {
+		r.Error = err.Error()
+	}
+	s.mu.Lock()
+	s.requests = append(s.requests, r)
+	if len(s.requests) > maxRequests {
+		s.requests = s.requests[len(s.requests)-maxRequests:]
+	}
+	s.mu.Unlock()
+}
+
+// auditedArgs names the member that identifies each audited action's
+// target.
+var auditedArgs = map[string]string{
+	"broadcast":      "message",
+	"broadcast-play": "filename",
+	"upload":         "filename",
+	"upload-commit":  "filename",
+	"delete":         "filename",
+	"restore":        "filename",
+	"purge":          "filename",
+	"tags":           "filename",
+}
+
+// recordAudit adds a successful action to the audit trail. Every client
+// of the simulator acts as its own peer id.
+func (s *Server) recordAudit(action string, req map[string]any, data any) {
+	arg, ok := auditedArgs[action]
+	if !ok {
+		return
+	}
+	target, _ := req[arg].(string)
+	if result, ok := data.(map[string]any); ok && target == "" {
+		target, _ = result[arg].(string)
+	}
+	if action == "tags" && target == "" {
+		// reading the tags changes nothing
+		return
+	}
+	if action == "upload-commit" {
+		action = "upload"
+	}
+	s.mu.Lock()
+	s.audit = append(s.audit, auditEntry{
+		Time:   time.Now().UTC().Format(time.RFC3339),
+		Actor:  s.cfg.ID,
+		Action: action,
+		Target: target,
+	})
+	if len(s.audit) > maxAudit {
+		s.audit = s.audit[len(s.audit)-maxAudit:]
+	}
+	s.mu.Unlock()
+}
+
+type pendingUpload struct {
+	filename    string
+	contentType string
+	size        int64
+	sha256      string
+	meta        map[string]any
+	data        []byte
+	created     time.Time
+	// ttl and onDisconnect are what upload-begin asked for a temporary
+	// upload.
+	ttl          time.Duration
+	onDisconnect bool
+}
+
+type logEntry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Source  string `json:"source,omitempty"`
+}
+
+type kvEntry struct {
+	Key       string `json:"key"`
+	Value     string `json:"value,omitempty"`
+	By        string `json:"by,omitempty"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	Deleted   bool   `json:"deleted,omitempty"`
+
+	expires time.Time
+}
+
+// kvEntries lists the live keys starting with prefix, sorted. Callers hold
+// s.mu.
+func (s *Server) kvEntries(prefix string) []kvEntry {
+	now := time.Now()
+	out := []kvEntry{}
+	for key, e := range s.kv {
+		if !e.expires.IsZero() && !now.Before(e.expires) {
+			delete(s.kv, key)
+			continue
+		}
+		if strings.HasPrefix(key, prefix) {
+			out = append(out, e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// setKV stores or, with a nil value, deletes a key and sends a kv event to
+// the connections watching it.
+func (s *Server) setKV(req map[string]any) (kvEntry, error) {
+	key, err := stringArg(req, "key")
+	if err != nil {
+		return kvEntry{}, err
+	}
+	if len(key) > protocol.MaxKVKeyBytes {
+		return kvEntry{}, hubError(protocol.CodeTooLarge, "key over %d bytes", protocol.MaxKVKeyBytes)
+	}
+	now := time.Now()
+	e := kvEntry{Key: key, By: s.cfg.ID, UpdatedAt: now.UTC().Format(time.RFC3339)}
+	switch value := req["value"].(type) {
+	case nil:
+		e.Deleted = true
+	case string:
+		if len(value) > protocol.MaxKVValueBytes {
+			return kvEntry{}, hubError(protocol.CodeTooLarge, "value over %d bytes", protocol.MaxKVValueBytes)
+		}
+		e.Value = value
+		if ttl, ok := req["ttl"].(float64); ok && ttl > 0 {
+			e.expires = now.Add(time.Duration(ttl * float64(time.Second)))
+			e.ExpiresAt = e.expires.UTC().Format(time.RFC3339)
+		}
+	default:
+		return kvEntry{}, hubError(protocol.CodeInvalid, "value must be a string or null")
+	}
+	s.mu.Lock()
+	if s.kv == nil {
+		s.kv = make(map[string]kvEntry)
+	}
+	if e.Deleted {
+		delete(s.kv, key)
+	} else {
+		s.kv[key] = e
+	}
+	var watchers []*conn
+	for c := range s.conns {
+		for _, prefix := range c.watches {
+			if strings.HasPrefix(key, prefix) {
+				watchers = append(watchers, c)
+				break
+			}
+		}
+	}
+	s.mu.Unlock()
+	for _, c := range watchers {
+		c.event(protocol.EventKV, e)
+	}
+	return e, nil
+}
+
+type peerConfig struct {
+	Peer      string `json:"peer"`
+	Volume    *int   `json:"volume,omitempty"`
+	UpdatedBy string `json:"updatedBy,omitempty"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+}
+
+// setPeerConfig stores a peer-config-set request and tells every client.
+func (s *Server) setPeerConfig(req map[string]any) (peerConfig, error) {
+	peer, err := stringArg(req, "peer")
+	if err != nil {
+		return peerConfig{}, err
+	}
+	v, ok := req["volume"].(float64)
+	if !ok || v != float64(int(v)) || v < 0 || v > protocol.MaxPeerVolume {
+		return peerConfig{}, hubError(protocol.CodeInvalid, "volume must be a whole number from 0 to %d", protocol.MaxPeerVolume)
+	}
+	volume := int(v)
+	s.mu.Lock()
+	if s.peerConfigs == nil {
+		s.peerConfigs = make(map[string]peerConfig)
+	}
+	pc := peerConfig{Peer: peer, Volume: &volume, UpdatedBy: s.cfg.ID, UpdatedAt: time.Now().UTC().Format(time.RFC3339)}
+	s.peerConfigs[peer] = pc
+	s.mu.Unlock()
+	s.Emit(protocol.EventPeerConfig, pc)
+	return pc, nil
+}
+
+func (s *Server) peerConfigList() []peerConfig {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]peerConfig, 0, len(s.peerConfigs))
+	for _, pc := range s.peerConfigs {
+		out = append(out, pc)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Peer < out[j].Peer })
+	return out
+}
+
+type zone struct {
+	Name      string   `json:"name"`
+	Peers     []string `json:"peers"`
+	Deleted   bool     `json:"deleted,omitempty"`
+	UpdatedBy string   `json:"updatedBy,omitempty"`
+	UpdatedAt string   `json:"updatedAt,omitempty"`
+}
+
+// setZone stores a zone-set request and tells every client.
+func (s *Server) setZone(req map[string]any) (zone, error) {
+	name, err := stringArg(req, "zone")
+	if err != nil {
+		return zone{}, err
+	}
+	list, ok := req["peers"].([]any)
+	if !ok {
+		return zone{}, hubError(protocol.CodeInvalid, "peers must be a list of peer ids")
+	}
+	z := zone{Name: name, Peers: []string{}, UpdatedBy: s.cfg.ID, UpdatedAt: time.Now().UTC().Format(time.RFC3339)}
+	seen := make(map[string]bool)
+	for _, v := range list {
+		id, _ := v.(string)
+		if id == "" {
+			return zone{}, hubError(protocol.CodeInvalid, "peers must be a list of peer ids")
+		}
+		if !seen[id] {
+			seen[id] = true
+			z.Peers = append(z.Peers, id)
+		}
+	}
+	s.mu.Lock()
+	if s.zones == nil {
+		s.zones = make(map[string]zone)
+	}
+	s.zones[name] = z
+	s.mu.Unlock()
+	s.Emit(protocol.EventZone, z)
+	return z, nil
+}
+
+func (s *Server) deleteZone(req map[string]any) (bool, error) {
+	name, err := stringArg(req, "zone")
+	if err != nil {
+		return false, err
+	}
+	s.mu.Lock()
+	_, ok := s.zones[name]
+	delete(s.zones, name)
+	s.mu.Unlock()
+	if ok {
+		s.Emit(protocol.EventZone, zone{Name: name, Deleted: true})
+	}
+	return ok, nil
+}
+
+type playStats struct {
+	Name       string `json:"name"`
+	Plays      int    `json:"plays"`
+	LastPlayed string `json:"lastPlayed"`
+}
+
+func (s *Server) countPlay(filename string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.plays == nil {
+		s.plays = make(map[string]*playStats)
+	}
+	p := s.plays[filename]
+	if p == nil {
+		p = &playStats{Name: filename}
+		s.plays[filename] = p
+	}
+	p.Plays++
+	p.LastPlayed = time.Now().UTC().Format(time.RFC3339)
+}
+
+// playStatsList is the "stats" answer: most played first.
+func (s *Server) playStatsList() []playStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]playStats, 0, len(s.plays))
+	for _, p := range s.plays {
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Plays != out[j].Plays {
+			return out[i].Plays > out[j].Plays
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
+
+func (s *Server) zoneList() []zone {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]zone, 0, len(s.zones))
+	for _, z := range s.zones {
+		out = append(out, z)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// recipients are the peers a broadcast reaches: those in the request's
+// zone, or every peer without one.
+func (s *Server) recipients(req map[string]any) ([]Peer, error) {
+	name, _ := req["zone"].(string)
+	if name == "" {
+		return s.cfg.Peers, nil
+	}
+	s.mu.Lock()
+	z, ok := s.zones[name]
+	s.mu.Unlock()
+	if !ok {
+		return nil, hubError(protocol.CodeNotFound, "no zone %s", name)
+	}
+	var out []Peer
+	for _, id := range z.Peers {
+		if i := s.peerIndex(id); i >= 0 {
+			out = append(out, s.cfg.Peers[i])
+		}
+	}
+	return out, nil
+}
+
+// selfHears reports whether this client hears a broadcast it sends to
+// peers: always without a zone, and with one only as a member.
+func (s *Server) selfHears(req map[string]any, peers []Peer) bool {
+	if name, _ := req["zone"].(string); name == "" {
+		return true
+	}
+	for _, p := range peers {
+		if p.ID == s.cfg.ID {
+			return true
+		}
+	}
+	return false
+}
+
+type chatMessage struct {
+	ID      string `json:"id"`
+	Channel string `json:"channel"`
+	From    string `json:"from"`
+	Text    string `json:"text"`
+	Time    string `json:"time"`
+}
+
+type auditEntry struct {
+	Time   string `json:"time"`
+	Actor  string `json:"actor"`
+	Action string `json:"action"`
+	Target string `json:"target,omitempty"`
+}
+
+type nowPlaying struct {
+	Peer     string  `json:"peer"`
+	Filename string  `json:"filename"`
+	Position float64 `json:"position"`
+	Duration float64 `json:"duration"`
+	State    string  `json:"state"`
+	Volume   *int    `json:"volume,omitempty"`
+	Loop     bool    `json:"loop,omitempty"`
+	started  time.Time
+}
+
+// New prepares a server; Start listens.
+func New(cfg Config) *Server {
+	if cfg.ID == "" {
+		cfg.ID = "fakehub-self"
+	}
+	if cfg.Peers == nil {
+		cfg.Peers = CannedPeers()
+	}
+	if cfg.Files == nil {
+		cfg.Files = CannedFiles()
+	}
+	s := &Server{
+		cfg:       cfg,
+		files:     make(map[string]*File),
+		tags:      map[string][]string{"chime.wav": {"alert"}},
+		keys:      make(map[string]string),
+		uploads:   make(map[string]*pendingUpload),
+		conns:     make(map[*conn]bool),
+		playing:   make(map[string]*nowPlaying),
+		commands:  make(map[string]*startedCommand),
+		transfers: make(map[string]string),
+		done:      make(chan struct{}),
+	}
+	for _, f := range cfg.Files {
+		f := f
+		if f.Modified.IsZero() {
+			f.Modified = time.Now().UTC().Truncate(time.Second)
+		}
+		s.files[f.Name] = &f
+	}
+	return s
+}
+
+// Start listens for socket clients on socketAddr and serves files over
+// HTTP on httpAddr. Either may use port 0.
+func (s *Server) Start(socketAddr, httpAddr string) error {
+	hl, err := net.Listen("tcp", httpAddr)
+	if err != nil {
+		return err
+	}
+	sl, err := net.Listen("tcp", socketAddr)
+	if err != nil {
+		hl.Close()
+		return err
+	}
+	s.socket = sl
+	s.httpHost = "ws://" + hl.Addr().String()
+	s.http = &http.Server{Handler: http.HandlerFunc(s.serveHTTP), ReadHeaderTimeout: 10 * time.Second}
+	go s.http.Serve(hl)
+	go s.accept()
+	if s.cfg.EventInterval > 0 {
+		go s.events()
+	}
+	s.logf("info", "listening on %s, files on %s", sl.Addr(), hl.Addr())
+	return nil
+}
+
+// SocketAddr is where clients connect.
+func (s *Server) SocketAddr() string { return s.socket.Addr().String() }
+
+// Host is the URL reported as the hub's host; /audio/<name> under it
+// serves the stored files.
+func (s *Server) Host() string { return s.httpHost }
+
+// Close stops listening and drops every client. Later calls do nothing.
+func (s *Server) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		close(s.done)
+		err = s.socket.Close()
+		s.http.Close()
+		s.mu.Lock()
+		for c := range s.conns {
+			c.raw.Close()
+		}
+		s.mu.Unlock()
+	})
+	return err
+}
+
+func (s *Server) logf(level, format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	if s.cfg.Logf != nil {
+		s.cfg.Logf("%s", msg)
+	}
+	entry := logEntry{Time: time.Now().UTC().Format(time.RFC3339), Level: level, Message: msg, Source: "fakehub"}
+	s.mu.Lock()
+	s.logs = append(s.logs, entry)
+	if len(s.logs) > 500 {
+		s.logs = s.logs[len(s.logs)-500:]
+	}
+	s.mu.Unlock()
+}
+
+// conn is one socket client; writes are serialised by mu.
+type conn struct {
+	raw net.Conn
+	mu  sync.Mutex
+	// watches are the key prefixes of kv-watch requests, guarded by
+	// Server.mu.
+	watches []string
+	// events, when set by subscribe, are the only events Emit sends
+	// here; closing statusStop ends the subscription's status pushes.
+	// Both are guarded by Server.mu.
+	events     map[string]bool
+	statusStop chan struct{}
+}
+
+func (c *conn) send(msg map[string]any) {
+	line, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("fakehub: encode: %v", err)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.raw.Write(append(line, '\n'))
+}
+
+func (c *conn) event(name string, payload any) {
+	c.send(map[string]any{"type": "event", "event": name, "payload": payload})
+}
+
+// Emit pushes an event to every connected client that did not subscribe
+// to others only.
+func (s *Server) Emit(name string, payload any) {
+	s.mu.Lock()
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		if c.events == nil || c.events[name] {
+			conns = append(conns, c)
+		}
+	}
+	s.mu.Unlock()
+	for _, c := range conns {
+		c.event(name, payload)
+	}
+}
+
+func (s *Server) accept() {
+	for {
+		raw, err := s.socket.Accept()
+		if err != nil {
+			return
+		}
+		c := &conn{raw: raw}
+		s.mu.Lock()
+		s.conns[c] = true
+		s.mu.Unlock()
+		go s.serve(c)
+	}
+}
+
+func (s *Server) serve(c *conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		if c.statusStop != nil {
+			close(c.statusStop)
+			c.statusStop = nil
+		}
+		var gone []string
+		for name, f := range s.files {
+			if f.owner == c {
+				delete(s.files, name)
+				delete(s.tags, name)
+				gone = append(gone, name)
+			}
+		}
+		s.mu.Unlock()
+		c.raw.Close()
+		for _, name := range gone {
+			s.logf("info", "removed temporary %s: its uploader disconnected", name)
+		}
+	}()
+	s.logf("info", "client connected from %s", c.raw.RemoteAddr())
+	c.event(protocol.EventHello, map[string]any{
+		"host":         s.httpHost,
+		"connectedAt":  time.Now().UTC().Format(time.RFC3339),
+		"version":      protocol.Version,
+		"capabilities": s.capabilities(),
+		"role":         s.cfg.Role,
+	})
+	c.event(protocol.EventStatus, s.status())
+	scanner := bufio.NewScanner(c.raw)
+	scanner.Buffer(make([]byte, 64<<10), protocol.MaxFrameSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var req map[string]any
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			c.send(map[string]any{"type": "error", "ok": false, "error": "invalid json"})
+			continue
+		}
+		id, _ := req["id"].(string)
+		action, _ := req["type"].(string)
+		if id == "" {
+			c.send(map[string]any{"type": "error", "ok": false, "error": "request id is required"})
+			continue
+		}
+		delete(req, "id")
+		delete(req, "type")
+		data, err := s.handle(c, action, req)
+		s.logRequest(action, req, err)
+		if err == nil {
+			s.recordAudit(action, req, data)
+		}
+		if err != nil {
+			var hubErr *protocol.Error
+			if !errors.As(err, &hubErr) {
+				hubErr = &protocol.Error{Message: err.Error()}
+			}
+			c.send(map[string]any{"id": id, "type": action, "ok": false, "error": hubErr})
+			continue
+		}
+		c.send(map[string]any{"id": id, "type": action, "ok": true, "data": data})
+		if action == "bye" {
+			return
+		}
+	}
+	if err := scanner.Err(); err != nil && !errors.Is(err, net.ErrClosed) {
+		s.logf("warn", "client %s: %v", c.raw.RemoteAddr(), err)
+	}
+}
+
+func hubError(code protocol.Code, format string, args ...any) error {
+	return &protocol.Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func stringArg(req map[string]any, name string) (string, error) {
+	v, _ := req[name].(string)
+	if v == "" {
+		return "", hubError(protocol.CodeInvalid, "%s is required", name)
+	}
+	return v, nil
+}
+
+// permit is the hub's side of the role check, which clients also make
+// before sending.
+func (s *Server) permit(action string, req map[string]any) error {
+	role := s.cfg.Role
+	if role == "" || role == protocol.RoleAdmin {
+		return nil
+	}
+	allowed := role.Allows(action)
+	if role == protocol.RoleReadOnly {
+		switch action {
+		case "command", "command-start":
+			command, _ := req["command"].(string)
+			allowed = protocol.ReadOnlyCommand(command)
+		case "tags":
+			_, setting := req["filename"]
+			allowed = !setting
+		}
+	}
+	if !allowed {
+		return hubError(protocol.CodeForbidden, "%s is not allowed for the %s role", action, role)
+	}
+	return nil
+}
+
+func (s *Server) handle(c *conn, action string, req map[string]any) (any, error) {
+	if err := s.permit(action, req); err != nil {
+		return nil, err
+	}
+	switch action {
+	case "status":
+		return s.status(), nil
+	case "command":
+		command, err := stringArg(req, "command")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"result": s.command(command)}, nil
+	case "command-start":
+		command, err := stringArg(req, "command")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"id": s.startCommand(c, command)}, nil
+	case "command-cancel":
+		id, err := stringArg(req, "commandId")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"cancelled": s.cancelCommand(id)}, nil
+	case "jobs":
+		return map[string]any{"jobs": s.jobs()}, nil
+	case "job-cancel":
+		id, err := stringArg(req, "jobId")
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"cancelled": s.cancelJob(id)}, nil
+	case "job-priority":
+		id, err := stringArg(req, "jobId")
+		if err != nil {
+			return nil, err
+		}
+		priority, ok := req["priority"].(float64)
+		if !ok {
+			return nil, hubError(protocol.CodeInvalid, "priority is required")
+		}
+		job, err := s.setJobPriority(id, int(priority))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"job": job}, nil
+	case "peer-ping":
+		peer, err := stringArg(req, "peer")
+		if err != nil {
+			return nil, err
+		}
+		from, _ := req["from"].(string)
+		return s.pingPeer(from, peer), nil
+	case "peer-files":
+		peer, err := stringArg(req, "peer")
+		if err != nil {
+			return nil, err
+		}
+		if i := s.peerIndex(peer); i < 0 || s.cfg.Peers[i].Offline {
+			return nil, hubError(protocol.CodeNotFound, "%s is not connected", peer)
+		}
+		path, _ := req["path"].(string)
+		files, ok := peerFiles(path)
+		if !ok {
+			return nil, hubError(protocol.CodeNotFound, "%s shares no folder %q", peer, path)
+		}
+		return map[string]any{"peer": peer, "path": path, "files": files}, nil
+	case "transfer-offer":
+		return s.offerTransfer(c, req)
+	case "transfer-answer":
+		id, err := stringArg(req, "transferId")
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		_, ok := s.transfers[id]
+		s.mu.Unlock()
+		if ok {
+			return nil, hubError(protocol.CodeForbidden, "only the receiving peer answers a transfer")
+		}
+		return nil, hubError(protocol.CodeNotFound, "unknown transfer %s", id)
+	case "transfer-cancel":
+		return s.cancelTransfer(req)
+	case "peer-upload":
+		peer, err := stringArg(req, "peer")
+		if err != nil {
+			return nil, err
+		}
+		filename, err := stringArg(req, "filename")
+		if err != nil {
+			return nil, err
+		}
+		if i := s.peerIndex(peer); i < 0 || s.cfg.Peers[i].Offline {
+			return nil, hubError(protocol.CodeNotFound, "%s is not connected", peer)
+		}
+		f, ok := peerFile(filename)
+		if !ok {
+			return nil, hubError(protocol.CodeNotFound, "%s shares no file %q", peer, filename)
+		}
+		return s.store(f.Name, "audio/wav", f.Data, nil)
+	case "peer-restart", "peer-update":
+		peer, err := stringArg(req, "peer")
+		if err != nil {
+			return nil, err
+		}
+		if i := s.peerIndex(peer); i < 0 || s.cfg.Peers[i].Offline {
+			return nil, hubError(protocol.CodeNotFound, "%s is not connected", peer)
+		}
+		return map[string]any{"operationId": s.controlPeer(strings.TrimPrefix(action, "peer-"), peer)}, nil
+	case "play":
+		filename, err := stringArg(req, "filename")
+		if err != nil {
+			return nil, err
+		}
+		info, err := s.fileInfo(filename)
+		if err != nil {
+			return nil, err
+		}
+		loop, _ := req["loop"].(bool)
+		s.startPlaying(s.cfg.ID, filename, loop)
+		return map[string]any{"played": filename, "info": info}, nil
+	case "broadcast":
+		message, err := stringArg(req, "message")
+		if err != nil {
+			return nil, err
+		}
+		peers, err := s.recipients(req)
+		if err != nil {
+			return nil, err
+		}
+		payload := map[string]any{"type": "user-message", "from": s.cfg.ID, "message": message, "timestamp": time.Now().UTC().Format(time.RFC3339)}
+		if s.selfHears(req, peers) {
+			s.Emit(protocol.EventHubMessage, map[string]any{"message": payload})
+		}
+		return map[string]any{"recipients": len(peers), "payload": payload}, nil
+	case "audio-stream":
+		streamID, err := stringArg(req, "streamId")
+		if err != nil {
+			return nil, err
+		}
+		chunk := map[string]any{"streamId": streamID, "from": s.cfg.ID, "self": true}
+		for _, k := range []string{"seq", "phase", "format", "base64"} {
+			if v, ok := req[k]; ok {
+				chunk[k] = v
+			}
+		}
+		s.Emit(protocol.EventAudioStream, chunk)
+		return map[string]any{"recipients": len(s.cfg.Peers)}, nil
+	case "chat":
+		text, err := stringArg(req, "text")
+		if err != nil {
+			return nil, err
+		}
+		if len(text) > protocol.MaxChatBytes {
+			return nil, hubError(protocol.CodeTooLarge, "message over %d bytes", protocol.MaxChatBytes)
+		}
+		channel, _ := req["channel"].(string)
+		if channel == "" {
+			channel = protocol.DefaultChatChannel
+		}
+		s.mu.Lock()
+		msg := chatMessage{ID: fmt.Sprintf("m%d", len(s.chat)+1), Channel: channel, From: s.cfg.ID, Text: text, Time: time.Now().UTC().Format(time.RFC3339)}
+		s.chat = append(s.chat, msg)
+		s.mu.Unlock()
+		s.Emit(protocol.EventChat, msg)
+		return map[string]any{"message": msg}, nil
+	case "chat-history":
+		channel, _ := req["channel"].(string)
+		if channel == "" {
+			channel = protocol.DefaultChatChannel
+		}
+		limit := 50
+		if n, ok := req["limit"].(float64); ok && n > 0 {
+			limit = int(n)
+		}
+		s.mu.Lock()
+		messages := []chatMessage{}
+		for _, m := range s.chat {
+			if m.Channel == channel {
+				messages = append(messages, m)
+			}
+		}
+		s.mu.Unlock()
+		return map[string]any{"messages": messages[max(len(messages)-limit, 0):]}, nil
+	case "chat-typing":
+		channel, err := stringArg(req, "channel")
+		if err != nil {
+			return nil, err
+		}
+		s.Emit(protocol.EventChatTyping, map[string]any{"channel": channel, "from": s.cfg.ID})
+		return map[string]any{}, nil
+	case "clipboard":
+		text, err := stringArg(req, "text")
+		if err != nil {
+			return nil, err
+		}
+		if len(text) > protocol.MaxClipboardBytes {
+			return nil, hubError(protocol.CodeTooLarge, "clipboard text over %d bytes", protocol.MaxClipboardBytes)
+		}
+		s.Emit(protocol.EventClipboard, map[string]any{"text": text, "from": s.cfg.ID, "timestamp": time.Now().UTC().Format(time.RFC3339), "self": true})
+		return map[string]any{"recipients": len(s.cfg.Peers)}, nil
+	case "broadcast-play":
+		filename, err := stringArg(req, "filename")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.fileInfo(filename); err != nil {
+			return nil, err
+		}
+		peers, err := s.recipients(req)
+		if err != nil {
+			return nil, err
+		}
+		s.countPlay(filename)
+		event := map[string]any{"filename": filename, "from": s.cfg.ID, "timestamp": time.Now().UTC().Format(time.RFC3339), "self": true}
+		res := map[string]any{"broadcast": true, "filename": filename}
+		loop, _ := req["loop"].(bool)
+		if normalize, _ := req["normalize"].(bool); normalize {
+			if gain, ok := s.replayGain(filename); ok {
+				event["gain"] = gain
+			}
+		}
+		if sync, _ := req["sync"].(bool); sync {
+			startAt := time.Now().Add(syncPlayLead)
+			event["startAt"] = startAt.UTC().Format(time.RFC3339Nano)
+			res["startAt"] = event["startAt"]
+			s.mu.Lock()
+			stops := s.stops
+			s.mu.Unlock()
+			go s.playAt(startAt, stops, peers, filename, loop)
+		} else {
+			for _, p := range peers {
+				s.startPlaying(p.ID, filename, loop)
+			}
+		}
+		if s.selfHears(req, peers) {
+			s.Emit(protocol.EventBroadcastPlay, event)
+		}
+		return res, nil
+	case "broadcast-stop":
+		s.stopAll()
+		s.Emit(protocol.EventBroadcastStop, map[string]any{"from": s.cfg.ID, "timestamp": time.Now().UTC().Format(time.RFC3339), "self": true})
+		return map[string]any{"recipients": len(s.cfg.Peers)}, nil
+	case "broadcast-image":
+		filename, err := stringArg(req, "filename")
+		if err != nil {
+			return nil, err
+		}
+		info, err := s.fileInfo(filename)
+		if err != nil {
+			return nil, err
+		}
+		contentType, _ := info["contentType"].(string)
+		if !strings.HasPrefix(contentType, "image/") {
+			return nil, hubError(protocol.CodeInvalid, "%s is not an image", filename)
+		}
+		event := map[string]any{"filename": filename, "contentType": contentType, "size": info["size"], "from": s.cfg.ID, "timestamp": time.Now().UTC().Format(time.RFC3339), "self": true}
+		if caption, _ := req["caption"].(string); caption != "" {
+			event["caption"] = caption
+		}
+		s.Emit(protocol.EventBroadcastImage, event)
+		return map[string]any{"recipients": len(s.cfg.Peers)}, nil
+	case "broadcast-plan":
+		return s.broadcastPlan(req)
+	case "upload":
+		filename, err := stringArg(req, "filename")
+		if err != nil {
+			return nil, err
+		}
+		data, err := base64.StdEncoding.DecodeString(fmt.Sprint(req["base64"]))
+		if err != nil {
+			return nil, hubError(protocol.CodeInvalid, "base64: %v", err)
+		}
+		contentType, _ := req["contentType"].(string)
+		meta, _ := req["metadata"].(map[string]any)
+		ttl, onDisconnect, err := temporary(req)
+		if err != nil {
+			return nil, err
+		}
+		res, err := s.store(filename, contentType, data, meta)
+		if err != nil {
+			return nil, err
+		}
+		s.keepFor(c, res, ttl, onDisconnect)
+		return res, nil
+	case "upload-begin", "upload-chunk", "upload-resume", "upload-commit", "upload-cancel":
+		return s.chunked(c, action, req)
+	case "files":
+		return map[string]any{"files": s.fileList()}, nil
+	case "storage":
+		used, count := s.usage()
+		return map[string]any{"used": used, "total": used, "quota": s.cfg.Quota, "files": count}, nil
+	case "delete":
+		filename, err := stringArg(req, "filename")
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		f, ok := s.files[filename]
+		if ok {
+			if s.trash == nil {
+				s.trash = make(map[string]*trashed)
+			}
+			// a second delete of the same name replaces the first
+			s.trash[filename] = &trashed{file: f, tags: s.tags[filename], plays: s.plays[filename], deletedAt: time.Now().UTC(), by: s.cfg.ID}
+		}
+		delete(s.files, filename)
+		delete(s.tags, filename)
+		delete(s.plays, filename)
+		s.mu.Unlock()
+		if !ok {
+			return nil, hubError(protocol.CodeNotFound, "%s not found", filename)
+		}
+		s.logf("info", "moved %s to the trash", filename)
+		return map[string]any{"deleted": filename, "trashed": true}, nil
+	case "move":
+		return s.move(req)
+	case "trash":
+		return map[string]any{"files": s.trashList()}, nil
+	case "restore":
+		return s.restore(req)
+	case "purge":
+		return s.purge(req)
+	case "tags":
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if filename, ok := req["filename"].(string); ok {
+			var tags []string
+			list, _ := req["tags"].([]any)
+			for _, t := range list {
+				if t, ok := t.(string); ok && t != "" {
+					tags = append(tags, t)
+				}
+			}
+			if len(tags) > 0 {
+				s.tags[filename] = tags
+			} else {
+				delete(s.tags, filename)
+			}
+		}
+		all := make(map[string][]string, len(s.tags))
+		for k, v := range s.tags {
+			all[k] = v
+		}
+		return map[string]any{"tags": all}, nil
+	case "hash":
+		filename, err := stringArg(req, "filename")
+		if err != nil {
+			return nil, err
+		}
+		s.mu.Lock()
+		f, ok := s.files[filename]
+		s.mu.Unlock()
+		if !ok {
+			return nil, hubError(protocol.CodeNotFound, "%s not found", filename)
+		}
+		sum := sha256.Sum256(f.Data)
+		return map[string]any{"filename": filename, "sha256": hex.EncodeToString(sum[:]), "size": len(f.Data)}, nil
+	case "logs":
+		count := 100
+		if n, ok := req["count"].(float64); ok && n > 0 {
+			count = int(n)
+		}
+		s.mu.Lock()
+		lines := append([]logEntry(nil), s.logs[max(len(s.logs)-count, 0):]...)
+		s.mu.Unlock()
+		return map[string]any{"lines": lines}, nil
+	case "kv-set":
+		e, err := s.setKV(req)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"entry": e}, nil
+	case "peer-config":
+		return map[string]any{"configs": s.peerConfigList()}, nil
+	case "peer-config-set":
+		pc, err := s.setPeerConfig(req)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"config": pc}, nil
+	case "zones":
+		return map[string]any{"zones": s.zoneList()}, nil
+	case "stats":
+		return map[string]any{"files": s.playStatsList()}, nil
+	case "clock":
+		return map[string]any{"nowMs": float64(time.Now().UnixMicro()) / 1000}, nil
+	case "zone-set":
+		z, err := s.setZone(req)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"zone": z}, nil
+	case "zone-delete":
+		deleted, err := s.deleteZone(req)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"deleted": deleted}, nil
+	case "subscribe":
+		return s.subscribe(c, req)
+	case "kv-get", "kv-watch":
+		prefix, _ := req["prefix"].(string)
+		key, byKey := req["key"].(string)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if action == "kv-watch" {
+			c.watches = append(c.watches, prefix)
+		}
+		if byKey && action == "kv-get" {
+			for _, e := range s.kvEntries(key) {
+				if e.Key == key {
+					return map[string]any{"entries": []kvEntry{e}}, nil
+				}
+			}
+			return map[string]any{"entries": []kvEntry{}}, nil
+		}
+		return map[string]any{"entries": s.kvEntries(prefix)}, nil
+	case "audit":
+		count := 100
+		if n, ok := req["count"].(float64); ok && n > 0 {
+			count = int(n)
+		}
+		s.mu.Lock()
+		entries := append([]auditEntry{}, s.audit[max(len(s.audit)-count, 0):]...)
+		s.mu.Unlock()
+		return map[string]any{"entries": entries}, nil
+	case "volume", "pause", "resume", "stop", "seek":
+		s.playback(action, req)
+		return map[string]any{}, nil
+	case "bye":
+		s.logf("info", "client %s said bye", c.raw.RemoteAddr())
+		return map[string]any{}, nil
+	case "framing":
+		return nil, hubError(protocol.CodeInvalid, "unsupported framing: %v", req["mode"])
+	}
+	return nil, fmt.Errorf("unknown request type: %s", action)
+}
+
+func (s *Server) status() map[string]any {
+	s.mu.Lock()
+	playing := make([]nowPlaying, 0, len(s.playing))
+	for _, np := range s.playing {
+		playing = append(playing, np.at(time.Now()))
+	}
+	s.mu.Unlock()
+	sort.Slice(playing, func(i, j int) bool { return playing[i].Peer < playing[j].Peer })
+	return map[string]any{
+		"host":      s.httpHost,
+		"connected": true,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"whoami": map[string]any{
+			"id":           s.cfg.ID,
+			"name":         "fakehub",
+			"capabilities": s.capabilities(),
+			"addresses":    []string{"127.0.0.1"},
+		},
+		"audioList":  map[string]any{"command": "audio", "files": s.fileList()},
+		"peers":      s.cfg.Peers,
+		"nowPlaying": playing,
+	}
+}
+
+func (s *Server) fileList() []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	names := make([]string, 0, len(s.files))
+	for name := range s.files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	list := make([]map[string]any, len(names))
+	for i, name := range names {
+		f := s.files[name]
+		list[i] = map[string]any{
+			"name":        name,
+			"size":        len(f.Data),
+			"modified":    f.Modified.Format(time.RFC3339),
+			"uploaded":    f.Modified.Format(time.RFC3339),
+			"contentType": f.ContentType,
+		}
+		if f.Loudness != 0 {
+			list[i]["loudness"] = f.Loudness
+			list[i]["replayGain"] = f.ReplayGain
+		}
+		if !f.expires.IsZero() {
+			list[i]["expiresAt"] = f.expires.Format(time.RFC3339)
+		}
+	}
+	return list
+}
+
+func (s *Server) fileInfo(filename string) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[filename]
+	if !ok {
+		return nil, hubError(protocol.CodeNotFound, "Audio file not found")
+	}
+	return map[string]any{"exists": true, "filename": filename, "size": len(f.Data), "contentType": f.ContentType}, nil
+}
+
+// move renames a file, taking its tags and play count along.
+func (s *Server) move(req map[string]any) (any, error) {
+	filename, err := stringArg(req, "filename")
+	if err != nil {
+		return nil, err
+	}
+	to, err := stringArg(req, "to")
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	f, ok := s.files[filename]
+	_, taken := s.files[to]
+	switch {
+	case !ok:
+		s.mu.Unlock()
+		return nil, hubError(protocol.CodeNotFound, "%s not found", filename)
+	case taken:
+		s.mu.Unlock()
+		return nil, hubError(protocol.CodeInvalid, "%s already exists", to)
+	}
+	delete(s.files, filename)
+	f.Name = to
+	s.files[to] = f
+	if tags, ok := s.tags[filename]; ok {
+		delete(s.tags, filename)
+		s.tags[to] = tags
+	}
+	if p, ok := s.plays[filename]; ok {
+		delete(s.plays, filename)
+		p.Name = to
+		s.plays[to] = p
+	}
+	s.mu.Unlock()
+	s.logf("info", "moved %s to %s", filename, to)
+	return map[string]any{"filename": filename, "to": to}, nil
+}
+
+// trashed is a deleted file with what it had when it went.
+type trashed struct {
+	file      *File
+	tags      []string
+	plays     *playStats
+	deletedAt time.Time
+	by        string
+}
+
+// trashList is the "trash" answer: most recently deleted first.
+func (s *Server) trashList() []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]map[string]any, 0, len(s.trash))
+	for name, t := range s.trash {
+		list = append(list, map[string]any{
+			"name":        name,
+			"size":        len(t.file.Data),
+			"contentType": t.file.ContentType,
+			"deletedAt":   t.deletedAt.Format(time.RFC3339Nano),
+			"deletedBy":   t.by,
+		})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i]["deletedAt"] != list[j]["deletedAt"] {
+			return list[i]["deletedAt"].(string) > list[j]["deletedAt"].(string)
+		}
+		return list[i]["name"].(string) < list[j]["name"].(string)
+	})
+	return list
+}
+
+func (s *Server) restore(req map[string]any) (any, error) {
+	filename, err := stringArg(req, "filename")
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	t, ok := s.trash[filename]
+	_, taken := s.files[filename]
+	switch {
+	case !ok:
+		s.mu.Unlock()
+		return nil, hubError(protocol.CodeNotFound, "%s is not in the trash", filename)
+	case taken:
+		s.mu.Unlock()
+		return nil, hubError(protocol.CodeInvalid, "%s already exists", filename)
+	}
+	delete(s.trash, filename)
+	s.files[filename] = t.file
+	if len(t.tags) > 0 {
+		s.tags[filename] = t.tags
+	}
+	if t.plays != nil {
+		if s.plays == nil {
+			s.plays = make(map[string]*playStats)
+		}
+		s.plays[filename] = t.plays
+	}
+	s.mu.Unlock()
+	s.logf("info", "restored %s from the trash", filename)
+	return map[string]any{"restored": filename}, nil
+}
+
+// purge empties the trash, or drops the one file named.
+func (s *Server) purge(req map[string]any) (any, error) {
+	filename, _ := req["filename"].(string)
+	s.mu.Lock()
+	n := len(s.trash)
+	if filename != "" {
+		if _, ok := s.trash[filename]; !ok {
+			s.mu.Unlock()
+			return nil, hubError(protocol.CodeNotFound, "%s is not in the trash", filename)
+		}
+		delete(s.trash, filename)
+		n = 1
+	} else {
+		s.trash = nil
+	}
+	s.mu.Unlock()
+	s.logf("info", "purged %d file(s) from the trash", n)
+	return map[string]any{"purged": n}, nil
+}
+
+// replayGain is the gain a normalized play of filename applies, and
+// whether its uploader measured one.
+func (s *Server) replayGain(filename string) (float64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[filename]
+	if !ok || f.Loudness == 0 {
+		return 0, false
+	}
+	return f.ReplayGain, true
+}
+
+// broadcastPlan lists who a broadcast would reach: the simulated peers,
+// which is who broadcast-play starts playing on.
+func (s *Server) broadcastPlan(req map[string]any) (any, error) {
+	action, err := stringArg(req, "action")
+	if err != nil {
+		return nil, err
+	}
+	plan := map[string]any{"action": action}
+	switch action {
+	case "broadcast":
+		if _, err := stringArg(req, "message"); err != nil {
+			return nil, err
+		}
+	case "broadcast-play":
+		filename, err := stringArg(req, "filename")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.fileInfo(filename); err != nil {
+			return nil, err
+		}
+		plan["filename"] = filename
+	default:
+		return nil, hubError(protocol.CodeInvalid, "cannot plan %s", action)
+	}
+	peers, err := s.recipients(req)
+	if err != nil {
+		return nil, err
+	}
+	if name, _ := req["zone"].(string); name != "" {
+		plan["zone"] = name
+	}
+	recipients := make([]map[string]any, 0, len(peers))
+	for _, p := range peers {
+		recipients = append(recipients, map[string]any{"id": p.ID, "name": p.Name, "self": p.ID == s.cfg.ID})
+	}
+	plan["recipients"] = recipients
+	return plan, nil
+}
+
+func (s *Server) usage() (int64, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var used int64
+	for _, f := range s.files {
+		used += int64(len(f.Data))
+	}
+	return used, len(s.files)
+}
+
+// capabilities is what this Server advertises: Capabilities less
+// cfg.Without.
+func (s *Server) capabilities() []string {
+	var out []string
+	for _, c := range Capabilities {
+		if !slices.Contains(s.cfg.Without, c) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (s *Server) store(filename, contentType string, data []byte, meta map[string]any) (map[string]any, error) {
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	s.mu.Lock()
+	var used int64
+	for name, f := range s.files {
+		if name != filename {
+			used += int64(len(f.Data))
+		}
+	}
+	if s.cfg.Quota > 0 && used+int64(len(data)) > s.cfg.Quota {
+		s.mu.Unlock()
+		return nil, hubError(protocol.CodeQuotaExceeded, "%s would take the hub to %d of %d bytes", filename, used+int64(len(data)), s.cfg.Quota)
+	}
+	f := &File{Name: filename, ContentType: contentType, Data: data, Modified: time.Now().UTC().Truncate(time.Second)}
+	f.Loudness, _ = meta["loudness"].(float64)
+	f.ReplayGain, _ = meta["replayGain"].(float64)
+	s.files[filename] = f
+	s.mu.Unlock()
+	s.logf("info", "stored %s (%d bytes)", filename, len(data))
+	sum := sha256.Sum256(data)
+	return map[string]any{"filename": filename, "size": len(data), "contentType": contentType, "sha256": hex.EncodeToString(sum[:])}, nil
+}
+
+// temporary reads whether an upload asked to be temporary: removed after
+// ttl, or when its uploader disconnects.
+func temporary(req map[string]any) (ttl time.Duration, onDisconnect bool, err error) {
+	if t, _ := req["temporary"].(bool); !t {
+		return 0, false, nil
+	}
+	seconds, _ := req["ttlSeconds"].(float64)
+	onDisconnect, _ = req["deleteOnDisconnect"].(bool)
+	if seconds <= 0 && !onDisconnect {
+		return 0, false, hubError(protocol.CodeInvalid, "a temporary upload needs ttlSeconds or deleteOnDisconnect")
+	}
+	return time.Duration(seconds) * time.Second, seconds <= 0, nil
+}
+
+// keepFor makes the file an upload just stored temporary, and says so in
+// its answer res: with expiresAt when it goes after ttl, with
+// deleteOnDisconnect when it goes as c disconnects.
+func (s *Server) keepFor(c *conn, res map[string]any, ttl time.Duration, onDisconnect bool) {
+	if ttl <= 0 && !onDisconnect {
+		return
+	}
+	filename := res["filename"].(string)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := s.files[filename]
+	if f == nil {
+		return
+	}
+	if ttl > 0 {
+		f.expires = time.Now().UTC().Add(ttl).Truncate(time.Second)
+		res["expiresAt"] = f.expires.Format(time.RFC3339)
+		time.AfterFunc(time.Until(f.expires), func() { s.expire(filename, f) })
+	} else {
+		f.owner = c
+		res["deleteOnDisconnect"] = true
+	}
+}
+
+// expire removes a temporary file whose time is up, unless it was
+// replaced or removed since.
+func (s *Server) expire(filename string, f *File) {
+	s.mu.Lock()
+	ok := s.files[filename] == f
+	if ok {
+		delete(s.files, filename)
+		delete(s.tags, filename)
+	}
+	s.mu.Unlock()
+	if ok {
+		s.logf("info", "temporary %s expired", filename)
+	}
+}
+
+func (s *Server) chunked(c *conn, action string, req map[string]any) (any, error) {
+	if action == "upload-begin" {
+		filename, err := stringArg(req, "filename")
+		if err != nil {
+			return nil, err
+		}
+		ttl, onDisconnect, err := temporary(req)
+		if err != nil {
+			return nil, err
+		}
+		size, _ := req["size"].(float64)
+		u := &pendingUpload{filename: filename, size: int64(size), created: time.Now().UTC(), ttl: ttl, onDisconnect: onDisconnect}
+		u.contentType, _ = req["contentType"].(string)
+		u.sha256, _ = req["sha256"].(string)
+		u.meta, _ = req["metadata"].(map[string]any)
+		s.mu.Lock()
+		s.nextID++
+		id := fmt.Sprintf("upload-%d", s.nextID)
+		s.uploads[id] = u
+		s.mu.Unlock()
+		return map[string]any{"uploadId": id, "offset": 0}, nil
+	}
+	id, err := stringArg(req, "uploadId")
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	u, ok := s.uploads[id]
+	s.mu.Unlock()
+	if !ok {
+		return nil, hubError(protocol.CodeNotFound, "unknown upload %s", id)
+	}
+	switch action {
+	case "upload-chunk":
+		offset, _ := req["offset"].(float64)
+		data, err := base64.StdEncoding.DecodeString(fmt.Sprint(req["base64"]))
+		if err != nil {
+			return nil, hubError(protocol.CodeInvalid, "base64: %v", err)
+		}
+		s.mu.Lock()
+		if int64(offset) == int64(len(u.data)) {
+			u.data = append(u.data, data...)
+		}
+		at := len(u.data)
+		s.mu.Unlock()
+		return map[string]any{"uploadId": id, "offset": at}, nil
+	case "upload-resume":
+		s.mu.Lock()
+		at := len(u.data)
+		s.mu.Unlock()
+		return map[string]any{"uploadId": id, "offset": at}, nil
+	case "upload-cancel":
+		s.mu.Lock()
+		delete(s.uploads, id)
+		s.mu.Unlock()
+		return map[string]any{}, nil
+	}
+	s.mu.Lock()
+	delete(s.uploads, id)
+	s.mu.Unlock()
+	if u.size > 0 && int64(len(u.data)) != u.size {
+		return nil, hubError(protocol.CodeInvalid, "upload %s has %d of %d bytes", id, len(u.data), u.size)
+	}
+	res, err := s.store(u.filename, u.contentType, u.data, u.meta)
+	if err != nil {
+		return nil, err
+	}
+	s.keepFor(c, res, u.ttl, u.onDisconnect)
+	return res, nil
+}
+
+func (s *Server) startPlaying(peer, filename string, loop bool) {
+	s.mu.Lock()
+	np := &nowPlaying{Peer: peer, Filename: filename, Duration: 30, State: "playing", Loop: loop, started: time.Now()}
+	if pc, ok := s.peerConfigs[peer]; ok {
+		np.Volume = pc.Volume
+	}
+	s.playing[peer] = np
+	current := np.at(time.Now())
+	s.mu.Unlock()
+	s.Emit(protocol.EventNowPlaying, current)
+}
+
+// playback applies a transport action to this client's playback, or with
+// broadcast set to every peer's.
+func (s *Server) playback(action string, req map[string]any) {
+	all, _ := req["broadcast"].(bool)
+	s.mu.Lock()
+	var changed []nowPlaying
+	now := time.Now()
+	for peer, np := range s.playing {
+		if !all && peer != s.cfg.ID {
+			continue
+		}
+		switch action {
+		case "pause":
+			if np.State == "playing" {
+				np.Position = np.at(now).Position
+				np.State = "paused"
+			}
+		case "resume":
+			if np.State == "paused" {
+				np.State = "playing"
+				np.started = now.Add(-time.Duration(np.Position * float64(time.Second)))
+			}
+		case "stop":
+			np.State = "stopped"
+			delete(s.playing, peer)
+		case "seek":
+			if pos, ok := req["position"].(float64); ok {
+				np.Position = pos
+				np.started = now.Add(-time.Duration(pos * float64(time.Second)))
+			}
+		}
+		changed = append(changed, np.at(now))
+	}
+	s.mu.Unlock()
+	for _, np := range changed {
+		s.Emit(protocol.EventNowPlaying, np)
+	}
+}
+
+// at is np with the position it has reached by now.
+func (np *nowPlaying) at(now time.Time) nowPlaying {
+	out := *np
+	switch {
+	case np.State == "playing" && np.Loop:
+		out.Position = math.Mod(now.Sub(np.started).Seconds(), np.Duration)
+	case np.State == "playing":
+		out.Position = min(now.Sub(np.started).Seconds(), np.Duration)
+	}
+	return out
+}
+
+// minStatusInterval is the fastest status push a subscriber gets.
+const minStatusInterval = time.Second
+
+// subscribe narrows the events c gets to those listed, or all of them
+// when none are, and pushes it status at the interval asked for.
+func (s *Server) subscribe(c *conn, req map[string]any) (any, error) {
+	var events []string
+	if list, ok := req["events"].([]any); ok {
+		for _, e := range list {
+			name, ok := e.(string)
+			if !ok {
+				return nil, hubError(protocol.CodeInvalid, "events must be a list of event names")
+			}
+			events = append(events, name)
+		}
+	}
+	seconds, _ := req["statusIntervalSeconds"].(float64)
+	interval := time.Duration(seconds * float64(time.Second))
+	if interval > 0 && interval < minStatusInterval {
+		interval = minStatusInterval
+	}
+	s.mu.Lock()
+	c.events = nil
+	if len(events) > 0 {
+		c.events = make(map[string]bool)
+		for _, name := range events {
+			c.events[name] = true
+		}
+	}
+	if c.statusStop != nil {
+		close(c.statusStop)
+		c.statusStop = nil
+	}
+	if interval > 0 {
+		c.statusStop = make(chan struct{})
+		go s.pushStatus(c, interval, c.statusStop)
+	}
+	s.mu.Unlock()
+	if events == nil {
+		events = []string{}
+	}
+	return map[string]any{"events": events, "statusIntervalSeconds": interval.Seconds()}, nil
+}
+
+// pushStatus sends c status every interval until stop closes.
+func (s *Server) pushStatus(c *conn, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		c.event(protocol.EventStatus, s.status())
+	}
+}
+
+// events pushes one canned event per interval, cycling through the kinds
+// a real hub sends.
+func (s *Server) events() {
+	ticker := time.NewTicker(s.cfg.EventInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+		s.mu.Lock()
+		s.tick++
+		tick := s.tick
+		s.mu.Unlock()
+		var peer Peer
+		if len(s.cfg.Peers) > 0 {
+			peer = s.cfg.Peers[tick%len(s.cfg.Peers)]
+		}
+		switch tick % 4 {
+		case 0:
+			s.Emit(protocol.EventStatus, s.status())
+		case 1:
+			if peer.ID != "" {
+				s.Emit(protocol.EventHubMessage, map[string]any{"message": map[string]any{
+					"type": "user-message", "from": peer.ID, "message": fmt.Sprintf("hello from %s (%d)", peer.Name, tick),
+				}})
+			}
+		case 2:
+			names := s.fileNames()
+			if peer.ID != "" && len(names) > 0 {
+				s.startPlaying(peer.ID, names[tick%len(names)], false)
+			}
+		case 3:
+			s.logf("info", "simulated activity %d", tick)
+			s.mu.Lock()
+			last := s.logs[len(s.logs)-1]
+			s.mu.Unlock()
+			s.Emit(protocol.EventLog, last)
+		}
+	}
+}
+
+func (s *Server) fileNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var names []string
+	for name, f := range s.files {
+		if strings.HasPrefix(f.ContentType, "audio/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := strings.CutPrefix(r.URL.Path, "/audio/")
+	if !ok || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		http.NotFound(w, r)
+		return
+	}
+	s.mu.Lock()
+	f, ok := s.files[name]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", f.ContentType)
+	w.Header().Set("Content-Length", fmt.Sprint(len(f.Data)))
+	if r.Method == http.MethodGet {
+		w.Write(f.Data)
+	}
+}
@@ -0,0 +1,205 @@
+package fakehub
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"brain/internal/protocol"
+)
+
+// commandSlots is how many started commands run at once; the rest wait
+// their turn, highest priority first.
+const commandSlots = 2
+
+// startedCommand is a command-start job. Its fields are guarded by
+// Server.mu.
+type startedCommand struct {
+	id       string
+	command  string
+	priority int
+	seq      int
+	created  time.Time
+	running  bool
+	start    chan struct{}
+	cancel   context.CancelFunc
+}
+
+// startCommand queues command for c, the way command-start does:
+// benchmark reports one peer at a time as command-output, anything else
+// finishes at once. A command-done event ends it either way.
+func (s *Server) startCommand(c *conn, command string) string {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.mu.Lock()
+	s.nextID++
+	sc := &startedCommand{
+		id:      fmt.Sprintf("command-%d", s.nextID),
+		command: command,
+		seq:     s.nextID,
+		created: time.Now().UTC(),
+		start:   make(chan struct{}),
+		cancel:  cancel,
+	}
+	s.commands[sc.id] = sc
+	s.scheduleLocked()
+	s.mu.Unlock()
+	go func() {
+		defer cancel()
+		var done map[string]any
+		select {
+		case <-sc.start:
+			done = s.runCommand(ctx, c, sc)
+		case <-ctx.Done():
+			done = map[string]any{"id": sc.id, "cancelled": true}
+		case <-s.done:
+		}
+		s.mu.Lock()
+		delete(s.commands, sc.id)
+		s.scheduleLocked()
+		s.mu.Unlock()
+		if done != nil {
+			c.event(protocol.EventCommandDone, done)
+		}
+	}()
+	return sc.id
+}
+
+// runCommand runs a started command and returns its command-done
+// payload, or nil when the server is closing.
+func (s *Server) runCommand(ctx context.Context, c *conn, sc *startedCommand) map[string]any {
+	fields := strings.Fields(strings.ToLower(sc.command))
+	if len(fields) == 0 || fields[0] != "benchmark" {
+		return map[string]any{"id": sc.id, "result": s.command(sc.command)}
+	}
+	var results []map[string]any
+	for i := range s.cfg.Peers {
+		select {
+		case <-ctx.Done():
+			return map[string]any{"id": sc.id, "cancelled": true}
+		case <-s.done:
+			return nil
+		case <-time.After(benchmarkStep):
+		}
+		r := s.benchmarkResult(i)
+		results = append(results, r)
+		c.event(protocol.EventCommandOutput, map[string]any{"id": sc.id, "text": fmt.Sprintf("%s: %.1f ms\n", r["clientId"], r["durationMs"])})
+	}
+	return map[string]any{"id": sc.id, "result": benchmarkSummary(results)}
+}
+
+// scheduleLocked starts waiting commands while there are free slots.
+func (s *Server) scheduleLocked() {
+	running := 0
+	var waiting []*startedCommand
+	for _, sc := range s.commands {
+		if sc.running {
+			running++
+		} else {
+			waiting = append(waiting, sc)
+		}
+	}
+	sort.Slice(waiting, func(i, j int) bool {
+		if waiting[i].priority != waiting[j].priority {
+			return waiting[i].priority > waiting[j].priority
+		}
+		return waiting[i].seq < waiting[j].seq
+	})
+	for _, sc := range waiting {
+		if running >= commandSlots {
+			return
+		}
+		sc.running = true
+		close(sc.start)
+		running++
+	}
+}
+
+func (s *Server) cancelCommand(id string) bool {
+	s.mu.Lock()
+	sc, ok := s.commands[id]
+	s.mu.Unlock()
+	if ok {
+		sc.cancel()
+	}
+	return ok
+}
+
+func (s *Server) commandJob(sc *startedCommand) map[string]any {
+	state := "pending"
+	if sc.running {
+		state = "running"
+	}
+	return map[string]any{
+		"id": sc.id, "kind": "command", "title": sc.command, "state": state,
+		"priority": sc.priority, "owner": s.cfg.ID, "createdAt": sc.created.Format(time.RFC3339),
+	}
+}
+
+// jobs lists started commands, running then waiting in turn, and then
+// chunked uploads.
+func (s *Server) jobs() []map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	commands := make([]*startedCommand, 0, len(s.commands))
+	for _, sc := range s.commands {
+		commands = append(commands, sc)
+	}
+	sort.Slice(commands, func(i, j int) bool {
+		a, b := commands[i], commands[j]
+		if a.running != b.running {
+			return a.running
+		}
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		return a.seq < b.seq
+	})
+	out := make([]map[string]any, 0, len(commands)+len(s.uploads))
+	for _, sc := range commands {
+		out = append(out, s.commandJob(sc))
+	}
+	ids := make([]string, 0, len(s.uploads))
+	for id := range s.uploads {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		u := s.uploads[id]
+		job := map[string]any{
+			"id": id, "kind": "upload", "title": u.filename, "state": "running",
+			"owner": s.cfg.ID, "createdAt": u.created.Format(time.RFC3339),
+		}
+		if u.size > 0 {
+			job["progress"] = float64(len(u.data)) / float64(u.size)
+		}
+		out = append(out, job)
+	}
+	return out
+}
+
+// cancelJob stops a started command or drops a chunked upload.
+func (s *Server) cancelJob(id string) bool {
+	if s.cancelCommand(id) {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.uploads[id]
+	delete(s.uploads, id)
+	return ok
+}
+
+func (s *Server) setJobPriority(id string, priority int) (map[string]any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if sc, ok := s.commands[id]; ok {
+		sc.priority = priority
+		return s.commandJob(sc), nil
+	}
+	if _, ok := s.uploads[id]; ok {
+		return nil, hubError(protocol.CodeInvalid, "upload %s is not queued", id)
+	}
+	return nil, hubError(protocol.CodeNotFound, "unknown job %s", id)
+}
@@ -0,0 +1,309 @@
+// Package gateway exposes a hub connection as a small REST API, for tools
+// that speak HTTP but not the socket protocol, such as home automation:
+//
+//	curl -X POST localhost:4460/broadcast -d message='Dinner is ready'
+//	curl -X POST localhost:4460/play -d filename=chime.wav -d all=true
+//	curl -F file=@doorbell.mp3 localhost:4460/upload
+//
+// Parameters may be sent as a query string, a form or a JSON object.
+package gateway
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+)
+
+// uploadTimeout bounds an /upload from the end of the body to the hub's
+// answer.
+const uploadTimeout = 2 * time.Minute
+
+// DefaultMaxUpload is the largest file /upload accepts when Config leaves
+// it unset. Whole files travel in one socket message.
+const DefaultMaxUpload = 32 << 20
+
+type Config struct {
+	// Client returns the connection to use; it may return nil while
+	// disconnected.
+	Client func() *hubclient.Client
+	// Token, when set, must arrive as "Authorization: Bearer <token>".
+	Token string
+	// MaxUpload bounds /upload files in bytes.
+	MaxUpload int64
+	// Logf receives one line per request; nil discards them.
+	Logf func(format string, args ...any)
+}
+
+type gateway struct {
+	cfg Config
+	mux *http.ServeMux
+}
+
+// New returns the gateway's handler.
+func New(cfg Config) http.Handler {
+	if cfg.MaxUpload <= 0 {
+		cfg.MaxUpload = DefaultMaxUpload
+	}
+	g := &gateway{cfg: cfg, mux: http.NewServeMux()}
+	g.mux.HandleFunc("/", g.index)
+	g.mux.HandleFunc("/status", g.only(http.MethodGet, g.status))
+	g.mux.HandleFunc("/files", g.only(http.MethodGet, g.files))
+	g.mux.HandleFunc("/play", g.only(http.MethodPost, g.play))
+	g.mux.HandleFunc("/broadcast", g.only(http.MethodPost, g.broadcast))
+	g.mux.HandleFunc("/upload", g.only(http.MethodPost, g.upload))
+	return g
+}
+
+func (g *gateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if g.cfg.Token != "" && !g.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="brain"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]any{"error": "missing or wrong token"})
+		return
+	}
+	rec := &statusRecorder{ResponseWriter: w, code: http.StatusOK}
+	started := time.Now()
+	g.mux.ServeHTTP(rec, r)
+	if g.cfg.Logf != nil {
+		g.cfg.Logf("gateway: %s %s %d (%v)", r.Method, r.URL.Path, rec.code, time.Since(started).Round(time.Millisecond))
+	}
+}
+
+// authorized compares the bearer token in constant time, so response
+// timing does not reveal how much of a guess was right.
+func (g *gateway) authorized(r *http.Request) bool {
+	got := []byte(r.Header.Get("Authorization"))
+	want := []byte("Bearer " + g.cfg.Token)
+	return subtle.ConstantTimeCompare(got, want) == 1
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	code int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.code = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (g *gateway) only(method string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]any{"error": method + " only"})
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (g *gateway) index(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		writeJSON(w, http.StatusNotFound, map[string]any{"error": "no such endpoint"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"endpoints": []string{
+		"GET /status",
+		"GET /files",
+		"POST /play filename [all]",
+		"POST /broadcast message",
+		"POST /upload file (multipart) [name] [play]",
+	}})
+}
+
+func (g *gateway) status(w http.ResponseWriter, r *http.Request) {
+	status, err := g.cfg.Client().Status(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+func (g *gateway) files(w http.ResponseWriter, r *http.Request) {
+	files, err := g.cfg.Client().Files(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if files == nil {
+		files = []hubclient.HubFile{}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"files": files})
+}
+
+func (g *gateway) play(w http.ResponseWriter, r *http.Request) {
+	p, err := params(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	filename := p["filename"]
+	if filename == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "filename is required"})
+		return
+	}
+	client := g.cfg.Client()
+	if truthy(p["all"]) {
+		err = client.BroadcastPlay(r.Context(), filename)
+	} else {
+		err = client.Play(r.Context(), filename)
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"played": filename, "all": truthy(p["all"])})
+}
+
+func (g *gateway) broadcast(w http.ResponseWriter, r *http.Request) {
+	p, err := params(r)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	message := strings.TrimSpace(p["message"])
+	if message == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "message is required"})
+		return
+	}
+	if err := g.cfg.Client().Broadcast(r.Context(), message); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"broadcast": message})
+}
+
+func (g *gateway) upload(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, g.cfg.MaxUpload+1<<20)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		var tooBig *http.MaxBytesError
+		if errors.As(err, &tooBig) {
+			writeJSON(w, http.StatusRequestEntityTooLarge, map[string]any{"error": fmt.Sprintf("files are limited to %d bytes", g.cfg.MaxUpload)})
+			return
+		}
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": "multipart field \"file\" is required"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, g.cfg.MaxUpload+1))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"error": err.Error()})
+		return
+	}
+	if int64(len(data)) > g.cfg.MaxUpload {
+		writeJSON(w, http.StatusRequestEntityTooLarge, map[string]any{"error": fmt.Sprintf("files are limited to %d bytes", g.cfg.MaxUpload)})
+		return
+	}
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" {
+		name = header.Filename
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), uploadTimeout)
+	defer cancel()
+	client := g.cfg.Client()
+	res, err := client.Upload(ctx, hubclient.UploadRequest{
+		Filename:    name,
+		Data:        data,
+		ContentType: header.Header.Get("Content-Type"),
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if truthy(r.FormValue("play")) {
+		if err := client.BroadcastPlay(ctx, res.Filename); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// params reads a JSON object body, or else the query and form values.
+func params(r *http.Request) (map[string]string, error) {
+	out := make(map[string]string)
+	if ct, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); ct == "application/json" {
+		var body map[string]any
+		if err := json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&body); err != nil {
+			return nil, fmt.Errorf("invalid JSON body: %w", err)
+		}
+		for k, v := range body {
+			if s, ok := v.(string); ok {
+				out[k] = s
+			} else {
+				out[k] = fmt.Sprint(v)
+			}
+		}
+	}
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+	for k, v := range r.Form {
+		if _, ok := out[k]; !ok && len(v) > 0 {
+			out[k] = v[0]
+		}
+	}
+	return out, nil
+}
+
+func truthy(s string) bool {
+	b, err := strconv.ParseBool(s)
+	return err == nil && b
+}
+
+// HTTPStatus maps a hub client error onto the status a gateway answers
+// with.
+func HTTPStatus(err error) int {
+	switch {
+	case errors.Is(err, hubclient.ErrUnsupported):
+		return http.StatusNotImplemented
+	case errors.Is(err, hubclient.ErrTimeout):
+		return http.StatusGatewayTimeout
+	case hubclient.IsConnectionError(err):
+		return http.StatusBadGateway
+	case errors.Is(err, protocol.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, protocol.ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, protocol.ErrUnauthorized), errors.Is(err, protocol.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, protocol.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, protocol.ErrQuotaExceeded):
+		return http.StatusInsufficientStorage
+	case errors.Is(err, protocol.ErrBusy):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadGateway
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	body := map[string]any{"error": protocol.Friendly(err)}
+	var hubErr *protocol.Error
+	if errors.As(err, &hubErr) && hubErr.Code != "" {
+		body["code"] = hubErr.Code
+	}
+	if delay := protocol.RetryDelay(err); delay > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(delay.Seconds()+0.5)))
+	}
+	writeJSON(w, HTTPStatus(err), body)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
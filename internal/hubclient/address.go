@@ -0,0 +1,40 @@
+package hubclient
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+const (
+	DefaultControlURL  = "http://127.0.0.1:4455"
+	DefaultControlPort = 4455
+)
+
+// SocketAddress derives the socket address from the hub's control URL: the
+// same host, one port above the control port. CLIENT_SOCKET_PORT overrides
+// the port.
+func SocketAddress(control *url.URL) (string, error) {
+	host := control.Hostname()
+	if host == "" {
+		host = "127.0.0.1"
+	}
+	if portStr := os.Getenv("CLIENT_SOCKET_PORT"); portStr != "" {
+		port, err := strconv.Atoi(portStr)
+		if err != nil {
+			return "", fmt.Errorf("invalid CLIENT_SOCKET_PORT: %w", err)
+		}
+		return net.JoinHostPort(host, strconv.Itoa(port)), nil
+	}
+	port := DefaultControlPort
+	if portStr := control.Port(); portStr != "" {
+		p, err := strconv.Atoi(portStr)
+		if err != nil {
+			return "", fmt.Errorf("invalid control port: %w", err)
+		}
+		port = p
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port+1)), nil
+}
@@ -0,0 +1,1361 @@
+package hubclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"brain/internal/protocol"
+)
+
+// Status is the hub's answer to "status" and the payload of status events.
+// AudioList and Peers vary between hub versions and are left undecoded.
+type Status struct {
+	Host       string       `json:"host"`
+	Connected  bool         `json:"connected"`
+	Timestamp  string       `json:"timestamp"`
+	Whoami     any          `json:"whoami"`
+	AudioList  any          `json:"audioList"`
+	Peers      any          `json:"peers"`
+	NowPlaying []NowPlaying `json:"nowPlaying"`
+}
+
+// NowPlaying is one peer's playback state.
+type NowPlaying struct {
+	Peer        string  `json:"peer"`
+	Filename    string  `json:"filename"`
+	Position    float64 `json:"position"`
+	Duration    float64 `json:"duration"`
+	State       string  `json:"state"`
+	TriggeredBy string  `json:"triggeredBy"`
+	Self        bool    `json:"self"`
+	// Volume is the peer's stored volume it is playing at, when it has one.
+	Volume *int `json:"volume,omitempty"`
+	// Loop repeats the file until a broadcast-stop.
+	Loop bool `json:"loop,omitempty"`
+}
+
+// UploadRequest is a whole-file upload. ContentType defaults to one derived
+// from Filename. A temporary upload with no TTL is removed when this client
+// disconnects.
+type UploadRequest struct {
+	Filename    string
+	Data        []byte
+	ContentType string
+	Temporary   bool
+	TTL         time.Duration
+	Meta        *AudioMeta
+}
+
+type UploadResult struct {
+	Filename    string `json:"filename"`
+	Size        int    `json:"size"`
+	ContentType string `json:"contentType"`
+	ExpiresAt   string `json:"expiresAt"`
+	// DeleteOnDisconnect is set on a temporary upload with no TTL.
+	DeleteOnDisconnect bool   `json:"deleteOnDisconnect"`
+	SHA256             string `json:"sha256"`
+	// Verified is set when the hub answered with a digest and it matched
+	// what was sent; hubs that predate checksums leave uploads unverified.
+	Verified bool `json:"verified"`
+}
+
+// UploadBeginRequest opens a chunked upload of Size bytes.
+type UploadBeginRequest struct {
+	Filename    string
+	Size        int64
+	SHA256      string
+	ContentType string
+	Temporary   bool
+	TTL         time.Duration
+	Meta        *AudioMeta
+}
+
+// AudioMeta is what the uploader read from an audio file's headers and
+// tags. It is stored with the file and comes back in audio listings; zero
+// members are unknown.
+type AudioMeta struct {
+	// Duration is in seconds.
+	Duration float64 `json:"duration,omitempty"`
+	// Bitrate is the average in bits per second.
+	Bitrate int    `json:"bitrate,omitempty"`
+	Title   string `json:"title,omitempty"`
+	Artist  string `json:"artist,omitempty"`
+	Album   string `json:"album,omitempty"`
+	// Loudness is the integrated loudness in LUFS, per EBU R128, and
+	// ReplayGain the gain in dB that brings it to the ReplayGain 2.0
+	// reference of -18 LUFS; both are zero when not measured.
+	Loudness   float64 `json:"loudness,omitempty"`
+	ReplayGain float64 `json:"replayGain,omitempty"`
+}
+
+// ReplayGainReference is the loudness, in LUFS, a ReplayGain of 0 dB
+// stands for.
+const ReplayGainReference = -18.0
+
+// UploadProgress is the hub's acknowledgement for chunked uploads: Offset
+// is how many bytes it has stored.
+type UploadProgress struct {
+	UploadID string `json:"uploadId"`
+	Offset   int64  `json:"offset"`
+}
+
+type HashResult struct {
+	Filename string `json:"filename"`
+	SHA256   string `json:"sha256"`
+	Size     int64  `json:"size"`
+}
+
+type PeerFile struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified,omitempty"`
+	Dir      bool   `json:"dir,omitempty"`
+}
+
+type PeerListing struct {
+	Peer  string     `json:"peer"`
+	Path  string     `json:"path"`
+	Files []PeerFile `json:"files"`
+}
+
+func (c *Client) Status(ctx context.Context) (*Status, error) {
+	var res Status
+	if err := c.Call(ctx, "status", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// HubFile is one file in the hub's store. Hubs that list bare names leave
+// everything but Name zero.
+type HubFile struct {
+	Name        string
+	Size        int64
+	Modified    time.Time
+	ContentType string
+	// Loudness and ReplayGain are as in AudioMeta, from hubs with
+	// protocol.CapNormalize.
+	Loudness   float64
+	ReplayGain float64
+}
+
+// Files lists every file the hub stores, audio or not.
+func (c *Client) Files(ctx context.Context) ([]HubFile, error) {
+	var res struct {
+		Files []any `json:"files"`
+	}
+	if err := c.Call(ctx, "files", nil, &res); err != nil {
+		return nil, err
+	}
+	files := make([]HubFile, 0, len(res.Files))
+	for _, item := range res.Files {
+		if f, ok := hubFileFrom(item); ok {
+			files = append(files, f)
+		}
+	}
+	return files, nil
+}
+
+func hubFileFrom(item any) (HubFile, bool) {
+	switch v := item.(type) {
+	case string:
+		return HubFile{Name: v}, v != ""
+	case map[string]any:
+		f := HubFile{}
+		f.Name, _ = v["name"].(string)
+		f.ContentType, _ = v["contentType"].(string)
+		if size, ok := v["size"].(float64); ok && size > 0 {
+			f.Size = int64(size)
+		}
+		if modified, ok := v["modified"].(string); ok {
+			f.Modified, _ = time.Parse(time.RFC3339, modified)
+		}
+		f.Loudness, _ = v["loudness"].(float64)
+		f.ReplayGain, _ = v["replayGain"].(float64)
+		return f, f.Name != ""
+	}
+	return HubFile{}, false
+}
+
+// StorageUsage is the hub's answer to "storage", in bytes.
+type StorageUsage struct {
+	// Total is the size of every stored file. Used is what counts against
+	// Quota, which hubs that exempt some files report below Total.
+	Total int64 `json:"total"`
+	Used  int64 `json:"used"`
+	// Quota is zero when the hub has none.
+	Quota int64 `json:"quota"`
+	Files int   `json:"files"`
+}
+
+// Free is what is left of the quota, or -1 with no quota.
+func (u *StorageUsage) Free() int64 {
+	if u.Quota <= 0 {
+		return -1
+	}
+	return max(u.Quota-u.Used, 0)
+}
+
+func (c *Client) Storage(ctx context.Context) (*StorageUsage, error) {
+	if err := c.require(protocol.CapStorage, "storage"); err != nil {
+		return nil, err
+	}
+	var res StorageUsage
+	if err := c.Call(ctx, "storage", nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// BroadcastPlan is the hub's answer to "broadcast-plan": who a broadcast
+// would reach.
+type BroadcastPlan struct {
+	Action     string          `json:"action"`
+	Filename   string          `json:"filename,omitempty"`
+	Zone       string          `json:"zone,omitempty"`
+	Recipients []PlanRecipient `json:"recipients"`
+}
+
+type PlanRecipient struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// Self is this client, which hears its own broadcasts.
+	Self bool `json:"self,omitempty"`
+}
+
+// PlanBroadcast asks which peers a "broadcast" of message or a
+// "broadcast-play" of filename would reach, without sending anything. A
+// broadcast-play of a missing file fails as the real one would.
+func (c *Client) PlanBroadcast(ctx context.Context, action, target string) (*BroadcastPlan, error) {
+	return c.PlanBroadcastTo(ctx, action, target, "")
+}
+
+// PlanBroadcastTo is PlanBroadcast for a broadcast limited to zone.
+func (c *Client) PlanBroadcastTo(ctx context.Context, action, target, zone string) (*BroadcastPlan, error) {
+	if err := c.require(protocol.CapBroadcastPlan, "broadcast-plan"); err != nil {
+		return nil, err
+	}
+	args, err := c.zoneArgs(zone, "broadcast-plan")
+	if err != nil {
+		return nil, err
+	}
+	args["action"] = action
+	switch action {
+	case "broadcast":
+		args["message"] = target
+	case "broadcast-play":
+		args["filename"] = target
+	default:
+		return nil, fmt.Errorf("cannot plan %q", action)
+	}
+	var res BroadcastPlan
+	if err := c.Call(ctx, "broadcast-plan", args, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Delete removes filename from the hub's store. Hubs with
+// protocol.CapTrash keep it in their trash until it is purged.
+func (c *Client) Delete(ctx context.Context, filename string) error {
+	if err := c.require(protocol.CapDelete, "delete"); err != nil {
+		return err
+	}
+	return c.Call(ctx, "delete", map[string]any{"filename": filename}, nil)
+}
+
+// Move renames filename to to on the hub.
+func (c *Client) Move(ctx context.Context, filename, to string) error {
+	if err := c.require(protocol.CapMove, "move"); err != nil {
+		return err
+	}
+	return c.Call(ctx, "move", map[string]any{"filename": filename, "to": to}, nil)
+}
+
+// TrashedFile is a deleted file the hub can still restore.
+type TrashedFile struct {
+	Name        string `json:"name"`
+	Size        int64  `json:"size,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	// DeletedAt is RFC 3339.
+	DeletedAt string `json:"deletedAt"`
+	DeletedBy string `json:"deletedBy,omitempty"`
+}
+
+// Trash lists the deleted files the hub still keeps, newest first.
+func (c *Client) Trash(ctx context.Context) ([]TrashedFile, error) {
+	if err := c.require(protocol.CapTrash, "trash"); err != nil {
+		return nil, err
+	}
+	var res struct {
+		Files []TrashedFile `json:"files"`
+	}
+	if err := c.Call(ctx, "trash", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Files, nil
+}
+
+// Restore takes filename out of the trash under its old name. The hub
+// refuses while another file has that name.
+func (c *Client) Restore(ctx context.Context, filename string) error {
+	if err := c.require(protocol.CapTrash, "restore"); err != nil {
+		return err
+	}
+	return c.Call(ctx, "restore", map[string]any{"filename": filename}, nil)
+}
+
+// Purge removes filename from the trash for good, or empties the trash
+// when filename is "". It returns how many files went.
+func (c *Client) Purge(ctx context.Context, filename string) (int, error) {
+	if err := c.require(protocol.CapTrash, "purge"); err != nil {
+		return 0, err
+	}
+	args := map[string]any{}
+	if filename != "" {
+		args["filename"] = filename
+	}
+	var res struct {
+		Purged int `json:"purged"`
+	}
+	if err := c.Call(ctx, "purge", args, &res); err != nil {
+		return 0, err
+	}
+	return res.Purged, nil
+}
+
+// Command runs a hub console command and returns its decoded result.
+func (c *Client) Command(ctx context.Context, command string) (any, error) {
+	var res struct {
+		Result any `json:"result"`
+	}
+	if err := c.Call(ctx, "command", map[string]any{"command": command}, &res); err != nil {
+		return nil, err
+	}
+	return res.Result, nil
+}
+
+// CommandOutput is the payload of a command-output event: more of what a
+// command started with CommandStart printed.
+type CommandOutput struct {
+	ID   string `json:"id"`
+	Text string `json:"text"`
+}
+
+// CommandDone is the payload of a command-done event, which ends every
+// started command.
+type CommandDone struct {
+	ID        string `json:"id"`
+	Result    any    `json:"result,omitempty"`
+	Error     string `json:"error,omitempty"`
+	Cancelled bool   `json:"cancelled,omitempty"`
+}
+
+// CommandStart runs a hub console command in the background and returns
+// its id, which its command-output and command-done events carry.
+func (c *Client) CommandStart(ctx context.Context, command string) (string, error) {
+	if err := c.require(protocol.CapCommandStream, "command-start"); err != nil {
+		return "", err
+	}
+	var res struct {
+		ID string `json:"id"`
+	}
+	if err := c.Call(ctx, "command-start", map[string]any{"command": command}, &res); err != nil {
+		return "", err
+	}
+	return res.ID, nil
+}
+
+// CommandCancel stops a started command, reporting whether it was still
+// running.
+func (c *Client) CommandCancel(ctx context.Context, id string) (bool, error) {
+	if err := c.require(protocol.CapCommandStream, "command-cancel"); err != nil {
+		return false, err
+	}
+	var res struct {
+		Cancelled bool `json:"cancelled"`
+	}
+	if err := c.Call(ctx, "command-cancel", map[string]any{"commandId": id}, &res); err != nil {
+		return false, err
+	}
+	return res.Cancelled, nil
+}
+
+// Job is one piece of the hub's pending or running work, as "jobs" lists
+// it.
+type Job struct {
+	ID string `json:"id"`
+	// Kind is "command" or "upload"; hubs may add others.
+	Kind  string `json:"kind"`
+	Title string `json:"title"`
+	// State is "pending" while the job waits its turn, else "running".
+	State string `json:"state"`
+	// Priority orders pending jobs, highest first.
+	Priority  int    `json:"priority,omitempty"`
+	Owner     string `json:"owner,omitempty"`
+	CreatedAt string `json:"createdAt,omitempty"`
+	// Progress is from 0 to 1 when the hub knows it.
+	Progress float64 `json:"progress,omitempty"`
+}
+
+// Jobs lists the hub's pending and running jobs.
+func (c *Client) Jobs(ctx context.Context) ([]Job, error) {
+	if err := c.require(protocol.CapJobs, "jobs"); err != nil {
+		return nil, err
+	}
+	var res struct {
+		Jobs []Job `json:"jobs"`
+	}
+	if err := c.Call(ctx, "jobs", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Jobs, nil
+}
+
+// CancelJob stops a job, reporting whether it was still there.
+func (c *Client) CancelJob(ctx context.Context, id string) (bool, error) {
+	if err := c.require(protocol.CapJobs, "job-cancel"); err != nil {
+		return false, err
+	}
+	var res struct {
+		Cancelled bool `json:"cancelled"`
+	}
+	if err := c.Call(ctx, "job-cancel", map[string]any{"jobId": id}, &res); err != nil {
+		return false, err
+	}
+	return res.Cancelled, nil
+}
+
+// SetJobPriority sets a job's priority and returns it as the hub now has
+// it.
+func (c *Client) SetJobPriority(ctx context.Context, id string, priority int) (*Job, error) {
+	if err := c.require(protocol.CapJobs, "job-priority"); err != nil {
+		return nil, err
+	}
+	var res struct {
+		Job Job `json:"job"`
+	}
+	if err := c.Call(ctx, "job-priority", map[string]any{"jobId": id, "priority": priority}, &res); err != nil {
+		return nil, err
+	}
+	return &res.Job, nil
+}
+
+// PeerPing is how one peer-ping went. Error says why an unreachable peer
+// did not answer.
+type PeerPing struct {
+	Peer      string  `json:"peer"`
+	From      string  `json:"from,omitempty"`
+	Reachable bool    `json:"reachable"`
+	LatencyMs float64 `json:"latencyMs,omitempty"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// PingPeer pings peer through the hub, from another peer when from is not
+// empty. An unreachable peer is a result, not an error.
+func (c *Client) PingPeer(ctx context.Context, from, peer string) (*PeerPing, error) {
+	if err := c.require(protocol.CapPeerPing, "peer-ping"); err != nil {
+		return nil, err
+	}
+	req := map[string]any{"peer": peer}
+	if from != "" {
+		req["from"] = from
+	}
+	var res PeerPing
+	if err := c.Call(ctx, "peer-ping", req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// PeerControl is a peer-control event: how far a peer restart or update
+// has got.
+type PeerControl struct {
+	OperationID string `json:"operationId"`
+	Peer        string `json:"peer"`
+	Action      string `json:"action"`
+	Phase       string `json:"phase"`
+	Message     string `json:"message,omitempty"`
+}
+
+// Finished reports whether the operation has ended, either way.
+func (p PeerControl) Finished() bool { return p.Phase == "done" || p.Phase == "failed" }
+
+// RestartPeer asks peer to restart and returns the operation id its
+// peer-control events carry.
+func (c *Client) RestartPeer(ctx context.Context, peer string) (string, error) {
+	return c.controlPeer(ctx, "peer-restart", peer)
+}
+
+// UpdatePeer asks peer to update itself and restart.
+func (c *Client) UpdatePeer(ctx context.Context, peer string) (string, error) {
+	return c.controlPeer(ctx, "peer-update", peer)
+}
+
+func (c *Client) controlPeer(ctx context.Context, action, peer string) (string, error) {
+	if err := c.require(protocol.CapPeerControl, action); err != nil {
+		return "", err
+	}
+	var res struct {
+		OperationID string `json:"operationId"`
+	}
+	if err := c.Call(ctx, action, map[string]any{"peer": peer}, &res); err != nil {
+		return "", err
+	}
+	return res.OperationID, nil
+}
+
+// PeerConfig is the hub's stored settings for one peer.
+type PeerConfig struct {
+	Peer      string `json:"peer"`
+	Volume    *int   `json:"volume,omitempty"`
+	UpdatedBy string `json:"updatedBy,omitempty"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+}
+
+// PeerConfigs lists the settings the hub stores, one entry per configured
+// peer.
+func (c *Client) PeerConfigs(ctx context.Context) ([]PeerConfig, error) {
+	if err := c.require(protocol.CapPeerConfig, "peer-config"); err != nil {
+		return nil, err
+	}
+	var res struct {
+		Configs []PeerConfig `json:"configs"`
+	}
+	if err := c.Call(ctx, "peer-config", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Configs, nil
+}
+
+// SetPeerVolume stores the volume, a percentage, that peer plays
+// broadcasts at.
+func (c *Client) SetPeerVolume(ctx context.Context, peer string, volume int) (*PeerConfig, error) {
+	if err := c.require(protocol.CapPeerConfig, "peer-config-set"); err != nil {
+		return nil, err
+	}
+	if volume < 0 || volume > protocol.MaxPeerVolume {
+		return nil, fmt.Errorf("volume out of range: %d", volume)
+	}
+	var res struct {
+		Config PeerConfig `json:"config"`
+	}
+	if err := c.Call(ctx, "peer-config-set", map[string]any{"peer": peer, "volume": volume}, &res); err != nil {
+		return nil, err
+	}
+	return &res.Config, nil
+}
+
+func (c *Client) Play(ctx context.Context, filename string) error {
+	return c.PlayWith(ctx, filename, PlayOptions{})
+}
+
+// PlayOptions adjust a play or broadcast-play.
+type PlayOptions struct {
+	// Zone limits a broadcast-play to the zone's peers.
+	Zone string
+	// Sync starts every peer of a broadcast-play together.
+	Sync bool
+	// Loop repeats the file until a broadcast-stop.
+	Loop bool
+	// Normalize has each peer apply the file's ReplayGain.
+	Normalize bool
+}
+
+// PlayWith plays filename on this client; only opts.Loop and
+// opts.Normalize apply.
+func (c *Client) PlayWith(ctx context.Context, filename string, opts PlayOptions) error {
+	args := map[string]any{"filename": filename}
+	if opts.Loop {
+		if err := c.require(protocol.CapBroadcastStop, "looped play"); err != nil {
+			return err
+		}
+		args["loop"] = true
+	}
+	if opts.Normalize {
+		if err := c.require(protocol.CapNormalize, "normalized play"); err != nil {
+			return err
+		}
+		args["normalize"] = true
+	}
+	return c.Call(ctx, "play", args, nil)
+}
+
+func (c *Client) Broadcast(ctx context.Context, message string) error {
+	return c.BroadcastTo(ctx, message, "")
+}
+
+func (c *Client) BroadcastPlay(ctx context.Context, filename string) error {
+	return c.BroadcastPlayTo(ctx, filename, "")
+}
+
+// BroadcastTo sends message to the peers in zone, or to every peer when
+// zone is empty.
+func (c *Client) BroadcastTo(ctx context.Context, message, zone string) error {
+	args, err := c.zoneArgs(zone, "broadcast")
+	if err != nil {
+		return err
+	}
+	args["message"] = message
+	return c.Call(ctx, "broadcast", args, nil)
+}
+
+// BroadcastPlayTo plays filename on the peers in zone, or on every peer
+// when zone is empty.
+func (c *Client) BroadcastPlayTo(ctx context.Context, filename, zone string) error {
+	_, err := c.BroadcastPlayWith(ctx, filename, PlayOptions{Zone: zone})
+	return err
+}
+
+// BroadcastPlaySynced is BroadcastPlayTo with every peer starting
+// together, and answers when they start.
+func (c *Client) BroadcastPlaySynced(ctx context.Context, filename, zone string) (time.Time, error) {
+	return c.BroadcastPlayWith(ctx, filename, PlayOptions{Zone: zone, Sync: true})
+}
+
+// BroadcastPlayWith plays filename on every peer, or those in opts.Zone.
+// With opts.Sync it answers when they start; otherwise the time is zero.
+func (c *Client) BroadcastPlayWith(ctx context.Context, filename string, opts PlayOptions) (time.Time, error) {
+	args, err := c.zoneArgs(opts.Zone, "broadcast-play")
+	if err != nil {
+		return time.Time{}, err
+	}
+	args["filename"] = filename
+	if opts.Sync {
+		if err := c.require(protocol.CapSyncPlay, "synchronized broadcast-play"); err != nil {
+			return time.Time{}, err
+		}
+		args["sync"] = true
+	}
+	if opts.Loop {
+		if err := c.require(protocol.CapBroadcastStop, "looped broadcast-play"); err != nil {
+			return time.Time{}, err
+		}
+		args["loop"] = true
+	}
+	if opts.Normalize {
+		if err := c.require(protocol.CapNormalize, "normalized broadcast-play"); err != nil {
+			return time.Time{}, err
+		}
+		args["normalize"] = true
+	}
+	var res struct {
+		StartAt string `json:"startAt"`
+	}
+	if err := c.Call(ctx, "broadcast-play", args, &res); err != nil || !opts.Sync {
+		return time.Time{}, err
+	}
+	start, err := time.Parse(time.RFC3339Nano, res.StartAt)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("broadcast-play start time: %w", err)
+	}
+	return start, nil
+}
+
+// BroadcastStop silences every peer, ending loops, and returns how many
+// it reached.
+func (c *Client) BroadcastStop(ctx context.Context) (int, error) {
+	if err := c.require(protocol.CapBroadcastStop, "broadcast-stop"); err != nil {
+		return 0, err
+	}
+	var res struct {
+		Recipients int `json:"recipients"`
+	}
+	if err := c.Call(ctx, "broadcast-stop", nil, &res); err != nil {
+		return 0, err
+	}
+	return res.Recipients, nil
+}
+
+// HubClock is one reading of the hub's clock.
+type HubClock struct {
+	// Offset is how far the hub's clock runs ahead of this machine's,
+	// taking the answer as made halfway through RTT.
+	Offset time.Duration
+	RTT    time.Duration
+	// UpstreamOffset and UpstreamRTT are the hub's own measurement of
+	// the clock it follows, when it reports one.
+	UpstreamOffset, UpstreamRTT time.Duration
+}
+
+// Clock reads the hub's clock once.
+func (c *Client) Clock(ctx context.Context) (*HubClock, error) {
+	if err := c.require(protocol.CapSyncPlay, "clock"); err != nil {
+		return nil, err
+	}
+	var res struct {
+		NowMs    float64 `json:"nowMs"`
+		OffsetMs float64 `json:"offsetMs"`
+		RTTMs    float64 `json:"rttMs"`
+	}
+	sent := time.Now()
+	if err := c.Call(ctx, "clock", nil, &res); err != nil {
+		return nil, err
+	}
+	rtt := time.Since(sent)
+	mid := sent.Add(rtt / 2)
+	hub := time.UnixMicro(int64(res.NowMs * 1000))
+	return &HubClock{
+		Offset:         hub.Sub(mid),
+		RTT:            rtt,
+		UpstreamOffset: time.Duration(res.OffsetMs * float64(time.Millisecond)),
+		UpstreamRTT:    time.Duration(res.RTTMs * float64(time.Millisecond)),
+	}, nil
+}
+
+// FileStats is how often a file was broadcast-played.
+type FileStats struct {
+	Name  string `json:"name"`
+	Plays int    `json:"plays"`
+	// LastPlayed is RFC 3339.
+	LastPlayed string `json:"lastPlayed,omitempty"`
+}
+
+// Stats lists the play counts of every file played at least once.
+func (c *Client) Stats(ctx context.Context) ([]FileStats, error) {
+	if err := c.require(protocol.CapStats, "stats"); err != nil {
+		return nil, err
+	}
+	var res struct {
+		Files []FileStats `json:"files"`
+	}
+	if err := c.Call(ctx, "stats", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Files, nil
+}
+
+// zoneArgs starts the arguments of an action limited to zone.
+func (c *Client) zoneArgs(zone, action string) (map[string]any, error) {
+	if zone == "" {
+		return map[string]any{}, nil
+	}
+	if err := c.require(protocol.CapZones, action+" to a zone"); err != nil {
+		return nil, err
+	}
+	return map[string]any{"zone": zone}, nil
+}
+
+// Zone is a named group of peers that broadcasts can be limited to.
+type Zone struct {
+	Name      string   `json:"name"`
+	Peers     []string `json:"peers"`
+	Deleted   bool     `json:"deleted,omitempty"`
+	UpdatedBy string   `json:"updatedBy,omitempty"`
+	UpdatedAt string   `json:"updatedAt,omitempty"`
+}
+
+// Zones lists the hub's zones.
+func (c *Client) Zones(ctx context.Context) ([]Zone, error) {
+	if err := c.require(protocol.CapZones, "zones"); err != nil {
+		return nil, err
+	}
+	var res struct {
+		Zones []Zone `json:"zones"`
+	}
+	if err := c.Call(ctx, "zones", nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Zones, nil
+}
+
+// SetZone creates the zone name, or replaces its peers.
+func (c *Client) SetZone(ctx context.Context, name string, peers []string) (*Zone, error) {
+	if err := c.require(protocol.CapZones, "zone-set"); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("zone name is required")
+	}
+	if peers == nil {
+		peers = []string{}
+	}
+	var res struct {
+		Zone Zone `json:"zone"`
+	}
+	if err := c.Call(ctx, "zone-set", map[string]any{"zone": name, "peers": peers}, &res); err != nil {
+		return nil, err
+	}
+	return &res.Zone, nil
+}
+
+// DeleteZone removes the zone name; deleting a missing zone succeeds.
+func (c *Client) DeleteZone(ctx context.Context, name string) error {
+	if err := c.require(protocol.CapZones, "zone-delete"); err != nil {
+		return err
+	}
+	return c.Call(ctx, "zone-delete", map[string]any{"zone": name}, nil)
+}
+
+// BroadcastImage shows the uploaded image filename, with an optional
+// caption, to every peer and returns how many it reached.
+func (c *Client) BroadcastImage(ctx context.Context, filename, caption string) (int, error) {
+	if err := c.require(protocol.CapBroadcastImage, "broadcast-image"); err != nil {
+		return 0, err
+	}
+	if !strings.HasPrefix(ContentType(filename), "image/") {
+		return 0, fmt.Errorf("%s is not an image", filename)
+	}
+	payload := map[string]any{"filename": filename}
+	if caption != "" {
+		payload["caption"] = caption
+	}
+	var res struct {
+		Recipients int `json:"recipients"`
+	}
+	if err := c.Call(ctx, "broadcast-image", payload, &res); err != nil {
+		return 0, err
+	}
+	return res.Recipients, nil
+}
+
+// Clipboard shares text with every peer and returns how many it reached.
+func (c *Client) Clipboard(ctx context.Context, text string) (int, error) {
+	if err := c.require(protocol.CapClipboard, "clipboard"); err != nil {
+		return 0, err
+	}
+	if len(text) > protocol.MaxClipboardBytes {
+		return 0, fmt.Errorf("clipboard text is %d bytes, over the %d byte limit", len(text), protocol.MaxClipboardBytes)
+	}
+	var res struct {
+		Recipients int `json:"recipients"`
+	}
+	if err := c.Call(ctx, "clipboard", map[string]any{"text": text}, &res); err != nil {
+		return 0, err
+	}
+	return res.Recipients, nil
+}
+
+// KVEntry is one key of the hub's shared key-value state. In kv events a
+// deleted key comes with Deleted set and no value.
+type KVEntry struct {
+	Key   string `json:"key"`
+	Value string `json:"value,omitempty"`
+	// By is the peer id of the client that last set the key.
+	By        string `json:"by,omitempty"`
+	UpdatedAt string `json:"updatedAt,omitempty"`
+	ExpiresAt string `json:"expiresAt,omitempty"`
+	Deleted   bool   `json:"deleted,omitempty"`
+}
+
+// KVSet stores value under key for every client; a positive ttl makes the
+// key expire.
+func (c *Client) KVSet(ctx context.Context, key, value string, ttl time.Duration) (*KVEntry, error) {
+	if err := c.require(protocol.CapKV, "kv-set"); err != nil {
+		return nil, err
+	}
+	if err := checkKV(key, value); err != nil {
+		return nil, err
+	}
+	payload := map[string]any{"key": key, "value": value}
+	if ttl > 0 {
+		payload["ttl"] = int(ttl / time.Second)
+	}
+	var res struct {
+		Entry KVEntry `json:"entry"`
+	}
+	if err := c.Call(ctx, "kv-set", payload, &res); err != nil {
+		return nil, err
+	}
+	return &res.Entry, nil
+}
+
+// KVDelete removes key.
+func (c *Client) KVDelete(ctx context.Context, key string) error {
+	if err := c.require(protocol.CapKV, "kv-set"); err != nil {
+		return err
+	}
+	return c.Call(ctx, "kv-set", map[string]any{"key": key, "value": nil}, nil)
+}
+
+// KVGet returns key, or nil when it is not set.
+func (c *Client) KVGet(ctx context.Context, key string) (*KVEntry, error) {
+	entries, err := c.kvQuery(ctx, "kv-get", map[string]any{"key": key})
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	return &entries[0], nil
+}
+
+// KVList returns every key starting with prefix.
+func (c *Client) KVList(ctx context.Context, prefix string) ([]KVEntry, error) {
+	return c.kvQuery(ctx, "kv-get", map[string]any{"prefix": prefix})
+}
+
+// KVWatch returns every key starting with prefix and has the hub push a
+// kv event whenever one of them is set or deleted, for as long as the
+// socket stays open.
+func (c *Client) KVWatch(ctx context.Context, prefix string) ([]KVEntry, error) {
+	return c.kvQuery(ctx, "kv-watch", map[string]any{"prefix": prefix})
+}
+
+func (c *Client) kvQuery(ctx context.Context, action string, payload map[string]any) ([]KVEntry, error) {
+	if err := c.require(protocol.CapKV, action); err != nil {
+		return nil, err
+	}
+	var res struct {
+		Entries []KVEntry `json:"entries"`
+	}
+	if err := c.Call(ctx, action, payload, &res); err != nil {
+		return nil, err
+	}
+	return res.Entries, nil
+}
+
+func checkKV(key, value string) error {
+	switch {
+	case key == "":
+		return fmt.Errorf("key is required")
+	case len(key) > protocol.MaxKVKeyBytes:
+		return fmt.Errorf("key is %d bytes, over the %d byte limit", len(key), protocol.MaxKVKeyBytes)
+	case len(value) > protocol.MaxKVValueBytes:
+		return fmt.Errorf("value is %d bytes, over the %d byte limit", len(value), protocol.MaxKVValueBytes)
+	}
+	return nil
+}
+
+// ChatMessage is one message of a chat channel, as chat-history returns
+// it and chat events carry it.
+type ChatMessage struct {
+	ID      string `json:"id"`
+	Channel string `json:"channel"`
+	// From is the peer id of the sender, as the hub knows it.
+	From string `json:"from"`
+	Text string `json:"text"`
+	Time string `json:"time"`
+}
+
+// ChatTyping is the payload of a chat-typing event.
+type ChatTyping struct {
+	Channel string `json:"channel"`
+	From    string `json:"from"`
+}
+
+// Chat posts text to channel, or the default channel when it is empty,
+// and returns the message as the hub stored it.
+func (c *Client) Chat(ctx context.Context, channel, text string) (*ChatMessage, error) {
+	if err := c.require(protocol.CapChat, "chat"); err != nil {
+		return nil, err
+	}
+	switch {
+	case strings.TrimSpace(text) == "":
+		return nil, fmt.Errorf("message is empty")
+	case len(text) > protocol.MaxChatBytes:
+		return nil, fmt.Errorf("message is %d bytes, over the %d byte limit", len(text), protocol.MaxChatBytes)
+	}
+	var res struct {
+		Message ChatMessage `json:"message"`
+	}
+	if err := c.Call(ctx, "chat", map[string]any{"channel": chatChannel(channel), "text": text}, &res); err != nil {
+		return nil, err
+	}
+	return &res.Message, nil
+}
+
+// ChatHistory returns up to limit of the channel's latest messages, oldest
+// first; a limit of zero leaves the count to the hub.
+func (c *Client) ChatHistory(ctx context.Context, channel string, limit int) ([]ChatMessage, error) {
+	if err := c.require(protocol.CapChat, "chat-history"); err != nil {
+		return nil, err
+	}
+	payload := map[string]any{"channel": chatChannel(channel)}
+	if limit > 0 {
+		payload["limit"] = limit
+	}
+	var res struct {
+		Messages []ChatMessage `json:"messages"`
+	}
+	if err := c.Call(ctx, "chat-history", payload, &res); err != nil {
+		return nil, err
+	}
+	return res.Messages, nil
+}
+
+// ChatTyping tells the channel's other clients this one is typing.
+func (c *Client) ChatTyping(ctx context.Context, channel string) error {
+	if err := c.require(protocol.CapChat, "chat-typing"); err != nil {
+		return err
+	}
+	return c.Call(ctx, "chat-typing", map[string]any{"channel": chatChannel(channel)}, nil)
+}
+
+func chatChannel(channel string) string {
+	if channel = strings.TrimSpace(channel); channel != "" {
+		return channel
+	}
+	return protocol.DefaultChatChannel
+}
+
+// Bye tells the hub this client is leaving on purpose, so it can log a
+// clean departure rather than a dropped socket. Hubs that predate bye
+// answer with an error, which callers can ignore.
+func (c *Client) Bye(ctx context.Context, reason string) error {
+	return c.Call(ctx, "bye", map[string]any{"reason": reason}, nil)
+}
+
+// Playback sends one of the transport actions (volume, pause, resume, stop,
+// seek). With all set the hub fans it out to every peer.
+func (c *Client) Playback(ctx context.Context, action string, payload map[string]any, all bool) error {
+	if err := c.require(protocol.CapPlayback, action); err != nil {
+		return err
+	}
+	req := make(map[string]any, len(payload)+1)
+	for k, v := range payload {
+		req[k] = v
+	}
+	if all {
+		req["broadcast"] = true
+	}
+	return c.Call(ctx, action, req, nil)
+}
+
+func (c *Client) Volume(ctx context.Context, level int, all bool) error {
+	if level < 0 || level > 100 {
+		return fmt.Errorf("volume out of range: %d", level)
+	}
+	return c.Playback(ctx, "volume", map[string]any{"volume": level}, all)
+}
+
+func (c *Client) Seek(ctx context.Context, position float64, all bool) error {
+	return c.Playback(ctx, "seek", map[string]any{"position": position}, all)
+}
+
+// Upload sends a whole file and checks the digest the hub computed over
+// what it stored. Hubs that predate checksums return none, and the result
+// is not Verified.
+func (c *Client) Upload(ctx context.Context, req UploadRequest) (*UploadResult, error) {
+	if req.Temporary {
+		if err := c.require(protocol.CapTemporary, "temporary upload"); err != nil {
+			return nil, err
+		}
+	}
+	sum := sha256.Sum256(req.Data)
+	digest := hex.EncodeToString(sum[:])
+	payload := map[string]any{
+		"filename":    req.Filename,
+		"base64":      rawBytes(req.Data),
+		"contentType": req.ContentType,
+		"sha256":      digest,
+	}
+	if req.ContentType == "" {
+		payload["contentType"] = ContentType(req.Filename)
+	}
+	addTemporary(payload, req.Temporary, req.TTL)
+	addMeta(payload, req.Meta)
+	var res UploadResult
+	if err := c.Call(ctx, "upload", payload, &res); err != nil {
+		return nil, err
+	}
+	if err := checkDigest(&res, digest); err != nil {
+		return nil, err
+	}
+	if req.Temporary {
+		if err := CheckTemporary(&res, req.TTL); err != nil {
+			return nil, err
+		}
+	}
+	return &res, nil
+}
+
+// UploadBegin opens a chunked upload. UploadCommit cannot tell whether it
+// was temporary, so the caller checks that answer with CheckTemporary.
+func (c *Client) UploadBegin(ctx context.Context, req UploadBeginRequest) (*UploadProgress, error) {
+	if err := c.require(protocol.CapChunkedUpload, "upload-begin"); err != nil {
+		return nil, err
+	}
+	if req.Temporary {
+		if err := c.require(protocol.CapTemporary, "temporary upload"); err != nil {
+			return nil, err
+		}
+	}
+	payload := map[string]any{
+		"filename":    req.Filename,
+		"size":        req.Size,
+		"sha256":      req.SHA256,
+		"contentType": req.ContentType,
+	}
+	if req.ContentType == "" {
+		payload["contentType"] = ContentType(req.Filename)
+	}
+	addTemporary(payload, req.Temporary, req.TTL)
+	addMeta(payload, req.Meta)
+	var res UploadProgress
+	if err := c.Call(ctx, "upload-begin", payload, &res); err != nil {
+		return nil, err
+	}
+	if res.UploadID == "" {
+		return nil, fmt.Errorf("upload-begin: hub returned no upload id")
+	}
+	return &res, nil
+}
+
+func (c *Client) UploadChunk(ctx context.Context, uploadID string, offset int64, data []byte) (*UploadProgress, error) {
+	if err := c.require(protocol.CapChunkedUpload, "upload-chunk"); err != nil {
+		return nil, err
+	}
+	var res UploadProgress
+	err := c.Call(ctx, "upload-chunk", map[string]any{
+		"uploadId": uploadID,
+		"offset":   offset,
+		"base64":   rawBytes(data),
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// UploadCommit finishes a chunked upload and checks the stored digest
+// against the one given to UploadBegin.
+func (c *Client) UploadCommit(ctx context.Context, uploadID, sha256 string) (*UploadResult, error) {
+	if err := c.require(protocol.CapChunkedUpload, "upload-commit"); err != nil {
+		return nil, err
+	}
+	var res UploadResult
+	if err := c.Call(ctx, "upload-commit", map[string]any{"uploadId": uploadID}, &res); err != nil {
+		return nil, err
+	}
+	if err := checkDigest(&res, sha256); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// UploadResume asks where an interrupted chunked upload left off.
+func (c *Client) UploadResume(ctx context.Context, uploadID, sha256 string) (*UploadProgress, error) {
+	if err := c.require(protocol.CapChunkedUpload, "upload-resume"); err != nil {
+		return nil, err
+	}
+	var res UploadProgress
+	if err := c.Call(ctx, "upload-resume", map[string]any{"uploadId": uploadID, "sha256": sha256}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+func (c *Client) UploadCancel(ctx context.Context, uploadID string) error {
+	if err := c.require(protocol.CapChunkedUpload, "upload-cancel"); err != nil {
+		return err
+	}
+	return c.Call(ctx, "upload-cancel", map[string]any{"uploadId": uploadID}, nil)
+}
+
+func (c *Client) Hash(ctx context.Context, filename string) (*HashResult, error) {
+	if err := c.require(protocol.CapHash, "hash"); err != nil {
+		return nil, err
+	}
+	var res HashResult
+	if err := c.Call(ctx, "hash", map[string]any{"filename": filename}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Tags returns the tags the hub stores, by file name.
+func (c *Client) Tags(ctx context.Context) (map[string][]string, error) {
+	if err := c.require(protocol.CapTags, "tags"); err != nil {
+		return nil, err
+	}
+	var res struct {
+		Tags map[string][]string `json:"tags"`
+	}
+	if err := c.Call(ctx, "tags", map[string]any{}, &res); err != nil {
+		return nil, err
+	}
+	return res.Tags, nil
+}
+
+// SetTags replaces the hub's tags for filename; no tags removes them.
+func (c *Client) SetTags(ctx context.Context, filename string, tags []string) error {
+	if err := c.require(protocol.CapTags, "tags"); err != nil {
+		return err
+	}
+	if tags == nil {
+		tags = []string{}
+	}
+	return c.Call(ctx, "tags", map[string]any{"filename": filename, "tags": tags}, nil)
+}
+
+// PeerFiles lists path inside another peer's shared folder.
+func (c *Client) PeerFiles(ctx context.Context, peer, path string) (*PeerListing, error) {
+	if err := c.require(protocol.CapPeerFiles, "peer-files"); err != nil {
+		return nil, err
+	}
+	var res PeerListing
+	if err := c.Call(ctx, "peer-files", map[string]any{"peer": peer, "path": path}, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// PeerUpload asks peer to push one of its shared files into the library.
+func (c *Client) PeerUpload(ctx context.Context, peer, filename string) error {
+	if err := c.require(protocol.CapPeerFiles, "peer-upload"); err != nil {
+		return err
+	}
+	return c.Call(ctx, "peer-upload", map[string]any{"peer": peer, "filename": filename}, nil)
+}
+
+func addMeta(payload map[string]any, meta *AudioMeta) {
+	if meta != nil && *meta != (AudioMeta{}) {
+		payload["metadata"] = meta
+	}
+}
+
+func addTemporary(payload map[string]any, temporary bool, ttl time.Duration) {
+	if !temporary {
+		return
+	}
+	payload["temporary"] = true
+	if ttl > 0 {
+		payload["ttlSeconds"] = int64(ttl / time.Second)
+	} else {
+		payload["deleteOnDisconnect"] = true
+	}
+}
+
+// CheckTemporary fails on the answer to a temporary upload that does not
+// say when the file goes: an expiresAt for one with a ttl, or
+// deleteOnDisconnect for one without. The hub has stored the file anyway.
+func CheckTemporary(res *UploadResult, ttl time.Duration) error {
+	if ttl > 0 && res.ExpiresAt == "" {
+		return fmt.Errorf("%s: %w: no expiresAt", res.Filename, ErrNotTemporary)
+	}
+	if ttl <= 0 && !res.DeleteOnDisconnect {
+		return fmt.Errorf("%s: %w: not deleted on disconnect", res.Filename, ErrNotTemporary)
+	}
+	return nil
+}
+
+// checkDigest fails on a digest that differs from the one sent, and marks
+// res Verified on one that matches.
+func checkDigest(res *UploadResult, sent string) error {
+	res.Verified = false
+	if res.SHA256 == "" {
+		return nil
+	}
+	if !strings.EqualFold(res.SHA256, sent) {
+		return fmt.Errorf("%w: hub stored %s, sent %s", ErrChecksumMismatch, ShortDigest(res.SHA256), ShortDigest(sent))
+	}
+	res.Verified = true
+	return nil
+}
+
+func ShortDigest(digest string) string {
+	if len(digest) > 12 {
+		return digest[:12]
+	}
+	return digest
+}
+
+// ContentType guesses the MIME type the hub expects from a file name.
+func ContentType(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".mp3"):
+		return "audio/mpeg"
+	case strings.HasSuffix(lower, ".wav"):
+		return "audio/wav"
+	case strings.HasSuffix(lower, ".ogg"):
+		return "audio/ogg"
+	case strings.HasSuffix(lower, ".flac"):
+		return "audio/flac"
+	case strings.HasSuffix(lower, ".m4a"):
+		return "audio/mp4"
+	}
+	if t := mime.TypeByExtension(path.Ext(lower)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// Subscription narrows which events the hub pushes to this connection.
+// Empty Events means every event; a zero StatusInterval keeps the hub's
+// default status push rate.
+type Subscription struct {
+	Events         []string
+	StatusInterval time.Duration
+}
+
+// SubscribeResult echoes what the hub actually applied.
+type SubscribeResult struct {
+	Events                []string `json:"events"`
+	StatusIntervalSeconds float64  `json:"statusIntervalSeconds"`
+}
+
+func (c *Client) Subscribe(ctx context.Context, sub Subscription) (*SubscribeResult, error) {
+	if err := c.require(protocol.CapSubscribe, "subscribe"); err != nil {
+		return nil, err
+	}
+	payload := map[string]any{}
+	if len(sub.Events) > 0 {
+		payload["events"] = sub.Events
+	}
+	if sub.StatusInterval > 0 {
+		payload["statusIntervalSeconds"] = sub.StatusInterval.Seconds()
+	}
+	var res SubscribeResult
+	if err := c.Call(ctx, "subscribe", payload, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// AuditEntry is one action in the hub's audit trail.
+type AuditEntry struct {
+	Time string `json:"time"`
+	// Actor is the peer id of the client that acted.
+	Actor  string `json:"actor"`
+	Action string `json:"action"`
+	// Target is the file, or the message for a broadcast.
+	Target string `json:"target,omitempty"`
+}
+
+// Audit fetches up to count of the hub's most recent audited actions,
+// oldest first.
+func (c *Client) Audit(ctx context.Context, count int) ([]AuditEntry, error) {
+	if err := c.require(protocol.CapAudit, "audit"); err != nil {
+		return nil, err
+	}
+	var res struct {
+		Entries []AuditEntry `json:"entries"`
+	}
+	if err := c.Call(ctx, "audit", map[string]any{"count": count}, &res); err != nil {
+		return nil, err
+	}
+	return res.Entries, nil
+}
+
+// LogEntry is one hub log line, as returned by "logs" and pushed in log
+// events.
+type LogEntry struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+	Source  string `json:"source,omitempty"`
+}
+
+// Logs fetches up to count recent hub log lines at or above level; an
+// empty level means all.
+func (c *Client) Logs(ctx context.Context, count int, level string) ([]LogEntry, error) {
+	if err := c.require(protocol.CapLogs, "logs"); err != nil {
+		return nil, err
+	}
+	payload := map[string]any{"count": count}
+	if level != "" {
+		payload["level"] = level
+	}
+	var res struct {
+		Lines []LogEntry `json:"lines"`
+	}
+	if err := c.Call(ctx, "logs", payload, &res); err != nil {
+		return nil, err
+	}
+	return res.Lines, nil
+}
@@ -0,0 +1,43 @@
+package hubclient
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCheckDigest(t *testing.T) {
+	for _, tc := range []struct {
+		stored   string
+		verified bool
+		mismatch bool
+	}{
+		{"", false, false},
+		{"ABCDEF", true, false},
+		{"abcdee", false, true},
+	} {
+		res := UploadResult{SHA256: tc.stored, Verified: true}
+		err := checkDigest(&res, "abcdef")
+		if res.Verified != tc.verified || errors.Is(err, ErrChecksumMismatch) != tc.mismatch {
+			t.Errorf("checkDigest(%q) = verified %v, %v", tc.stored, res.Verified, err)
+		}
+	}
+}
+
+func TestCheckTemporary(t *testing.T) {
+	for _, tc := range []struct {
+		res  UploadResult
+		ttl  time.Duration
+		fail bool
+	}{
+		{UploadResult{ExpiresAt: "2026-10-18T12:00:00Z"}, time.Hour, false},
+		{UploadResult{}, time.Hour, true},
+		{UploadResult{DeleteOnDisconnect: true}, 0, false},
+		{UploadResult{}, 0, true},
+	} {
+		err := CheckTemporary(&tc.res, tc.ttl)
+		if errors.Is(err, ErrNotTemporary) != tc.fail {
+			t.Errorf("CheckTemporary(%+v, %s) = %v", tc.res, tc.ttl, err)
+		}
+	}
+}
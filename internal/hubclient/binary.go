@@ -0,0 +1,49 @@
+package hubclient
+
+import (
+	"encoding/base64"
+	"encoding/json"
+
+	"brain/internal/protocol"
+)
+
+// rawBytes marks file data in a request payload. In JSON it is a base64
+// string; when the hub takes binary frames it travels raw after the
+// header instead, saving the third base64 adds.
+type rawBytes []byte
+
+func (b rawBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.StdEncoding.EncodeToString(b))
+}
+
+// BinaryFrames reports whether file data is sent raw in binary frames.
+func (c *Client) BinaryFrames() bool {
+	if !c.LengthPrefixed() {
+		return false
+	}
+	hello := c.Hello()
+	return hello != nil && hello.Has(protocol.CapBinaryFrames)
+}
+
+// splitBinary takes the rawBytes member out of payload when binary frames
+// are in use, naming it in the header so the hub knows where it belongs.
+func (c *Client) splitBinary(payload map[string]any) (map[string]any, []byte) {
+	if !c.BinaryFrames() {
+		return payload, nil
+	}
+	for key, v := range payload {
+		raw, ok := v.(rawBytes)
+		if !ok || len(raw) == 0 {
+			continue
+		}
+		header := make(map[string]any, len(payload))
+		for k, v := range payload {
+			if k != key {
+				header[k] = v
+			}
+		}
+		header[protocol.BinaryField] = key
+		return header, raw
+	}
+	return payload, nil
+}
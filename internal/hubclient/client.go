@@ -0,0 +1,374 @@
+// Package hubclient speaks the hub's socket protocol and offers typed
+// wrappers for the hub actions. Connections start as newline-delimited
+// JSON; UseLengthPrefixed moves them to length-prefixed frames, optionally
+// switching both directions to CBOR. Once framed, file data goes to hubs
+// that offer binary frames as raw bytes after the message header instead
+// of base64.
+// Requests can also travel as JSON-RPC 2.0; see PreferJSONRPC.
+package hubclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"brain/internal/metrics"
+	"brain/internal/protocol"
+)
+
+// DefaultTimeout applies to requests without a deadline when no Timeout
+// func is installed.
+const DefaultTimeout = 6 * time.Second
+
+// Message is any message on the socket: a request, its response or an
+// event. Data and Payload are left in the codec the message arrived in;
+// DecodeData and DecodePayload read them whatever that was.
+type Message struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	OK      *bool           `json:"ok,omitempty"`
+	Error   *protocol.Error `json:"error,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	// Binary holds the raw bytes of a message that arrived as a binary
+	// frame.
+	Binary []byte `json:"-"`
+
+	codec protocol.Codec
+}
+
+// Client is one connection to the hub's socket. A nil *Client is valid and
+// fails every request with ErrNotConnected.
+type Client struct {
+	conn         net.Conn
+	pending      *pendingTable
+	closed       chan struct{}
+	eventHandler func(Message)
+	requestID    uint64
+
+	controlWrites  chan writeRequest
+	bulkWrites     chan writeRequest
+	limiter        rateLimiter
+	metrics        atomic.Pointer[metrics.Registry]
+	preferRPC      atomic.Bool
+	rpcOffered     atomic.Bool
+	hello          atomic.Pointer[protocol.Hello]
+	retry          atomic.Pointer[RetryPolicy]
+	switching      atomic.Pointer[framingSwitch]
+	lengthPrefixed atomic.Bool
+	codecName      atomic.Value
+	validation     atomic.Int32
+	framedWrites   bool           // owned by writeLoop
+	writeCodec     protocol.Codec // owned by writeLoop
+	helloReady     chan struct{}
+	helloOnce      sync.Once
+	// actions maps request ids to their action so the bytes of a
+	// response are counted against it.
+	actions sync.Map
+	// partIDs holds the ids of the leading messages of a split
+	// upload-chunk, whose answers no one waits for.
+	partIDs sync.Map
+
+	// Observe, when set, is called once per request after it completes,
+	// with the context the request was made under.
+	Observe func(ctx context.Context, action string, started time.Time, err error)
+	// Timeout, when set, picks the deadline for requests whose context
+	// has none.
+	Timeout func(action string) time.Duration
+	// Sent, when set, is called with every request once it is written.
+	// It must not modify payload.
+	Sent func(id, action string, payload map[string]any)
+}
+
+// Dial connects to the hub socket at address, racing every address the
+// host resolves to. handler receives events, including a synthetic
+// "disconnect" event when the connection ends.
+func Dial(address string, handler func(Message)) (*Client, error) {
+	conn, err := dialHappy(context.Background(), address)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(conn, handler), nil
+}
+
+func newClient(conn net.Conn, handler func(Message)) *Client {
+	client := &Client{
+		conn:         conn,
+		pending:      newPendingTable(DefaultMaxInFlight),
+		closed:       make(chan struct{}),
+		helloReady:   make(chan struct{}),
+		eventHandler: handler,
+
+		controlWrites: make(chan writeRequest),
+		bulkWrites:    make(chan writeRequest),
+	}
+	go client.readLoop()
+	go client.writeLoop()
+	return client
+}
+
+// RemoteAddr is the address the connection went to: the one that won the
+// dial race, or the proxy.
+func (c *Client) RemoteAddr() string {
+	if c == nil || c.conn == nil {
+		return ""
+	}
+	return c.conn.RemoteAddr().String()
+}
+
+func (c *Client) Close() error {
+	if c != nil && c.conn != nil {
+		return c.conn.Close()
+	}
+	return nil
+}
+
+func (c *Client) readLoop() {
+	frames := protocol.NewFrameReader(c.conn, protocol.MaxFrameSize)
+	codec := protocol.JSON
+	var readErr error
+	for {
+		frame, wire, err := frames.Next()
+		read := func(action string) {
+			c.registry().Add(MetricBytesRead, metrics.Labels{"action": action}, float64(wire))
+		}
+		if errors.Is(err, protocol.ErrFrameTooLarge) || errors.Is(err, protocol.ErrBadFrame) {
+			read("invalid")
+			fmt.Printf("socket read: skipping message: %v\n", err)
+			continue
+		}
+		if err != nil {
+			if wire > 0 {
+				read("invalid")
+			}
+			if !errors.Is(err, io.EOF) {
+				readErr = err
+			}
+			break
+		}
+		if len(frame.Body) == 0 {
+			read("keepalive")
+			continue
+		}
+		msg, err := decodeMessage(codec, frame.Body)
+		if err != nil {
+			read("invalid")
+			fmt.Printf("socket decode error: %v\n", err)
+			continue
+		}
+		msg.Binary = frame.Data
+		if msg.ID != "" {
+			if action, ok := c.actions.LoadAndDelete(msg.ID); ok {
+				read(action.(string))
+			} else {
+				read("response")
+			}
+			if switched := c.framingAnswered(msg, frames); switched != nil {
+				codec = switched
+			}
+			if _, part := c.partIDs.LoadAndDelete(msg.ID); part {
+				continue
+			}
+			if !c.pending.resolve(msg) {
+				c.registry().Add(MetricUnmatched, nil, 1)
+			}
+			continue
+		}
+		if msg.Type != "event" {
+			read("other")
+		} else {
+			read("event:" + msg.Event)
+			if c.checkSchema("event", msg.Event, msg, msg.Payload) != nil {
+				continue
+			}
+			c.negotiate(msg)
+		}
+		if msg.Type == "event" && c.eventHandler != nil {
+			// run handler asynchronously to avoid blocking reader
+			go c.eventHandler(msg)
+		}
+	}
+	if readErr != nil && !errors.Is(readErr, net.ErrClosed) {
+		fmt.Printf("socket read error: %v\n", readErr)
+	}
+	c.pending.closeAll()
+	close(c.closed)
+	if c.eventHandler != nil {
+		errMsg := "socket closed"
+		if readErr != nil {
+			errMsg = readErr.Error()
+		}
+		go c.eventHandler(Message{Type: "event", Event: "disconnect", Error: &protocol.Error{Message: errMsg}})
+	}
+}
+
+// PendingCount reports requests still waiting for a response.
+func (c *Client) PendingCount() int {
+	if c == nil {
+		return 0
+	}
+	return c.pending.len()
+}
+
+// Drain waits until no request is pending, the connection closes or ctx
+// ends, and returns how many requests were still outstanding.
+func (c *Client) Drain(ctx context.Context) int {
+	if c == nil {
+		return 0
+	}
+	tick := time.NewTicker(50 * time.Millisecond)
+	defer tick.Stop()
+	for {
+		n := c.PendingCount()
+		if n == 0 {
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			return n
+		case <-c.closed:
+			return 0
+		case <-tick.C:
+		}
+	}
+}
+
+// Request is RequestCtx without a caller context.
+func (c *Client) Request(action string, payload map[string]any) (*Message, error) {
+	return c.RequestCtx(context.Background(), action, payload)
+}
+
+// RequestCtx sends a request and waits for its response until ctx is done.
+// Without a deadline on ctx the per-action timeout applies to each
+// attempt, including any wait for an in-flight slot. Cancelling ctx drops
+// the pending entry, so a late response is discarded. Timed-out requests are re-sent under the retry policy when
+// that is safe; see SetRetry.
+func (c *Client) RequestCtx(ctx context.Context, action string, payload map[string]any) (*Message, error) {
+	if c == nil {
+		return nil, ErrNotConnected
+	}
+	if err := c.permit(action); err != nil {
+		return nil, err
+	}
+	payload = withIdempotencyKey(ctx, action, payload)
+	return c.sendWithRetry(ctx, action, func() (*Message, error) {
+		return c.request(ctx, c.nextID(), action, payload, nil)
+	})
+}
+
+// request is one attempt of RequestCtx. after, when set, runs on the write
+// loop right after the request is on the wire, before anything else is
+// written.
+func (c *Client) request(ctx context.Context, id, action string, payload map[string]any, after func()) (_ *Message, err error) {
+	started := time.Now()
+	defer func() {
+		c.actions.Delete(id)
+		c.recordRequest(action, started, err)
+		if c.Observe != nil {
+			c.Observe(ctx, action, started, err)
+		}
+	}()
+	if _, ok := ctx.Deadline(); !ok {
+		d := DefaultTimeout
+		if c.Timeout != nil {
+			d = c.Timeout(action)
+		}
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	ch, err := c.pending.add(ctx, id)
+	if err != nil {
+		return nil, ctxError(err)
+	}
+	if err = c.write(ctx, id, action, payload, after); err != nil {
+		c.pending.remove(id)
+		return nil, ctxError(err)
+	}
+	select {
+	case resp, ok := <-ch:
+		return response(action, resp, ok)
+	case <-ctx.Done():
+		if !c.pending.remove(id) {
+			// the response won the race against the deadline
+			resp, ok := <-ch
+			return response(action, resp, ok)
+		}
+		return nil, ctxError(ctx.Err())
+	case <-c.closed:
+		return nil, ErrClosed
+	}
+}
+
+// response turns what arrived on a pending channel into request's result.
+func response(action string, resp Message, ok bool) (*Message, error) {
+	if !ok {
+		return nil, ErrClosed
+	}
+	if resp.OK != nil && !*resp.OK {
+		hubErr := resp.Error
+		if hubErr == nil {
+			hubErr = &protocol.Error{}
+		}
+		return nil, &HubError{Action: action, Err: hubErr}
+	}
+	return &resp, nil
+}
+
+// ctxError maps an expired deadline onto ErrTimeout so callers keep
+// treating it as a connection problem; cancellation is passed through.
+func ctxError(err error) error {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return err
+}
+
+// Send writes a request without waiting for its response; whatever the hub
+// answers is dropped since no one is pending on the id.
+func (c *Client) Send(action string, payload map[string]any) error {
+	if c == nil {
+		return ErrNotConnected
+	}
+	return c.write(context.Background(), c.nextID(), action, payload, nil)
+}
+
+// Call sends action and decodes the response data into out, which may be
+// nil when the caller only cares about success.
+func (c *Client) Call(ctx context.Context, action string, payload map[string]any, out any) error {
+	resp, err := c.RequestCtx(ctx, action, payload)
+	if err != nil {
+		return err
+	}
+	if err := c.checkSchema("response", action, *resp, resp.Data); err != nil {
+		return err
+	}
+	if out != nil && len(resp.Data) > 0 {
+		if err := resp.DecodeData(out); err != nil {
+			return fmt.Errorf("%s: decode response: %w", action, err)
+		}
+	}
+	return nil
+}
+
+func encodeRequest(codec protocol.Codec, id, action string, payload map[string]any) ([]byte, error) {
+	req := make(map[string]any, len(payload)+2)
+	for k, v := range payload {
+		req[k] = v
+	}
+	req["id"] = id
+	req["type"] = action
+	return codec.Marshal(req)
+}
+
+func (c *Client) nextID() string {
+	value := atomic.AddUint64(&c.requestID, 1)
+	return fmt.Sprintf("req-%d", value)
+}
@@ -0,0 +1,118 @@
+package hubclient
+
+import (
+	"encoding/json"
+
+	"brain/internal/protocol"
+)
+
+// codedMessage is Message as a non-JSON codec carries it, with data and
+// payload left encoded until someone asks for them.
+type codedMessage struct {
+	ID      string          `json:"id,omitempty"`
+	Type    string          `json:"type"`
+	OK      *bool           `json:"ok,omitempty"`
+	Error   *protocol.Error `json:"error,omitempty"`
+	Data    protocol.Raw    `json:"data,omitempty"`
+	Event   string          `json:"event,omitempty"`
+	Payload protocol.Raw    `json:"payload,omitempty"`
+}
+
+func decodeMessage(codec protocol.Codec, body []byte) (Message, error) {
+	if codec.Name() == protocol.CodecJSON {
+		if isJSONRPC(body) {
+			return decodeJSONRPC(body)
+		}
+		var msg Message
+		err := json.Unmarshal(body, &msg)
+		return msg, err
+	}
+	var m codedMessage
+	if err := codec.Unmarshal(body, &m); err != nil {
+		return Message{}, err
+	}
+	return Message{
+		ID: m.ID, Type: m.Type, OK: m.OK, Error: m.Error,
+		Data: json.RawMessage(m.Data), Event: m.Event, Payload: json.RawMessage(m.Payload),
+		codec: codec,
+	}, nil
+}
+
+// DecodeData decodes a response's data into v.
+func (m Message) DecodeData(v any) error {
+	return m.decode(m.Data, v)
+}
+
+// DecodePayload decodes an event's payload into v.
+func (m Message) DecodePayload(v any) error {
+	return m.decode(m.Payload, v)
+}
+
+// JSONPayload returns the event payload as JSON, re-encoding it when it
+// arrived in another codec. It is nil when the payload is empty or cannot
+// be converted.
+func (m Message) JSONPayload() json.RawMessage {
+	if m.codec == nil || m.codec.Name() == protocol.CodecJSON || len(m.Payload) == 0 {
+		return m.Payload
+	}
+	var v any
+	if m.codec.Unmarshal(m.Payload, &v) != nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+func (m Message) decode(data []byte, v any) error {
+	if m.codec == nil {
+		return json.Unmarshal(data, v)
+	}
+	return m.codec.Unmarshal(data, v)
+}
+
+// Codec names the codec in use on the connection.
+func (c *Client) Codec() string {
+	if c == nil {
+		return protocol.CodecJSON
+	}
+	if name, ok := c.codecName.Load().(string); ok {
+		return name
+	}
+	return protocol.CodecJSON
+}
+
+// encodeFrame encodes and frames a request the way the write side speaks
+// right now. Only the write loop calls it, so a framing switch can never
+// land between encoding a request and writing it.
+func (c *Client) encodeFrame(id, action string, payload map[string]any) ([]byte, error) {
+	frame := protocol.AppendLine
+	if c.framedWrites {
+		frame = protocol.AppendFrame
+	}
+	if c.JSONRPC() {
+		encoded, err := json.Marshal(rpcRequest{JSONRPC: "2.0", ID: id, Method: action, Params: payload})
+		if err != nil {
+			return nil, err
+		}
+		return frame(nil, encoded), nil
+	}
+	codec := c.writeCodec
+	if codec == nil {
+		codec = protocol.JSON
+	}
+	var raw []byte
+	if c.framedWrites {
+		payload, raw = c.splitBinary(payload)
+	}
+	encoded, err := encodeRequest(codec, id, action, payload)
+	if err != nil {
+		return nil, err
+	}
+	if raw != nil {
+		return protocol.AppendBinaryFrame(nil, encoded, raw), nil
+	}
+	return frame(nil, encoded), nil
+}
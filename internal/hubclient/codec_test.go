@@ -0,0 +1,54 @@
+package hubclient
+
+import (
+	"encoding/json"
+	"testing"
+
+	"brain/internal/protocol"
+)
+
+// FuzzDecodeMessage feeds arbitrary frames through the message decoder and
+// the accessors handlers call on the result; hostile hub data must come
+// back as an error, never a panic.
+func FuzzDecodeMessage(f *testing.F) {
+	for _, seed := range []string{
+		`{"id":"1","type":"response","ok":true,"data":{"files":["a.mp3"]}}`,
+		`{"type":"event","event":"status","payload":{"host":"pi","peers":[]}}`,
+		`{"id":"2","type":"response","ok":false,"error":{"code":"not_found","message":"gone"}}`,
+		`{"jsonrpc":"2.0","id":"3","result":{"ok":true}}`,
+		`{"jsonrpc":"2.0","id":4,"error":{"code":-32601,"message":"no","data":{"code":"invalid"}}}`,
+		`{"jsonrpc":"2.0","method":"status","params":[1,2]}`,
+		`{"jsonrpc":"2.0","error":{"code":-32700,"message":"parse"}}`,
+		`{"jsonrpc":"1.0"}`,
+		`[]`, `null`, `{"id":{}}`,
+	} {
+		f.Add([]byte(seed))
+	}
+	for _, v := range []any{
+		map[string]any{"id": "1", "type": "response", "ok": true, "data": map[string]any{"files": []any{"a.mp3", 1.5}}},
+		map[string]any{"type": "event", "event": "status", "payload": map[string]any{"bytes": []byte{0, 1, 2}}},
+	} {
+		encoded, err := protocol.MarshalCBOR(v)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(encoded)
+	}
+	f.Fuzz(func(t *testing.T, body []byte) {
+		for _, codec := range []protocol.Codec{protocol.JSON, protocol.CBOR} {
+			msg, err := decodeMessage(codec, body)
+			if err != nil {
+				continue
+			}
+			var v any
+			_ = msg.DecodeData(&v)
+			_ = msg.DecodePayload(&v)
+			if payload := msg.JSONPayload(); payload != nil && !json.Valid(payload) {
+				t.Fatalf("%s: JSONPayload returned invalid JSON %q", codec.Name(), payload)
+			}
+			if msg.Error != nil {
+				_ = msg.Error.Error()
+			}
+		}
+	})
+}
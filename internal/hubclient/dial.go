@@ -0,0 +1,125 @@
+package hubclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// attemptDelay staggers connection attempts to successive addresses of
+	// a host, as in RFC 8305.
+	attemptDelay = 250 * time.Millisecond
+	// attemptTimeout bounds the attempt to a single address.
+	attemptTimeout = 5 * time.Second
+)
+
+// dialHappy resolves every A and AAAA record of address and races
+// connections to them, returning the first that succeeds.
+func dialHappy(ctx context.Context, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range addrs {
+			ips = append(ips, a.IP)
+		}
+	}
+	return raceDial(ctx, interleave(ips), port)
+}
+
+// interleave alternates address families, IPv6 first, so a broken family
+// costs one attemptDelay rather than one timeout per address.
+func interleave(ips []net.IP) []net.IP {
+	var v6, v4 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	out := make([]net.IP, 0, len(ips))
+	for len(v6) > 0 || len(v4) > 0 {
+		if len(v6) > 0 {
+			out, v6 = append(out, v6[0]), v6[1:]
+		}
+		if len(v4) > 0 {
+			out, v4 = append(out, v4[0]), v4[1:]
+		}
+	}
+	return out
+}
+
+// raceDial starts an attempt to the next address every attemptDelay, or
+// as soon as the previous one fails, and keeps the first connection.
+func raceDial(ctx context.Context, ips []net.IP, port string) (net.Conn, error) {
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no addresses to dial")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result)
+	next, running := 0, 0
+	start := func() {
+		addr := net.JoinHostPort(ips[next].String(), port)
+		next++
+		running++
+		go func() {
+			attemptCtx, attemptCancel := context.WithTimeout(ctx, attemptTimeout)
+			defer attemptCancel()
+			conn, err := (&net.Dialer{}).DialContext(attemptCtx, "tcp", addr)
+			select {
+			case results <- result{conn, err}:
+			case <-ctx.Done():
+				if conn != nil {
+					conn.Close()
+				}
+			}
+		}()
+	}
+	start()
+	timer := time.NewTimer(attemptDelay)
+	defer timer.Stop()
+	var firstErr error
+	for running > 0 {
+		select {
+		case <-timer.C:
+			if next < len(ips) {
+				start()
+				timer.Reset(attemptDelay)
+			}
+		case r := <-results:
+			running--
+			if r.err == nil {
+				return r.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if next < len(ips) {
+				start()
+				timer.Reset(attemptDelay)
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if len(ips) > 1 {
+		return nil, fmt.Errorf("none of %d addresses answered: %w", len(ips), firstErr)
+	}
+	return nil, firstErr
+}
@@ -0,0 +1,63 @@
+package hubclient
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+)
+
+func TestInterleave(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.3"),
+		net.ParseIP("fd00::1"), net.ParseIP("fd00::2"),
+	}
+	var got []string
+	for _, ip := range interleave(ips) {
+		got = append(got, ip.String())
+	}
+	want := []string{"fd00::1", "10.0.0.1", "fd00::2", "10.0.0.2", "10.0.0.3"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("interleave = %v, want %v", got, want)
+	}
+}
+
+// TestRaceDialFallsThrough dials a refused address first; the race must
+// move on to the next one rather than fail.
+func TestRaceDialFallsThrough(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	conn, err := raceDial(context.Background(), []net.IP{net.ParseIP("127.0.0.2"), net.ParseIP("127.0.0.1")}, port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if got := conn.RemoteAddr().String(); got != ln.Addr().String() {
+		t.Fatalf("connected to %s, want %s", got, ln.Addr())
+	}
+}
+
+func TestRaceDialAllFail(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	ln.Close()
+	if _, err := raceDial(context.Background(), []net.IP{net.ParseIP("127.0.0.2"), net.ParseIP("127.0.0.1")}, port); err == nil {
+		t.Fatal("want an error when no address answers")
+	}
+}
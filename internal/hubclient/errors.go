@@ -0,0 +1,40 @@
+package hubclient
+
+import (
+	"errors"
+
+	"brain/internal/protocol"
+)
+
+var (
+	ErrNotConnected     = errors.New("socket not connected")
+	ErrClosed           = errors.New("socket connection closed")
+	ErrTimeout          = errors.New("socket request timeout")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrUnsupported      = errors.New("not supported by this hub")
+	// ErrNotTemporary is a temporary upload the hub stored without saying
+	// when it goes.
+	ErrNotTemporary = errors.New("hub did not make the upload temporary")
+)
+
+// HubError is a request the hub answered with ok=false. It unwraps to the
+// protocol error, so errors.Is(err, protocol.ErrNotFound) works.
+type HubError struct {
+	Action string
+	Err    *protocol.Error
+}
+
+func (e *HubError) Error() string {
+	if e.Err.Message == "" && e.Err.Code == "" {
+		return e.Action + ": request failed"
+	}
+	return e.Err.Error()
+}
+
+func (e *HubError) Unwrap() error { return e.Err }
+
+// IsConnectionError reports whether err means the request never got an
+// answer, as opposed to the hub refusing it.
+func IsConnectionError(err error) bool {
+	return errors.Is(err, ErrNotConnected) || errors.Is(err, ErrClosed) || errors.Is(err, ErrTimeout)
+}
@@ -0,0 +1,259 @@
+package hubclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"brain/internal/metrics"
+)
+
+const (
+	bulkPieceMin = 1 << 10
+	bulkPieceMax = 64 << 10
+)
+
+// bulkMessageMax is the most file data one upload-chunk message carries
+// on the wire. A larger chunk goes out as several upload-chunk messages
+// at advancing offsets, and control requests queued meanwhile are written
+// between them instead of behind the whole chunk.
+const bulkMessageMax = 256 << 10
+
+// bulkActions carry file data. They are written behind every control
+// request and, when a limit is configured, paced to it.
+var bulkActions = map[string]bool{
+	"upload":       true,
+	"upload-chunk": true,
+}
+
+// rateLimiter is a token bucket over bytes with a one second burst. A zero
+// rate means unlimited.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   int64
+	tokens float64
+	last   time.Time
+}
+
+func (l *rateLimiter) setRate(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	l.rate = bytesPerSec
+	l.tokens = 0
+	l.last = time.Now()
+}
+
+func (l *rateLimiter) limit() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// reserve takes n bytes from the bucket and returns how long the caller
+// must wait before writing them.
+func (l *rateLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.rate <= 0 {
+		return 0
+	}
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+	if burst := float64(l.rate); l.tokens > burst {
+		l.tokens = burst
+	}
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+}
+
+// pieceSize is how much of a bulk message is written between limiter
+// checks: about a tenth of a second's worth.
+func (l *rateLimiter) pieceSize() int {
+	rate := l.limit()
+	if rate <= 0 {
+		return bulkPieceMax
+	}
+	size := int(rate / 10)
+	if size < bulkPieceMin {
+		size = bulkPieceMin
+	}
+	if size > bulkPieceMax {
+		size = bulkPieceMax
+	}
+	return size
+}
+
+type writeRequest struct {
+	ctx     context.Context
+	id      string
+	action  string
+	payload map[string]any
+	after   func()
+	done    chan error
+}
+
+// writeLoop owns the connection's write side. Control writes always go
+// first; bulk writes are split into messages, with queued control writes
+// let in between, and each message into pieces paced by the limiter.
+func (c *Client) writeLoop() {
+	for {
+		c.writeControl()
+		select {
+		case w := <-c.controlWrites:
+			w.done <- c.writeQueued(w, c.writeAll)
+		case w := <-c.bulkWrites:
+			w.done <- c.writeSplit(w)
+		case <-c.closed:
+			return
+		}
+	}
+}
+
+// writeControl writes every control request already queued.
+func (c *Client) writeControl() {
+	for {
+		select {
+		case w := <-c.controlWrites:
+			w.done <- c.writeQueued(w, c.writeAll)
+		default:
+			return
+		}
+	}
+}
+
+// writeSplit writes a bulk request as the messages splitChunk makes of it,
+// letting control writes in between. Only the last message carries w's id;
+// the hub's answers to the others are dropped by the read loop, and a
+// failed one shows in the offset the last is acknowledged at.
+func (c *Client) writeSplit(w writeRequest) error {
+	parts := splitChunk(w)
+	for i, part := range parts {
+		if i > 0 {
+			c.writeControl()
+		}
+		last := i == len(parts)-1
+		if !last {
+			c.partIDs.Store(part.id, true)
+		}
+		if err := c.writeQueued(part, c.writeBulk); err != nil {
+			c.partIDs.Delete(part.id)
+			return err
+		}
+	}
+	return nil
+}
+
+// splitChunk cuts an upload-chunk carrying more than bulkMessageMax bytes
+// into upload-chunks of at most that, at advancing offsets. Other
+// requests are returned whole.
+func splitChunk(w writeRequest) []writeRequest {
+	data, ok := w.payload["base64"].(rawBytes)
+	offset, hasOffset := w.payload["offset"].(int64)
+	if w.action != "upload-chunk" || !ok || !hasOffset || len(data) <= bulkMessageMax {
+		return []writeRequest{w}
+	}
+	var parts []writeRequest
+	for start := 0; start < len(data); start += bulkMessageMax {
+		end := min(start+bulkMessageMax, len(data))
+		part := w
+		part.payload = make(map[string]any, len(w.payload))
+		for k, v := range w.payload {
+			part.payload[k] = v
+		}
+		part.payload["offset"] = offset + int64(start)
+		part.payload["base64"] = data[start:end]
+		if end < len(data) {
+			part.id = fmt.Sprintf("%s.%d", w.id, len(parts)+1)
+			part.after = nil
+		}
+		parts = append(parts, part)
+	}
+	return parts
+}
+
+// writeQueued skips requests whose context ended while they waited; once a
+// message is started it is always finished so the stream stays framed.
+func (c *Client) writeQueued(w writeRequest, write func(string, []byte) error) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	framed, err := c.encodeFrame(w.id, w.action, w.payload)
+	if err != nil {
+		return err
+	}
+	c.actions.Store(w.id, w.action)
+	err = write(w.action, framed)
+	if err == nil && w.after != nil {
+		w.after()
+	}
+	return err
+}
+
+func (c *Client) writeAll(action string, data []byte) error {
+	n, err := c.conn.Write(data)
+	c.registry().Add(MetricBytesWritten, metrics.Labels{"action": action}, float64(n))
+	return err
+}
+
+func (c *Client) writeBulk(action string, data []byte) error {
+	for len(data) > 0 {
+		n := c.limiter.pieceSize()
+		if n > len(data) {
+			n = len(data)
+		}
+		if wait := c.limiter.reserve(n); wait > 0 {
+			select {
+			case <-time.After(wait):
+			case <-c.closed:
+				return ErrClosed
+			}
+		}
+		if err := c.writeAll(action, data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+	}
+	return nil
+}
+
+// write queues a request behind earlier writes of the same priority and
+// waits until it is on the wire or dropped because ctx ended first. The
+// write loop encodes it.
+func (c *Client) write(ctx context.Context, id, action string, payload map[string]any, after func()) error {
+	queue := c.controlWrites
+	if bulkActions[action] {
+		queue = c.bulkWrites
+	}
+	w := writeRequest{ctx: ctx, id: id, action: action, payload: payload, after: after, done: make(chan error, 1)}
+	select {
+	case queue <- w:
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.closed:
+		return ErrClosed
+	}
+	select {
+	case err := <-w.done:
+		if err == nil && c.Sent != nil {
+			c.Sent(id, action, payload)
+		}
+		return err
+	case <-c.closed:
+		return ErrClosed
+	}
+}
+
+// SetRateLimit caps bulk writes at bytesPerSec; zero removes the cap.
+func (c *Client) SetRateLimit(bytesPerSec int64) {
+	if c != nil {
+		c.limiter.setRate(bytesPerSec)
+	}
+}
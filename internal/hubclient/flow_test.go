@@ -0,0 +1,101 @@
+package hubclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"brain/internal/protocol"
+)
+
+// TestSplitChunk checks that a large upload-chunk goes out as several
+// messages at advancing offsets, that a control request made meanwhile is
+// written between them, and that the caller gets the last one's answer.
+func TestSplitChunk(t *testing.T) {
+	hubConn, clientConn := net.Pipe()
+	c := newClient(clientConn, nil)
+	defer c.Close()
+	c.SetRateLimit(2 << 20)
+
+	type seen struct {
+		action string
+		offset int64
+	}
+	got := make(chan seen, 16)
+	firstPart := make(chan struct{})
+	go func() {
+		scanner := bufio.NewScanner(hubConn)
+		scanner.Buffer(make([]byte, 64<<10), protocol.MaxFrameSize)
+		for scanner.Scan() {
+			var req struct {
+				ID     string `json:"id"`
+				Type   string `json:"type"`
+				Offset int64  `json:"offset"`
+				Base64 string `json:"base64"`
+			}
+			if err := json.Unmarshal(scanner.Bytes(), &req); err != nil {
+				return
+			}
+			got <- seen{req.Type, req.Offset}
+			data := map[string]any{}
+			if req.Type == "upload-chunk" {
+				if req.Offset == 0 {
+					close(firstPart)
+				}
+				n, _ := base64.StdEncoding.DecodeString(req.Base64)
+				data = map[string]any{"uploadId": "u1", "offset": req.Offset + int64(len(n))}
+			}
+			line, _ := json.Marshal(map[string]any{"id": req.ID, "type": req.Type, "ok": true, "data": data})
+			hubConn.Write(append(line, '\n'))
+		}
+	}()
+
+	size := 4 * bulkMessageMax
+	done := make(chan error, 1)
+	var ack UploadProgress
+	go func() {
+		done <- c.Call(context.Background(), "upload-chunk", map[string]any{
+			"uploadId": "u1", "offset": int64(0), "base64": rawBytes(make([]byte, size)),
+		}, &ack)
+	}()
+	<-firstPart
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := c.Call(ctx, "echo", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if ack.Offset != int64(size) {
+		t.Errorf("acknowledged offset %d, want %d", ack.Offset, size)
+	}
+	var order []seen
+	for len(order) < 5 {
+		order = append(order, <-got)
+	}
+	var parts []int64
+	echoAt := -1
+	for i, s := range order {
+		if s.action == "echo" {
+			echoAt = i
+			continue
+		}
+		parts = append(parts, s.offset)
+	}
+	for i, offset := range parts {
+		if offset != int64(i*bulkMessageMax) {
+			t.Errorf("part %d at offset %d, want %d", i, offset, i*bulkMessageMax)
+		}
+	}
+	if echoAt < 1 || echoAt == len(order)-1 {
+		t.Errorf("echo written at %d of %v, want between the parts", echoAt, order)
+	}
+	if n := c.PendingCount(); n != 0 {
+		t.Errorf("%d requests still pending", n)
+	}
+}
@@ -0,0 +1,101 @@
+package hubclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"brain/internal/protocol"
+)
+
+// framingWait bounds how long writes are held while the hub answers a
+// framing request. A hub that stays silent leaves the stream's framing
+// unknown, so the connection is closed.
+const framingWait = 5 * time.Second
+
+// framingSwitch is an outstanding framing request. Once it is written the
+// write loop holds every other write until the read loop has seen the
+// answer, so no message is framed the way the hub no longer expects.
+type framingSwitch struct {
+	id     string
+	codec  protocol.Codec
+	result chan bool
+	framed atomic.Bool
+}
+
+// UseLengthPrefixed switches the connection from newline to length-prefixed
+// framing, lifting the line-length cap and keeping one malformed message
+// from desynchronising the rest. codec, when not "" or "json", moves both
+// directions to that codec in the same step. It fails with ErrUnsupported
+// unless the hub's hello listed protocol.FramingLengthPrefixed and the
+// codec.
+func (c *Client) UseLengthPrefixed(ctx context.Context, codec string) error {
+	if c == nil {
+		return ErrNotConnected
+	}
+	hello := c.Hello()
+	if hello == nil || !hello.Speaks(protocol.FramingLengthPrefixed) {
+		return fmt.Errorf("length-prefixed framing: %w", ErrUnsupported)
+	}
+	cd, known := protocol.CodecByName(codec)
+	if !known || !hello.HasCodec(codec) || (c.JSONRPC() && cd != protocol.JSON) {
+		return fmt.Errorf("codec %s: %w", codec, ErrUnsupported)
+	}
+	if c.LengthPrefixed() {
+		return nil
+	}
+	sw := &framingSwitch{id: c.nextID(), codec: cd, result: make(chan bool, 1)}
+	if !c.switching.CompareAndSwap(nil, sw) {
+		return errors.New("framing switch already in progress")
+	}
+	defer c.switching.Store(nil)
+	payload := map[string]any{"mode": protocol.FramingLengthPrefixed}
+	if cd != protocol.JSON {
+		payload["codec"] = cd.Name()
+	}
+	_, err := c.request(ctx, sw.id, "framing", payload, func() {
+		select {
+		case ok := <-sw.result:
+			if ok {
+				c.framedWrites = true
+				c.writeCodec = sw.codec
+			}
+			sw.framed.Store(ok)
+		case <-c.closed:
+		case <-time.After(framingWait):
+			_ = c.conn.Close()
+		}
+	})
+	if err == nil && !sw.framed.Load() {
+		err = errors.New("length-prefixed framing: hub did not switch")
+	}
+	return err
+}
+
+// framingAnswered switches the read side when msg answers the outstanding
+// framing request, and releases the write loop. The hub sends that answer
+// in the old framing and codec and everything after it in the new ones.
+// It returns the codec to read with from now on, or nil for no change.
+func (c *Client) framingAnswered(msg Message, frames *protocol.FrameReader) protocol.Codec {
+	sw := c.switching.Load()
+	if sw == nil || sw.id != msg.ID {
+		return nil
+	}
+	if msg.OK == nil || !*msg.OK {
+		sw.result <- false
+		return nil
+	}
+	frames.SetLengthPrefixed()
+	c.lengthPrefixed.Store(true)
+	c.codecName.Store(sw.codec.Name())
+	sw.result <- true
+	return sw.codec
+}
+
+// LengthPrefixed reports whether the connection uses length-prefixed
+// frames.
+func (c *Client) LengthPrefixed() bool {
+	return c != nil && c.lengthPrefixed.Load()
+}
@@ -0,0 +1,92 @@
+package hubclient
+
+import (
+	"context"
+	"fmt"
+
+	"brain/internal/protocol"
+)
+
+// negotiate records the hello event before it is handed on.
+func (c *Client) negotiate(msg Message) {
+	if msg.Event != protocol.EventHello {
+		return
+	}
+	var hello protocol.Hello
+	if msg.DecodePayload(&hello) != nil {
+		return
+	}
+	c.hello.Store(&hello)
+	c.helloOnce.Do(func() { close(c.helloReady) })
+	if hello.Speaks(ProtocolJSONRPC) {
+		c.rpcOffered.Store(true)
+	}
+}
+
+// Hello returns the hub's hello, or nil before it has arrived.
+func (c *Client) Hello() *protocol.Hello {
+	if c == nil {
+		return nil
+	}
+	return c.hello.Load()
+}
+
+// WaitHello blocks until the hello arrives, ctx ends or the connection
+// closes, and returns the hello if there is one.
+func (c *Client) WaitHello(ctx context.Context) *protocol.Hello {
+	if c == nil {
+		return nil
+	}
+	select {
+	case <-c.helloReady:
+	case <-ctx.Done():
+	case <-c.closed:
+	}
+	return c.hello.Load()
+}
+
+// Supports reports whether the hub advertised capability. Before the hello
+// arrives the answer is optimistically true and the request decides.
+func (c *Client) Supports(capability string) bool {
+	if c == nil {
+		return false
+	}
+	hello := c.hello.Load()
+	return hello == nil || hello.Has(capability)
+}
+
+// Role is the role the hub gave this client, RoleAdmin before the hello
+// or from hubs without roles.
+func (c *Client) Role() protocol.Role {
+	if c == nil {
+		return protocol.RoleAdmin
+	}
+	if hello := c.hello.Load(); hello != nil && hello.Role != "" {
+		return hello.Role
+	}
+	return protocol.RoleAdmin
+}
+
+// Allows reports whether the client's role lets it send action.
+func (c *Client) Allows(action string) bool {
+	return c.Role().Allows(action)
+}
+
+// permit fails action up front when the role forbids it, with the same
+// error the hub would send.
+func (c *Client) permit(action string) error {
+	role := c.Role()
+	if role.Allows(action) {
+		return nil
+	}
+	return &protocol.Error{Code: protocol.CodeForbidden, Message: fmt.Sprintf("%s needs more than the %s role", action, role)}
+}
+
+// require fails action up front when the hub lacks capability. A nil
+// client passes so the request reports ErrNotConnected instead.
+func (c *Client) require(capability, action string) error {
+	if c == nil || c.Supports(capability) {
+		return nil
+	}
+	return fmt.Errorf("%s: %w (needs %s)", action, ErrUnsupported, capability)
+}
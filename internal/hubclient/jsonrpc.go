@@ -0,0 +1,120 @@
+package hubclient
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"brain/internal/protocol"
+)
+
+// ProtocolJSONRPC is the name a hub lists in its hello "protocols" when it
+// accepts JSON-RPC 2.0 framing on the socket.
+const ProtocolJSONRPC = "jsonrpc-2.0"
+
+// JSON-RPC 2.0 reserved error codes.
+const (
+	rpcParseError     = -32700
+	rpcInvalidRequest = -32600
+	rpcMethodNotFound = -32601
+	rpcInvalidParams  = -32602
+	rpcInternalError  = -32603
+)
+
+type rpcRequest struct {
+	JSONRPC string         `json:"jsonrpc"`
+	ID      string         `json:"id,omitempty"`
+	Method  string         `json:"method"`
+	Params  map[string]any `json:"params,omitempty"`
+}
+
+// rpcMessage is any inbound JSON-RPC line: a response (ID set) or a
+// notification (Method set, no ID), which the hub uses for events.
+type rpcMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// rpcError carries the hub's native error envelope in Data when it has
+// one, so codes like busy survive the translation.
+type rpcError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// PreferJSONRPC switches the client to JSON-RPC framing when the hub's
+// hello advertises it, whether the hello arrived before or after this
+// call. Until then, and with hubs that never do, requests use the native
+// format.
+func (c *Client) PreferJSONRPC(on bool) {
+	if c != nil {
+		c.preferRPC.Store(on)
+	}
+}
+
+// JSONRPC reports whether requests are currently framed as JSON-RPC.
+func (c *Client) JSONRPC() bool {
+	return c != nil && c.preferRPC.Load() && c.rpcOffered.Load()
+}
+
+// isJSONRPC is a cheap check that avoids decoding every native line twice.
+func isJSONRPC(line []byte) bool {
+	return bytes.Contains(line, []byte(`"jsonrpc"`))
+}
+
+// decodeJSONRPC maps a JSON-RPC line onto the native Message shape.
+func decodeJSONRPC(line []byte) (Message, error) {
+	var m rpcMessage
+	if err := json.Unmarshal(line, &m); err != nil {
+		return Message{}, err
+	}
+	if m.JSONRPC != "2.0" {
+		return Message{}, fmt.Errorf("unsupported jsonrpc version %q", m.JSONRPC)
+	}
+	if len(m.ID) == 0 || string(m.ID) == "null" {
+		if m.Method == "" {
+			if m.Error != nil {
+				return Message{Type: "event", Event: protocol.EventError, Error: m.Error.native()}, nil
+			}
+			return Message{}, fmt.Errorf("jsonrpc message without id or method")
+		}
+		return Message{Type: "event", Event: m.Method, Payload: m.Params}, nil
+	}
+	var id string
+	if err := json.Unmarshal(m.ID, &id); err != nil {
+		// numeric ids were not sent by this client, but keep them matchable
+		id = strings.TrimSpace(string(m.ID))
+	}
+	ok := m.Error == nil
+	msg := Message{ID: id, Type: "response", OK: &ok, Data: m.Result}
+	if m.Error != nil {
+		msg.Error = m.Error.native()
+	}
+	return msg, nil
+}
+
+func (e *rpcError) native() *protocol.Error {
+	if len(e.Data) > 0 {
+		var inner protocol.Error
+		if json.Unmarshal(e.Data, &inner) == nil && inner.Code != "" {
+			if inner.Message == "" {
+				inner.Message = e.Message
+			}
+			return &inner
+		}
+	}
+	out := &protocol.Error{Message: e.Message}
+	switch e.Code {
+	case rpcParseError, rpcInvalidRequest, rpcMethodNotFound, rpcInvalidParams:
+		out.Code = protocol.CodeInvalid
+	case rpcInternalError:
+		out.Code = protocol.CodeInternal
+	}
+	return out
+}
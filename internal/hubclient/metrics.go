@@ -0,0 +1,67 @@
+package hubclient
+
+import (
+	"errors"
+	"time"
+
+	"brain/internal/metrics"
+)
+
+// Metric names recorded when a registry is installed with SetMetrics.
+const (
+	MetricRequests         = "brain_client_requests_total"
+	MetricRequestTime      = "brain_client_request_seconds"
+	MetricBytesWritten     = "brain_client_socket_written_bytes_total"
+	MetricBytesRead        = "brain_client_socket_read_bytes_total"
+	MetricRetries          = "brain_client_retries_total"
+	MetricUnmatched        = "brain_client_unmatched_responses_total"
+	MetricSchemaViolations = "brain_client_schema_violations_total"
+)
+
+// DescribeMetrics registers help text for the metrics the client records.
+func DescribeMetrics(r *metrics.Registry) {
+	r.Describe(MetricRequests, metrics.KindCounter, "Socket requests by action and outcome.")
+	r.Describe(MetricRequestTime, metrics.KindHistogram, "Socket request round-trip time by action.")
+	r.Describe(MetricBytesWritten, metrics.KindCounter, "Bytes written to the hub socket, by request action.")
+	r.Describe(MetricBytesRead, metrics.KindCounter, "Bytes read from the hub socket, by request action or event.")
+	r.Describe(MetricRetries, metrics.KindCounter, "Requests re-sent after a timeout, by action.")
+	r.Describe(MetricUnmatched, metrics.KindCounter, "Responses nobody waited for: late after a timeout, or answers to Send.")
+	r.Describe(MetricSchemaViolations, metrics.KindCounter, "Hub messages that did not match their schema, by kind and name.")
+}
+
+// SetMetrics installs the registry the client records into. It may be
+// called while the connection is in use; nil turns recording off.
+func (c *Client) SetMetrics(r *metrics.Registry) {
+	if c == nil {
+		return
+	}
+	c.metrics.Store(r)
+}
+
+func (c *Client) registry() *metrics.Registry {
+	return c.metrics.Load()
+}
+
+func (c *Client) recordRequest(action string, started time.Time, err error) {
+	r := c.registry()
+	if r == nil {
+		return
+	}
+	r.Add(MetricRequests, metrics.Labels{"action": action, "outcome": outcome(err)}, 1)
+	r.Observe(MetricRequestTime, metrics.Labels{"action": action}, time.Since(started).Seconds())
+}
+
+func outcome(err error) string {
+	var hubErr *HubError
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.As(err, &hubErr):
+		return "hub-error"
+	case errors.Is(err, ErrTimeout):
+		return "timeout"
+	case IsConnectionError(err):
+		return "disconnected"
+	}
+	return "error"
+}
@@ -0,0 +1,133 @@
+package hubclient
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// DefaultMaxInFlight bounds how many requests wait for a response at once
+// until SetMaxInFlight installs another limit.
+const DefaultMaxInFlight = 64
+
+// pendingTable holds the requests waiting for a response. An entry leaves
+// the table exactly once, by resolve, remove or closeAll, and that is also
+// what frees its slot, so a request that times out can neither leak its
+// entry nor receive an answer meant for someone else. Request ids are never
+// reused on a connection, so a late response finds no entry and is dropped.
+type pendingTable struct {
+	mu     sync.Mutex
+	calls  map[string]chan Message
+	limit  int
+	freed  chan struct{} // closed and replaced whenever an entry leaves
+	closed bool
+}
+
+func newPendingTable(limit int) *pendingTable {
+	return &pendingTable{
+		calls: make(map[string]chan Message),
+		limit: limit,
+		freed: make(chan struct{}),
+	}
+}
+
+// add registers id, waiting for a free slot while the table is full.
+func (t *pendingTable) add(ctx context.Context, id string) (<-chan Message, error) {
+	for {
+		t.mu.Lock()
+		if t.closed {
+			t.mu.Unlock()
+			return nil, ErrClosed
+		}
+		if _, dup := t.calls[id]; dup {
+			t.mu.Unlock()
+			return nil, fmt.Errorf("request id %q already pending", id)
+		}
+		if t.limit <= 0 || len(t.calls) < t.limit {
+			ch := make(chan Message, 1)
+			t.calls[id] = ch
+			t.mu.Unlock()
+			return ch, nil
+		}
+		freed := t.freed
+		t.mu.Unlock()
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// resolve hands msg to the request waiting on its id. It reports false for
+// an id nobody waits on any more, such as a response arriving after its
+// request timed out.
+func (t *pendingTable) resolve(msg Message) bool {
+	t.mu.Lock()
+	ch, ok := t.calls[msg.ID]
+	if ok {
+		t.release(msg.ID)
+	}
+	t.mu.Unlock()
+	if ok {
+		ch <- msg
+		close(ch)
+	}
+	return ok
+}
+
+// remove gives up on id. It reports false when the entry already left,
+// in which case the response, or the close, is waiting on the channel.
+func (t *pendingTable) remove(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.calls[id]; !ok {
+		return false
+	}
+	t.release(id)
+	return true
+}
+
+// closeAll fails every waiting request and refuses new ones; a closed
+// channel without a message means the connection went away.
+func (t *pendingTable) closeAll() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id, ch := range t.calls {
+		delete(t.calls, id)
+		close(ch)
+	}
+	t.closed = true
+	close(t.freed)
+	t.freed = make(chan struct{})
+}
+
+// release must be called with mu held.
+func (t *pendingTable) release(id string) {
+	delete(t.calls, id)
+	close(t.freed)
+	t.freed = make(chan struct{})
+}
+
+func (t *pendingTable) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.calls)
+}
+
+func (t *pendingTable) setLimit(n int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.limit = n
+	close(t.freed)
+	t.freed = make(chan struct{})
+}
+
+// SetMaxInFlight caps how many requests may await a response at once;
+// further requests wait for a slot, bounded by their context. Zero or less
+// removes the cap.
+func (c *Client) SetMaxInFlight(n int) {
+	if c != nil {
+		c.pending.setLimit(n)
+	}
+}
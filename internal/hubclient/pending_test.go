@@ -0,0 +1,149 @@
+package hubclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestPendingResolveRemoveRace has a response and a timeout race for the
+// same entry: exactly one must win and the entry must be gone either way.
+func TestPendingResolveRemoveRace(t *testing.T) {
+	table := newPendingTable(1)
+	for i := 0; i < 2000; i++ {
+		id := fmt.Sprintf("req-%d", i)
+		ch, err := table.add(context.Background(), id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var resolved, removed bool
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			resolved = table.resolve(Message{ID: id, Type: "status"})
+		}()
+		go func() {
+			defer wg.Done()
+			removed = table.remove(id)
+		}()
+		wg.Wait()
+		if resolved == removed {
+			t.Fatalf("%s: resolved=%v removed=%v, want exactly one", id, resolved, removed)
+		}
+		if resolved {
+			if msg, ok := <-ch; !ok || msg.ID != id {
+				t.Fatalf("%s: got %+v, %v", id, msg, ok)
+			}
+		}
+		if n := table.len(); n != 0 {
+			t.Fatalf("%s: %d entries left", id, n)
+		}
+	}
+}
+
+// fakeHub answers every request on conn with its own id and n after a
+// random delay of up to maxDelay, or never when maxDelay is negative.
+func fakeHub(conn net.Conn, maxDelay time.Duration) {
+	var mu sync.Mutex
+	scanner := bufio.NewScanner(conn)
+	for scanner.Scan() {
+		var req struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+			N    int    `json:"n"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &req) != nil || maxDelay < 0 {
+			continue
+		}
+		go func() {
+			time.Sleep(time.Duration(rand.Int63n(int64(maxDelay) + 1)))
+			line, _ := json.Marshal(map[string]any{"id": req.ID, "type": req.Type, "ok": true, "data": map[string]int{"n": req.N}})
+			mu.Lock()
+			defer mu.Unlock()
+			_, _ = conn.Write(append(line, '\n'))
+		}()
+	}
+}
+
+// TestRequestTimeoutVersusLateResponse sends requests whose responses land
+// around their deadline. Each must end with its own answer or a timeout,
+// never another request's answer, and nothing may stay pending.
+func TestRequestTimeoutVersusLateResponse(t *testing.T) {
+	hubConn, clientConn := net.Pipe()
+	go fakeHub(hubConn, 4*time.Millisecond)
+	c := newClient(clientConn, nil)
+	c.SetRetry(RetryPolicy{Attempts: 1})
+	defer c.Close()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	answered, timedOut := 0, 0
+	for n := 0; n < 500; n++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Millisecond)
+			defer cancel()
+			var out struct{ N int }
+			err := c.Call(ctx, "echo", map[string]any{"n": n}, &out)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, ErrTimeout):
+				timedOut++
+			case err != nil:
+				t.Errorf("request %d: %v", n, err)
+			case out.N != n:
+				t.Errorf("request %d got the answer to %d", n, out.N)
+			default:
+				answered++
+			}
+		}(n)
+	}
+	wg.Wait()
+	if n := c.PendingCount(); n != 0 {
+		t.Fatalf("%d requests still pending", n)
+	}
+	t.Logf("%d answered, %d timed out", answered, timedOut)
+}
+
+// TestMaxInFlight checks that requests beyond the limit wait for a slot
+// and that closing the connection releases every one of them.
+func TestMaxInFlight(t *testing.T) {
+	hubConn, clientConn := net.Pipe()
+	go fakeHub(hubConn, -1)
+	c := newClient(clientConn, nil)
+	c.SetMaxInFlight(3)
+
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		go func() {
+			errs <- c.Call(context.Background(), "echo", nil, nil)
+		}()
+	}
+	deadline := time.Now().Add(time.Second)
+	for c.PendingCount() < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := c.PendingCount(); n != 3 {
+		t.Fatalf("%d requests in flight, want 3", n)
+	}
+	hubConn.Close()
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; !errors.Is(err, ErrClosed) {
+			t.Errorf("got %v, want ErrClosed", err)
+		}
+	}
+	if n := c.PendingCount(); n != 0 {
+		t.Fatalf("%d requests still pending", n)
+	}
+}
@@ -0,0 +1,251 @@
+package hubclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// proxyHandshakeTimeout bounds the talk with the proxy before the socket is
+// handed to the client.
+const proxyHandshakeTimeout = 10 * time.Second
+
+// ProxyFromEnvironment returns ALL_PROXY (or all_proxy) unless NO_PROXY
+// (or no_proxy) exempts the host of address; "" means dial directly.
+func ProxyFromEnvironment(address string) string {
+	proxy := os.Getenv("ALL_PROXY")
+	if proxy == "" {
+		proxy = os.Getenv("all_proxy")
+	}
+	if proxy == "" {
+		return ""
+	}
+	noProxy := os.Getenv("NO_PROXY")
+	if noProxy == "" {
+		noProxy = os.Getenv("no_proxy")
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.TrimPrefix(strings.TrimSpace(entry), ".")
+		if entry == "" {
+			continue
+		}
+		if entry == "*" || host == entry || strings.HasSuffix(host, "."+entry) {
+			return ""
+		}
+	}
+	return proxy
+}
+
+// DialProxy is Dial through proxy, a socks5://, socks5h:// or http:// URL
+// with optional user:password. An empty proxy dials directly.
+func DialProxy(address, proxy string, handler func(Message)) (*Client, error) {
+	if proxy == "" {
+		return Dial(address, handler)
+	}
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), proxyHandshakeTimeout)
+	defer cancel()
+	conn, err := dialViaProxy(ctx, proxyURL, address)
+	if err != nil {
+		return nil, err
+	}
+	return newClient(conn, handler), nil
+}
+
+// dialViaProxy opens a tunnel to address through proxyURL.
+func dialViaProxy(ctx context.Context, proxyURL *url.URL, address string) (net.Conn, error) {
+	var handshake func(net.Conn, *url.URL, string) (net.Conn, error)
+	defaultPort := ""
+	switch proxyURL.Scheme {
+	case "socks5", "socks5h":
+		handshake, defaultPort = socks5Connect, "1080"
+	case "http":
+		handshake, defaultPort = httpConnect, "80"
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", proxyURL.Scheme)
+	}
+	proxyAddr := proxyURL.Host
+	if proxyURL.Port() == "" {
+		proxyAddr = net.JoinHostPort(proxyURL.Hostname(), defaultPort)
+	}
+	conn, err := dialHappy(ctx, proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("proxy %s: %w", proxyAddr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	tunnel, err := handshake(conn, proxyURL, address)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("proxy %s: %w", proxyAddr, err)
+	}
+	conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+var socks5Replies = map[byte]string{
+	1: "general failure",
+	2: "connection not allowed by ruleset",
+	3: "network unreachable",
+	4: "host unreachable",
+	5: "connection refused",
+	6: "TTL expired",
+	7: "command not supported",
+	8: "address type not supported",
+}
+
+// socks5Connect runs a SOCKS5 CONNECT (RFC 1928), with username/password
+// authentication (RFC 1929) when the proxy URL carries a user.
+func socks5Connect(conn net.Conn, proxyURL *url.URL, address string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q", portStr)
+	}
+	methods := []byte{0x00}
+	if proxyURL.User != nil {
+		methods = []byte{0x02}
+	}
+	if _, err := conn.Write(append([]byte{0x05, byte(len(methods))}, methods...)); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, err
+	}
+	if reply[0] != 0x05 {
+		return nil, errors.New("not a SOCKS5 proxy")
+	}
+	switch reply[1] {
+	case 0x00:
+	case 0x02:
+		user := proxyURL.User.Username()
+		pass, _ := proxyURL.User.Password()
+		if len(user) > 255 || len(pass) > 255 {
+			return nil, errors.New("SOCKS5 credentials too long")
+		}
+		auth := []byte{0x01, byte(len(user))}
+		auth = append(auth, user...)
+		auth = append(auth, byte(len(pass)))
+		auth = append(auth, pass...)
+		if _, err := conn.Write(auth); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return nil, err
+		}
+		if reply[1] != 0x00 {
+			return nil, errors.New("SOCKS5 authentication failed")
+		}
+	default:
+		return nil, errors.New("SOCKS5 proxy accepts none of our authentication methods")
+	}
+
+	req := []byte{0x05, 0x01, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			req = append(append(req, 0x01), ip4...)
+		} else {
+			req = append(append(req, 0x04), ip...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, errors.New("host name too long for SOCKS5")
+		}
+		req = append(append(req, 0x03, byte(len(host))), host...)
+	}
+	req = binary.BigEndian.AppendUint16(req, uint16(port))
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return nil, err
+	}
+	if head[1] != 0x00 {
+		if msg, ok := socks5Replies[head[1]]; ok {
+			return nil, fmt.Errorf("SOCKS5 connect to %s: %s", address, msg)
+		}
+		return nil, fmt.Errorf("SOCKS5 connect to %s: reply %d", address, head[1])
+	}
+	var skip int
+	switch head[3] {
+	case 0x01:
+		skip = net.IPv4len
+	case 0x04:
+		skip = net.IPv6len
+	case 0x03:
+		n := make([]byte, 1)
+		if _, err := io.ReadFull(conn, n); err != nil {
+			return nil, err
+		}
+		skip = int(n[0])
+	default:
+		return nil, fmt.Errorf("SOCKS5 reply with address type %d", head[3])
+	}
+	if _, err := io.CopyN(io.Discard, conn, int64(skip+2)); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// httpConnect opens a tunnel with an HTTP CONNECT request.
+func httpConnect(conn net.Conn, proxyURL *url.URL, address string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: address},
+		Host:   address,
+		Header: make(http.Header),
+	}
+	if proxyURL.User != nil {
+		pass, _ := proxyURL.User.Password()
+		creds := base64.StdEncoding.EncodeToString([]byte(proxyURL.User.Username() + ":" + pass))
+		req.Header.Set("Proxy-Authorization", "Basic "+creds)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT %s: %s", address, resp.Status)
+	}
+	if r.Buffered() == 0 {
+		return conn, nil
+	}
+	// the hub speaks first, so its hello may already sit in the buffer
+	return &bufferedConn{Conn: conn, r: r}, nil
+}
+
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) { return c.r.Read(p) }
@@ -0,0 +1,175 @@
+package hubclient
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// greeter stands in for the hub: it writes a line as soon as a connection
+// arrives, the way the hub sends its hello first.
+func greeter(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Write([]byte("hello\n"))
+			conn.Close()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// fakeProxy accepts one connection, runs handshake on it and then relays
+// to whatever address handshake returned.
+func fakeProxy(t *testing.T, handshake func(conn net.Conn, r *bufio.Reader) string) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		target := handshake(conn, r)
+		if target == "" {
+			return
+		}
+		upstream, err := net.Dial("tcp", target)
+		if err != nil {
+			return
+		}
+		defer upstream.Close()
+		go io.Copy(upstream, r)
+		io.Copy(conn, upstream)
+	}()
+	return ln.Addr().String()
+}
+
+func readGreeting(t *testing.T, conn net.Conn) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "hello\n" {
+		t.Fatalf("read through tunnel: %q, %v", line, err)
+	}
+}
+
+func TestSOCKS5Connect(t *testing.T) {
+	target := greeter(t)
+	_, targetPort, _ := net.SplitHostPort(target)
+	proxy := fakeProxy(t, func(conn net.Conn, r *bufio.Reader) string {
+		greeting := make([]byte, 3)
+		if _, err := io.ReadFull(r, greeting); err != nil || greeting[2] != 0x02 {
+			t.Errorf("greeting %v, %v: want username/password offered", greeting, err)
+			return ""
+		}
+		conn.Write([]byte{0x05, 0x02})
+		head := make([]byte, 2)
+		io.ReadFull(r, head)
+		user := make([]byte, head[1])
+		io.ReadFull(r, user)
+		n, _ := r.ReadByte()
+		pass := make([]byte, n)
+		io.ReadFull(r, pass)
+		if string(user) != "ann" || string(pass) != "s3cret" {
+			t.Errorf("credentials %q:%q", user, pass)
+			conn.Write([]byte{0x01, 0x01})
+			return ""
+		}
+		conn.Write([]byte{0x01, 0x00})
+		req := make([]byte, 5)
+		io.ReadFull(r, req)
+		if req[1] != 0x01 || req[3] != 0x03 {
+			t.Errorf("request %v: want CONNECT to a domain name", req)
+			return ""
+		}
+		host := make([]byte, req[4])
+		io.ReadFull(r, host)
+		port := make([]byte, 2)
+		io.ReadFull(r, port)
+		if string(host) != "localhost" {
+			t.Errorf("host %q, want localhost", host)
+		}
+		conn.Write([]byte{0x05, 0x00, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return net.JoinHostPort("127.0.0.1", strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	})
+	proxyURL, _ := url.Parse("socks5://ann:s3cret@" + proxy)
+	conn, err := dialViaProxy(context.Background(), proxyURL, net.JoinHostPort("localhost", targetPort))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	readGreeting(t, conn)
+}
+
+func TestSOCKS5Refused(t *testing.T) {
+	proxy := fakeProxy(t, func(conn net.Conn, r *bufio.Reader) string {
+		io.ReadFull(r, make([]byte, 3))
+		conn.Write([]byte{0x05, 0x00})
+		io.ReadFull(r, make([]byte, 10))
+		conn.Write([]byte{0x05, 0x05, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+		return ""
+	})
+	proxyURL, _ := url.Parse("socks5://" + proxy)
+	if _, err := dialViaProxy(context.Background(), proxyURL, "127.0.0.1:4456"); err == nil {
+		t.Fatal("want an error when the proxy refuses the connection")
+	}
+}
+
+func TestHTTPConnect(t *testing.T) {
+	target := greeter(t)
+	proxy := fakeProxy(t, func(conn net.Conn, r *bufio.Reader) string {
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			t.Error(err)
+			return ""
+		}
+		if req.Method != http.MethodConnect || req.Host != target {
+			t.Errorf("got %s %s, want CONNECT %s", req.Method, req.Host, target)
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		return req.Host
+	})
+	proxyURL, _ := url.Parse("http://" + proxy)
+	conn, err := dialViaProxy(context.Background(), proxyURL, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	readGreeting(t, conn)
+}
+
+func TestProxyFromEnvironment(t *testing.T) {
+	t.Setenv("ALL_PROXY", "socks5://proxy:1080")
+	t.Setenv("NO_PROXY", "localhost, .lan")
+	for addr, want := range map[string]string{
+		"hub.example.com:4456": "socks5://proxy:1080",
+		"localhost:4456":       "",
+		"pi.lan:4456":          "",
+	} {
+		if got := ProxyFromEnvironment(addr); got != want {
+			t.Errorf("ProxyFromEnvironment(%q) = %q, want %q", addr, got, want)
+		}
+	}
+}
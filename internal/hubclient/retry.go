@@ -0,0 +1,141 @@
+package hubclient
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"brain/internal/protocol"
+)
+
+// RetryPolicy re-sends requests whose outcome is unknown because they
+// timed out. Attempts counts the first try; below 2 nothing is retried.
+type RetryPolicy struct {
+	Attempts   int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetry is used until SetRetry installs another policy.
+var DefaultRetry = RetryPolicy{Attempts: 3, Backoff: 250 * time.Millisecond, MaxBackoff: 2 * time.Second}
+
+// IdempotencyKeyField carries the key on mutating requests.
+const IdempotencyKeyField = "idempotencyKey"
+
+// idempotentActions can be repeated without changing anything on the hub.
+var idempotentActions = map[string]bool{
+	"status": true, "files": true, "logs": true, "hash": true,
+	"peer-files": true, "subscribe": true, "storage": true,
+	"broadcast-plan": true, "audit": true, "kv-get": true,
+	"chat-history": true, "chat-typing": true, "command-cancel": true,
+	"jobs": true, "job-cancel": true, "job-priority": true,
+	"peer-ping": true, "peer-config": true, "zones": true, "zone-delete": true,
+	"clock": true, "broadcast-stop": true, "stats": true, "trash": true,
+}
+
+// keyedActions change hub state. They carry an idempotency key, and are
+// only retried when the hub promises to answer a repeated key with the
+// first result instead of acting twice.
+var keyedActions = map[string]bool{
+	"upload": true, "broadcast": true, "broadcast-play": true, "play": true,
+	"delete": true, "move": true, "restore": true, "purge": true, "clipboard": true, "kv-set": true, "chat": true,
+	"broadcast-image": true, "command-start": true, "peer-restart": true,
+	"peer-update": true, "peer-config-set": true, "zone-set": true,
+}
+
+// SetRetry replaces the retry policy.
+func (c *Client) SetRetry(p RetryPolicy) {
+	if c != nil {
+		c.retry.Store(&p)
+	}
+}
+
+func (c *Client) retryPolicy() RetryPolicy {
+	if p := c.retry.Load(); p != nil {
+		return *p
+	}
+	return DefaultRetry
+}
+
+// retryable reports whether a timed-out action may be sent again.
+func (c *Client) retryable(action string) bool {
+	if idempotentActions[action] {
+		return true
+	}
+	if keyedActions[action] {
+		hello := c.Hello()
+		return hello != nil && hello.Has(protocol.CapIdempotency)
+	}
+	return false
+}
+
+type idempotencyKeyCtx struct{}
+
+// WithIdempotencyKey makes keyed actions sent with ctx carry key, so a
+// caller that re-sends the same intent later, say from an offline queue,
+// is deduplicated against the first try.
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// withIdempotencyKey returns payload plus a key for keyed actions, leaving
+// the caller's map untouched. A key already in payload is kept; otherwise
+// the one on ctx or a fresh one is used.
+func withIdempotencyKey(ctx context.Context, action string, payload map[string]any) map[string]any {
+	if !keyedActions[action] {
+		return payload
+	}
+	if _, ok := payload[IdempotencyKeyField]; ok {
+		return payload
+	}
+	key, _ := ctx.Value(idempotencyKeyCtx{}).(string)
+	if key == "" {
+		key = NewIdempotencyKey()
+	}
+	keyed := make(map[string]any, len(payload)+1)
+	for k, v := range payload {
+		keyed[k] = v
+	}
+	keyed[IdempotencyKeyField] = key
+	return keyed
+}
+
+// NewIdempotencyKey returns a random 128-bit key in hex.
+func NewIdempotencyKey() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// sendWithRetry runs attempt until it succeeds, fails for a reason other
+// than a timeout, the policy runs out or ctx ends.
+func (c *Client) sendWithRetry(ctx context.Context, action string, attempt func() (*Message, error)) (*Message, error) {
+	policy := c.retryPolicy()
+	if !c.retryable(action) || policy.Attempts < 2 {
+		return attempt()
+	}
+	delay := policy.Backoff
+	for i := 1; ; i++ {
+		msg, err := attempt()
+		if err == nil || !errors.Is(err, ErrTimeout) || i >= policy.Attempts {
+			return msg, err
+		}
+		c.registry().Add(MetricRetries, map[string]string{"action": action}, 1)
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, err
+		case <-c.closed:
+			t.Stop()
+			return nil, err
+		case <-t.C:
+		}
+		delay *= 2
+		if policy.MaxBackoff > 0 && delay > policy.MaxBackoff {
+			delay = policy.MaxBackoff
+		}
+	}
+}
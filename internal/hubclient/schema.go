@@ -0,0 +1,76 @@
+package hubclient
+
+import (
+	"encoding/json"
+
+	"brain/internal/metrics"
+	"brain/internal/protocol"
+)
+
+// Validation chooses what happens to hub messages that do not match their
+// schema in package protocol.
+type Validation int32
+
+const (
+	// ValidateStrict fails a mismatched response with a
+	// *protocol.SchemaError and drops a mismatched event.
+	ValidateStrict Validation = iota
+	// ValidateLenient uses mismatched messages anyway, for older hubs
+	// whose shapes predate the schemas.
+	ValidateLenient
+)
+
+// EventSchemaViolation is a synthetic event, like "disconnect", reporting
+// a message that did not match its schema. Its payload is the
+// *protocol.SchemaError.
+const EventSchemaViolation = "schema-violation"
+
+// SetValidation picks strict or lenient handling of mismatched messages.
+// The default is strict.
+func (c *Client) SetValidation(v Validation) {
+	if c != nil {
+		c.validation.Store(int32(v))
+	}
+}
+
+// Validation reports the current handling of mismatched messages.
+func (c *Client) Validation() Validation {
+	if c == nil {
+		return ValidateStrict
+	}
+	return Validation(c.validation.Load())
+}
+
+// checkSchema validates body, the data or payload of msg, and reports a
+// mismatch. It returns the error only when the message must be refused.
+// Bodies the codec cannot decode are left to the typed decode to report.
+func (c *Client) checkSchema(kind, name string, msg Message, body []byte) *protocol.SchemaError {
+	schema := protocol.ResponseSchemas[name]
+	if kind == "event" {
+		schema = protocol.EventSchemas[name]
+	}
+	if schema == nil {
+		return nil
+	}
+	var v any
+	if len(body) > 0 && msg.decode(body, &v) != nil {
+		return nil
+	}
+	violations := schema.Validate(v)
+	if len(violations) == 0 {
+		return nil
+	}
+	// the hello is always used: nothing can be negotiated without it, and
+	// it may arrive before SetValidation takes effect
+	rejected := c.Validation() == ValidateStrict && !(kind == "event" && name == protocol.EventHello)
+	err := &protocol.SchemaError{Kind: kind, Name: name, Violations: violations, Rejected: rejected}
+	c.registry().Add(MetricSchemaViolations, metrics.Labels{"kind": kind, "name": name}, 1)
+	if c.eventHandler != nil {
+		payload, _ := json.Marshal(err)
+		go c.eventHandler(Message{Type: "event", Event: EventSchemaViolation, Payload: payload})
+	}
+	if !rejected {
+		return nil
+	}
+	return err
+}
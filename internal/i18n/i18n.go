@@ -0,0 +1,104 @@
+// Package i18n translates UI strings from gettext .po catalogs embedded in
+// the binary. Lookups fall back to the English msgid, so untranslated
+// strings and a missing catalog are never an error for callers.
+//
+// To add or refresh a translation:
+//
+//	go generate ./internal/i18n           # rewrite po/brain.pot from tr() calls
+//	msginit -i po/brain.pot -o po/de.po   # start a new language
+//	msgmerge -U po/de.po po/brain.pot     # or update an existing one
+package i18n
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+//go:generate go run ../../cmd/i18nextract -o po/brain.pot ../../cmd/gtkclient
+
+//go:embed po
+var catalogs embed.FS
+
+var current atomic.Pointer[map[string]string]
+
+// T returns the translation of msgid in the loaded language, or msgid.
+func T(msgid string) string {
+	if m := current.Load(); m != nil {
+		if s, ok := (*m)[msgid]; ok {
+			return s
+		}
+	}
+	return msgid
+}
+
+// Init loads the catalog for lang, or for the environment's locale when
+// lang is empty. It returns the catalog name it loaded; "" with a nil
+// error means English.
+func Init(lang string) (string, error) {
+	candidates := Candidates(lang)
+	for _, name := range candidates {
+		data, err := fs.ReadFile(catalogs, "po/"+name+".po")
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		m, err := ParsePO(strings.NewReader(string(data)))
+		if err != nil {
+			return "", err
+		}
+		current.Store(&m)
+		return name, nil
+	}
+	current.Store(nil)
+	return "", nil
+}
+
+// Languages lists the embedded catalogs.
+func Languages() []string {
+	entries, _ := fs.ReadDir(catalogs, "po")
+	var langs []string
+	for _, e := range entries {
+		if name, ok := strings.CutSuffix(e.Name(), ".po"); ok {
+			langs = append(langs, name)
+		}
+	}
+	return langs
+}
+
+// Candidates expands lang, or LANGUAGE, LC_ALL, LC_MESSAGES and LANG in
+// gettext's order, into catalog names to try: "de_DE.UTF-8" gives de_DE
+// then de.
+func Candidates(lang string) []string {
+	var list []string
+	if lang != "" {
+		list = []string{lang}
+	} else if v := os.Getenv("LANGUAGE"); v != "" {
+		list = strings.Split(v, ":")
+	} else {
+		for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+			if v := os.Getenv(key); v != "" {
+				list = []string{v}
+				break
+			}
+		}
+	}
+	var names []string
+	for _, l := range list {
+		l, _, _ = strings.Cut(l, ".")
+		l, _, _ = strings.Cut(l, "@")
+		if l == "" || l == "C" || l == "POSIX" {
+			continue
+		}
+		names = append(names, l)
+		if base, _, ok := strings.Cut(l, "_"); ok {
+			names = append(names, base)
+		}
+	}
+	return names
+}
@@ -0,0 +1,104 @@
+package i18n
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParsePO reads the msgid/msgstr pairs of a .po file. Fuzzy entries, empty
+// translations and the header entry are left out so they fall back to
+// English; for plural entries msgstr[0] is used.
+func ParsePO(r io.Reader) (map[string]string, error) {
+	out := make(map[string]string)
+	var (
+		msgid, msgstr strings.Builder
+		target        *strings.Builder
+		fuzzy, seen   bool
+	)
+	flush := func() {
+		if seen && !fuzzy && msgid.Len() > 0 && msgstr.Len() > 0 {
+			out[msgid.String()] = msgstr.String()
+		}
+		msgid.Reset()
+		msgstr.Reset()
+		target, fuzzy, seen = nil, false, false
+	}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		switch {
+		case text == "":
+			flush()
+		case strings.HasPrefix(text, "#"):
+			if seen {
+				flush()
+			}
+			if strings.HasPrefix(text, "#,") && strings.Contains(text, "fuzzy") {
+				fuzzy = true
+			}
+		case strings.HasPrefix(text, "msgid_plural"), strings.HasPrefix(text, "msgctxt"):
+			target = nil
+		case strings.HasPrefix(text, "msgid "):
+			if seen {
+				flush()
+			}
+			seen = true
+			target = &msgid
+			if err := appendQuoted(target, strings.TrimPrefix(text, "msgid ")); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		case strings.HasPrefix(text, "msgstr[0] "), strings.HasPrefix(text, "msgstr "):
+			target = &msgstr
+			_, value, _ := strings.Cut(text, " ")
+			if err := appendQuoted(target, value); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		case strings.HasPrefix(text, "msgstr["):
+			target = nil
+		case strings.HasPrefix(text, `"`):
+			if target == nil {
+				continue
+			}
+			if err := appendQuoted(target, text); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		default:
+			return nil, fmt.Errorf("line %d: unexpected %q", line, text)
+		}
+	}
+	flush()
+	return out, scanner.Err()
+}
+
+func appendQuoted(b *strings.Builder, s string) error {
+	u, err := strconv.Unquote(strings.TrimSpace(s))
+	if err != nil {
+		return fmt.Errorf("bad string %s", s)
+	}
+	b.WriteString(u)
+	return nil
+}
+
+// WritePOT renders msgids as a translation template, each with the source
+// positions it was found at.
+func WritePOT(w io.Writer, msgids []string, refs map[string][]string) error {
+	bw := bufio.NewWriter(w)
+	bw.WriteString("# Translation template for the brain GTK client.\n")
+	bw.WriteString("# Generated by cmd/i18nextract; do not edit.\n")
+	bw.WriteString("msgid \"\"\nmsgstr \"\"\n\"Content-Type: text/plain; charset=UTF-8\\n\"\n\n")
+	for _, id := range msgids {
+		for _, ref := range refs[id] {
+			fmt.Fprintf(bw, "#: %s\n", ref)
+		}
+		if strings.Contains(id, "%") {
+			bw.WriteString("#, c-format\n")
+		}
+		fmt.Fprintf(bw, "msgid %s\nmsgstr \"\"\n\n", strconv.Quote(id))
+	}
+	return bw.Flush()
+}
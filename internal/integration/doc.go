@@ -0,0 +1,6 @@
+// Package integration holds end-to-end tests that run the typed hub client
+// and the script runner against the fakehub simulator over real sockets.
+// They need no GTK and no real hub:
+//
+//	go test ./internal/integration
+package integration
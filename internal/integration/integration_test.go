@@ -0,0 +1,1714 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"brain/internal/automation"
+	"brain/internal/fakehub"
+	"brain/internal/gateway"
+	"brain/internal/hubclient"
+	"brain/internal/metrics"
+	"brain/internal/protocol"
+	"brain/internal/script"
+	"brain/internal/syncdir"
+)
+
+const waitEvent = 2 * time.Second
+
+// harness is one simulator with one client connected to it.
+type harness struct {
+	hub    *fakehub.Server
+	client *hubclient.Client
+	events chan hubclient.Message
+
+	mu   sync.Mutex
+	sent []string
+}
+
+func start(t *testing.T, cfg fakehub.Config) *harness {
+	t.Helper()
+	h := &harness{hub: fakehub.New(cfg), events: make(chan hubclient.Message, 256)}
+	if err := h.hub.Start("127.0.0.1:0", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.hub.Close() })
+	client, err := hubclient.Dial(h.hub.SocketAddr(), func(msg hubclient.Message) {
+		select {
+		case h.events <- msg:
+		default:
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	// a schema mismatch anywhere fails the request instead of slipping by
+	client.SetValidation(hubclient.ValidateStrict)
+	client.Sent = func(id, action string, payload map[string]any) {
+		h.mu.Lock()
+		h.sent = append(h.sent, action)
+		h.mu.Unlock()
+	}
+	h.client = client
+	ctx, cancel := context.WithTimeout(context.Background(), waitEvent)
+	defer cancel()
+	if client.WaitHello(ctx) == nil {
+		t.Fatal("no hello from fakehub")
+	}
+	return h
+}
+
+func (h *harness) ctx(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// waitFor returns the first event named name, skipping others.
+func (h *harness) waitFor(t *testing.T, name string) hubclient.Message {
+	t.Helper()
+	deadline := time.After(waitEvent)
+	for {
+		select {
+		case msg := <-h.events:
+			if msg.Event == name {
+				return msg
+			}
+		case <-deadline:
+			t.Fatalf("no %s event within %v", name, waitEvent)
+		}
+	}
+}
+
+// actions names what the hub received, in order.
+func (h *harness) actions() []string {
+	var out []string
+	for _, r := range h.hub.Requests() {
+		out = append(out, r.Action)
+	}
+	return out
+}
+
+func fmtJSON(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+func TestHandshake(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	hello := h.client.Hello()
+	if hello.Version != protocol.Version {
+		t.Errorf("hello version %d, want %d", hello.Version, protocol.Version)
+	}
+	if msg := hello.Compatibility(); msg != "" {
+		t.Errorf("compatibility: %s", msg)
+	}
+	for _, capability := range fakehub.Capabilities {
+		if !h.client.Supports(capability) {
+			t.Errorf("client does not see capability %s", capability)
+		}
+	}
+	old := start(t, fakehub.Config{Without: []string{protocol.CapPeerFiles}})
+	if old.client.Supports(protocol.CapPeerFiles) {
+		t.Error("client assumes peer-files, which the hub does not advertise")
+	}
+	if _, err := old.client.PeerFiles(old.ctx(t), "peer-kitchen", ""); !errors.Is(err, hubclient.ErrUnsupported) {
+		t.Errorf("peer-files on a hub without it: %v, want ErrUnsupported", err)
+	}
+	if n := len(old.hub.Requests()); n != 0 {
+		t.Errorf("an unsupported action reached the hub: %d requests", n)
+	}
+	var status hubclient.Status
+	if err := h.waitFor(t, protocol.EventStatus).DecodePayload(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status.Host != h.hub.Host() || !status.Connected {
+		t.Errorf("pushed status %+v", status)
+	}
+}
+
+func TestStatusAndFiles(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	status, err := h.client.Status(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Host != h.hub.Host() {
+		t.Errorf("status host %q, want %q", status.Host, h.hub.Host())
+	}
+	files, err := h.client.Files(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(fakehub.CannedFiles()) {
+		t.Fatalf("%d files, want %d", len(files), len(fakehub.CannedFiles()))
+	}
+	for _, f := range files {
+		if f.Size <= 0 || f.ContentType == "" || f.Modified.IsZero() {
+			t.Errorf("file missing details: %+v", f)
+		}
+	}
+	peers, err := h.client.Command(h.ctx(t), "peers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(fmtJSON(peers), "peer-kitchen") {
+		t.Errorf("peers command: %v", peers)
+	}
+}
+
+func TestUploadDownloadDelete(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	data := bytes.Repeat([]byte("brain "), 1000)
+	res, err := h.client.Upload(h.ctx(t), hubclient.UploadRequest{Filename: "notes/test.txt", Data: data})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	if res.SHA256 != hex.EncodeToString(sum[:]) || res.Size != len(data) || !res.Verified {
+		t.Errorf("upload result %+v", res)
+	}
+
+	resp, err := http.Get("http" + strings.TrimPrefix(h.hub.Host(), "ws") + "/audio/notes/test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(got, data) {
+		t.Errorf("downloaded %d bytes, want the %d uploaded", len(got), len(data))
+	}
+
+	hash, err := h.client.Hash(h.ctx(t), "notes/test.txt")
+	if err != nil || hash.SHA256 != res.SHA256 {
+		t.Errorf("hash %+v, %v", hash, err)
+	}
+	if err := h.client.Delete(h.ctx(t), "notes/test.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.client.Delete(h.ctx(t), "notes/test.txt"); !errors.Is(err, protocol.ErrNotFound) {
+		t.Errorf("second delete: %v, want not found", err)
+	}
+}
+
+func TestChunkedUpload(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	data := fakehub.Tone(440, 1)
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	ctx := h.ctx(t)
+	begin, err := h.client.UploadBegin(ctx, hubclient.UploadBeginRequest{Filename: "tone.wav", Size: int64(len(data)), SHA256: digest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const chunk = 4096
+	offset := begin.Offset
+	for offset < int64(len(data)) {
+		end := min(offset+chunk, int64(len(data)))
+		progress, err := h.client.UploadChunk(ctx, begin.UploadID, offset, data[offset:end])
+		if err != nil {
+			t.Fatal(err)
+		}
+		offset = progress.Offset
+	}
+	resumed, err := h.client.UploadResume(ctx, begin.UploadID, digest)
+	if err != nil || resumed.Offset != int64(len(data)) {
+		t.Fatalf("resume %+v, %v", resumed, err)
+	}
+	res, err := h.client.UploadCommit(ctx, begin.UploadID, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Filename != "tone.wav" || res.Size != len(data) {
+		t.Errorf("commit result %+v", res)
+	}
+}
+
+func TestTemporaryUpload(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	other, err := hubclient.Dial(h.hub.SocketAddr(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	ctx := h.ctx(t)
+	if other.WaitHello(ctx) == nil {
+		t.Fatal("no hello from fakehub")
+	}
+	res, err := other.Upload(ctx, hubclient.UploadRequest{Filename: "scratch.txt", Data: []byte("scratch"), Temporary: true})
+	if err != nil || !res.DeleteOnDisconnect {
+		t.Fatalf("upload until disconnect %+v, %v", res, err)
+	}
+	res, err = h.client.Upload(ctx, hubclient.UploadRequest{Filename: "brief.txt", Data: []byte("brief"), Temporary: true, TTL: time.Second})
+	if err != nil || res.ExpiresAt == "" {
+		t.Fatalf("upload with ttl %+v, %v", res, err)
+	}
+	other.Close()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		files, err := h.client.Files(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		left := 0
+		for _, f := range files {
+			if f.Name == "scratch.txt" || f.Name == "brief.txt" {
+				left++
+			}
+		}
+		if left == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d temporary uploads still listed", left)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	older := start(t, fakehub.Config{Without: []string{protocol.CapTemporary}})
+	_, err = older.client.Upload(older.ctx(t), hubclient.UploadRequest{Filename: "scratch.txt", Data: []byte("scratch"), Temporary: true})
+	if !errors.Is(err, hubclient.ErrUnsupported) {
+		t.Errorf("temporary upload to an older hub: %v, want unsupported", err)
+	}
+}
+
+func TestQuota(t *testing.T) {
+	h := start(t, fakehub.Config{Files: []fakehub.File{}, Quota: 1000})
+	if _, err := h.client.Upload(h.ctx(t), hubclient.UploadRequest{Filename: "small.bin", Data: make([]byte, 600)}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := h.client.Upload(h.ctx(t), hubclient.UploadRequest{Filename: "big.bin", Data: make([]byte, 600)})
+	if !errors.Is(err, protocol.ErrQuotaExceeded) {
+		t.Fatalf("upload past quota: %v, want ErrQuotaExceeded", err)
+	}
+	if protocol.Retryable(err) {
+		t.Error("quota errors must not be retried")
+	}
+	usage, err := h.client.Storage(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usage.Used != 600 || usage.Quota != 1000 || usage.Free() != 400 {
+		t.Errorf("storage %+v", usage)
+	}
+}
+
+func TestPlayFlow(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	if err := h.client.Play(h.ctx(t), "chime.wav"); err != nil {
+		t.Fatal(err)
+	}
+	var np hubclient.NowPlaying
+	if err := h.waitFor(t, protocol.EventNowPlaying).DecodePayload(&np); err != nil {
+		t.Fatal(err)
+	}
+	if np.Filename != "chime.wav" {
+		t.Errorf("now playing %+v", np)
+	}
+	if err := h.client.Play(h.ctx(t), "missing.wav"); !errors.Is(err, protocol.ErrNotFound) {
+		t.Errorf("play missing file: %v, want not found", err)
+	}
+
+	if err := h.client.BroadcastPlay(h.ctx(t), "doorbell.wav"); err != nil {
+		t.Fatal(err)
+	}
+	var played struct {
+		Filename string `json:"filename"`
+		Self     bool   `json:"self"`
+	}
+	if err := h.waitFor(t, protocol.EventBroadcastPlay).DecodePayload(&played); err != nil {
+		t.Fatal(err)
+	}
+	if played.Filename != "doorbell.wav" || !played.Self {
+		t.Errorf("broadcast-play event %+v", played)
+	}
+	if err := h.client.Playback(h.ctx(t), "pause", nil, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.client.Broadcast(h.ctx(t), "hello peers"); err != nil {
+		t.Fatal(err)
+	}
+	if msg := h.waitFor(t, protocol.EventHubMessage); !strings.Contains(string(msg.Payload), "hello peers") {
+		t.Errorf("hub-message %s", msg.Payload)
+	}
+}
+
+func TestBroadcastPlan(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	plan, err := h.client.PlanBroadcast(h.ctx(t), "broadcast-play", "doorbell.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Filename != "doorbell.wav" || len(plan.Recipients) != 3 || plan.Recipients[0].Name != "kitchen" {
+		t.Errorf("plan %+v", plan)
+	}
+	if _, err := h.client.PlanBroadcast(h.ctx(t), "broadcast-play", "missing.wav"); !errors.Is(err, protocol.ErrNotFound) {
+		t.Errorf("plan for a missing file: %v, want not found", err)
+	}
+	if plan, err := h.client.PlanBroadcast(h.ctx(t), "broadcast", "hello peers"); err != nil || len(plan.Recipients) != 3 {
+		t.Errorf("broadcast plan %+v, %v", plan, err)
+	}
+	if _, err := h.client.PlanBroadcast(h.ctx(t), "delete", "x"); err == nil {
+		t.Error("planning a delete succeeded")
+	}
+}
+
+func TestRoles(t *testing.T) {
+	h := start(t, fakehub.Config{Role: protocol.RoleReadOnly})
+	if h.client.Role() != protocol.RoleReadOnly {
+		t.Fatalf("role %q", h.client.Role())
+	}
+	if _, err := h.client.Files(h.ctx(t)); err != nil {
+		t.Errorf("files: %v", err)
+	}
+	if _, err := h.client.Command(h.ctx(t), "peers"); err != nil {
+		t.Errorf("read-only command: %v", err)
+	}
+	before := len(h.hub.Requests())
+	err := h.client.BroadcastPlay(h.ctx(t), "doorbell.wav")
+	if !errors.Is(err, protocol.ErrForbidden) || protocol.Retryable(err) {
+		t.Errorf("broadcast-play as read-only: %v, want ErrForbidden", err)
+	}
+	if len(h.hub.Requests()) != before {
+		t.Error("a forbidden request was sent")
+	}
+	// the hub checks too, for what the client cannot tell up front
+	if _, err := h.client.Command(h.ctx(t), "audio delete chime.wav"); !errors.Is(err, protocol.ErrForbidden) {
+		t.Errorf("writing command as read-only: %v, want ErrForbidden", err)
+	}
+
+	op := start(t, fakehub.Config{Role: protocol.RoleOperator})
+	if err := op.client.BroadcastPlay(op.ctx(t), "doorbell.wav"); err != nil {
+		t.Errorf("broadcast-play as operator: %v", err)
+	}
+	if err := op.client.Delete(op.ctx(t), "chime.wav"); !errors.Is(err, protocol.ErrForbidden) {
+		t.Errorf("delete as operator: %v, want ErrForbidden", err)
+	}
+}
+
+func TestAudit(t *testing.T) {
+	h := start(t, fakehub.Config{ID: "peer-me"})
+	if err := h.client.BroadcastPlay(h.ctx(t), "doorbell.wav"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.client.Upload(h.ctx(t), hubclient.UploadRequest{Filename: "new.wav", Data: []byte("RIFF")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.client.Delete(h.ctx(t), "new.wav"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.client.Files(h.ctx(t)); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := h.client.Audit(h.ctx(t), 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		if e.Actor != "peer-me" || e.Time == "" {
+			t.Errorf("entry %+v", e)
+		}
+		got = append(got, e.Action+" "+e.Target)
+	}
+	if want := "broadcast-play doorbell.wav,upload new.wav,delete new.wav"; strings.Join(got, ",") != want {
+		t.Errorf("audit %q, want %q", got, want)
+	}
+	if last, err := h.client.Audit(h.ctx(t), 1); err != nil || len(last) != 1 || last[0].Action != "delete" {
+		t.Errorf("last entry %+v, %v", last, err)
+	}
+}
+
+func TestClipboard(t *testing.T) {
+	h := start(t, fakehub.Config{ID: "peer-me"})
+	n, err := h.client.Clipboard(h.ctx(t), "ssh-ed25519 AAAA…")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Error("clipboard reached no peers")
+	}
+	var got struct {
+		Text string `json:"text"`
+		From string `json:"from"`
+		Self bool   `json:"self"`
+	}
+	if err := h.waitFor(t, protocol.EventClipboard).DecodePayload(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "ssh-ed25519 AAAA…" || got.From != "peer-me" || !got.Self {
+		t.Errorf("clipboard event %+v", got)
+	}
+	before := len(h.hub.Requests())
+	if _, err := h.client.Clipboard(h.ctx(t), strings.Repeat("x", protocol.MaxClipboardBytes+1)); err == nil {
+		t.Error("oversized clipboard text accepted")
+	}
+	if after := len(h.hub.Requests()); after != before {
+		t.Errorf("oversized clipboard text reached the hub")
+	}
+}
+
+func TestBroadcastImage(t *testing.T) {
+	h := start(t, fakehub.Config{ID: "peer-me"})
+	if _, err := h.client.Upload(h.ctx(t), hubclient.UploadRequest{Filename: "shots/door.png", Data: []byte("\x89PNG\r\n\x1a\n")}); err != nil {
+		t.Fatal(err)
+	}
+	n, err := h.client.BroadcastImage(h.ctx(t), "shots/door.png", "who is this?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Error("image reached no peers")
+	}
+	var got struct {
+		Filename string `json:"filename"`
+		Caption  string `json:"caption"`
+		From     string `json:"from"`
+		Self     bool   `json:"self"`
+	}
+	if err := h.waitFor(t, protocol.EventBroadcastImage).DecodePayload(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Filename != "shots/door.png" || got.Caption != "who is this?" || got.From != "peer-me" || !got.Self {
+		t.Errorf("broadcast-image event %+v", got)
+	}
+	if _, err := h.client.BroadcastImage(h.ctx(t), "missing.png", ""); !errors.Is(err, protocol.ErrNotFound) {
+		t.Errorf("missing image: %v", err)
+	}
+	before := len(h.hub.Requests())
+	if _, err := h.client.BroadcastImage(h.ctx(t), "doorbell.wav", ""); err == nil {
+		t.Error("audio accepted as an image")
+	}
+	if after := len(h.hub.Requests()); after != before {
+		t.Errorf("non-image reached the hub")
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	h.waitFor(t, protocol.EventStatus)
+	res, err := h.client.Subscribe(h.ctx(t), hubclient.Subscription{Events: []string{protocol.EventChatTyping}, StatusInterval: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(res.Events, []string{protocol.EventChatTyping}) || res.StatusIntervalSeconds != 1 {
+		t.Errorf("subscribe applied %+v", res)
+	}
+	if _, err := h.client.Chat(h.ctx(t), "", "unheard"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.client.ChatTyping(h.ctx(t), ""); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.After(waitEvent)
+	for typing, status := false, false; !typing || !status; {
+		select {
+		case msg := <-h.events:
+			switch msg.Event {
+			case protocol.EventChatTyping:
+				typing = true
+			case protocol.EventStatus:
+				status = true
+			case protocol.EventHello:
+				// sent before the subscription
+			default:
+				t.Errorf("%s event after subscribing to chat-typing only", msg.Event)
+			}
+		case <-deadline:
+			t.Fatalf("no chat-typing and status within %v", waitEvent)
+		}
+	}
+}
+
+func TestChat(t *testing.T) {
+	h := start(t, fakehub.Config{ID: "peer-me"})
+	sent, err := h.client.Chat(h.ctx(t), "", "lunch?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sent.Channel != protocol.DefaultChatChannel || sent.From != "peer-me" || sent.ID == "" {
+		t.Errorf("chat returned %+v", sent)
+	}
+	var got hubclient.ChatMessage
+	if err := h.waitFor(t, protocol.EventChat).DecodePayload(&got); err != nil {
+		t.Fatal(err)
+	}
+	if got != *sent {
+		t.Errorf("chat event %+v, want %+v", got, *sent)
+	}
+	if _, err := h.client.Chat(h.ctx(t), "ops", "deploying"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.client.ChatTyping(h.ctx(t), "ops"); err != nil {
+		t.Fatal(err)
+	}
+	var typing hubclient.ChatTyping
+	if err := h.waitFor(t, protocol.EventChatTyping).DecodePayload(&typing); err != nil {
+		t.Fatal(err)
+	}
+	if typing.Channel != "ops" || typing.From != "peer-me" {
+		t.Errorf("chat-typing event %+v", typing)
+	}
+
+	history, err := h.client.ChatHistory(h.ctx(t), "general", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 || history[0].Text != "lunch?" {
+		t.Errorf("general history %+v", history)
+	}
+	if history, _ := h.client.ChatHistory(h.ctx(t), "ops", 1); len(history) != 1 || history[0].Text != "deploying" {
+		t.Errorf("ops history %+v", history)
+	}
+	if _, err := h.client.Chat(h.ctx(t), "", "  "); err == nil {
+		t.Error("empty message accepted")
+	}
+}
+
+func TestCommandStream(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	id, err := h.client.CommandStart(h.ctx(t), "benchmark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out hubclient.CommandOutput
+	if err := h.waitFor(t, protocol.EventCommandOutput).DecodePayload(&out); err != nil {
+		t.Fatal(err)
+	}
+	if out.ID != id || !strings.Contains(out.Text, "peer-kitchen") {
+		t.Errorf("first output %+v", out)
+	}
+	var done hubclient.CommandDone
+	if err := h.waitFor(t, protocol.EventCommandDone).DecodePayload(&done); err != nil {
+		t.Fatal(err)
+	}
+	result, _ := done.Result.(map[string]any)
+	if done.ID != id || done.Cancelled || result["responded"] != float64(len(fakehub.CannedPeers())) {
+		t.Errorf("done %+v", done)
+	}
+
+	id, err = h.client.CommandStart(h.ctx(t), "benchmark")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancelled, err := h.client.CommandCancel(h.ctx(t), id); err != nil || !cancelled {
+		t.Fatalf("cancel: %v, %v", cancelled, err)
+	}
+	if err := h.waitFor(t, protocol.EventCommandDone).DecodePayload(&done); err != nil {
+		t.Fatal(err)
+	}
+	if done.ID != id || !done.Cancelled {
+		t.Errorf("cancelled done %+v", done)
+	}
+	if cancelled, err := h.client.CommandCancel(h.ctx(t), id); err != nil || cancelled {
+		t.Errorf("second cancel: %v, %v", cancelled, err)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	var ids []string
+	for i := 0; i < 3; i++ {
+		id, err := h.client.CommandStart(h.ctx(t), "benchmark")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	upload, err := h.client.UploadBegin(h.ctx(t), hubclient.UploadBeginRequest{Filename: "big.wav", Size: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.client.UploadChunk(h.ctx(t), upload.UploadID, 0, []byte("RI")); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := h.client.Jobs(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := map[string]string{}
+	for _, j := range jobs {
+		states[j.ID] = j.State
+		if j.Kind == "upload" && (j.Title != "big.wav" || j.Progress != 0.5) {
+			t.Errorf("upload job %+v", j)
+		}
+	}
+	if states[ids[0]] != "running" || states[ids[1]] != "running" || states[ids[2]] != "pending" || states[upload.UploadID] != "running" {
+		t.Fatalf("job states %v", states)
+	}
+
+	job, err := h.client.SetJobPriority(h.ctx(t), ids[2], 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.Priority != 5 || job.State != "pending" {
+		t.Errorf("reprioritized job %+v", job)
+	}
+	if _, err := h.client.SetJobPriority(h.ctx(t), "command-missing", 1); !errors.Is(err, protocol.ErrNotFound) {
+		t.Errorf("missing job: %v", err)
+	}
+	if cancelled, err := h.client.CancelJob(h.ctx(t), ids[2]); err != nil || !cancelled {
+		t.Fatalf("cancel pending job: %v, %v", cancelled, err)
+	}
+	var done hubclient.CommandDone
+	for done.ID != ids[2] {
+		if err := h.waitFor(t, protocol.EventCommandDone).DecodePayload(&done); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !done.Cancelled {
+		t.Errorf("pending job ended %+v", done)
+	}
+	if cancelled, err := h.client.CancelJob(h.ctx(t), upload.UploadID); err != nil || !cancelled {
+		t.Errorf("cancel upload job: %v, %v", cancelled, err)
+	}
+	if _, err := h.client.UploadResume(h.ctx(t), upload.UploadID, ""); !errors.Is(err, protocol.ErrNotFound) {
+		t.Errorf("cancelled upload resumed: %v", err)
+	}
+}
+
+func TestPeerPing(t *testing.T) {
+	peers := append(fakehub.CannedPeers(), fakehub.Peer{ID: "peer-attic", Offline: true})
+	h := start(t, fakehub.Config{Peers: peers})
+	ping, err := h.client.PingPeer(h.ctx(t), "", "peer-studio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ping.Reachable || ping.LatencyMs <= 0 || ping.From != "" {
+		t.Errorf("direct ping %+v", ping)
+	}
+	relayed, err := h.client.PingPeer(h.ctx(t), "peer-kitchen", "peer-studio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !relayed.Reachable || relayed.From != "peer-kitchen" || relayed.LatencyMs <= ping.LatencyMs {
+		t.Errorf("relayed ping %+v, direct %+v", relayed, ping)
+	}
+	for _, pair := range [][2]string{{"", "peer-attic"}, {"peer-attic", "peer-studio"}, {"", "peer-missing"}} {
+		ping, err := h.client.PingPeer(h.ctx(t), pair[0], pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ping.Reachable || ping.Error == "" {
+			t.Errorf("ping %v: %+v", pair, ping)
+		}
+	}
+	if _, err := h.client.PingPeer(h.ctx(t), "", ""); !errors.Is(err, protocol.ErrInvalid) {
+		t.Errorf("ping without a peer: %v", err)
+	}
+}
+
+func TestPeerFiles(t *testing.T) {
+	peers := append(fakehub.CannedPeers(), fakehub.Peer{ID: "peer-attic", Offline: true})
+	h := start(t, fakehub.Config{Peers: peers})
+	top, err := h.client.PeerFiles(h.ctx(t), "peer-studio", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if top.Peer != "peer-studio" || len(top.Files) != 2 || !top.Files[0].Dir || top.Files[1].Size == 0 {
+		t.Errorf("top listing %+v", top)
+	}
+	music, err := h.client.PeerFiles(h.ctx(t), "peer-studio", top.Files[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if music.Path != "music" || len(music.Files) != 2 {
+		t.Errorf("music listing %+v", music)
+	}
+	if err := h.client.PeerUpload(h.ctx(t), "peer-studio", "music/"+music.Files[0].Name); err != nil {
+		t.Fatal(err)
+	}
+	files, err := h.client.Files(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.ContainsFunc(files, func(f hubclient.HubFile) bool { return f.Name == music.Files[0].Name }) {
+		t.Errorf("%s is not in the library after peer-upload: %+v", music.Files[0].Name, files)
+	}
+	for _, peer := range []string{"peer-attic", "peer-missing"} {
+		if _, err := h.client.PeerFiles(h.ctx(t), peer, ""); !errors.Is(err, protocol.ErrNotFound) {
+			t.Errorf("peer-files on %s: %v", peer, err)
+		}
+	}
+	if _, err := h.client.PeerFiles(h.ctx(t), "peer-studio", "nope"); !errors.Is(err, protocol.ErrNotFound) {
+		t.Errorf("peer-files of a missing folder: %v", err)
+	}
+}
+
+func TestDirectTransfer(t *testing.T) {
+	peers := append(fakehub.CannedPeers(), fakehub.Peer{ID: "peer-attic", Offline: true})
+	h := start(t, fakehub.Config{Peers: peers})
+	offer := func(peer string) (string, error) {
+		var res struct {
+			TransferID string `json:"transferId"`
+		}
+		err := h.client.Call(h.ctx(t), "transfer-offer", map[string]any{
+			"peer": peer, "filename": "big.wav", "size": 4, "token": "secret", "endpoints": []string{},
+		}, &res)
+		return res.TransferID, err
+	}
+	id, err := offer("peer-studio")
+	if err != nil || id == "" {
+		t.Fatalf("offer %q, %v", id, err)
+	}
+	var answer struct {
+		TransferID string `json:"transferId"`
+		From       string `json:"from"`
+		Accept     bool   `json:"accept"`
+	}
+	if err := h.waitFor(t, protocol.EventTransferAnswer).DecodePayload(&answer); err != nil {
+		t.Fatal(err)
+	}
+	if answer.TransferID != id || answer.From != "peer-studio" || !answer.Accept {
+		t.Errorf("answer %+v", answer)
+	}
+	if err := h.client.Call(h.ctx(t), "transfer-answer", map[string]any{"transferId": id, "accept": true}, nil); !errors.Is(err, protocol.ErrForbidden) {
+		t.Errorf("answering our own offer: %v, want forbidden", err)
+	}
+
+	// the relay has to be on the hub before the peer is pointed at it
+	relay := map[string]any{"transferId": id, "fallback": "relay", "filename": "transfers/" + id + "/big.wav"}
+	if err := h.client.Call(h.ctx(t), "transfer-cancel", relay, nil); !errors.Is(err, protocol.ErrInvalid) {
+		t.Errorf("relay of a missing file: %v, want invalid", err)
+	}
+	if _, err := h.client.Upload(h.ctx(t), hubclient.UploadRequest{Filename: "transfers/" + id + "/big.wav", Data: []byte("data")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.client.Call(h.ctx(t), "transfer-cancel", relay, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.client.Call(h.ctx(t), "transfer-cancel", relay, nil); !errors.Is(err, protocol.ErrNotFound) {
+		t.Errorf("second cancel: %v, want not found", err)
+	}
+	for _, peer := range []string{"peer-attic", "peer-missing"} {
+		if _, err := offer(peer); !errors.Is(err, protocol.ErrNotFound) {
+			t.Errorf("offer to %s: %v, want not found", peer, err)
+		}
+	}
+}
+
+func TestAudioStream(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	var res struct {
+		Recipients int `json:"recipients"`
+	}
+	chunk := map[string]any{"streamId": "talk-1", "seq": 1, "phase": "data", "base64": "AAAA"}
+	if err := h.client.Call(h.ctx(t), "audio-stream", chunk, &res); err != nil {
+		t.Fatal(err)
+	}
+	if res.Recipients != len(fakehub.CannedPeers()) {
+		t.Errorf("%d recipients", res.Recipients)
+	}
+	var ev struct {
+		StreamID string `json:"streamId"`
+		Self     bool   `json:"self"`
+		Seq      int    `json:"seq"`
+		Base64   string `json:"base64"`
+	}
+	if err := h.waitFor(t, protocol.EventAudioStream).DecodePayload(&ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.StreamID != "talk-1" || !ev.Self || ev.Seq != 1 || ev.Base64 != "AAAA" {
+		t.Errorf("audio-stream event %+v", ev)
+	}
+	if err := h.client.Call(h.ctx(t), "audio-stream", map[string]any{"phase": "data"}, nil); !errors.Is(err, protocol.ErrInvalid) {
+		t.Errorf("chunk without a stream: %v", err)
+	}
+}
+
+func TestPeerControl(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	id, err := h.client.UpdatePeer(h.ctx(t), "peer-studio")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var phases []string
+	for {
+		var ev hubclient.PeerControl
+		if err := h.waitFor(t, protocol.EventPeerControl).DecodePayload(&ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.OperationID != id || ev.Peer != "peer-studio" || ev.Action != "update" {
+			t.Fatalf("peer-control event %+v for operation %s", ev, id)
+		}
+		phases = append(phases, ev.Phase)
+		if ev.Finished() {
+			break
+		}
+	}
+	if got := strings.Join(phases, " "); got != "requested updating updating restarting done" {
+		t.Errorf("update phases: %s", got)
+	}
+	if _, err := h.client.RestartPeer(h.ctx(t), "peer-missing"); !errors.Is(err, protocol.ErrNotFound) {
+		t.Errorf("restart of a missing peer: %v", err)
+	}
+
+	op := start(t, fakehub.Config{Role: protocol.RoleOperator})
+	if _, err := op.client.RestartPeer(op.ctx(t), "peer-studio"); !errors.Is(err, protocol.ErrForbidden) {
+		t.Errorf("operator restart: %v", err)
+	}
+}
+
+func TestPeerConfig(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	cfg, err := h.client.SetPeerVolume(h.ctx(t), "peer-kitchen", 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Peer != "peer-kitchen" || cfg.Volume == nil || *cfg.Volume != 40 {
+		t.Fatalf("stored config %+v", cfg)
+	}
+	var ev hubclient.PeerConfig
+	if err := h.waitFor(t, protocol.EventPeerConfig).DecodePayload(&ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Peer != "peer-kitchen" || ev.Volume == nil || *ev.Volume != 40 {
+		t.Errorf("peer-config event %+v", ev)
+	}
+	configs, err := h.client.PeerConfigs(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(configs) != 1 || configs[0].Peer != "peer-kitchen" {
+		t.Errorf("configs %+v", configs)
+	}
+	if _, err := h.client.SetPeerVolume(h.ctx(t), "peer-kitchen", 150); err == nil {
+		t.Error("volume 150 accepted")
+	}
+
+	if err := h.client.BroadcastPlay(h.ctx(t), "chime.wav"); err != nil {
+		t.Fatal(err)
+	}
+	volumes := map[string]*int{}
+	for len(volumes) < len(fakehub.CannedPeers()) {
+		var np hubclient.NowPlaying
+		if err := h.waitFor(t, protocol.EventNowPlaying).DecodePayload(&np); err != nil {
+			t.Fatal(err)
+		}
+		volumes[np.Peer] = np.Volume
+	}
+	if v := volumes["peer-kitchen"]; v == nil || *v != 40 {
+		t.Errorf("kitchen played at %v", v)
+	}
+	if v := volumes["peer-studio"]; v != nil {
+		t.Errorf("unconfigured studio played at %d", *v)
+	}
+}
+
+func TestZones(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	z, err := h.client.SetZone(h.ctx(t), "downstairs", []string{"peer-kitchen", "peer-garage", "peer-kitchen"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if z.Name != "downstairs" || len(z.Peers) != 2 {
+		t.Fatalf("stored zone %+v", z)
+	}
+	var ev hubclient.Zone
+	if err := h.waitFor(t, protocol.EventZone).DecodePayload(&ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Name != "downstairs" || ev.Deleted {
+		t.Errorf("zone event %+v", ev)
+	}
+	zones, err := h.client.Zones(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zones) != 1 || zones[0].Name != "downstairs" {
+		t.Errorf("zones %+v", zones)
+	}
+
+	plan, err := h.client.PlanBroadcastTo(h.ctx(t), "broadcast", "dinner", "downstairs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if plan.Zone != "downstairs" || len(plan.Recipients) != 2 {
+		t.Errorf("zone plan %+v", plan)
+	}
+	if err := h.client.BroadcastPlayTo(h.ctx(t), "chime.wav", "downstairs"); err != nil {
+		t.Fatal(err)
+	}
+	played := map[string]bool{}
+	for len(played) < 2 {
+		var np hubclient.NowPlaying
+		if err := h.waitFor(t, protocol.EventNowPlaying).DecodePayload(&np); err != nil {
+			t.Fatal(err)
+		}
+		played[np.Peer] = true
+	}
+	if !played["peer-kitchen"] || !played["peer-garage"] {
+		t.Errorf("zone broadcast played on %v", played)
+	}
+	if err := h.client.BroadcastTo(h.ctx(t), "hi", "upstairs"); !errors.Is(err, protocol.ErrNotFound) {
+		t.Errorf("broadcast to a missing zone: %v, want not found", err)
+	}
+
+	if err := h.client.DeleteZone(h.ctx(t), "downstairs"); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		var ev hubclient.Zone
+		if err := h.waitFor(t, protocol.EventZone).DecodePayload(&ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Deleted {
+			break
+		}
+	}
+	if zones, err := h.client.Zones(h.ctx(t)); err != nil || len(zones) != 0 {
+		t.Errorf("zones after delete %+v, %v", zones, err)
+	}
+}
+
+func TestSyncPlay(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	clock, err := h.client.Clock(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if clock.Offset > 50*time.Millisecond || clock.Offset < -50*time.Millisecond || clock.RTT <= 0 {
+		t.Errorf("clock %+v", clock)
+	}
+	sent := time.Now()
+	startAt, err := h.client.BroadcastPlaySynced(h.ctx(t), "chime.wav", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !startAt.After(sent) {
+		t.Errorf("start %v is not ahead of %v", startAt, sent)
+	}
+	var ev struct {
+		StartAt string `json:"startAt"`
+	}
+	if err := h.waitFor(t, protocol.EventBroadcastPlay).DecodePayload(&ev); err != nil {
+		t.Fatal(err)
+	}
+	if at, err := time.Parse(time.RFC3339Nano, ev.StartAt); err != nil || !at.Equal(startAt) {
+		t.Errorf("event startAt %q, want %v", ev.StartAt, startAt)
+	}
+	h.waitFor(t, protocol.EventNowPlaying)
+	if early := time.Until(startAt); early > 0 {
+		t.Errorf("playing %v before the start", early)
+	}
+}
+
+func TestBroadcastStop(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	if _, err := h.client.BroadcastPlayWith(h.ctx(t), "chime.wav", hubclient.PlayOptions{Loop: true}); err != nil {
+		t.Fatal(err)
+	}
+	for seen := 0; seen < len(fakehub.CannedPeers()); seen++ {
+		var np hubclient.NowPlaying
+		if err := h.waitFor(t, protocol.EventNowPlaying).DecodePayload(&np); err != nil {
+			t.Fatal(err)
+		}
+		if !np.Loop || np.State != "playing" {
+			t.Errorf("looped play %+v", np)
+		}
+	}
+	n, err := h.client.BroadcastStop(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(fakehub.CannedPeers()) {
+		t.Errorf("stop reached %d peers", n)
+	}
+	for seen := 0; seen < len(fakehub.CannedPeers()); seen++ {
+		var np hubclient.NowPlaying
+		if err := h.waitFor(t, protocol.EventNowPlaying).DecodePayload(&np); err != nil {
+			t.Fatal(err)
+		}
+		if np.State != "stopped" {
+			t.Errorf("after stop %+v", np)
+		}
+	}
+	h.waitFor(t, protocol.EventBroadcastStop)
+
+	// a synchronized start still pending is stopped too
+	if _, err := h.client.BroadcastPlaySynced(h.ctx(t), "chime.wav", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.client.BroadcastStop(h.ctx(t)); err != nil {
+		t.Fatal(err)
+	}
+	h.waitFor(t, protocol.EventBroadcastStop)
+	time.Sleep(300 * time.Millisecond)
+	if st, err := h.client.Status(h.ctx(t)); err != nil {
+		t.Fatal(err)
+	} else if len(st.NowPlaying) != 0 {
+		t.Errorf("playing after a stop: %+v", st.NowPlaying)
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	meta := &hubclient.AudioMeta{Duration: 1, Loudness: -23, ReplayGain: hubclient.ReplayGainReference + 23}
+	if _, err := h.client.Upload(h.ctx(t), hubclient.UploadRequest{Filename: "quiet.wav", Data: []byte("RIFF"), Meta: meta}); err != nil {
+		t.Fatal(err)
+	}
+	files, err := h.client.Files(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range files {
+		if f.Name == "quiet.wav" && (f.Loudness != -23 || f.ReplayGain != 5) {
+			t.Errorf("listed %+v", f)
+		}
+	}
+	if _, err := h.client.BroadcastPlayWith(h.ctx(t), "quiet.wav", hubclient.PlayOptions{Normalize: true}); err != nil {
+		t.Fatal(err)
+	}
+	var ev struct {
+		Gain *float64 `json:"gain"`
+	}
+	if err := h.waitFor(t, protocol.EventBroadcastPlay).DecodePayload(&ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Gain == nil || *ev.Gain != 5 {
+		t.Errorf("normalized broadcast-play gain %v", ev.Gain)
+	}
+
+	// a file nobody measured plays as it is
+	if _, err := h.client.BroadcastPlayWith(h.ctx(t), "chime.wav", hubclient.PlayOptions{Normalize: true}); err != nil {
+		t.Fatal(err)
+	}
+	ev.Gain = nil
+	if err := h.waitFor(t, protocol.EventBroadcastPlay).DecodePayload(&ev); err != nil {
+		t.Fatal(err)
+	}
+	if ev.Gain != nil {
+		t.Errorf("unmeasured file got gain %v", *ev.Gain)
+	}
+}
+
+func TestStats(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	if stats, err := h.client.Stats(h.ctx(t)); err != nil {
+		t.Fatal(err)
+	} else if len(stats) != 0 {
+		t.Errorf("stats before any play: %+v", stats)
+	}
+	for _, f := range []string{"chime.wav", "chime.wav", "doorbell.wav"} {
+		if err := h.client.BroadcastPlay(h.ctx(t), f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	stats, err := h.client.Stats(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 2 || stats[0].Name != "chime.wav" || stats[0].Plays != 2 || stats[1].Plays != 1 {
+		t.Fatalf("stats %+v", stats)
+	}
+	if _, err := time.Parse(time.RFC3339, stats[0].LastPlayed); err != nil {
+		t.Errorf("last played: %v", err)
+	}
+	if err := h.client.Delete(h.ctx(t), "doorbell.wav"); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err := h.client.Stats(h.ctx(t)); err != nil {
+		t.Fatal(err)
+	} else if len(stats) != 1 {
+		t.Errorf("deleted file still counted: %+v", stats)
+	}
+}
+
+func TestMove(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	if err := h.client.SetTags(h.ctx(t), "sfx/alarm.wav", []string{"loud"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.client.BroadcastPlay(h.ctx(t), "sfx/alarm.wav"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.client.Move(h.ctx(t), "sfx/alarm.wav", "archive/alarm.wav"); err != nil {
+		t.Fatal(err)
+	}
+	files, err := h.client.Files(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	if !slices.Contains(names, "archive/alarm.wav") || slices.Contains(names, "sfx/alarm.wav") {
+		t.Errorf("files after move: %v", names)
+	}
+	tags, err := h.client.Tags(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tags["archive/alarm.wav"]; len(got) != 1 || got[0] != "loud" {
+		t.Errorf("tags after move: %v", tags)
+	}
+	stats, err := h.client.Stats(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0].Name != "archive/alarm.wav" || stats[0].Plays != 1 {
+		t.Errorf("stats after move: %+v", stats)
+	}
+	if err := h.client.Move(h.ctx(t), "chime.wav", "doorbell.wav"); !errors.Is(err, protocol.ErrInvalid) {
+		t.Errorf("move onto an existing file: %v", err)
+	}
+	if err := h.client.Move(h.ctx(t), "sfx/alarm.wav", "alarm.wav"); !errors.Is(err, protocol.ErrNotFound) {
+		t.Errorf("move of a missing file: %v", err)
+	}
+}
+
+func TestTrash(t *testing.T) {
+	h := start(t, fakehub.Config{ID: "peer-me"})
+	if err := h.client.SetTags(h.ctx(t), "chime.wav", []string{"short"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []string{"chime.wav", "doorbell.wav"} {
+		if err := h.client.Delete(h.ctx(t), f); err != nil {
+			t.Fatal(err)
+		}
+	}
+	trash, err := h.client.Trash(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 2 || trash[0].Name != "doorbell.wav" || trash[1].Name != "chime.wav" || trash[1].DeletedBy != "peer-me" || trash[1].Size == 0 {
+		t.Fatalf("trash %+v", trash)
+	}
+	if err := h.client.Restore(h.ctx(t), "chime.wav"); err != nil {
+		t.Fatal(err)
+	}
+	files, err := h.client.Files(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := false
+	for _, f := range files {
+		restored = restored || f.Name == "chime.wav"
+	}
+	if !restored {
+		t.Error("restored file is not listed")
+	}
+	if tags, err := h.client.Tags(h.ctx(t)); err != nil || len(tags["chime.wav"]) != 1 {
+		t.Errorf("tags after restore: %v, %v", tags, err)
+	}
+	if err := h.client.Restore(h.ctx(t), "chime.wav"); !errors.Is(err, protocol.ErrNotFound) {
+		t.Errorf("second restore: %v, want not found", err)
+	}
+
+	// a new file under the old name blocks the restore
+	if _, err := h.client.Upload(h.ctx(t), hubclient.UploadRequest{Filename: "doorbell.wav", Data: []byte("new")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.client.Restore(h.ctx(t), "doorbell.wav"); !errors.Is(err, protocol.ErrInvalid) {
+		t.Errorf("restore over an existing file: %v", err)
+	}
+	if err := h.client.Delete(h.ctx(t), "chime.wav"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := h.client.Purge(h.ctx(t), "doorbell.wav"); err != nil || n != 1 {
+		t.Errorf("purge one: %d, %v", n, err)
+	}
+	if n, err := h.client.Purge(h.ctx(t), ""); err != nil || n != 1 {
+		t.Errorf("purge all: %d, %v", n, err)
+	}
+	if trash, err := h.client.Trash(h.ctx(t)); err != nil || len(trash) != 0 {
+		t.Errorf("trash after purge: %+v, %v", trash, err)
+	}
+}
+
+func TestSyncDir(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	if _, err := h.client.Upload(h.ctx(t), hubclient.UploadRequest{Filename: "synced/clash.wav", Data: []byte("hub")}); err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	write := func(name, data string) {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("a.wav", "one")
+	write("clash.wav", "local")
+	write("notes.txt", "not audio")
+	changes := make(chan syncdir.Entry, 64)
+	cfg := syncdir.Config{
+		Dir:           dir,
+		Folder:        "synced",
+		MirrorDeletes: true,
+		Settle:        50 * time.Millisecond,
+		StateFile:     filepath.Join(t.TempDir(), "sync.json"),
+		Client:        func() *hubclient.Client { return h.client },
+		OnChange:      func(e syncdir.Entry) { changes <- e },
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go syncdir.New(cfg).Run(ctx)
+	// files sync concurrently, so changes to other files than the one
+	// waited for are kept for later waits
+	var others []syncdir.Entry
+	wait := func(path string, status syncdir.Status) syncdir.Entry {
+		t.Helper()
+		for i, e := range others {
+			if e.Path == path && e.Status == status {
+				others = append(others[:i], others[i+1:]...)
+				return e
+			}
+		}
+		deadline := time.After(5 * time.Second)
+		for {
+			select {
+			case e := <-changes:
+				if e.Path == path && e.Status == status {
+					return e
+				}
+				if e.Path != path {
+					others = append(others, e)
+				}
+			case <-deadline:
+				t.Fatalf("%s never became %s", path, status)
+			}
+		}
+	}
+	hubHas := func(name, data string) {
+		t.Helper()
+		sum := sha256.Sum256([]byte(data))
+		if res, err := h.client.Hash(h.ctx(t), name); err != nil || res.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s on the hub: %+v, %v; want %q", name, res, err, data)
+		}
+	}
+
+	wait("a.wav", syncdir.Synced)
+	hubHas("synced/a.wav", "one")
+	// the hub's own clash.wav is kept and the local one goes beside it
+	conflict := wait("clash.wav", syncdir.Conflict)
+	if !strings.HasPrefix(conflict.Remote, "synced/clash (conflict ") {
+		t.Errorf("conflict copy %q", conflict.Remote)
+	}
+	hubHas("synced/clash.wav", "hub")
+	hubHas(conflict.Remote, "local")
+
+	write("a.wav", "two")
+	wait("a.wav", syncdir.Synced)
+	hubHas("synced/a.wav", "two")
+	if err := os.Remove(filepath.Join(dir, "a.wav")); err != nil {
+		t.Fatal(err)
+	}
+	wait("a.wav", syncdir.Deleted)
+	if _, err := h.client.Hash(h.ctx(t), "synced/a.wav"); !errors.Is(err, protocol.ErrNotFound) {
+		t.Errorf("deleted file still on the hub: %v", err)
+	}
+	if _, err := h.client.Hash(h.ctx(t), "synced/notes.txt"); !errors.Is(err, protocol.ErrNotFound) {
+		t.Errorf("non-audio file synced: %v", err)
+	}
+	cancel()
+
+	// a restart remembers the conflict from the state file
+	var clash syncdir.Entry
+	for _, e := range syncdir.New(cfg).Entries() {
+		if e.Path == "clash.wav" {
+			clash = e
+		}
+	}
+	if clash.Status != syncdir.Conflict || clash.Remote != conflict.Remote {
+		t.Errorf("after restart clash.wav is %+v", clash)
+	}
+}
+
+// TestSyncDirWithoutHash mirrors deletes to a hub that cannot hash files,
+// which must keep a copy changed on the hub since it was synced.
+func TestSyncDirWithoutHash(t *testing.T) {
+	h := start(t, fakehub.Config{Without: []string{protocol.CapHash}})
+	dir := t.TempDir()
+	for name, data := range map[string]string{"a.wav": "one", "b.wav": "two"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	changes := make(chan syncdir.Entry, 64)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go syncdir.New(syncdir.Config{
+		Dir:           dir,
+		MirrorDeletes: true,
+		Settle:        50 * time.Millisecond,
+		Client:        func() *hubclient.Client { return h.client },
+		OnChange:      func(e syncdir.Entry) { changes <- e },
+	}).Run(ctx)
+	// wait collects the entries that reach status, whatever order they
+	// come in
+	wait := func(status syncdir.Status, paths ...string) map[string]syncdir.Entry {
+		t.Helper()
+		got := make(map[string]syncdir.Entry)
+		deadline := time.After(5 * time.Second)
+		for len(got) < len(paths) {
+			select {
+			case e := <-changes:
+				if e.Status == status && slices.Contains(paths, e.Path) {
+					got[e.Path] = e
+				}
+			case <-deadline:
+				t.Fatalf("%v never all became %s; got %v", paths, status, got)
+			}
+		}
+		return got
+	}
+	wait(syncdir.Synced, "a.wav", "b.wav")
+	if _, err := h.client.Upload(h.ctx(t), hubclient.UploadRequest{Filename: "b.wav", Data: []byte("edited on the hub")}); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.wav", "b.wav"} {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	deleted := wait(syncdir.Deleted, "a.wav", "b.wav")
+	if e := deleted["b.wav"]; !strings.HasPrefix(e.Detail, "kept on the hub") {
+		t.Errorf("b.wav: %s", e.Detail)
+	}
+	files, err := h.client.Files(h.ctx(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+	}
+	if slices.Contains(names, "a.wav") || !slices.Contains(names, "b.wav") {
+		t.Errorf("hub holds %v; want b.wav kept and a.wav deleted", names)
+	}
+}
+
+func TestKV(t *testing.T) {
+	h := start(t, fakehub.Config{ID: "peer-me"})
+	other, err := hubclient.Dial(h.hub.SocketAddr(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if other.WaitHello(h.ctx(t)) == nil {
+		t.Fatal("no hello for the second client")
+	}
+	if _, err := other.KVSet(h.ctx(t), "house/mode", "home", 0); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := h.client.KVWatch(h.ctx(t), "house/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Value != "home" || entries[0].By != "peer-me" {
+		t.Fatalf("watch snapshot %+v", entries)
+	}
+
+	if _, err := other.KVSet(h.ctx(t), "presets/quiet", "20", 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.KVSet(h.ctx(t), "house/mode", "away", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	var changed hubclient.KVEntry
+	if err := h.waitFor(t, protocol.EventKV).DecodePayload(&changed); err != nil {
+		t.Fatal(err)
+	}
+	// the preset is outside the watched prefix, so the first event is the mode
+	if changed.Key != "house/mode" || changed.Value != "away" || changed.ExpiresAt == "" {
+		t.Errorf("kv event %+v", changed)
+	}
+	if err := other.KVDelete(h.ctx(t), "house/mode"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.waitFor(t, protocol.EventKV).DecodePayload(&changed); err != nil {
+		t.Fatal(err)
+	}
+	if changed.Key != "house/mode" || !changed.Deleted {
+		t.Errorf("kv delete event %+v", changed)
+	}
+
+	if e, err := h.client.KVGet(h.ctx(t), "house/mode"); err != nil || e != nil {
+		t.Errorf("deleted key: %+v, %v", e, err)
+	}
+	if e, err := h.client.KVGet(h.ctx(t), "presets/quiet"); err != nil || e == nil || e.Value != "20" {
+		t.Errorf("preset: %+v, %v", e, err)
+	}
+	if all, err := h.client.KVList(h.ctx(t), ""); err != nil || len(all) != 1 {
+		t.Errorf("list: %+v, %v", all, err)
+	}
+	if _, err := h.client.KVSet(h.ctx(t), "big", strings.Repeat("x", protocol.MaxKVValueBytes+1), 0); err == nil {
+		t.Error("oversized value accepted")
+	}
+}
+
+// TestTraffic checks what goes over the wire: every request the client
+// wrote arrives once and in order, and keyed actions carry an
+// idempotency key.
+func TestTraffic(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	ctx := h.ctx(t)
+	_, _ = h.client.Status(ctx)
+	_ = h.client.BroadcastPlay(ctx, "chime.wav")
+	_ = h.client.Broadcast(ctx, "hi")
+	_, _ = h.client.Tags(ctx)
+
+	want := []string{"status", "broadcast-play", "broadcast", "tags"}
+	h.mu.Lock()
+	sent := append([]string(nil), h.sent...)
+	h.mu.Unlock()
+	if strings.Join(sent, ",") != strings.Join(want, ",") {
+		t.Errorf("client wrote %v, want %v", sent, want)
+	}
+	if got := h.actions(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("hub received %v, want %v", got, want)
+	}
+	for _, r := range h.hub.Requests() {
+		_, keyed := r.Payload[hubclient.IdempotencyKeyField]
+		if wantKey := r.Action == "broadcast-play" || r.Action == "broadcast"; keyed != wantKey {
+			t.Errorf("%s: idempotency key present=%v, want %v", r.Action, keyed, wantKey)
+		}
+	}
+}
+
+// TestBytesByAction checks that socket traffic is counted against the
+// action of the request, and the response, that moved it.
+func TestBytesByAction(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	reg := metrics.NewRegistry()
+	h.client.SetMetrics(reg)
+	ctx := h.ctx(t)
+	if _, err := h.client.Status(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := h.client.Files(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, action := range []string{"status", "files"} {
+		labels := metrics.Labels{"action": action}
+		if reg.Total(hubclient.MetricBytesWritten, labels) == 0 {
+			t.Errorf("%s: no bytes written counted", action)
+		}
+		if reg.Total(hubclient.MetricBytesRead, labels) == 0 {
+			t.Errorf("%s: no bytes read counted", action)
+		}
+	}
+	if got := reg.Total(hubclient.MetricBytesRead, metrics.Labels{"action": "response"}); got != 0 {
+		t.Errorf("%v response bytes without an action", got)
+	}
+}
+
+func TestDisconnect(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	h.hub.Close()
+	msg := h.waitFor(t, "disconnect")
+	if msg.Error == nil {
+		t.Error("disconnect event without a reason")
+	}
+	if _, err := h.client.Status(h.ctx(t)); !hubclient.IsConnectionError(err) {
+		t.Errorf("status after disconnect: %v, want a connection error", err)
+	}
+}
+
+func TestPeriodicEvents(t *testing.T) {
+	h := start(t, fakehub.Config{EventInterval: 20 * time.Millisecond})
+	for _, name := range []string{protocol.EventHubMessage, protocol.EventNowPlaying, protocol.EventLog, protocol.EventStatus} {
+		h.waitFor(t, name)
+	}
+}
+
+func TestScript(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	steps, err := script.Parse(strings.NewReader(`
+status
+expect "connected":true
+play chime.wav
+expect ok
+play nothing.wav
+expect error not found
+command audio list
+expect "doorbell.wav"
+broadcast-play sfx/alarm.wav
+expect ok
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out bytes.Buffer
+	runner := &script.Runner{Client: h.client, Out: &out}
+	if err := runner.Run(h.ctx(t), steps); err != nil {
+		t.Fatalf("%v\n%s", err, out.String())
+	}
+}
+
+func TestAutomation(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	var notes, printed []string
+	cfg := automation.Config{
+		Client: func() *hubclient.Client { return h.client },
+		Actions: map[string]func(context.Context, ...string) error{
+			"notify": func(_ context.Context, args ...string) error {
+				notes = append(notes, args...)
+				return nil
+			},
+		},
+		Print: func(_, msg string) { printed = append(printed, msg) },
+	}
+	s, err := automation.Load(h.ctx(t), "door.star", []byte(`
+print("starting")
+
+def doorbell(ev):
+    call("kv-set", {"key": "door", "value": ev["text"]})
+    got = call("kv-get", {"key": "door"})
+    if got["entries"][0]["value"] != ev["text"]:
+        fail("kv-get returned %r" % got)
+    notify(ev["peer"] + " rang")
+    play("chime.wav")
+
+on("hub-message", doorbell, match = "(?i)doorbell")
+on("status", lambda ev: play("nothing.wav"))
+`), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(printed) != 1 || printed[0] != "starting" {
+		t.Errorf("print got %q", printed)
+	}
+	if len(s.Handlers) != 2 {
+		t.Fatalf("got %d handlers", len(s.Handlers))
+	}
+	door, status := s.Handlers[0], s.Handlers[1]
+	if door.Handles("hub-message", "hello") || door.Handles("status", "doorbell") || !door.Handles("hub-message", "DoorBell") {
+		t.Error("handler matches the wrong events")
+	}
+	if door.String() != "door.star:4:1" {
+		t.Errorf("handler at %q", door)
+	}
+	if err := s.Run(h.ctx(t), door, map[string]any{"text": `ring "doorbell"`, "peer": "kitchen"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(notes) != 1 || notes[0] != "kitchen rang" {
+		t.Errorf("notify got %q", notes)
+	}
+	// hub errors stop the handler and name the script line
+	err = s.Run(h.ctx(t), status, map[string]any{})
+	if err == nil || !strings.Contains(err.Error(), "door.star:13") || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("failed play returned %v", err)
+	}
+
+	for _, bad := range []string{"def (", `on("status", print, match = "(")`, `on("", print)`, `fail("no")`} {
+		if _, err := automation.Load(h.ctx(t), "bad.star", []byte(bad), cfg); err == nil {
+			t.Errorf("Load(%q) succeeded", bad)
+		}
+	}
+	late, err := automation.Load(h.ctx(t), "late.star", []byte(`on("status", lambda ev: on("status", print))`), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := late.Run(h.ctx(t), late.Handlers[0], nil); err == nil || !strings.Contains(err.Error(), "top level") {
+		t.Errorf("on in a handler returned %v", err)
+	}
+}
+
+func TestGateway(t *testing.T) {
+	h := start(t, fakehub.Config{})
+	srv := httptest.NewServer(gateway.New(gateway.Config{Client: func() *hubclient.Client { return h.client }, Token: "secret"}))
+	defer srv.Close()
+	do := func(req *http.Request) (int, map[string]any) {
+		t.Helper()
+		req.Header.Set("Authorization", "Bearer secret")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var body map[string]any
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatalf("%s %s: %v", req.Method, req.URL.Path, err)
+		}
+		return resp.StatusCode, body
+	}
+	form := func(path string, values url.Values) *http.Request {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL+path, strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req
+	}
+
+	resp, err := http.Get(srv.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Errorf("no token: %d, want 401", resp.StatusCode)
+	}
+
+	get, _ := http.NewRequest(http.MethodGet, srv.URL+"/status", nil)
+	if code, body := do(get); code != http.StatusOK || body["host"] != h.hub.Host() {
+		t.Errorf("GET /status: %d %v", code, body)
+	}
+	get, _ = http.NewRequest(http.MethodGet, srv.URL+"/files", nil)
+	if code, body := do(get); code != http.StatusOK || len(body["files"].([]any)) != len(fakehub.CannedFiles()) {
+		t.Errorf("GET /files: %d %v", code, body)
+	}
+	if code, body := do(form("/broadcast", url.Values{"message": {"dinner"}})); code != http.StatusOK {
+		t.Errorf("POST /broadcast: %d %v", code, body)
+	}
+	body := strings.NewReader(`{"filename": "chime.wav", "all": true}`)
+	req, _ := http.NewRequest(http.MethodPost, srv.URL+"/play", body)
+	req.Header.Set("Content-Type", "application/json")
+	if code, body := do(req); code != http.StatusOK || body["all"] != true {
+		t.Errorf("POST /play JSON: %d %v", code, body)
+	}
+	if code, body := do(form("/play", url.Values{"filename": {"missing.wav"}})); code != http.StatusNotFound || body["code"] != string(protocol.CodeNotFound) {
+		t.Errorf("POST /play missing: %d %v", code, body)
+	}
+	get, _ = http.NewRequest(http.MethodGet, srv.URL+"/play", nil)
+	if code, _ := do(get); code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /play: %d, want 405", code)
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	part, _ := mw.CreateFormFile("file", "bell.wav")
+	part.Write(fakehub.Tone(500, 0.2))
+	mw.WriteField("name", "sfx/bell.wav")
+	mw.WriteField("play", "true")
+	mw.Close()
+	req, _ = http.NewRequest(http.MethodPost, srv.URL+"/upload", &buf)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if code, body := do(req); code != http.StatusOK || body["filename"] != "sfx/bell.wav" {
+		t.Errorf("POST /upload: %d %v", code, body)
+	}
+	var played struct {
+		Filename string `json:"filename"`
+	}
+	h.waitFor(t, protocol.EventBroadcastPlay).DecodePayload(&played)
+	for played.Filename != "sfx/bell.wav" {
+		h.waitFor(t, protocol.EventBroadcastPlay).DecodePayload(&played)
+	}
+
+	offline := httptest.NewServer(gateway.New(gateway.Config{Client: func() *hubclient.Client { return nil }}))
+	defer offline.Close()
+	resp, err = http.Get(offline.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status while disconnected: %d, want 502", resp.StatusCode)
+	}
+}
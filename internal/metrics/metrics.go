@@ -0,0 +1,316 @@
+// Package metrics is a small in-process registry of counters, gauges and
+// histograms that can be rendered in the Prometheus text format. A nil
+// *Registry accepts and drops every update.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type Kind string
+
+const (
+	KindCounter   Kind = "counter"
+	KindGauge     Kind = "gauge"
+	KindHistogram Kind = "histogram"
+)
+
+// Labels are the dimensions of one series.
+type Labels map[string]string
+
+// LatencyBuckets suit request round trips, in seconds.
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+type series struct {
+	labels  Labels
+	value   float64
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+type family struct {
+	name    string
+	help    string
+	kind    Kind
+	bounds  []float64
+	series  map[string]*series
+	ordered []string
+}
+
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+
+	collectMu sync.Mutex
+	collect   []func()
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Describe registers help text and kind for a metric name. Metrics used
+// without Describe get their kind from the first update.
+func (r *Registry) Describe(name string, kind Kind, help string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.familyLocked(name, kind)
+	f.help = help
+}
+
+func (r *Registry) familyLocked(name string, kind Kind) *family {
+	f, ok := r.families[name]
+	if !ok {
+		f = &family{name: name, kind: kind, series: make(map[string]*series)}
+		if kind == KindHistogram {
+			f.bounds = LatencyBuckets
+		}
+		r.families[name] = f
+	}
+	return f
+}
+
+func (f *family) get(labels Labels) *series {
+	key := labelKey(labels)
+	s, ok := f.series[key]
+	if !ok {
+		copied := make(Labels, len(labels))
+		for k, v := range labels {
+			copied[k] = v
+		}
+		s = &series{labels: copied}
+		if f.kind == KindHistogram {
+			s.buckets = make([]uint64, len(f.bounds))
+		}
+		f.series[key] = s
+		f.ordered = append(f.ordered, key)
+		sort.Strings(f.ordered)
+	}
+	return s
+}
+
+// Add increments a counter.
+func (r *Registry) Add(name string, labels Labels, delta float64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.familyLocked(name, KindCounter).get(labels).value += delta
+}
+
+// Set replaces a gauge value.
+func (r *Registry) Set(name string, labels Labels, value float64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.familyLocked(name, KindGauge).get(labels).value = value
+}
+
+// Observe records one histogram sample.
+func (r *Registry) Observe(name string, labels Labels, value float64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f := r.familyLocked(name, KindHistogram)
+	s := f.get(labels)
+	for i, bound := range f.bounds {
+		if value <= bound {
+			s.buckets[i]++
+		}
+	}
+	s.sum += value
+	s.count++
+}
+
+// Total sums a counter or gauge across all of its series whose labels
+// include match.
+func (r *Registry) Total(name string, match Labels) float64 {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.families[name]
+	if !ok {
+		return 0
+	}
+	var total float64
+	for _, s := range f.series {
+		if matches(s.labels, match) {
+			if f.kind == KindHistogram {
+				total += float64(s.count)
+			} else {
+				total += s.value
+			}
+		}
+	}
+	return total
+}
+
+// HistogramTotals returns the summed sample count and sum of a histogram
+// across series whose labels include match.
+func (r *Registry) HistogramTotals(name string, match Labels) (count uint64, sum float64) {
+	if r == nil {
+		return 0, 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.families[name]
+	if !ok {
+		return 0, 0
+	}
+	for _, s := range f.series {
+		if matches(s.labels, match) {
+			count += s.count
+			sum += s.sum
+		}
+	}
+	return count, sum
+}
+
+// LabelValues lists the distinct values of one label within a metric.
+func (r *Registry) LabelValues(name, label string) []string {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, ok := r.families[name]
+	if !ok {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var values []string
+	for _, s := range f.series {
+		if v, ok := s.labels[label]; ok && !seen[v] {
+			seen[v] = true
+			values = append(values, v)
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+func matches(labels, match Labels) bool {
+	for k, v := range match {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// OnCollect registers f to run before every WriteText, for gauges that
+// are derived at scrape time such as ages.
+func (r *Registry) OnCollect(f func()) {
+	if r == nil {
+		return
+	}
+	r.collectMu.Lock()
+	defer r.collectMu.Unlock()
+	r.collect = append(r.collect, f)
+}
+
+// WriteText renders every metric in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	if r == nil {
+		return nil
+	}
+	r.collectMu.Lock()
+	hooks := append([]func(){}, r.collect...)
+	r.collectMu.Unlock()
+	for _, f := range hooks {
+		f()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	bw := bufio.NewWriter(w)
+	for _, name := range names {
+		f := r.families[name]
+		if f.help != "" {
+			fmt.Fprintf(bw, "# HELP %s %s\n", name, escapeHelp(f.help))
+		}
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, f.kind)
+		for _, key := range f.ordered {
+			s := f.series[key]
+			if f.kind != KindHistogram {
+				fmt.Fprintf(bw, "%s%s %s\n", name, formatLabels(s.labels, "", ""), formatValue(s.value))
+				continue
+			}
+			for i, bound := range f.bounds {
+				fmt.Fprintf(bw, "%s_bucket%s %d\n", name, formatLabels(s.labels, "le", formatValue(bound)), s.buckets[i])
+			}
+			fmt.Fprintf(bw, "%s_bucket%s %d\n", name, formatLabels(s.labels, "le", "+Inf"), s.count)
+			fmt.Fprintf(bw, "%s_sum%s %s\n", name, formatLabels(s.labels, "", ""), formatValue(s.sum))
+			fmt.Fprintf(bw, "%s_count%s %d\n", name, formatLabels(s.labels, "", ""), s.count)
+		}
+	}
+	return bw.Flush()
+}
+
+func labelKey(labels Labels) string {
+	return formatLabels(labels, "", "")
+}
+
+func formatLabels(labels Labels, extraKey, extraValue string) string {
+	keys := make([]string, 0, len(labels)+1)
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, 0, len(keys)+1)
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%q", k, escapeLabel(labels[k])))
+	}
+	if extraKey != "" {
+		parts = append(parts, fmt.Sprintf("%s=%q", extraKey, extraValue))
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// escapeLabel pre-escapes newlines; %q takes care of quotes and
+// backslashes.
+func escapeLabel(v string) string {
+	return strings.ReplaceAll(v, "\n", " ")
+}
+
+func escapeHelp(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	return strings.ReplaceAll(v, "\n", `\n`)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,274 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+)
+
+const (
+	DefaultPrefix  = "brain"
+	redialDelay    = 5 * time.Second
+	commandTimeout = 30 * time.Second
+)
+
+// BridgeConfig describes a bridge. Topics are relative to Prefix unless
+// they start with "/".
+type BridgeConfig struct {
+	Options
+	// Prefix defaults to DefaultPrefix.
+	Prefix string
+	// Topics maps hub events to the topic each is published on; nil
+	// publishes status, broadcast-play, hub-message and now-playing under
+	// their own names.
+	Topics map[string]string
+	// CommandTopic is where play and broadcast commands arrive, "command"
+	// by default. Each command's outcome goes to CommandTopic + "/result".
+	CommandTopic string
+	// Client returns the hub connection; it may return nil while
+	// disconnected.
+	Client func() *hubclient.Client
+	Logf   func(format string, args ...any)
+}
+
+// DefaultTopics are the events a bridge publishes when BridgeConfig.Topics
+// is nil.
+func DefaultTopics() map[string]string {
+	return map[string]string{
+		protocol.EventStatus:        "status",
+		protocol.EventBroadcastPlay: "broadcast-play",
+		protocol.EventHubMessage:    "hub-message",
+		protocol.EventNowPlaying:    "now-playing",
+	}
+}
+
+// Bridge publishes hub events to a broker and runs the commands it
+// receives. Feed it events with Event; Run keeps the broker connection up.
+type Bridge struct {
+	cfg BridgeConfig
+
+	mu     sync.Mutex
+	broker *Client
+}
+
+func NewBridge(cfg BridgeConfig) *Bridge {
+	if cfg.Prefix == "" {
+		cfg.Prefix = DefaultPrefix
+	}
+	if cfg.Topics == nil {
+		cfg.Topics = DefaultTopics()
+	}
+	if cfg.CommandTopic == "" {
+		cfg.CommandTopic = "command"
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = fmt.Sprintf("brain-%d", time.Now().UnixNano()%1e8)
+	}
+	if cfg.Logf == nil {
+		cfg.Logf = func(string, ...any) {}
+	}
+	cfg.Will = &Message{Topic: bridgeTopic(cfg.Prefix, "availability"), Payload: []byte("offline"), QoS: 1, Retain: true}
+	return &Bridge{cfg: cfg}
+}
+
+func bridgeTopic(prefix, topic string) string {
+	if strings.HasPrefix(topic, "/") {
+		return strings.TrimPrefix(topic, "/")
+	}
+	return strings.TrimSuffix(prefix, "/") + "/" + topic
+}
+
+func (b *Bridge) topic(name string) string {
+	return bridgeTopic(b.cfg.Prefix, name)
+}
+
+// Run connects to the broker and reconnects after it drops until ctx ends.
+func (b *Bridge) Run(ctx context.Context) {
+	for ctx.Err() == nil {
+		if err := b.session(ctx); err != nil && ctx.Err() == nil {
+			b.cfg.Logf("mqtt: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+		case <-time.After(redialDelay):
+		}
+	}
+}
+
+func (b *Bridge) session(ctx context.Context) error {
+	broker, err := Dial(b.cfg.Options, b.command)
+	if err != nil {
+		return err
+	}
+	defer broker.Close()
+	if err := broker.Subscribe(b.topic(b.cfg.CommandTopic), 1); err != nil {
+		return err
+	}
+	if err := broker.Publish(Message{Topic: b.topic("availability"), Payload: []byte("online"), QoS: 1, Retain: true}); err != nil {
+		return err
+	}
+	b.cfg.Logf("mqtt: connected to %s as %s", b.cfg.Broker, b.cfg.ClientID)
+	b.mu.Lock()
+	b.broker = broker
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.broker = nil
+		b.mu.Unlock()
+	}()
+	select {
+	case <-ctx.Done():
+		broker.Publish(Message{Topic: b.topic("availability"), Payload: []byte("offline"), QoS: 1, Retain: true})
+		return nil
+	case <-broker.Done():
+		return fmt.Errorf("connection to %s lost: %w", b.cfg.Broker, broker.Err())
+	}
+}
+
+// Connected reports whether the broker connection is up.
+func (b *Bridge) Connected() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.broker != nil
+}
+
+func (b *Bridge) publish(topic string, payload []byte, retain bool) {
+	b.mu.Lock()
+	broker := b.broker
+	b.mu.Unlock()
+	if broker == nil {
+		return
+	}
+	if err := broker.Publish(Message{Topic: topic, Payload: payload, Retain: retain}); err != nil {
+		b.cfg.Logf("mqtt: publish %s: %v", topic, err)
+	}
+}
+
+// Event publishes msg if its event has a topic. Status is retained so new
+// subscribers see the current state. A nil *Bridge drops events.
+func (b *Bridge) Event(msg hubclient.Message) {
+	if b == nil {
+		return
+	}
+	topic, ok := b.cfg.Topics[msg.Event]
+	if !ok || topic == "" {
+		return
+	}
+	payload := []byte(msg.JSONPayload())
+	if len(payload) == 0 {
+		payload = []byte("{}")
+	}
+	b.publish(b.topic(topic), payload, msg.Event == protocol.EventStatus)
+}
+
+// Command is a request arriving on the command topic, as JSON or as text
+// such as "play chime.wav" or "broadcast Dinner is ready".
+type Command struct {
+	Action   string `json:"action"`
+	Filename string `json:"filename,omitempty"`
+	Message  string `json:"message,omitempty"`
+	All      bool   `json:"all,omitempty"`
+	Command  string `json:"command,omitempty"`
+	// ID is echoed in the result so callers can match them up.
+	ID string `json:"id,omitempty"`
+}
+
+// ParseCommand reads a command payload.
+func ParseCommand(payload []byte) (Command, error) {
+	text := strings.TrimSpace(string(payload))
+	var c Command
+	if strings.HasPrefix(text, "{") {
+		if err := json.Unmarshal([]byte(text), &c); err != nil {
+			return c, fmt.Errorf("invalid command JSON: %w", err)
+		}
+	} else {
+		action, arg, _ := strings.Cut(text, " ")
+		arg = strings.TrimSpace(arg)
+		c.Action = action
+		switch strings.ToLower(action) {
+		case "play", "broadcast-play":
+			c.Filename = arg
+		case "broadcast":
+			c.Message = arg
+		case "command":
+			c.Command = arg
+		}
+	}
+	c.Action = strings.ToLower(c.Action)
+	switch c.Action {
+	case "play", "broadcast-play":
+		if c.Filename == "" {
+			return c, errors.New("filename is required")
+		}
+	case "broadcast":
+		if strings.TrimSpace(c.Message) == "" {
+			return c, errors.New("message is required")
+		}
+	case "command":
+		if strings.TrimSpace(c.Command) == "" {
+			return c, errors.New("command is required")
+		}
+	case "":
+		return c, errors.New("action is required")
+	default:
+		return c, fmt.Errorf("unknown action %q (want play, broadcast-play, broadcast or command)", c.Action)
+	}
+	return c, nil
+}
+
+// command runs a message from the command topic. It is the broker
+// client's handler, so the hub request runs on its own goroutine.
+func (b *Bridge) command(m Message) {
+	go func() {
+		c, err := ParseCommand(m.Payload)
+		var data any
+		if err == nil {
+			data, err = b.run(c)
+		}
+		result := map[string]any{"action": c.Action, "ok": err == nil}
+		if c.ID != "" {
+			result["id"] = c.ID
+		}
+		if err != nil {
+			result["error"] = protocol.Friendly(err)
+			b.cfg.Logf("mqtt: command %q failed: %v", m.Payload, err)
+		} else if data != nil {
+			result["data"] = data
+		}
+		out, _ := json.Marshal(result)
+		b.publish(b.topic(b.cfg.CommandTopic+"/result"), out, false)
+	}()
+}
+
+func (b *Bridge) run(c Command) (any, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+	var client *hubclient.Client
+	if b.cfg.Client != nil {
+		client = b.cfg.Client()
+	}
+	switch c.Action {
+	case "play":
+		if c.All {
+			return nil, client.BroadcastPlay(ctx, c.Filename)
+		}
+		return nil, client.Play(ctx, c.Filename)
+	case "broadcast-play":
+		return nil, client.BroadcastPlay(ctx, c.Filename)
+	case "broadcast":
+		return nil, client.Broadcast(ctx, c.Message)
+	case "command":
+		return client.Command(ctx, c.Command)
+	}
+	return nil, fmt.Errorf("unknown action %q", c.Action)
+}
@@ -0,0 +1,439 @@
+// Package mqtt is a minimal MQTT 3.1.1 client, enough to publish and
+// subscribe at QoS 0 and 1, and a bridge between a hub connection and a
+// broker.
+package mqtt
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	packetConnect     = 1
+	packetConnAck     = 2
+	packetPublish     = 3
+	packetPubAck      = 4
+	packetSubscribe   = 8
+	packetSubAck      = 9
+	packetPingReq     = 12
+	packetPingResp    = 13
+	packetDisconnect  = 14
+	maxRemainingBytes = 268435455
+)
+
+var ErrClosed = errors.New("mqtt: connection closed")
+
+// Message is a publication, received or to send.
+type Message struct {
+	Topic   string
+	Payload []byte
+	QoS     byte
+	Retain  bool
+}
+
+type Options struct {
+	// Broker is host[:port] or a tcp://, mqtt://, ssl:// or mqtts:// URL.
+	Broker   string
+	ClientID string
+	Username string
+	Password string
+	// KeepAlive defaults to 30 seconds.
+	KeepAlive time.Duration
+	// Will is published by the broker if the connection drops uncleanly.
+	Will *Message
+	// DialTimeout defaults to 10 seconds.
+	DialTimeout time.Duration
+}
+
+type Client struct {
+	conn    net.Conn
+	handler func(Message)
+
+	writeMu sync.Mutex
+	mu      sync.Mutex
+	nextID  uint16
+	acks    map[uint16]chan byte
+
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// BrokerAddress turns Options.Broker into a dial address, and whether to
+// use TLS.
+func BrokerAddress(broker string) (addr string, useTLS bool, err error) {
+	if broker == "" {
+		return "", false, errors.New("mqtt: no broker address")
+	}
+	if !strings.Contains(broker, "://") {
+		broker = "tcp://" + broker
+	}
+	u, err := url.Parse(broker)
+	if err != nil {
+		return "", false, fmt.Errorf("mqtt: broker address: %w", err)
+	}
+	port := "1883"
+	switch u.Scheme {
+	case "tcp", "mqtt":
+	case "ssl", "tls", "mqtts":
+		useTLS, port = true, "8883"
+	default:
+		return "", false, fmt.Errorf("mqtt: unsupported broker scheme %q", u.Scheme)
+	}
+	if u.Port() != "" {
+		port = u.Port()
+	}
+	if u.Hostname() == "" {
+		return "", false, fmt.Errorf("mqtt: broker address %q has no host", broker)
+	}
+	return net.JoinHostPort(u.Hostname(), port), useTLS, nil
+}
+
+// Dial connects and waits for the broker's CONNACK. handler receives each
+// publication on a subscribed topic, on the client's read goroutine.
+func Dial(opts Options, handler func(Message)) (*Client, error) {
+	addr, useTLS, err := BrokerAddress(opts.Broker)
+	if err != nil {
+		return nil, err
+	}
+	if opts.KeepAlive <= 0 {
+		opts.KeepAlive = 30 * time.Second
+	}
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 10 * time.Second
+	}
+	dialer := &net.Dialer{Timeout: opts.DialTimeout}
+	var conn net.Conn
+	if useTLS {
+		host, _, _ := net.SplitHostPort(addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	conn.SetDeadline(time.Now().Add(opts.DialTimeout))
+	if _, err := conn.Write(connectPacket(opts)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	kind, body, err := readPacket(r)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: waiting for CONNACK: %w", err)
+	}
+	if kind>>4 != packetConnAck || len(body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: expected CONNACK, got packet type %d", kind>>4)
+	}
+	if code := body[1]; code != 0 {
+		conn.Close()
+		return nil, connectError(code)
+	}
+	conn.SetDeadline(time.Time{})
+	c := &Client{
+		conn:    conn,
+		handler: handler,
+		acks:    make(map[uint16]chan byte),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(r)
+	go c.keepAlive(opts.KeepAlive)
+	return c, nil
+}
+
+func connectError(code byte) error {
+	reasons := map[byte]string{
+		1: "unacceptable protocol version",
+		2: "client identifier rejected",
+		3: "server unavailable",
+		4: "bad user name or password",
+		5: "not authorized",
+	}
+	if reason, ok := reasons[code]; ok {
+		return fmt.Errorf("mqtt: connection refused: %s", reason)
+	}
+	return fmt.Errorf("mqtt: connection refused (code %d)", code)
+}
+
+func connectPacket(opts Options) []byte {
+	var flags byte = 0x02 // clean session
+	var body []byte
+	body = appendString(body, "MQTT")
+	body = append(body, 4, 0)
+	body = binary.BigEndian.AppendUint16(body, uint16(opts.KeepAlive/time.Second))
+	body = appendString(body, opts.ClientID)
+	if w := opts.Will; w != nil {
+		flags |= 0x04 | (w.QoS&3)<<3
+		if w.Retain {
+			flags |= 0x20
+		}
+		body = appendString(body, w.Topic)
+		body = appendBytes(body, w.Payload)
+	}
+	if opts.Username != "" {
+		flags |= 0x80
+		body = appendString(body, opts.Username)
+		if opts.Password != "" {
+			flags |= 0x40
+			body = appendString(body, opts.Password)
+		}
+	}
+	body[7] = flags
+	return packet(packetConnect<<4, body)
+}
+
+// Done is closed when the connection ends.
+func (c *Client) Done() <-chan struct{} {
+	return c.done
+}
+
+// Err is why the connection ended, once Done is closed.
+func (c *Client) Err() error {
+	<-c.done
+	return c.err
+}
+
+// Close sends DISCONNECT, so the broker discards the will, and closes the
+// connection.
+func (c *Client) Close() error {
+	c.write(packet(packetDisconnect<<4, nil))
+	c.shutdown(ErrClosed)
+	return nil
+}
+
+func (c *Client) shutdown(err error) {
+	c.closeOnce.Do(func() {
+		c.err = err
+		c.conn.Close()
+		close(c.done)
+	})
+}
+
+// Publish sends m. At QoS 1 it waits for the broker's PUBACK.
+func (c *Client) Publish(m Message) error {
+	header := byte(packetPublish<<4) | (m.QoS&1)<<1
+	if m.Retain {
+		header |= 1
+	}
+	body := appendString(nil, m.Topic)
+	var ack chan byte
+	var id uint16
+	if m.QoS > 0 {
+		id, ack = c.expectAck()
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, m.Payload...)
+	if err := c.write(packet(header, body)); err != nil {
+		return err
+	}
+	return c.waitAck(id, ack)
+}
+
+// Subscribe asks for publications matching filter at up to qos and waits
+// for the broker to grant it.
+func (c *Client) Subscribe(filter string, qos byte) error {
+	id, ack := c.expectAck()
+	body := binary.BigEndian.AppendUint16(nil, id)
+	body = appendString(body, filter)
+	body = append(body, qos&1)
+	if err := c.write(packet(packetSubscribe<<4|0x02, body)); err != nil {
+		return err
+	}
+	return c.waitAck(id, ack)
+}
+
+func (c *Client) expectAck() (uint16, chan byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.nextID++
+	if c.nextID == 0 {
+		c.nextID = 1
+	}
+	ack := make(chan byte, 1)
+	c.acks[c.nextID] = ack
+	return c.nextID, ack
+}
+
+func (c *Client) waitAck(id uint16, ack chan byte) error {
+	if ack == nil {
+		return nil
+	}
+	defer func() {
+		c.mu.Lock()
+		delete(c.acks, id)
+		c.mu.Unlock()
+	}()
+	select {
+	case code := <-ack:
+		if code == 0x80 {
+			return errors.New("mqtt: subscription refused")
+		}
+		return nil
+	case <-c.done:
+		return c.err
+	case <-time.After(30 * time.Second):
+		return errors.New("mqtt: timed out waiting for the broker")
+	}
+}
+
+func (c *Client) write(b []byte) error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(b); err != nil {
+		c.shutdown(err)
+		return err
+	}
+	return nil
+}
+
+func (c *Client) keepAlive(interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			c.write(packet(packetPingReq<<4, nil))
+		}
+	}
+}
+
+func (c *Client) readLoop(r *bufio.Reader) {
+	for {
+		kind, body, err := readPacket(r)
+		if err != nil {
+			c.shutdown(err)
+			return
+		}
+		switch kind >> 4 {
+		case packetPublish:
+			m, id, err := parsePublish(kind, body)
+			if err != nil {
+				c.shutdown(err)
+				return
+			}
+			if m.QoS > 0 {
+				c.write(packet(packetPubAck<<4, binary.BigEndian.AppendUint16(nil, id)))
+			}
+			if c.handler != nil {
+				c.handler(m)
+			}
+		case packetPubAck, packetSubAck:
+			if len(body) < 2 {
+				continue
+			}
+			code := byte(0)
+			if kind>>4 == packetSubAck && len(body) > 2 {
+				code = body[2]
+			}
+			c.mu.Lock()
+			ack := c.acks[binary.BigEndian.Uint16(body)]
+			c.mu.Unlock()
+			if ack != nil {
+				select {
+				case ack <- code:
+				default:
+				}
+			}
+		}
+	}
+}
+
+func parsePublish(header byte, body []byte) (Message, uint16, error) {
+	m := Message{QoS: header >> 1 & 3, Retain: header&1 != 0}
+	if len(body) < 2 {
+		return m, 0, errors.New("mqtt: short PUBLISH")
+	}
+	n := int(binary.BigEndian.Uint16(body))
+	if len(body) < 2+n {
+		return m, 0, errors.New("mqtt: short PUBLISH topic")
+	}
+	m.Topic = string(body[2 : 2+n])
+	body = body[2+n:]
+	var id uint16
+	if m.QoS > 0 {
+		if len(body) < 2 {
+			return m, 0, errors.New("mqtt: short PUBLISH packet id")
+		}
+		id = binary.BigEndian.Uint16(body)
+		body = body[2:]
+	}
+	m.Payload = body
+	return m, id, nil
+}
+
+func readPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, shift := 0, 0
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		shift += 7
+		if shift > 21 {
+			return 0, nil, errors.New("mqtt: malformed remaining length")
+		}
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header, body, nil
+}
+
+func packet(header byte, body []byte) []byte {
+	out := []byte{header}
+	n := len(body)
+	if n > maxRemainingBytes {
+		n = maxRemainingBytes
+		body = body[:n]
+	}
+	for {
+		b := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	return appendBytes(b, []byte(s))
+}
+
+func appendBytes(b, s []byte) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
@@ -0,0 +1,310 @@
+package mqtt
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"brain/internal/fakehub"
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+)
+
+// broker is just enough of an MQTT broker for the tests: exact topic
+// matches, retained messages and wills.
+type broker struct {
+	ln net.Listener
+
+	mu       sync.Mutex
+	subs     map[string][]net.Conn
+	retained map[string][]byte
+}
+
+func startBroker(t *testing.T) *broker {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &broker{ln: ln, subs: make(map[string][]net.Conn), retained: make(map[string][]byte)}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *broker) addr() string { return b.ln.Addr().String() }
+
+func (b *broker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	var will *Message
+	for {
+		header, body, err := readPacket(r)
+		if err != nil {
+			if will != nil {
+				b.route(*will)
+			}
+			return
+		}
+		switch header >> 4 {
+		case packetConnect:
+			flags := body[7]
+			rest := body[10:]
+			next := func() []byte {
+				n := int(binary.BigEndian.Uint16(rest))
+				s := rest[2 : 2+n]
+				rest = rest[2+n:]
+				return s
+			}
+			next() // client id
+			if flags&0x04 != 0 {
+				will = &Message{Topic: string(next()), Payload: next(), Retain: flags&0x20 != 0}
+			}
+			conn.Write(packet(packetConnAck<<4, []byte{0, 0}))
+		case packetSubscribe:
+			id := body[:2]
+			n := int(binary.BigEndian.Uint16(body[2:]))
+			filter := string(body[4 : 4+n])
+			b.mu.Lock()
+			b.subs[filter] = append(b.subs[filter], conn)
+			retained, ok := b.retained[filter]
+			b.mu.Unlock()
+			conn.Write(packet(packetSubAck<<4, append(append([]byte{}, id...), 0)))
+			if ok {
+				conn.Write(packet(packetPublish<<4|1, append(appendString(nil, filter), retained...)))
+			}
+		case packetPublish:
+			m, id, err := parsePublish(header, body)
+			if err != nil {
+				return
+			}
+			if m.QoS > 0 {
+				conn.Write(packet(packetPubAck<<4, binary.BigEndian.AppendUint16(nil, id)))
+			}
+			b.route(m)
+		case packetPingReq:
+			conn.Write(packet(packetPingResp<<4, nil))
+		case packetDisconnect:
+			return
+		}
+	}
+}
+
+func (b *broker) route(m Message) {
+	b.mu.Lock()
+	if m.Retain {
+		b.retained[m.Topic] = m.Payload
+	}
+	subs := append([]net.Conn(nil), b.subs[m.Topic]...)
+	b.mu.Unlock()
+	for _, c := range subs {
+		c.Write(packet(packetPublish<<4, append(appendString(nil, m.Topic), m.Payload...)))
+	}
+}
+
+// inbox collects what a subscribed client receives.
+type inbox struct {
+	got     chan Message
+	pending []Message
+}
+
+// listen subscribes a fresh client to topics.
+func listen(t *testing.T, b *broker, topics ...string) *inbox {
+	t.Helper()
+	in := &inbox{got: make(chan Message, 64)}
+	c, err := Dial(Options{Broker: b.addr(), ClientID: "listener"}, func(m Message) { in.got <- m })
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	for _, topic := range topics {
+		if err := c.Subscribe(topic, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return in
+}
+
+// next returns the first message on topic, keeping others for later.
+func (in *inbox) next(t *testing.T, topic string) Message {
+	t.Helper()
+	for i, m := range in.pending {
+		if m.Topic == topic {
+			in.pending = append(in.pending[:i], in.pending[i+1:]...)
+			return m
+		}
+	}
+	deadline := time.After(2 * time.Second)
+	for {
+		select {
+		case m := <-in.got:
+			if m.Topic == topic {
+				return m
+			}
+			in.pending = append(in.pending, m)
+		case <-deadline:
+			t.Fatalf("nothing published on %s", topic)
+		}
+	}
+}
+
+func TestBrokerAddress(t *testing.T) {
+	for _, tc := range []struct {
+		in, addr string
+		tls      bool
+	}{
+		{"localhost", "localhost:1883", false},
+		{"10.0.0.2:1884", "10.0.0.2:1884", false},
+		{"tcp://broker.lan", "broker.lan:1883", false},
+		{"mqtts://broker.lan", "broker.lan:8883", true},
+		{"ssl://broker.lan:9999", "broker.lan:9999", true},
+	} {
+		addr, useTLS, err := BrokerAddress(tc.in)
+		if err != nil || addr != tc.addr || useTLS != tc.tls {
+			t.Errorf("BrokerAddress(%q) = %q, %v, %v", tc.in, addr, useTLS, err)
+		}
+	}
+	for _, bad := range []string{"", "ws://broker.lan", "tcp://"} {
+		if _, _, err := BrokerAddress(bad); err == nil {
+			t.Errorf("BrokerAddress(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	b := startBroker(t)
+	got := listen(t, b, "a/b")
+	c, err := Dial(Options{Broker: b.addr(), ClientID: "pub", Username: "u", Password: "p"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Publish(Message{Topic: "a/b", Payload: []byte("hello"), QoS: 1}); err != nil {
+		t.Fatal(err)
+	}
+	big := strings.Repeat("x", 70000)
+	if err := c.Publish(Message{Topic: "a/b", Payload: []byte(big)}); err != nil {
+		t.Fatal(err)
+	}
+	if m := got.next(t, "a/b"); string(m.Payload) != "hello" {
+		t.Errorf("payload %q", m.Payload)
+	}
+	if m := got.next(t, "a/b"); string(m.Payload) != big {
+		t.Errorf("large payload: %d bytes", len(m.Payload))
+	}
+	c.Close()
+	if err := c.Publish(Message{Topic: "a/b"}); err == nil {
+		t.Error("publish after Close succeeded")
+	}
+}
+
+func TestParseCommand(t *testing.T) {
+	for _, tc := range []struct {
+		in   string
+		want Command
+	}{
+		{"play chime.wav", Command{Action: "play", Filename: "chime.wav"}},
+		{"Broadcast  Dinner is ready ", Command{Action: "broadcast", Message: "Dinner is ready"}},
+		{`{"action":"play","filename":"a b.wav","all":true,"id":"7"}`, Command{Action: "play", Filename: "a b.wav", All: true, ID: "7"}},
+		{"command peers", Command{Action: "command", Command: "peers"}},
+	} {
+		got, err := ParseCommand([]byte(tc.in))
+		if err != nil || got != tc.want {
+			t.Errorf("ParseCommand(%q) = %+v, %v", tc.in, got, err)
+		}
+	}
+	for _, bad := range []string{"", "play", "broadcast ", "dance now", `{"action":`} {
+		if _, err := ParseCommand([]byte(bad)); err == nil {
+			t.Errorf("ParseCommand(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestBridge(t *testing.T) {
+	b := startBroker(t)
+	hub := fakehub.New(fakehub.Config{})
+	if err := hub.Start("127.0.0.1:0", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	defer hub.Close()
+
+	var client *hubclient.Client
+	var mu sync.Mutex
+	bridge := NewBridge(BridgeConfig{
+		Options: Options{Broker: b.addr(), ClientID: "bridge"},
+		Prefix:  "home/brain",
+		Topics:  map[string]string{protocol.EventBroadcastPlay: "played", protocol.EventHubMessage: "/announcements"},
+		Client: func() *hubclient.Client {
+			mu.Lock()
+			defer mu.Unlock()
+			return client
+		},
+		Logf: t.Logf,
+	})
+	c, err := hubclient.Dial(hub.SocketAddr(), bridge.Event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	mu.Lock()
+	client = c
+	mu.Unlock()
+	got := listen(t, b, "home/brain/availability", "home/brain/played", "announcements", "home/brain/command/result")
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		bridge.Run(ctx)
+		close(done)
+	}()
+	if m := got.next(t, "home/brain/availability"); string(m.Payload) != "online" {
+		t.Fatalf("availability %q", m.Payload)
+	}
+
+	pub, err := Dial(Options{Broker: b.addr(), ClientID: "automation"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pub.Close()
+	pub.Publish(Message{Topic: "home/brain/command", Payload: []byte(`{"action":"play","filename":"chime.wav","all":true,"id":"1"}`)})
+	var result map[string]any
+	json.Unmarshal(got.next(t, "home/brain/command/result").Payload, &result)
+	if result["ok"] != true || result["id"] != "1" {
+		t.Errorf("play result %v", result)
+	}
+	var played map[string]any
+	json.Unmarshal(got.next(t, "home/brain/played").Payload, &played)
+	if played["filename"] != "chime.wav" {
+		t.Errorf("broadcast-play event %v", played)
+	}
+
+	pub.Publish(Message{Topic: "home/brain/command", Payload: []byte("play missing.wav")})
+	json.Unmarshal(got.next(t, "home/brain/command/result").Payload, &result)
+	if result["ok"] != false || result["error"] == "" {
+		t.Errorf("missing file result %v", result)
+	}
+
+	hub.Emit(protocol.EventHubMessage, map[string]any{"message": "hello"})
+	if m := got.next(t, "announcements"); !strings.Contains(string(m.Payload), "hello") {
+		t.Errorf("hub-message %q", m.Payload)
+	}
+
+	cancel()
+	<-done
+	if m := got.next(t, "home/brain/availability"); string(m.Payload) != "offline" {
+		t.Errorf("availability after stop %q", m.Payload)
+	}
+}
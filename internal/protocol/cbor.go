@@ -0,0 +1,1005 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CBOR (RFC 8949) covering what JSON can express, plus byte strings.
+// Struct fields follow their json tags, so the types shared with the JSON
+// codec need no second set of annotations. Values with their own
+// MarshalJSON or UnmarshalJSON go through JSON for that one value.
+
+const (
+	cborUint   = 0 << 5
+	cborNegInt = 1 << 5
+	cborBytes  = 2 << 5
+	cborText   = 3 << 5
+	cborArray  = 4 << 5
+	cborMap    = 5 << 5
+	cborTag    = 6 << 5
+	cborSimple = 7 << 5
+
+	cborFalse     = cborSimple | 20
+	cborTrue      = cborSimple | 21
+	cborNull      = cborSimple | 22
+	cborUndefined = cborSimple | 23
+	cborFloat16   = cborSimple | 25
+	cborFloat32   = cborSimple | 26
+	cborFloat64   = cborSimple | 27
+	cborBreak     = 0xff
+
+	cborIndefinite = 31
+	cborMaxDepth   = 512
+)
+
+// Raw is a value left in the encoding of the codec it arrived in.
+type Raw []byte
+
+var (
+	errCBORTruncated = errors.New("cbor: unexpected end of data")
+	errCBORDepth     = errors.New("cbor: nesting too deep")
+
+	rawType             = reflect.TypeOf(Raw(nil))
+	rawJSONType         = reflect.TypeOf(json.RawMessage(nil))
+	numberType          = reflect.TypeOf(json.Number(""))
+	jsonMarshalerType   = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+)
+
+// MarshalCBOR encodes v.
+func MarshalCBOR(v any) ([]byte, error) {
+	e := cborEncoder{buf: make([]byte, 0, 256)}
+	if err := e.encode(reflect.ValueOf(v), 0); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// UnmarshalCBOR decodes data, which must hold exactly one item, into v.
+func UnmarshalCBOR(data []byte, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("cbor: decode into non-pointer %T", v)
+	}
+	d := cborDecoder{data: data}
+	if err := d.decode(rv.Elem(), 0); err != nil {
+		return err
+	}
+	if d.off != len(data) {
+		return fmt.Errorf("cbor: %d trailing bytes", len(data)-d.off)
+	}
+	return nil
+}
+
+// CBORToJSON re-encodes one CBOR item as JSON.
+func CBORToJSON(data []byte) ([]byte, error) {
+	d := cborDecoder{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(v)
+}
+
+func appendCBORHead(b []byte, major byte, n uint64) []byte {
+	switch {
+	case n < 24:
+		return append(b, major|byte(n))
+	case n <= math.MaxUint8:
+		return append(b, major|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, major|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, major|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(b, major|27), n)
+}
+
+type cborEncoder struct {
+	buf []byte
+}
+
+func (e *cborEncoder) encode(v reflect.Value, depth int) error {
+	if depth > cborMaxDepth {
+		return errCBORDepth
+	}
+	if !v.IsValid() {
+		e.buf = append(e.buf, cborNull)
+		return nil
+	}
+	t := v.Type()
+	switch t {
+	case rawType:
+		if v.Len() == 0 {
+			e.buf = append(e.buf, cborNull)
+		} else {
+			e.buf = append(e.buf, v.Bytes()...)
+		}
+		return nil
+	case rawJSONType:
+		return e.encodeJSON(v.Bytes(), depth)
+	case numberType:
+		return e.encodeNumber(json.Number(v.String()))
+	}
+	if typeHooks(t).marshaler && !(v.Kind() == reflect.Pointer && v.IsNil()) {
+		data, err := v.Interface().(json.Marshaler).MarshalJSON()
+		if err != nil {
+			return err
+		}
+		return e.encodeJSON(data, depth)
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, cborTrue)
+		} else {
+			e.buf = append(e.buf, cborFalse)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.buf = appendCBORHead(e.buf, cborUint, v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return e.encodeFloat(v.Float())
+	case reflect.String:
+		e.buf = appendCBORHead(e.buf, cborText, uint64(v.Len()))
+		e.buf = append(e.buf, v.String()...)
+	case reflect.Slice:
+		if v.IsNil() {
+			e.buf = append(e.buf, cborNull)
+			return nil
+		}
+		if t.Elem().Kind() == reflect.Uint8 {
+			e.buf = appendCBORHead(e.buf, cborBytes, uint64(v.Len()))
+			e.buf = append(e.buf, v.Bytes()...)
+			return nil
+		}
+		fallthrough
+	case reflect.Array:
+		e.buf = appendCBORHead(e.buf, cborArray, uint64(v.Len()))
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf = append(e.buf, cborNull)
+			return nil
+		}
+		e.buf = appendCBORHead(e.buf, cborMap, uint64(v.Len()))
+		iter := v.MapRange()
+		for iter.Next() {
+			key, err := mapKey(iter.Key())
+			if err != nil {
+				return err
+			}
+			e.buf = appendCBORHead(e.buf, cborText, uint64(len(key)))
+			e.buf = append(e.buf, key...)
+			if err := e.encode(iter.Value(), depth+1); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		return e.encodeStruct(v, depth)
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, cborNull)
+			return nil
+		}
+		return e.encode(v.Elem(), depth+1)
+	default:
+		return fmt.Errorf("cbor: unsupported type %s", t)
+	}
+	return nil
+}
+
+func (e *cborEncoder) encodeInt(n int64) {
+	if n >= 0 {
+		e.buf = appendCBORHead(e.buf, cborUint, uint64(n))
+	} else {
+		e.buf = appendCBORHead(e.buf, cborNegInt, uint64(-1-n))
+	}
+}
+
+// encodeFloat writes whole numbers as integers, as JSON would print them,
+// and everything else as a float64. NaN and infinities are refused, as
+// encoding/json refuses them.
+func (e *cborEncoder) encodeFloat(f float64) error {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return fmt.Errorf("cbor: unsupported value %v", f)
+	}
+	if f == math.Trunc(f) && math.Abs(f) < 1<<53 && !(f == 0 && math.Signbit(f)) {
+		e.encodeInt(int64(f))
+		return nil
+	}
+	e.buf = binary.BigEndian.AppendUint64(append(e.buf, cborFloat64), math.Float64bits(f))
+	return nil
+}
+
+func (e *cborEncoder) encodeNumber(n json.Number) error {
+	if i, err := n.Int64(); err == nil {
+		e.encodeInt(i)
+		return nil
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return fmt.Errorf("cbor: invalid number %q", n)
+	}
+	return e.encodeFloat(f)
+}
+
+// encodeJSON converts a JSON value produced by a MarshalJSON method.
+func (e *cborEncoder) encodeJSON(data []byte, depth int) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		e.buf = append(e.buf, cborNull)
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return err
+	}
+	return e.encode(reflect.ValueOf(v), depth+1)
+}
+
+// encodeStruct counts the fields it will write in a first pass, since a
+// definite-length map needs the count up front.
+func (e *cborEncoder) encodeStruct(v reflect.Value, depth int) error {
+	fields := cachedFields(v.Type())
+	n := 0
+	for i := range fields.list {
+		if _, ok := fields.list[i].value(v); ok {
+			n++
+		}
+	}
+	e.buf = appendCBORHead(e.buf, cborMap, uint64(n))
+	for i := range fields.list {
+		f := &fields.list[i]
+		fv, ok := f.value(v)
+		if !ok {
+			continue
+		}
+		e.buf = appendCBORHead(e.buf, cborText, uint64(len(f.name)))
+		e.buf = append(e.buf, f.name...)
+		if err := e.encode(fv, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value returns the field of v to encode, if any.
+func (f *structField) value(v reflect.Value) (reflect.Value, bool) {
+	var fv reflect.Value
+	if len(f.index) == 1 {
+		fv = v.Field(f.index[0])
+	} else {
+		var err error
+		if fv, err = v.FieldByIndexErr(f.index); err != nil {
+			return fv, false
+		}
+	}
+	return fv, !(f.omitEmpty && isEmptyValue(fv))
+}
+
+func mapKey(k reflect.Value) (string, error) {
+	switch k.Kind() {
+	case reflect.String:
+		return k.String(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(k.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(k.Uint(), 10), nil
+	}
+	return "", fmt.Errorf("cbor: unsupported map key type %s", k.Type())
+}
+
+func isEmptyValue(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	case reflect.Interface, reflect.Pointer:
+		return v.IsNil()
+	}
+	return false
+}
+
+type structField struct {
+	name      string
+	index     []int
+	omitEmpty bool
+}
+
+type structFields struct {
+	list   []structField
+	byName map[string]int
+}
+
+var fieldCache sync.Map // reflect.Type -> *structFields
+
+// hooks records whether a type brings its own JSON encoding.
+type hooks struct {
+	marshaler   bool
+	unmarshaler bool // through a pointer
+}
+
+var hookCache sync.Map // reflect.Type -> hooks
+
+func typeHooks(t reflect.Type) hooks {
+	if h, ok := hookCache.Load(t); ok {
+		return h.(hooks)
+	}
+	h := hooks{
+		marshaler:   t.Implements(jsonMarshalerType),
+		unmarshaler: reflect.PointerTo(t).Implements(jsonUnmarshalerType),
+	}
+	hookCache.Store(t, h)
+	return h
+}
+
+func cachedFields(t reflect.Type) *structFields {
+	if f, ok := fieldCache.Load(t); ok {
+		return f.(*structFields)
+	}
+	fields := &structFields{byName: make(map[string]int)}
+	collectFields(t, nil, fields)
+	f, _ := fieldCache.LoadOrStore(t, fields)
+	return f.(*structFields)
+}
+
+// collectFields walks t like encoding/json: tagged names, "-" skipped,
+// untagged embedded structs flattened, outer fields winning.
+func collectFields(t reflect.Type, index []int, fields *structFields) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		idx := append(append([]int(nil), index...), i)
+		if sf.Anonymous && name == "" {
+			ft := sf.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				collectFields(ft, idx, fields)
+				continue
+			}
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		f := structField{name: name, index: idx, omitEmpty: strings.Contains(","+opts+",", ",omitempty,")}
+		if at, dup := fields.byName[name]; dup {
+			if len(fields.list[at].index) > len(idx) {
+				fields.list[at] = f
+			}
+			continue
+		}
+		fields.byName[name] = len(fields.list)
+		fields.list = append(fields.list, f)
+	}
+}
+
+// field finds the field for a map key, falling back to a case-insensitive
+// match as encoding/json does.
+func (fs *structFields) field(name []byte) (*structField, bool) {
+	if i, ok := fs.byName[string(name)]; ok {
+		return &fs.list[i], true
+	}
+	for i := range fs.list {
+		if f := &fs.list[i]; bytes.EqualFold([]byte(f.name), name) {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+type cborDecoder struct {
+	data []byte
+	off  int
+}
+
+// head reads an item's initial byte and argument. For indefinite lengths
+// info is cborIndefinite and n is zero.
+func (d *cborDecoder) head() (major, info byte, n uint64, err error) {
+	if d.off >= len(d.data) {
+		return 0, 0, 0, errCBORTruncated
+	}
+	b := d.data[d.off]
+	d.off++
+	major, info = b&0xe0, b&0x1f
+	var size int
+	switch {
+	case info < 24:
+		return major, info, uint64(info), nil
+	case info == 24:
+		size = 1
+	case info == 25:
+		size = 2
+	case info == 26:
+		size = 4
+	case info == 27:
+		size = 8
+	case info == cborIndefinite && major != cborUint && major != cborNegInt && major != cborTag:
+		return major, info, 0, nil
+	default:
+		return 0, 0, 0, fmt.Errorf("cbor: invalid initial byte 0x%02x", b)
+	}
+	if len(d.data)-d.off < size {
+		return 0, 0, 0, errCBORTruncated
+	}
+	p := d.data[d.off : d.off+size]
+	d.off += size
+	switch size {
+	case 1:
+		n = uint64(p[0])
+	case 2:
+		n = uint64(binary.BigEndian.Uint16(p))
+	case 4:
+		n = uint64(binary.BigEndian.Uint32(p))
+	default:
+		n = binary.BigEndian.Uint64(p)
+	}
+	return major, info, n, nil
+}
+
+// count checks that n items of at least one byte each can still follow.
+func (d *cborDecoder) count(n uint64) (int, error) {
+	if n > uint64(len(d.data)-d.off) {
+		return 0, errCBORTruncated
+	}
+	return int(n), nil
+}
+
+// str reads a byte or text string body, joining indefinite chunks.
+func (d *cborDecoder) str(major, info byte, n uint64) ([]byte, error) {
+	if info != cborIndefinite {
+		size, err := d.count(n)
+		if err != nil {
+			return nil, err
+		}
+		s := d.data[d.off : d.off+size]
+		d.off += size
+		return s, nil
+	}
+	var out []byte
+	for {
+		if d.off < len(d.data) && d.data[d.off] == cborBreak {
+			d.off++
+			return out, nil
+		}
+		m, i, n, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		if m != major || i == cborIndefinite {
+			return nil, errors.New("cbor: bad chunk in indefinite string")
+		}
+		chunk, err := d.str(m, i, n)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, chunk...)
+	}
+}
+
+// more reports whether another element of a container follows. Definite
+// containers count down remaining; indefinite ones end at a break.
+func (d *cborDecoder) more(indefinite bool, remaining *int) (bool, error) {
+	if !indefinite {
+		*remaining--
+		return *remaining >= 0, nil
+	}
+	if d.off >= len(d.data) {
+		return false, errCBORTruncated
+	}
+	if d.data[d.off] == cborBreak {
+		d.off++
+		return false, nil
+	}
+	return true, nil
+}
+
+func (d *cborDecoder) containerLen(info byte, n uint64, perItem uint64) (int, bool, error) {
+	if info == cborIndefinite {
+		return 0, true, nil
+	}
+	if n > math.MaxInt32 {
+		return 0, false, errCBORTruncated
+	}
+	size, err := d.count(n * perItem)
+	return size / int(perItem), false, err
+}
+
+func (d *cborDecoder) float(info byte, n uint64) float64 {
+	switch info {
+	case 25:
+		return halfToFloat(uint16(n))
+	case 26:
+		return float64(math.Float32frombits(uint32(n)))
+	}
+	return math.Float64frombits(n)
+}
+
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var f float64
+	switch exp {
+	case 0:
+		f = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			f = math.Inf(1)
+		} else {
+			f = math.NaN()
+		}
+	default:
+		f = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		f = -f
+	}
+	return f
+}
+
+// skip steps over one item.
+func (d *cborDecoder) skip(depth int) error {
+	if depth > cborMaxDepth {
+		return errCBORDepth
+	}
+	major, info, n, err := d.head()
+	if err != nil {
+		return err
+	}
+	switch major {
+	case cborBytes, cborText:
+		_, err = d.str(major, info, n)
+		return err
+	case cborArray, cborMap:
+		per := uint64(1)
+		if major == cborMap {
+			per = 2
+		}
+		remaining, indefinite, err := d.containerLen(info, n, per)
+		if err != nil {
+			return err
+		}
+		remaining *= int(per)
+		for {
+			ok, err := d.more(indefinite, &remaining)
+			if err != nil || !ok {
+				return err
+			}
+			if err := d.skip(depth + 1); err != nil {
+				return err
+			}
+		}
+	case cborTag:
+		return d.skip(depth + 1)
+	}
+	return nil
+}
+
+// value decodes one item the way encoding/json fills an interface{}:
+// numbers become float64, maps map[string]any. Byte strings stay []byte.
+func (d *cborDecoder) value(depth int) (any, error) {
+	if depth > cborMaxDepth {
+		return nil, errCBORDepth
+	}
+	major, info, n, err := d.head()
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case cborUint:
+		return float64(n), nil
+	case cborNegInt:
+		return -1 - float64(n), nil
+	case cborBytes:
+		b, err := d.str(major, info, n)
+		return append([]byte(nil), b...), err
+	case cborText:
+		b, err := d.str(major, info, n)
+		return string(b), err
+	case cborArray:
+		size, indefinite, err := d.containerLen(info, n, 1)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]any, 0, size)
+		for {
+			ok, err := d.more(indefinite, &size)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return out, nil
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+	case cborMap:
+		size, indefinite, err := d.containerLen(info, n, 2)
+		if err != nil {
+			return nil, err
+		}
+		out := make(map[string]any, size)
+		for {
+			ok, err := d.more(indefinite, &size)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return out, nil
+			}
+			k, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			v, err := d.value(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			key, ok := k.(string)
+			if !ok {
+				key = fmt.Sprint(k)
+			}
+			out[key] = v
+		}
+	case cborTag:
+		return d.value(depth + 1)
+	}
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25, 26, 27:
+		// JSON cannot carry NaN or infinities; JavaScript hubs send them
+		// as null.
+		if f := d.float(info, n); !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f, nil
+		}
+		return nil, nil
+	}
+	return nil, fmt.Errorf("cbor: unsupported simple value %d", n)
+}
+
+// decode fills v from one item.
+func (d *cborDecoder) decode(v reflect.Value, depth int) error {
+	if depth > cborMaxDepth {
+		return errCBORDepth
+	}
+	start := d.off
+	switch v.Type() {
+	case rawType:
+		if err := d.skip(depth); err != nil {
+			return err
+		}
+		v.SetBytes(append([]byte(nil), d.data[start:d.off]...))
+		return nil
+	case rawJSONType:
+		x, err := d.value(depth)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(x)
+		if err != nil {
+			return err
+		}
+		v.SetBytes(data)
+		return nil
+	}
+	if d.off < len(d.data) && (d.data[d.off] == cborNull || d.data[d.off] == cborUndefined) {
+		d.off++
+		switch v.Kind() {
+		case reflect.Pointer, reflect.Map, reflect.Slice, reflect.Interface:
+			v.Set(reflect.Zero(v.Type()))
+		}
+		return nil
+	}
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return d.decode(v.Elem(), depth+1)
+	}
+	if v.CanAddr() && typeHooks(v.Type()).unmarshaler {
+		x, err := d.value(depth)
+		if err != nil {
+			return err
+		}
+		data, err := json.Marshal(x)
+		if err != nil {
+			return err
+		}
+		return v.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(data)
+	}
+	if v.Kind() == reflect.Interface {
+		if v.NumMethod() != 0 {
+			return fmt.Errorf("cbor: cannot decode into %s", v.Type())
+		}
+		x, err := d.value(depth)
+		if err != nil {
+			return err
+		}
+		if x == nil {
+			v.Set(reflect.Zero(v.Type()))
+		} else {
+			v.Set(reflect.ValueOf(x))
+		}
+		return nil
+	}
+
+	major, info, n, err := d.head()
+	if err != nil {
+		return err
+	}
+	mismatch := func(what string) error {
+		return fmt.Errorf("cbor: cannot decode %s into %s", what, v.Type())
+	}
+	switch major {
+	case cborUint, cborNegInt:
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if n > math.MaxInt64 {
+				return mismatch("large integer")
+			}
+			i := int64(n)
+			if major == cborNegInt {
+				i = -1 - i
+			}
+			if v.OverflowInt(i) {
+				return mismatch("integer " + strconv.FormatInt(i, 10))
+			}
+			v.SetInt(i)
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			if major == cborNegInt || v.OverflowUint(n) {
+				return mismatch("integer")
+			}
+			v.SetUint(n)
+		case reflect.Float32, reflect.Float64:
+			f := float64(n)
+			if major == cborNegInt {
+				f = -1 - f
+			}
+			v.SetFloat(f)
+		default:
+			return mismatch("number")
+		}
+	case cborBytes:
+		b, err := d.str(major, info, n)
+		if err != nil {
+			return err
+		}
+		if v.Kind() != reflect.Slice || v.Type().Elem().Kind() != reflect.Uint8 {
+			return mismatch("byte string")
+		}
+		v.SetBytes(append([]byte(nil), b...))
+	case cborText:
+		b, err := d.str(major, info, n)
+		if err != nil {
+			return err
+		}
+		switch {
+		case v.Kind() == reflect.String:
+			v.SetString(string(b))
+		case v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8:
+			// like encoding/json, a string fills []byte as base64
+			raw, err := base64.StdEncoding.DecodeString(string(b))
+			if err != nil {
+				return err
+			}
+			v.SetBytes(raw)
+		default:
+			return mismatch("string")
+		}
+	case cborArray:
+		return d.decodeArray(v, info, n, depth)
+	case cborMap:
+		return d.decodeMap(v, info, n, depth)
+	case cborTag:
+		return d.decode(v, depth+1)
+	default:
+		switch info {
+		case 20, 21:
+			if v.Kind() != reflect.Bool {
+				return mismatch("bool")
+			}
+			v.SetBool(info == 21)
+		case 25, 26, 27:
+			f := d.float(info, n)
+			switch v.Kind() {
+			case reflect.Float32, reflect.Float64:
+				v.SetFloat(f)
+			case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+				if f != math.Trunc(f) || v.OverflowInt(int64(f)) {
+					return mismatch("number " + strconv.FormatFloat(f, 'g', -1, 64))
+				}
+				v.SetInt(int64(f))
+			default:
+				return mismatch("number")
+			}
+		default:
+			return mismatch("simple value")
+		}
+	}
+	return nil
+}
+
+func (d *cborDecoder) decodeArray(v reflect.Value, info byte, n uint64, depth int) error {
+	size, indefinite, err := d.containerLen(info, n, 1)
+	if err != nil {
+		return err
+	}
+	switch v.Kind() {
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), size, size))
+	case reflect.Array:
+	default:
+		return fmt.Errorf("cbor: cannot decode array into %s", v.Type())
+	}
+	for i := 0; ; i++ {
+		ok, err := d.more(indefinite, &size)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		switch {
+		case v.Kind() == reflect.Slice:
+			if indefinite {
+				v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+			}
+			err = d.decode(v.Index(i), depth+1)
+		case i < v.Len():
+			err = d.decode(v.Index(i), depth+1)
+		default:
+			err = d.skip(depth + 1)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *cborDecoder) decodeMap(v reflect.Value, info byte, n uint64, depth int) error {
+	size, indefinite, err := d.containerLen(info, n, 2)
+	if err != nil {
+		return err
+	}
+	var fields *structFields
+	switch v.Kind() {
+	case reflect.Struct:
+		fields = cachedFields(v.Type())
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(v.Type(), size))
+		}
+	default:
+		return fmt.Errorf("cbor: cannot decode map into %s", v.Type())
+	}
+	for {
+		ok, err := d.more(indefinite, &size)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		key, err := d.key(depth + 1)
+		if err != nil {
+			return err
+		}
+		if fields != nil {
+			f, found := fields.field(key)
+			if !found {
+				if err := d.skip(depth + 1); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(fieldForSet(v, f.index), depth+1); err != nil {
+				return err
+			}
+			continue
+		}
+		kv, err := mapKeyValue(v.Type().Key(), string(key))
+		if err != nil {
+			return err
+		}
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := d.decode(elem, depth+1); err != nil {
+			return err
+		}
+		v.SetMapIndex(kv, elem)
+	}
+}
+
+// key reads a map key. Text keys come back without copying; anything else
+// is printed the way value would decode it.
+func (d *cborDecoder) key(depth int) ([]byte, error) {
+	if d.off < len(d.data) && d.data[d.off]&0xe0 == cborText {
+		major, info, n, err := d.head()
+		if err != nil {
+			return nil, err
+		}
+		return d.str(major, info, n)
+	}
+	k, err := d.value(depth)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(fmt.Sprint(k)), nil
+}
+
+func mapKeyValue(t reflect.Type, key string) (reflect.Value, error) {
+	kv := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.String:
+		kv.SetString(key)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(key, 10, 64)
+		if err != nil || kv.OverflowInt(i) {
+			return kv, fmt.Errorf("cbor: invalid map key %q for %s", key, t)
+		}
+		kv.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(key, 10, 64)
+		if err != nil || kv.OverflowUint(u) {
+			return kv, fmt.Errorf("cbor: invalid map key %q for %s", key, t)
+		}
+		kv.SetUint(u)
+	default:
+		return kv, fmt.Errorf("cbor: unsupported map key type %s", t)
+	}
+	return kv, nil
+}
+
+// fieldForSet walks index from v, allocating nil embedded pointers.
+func fieldForSet(v reflect.Value, index []int) reflect.Value {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v
+}
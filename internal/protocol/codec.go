@@ -0,0 +1,46 @@
+package protocol
+
+import "encoding/json"
+
+// Codec names listed in a hello's "codecs". JSON is always understood;
+// others are switched to by the framing request and only travel in
+// length-prefixed frames, since their bytes may contain newlines.
+const (
+	CodecJSON = "json"
+	CodecCBOR = "cbor"
+)
+
+// Codec encodes the messages on the socket.
+type Codec interface {
+	Name() string
+	Marshal(v any) ([]byte, error)
+	Unmarshal(data []byte, v any) error
+}
+
+var (
+	JSON Codec = jsonCodec{}
+	CBOR Codec = cborCodec{}
+)
+
+// CodecByName returns the codec called name; "" is JSON.
+func CodecByName(name string) (Codec, bool) {
+	switch name {
+	case "", CodecJSON:
+		return JSON, true
+	case CodecCBOR:
+		return CBOR, true
+	}
+	return nil, false
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string                       { return CodecJSON }
+func (jsonCodec) Marshal(v any) ([]byte, error)      { return json.Marshal(v) }
+func (jsonCodec) Unmarshal(data []byte, v any) error { return json.Unmarshal(data, v) }
+
+type cborCodec struct{}
+
+func (cborCodec) Name() string                       { return CodecCBOR }
+func (cborCodec) Marshal(v any) ([]byte, error)      { return MarshalCBOR(v) }
+func (cborCodec) Unmarshal(data []byte, v any) error { return UnmarshalCBOR(data, v) }
@@ -0,0 +1,148 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// benchStatus mirrors the status push a hub sends every few seconds.
+type benchStatus struct {
+	Host       string           `json:"host"`
+	Connected  bool             `json:"connected"`
+	Timestamp  string           `json:"timestamp"`
+	Peers      []map[string]any `json:"peers"`
+	NowPlaying []benchPlaying   `json:"nowPlaying"`
+}
+
+type benchPlaying struct {
+	Peer     string  `json:"peer"`
+	Filename string  `json:"filename"`
+	Position float64 `json:"position"`
+	Duration float64 `json:"duration"`
+	State    string  `json:"state"`
+	Self     bool    `json:"self,omitempty"`
+}
+
+// benchFile is one entry of a large file listing.
+type benchFile struct {
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	Modified string `json:"modified,omitempty"`
+	Dir      bool   `json:"dir,omitempty"`
+}
+
+func benchPayloads() map[string]any {
+	status := benchStatus{Host: "studio-pi", Connected: true, Timestamp: "2026-10-17T09:30:00Z"}
+	for i := 0; i < 8; i++ {
+		status.Peers = append(status.Peers, map[string]any{"id": fmt.Sprintf("peer-%d", i), "joinedAt": "2026-10-17T08:00:00Z", "vector": []any{0.12, 0.5, 0.93}})
+		status.NowPlaying = append(status.NowPlaying, benchPlaying{Peer: fmt.Sprintf("peer-%d", i), Filename: "jingles/morning show intro.mp3", Position: 12.75, Duration: 31.5, State: "playing"})
+	}
+	var files struct {
+		Files []benchFile `json:"files"`
+	}
+	for i := 0; i < 2000; i++ {
+		files.Files = append(files.Files, benchFile{Name: fmt.Sprintf("library/artist %d/track %04d.flac", i%50, i), Size: int64(3_000_000 + i*1733), Modified: "2026-09-01T12:00:00Z"})
+	}
+	return map[string]any{"status": status, "files": files}
+}
+
+func BenchmarkCodecs(b *testing.B) {
+	for name, payload := range benchPayloads() {
+		for _, codec := range []Codec{JSON, CBOR} {
+			encoded, err := codec.Marshal(payload)
+			if err != nil {
+				b.Fatal(err)
+			}
+			target := reflect.TypeOf(payload)
+			decoded := reflect.New(target)
+			if err := codec.Unmarshal(encoded, decoded.Interface()); err != nil {
+				b.Fatal(err)
+			}
+			if !reflect.DeepEqual(decoded.Elem().Interface(), payload) {
+				b.Fatalf("%s/%s: round trip changed the value", name, codec.Name())
+			}
+
+			b.Run(name+"/"+codec.Name()+"/marshal", func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(encoded)))
+				for i := 0; i < b.N; i++ {
+					if _, err := codec.Marshal(payload); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run(name+"/"+codec.Name()+"/unmarshal", func(b *testing.B) {
+				b.ReportAllocs()
+				b.SetBytes(int64(len(encoded)))
+				for i := 0; i < b.N; i++ {
+					if err := codec.Unmarshal(encoded, reflect.New(target).Interface()); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// FuzzUnmarshalCBOR decodes arbitrary bytes as a hub message would be; a
+// malformed or hostile frame must be an error, not a panic or a huge
+// allocation.
+func FuzzUnmarshalCBOR(f *testing.F) {
+	encoded, err := MarshalCBOR(benchPayloads()["status"])
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(encoded)
+	for _, seed := range []string{"bf61610161629f0203ffff", "f93c00", "9b00000000ffffffff", "d8185f4101ff", "7f6161ff"} {
+		encoded, _ := hex.DecodeString(seed)
+		f.Add(encoded)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v any
+		if err := UnmarshalCBOR(data, &v); err != nil {
+			return
+		}
+		if _, err := CBORToJSON(data); err != nil {
+			t.Fatalf("decoded as %T but CBORToJSON failed: %v", v, err)
+		}
+		var status benchStatus
+		_ = UnmarshalCBOR(data, &status)
+	})
+}
+
+// FuzzFrameReader splits arbitrary streams in both framings; every message
+// it returns must fit the limit.
+func FuzzFrameReader(f *testing.F) {
+	f.Add([]byte("{\"type\":\"event\"}\n\n{}\n"), false)
+	f.Add(AppendFrame(nil, []byte(`{"id":"1"}`)), true)
+	f.Add(AppendBinaryFrame(nil, []byte(`{"binary":"base64"}`), []byte{1, 2, 3}), true)
+	f.Add([]byte{0x80, 0, 0, 2, 0, 0}, true)
+	f.Fuzz(func(t *testing.T, stream []byte, prefixed bool) {
+		const limit = 1 << 10
+		frames := NewFrameReader(bytes.NewReader(stream), limit)
+		if prefixed {
+			frames.SetLengthPrefixed()
+		}
+		total := 0
+		for {
+			frame, wire, err := frames.Next()
+			total += wire
+			if total > len(stream) {
+				t.Fatalf("read %d bytes from a %d byte stream", total, len(stream))
+			}
+			if errors.Is(err, ErrFrameTooLarge) || errors.Is(err, ErrBadFrame) {
+				continue
+			}
+			if err != nil {
+				return
+			}
+			if len(frame.Body)+len(frame.Data) > limit {
+				t.Fatalf("frame of %d bytes over the %d limit", len(frame.Body)+len(frame.Data), limit)
+			}
+		}
+	})
+}
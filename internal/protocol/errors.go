@@ -0,0 +1,153 @@
+// Package protocol holds the wire-level definitions shared by everything
+// that talks to the hub socket.
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Code is a machine-readable error class sent by the hub.
+type Code string
+
+const (
+	CodeNotFound     Code = "not-found"
+	CodeUnauthorized Code = "unauthorized"
+	CodeTooLarge     Code = "too-large"
+	CodeBusy         Code = "busy"
+	CodeInvalid      Code = "invalid"
+	CodeInternal     Code = "internal"
+	// CodeQuotaExceeded means storing the upload would take the hub past
+	// its storage quota.
+	CodeQuotaExceeded Code = "quota-exceeded"
+	// CodeForbidden means the client's role does not allow the action.
+	CodeForbidden Code = "forbidden"
+)
+
+// Sentinel errors matched by errors.Is against an *Error of the same code.
+var (
+	ErrNotFound      = errors.New("not found")
+	ErrUnauthorized  = errors.New("unauthorized")
+	ErrTooLarge      = errors.New("too large")
+	ErrBusy          = errors.New("busy")
+	ErrInvalid       = errors.New("invalid request")
+	ErrInternal      = errors.New("internal hub error")
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+	ErrForbidden     = errors.New("permission denied")
+)
+
+var codeErrors = map[Code]error{
+	CodeNotFound:      ErrNotFound,
+	CodeUnauthorized:  ErrUnauthorized,
+	CodeTooLarge:      ErrTooLarge,
+	CodeBusy:          ErrBusy,
+	CodeInvalid:       ErrInvalid,
+	CodeInternal:      ErrInternal,
+	CodeQuotaExceeded: ErrQuotaExceeded,
+	CodeForbidden:     ErrForbidden,
+}
+
+// Error is the error member of a response. Older hubs send a bare string,
+// which decodes into Message with no Code.
+//
+//	"error": {"code": "busy", "message": "library is being rescanned", "retryAfter": 5}
+type Error struct {
+	Code    Code   `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+	// RetryAfter is a hint in seconds for busy errors.
+	RetryAfter float64 `json:"retryAfter,omitempty"`
+}
+
+func (e *Error) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '"' {
+		*e = Error{}
+		return json.Unmarshal(data, &e.Message)
+	}
+	type envelope Error
+	return json.Unmarshal(data, (*envelope)(e))
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Message != "":
+		return e.Message
+	case e.Code != "":
+		return string(e.Code)
+	default:
+		return "request failed"
+	}
+}
+
+// Is lets errors.Is(err, ErrBusy) and friends match on the code.
+func (e *Error) Is(target error) bool {
+	sentinel, ok := codeErrors[e.Code]
+	return ok && sentinel == target
+}
+
+// Retryable reports whether repeating the request may succeed. Errors
+// without a code are assumed retryable, as they were before codes existed;
+// a response that failed its schema will fail it again.
+func Retryable(err error) bool {
+	var schemaErr *SchemaError
+	if errors.As(err, &schemaErr) {
+		return false
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		return true
+	}
+	switch e.Code {
+	case CodeNotFound, CodeUnauthorized, CodeTooLarge, CodeInvalid, CodeQuotaExceeded, CodeForbidden:
+		return false
+	}
+	return true
+}
+
+// RetryDelay returns the hub's retry hint, or zero.
+func RetryDelay(err error) time.Duration {
+	var e *Error
+	if !errors.As(err, &e) || e.RetryAfter <= 0 {
+		return 0
+	}
+	return time.Duration(e.RetryAfter * float64(time.Second))
+}
+
+// Friendly turns a coded error into a sentence for people; uncoded errors
+// keep their message.
+func Friendly(err error) string {
+	var e *Error
+	if !errors.As(err, &e) {
+		return err.Error()
+	}
+	var text string
+	switch e.Code {
+	case CodeNotFound:
+		text = "The hub could not find it"
+	case CodeUnauthorized:
+		text = "This client is not allowed to do that"
+	case CodeTooLarge:
+		text = "That is larger than the hub accepts"
+	case CodeBusy:
+		text = "The hub is busy"
+		if d := RetryDelay(err); d > 0 {
+			text += ", try again in " + d.Round(time.Second).String()
+		}
+	case CodeInvalid:
+		text = "The hub rejected the request as invalid"
+	case CodeInternal:
+		text = "The hub hit an internal error"
+	case CodeQuotaExceeded:
+		text = "That would go over the hub's storage quota"
+	case CodeForbidden:
+		text = "Your role on this hub does not allow that"
+	default:
+		return err.Error()
+	}
+	if e.Message != "" {
+		text += " (" + e.Message + ")"
+	}
+	return text
+}
@@ -0,0 +1,40 @@
+package protocol
+
+// Event names carried in the "event" member of event messages.
+const (
+	EventHello             = "hello"
+	EventStatus            = "status"
+	EventHubMessage        = "hub-message"
+	EventBroadcastPlay     = "broadcast-play"
+	EventNowPlaying        = "now-playing"
+	EventLog               = "log"
+	EventError             = "error"
+	EventPeerFilesRequest  = "peer-files-request"
+	EventPeerUploadRequest = "peer-upload-request"
+	EventAudioStream       = "audio-stream"
+	EventTransferOffer     = "transfer-offer"
+	EventTransferAnswer    = "transfer-answer"
+	EventTransferCancel    = "transfer-cancel"
+	EventClipboard         = "clipboard"
+	EventKV                = "kv"
+	EventChat              = "chat"
+	EventChatTyping        = "chat-typing"
+	EventBroadcastImage    = "broadcast-image"
+	EventCommandOutput     = "command-output"
+	EventCommandDone       = "command-done"
+	EventPeerControl       = "peer-control"
+	EventPeerConfig        = "peer-config"
+	EventZone              = "zone"
+	EventBroadcastStop     = "broadcast-stop"
+)
+
+// RelayEvents are requests from other peers that this client is expected
+// to answer; a client serving a shared folder or accepting transfers must
+// keep them in any subscription.
+var RelayEvents = []string{
+	EventPeerFilesRequest,
+	EventPeerUploadRequest,
+	EventTransferOffer,
+	EventTransferAnswer,
+	EventTransferCancel,
+}
@@ -0,0 +1,157 @@
+package protocol
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// FramingLengthPrefixed is listed in a hello's "protocols" by hubs that
+// accept a "framing" request switching the socket to length-prefixed
+// frames: a 4-byte big-endian length followed by that many bytes of message.
+// Newline-delimited JSON stays the default and needs no negotiation.
+const FramingLengthPrefixed = "length-prefixed"
+
+// MaxFrameSize bounds a single message in either framing.
+const MaxFrameSize = 64 << 20
+
+// binaryFlag marks a length prefix as a binary frame: a 4-byte header
+// length, the header message and then raw bytes. Hubs that accept them list
+// CapBinaryFrames; they only exist in length-prefixed framing.
+const binaryFlag = 1 << 31
+
+// BinaryField in a binary frame's header names the member the raw bytes
+// stand for, which in JSON would carry them base64-encoded.
+const BinaryField = "binary"
+
+var (
+	// ErrFrameTooLarge is returned for a message over the reader's limit.
+	// The message is skipped, so the stream stays in sync and reading can
+	// go on.
+	ErrFrameTooLarge = errors.New("frame too large")
+	// ErrBadFrame is a binary frame whose header length does not fit; it
+	// is skipped like an oversized one.
+	ErrBadFrame = errors.New("malformed binary frame")
+)
+
+// Frame is one message off the socket, encoded with the connection's
+// codec. Data holds the raw bytes of a binary frame and is nil otherwise.
+type Frame struct {
+	Body []byte
+	Data []byte
+}
+
+// AppendLine frames msg as one newline-terminated line.
+func AppendLine(dst, msg []byte) []byte {
+	return append(append(dst, msg...), '\n')
+}
+
+// AppendFrame frames msg with its length prefix.
+func AppendFrame(dst, msg []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(msg)))
+	return append(dst, msg...)
+}
+
+// AppendBinaryFrame frames header followed by raw data.
+func AppendBinaryFrame(dst, header, data []byte) []byte {
+	dst = binary.BigEndian.AppendUint32(dst, uint32(4+len(header)+len(data))|binaryFlag)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(len(header)))
+	dst = append(dst, header...)
+	return append(dst, data...)
+}
+
+// FrameReader splits a socket stream into messages. It starts in newline
+// framing; SetLengthPrefixed switches it from the next message on. It is
+// not safe for concurrent use.
+type FrameReader struct {
+	r        *bufio.Reader
+	max      int
+	prefixed bool
+}
+
+// NewFrameReader reads messages of up to max bytes from r; max <= 0 means
+// MaxFrameSize.
+func NewFrameReader(r io.Reader, max int) *FrameReader {
+	if max <= 0 {
+		max = MaxFrameSize
+	}
+	return &FrameReader{r: bufio.NewReaderSize(r, 64*1024), max: max}
+}
+
+// SetLengthPrefixed switches to length-prefixed frames.
+func (f *FrameReader) SetLengthPrefixed() { f.prefixed = true }
+
+// LengthPrefixed reports the current framing.
+func (f *FrameReader) LengthPrefixed() bool { return f.prefixed }
+
+// Next returns the next message and how many bytes it took on the wire,
+// framing included.
+func (f *FrameReader) Next() (Frame, int, error) {
+	if f.prefixed {
+		return f.nextFrame()
+	}
+	line, wire, err := f.nextLine()
+	return Frame{Body: line}, wire, err
+}
+
+func (f *FrameReader) nextFrame() (Frame, int, error) {
+	var prefix [4]byte
+	if _, err := io.ReadFull(f.r, prefix[:]); err != nil {
+		return Frame{}, 0, err
+	}
+	word := binary.BigEndian.Uint32(prefix[:])
+	n := int64(word &^ binaryFlag)
+	if n > int64(f.max) {
+		skipped, err := io.CopyN(io.Discard, f.r, n)
+		if err != nil {
+			return Frame{}, 4 + int(skipped), err
+		}
+		return Frame{}, 4 + int(n), fmt.Errorf("%w: %d bytes", ErrFrameTooLarge, n)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(f.r, msg); err != nil {
+		return Frame{}, 4, err
+	}
+	wire := 4 + int(n)
+	if word&binaryFlag == 0 {
+		return Frame{Body: msg}, wire, nil
+	}
+	if n < 4 {
+		return Frame{}, wire, ErrBadFrame
+	}
+	headerLen := int64(binary.BigEndian.Uint32(msg))
+	if headerLen > n-4 {
+		return Frame{}, wire, fmt.Errorf("%w: header of %d bytes in %d", ErrBadFrame, headerLen, n)
+	}
+	return Frame{Body: msg[4 : 4+headerLen], Data: msg[4+headerLen:]}, wire, nil
+}
+
+// nextLine reads up to the next newline. An overlong line is discarded
+// through its newline rather than cutting the stream short.
+func (f *FrameReader) nextLine() ([]byte, int, error) {
+	var line []byte
+	wire := 0
+	tooLarge := false
+	for {
+		chunk, err := f.r.ReadSlice('\n')
+		wire += len(chunk)
+		if !tooLarge {
+			if len(line)+len(chunk) > f.max+1 {
+				tooLarge, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		switch {
+		case err == bufio.ErrBufferFull:
+			continue
+		case err != nil:
+			return nil, wire, err
+		case tooLarge:
+			return nil, wire, fmt.Errorf("%w: line over %d bytes", ErrFrameTooLarge, f.max)
+		}
+		return line[:len(line)-1], wire, nil
+	}
+}
@@ -0,0 +1,76 @@
+package protocol
+
+import "strings"
+
+// Role is what the hub lets a client do, sent in its hello. Hubs that
+// predate roles send none, which counts as RoleAdmin.
+type Role string
+
+const (
+	// RoleReadOnly may look but not act: status, files, storage, logs
+	// and the like, and read-only console commands.
+	RoleReadOnly Role = "read-only"
+	// RoleOperator may also play, broadcast, upload and tag.
+	RoleOperator Role = "operator"
+	// RoleAdmin may also delete files and restart or update peers.
+	RoleAdmin Role = "admin"
+)
+
+// readActions change nothing, so every role may send them. "command",
+// "command-start" and "tags" are here because the hub decides per
+// command, and reading tags is allowed while setting them is not.
+var readActions = map[string]bool{
+	"status": true, "files": true, "storage": true, "broadcast-plan": true,
+	"framing": true, "bye": true, "command": true, "tags": true, "audit": true,
+	"kv-get": true, "kv-watch": true, "chat-history": true,
+	"command-start": true, "command-cancel": true, "jobs": true,
+	"peer-ping": true, "peer-config": true, "zones": true,
+	"clock": true, "stats": true, "trash": true, "peer-files": true, "peer-files-response": true,
+	"subscribe": true, "logs": true,
+}
+
+// adminActions need RoleAdmin.
+var adminActions = map[string]bool{
+	"delete": true, "move": true, "restore": true, "purge": true,
+	"peer-restart": true, "peer-update": true,
+}
+
+// Allows reports whether the role may send action.
+func (r Role) Allows(action string) bool {
+	switch {
+	case r == "" || r == RoleAdmin:
+		return true
+	case readActions[action]:
+		return true
+	case adminActions[action]:
+		return false
+	}
+	return r == RoleOperator
+}
+
+// readCommands are the console commands a read-only client may run;
+// "audio" is read-only only with one of readAudioCommands.
+var (
+	readCommands = map[string]bool{
+		"help": true, "peers": true, "whoami": true, "get": true,
+		"keys": true, "ttl": true, "audit": true, "stats": true,
+	}
+	readAudioCommands = map[string]bool{"list": true, "get": true, "usage": true}
+)
+
+// ReadOnlyCommand reports whether a console command only reads.
+func ReadOnlyCommand(command string) bool {
+	fields := strings.Fields(strings.ToLower(command))
+	if len(fields) == 0 {
+		return false
+	}
+	if fields[0] == "audio" {
+		return len(fields) > 1 && readAudioCommands[fields[1]]
+	}
+	return readCommands[fields[0]]
+}
+
+// Known reports whether r is one of the roles above.
+func (r Role) Known() bool {
+	return r == RoleReadOnly || r == RoleOperator || r == RoleAdmin
+}
@@ -0,0 +1,196 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Kind is the JSON type a schema expects.
+type Kind uint8
+
+const (
+	KindAny Kind = iota
+	KindString
+	KindNumber
+	// KindInteger is a number without a fractional part.
+	KindInteger
+	KindBool
+	KindObject
+	KindArray
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindString:
+		return "string"
+	case KindNumber:
+		return "number"
+	case KindInteger:
+		return "integer"
+	case KindBool:
+		return "bool"
+	case KindObject:
+		return "object"
+	case KindArray:
+		return "array"
+	}
+	return "any value"
+}
+
+// Schema is the expected shape of a response's data or an event's
+// payload. Members an object schema does not list are allowed, so hubs can
+// add fields without breaking older clients; listed ones must have the
+// right type, and required ones must be present and not null.
+type Schema struct {
+	Kind   Kind
+	Fields []Field
+	// Items is the schema of every array element.
+	Items *Schema
+	// OneOf lists alternatives for values hubs send in more than one
+	// shape; Kind is ignored when it is set.
+	OneOf []*Schema
+}
+
+// Field is one member of an object schema.
+type Field struct {
+	Name     string
+	Required bool
+	Schema   *Schema
+}
+
+// Violation is one place a value does not match its schema. Path starts at
+// "$", the value itself.
+type Violation struct {
+	Path    string `json:"path"`
+	Problem string `json:"problem"`
+}
+
+func (v Violation) String() string {
+	return v.Path + ": " + v.Problem
+}
+
+// maxViolations bounds the report for one message; a wrong element type in
+// a long listing would otherwise repeat the same problem thousands of
+// times.
+const maxViolations = 20
+
+// Validate checks v, as decoded into an interface{} by either codec,
+// against s and returns what does not match.
+func (s *Schema) Validate(v any) []Violation {
+	var out []Violation
+	s.check(v, "$", &out)
+	return out
+}
+
+func (s *Schema) check(v any, path string, out *[]Violation) {
+	if s == nil || len(*out) >= maxViolations {
+		return
+	}
+	if len(s.OneOf) > 0 {
+		var first []Violation
+		for i, alt := range s.OneOf {
+			var got []Violation
+			alt.check(v, path, &got)
+			if len(got) == 0 {
+				return
+			}
+			if i == 0 {
+				first = got
+			}
+		}
+		*out = append(*out, first...)
+		return
+	}
+	report := func(problem string) {
+		*out = append(*out, Violation{Path: path, Problem: problem})
+	}
+	switch s.Kind {
+	case KindAny:
+	case KindString:
+		switch v.(type) {
+		case string, []byte:
+		default:
+			report("expected string, got " + describe(v))
+		}
+	case KindNumber, KindInteger:
+		f, ok := v.(float64)
+		switch {
+		case !ok:
+			report("expected " + s.Kind.String() + ", got " + describe(v))
+		case s.Kind == KindInteger && (f != math.Trunc(f) || math.IsInf(f, 0)):
+			report("expected integer, got " + strconv.FormatFloat(f, 'g', -1, 64))
+		}
+	case KindBool:
+		if _, ok := v.(bool); !ok {
+			report("expected bool, got " + describe(v))
+		}
+	case KindArray:
+		items, ok := v.([]any)
+		if !ok {
+			report("expected array, got " + describe(v))
+			return
+		}
+		for i, item := range items {
+			s.Items.check(item, path+"["+strconv.Itoa(i)+"]", out)
+		}
+	case KindObject:
+		members, ok := v.(map[string]any)
+		if !ok {
+			report("expected object, got " + describe(v))
+			return
+		}
+		for _, f := range s.Fields {
+			value, present := members[f.Name]
+			if !present || value == nil {
+				if f.Required {
+					*out = append(*out, Violation{Path: path + "." + f.Name, Problem: "required member missing"})
+				}
+				continue
+			}
+			f.Schema.check(value, path+"."+f.Name, out)
+		}
+	}
+}
+
+func describe(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string, []byte:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// SchemaError is a hub message that did not match the schema for its
+// action or event.
+type SchemaError struct {
+	// Kind is "response" or "event".
+	Kind       string      `json:"kind"`
+	Name       string      `json:"name"`
+	Violations []Violation `json:"violations"`
+	// Rejected is set when the message was refused rather than used
+	// anyway.
+	Rejected bool `json:"rejected"`
+}
+
+func (e *SchemaError) Error() string {
+	msg := fmt.Sprintf("%s %s does not match its schema", e.Name, e.Kind)
+	if len(e.Violations) == 0 {
+		return msg
+	}
+	msg += ": " + e.Violations[0].String()
+	if n := len(e.Violations) - 1; n > 0 {
+		msg += fmt.Sprintf(" (and %d more)", n)
+	}
+	return msg
+}
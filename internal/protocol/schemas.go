@@ -0,0 +1,185 @@
+package protocol
+
+func req(name string, s *Schema) Field { return Field{Name: name, Required: true, Schema: s} }
+func opt(name string, s *Schema) Field { return Field{Name: name, Schema: s} }
+
+func object(fields ...Field) *Schema { return &Schema{Kind: KindObject, Fields: fields} }
+func arrayOf(items *Schema) *Schema  { return &Schema{Kind: KindArray, Items: items} }
+func oneOf(alts ...*Schema) *Schema  { return &Schema{OneOf: alts} }
+
+var (
+	anyValue = &Schema{Kind: KindAny}
+	str      = &Schema{Kind: KindString}
+	num      = &Schema{Kind: KindNumber}
+	integer  = &Schema{Kind: KindInteger}
+	boolean  = &Schema{Kind: KindBool}
+)
+
+var (
+	nowPlayingSchema = object(
+		req("peer", str), req("filename", str),
+		opt("position", num), opt("duration", num), opt("state", str),
+		opt("triggeredBy", str), opt("self", boolean), opt("volume", integer), opt("loop", boolean),
+	)
+	statusSchema = object(
+		req("host", str), opt("connected", boolean), opt("timestamp", str),
+		opt("whoami", anyValue), opt("audioList", anyValue), opt("peers", anyValue),
+		opt("nowPlaying", arrayOf(nowPlayingSchema)),
+	)
+	logEntrySchema = object(opt("time", str), opt("level", str), req("message", str), opt("source", str))
+	uploadSchema   = object(
+		req("filename", str), opt("size", integer), opt("contentType", str),
+		opt("expiresAt", str), opt("deleteOnDisconnect", boolean), opt("sha256", str),
+	)
+	progressSchema = object(req("uploadId", str), req("offset", integer))
+	auditSchema    = object(req("time", str), req("actor", str), req("action", str), opt("target", str))
+	planSchema     = object(
+		req("action", str), opt("filename", str), opt("zone", str),
+		req("recipients", arrayOf(object(req("id", str), opt("name", str), opt("self", boolean)))),
+	)
+	kvSchema = object(
+		req("key", str), opt("value", str), opt("by", str), opt("updatedAt", str),
+		opt("expiresAt", str), opt("deleted", boolean),
+	)
+	chatSchema = object(req("id", str), req("channel", str), req("from", str), req("text", str), req("time", str))
+	jobSchema  = object(
+		req("id", str), req("kind", str), req("title", str), req("state", str),
+		opt("priority", integer), opt("owner", str), opt("createdAt", str), opt("progress", num),
+	)
+	peerConfigSchema = object(req("peer", str), opt("volume", integer), opt("updatedBy", str), opt("updatedAt", str))
+	zoneSchema       = object(req("name", str), req("peers", arrayOf(str)), opt("updatedBy", str), opt("updatedAt", str))
+	// older hubs list bare names
+	hubFileSchema = oneOf(str, object(
+		req("name", str), opt("size", integer), opt("modified", str), opt("contentType", str),
+		opt("loudness", num), opt("replayGain", num),
+	))
+	trashedFileSchema = object(
+		req("name", str), opt("size", integer), opt("contentType", str),
+		req("deletedAt", str), opt("deletedBy", str),
+	)
+	// acknowledgements, whose data the client does not read
+	ack = anyValue
+)
+
+// ResponseSchemas describes the data of successful responses, by action.
+// Actions missing here are not checked.
+var ResponseSchemas = map[string]*Schema{
+	"status":          statusSchema,
+	"files":           object(req("files", arrayOf(hubFileSchema))),
+	"delete":          object(opt("deleted", str), opt("trashed", boolean)),
+	"move":            object(req("filename", str), req("to", str)),
+	"storage":         object(req("used", integer), opt("total", integer), opt("quota", integer), opt("files", integer)),
+	"command":         object(opt("result", anyValue)),
+	"play":            object(opt("played", str), opt("info", anyValue)),
+	"broadcast":       ack,
+	"broadcast-play":  ack,
+	"broadcast-stop":  object(req("recipients", integer)),
+	"broadcast-plan":  planSchema,
+	"audit":           object(req("entries", arrayOf(auditSchema))),
+	"clipboard":       object(req("recipients", integer)),
+	"kv-set":          object(req("entry", kvSchema)),
+	"kv-get":          object(req("entries", arrayOf(kvSchema))),
+	"kv-watch":        object(req("entries", arrayOf(kvSchema))),
+	"chat":            object(req("message", chatSchema)),
+	"chat-history":    object(req("messages", arrayOf(chatSchema))),
+	"chat-typing":     ack,
+	"broadcast-image": object(req("recipients", integer)),
+	"command-start":   object(req("id", str)),
+	"command-cancel":  object(req("cancelled", boolean)),
+	"jobs":            object(req("jobs", arrayOf(jobSchema))),
+	"job-cancel":      object(req("cancelled", boolean)),
+	"job-priority":    object(req("job", jobSchema)),
+	"peer-ping": object(
+		req("peer", str), opt("from", str), req("reachable", boolean),
+		opt("latencyMs", num), opt("error", str),
+	),
+	"peer-restart":    object(req("operationId", str)),
+	"peer-update":     object(req("operationId", str)),
+	"peer-config":     object(req("configs", arrayOf(peerConfigSchema))),
+	"peer-config-set": object(req("config", peerConfigSchema)),
+	"zones":           object(req("zones", arrayOf(zoneSchema))),
+	// times are milliseconds since the epoch, for sub-second offsets
+	"clock":         object(req("nowMs", num), opt("offsetMs", num), opt("rttMs", num)),
+	"zone-set":      object(req("zone", zoneSchema)),
+	"zone-delete":   object(req("deleted", boolean)),
+	"stats":         object(req("files", arrayOf(object(req("name", str), req("plays", integer), opt("lastPlayed", str))))),
+	"trash":         object(req("files", arrayOf(trashedFileSchema))),
+	"restore":       object(req("restored", str)),
+	"purge":         object(req("purged", integer)),
+	"bye":           ack,
+	"upload":        uploadSchema,
+	"upload-begin":  progressSchema,
+	"upload-chunk":  progressSchema,
+	"upload-resume": progressSchema,
+	"upload-commit": uploadSchema,
+	"upload-cancel": ack,
+	"hash":          object(req("filename", str), req("sha256", str), opt("size", integer)),
+	"peer-files": object(
+		opt("peer", str), opt("path", str),
+		req("files", arrayOf(object(req("name", str), opt("size", integer), opt("modified", str), opt("dir", boolean)))),
+	),
+	"peer-upload":     ack,
+	"subscribe":       object(opt("events", arrayOf(str)), opt("statusIntervalSeconds", num)),
+	"logs":            object(req("lines", arrayOf(logEntrySchema))),
+	"framing":         object(req("mode", str), opt("codec", str)),
+	"volume":          ack,
+	"pause":           ack,
+	"resume":          ack,
+	"stop":            ack,
+	"seek":            ack,
+	"transfer-offer":  object(req("transferId", str)),
+	"transfer-answer": ack,
+	"transfer-cancel": ack,
+	// file name to tag list; map values are not described
+	"tags": object(req("tags", object())),
+}
+
+// EventSchemas describes event payloads, by event name.
+var EventSchemas = map[string]*Schema{
+	EventHello: object(
+		req("host", str), opt("connectedAt", str), opt("version", integer),
+		opt("capabilities", arrayOf(str)), opt("protocols", arrayOf(str)), opt("codecs", arrayOf(str)), opt("role", str),
+	),
+	EventStatus:        statusSchema,
+	EventHubMessage:    object(opt("message", anyValue), opt("format", str)),
+	EventBroadcastPlay: object(req("filename", str), opt("from", str), opt("timestamp", str), opt("self", boolean), opt("startAt", str), opt("gain", num)),
+	EventNowPlaying:    nowPlayingSchema,
+	// older hubs push bare log lines
+	EventLog:               oneOf(logEntrySchema, str),
+	EventError:             anyValue,
+	EventPeerFilesRequest:  object(req("requestId", str), opt("from", str), opt("path", str)),
+	EventPeerUploadRequest: object(req("requestId", str), opt("from", str), req("filename", str)),
+	EventAudioStream: object(
+		req("streamId", str), opt("from", str), opt("self", boolean), opt("seq", integer), opt("phase", str),
+		opt("format", object(opt("encoding", str), opt("rate", integer), opt("channels", integer))),
+		opt("base64", str),
+	),
+	EventTransferOffer: object(
+		req("transferId", str), opt("from", str), req("filename", str), opt("size", integer),
+		opt("contentType", str), req("token", str), opt("endpoints", arrayOf(str)),
+	),
+	EventTransferAnswer: object(
+		req("transferId", str), opt("from", str), req("accept", boolean), opt("endpoints", arrayOf(str)), opt("reason", str),
+	),
+	EventTransferCancel: object(
+		req("transferId", str), opt("from", str), opt("fallback", str), opt("filename", str), opt("reason", str),
+	),
+	EventKV:         kvSchema,
+	EventChat:       chatSchema,
+	EventChatTyping: object(req("channel", str), req("from", str)),
+	EventBroadcastImage: object(
+		req("filename", str), opt("caption", str), opt("contentType", str), opt("size", integer),
+		opt("from", str), opt("timestamp", str), opt("self", boolean),
+	),
+	EventCommandOutput: object(req("id", str), req("text", str)),
+	EventCommandDone:   object(req("id", str), opt("result", anyValue), opt("error", str), opt("cancelled", boolean)),
+	EventPeerControl: object(
+		req("operationId", str), req("peer", str), req("action", str), req("phase", str),
+		opt("message", str),
+	),
+	EventPeerConfig: peerConfigSchema,
+	// a deleted zone comes with its name only
+	EventBroadcastStop: object(opt("from", str), opt("timestamp", str), opt("self", boolean)),
+	EventZone:          object(req("name", str), opt("peers", arrayOf(str)), opt("deleted", boolean), opt("updatedBy", str), opt("updatedAt", str)),
+	EventClipboard:     object(req("text", str), opt("from", str), opt("timestamp", str), opt("self", boolean)),
+}
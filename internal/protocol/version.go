@@ -0,0 +1,221 @@
+package protocol
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Version is the socket protocol revision this client implements. Hubs
+// whose hello carries no version predate versioning and count as 0.
+const Version = 1
+
+// Capabilities a hub lists in its hello. Actions outside the original
+// set (status, command, play, broadcast, broadcast-play, upload) are only
+// sent to hubs that advertise them.
+const (
+	CapChunkedUpload = "chunked-upload"
+	// CapPlayback covers volume, pause, resume, stop and seek.
+	CapPlayback = "playback"
+	// CapNowPlaying means peers report what they play, with position and
+	// who started it, as now-playing events, and status lists it.
+	CapNowPlaying = "now-playing"
+	CapHash       = "hash"
+	CapPeerFiles  = "peer-files"
+	CapSubscribe  = "subscribe"
+	CapLogs       = "logs"
+	// CapIdempotency means a repeated idempotencyKey gets the first
+	// answer again instead of a second action.
+	CapIdempotency = "idempotency-keys"
+	// CapBinaryFrames means upload data may travel raw in binary frames
+	// once the socket uses length-prefixed framing.
+	CapBinaryFrames = "binary-frames"
+	// CapTags means the hub stores file tags shared by every client.
+	CapTags = "tags"
+	// CapDelete means files can be removed with a "delete" request.
+	CapDelete = "delete"
+	// CapStorage means the hub reports its storage use and quota, and
+	// refuses uploads past the quota with CodeQuotaExceeded.
+	CapStorage = "storage"
+	// CapBroadcastPlan means "broadcast-plan" lists who a broadcast or
+	// broadcast-play would reach without sending it.
+	CapBroadcastPlan = "broadcast-plan"
+	// CapAudit means "audit" returns the hub's record of who broadcast,
+	// uploaded, deleted or tagged what.
+	CapAudit = "audit"
+	// CapClipboard means "clipboard" shares text with every peer, which
+	// receive it as a clipboard event.
+	CapClipboard = "clipboard"
+	// CapKV means "kv-set", "kv-get" and "kv-watch" share key-value state
+	// between clients, with kv events for watched keys.
+	CapKV = "kv"
+	// CapChat means "chat" posts to a channel, "chat-history" returns a
+	// channel's recent messages and "chat-typing" tells the others someone
+	// is typing, as chat and chat-typing events.
+	CapChat = "chat"
+	// CapBroadcastImage means "broadcast-image" shows an uploaded image to
+	// every peer, which receive it as a broadcast-image event.
+	CapBroadcastImage = "broadcast-image"
+	// CapCommandStream means "command-start" runs a console command in the
+	// background, answering with its id at once; its output arrives as
+	// command-output events and its result as a command-done event, and
+	// "command-cancel" with that commandId stops it.
+	CapCommandStream = "command-stream"
+	// CapJobs means "jobs" lists the hub's pending and running work, such
+	// as started commands and chunked uploads, "job-cancel" stops a job
+	// and "job-priority" moves a waiting one up or down the queue.
+	CapJobs = "jobs"
+	// CapPeerPing means "peer-ping" relays a ping to a peer, optionally
+	// from another peer, and answers with whether it came back and how
+	// long the round trip took.
+	CapPeerPing = "peer-ping"
+	// CapPeerControl means "peer-restart" and "peer-update" ask a peer to
+	// restart, or to update itself and then restart. Each answers with an
+	// operationId at once; peer-control events with that id then report
+	// the phases: requested, updating, restarting, then done or failed.
+	CapPeerControl = "peer-control"
+	// CapPeerConfig means the hub stores settings for each peer: "peer-config"
+	// lists them, "peer-config-set" changes one peer's and every client
+	// hears it as a peer-config event. A peer plays broadcast-play at its
+	// stored volume.
+	CapPeerConfig = "peer-config"
+	// CapZones means the hub stores named groups of peers: "zones" lists
+	// them, "zone-set" creates or replaces one, "zone-delete" removes one,
+	// and every client hears each change as a zone event. "broadcast",
+	// "broadcast-play" and "broadcast-plan" take an optional zone and then
+	// reach only its peers.
+	CapZones = "zones"
+	// CapSyncPlay means peers start a synchronized broadcast-play
+	// together: "clock" answers the hub's time, from which a client
+	// measures its clock offset, and "broadcast-play" with sync set answers
+	// with a startAt a moment ahead, at which every peer begins. Its
+	// broadcast-play events carry the same startAt.
+	CapSyncPlay = "sync-play"
+	// CapBroadcastStop means "broadcast-stop" silences every peer, ending
+	// any loop, and each hears it as a broadcast-stop event. "play" and
+	// "broadcast-play" then also take loop, repeating the file until
+	// stopped, since a loop is only safe once it can be ended.
+	CapBroadcastStop = "broadcast-stop"
+	// CapNormalize means the hub keeps the loudness uploaders measure and
+	// lists it with each file, and "play" and "broadcast-play" take
+	// normalize, which has each peer apply the file's ReplayGain so quiet
+	// and loud files play at about the same level. Its broadcast-play
+	// events then carry the gain, in dB.
+	CapNormalize = "normalize"
+	// CapStats means the hub counts broadcast-plays: "stats" lists each
+	// file played at least once with its play count and when it was last
+	// played.
+	CapStats = "stats"
+	// CapMove means "move" renames a stored file, keeping its tags and
+	// play count. It refuses to replace an existing file.
+	CapMove = "move"
+	// CapTrash means "delete" moves a file to the hub's trash instead of
+	// removing it: "trash" lists what is there, "restore" puts a file back
+	// under its old name and "purge" removes one, or all, for good.
+	CapTrash = "trash"
+	// CapAudioStream means "audio-stream" chunks from the intercom are
+	// relayed as they come to every peer, whose clients get them as
+	// audio-stream events.
+	CapAudioStream = "audio-stream"
+	// CapTemporary means "upload" and "upload-begin" take temporary with
+	// either ttlSeconds, after which the hub removes the file, or
+	// deleteOnDisconnect, which removes it when the uploading client
+	// disconnects. The answer carries expiresAt or deleteOnDisconnect, and
+	// listings show expiresAt.
+	CapTemporary = "temporary-uploads"
+	// CapDirectTransfer means the hub brokers direct transfers between
+	// peers: "transfer-offer" sends one peer an offer, answered with a
+	// transferId, and "transfer-answer" and "transfer-cancel" with that id
+	// reach the other side; each arrives as the event of the same name.
+	// A cancel with fallback "relay" names the file the sender uploaded
+	// instead, for the receiver to download.
+	CapDirectTransfer = "direct-transfer"
+)
+
+// MaxPeerVolume is the loudest stored peer volume, a percentage.
+const MaxPeerVolume = 100
+
+// MaxClipboardBytes bounds the text of one clipboard share.
+const MaxClipboardBytes = 64 << 10
+
+// Bounds on shared key-value state, in bytes.
+const (
+	MaxKVKeyBytes   = 256
+	MaxKVValueBytes = 16 << 10
+)
+
+// MaxChatBytes bounds the text of one chat message.
+const MaxChatBytes = 4 << 10
+
+// DefaultChatChannel is the channel of chat messages that name none.
+const DefaultChatChannel = "general"
+
+// Hello is the payload of the hello event sent when a client connects.
+type Hello struct {
+	Host         string   `json:"host"`
+	ConnectedAt  string   `json:"connectedAt,omitempty"`
+	Version      int      `json:"version,omitempty"`
+	Capabilities []string `json:"capabilities,omitempty"`
+	Protocols    []string `json:"protocols,omitempty"`
+	Codecs       []string `json:"codecs,omitempty"`
+	Role         Role     `json:"role,omitempty"`
+}
+
+// Has reports whether the hub advertised capability. A hub without a
+// capability list only supports the original actions.
+func (h *Hello) Has(capability string) bool {
+	for _, c := range h.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Speaks reports whether the hub listed protocol among the framings it
+// accepts.
+func (h *Hello) Speaks(protocol string) bool {
+	for _, p := range h.Protocols {
+		if p == protocol {
+			return true
+		}
+	}
+	return false
+}
+
+// HasCodec reports whether the hub can switch to codec. JSON always works.
+func (h *Hello) HasCodec(codec string) bool {
+	if codec == "" || codec == CodecJSON {
+		return true
+	}
+	for _, c := range h.Codecs {
+		if c == codec {
+			return true
+		}
+	}
+	return false
+}
+
+// Compatibility describes a version mismatch between the hub and this
+// client, or returns "" when they match.
+func (h *Hello) Compatibility() string {
+	switch {
+	case h.Version == Version:
+		return ""
+	case h.Version == 0:
+		return "hub predates protocol versioning; newer features are disabled"
+	case h.Version < Version:
+		return fmt.Sprintf("hub speaks protocol v%d, client v%d; features the hub does not advertise are disabled", h.Version, Version)
+	}
+	return fmt.Sprintf("hub speaks protocol v%d, newer than client v%d; consider updating the client", h.Version, Version)
+}
+
+func (h *Hello) String() string {
+	caps := "none"
+	if len(h.Capabilities) > 0 {
+		caps = strings.Join(h.Capabilities, ", ")
+	}
+	if h.Role != "" {
+		return fmt.Sprintf("protocol v%d, capabilities: %s, role: %s", h.Version, caps, h.Role)
+	}
+	return fmt.Sprintf("protocol v%d, capabilities: %s", h.Version, caps)
+}
@@ -0,0 +1,258 @@
+// Package script runs .brain files: one hub action or directive per line,
+// for repeatable demos and smoke tests.
+//
+//	# comments and blank lines are ignored
+//	status
+//	expect "connected":true
+//	play intro.mp3
+//	sleep 2s
+//	retry 3 1s broadcast-play chime.wav
+//	volume {"volume": 40, "broadcast": true}
+//	expect ok
+//
+// Any other first word is sent as that action, with the rest of the line
+// as its JSON payload. expect checks the previous step: "ok", "error"
+// optionally followed by text the error must contain, or text the JSON
+// response must contain.
+package script
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"brain/internal/hubclient"
+)
+
+// Step is one parsed line.
+type Step struct {
+	Line   int
+	Action string
+	// Rest is the unparsed text after Action.
+	Rest string
+	// Retries and Delay are set by a retry prefix.
+	Retries int
+	Delay   time.Duration
+}
+
+func (s Step) String() string {
+	if s.Rest == "" {
+		return s.Action
+	}
+	return s.Action + " " + s.Rest
+}
+
+// Parse reads a script, checking directive arguments up front so a typo
+// fails before anything is sent.
+func Parse(r io.Reader) ([]Step, error) {
+	var steps []Step
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		step := Step{Line: line}
+		word, rest := cut(text)
+		if word == "retry" {
+			countStr, after := cut(rest)
+			n, err := strconv.Atoi(countStr)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("line %d: retry needs a positive count", line)
+			}
+			step.Retries = n
+			if delayStr, after2 := cut(after); delayStr != "" {
+				if d, err := time.ParseDuration(delayStr); err == nil {
+					step.Delay = d
+					after = after2
+				}
+			}
+			word, rest = cut(after)
+			if word == "" || word == "sleep" || word == "expect" || word == "retry" {
+				return nil, fmt.Errorf("line %d: retry needs an action", line)
+			}
+		}
+		step.Action, step.Rest = word, rest
+		if err := check(step); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		steps = append(steps, step)
+	}
+	return steps, scanner.Err()
+}
+
+func cut(s string) (string, string) {
+	word, rest, _ := strings.Cut(strings.TrimSpace(s), " ")
+	return word, strings.TrimSpace(rest)
+}
+
+func check(s Step) error {
+	switch s.Action {
+	case "sleep":
+		if _, err := time.ParseDuration(s.Rest); err != nil {
+			return fmt.Errorf("sleep: %w", err)
+		}
+	case "expect":
+		if s.Rest == "" {
+			return errors.New("expect needs ok, error or text to match")
+		}
+	case "play", "broadcast-play", "broadcast", "command":
+		if s.Rest == "" {
+			return fmt.Errorf("%s needs an argument", s.Action)
+		}
+	default:
+		if strings.HasPrefix(s.Rest, "{") && !json.Valid([]byte(s.Rest)) {
+			return fmt.Errorf("%s: payload is not valid JSON", s.Action)
+		}
+	}
+	return nil
+}
+
+// Runner executes steps against a connected client.
+type Runner struct {
+	Client *hubclient.Client
+	// Out receives one line per step; nil discards it.
+	Out io.Writer
+
+	last    json.RawMessage
+	lastErr error
+}
+
+// Run executes steps in order and stops at the first failure.
+func (r *Runner) Run(ctx context.Context, steps []Step) error {
+	for i, step := range steps {
+		started := time.Now()
+		err := r.step(ctx, step)
+		if err != nil && i+1 < len(steps) && expectsError(steps[i+1]) {
+			r.printf("line %d: %s: failed as expected: %v\n", step.Line, step, err)
+			continue
+		}
+		if err != nil {
+			r.printf("line %d: %s: FAIL: %v\n", step.Line, step, err)
+			return fmt.Errorf("line %d: %s: %w", step.Line, step.Action, err)
+		}
+		r.printf("line %d: %s: ok (%s)\n", step.Line, step, time.Since(started).Round(time.Millisecond))
+	}
+	return nil
+}
+
+func (r *Runner) printf(format string, args ...any) {
+	if r.Out != nil {
+		fmt.Fprintf(r.Out, format, args...)
+	}
+}
+
+func (r *Runner) step(ctx context.Context, s Step) error {
+	switch s.Action {
+	case "sleep":
+		d, _ := time.ParseDuration(s.Rest)
+		return sleep(ctx, d)
+	case "expect":
+		return r.expect(s.Rest)
+	}
+	attempts := s.Retries
+	if attempts == 0 {
+		attempts = 1
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			r.printf("line %d: %s: retry %d/%d after %v\n", s.Line, s, i, attempts-1, err)
+			if err := sleep(ctx, s.Delay); err != nil {
+				return err
+			}
+		}
+		r.last, err = r.call(ctx, s)
+		r.lastErr = err
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+	}
+	return err
+}
+
+func expectsError(s Step) bool {
+	return s.Action == "expect" && (s.Rest == "error" || strings.HasPrefix(s.Rest, "error "))
+}
+
+func (r *Runner) call(ctx context.Context, s Step) (json.RawMessage, error) {
+	payload := map[string]any{}
+	switch s.Action {
+	case "play", "broadcast-play":
+		payload["filename"] = unquote(s.Rest)
+	case "broadcast":
+		payload["message"] = unquote(s.Rest)
+	case "command":
+		payload["command"] = unquote(s.Rest)
+	default:
+		if s.Rest != "" {
+			if err := json.Unmarshal([]byte(s.Rest), &payload); err != nil {
+				return nil, fmt.Errorf("payload: %w", err)
+			}
+		}
+	}
+	var res json.RawMessage
+	if err := r.Client.Call(ctx, s.Action, payload, &res); err != nil {
+		return nil, err
+	}
+	// compact so expect text does not depend on the hub's spacing
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, res); err != nil {
+		return res, nil
+	}
+	return compact.Bytes(), nil
+}
+
+func (r *Runner) expect(want string) error {
+	switch {
+	case want == "ok":
+		return r.lastErr
+	case expectsError(Step{Action: "expect", Rest: want}):
+		if r.lastErr == nil {
+			return errors.New("expected an error, got ok")
+		}
+		text := unquote(strings.TrimSpace(strings.TrimPrefix(want, "error")))
+		if !strings.Contains(r.lastErr.Error(), text) {
+			return fmt.Errorf("expected error containing %q, got %v", text, r.lastErr)
+		}
+		return nil
+	}
+	if r.lastErr != nil {
+		return r.lastErr
+	}
+	text := unquote(want)
+	if !strings.Contains(string(r.last), text) {
+		return fmt.Errorf("response does not contain %q: %s", text, r.last)
+	}
+	return nil
+}
+
+// unquote accepts bare words or a Go-style double-quoted string.
+func unquote(s string) string {
+	if strings.HasPrefix(s, `"`) {
+		if u, err := strconv.Unquote(s); err == nil {
+			return u
+		}
+	}
+	return s
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,524 @@
+// Package syncdir keeps a local folder's audio files uploaded to a hub: it
+// watches the folder, uploads new and changed files once they stop
+// changing, and optionally deletes hub copies of files deleted locally.
+package syncdir
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"brain/internal/hubclient"
+	"brain/internal/protocol"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	DefaultSettle = 2 * time.Second
+	retryDelay    = 30 * time.Second
+	callTimeout   = 5 * time.Minute
+)
+
+// Config describes a synced folder.
+type Config struct {
+	// Dir is the local folder; files in its subfolders are synced too.
+	Dir string
+	// Folder is the hub folder files go under, "" for the top level.
+	Folder string
+	// MirrorDeletes deletes a file's hub copy when it is deleted locally,
+	// unless the hub copy changed since it was uploaded.
+	MirrorDeletes bool
+	// Settle is how long a file must go unchanged before it is uploaded;
+	// DefaultSettle when zero.
+	Settle time.Duration
+	// StateFile keeps what was last synced across restarts, so a file
+	// edited on both sides is told apart from one edited on one. "" keeps
+	// it in memory only.
+	StateFile string
+	// Client returns the hub connection; it may return nil while
+	// disconnected.
+	Client func() *hubclient.Client
+	// Upload sends the file at local to the hub as remote; nil uploads it
+	// in one request with Client().Upload.
+	Upload func(ctx context.Context, local, remote string) error
+	// OnChange is called from the syncer's goroutine after an entry
+	// changes.
+	OnChange func(Entry)
+	Logf     func(format string, args ...any)
+}
+
+// Status is where a file stands.
+type Status string
+
+const (
+	Uploading Status = "uploading"
+	Synced    Status = "synced"
+	Conflict  Status = "conflict"
+	Failed    Status = "error"
+	Deleted   Status = "deleted"
+)
+
+// Entry is one file in the folder. Path is relative to Config.Dir with
+// forward slashes; Remote is the hub file it is synced to. For a conflict
+// Remote is the copy the local file was uploaded as instead.
+type Entry struct {
+	Path   string
+	Remote string
+	Status Status
+	Detail string
+	Time   time.Time
+}
+
+// record is what was last synced for a file. HubMod is when the hub's
+// copy was stored, as its listing said right after the upload; hubs that
+// cannot hash files are only trusted to still hold that copy while their
+// listing shows the same size and time.
+type record struct {
+	Remote string    `json:"remote"`
+	Size   int64     `json:"size"`
+	Mod    time.Time `json:"modified"`
+	SHA256 string    `json:"sha256"`
+	HubMod time.Time `json:"hubModified,omitempty"`
+}
+
+// Syncer syncs one folder. Run may be called again after it returns.
+type Syncer struct {
+	cfg Config
+
+	mu      sync.Mutex
+	records map[string]record
+	entries map[string]Entry
+	rescan  chan struct{}
+}
+
+func New(cfg Config) *Syncer {
+	if cfg.Settle <= 0 {
+		cfg.Settle = DefaultSettle
+	}
+	if cfg.Logf == nil {
+		cfg.Logf = func(string, ...any) {}
+	}
+	if cfg.OnChange == nil {
+		cfg.OnChange = func(Entry) {}
+	}
+	s := &Syncer{cfg: cfg, records: make(map[string]record), entries: make(map[string]Entry), rescan: make(chan struct{}, 1)}
+	if cfg.Upload == nil {
+		s.cfg.Upload = s.uploadWhole
+	}
+	if cfg.StateFile != "" {
+		if data, err := os.ReadFile(cfg.StateFile); err == nil {
+			if err := json.Unmarshal(data, &s.records); err != nil {
+				cfg.Logf("sync: ignoring %s: %v", cfg.StateFile, err)
+				s.records = make(map[string]record)
+			}
+		}
+	}
+	for rel, rec := range s.records {
+		e := Entry{Path: rel, Remote: rec.Remote, Status: Synced, Time: rec.Mod}
+		if rec.Remote != s.remote(rel) {
+			e.Status = Conflict
+		}
+		s.entries[rel] = e
+	}
+	return s
+}
+
+// Entries lists every file the syncer knows of, by path.
+func (s *Syncer) Entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Entry, 0, len(s.entries))
+	for _, e := range s.entries {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+	return list
+}
+
+// SyncNow makes a running syncer look over the whole folder again, picking
+// up anything it could not send before.
+func (s *Syncer) SyncNow() {
+	select {
+	case s.rescan <- struct{}{}:
+	default:
+	}
+}
+
+// Run watches the folder and syncs it until ctx ends.
+func (s *Syncer) Run(ctx context.Context) error {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	if err := s.watchTree(w, s.cfg.Dir); err != nil {
+		return err
+	}
+	s.cfg.Logf("sync: watching %s", s.cfg.Dir)
+	// due holds each changed file and when it may be synced
+	due := make(map[string]time.Time)
+	s.scan(due, time.Now())
+	tick := time.NewTicker(s.cfg.Settle / 4)
+	defer tick.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.rescan:
+			s.scan(due, time.Now())
+		case ev, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			if ev.Has(fsnotify.Create) {
+				if info, err := os.Stat(ev.Name); err == nil && info.IsDir() {
+					if err := s.watchTree(w, ev.Name); err != nil {
+						s.cfg.Logf("sync: %v", err)
+					}
+					s.scanDir(ev.Name, due, time.Now().Add(s.cfg.Settle))
+					continue
+				}
+			}
+			if rel, ok := s.rel(ev.Name); ok {
+				due[rel] = time.Now().Add(s.cfg.Settle)
+			} else if ev.Has(fsnotify.Remove) || ev.Has(fsnotify.Rename) {
+				// a folder may have gone with files under it
+				s.mu.Lock()
+				for rel := range s.records {
+					if strings.HasPrefix(filepath.Join(s.cfg.Dir, filepath.FromSlash(rel)), ev.Name+string(filepath.Separator)) {
+						due[rel] = time.Now().Add(s.cfg.Settle)
+					}
+				}
+				s.mu.Unlock()
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			s.cfg.Logf("sync: watch error: %v", err)
+		case now := <-tick.C:
+			for rel, at := range due {
+				if ctx.Err() != nil {
+					return nil
+				}
+				if now.Before(at) {
+					continue
+				}
+				delete(due, rel)
+				if err := s.syncFile(ctx, rel); err != nil {
+					if ctx.Err() != nil {
+						return nil
+					}
+					s.set(Entry{Path: rel, Remote: s.remote(rel), Status: Failed, Detail: protocol.Friendly(err)})
+					s.cfg.Logf("sync: %s: %v", rel, err)
+					due[rel] = now.Add(retryDelay)
+				}
+			}
+		}
+	}
+}
+
+func (s *Syncer) watchTree(w *fsnotify.Watcher, root string) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != root && hidden(d.Name()) {
+				return filepath.SkipDir
+			}
+			if err := w.Add(p); err != nil {
+				return fmt.Errorf("watch %s: %w", p, err)
+			}
+		}
+		return nil
+	})
+}
+
+// scan queues every file in the folder, and every synced file no longer
+// in it.
+func (s *Syncer) scan(due map[string]time.Time, at time.Time) {
+	s.scanDir(s.cfg.Dir, due, at)
+	s.mu.Lock()
+	for rel := range s.records {
+		if _, err := os.Stat(filepath.Join(s.cfg.Dir, filepath.FromSlash(rel))); errors.Is(err, fs.ErrNotExist) {
+			due[rel] = at
+		}
+	}
+	s.mu.Unlock()
+}
+
+func (s *Syncer) scanDir(dir string, due map[string]time.Time, at time.Time) {
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p != dir && hidden(d.Name()) {
+			return filepath.SkipDir
+		}
+		if rel, ok := s.rel(p); ok && d.Type().IsRegular() {
+			due[rel] = at
+		}
+		return nil
+	})
+	if err != nil {
+		s.cfg.Logf("sync: scan %s: %v", dir, err)
+	}
+}
+
+// rel is p relative to the folder, if p names a file worth syncing.
+func (s *Syncer) rel(p string) (string, bool) {
+	rel, err := filepath.Rel(s.cfg.Dir, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", false
+	}
+	for _, part := range strings.Split(rel, string(filepath.Separator)) {
+		if hidden(part) {
+			return "", false
+		}
+	}
+	if !strings.HasPrefix(hubclient.ContentType(rel), "audio/") {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// hidden leaves out dot files and editors' and downloaders' partial files.
+func hidden(name string) bool {
+	return strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") || strings.HasSuffix(name, ".part")
+}
+
+func (s *Syncer) remote(rel string) string {
+	if s.cfg.Folder == "" {
+		return rel
+	}
+	return path.Join(s.cfg.Folder, rel)
+}
+
+func (s *Syncer) set(e Entry) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	s.mu.Lock()
+	s.entries[e.Path] = e
+	s.mu.Unlock()
+	s.cfg.OnChange(e)
+}
+
+func (s *Syncer) record(rel string, rec *record) {
+	s.mu.Lock()
+	if rec == nil {
+		delete(s.records, rel)
+	} else {
+		s.records[rel] = *rec
+	}
+	var data []byte
+	if s.cfg.StateFile != "" {
+		data, _ = json.MarshalIndent(s.records, "", "  ")
+	}
+	s.mu.Unlock()
+	if data != nil {
+		if err := os.WriteFile(s.cfg.StateFile, data, 0o600); err != nil {
+			s.cfg.Logf("sync: state save error: %v", err)
+		}
+	}
+}
+
+func (s *Syncer) client() (*hubclient.Client, error) {
+	if c := s.cfg.Client(); c != nil {
+		return c, nil
+	}
+	return nil, errors.New("not connected to a hub")
+}
+
+// syncFile brings the hub up to date with one file.
+func (s *Syncer) syncFile(ctx context.Context, rel string) error {
+	local := filepath.Join(s.cfg.Dir, filepath.FromSlash(rel))
+	s.mu.Lock()
+	rec, known := s.records[rel]
+	s.mu.Unlock()
+	info, err := os.Stat(local)
+	if errors.Is(err, fs.ErrNotExist) {
+		if !known {
+			return nil
+		}
+		return s.deleted(ctx, rel, rec)
+	}
+	if err != nil {
+		return err
+	}
+	if known && info.Size() == rec.Size && info.ModTime().Equal(rec.Mod) {
+		return nil
+	}
+	digest, err := fileSHA256(local)
+	if err != nil {
+		return err
+	}
+	now := &record{Remote: s.remote(rel), Size: info.Size(), Mod: info.ModTime(), SHA256: digest}
+	if known && digest == rec.SHA256 {
+		// touched, not changed
+		now.Remote = rec.Remote
+		s.record(rel, now)
+		return nil
+	}
+	c, err := s.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	hub, err := hubDigest(ctx, c, now.Remote, rec)
+	if err != nil {
+		return err
+	}
+	switch {
+	case hub == digest:
+		s.record(rel, now)
+		s.set(Entry{Path: rel, Remote: now.Remote, Status: Synced})
+		return nil
+	case hub != "" && (!known || hub != rec.SHA256):
+		// the hub holds a version this folder never had; keep both
+		now.Remote = conflictName(now.Remote, time.Now())
+	}
+	s.set(Entry{Path: rel, Remote: now.Remote, Status: Uploading})
+	if err := s.cfg.Upload(ctx, local, now.Remote); err != nil {
+		return err
+	}
+	if !c.Supports(protocol.CapHash) {
+		f, err := hubFile(ctx, c, now.Remote)
+		if err != nil {
+			return err
+		}
+		if f != nil {
+			now.HubMod = f.Modified
+		}
+	}
+	s.record(rel, now)
+	if now.Remote != s.remote(rel) {
+		s.cfg.Logf("sync: %s changed on the hub too; uploaded as %s", rel, now.Remote)
+		s.set(Entry{Path: rel, Remote: now.Remote, Status: Conflict, Detail: fmt.Sprintf("%s differs on the hub", s.remote(rel))})
+		return nil
+	}
+	s.cfg.Logf("sync: uploaded %s as %s", rel, now.Remote)
+	s.set(Entry{Path: rel, Remote: now.Remote, Status: Synced})
+	return nil
+}
+
+// deleted handles a synced file gone from the folder.
+func (s *Syncer) deleted(ctx context.Context, rel string, rec record) error {
+	if !s.cfg.MirrorDeletes {
+		s.record(rel, nil)
+		s.set(Entry{Path: rel, Remote: rec.Remote, Status: Deleted, Detail: "kept on the hub"})
+		return nil
+	}
+	c, err := s.client()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, callTimeout)
+	defer cancel()
+	hub, err := hubDigest(ctx, c, rec.Remote, rec)
+	if err != nil {
+		return err
+	}
+	detail := "deleted on the hub"
+	switch {
+	case hub == "":
+		detail = "already gone from the hub"
+	case hub != rec.SHA256:
+		detail = "kept on the hub, which has a newer version"
+	default:
+		if err := c.Delete(ctx, rec.Remote); err != nil && !errors.Is(err, protocol.ErrNotFound) {
+			return err
+		}
+		s.cfg.Logf("sync: deleted %s, gone from %s", rec.Remote, s.cfg.Dir)
+	}
+	s.record(rel, nil)
+	s.set(Entry{Path: rel, Remote: rec.Remote, Status: Deleted, Detail: detail})
+	return nil
+}
+
+// hubDigest is the SHA-256 of the hub's copy of name, or "" if it has none.
+// A hub that cannot hash files is taken to hold last's digest only while
+// its listing shows the size and time last recorded; any other copy counts
+// as changed on the hub, so it is neither overwritten nor deleted.
+func hubDigest(ctx context.Context, c *hubclient.Client, name string, last record) (string, error) {
+	if !c.Supports(protocol.CapHash) {
+		f, err := hubFile(ctx, c, name)
+		if err != nil || f == nil {
+			return "", err
+		}
+		if last.SHA256 != "" && f.Size == last.Size && f.Modified.Equal(last.HubMod) {
+			return last.SHA256, nil
+		}
+		return "unknown", nil
+	}
+	res, err := c.Hash(ctx, name)
+	if errors.Is(err, protocol.ErrNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return res.SHA256, nil
+}
+
+// hubFile is name in the hub's listing, or nil if it has no such file.
+func hubFile(ctx context.Context, c *hubclient.Client, name string) (*hubclient.HubFile, error) {
+	files, err := c.Files(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.Name == name {
+			return &f, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *Syncer) uploadWhole(ctx context.Context, local, remote string) error {
+	data, err := os.ReadFile(local)
+	if err != nil {
+		return err
+	}
+	c, err := s.client()
+	if err != nil {
+		return err
+	}
+	_, err = c.Upload(ctx, hubclient.UploadRequest{Filename: remote, Data: data, ContentType: hubclient.ContentType(remote)})
+	return err
+}
+
+// conflictName is where a local version goes when the hub's differs:
+// "dir/name (conflict 2006-01-02 150405).ext".
+func conflictName(name string, at time.Time) string {
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s (conflict %s)%s", strings.TrimSuffix(name, ext), at.Format("2006-01-02 150405"), ext)
+}
+
+func fileSHA256(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
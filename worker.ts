@@ -14,8 +14,37 @@ const randomRequestId = () =>
 
 type ClientCallback = {
     broadcast(message: unknown): Promise<void> | void;
+    // ping answers at once, or with its own ping of peer when one is named.
+    ping(peer?: string): unknown;
+    // control restarts this peer, updating it first for "update"; progress
+    // hears each phase until it goes down.
+    control(action: PeerAction, progress: PeerProgress): unknown;
 };
 
+type PeerAction = "restart" | "update";
+type PeerProgress = (phase: string, message?: string) => unknown;
+
+// A restarted peer that has not rejoined in PEER_RESTART_TIMEOUT_MS
+// counts as failed.
+const PEER_RESTART_TIMEOUT_MS = 60_000;
+
+// PeerPing is the answer to pingPeer.
+type PeerPing = {
+    peer: string;
+    from?: string;
+    reachable: boolean;
+    latencyMs?: number;
+    error?: string;
+};
+
+// A peer that has not answered a ping in PING_TIMEOUT_MS counts as
+// unreachable.
+const PING_TIMEOUT_MS = 5000;
+
+// A synchronized broadcast-play starts SYNC_PLAY_LEAD_MS after it is sent,
+// time enough for every peer to download the file first.
+const SYNC_PLAY_LEAD_MS = 2000;
+
 type ClientInfo = {
     id: string;
     joinedAt: string;
@@ -46,8 +75,14 @@ type PendingBenchmark = {
     results: BenchmarkResult[];
     resolve: (summary: BenchmarkSummary) => void;
     timeoutHandle: ReturnType<typeof setTimeout>;
+    // output streams each report to a caller that passed one.
+    output?: CommandOutput;
 };
 
+// CommandOutput receives a long-running command's progress, one line at a
+// time, while runCommand is still waiting on its result.
+type CommandOutput = (text: string) => unknown;
+
 type BenchmarkSummary = {
     command: "benchmark";
     requestId: string;
@@ -183,9 +218,260 @@ function isClientInfo(value: unknown): value is ClientInfo {
     );
 }
 
+// Audio metadata the uploading client read from the file's tags. R2 custom
+// metadata only holds strings, so numbers are stored as text and parsed
+// back when listing. Loudness, in LUFS, and ReplayGain, in dB, may be
+// negative.
+const AUDIO_NUMBER_FIELDS = ["duration", "bitrate"] as const;
+const AUDIO_SIGNED_FIELDS = ["loudness", "replayGain"] as const;
+const AUDIO_TEXT_FIELDS = ["title", "artist", "album"] as const;
+const AUDIO_TEXT_LIMIT = 256;
+
+function audioMetadataToCustom(metadata: unknown): Record<string, string> | undefined {
+    if (!metadata || typeof metadata !== "object" || Array.isArray(metadata)) return undefined;
+    const source = metadata as Record<string, unknown>;
+    const custom: Record<string, string> = {};
+    for (const key of AUDIO_NUMBER_FIELDS) {
+        const value = source[key];
+        if (typeof value === "number" && Number.isFinite(value) && value > 0) {
+            custom[key] = String(value);
+        }
+    }
+    for (const key of AUDIO_SIGNED_FIELDS) {
+        const value = source[key];
+        if (typeof value === "number" && Number.isFinite(value)) {
+            custom[key] = String(value);
+        }
+    }
+    for (const key of AUDIO_TEXT_FIELDS) {
+        const value = source[key];
+        if (typeof value === "string" && value.trim()) {
+            custom[key] = value.trim().slice(0, AUDIO_TEXT_LIMIT);
+        }
+    }
+    return Object.keys(custom).length > 0 ? custom : undefined;
+}
+
+// sha256Hex is the digest uploads answer with, so clients can tell what
+// was stored from what they sent.
+async function sha256Hex(bytes: Uint8Array): Promise<string> {
+    const digest = await crypto.subtle.digest("SHA-256", bytes);
+    return Array.from(new Uint8Array(digest), (b) => b.toString(16).padStart(2, "0")).join("");
+}
+
+function audioMetadataFromCustom(custom: Record<string, string> | undefined): Record<string, string | number> {
+    const out: Record<string, string | number> = {};
+    if (!custom) return out;
+    for (const key of AUDIO_NUMBER_FIELDS) {
+        const value = Number(custom[key]);
+        if (Number.isFinite(value) && value > 0) out[key] = value;
+    }
+    for (const key of AUDIO_SIGNED_FIELDS) {
+        if (custom[key] === undefined) continue;
+        const value = Number(custom[key]);
+        if (Number.isFinite(value)) out[key] = value;
+    }
+    for (const key of AUDIO_TEXT_FIELDS) {
+        if (custom[key]) out[key] = custom[key];
+    }
+    return out;
+}
+
+// Tags clients attach to audio files, kept in Durable Object storage as
+// one map from file name to its sorted tag list. "favorite" is the star.
+const AUDIO_TAGS_KEY = "audio:tags";
+// Who broadcast, uploaded, deleted or tagged what, oldest first, kept in
+// Durable Object storage and capped at AUDIT_LIMIT entries.
+const AUDIT_KEY = "audit:log";
+const AUDIT_LIMIT = 500;
+
+type AuditEntry = {
+    time: string;
+    actor: string;
+    action: string;
+    target?: string;
+};
+// Shared key-value state for clients and scripts ("house mode", volume
+// presets), each key kept in Durable Object storage under KV_PREFIX.
+const KV_PREFIX = "kv:";
+const KV_KEY_LIMIT = 256;
+const KV_VALUE_LIMIT = 16 * 1024;
+
+type KvEntry = {
+    key: string;
+    value?: string;
+    by: string;
+    updatedAt: string;
+    expiresAt?: string;
+    deleted?: boolean;
+};
+// Chat between clients, each channel's latest CHAT_LIMIT messages kept in
+// Durable Object storage under CHAT_PREFIX.
+const CHAT_PREFIX = "chat:";
+const CHAT_LIMIT = 200;
+const CHAT_TEXT_LIMIT = 4 * 1024;
+const CHAT_CHANNEL_LIMIT = 64;
+
+type ChatMessage = {
+    id: string;
+    channel: string;
+    from: string;
+    text: string;
+    time: string;
+};
+// Settings for each peer, such as the volume it plays broadcasts at, kept
+// in Durable Object storage as one map from peer id to its settings.
+const PEER_CONFIG_KEY = "peer:config";
+const MAX_PEER_VOLUME = 100;
+
+type PeerConfig = {
+    peer: string;
+    volume?: number;
+    updatedBy: string;
+    updatedAt: string;
+};
+// Named groups of peers that broadcasts can be limited to, kept as one map
+// from zone name to the zone.
+const ZONES_KEY = "peer:zones";
+
+type Zone = {
+    name: string;
+    peers: string[];
+    updatedBy: string;
+    updatedAt: string;
+};
+// How often each audio file was broadcast-played and when last, kept as
+// one map from file name to its stats.
+const PLAY_STATS_KEY = "audio:plays";
+
+type PlayStats = {
+    name: string;
+    plays: number;
+    lastPlayed: string;
+};
+// Deleted files stay in the bucket under TRASH_PREFIX until restored or
+// purged; what they had when deleted is kept as one map from old name to
+// the entry.
+const TRASH_KEY = "audio:trash";
+const TRASH_PREFIX = ".trash/";
+
+type TrashEntry = {
+    name: string;
+    size: number;
+    contentType?: string;
+    deletedAt: string;
+    deletedBy: string;
+    tags?: string[];
+    plays?: PlayStats;
+};
+const AUDIO_TAG_LIMIT = 64;
+const AUDIO_TAGS_PER_FILE = 32;
+
+function normalizeAudioTags(value: unknown): string[] {
+    if (!Array.isArray(value)) return [];
+    const tags = new Set<string>();
+    for (const item of value) {
+        if (typeof item !== "string") continue;
+        const tag = item.trim().slice(0, AUDIO_TAG_LIMIT);
+        if (tag) tags.add(tag);
+        if (tags.size >= AUDIO_TAGS_PER_FILE) break;
+    }
+    return [...tags].sort();
+}
+
+// Storage quota in bytes, from the STORAGE_QUOTA_BYTES variable; unset or
+// zero means none. Every stored file counts against it.
+function storageQuota(setting: string | undefined): number {
+    const quota = Number(setting);
+    return Number.isFinite(quota) && quota > 0 ? Math.floor(quota) : 0;
+}
+
+async function storageUsage(bucket: R2Bucket, quotaSetting: string | undefined) {
+    let used = 0;
+    let files = 0;
+    let cursor: string | undefined;
+    do {
+        // R2 lists at most 1000 objects a page
+        const page = await bucket.list({ cursor });
+        for (const obj of page.objects) {
+            used += obj.size;
+            files++;
+        }
+        cursor = page.truncated ? page.cursor : undefined;
+    } while (cursor);
+    return { total: used, used, quota: storageQuota(quotaSetting), files };
+}
+
+// renameObject moves an R2 object, which R2 cannot do itself: it copies
+// with the same metadata, then deletes. It returns the object's size and
+// content type, or null when from does not exist.
+async function renameObject(bucket: R2Bucket, from: string, to: string) {
+    const object = await bucket.get(from);
+    if (!object) return null;
+    await bucket.put(to, await object.arrayBuffer(), {
+        httpMetadata: object.httpMetadata,
+        customMetadata: object.customMetadata
+    });
+    await bucket.delete(from);
+    return { size: object.size, contentType: object.httpMetadata?.contentType };
+}
+
+// quotaError explains why storing size bytes as filename would go over the
+// quota, or is null when it fits. A file being replaced frees its space.
+async function quotaError(bucket: R2Bucket, quotaSetting: string | undefined, filename: string, size: number) {
+    if (!storageQuota(quotaSetting)) return null;
+    const usage = await storageUsage(bucket, quotaSetting);
+    const existing = await bucket.head(filename);
+    const after = usage.used - (existing?.size ?? 0) + size;
+    if (after <= usage.quota) return null;
+    return `storing ${filename} would use ${after} of ${usage.quota} bytes`;
+}
+
+// A temporary upload carries, in its custom metadata, expiresAt when it
+// has a TTL or owner, the id of the client whose leaving removes it.
+// Expired files are hidden at once and swept by the scheduled handler.
+const TEMPORARY_TTL_LIMIT = 7 * 24 * 60 * 60;
+
+function temporaryCustom(ttlSeconds: unknown, owner: unknown): Record<string, string> | undefined {
+    if (typeof ttlSeconds === "number" && Number.isFinite(ttlSeconds) && ttlSeconds > 0) {
+        const seconds = Math.min(Math.floor(ttlSeconds), TEMPORARY_TTL_LIMIT);
+        return { expiresAt: new Date(Date.now() + seconds * 1000).toISOString() };
+    }
+    if (typeof owner === "string" && owner) return { owner };
+    return undefined;
+}
+
+function isExpired(custom: Record<string, string> | undefined, now = Date.now()): boolean {
+    return !!custom?.expiresAt && Date.parse(custom.expiresAt) <= now;
+}
+
+// sweepTemporary deletes the files whose custom metadata matches gone and
+// returns their names.
+async function sweepTemporary(bucket: R2Bucket, gone: (custom: Record<string, string>) => boolean) {
+    const removed: string[] = [];
+    let cursor: string | undefined;
+    do {
+        const page = await bucket.list({ cursor, include: ["customMetadata"] });
+        for (const obj of page.objects) {
+            if (obj.customMetadata && gone(obj.customMetadata)) {
+                await bucket.delete(obj.key);
+                removed.push(obj.key);
+            }
+        }
+        cursor = page.truncated ? page.cursor : undefined;
+    } while (cursor);
+    return removed;
+}
+
+// TRANSFER_BROKER_MS is how long the hub relays answers and cancels for
+// one direct transfer: long enough for the receiver to decide and the
+// sender to fall back to uploading a large file.
+const TRANSFER_BROKER_MS = 60 * 60_000;
+
 type Env = {
     RPC_HUB: DurableObjectNamespace;
     AUDIO_BUCKET: R2Bucket;
+    STORAGE_QUOTA_BYTES?: string;
 };
 
 class HubApi extends RpcTarget {
@@ -204,11 +490,25 @@ class HubApi extends RpcTarget {
         "benchmark",
         "broadcast",
         "audio",
+        "tags",
         "mapreduce",
+        "audit",
+        "kv",
+        "chat",
+        "peer-config",
+        "zone",
+        "stats",
+        "trash",
     ] as const;
     private state?: DurableObjectState;
     private pendingBenchmarks = new Map<string, PendingBenchmark>();
     private pendingMapReduces = new Map<string, PendingMapReduce>();
+    // peers being restarted, by id, each waiting for its rejoin
+    private rejoinWaiters = new Map<string, () => void>();
+    // direct transfers being brokered, by transferId: the offering and
+    // the receiving peer. Only those two may answer or cancel one, and
+    // either leaving cancels it for the other.
+    private transfers = new Map<string, { from: string; to: string; timer: ReturnType<typeof setTimeout> }>();
 
     async addClient(stub: RpcStub<ClientCallback>, rawInfo: unknown) {
         if (!isClientInfo(rawInfo)) {
@@ -225,6 +525,7 @@ class HubApi extends RpcTarget {
         });
         this.clients.push(record);
         console.log(`Registered client; total clients: ${this.clients.length}`);
+        this.rejoinWaiters.get(info.id)?.();
 
         try {
             await dup.broadcast({
@@ -282,10 +583,144 @@ class HubApi extends RpcTarget {
             }).catch((error) => console.error("Failed to broadcast leave", error));
             this.handleBenchmarkDeparture(record.info.id);
             this.handleMapReduceDeparture(record.info.id);
+            this.handleTransferDeparture(record.info.id);
+            const owner = record.info.id;
+            sweepTemporary((this as any).env.AUDIO_BUCKET, (custom) => custom.owner === owner)
+                .then((removed) => {
+                    if (removed.length > 0) console.log(`Removed ${removed.length} temporary uploads of ${owner}`);
+                })
+                .catch((error) => console.error("Failed to remove temporary uploads", error));
         }
         console.log(`Remaining clients: ${this.clients.length}`);
     }
 
+    // clock is the hub's time, which peers measure their clock offset
+    // against so they can start synchronized playback together.
+    clock(): number {
+        return Date.now();
+    }
+
+    // syncStart is when a synchronized broadcast-play sent now should
+    // start, in hub time.
+    syncStart(): number {
+        return Date.now() + SYNC_PLAY_LEAD_MS;
+    }
+
+    // transferOffer relays a direct transfer offer from one peer to
+    // another and starts brokering it. The two then exchange endpoints
+    // through transferSignal and stream between themselves; the hub never
+    // sees the file unless the sender falls back to uploading it.
+    async transferOffer(from: string, to: string, offer: Record<string, unknown>) {
+        if (from === to) {
+            return { error: "cannot send a transfer to yourself", code: "invalid" };
+        }
+        if (!this.clients.some((client) => client.info.id === to)) {
+            return { error: `${to} is not connected`, code: "not-found" };
+        }
+        const transferId = randomRequestId();
+        const timer = setTimeout(() => this.transfers.delete(transferId), TRANSFER_BROKER_MS);
+        this.transfers.set(transferId, { from, to, timer });
+        await this.broadcast({ ...offer, type: "transfer-offer", transferId, from }, [to]);
+        return { transferId };
+    }
+
+    // transferSignal passes a transfer-answer, which only the receiver
+    // sends, or a transfer-cancel from either side to the other peer. A
+    // cancel ends the brokering.
+    async transferSignal(kind: string, from: string, transferId: string, fields: Record<string, unknown>) {
+        const transfer = this.transfers.get(transferId);
+        if (!transfer || (from !== transfer.from && from !== transfer.to)) {
+            return { error: `unknown transfer ${transferId}`, code: "not-found" };
+        }
+        if (kind !== "transfer-answer" && kind !== "transfer-cancel") {
+            return { error: `unknown transfer signal ${kind}`, code: "invalid" };
+        }
+        if (kind === "transfer-answer" && from !== transfer.to) {
+            return { error: "only the receiving peer answers a transfer", code: "forbidden" };
+        }
+        if (kind === "transfer-cancel") {
+            clearTimeout(transfer.timer);
+            this.transfers.delete(transferId);
+        }
+        const other = from === transfer.from ? transfer.to : transfer.from;
+        await this.broadcast({ ...fields, type: kind, transferId, from }, [other]);
+        return {};
+    }
+
+    private handleTransferDeparture(peer: string) {
+        for (const [transferId, transfer] of this.transfers) {
+            if (transfer.from !== peer && transfer.to !== peer) continue;
+            clearTimeout(transfer.timer);
+            this.transfers.delete(transferId);
+            const other = transfer.from === peer ? transfer.to : transfer.from;
+            this.broadcast({ type: "transfer-cancel", transferId, from: peer, reason: "peer left" }, [other])
+                .catch((error) => console.error("Failed to cancel transfer", error));
+        }
+    }
+
+    // pingPeer pings peer, or has from ping it so the answer covers that
+    // peer's own link; latencyMs is the round trip as the pinger saw it.
+    async pingPeer(peer: string, from?: string): Promise<PeerPing> {
+        const source = from ? this.clients.find((c) => c.info.id === from) : undefined;
+        if (from && !source) {
+            return { peer, from, reachable: false, error: `${from} is not connected` };
+        }
+        const target = source ?? this.clients.find((c) => c.info.id === peer);
+        if (!target) {
+            return { peer, reachable: false, error: `${peer} is not connected` };
+        }
+        const started = Date.now();
+        let timer: ReturnType<typeof setTimeout> | undefined;
+        try {
+            const answer = await Promise.race([
+                source ? source.stub.ping(peer) : target.stub.ping(),
+                new Promise<never>((_, reject) => {
+                    timer = setTimeout(() => reject(new Error(`no answer in ${PING_TIMEOUT_MS} ms`)), PING_TIMEOUT_MS);
+                }),
+            ]);
+            if (source) {
+                return { ...(answer as PeerPing), peer, from };
+            }
+            return { peer, reachable: true, latencyMs: Date.now() - started };
+        } catch (error) {
+            const message = error instanceof Error ? error.message : String(error);
+            return { peer, ...(from && { from }), reachable: false, error: source ? `${from}: ${message}` : message };
+        } finally {
+            clearTimeout(timer);
+        }
+    }
+
+    // controlPeer restarts or updates peer for from, resolving once it has
+    // rejoined under the same id; progress hears the phases on the way.
+    async controlPeer(peer: string, action: PeerAction, from: string, progress: PeerProgress) {
+        if (action !== "restart" && action !== "update") {
+            throw new TypeError(`unknown peer action ${action}`);
+        }
+        const target = this.clients.find((c) => c.info.id === peer);
+        if (!target) {
+            throw new Error(`${peer} is not connected`);
+        }
+        if (this.rejoinWaiters.has(peer)) {
+            throw new Error(`${peer} is already restarting`);
+        }
+        await this.recordAudit(from, `peer-${action}`, peer);
+        let timer: ReturnType<typeof setTimeout> | undefined;
+        const back = new Promise<boolean>((resolve) => {
+            timer = setTimeout(() => resolve(false), PEER_RESTART_TIMEOUT_MS);
+            this.rejoinWaiters.set(peer, () => resolve(true));
+        });
+        try {
+            await target.stub.control(action, progress);
+            await progress("restarting");
+            if (!(await back)) {
+                throw new Error(`${peer} did not rejoin within ${PEER_RESTART_TIMEOUT_MS / 1000} s`);
+            }
+        } finally {
+            clearTimeout(timer);
+            this.rejoinWaiters.delete(peer);
+        }
+    }
+
     private resolveBenchmark(requestId: string, message?: string) {
         const pending = this.pendingBenchmarks.get(requestId);
         if (!pending) {
@@ -321,13 +756,15 @@ class HubApi extends RpcTarget {
         }
     }
 
-    async broadcast(message: unknown) {
-        if (this.clients.length === 0) {
+    // broadcast sends message to every client, or only to the ids in to.
+    async broadcast(message: unknown, to?: string[]) {
+        await this.auditBroadcast(message);
+        const snapshot = to ? this.clients.filter((client) => to.includes(client.info.id)) : [...this.clients];
+        if (snapshot.length === 0) {
             return 0;
         }
 
-        console.log(`Broadcasting to ${this.clients.length} client(s)`);
-        const snapshot = [...this.clients];
+        console.log(`Broadcasting to ${snapshot.length} client(s)`);
         await Promise.all(
             snapshot.map(async ({ stub }) => {
                 try {
@@ -344,7 +781,7 @@ class HubApi extends RpcTarget {
                 }
             }),
         );
-        return this.clients.length;
+        return snapshot.length;
     }
 
     async uploadAudioBase64(filename: string, base64Data: string, contentTypeHint?: string) {
@@ -381,6 +818,11 @@ class HubApi extends RpcTarget {
                 ? 'audio/ogg'
                 : 'application/octet-stream');
 
+        const overQuota = await quotaError((this as any).env.AUDIO_BUCKET, (this as any).env.STORAGE_QUOTA_BYTES, filename, bytes.length);
+        if (overQuota) {
+            throw new Error(`quota exceeded: ${overQuota}`);
+        }
+
         await (this as any).env.AUDIO_BUCKET.put(filename, bytes, {
             httpMetadata: {
                 contentType,
@@ -396,7 +838,7 @@ class HubApi extends RpcTarget {
         };
     }
 
-    async runCommand(command: string, clientId?: string) {
+    async runCommand(command: string, clientId?: string, output?: CommandOutput) {
         const parts = command.trim().split(/\s+/);
         const cmd = parts[0].toLowerCase();
         
@@ -753,6 +1195,12 @@ class HubApi extends RpcTarget {
                     }
 
                     pending.expected.delete(responderId);
+                    if (pending.output) {
+                        const line = `${responderId}: ${durationMs.toFixed(1)} ms (${pending.expected.size} still running)\n`;
+                        Promise.resolve(pending.output(line)).catch((error) => {
+                            console.error("Failed to stream benchmark output", error);
+                        });
+                    }
                     if (pending.expected.size === 0) {
                         this.resolveBenchmark(requestId);
                     }
@@ -823,6 +1271,7 @@ class HubApi extends RpcTarget {
                         results: [],
                         resolve,
                         timeoutHandle,
+                        output,
                     });
                 });
 
@@ -890,7 +1339,7 @@ class HubApi extends RpcTarget {
                 if (parts.length < 2) {
                     return {
                         command: "audio",
-                        error: "Usage: audio <list|get> [filename]",
+                        error: "Usage: audio <list|get|delete|move|usage> [filename]",
                         example: "audio list"
                     };
                 }
@@ -900,11 +1349,16 @@ class HubApi extends RpcTarget {
                 if (audioAction === "list") {
                     try {
                         // List objects in R2 bucket
-                        const objects = await (this as any).env.AUDIO_BUCKET.list();
-                        const files = objects.objects.map((obj: any) => ({
+                        const objects = await (this as any).env.AUDIO_BUCKET.list({ include: ["customMetadata", "httpMetadata"] });
+                        const tags = await this.readAudioTags();
+                        const files = objects.objects.filter((obj: any) => !obj.key.startsWith(TRASH_PREFIX) && !isExpired(obj.customMetadata)).map((obj: any) => ({
                             name: obj.key,
                             size: obj.size,
-                            uploaded: obj.uploaded.toISOString()
+                            uploaded: obj.uploaded.toISOString(),
+                            ...(obj.httpMetadata?.contentType && { contentType: obj.httpMetadata.contentType }),
+                            ...(obj.customMetadata?.expiresAt && { expiresAt: obj.customMetadata.expiresAt }),
+                            ...audioMetadataFromCustom(obj.customMetadata),
+                            ...(tags[obj.key] && { tags: tags[obj.key] })
                         }));
                         
                         return {
@@ -934,7 +1388,7 @@ class HubApi extends RpcTarget {
                         // Generate a signed URL for the audio file
                         const object = await (this as any).env.AUDIO_BUCKET.get(filename);
                         
-                        if (!object) {
+                        if (!object || isExpired(object.customMetadata)) {
                             return {
                                 command: "audio",
                                 action: "get",
@@ -953,6 +1407,7 @@ class HubApi extends RpcTarget {
                             key: filename,
                             size: object.size,
                             contentType: object.httpMetadata?.contentType,
+                            ...audioMetadataFromCustom(object.customMetadata),
                             exists: true,
                             message: "Audio file found. Use a media player to stream from R2."
                         };
@@ -962,6 +1417,136 @@ class HubApi extends RpcTarget {
                             error: `Failed to get audio file: ${error instanceof Error ? error.message : String(error)}`
                         };
                     }
+                } else if (audioAction === "usage") {
+                    try {
+                        const usage = await storageUsage((this as any).env.AUDIO_BUCKET, (this as any).env.STORAGE_QUOTA_BYTES);
+                        return { command: "audio", action: "usage", ...usage };
+                    } catch (error) {
+                        return {
+                            command: "audio",
+                            error: `Failed to measure storage: ${error instanceof Error ? error.message : String(error)}`
+                        };
+                    }
+                } else if (audioAction === "delete") {
+                    // the rest of the line, so names with spaces survive
+                    const filename = command.trim().replace(/^\S+\s+\S+\s*/, "");
+                    if (!filename) {
+                        return {
+                            command: "audio",
+                            error: "Usage: audio delete <filename>",
+                            example: "audio delete song.mp3"
+                        };
+                    }
+                    try {
+                        // deleting moves the file to the trash, which a second
+                        // delete of the same name overwrites
+                        const moved = filename.startsWith(TRASH_PREFIX)
+                            ? null
+                            : await renameObject((this as any).env.AUDIO_BUCKET, filename, TRASH_PREFIX + filename);
+                        if (!moved) {
+                            return { command: "audio", action: "delete", filename, error: "File not found" };
+                        }
+                        const entry: TrashEntry = {
+                            name: filename,
+                            size: moved.size,
+                            ...(moved.contentType && { contentType: moved.contentType }),
+                            deletedAt: new Date().toISOString(),
+                            deletedBy: clientId ?? ""
+                        };
+                        const tags = await this.readAudioTags();
+                        if (tags[filename]) {
+                            entry.tags = tags[filename];
+                            delete tags[filename];
+                            await this.state!.storage.put(AUDIO_TAGS_KEY, JSON.stringify(tags));
+                        }
+                        const stats = await this.readPlayStats();
+                        if (stats[filename]) {
+                            entry.plays = stats[filename];
+                            delete stats[filename];
+                            await this.state!.storage.put(PLAY_STATS_KEY, JSON.stringify(stats));
+                        }
+                        const trash = await this.readTrash();
+                        trash[filename] = entry;
+                        await this.state!.storage.put(TRASH_KEY, JSON.stringify(trash));
+                        await this.recordAudit(clientId ?? "", "delete", filename);
+                        return { command: "audio", action: "delete", filename, deleted: true, trashed: true };
+                    } catch (error) {
+                        return {
+                            command: "audio",
+                            error: `Failed to delete file: ${error instanceof Error ? error.message : String(error)}`
+                        };
+                    }
+                } else if (audioAction === "expire") {
+                    // removes a temporary upload for good, skipping the
+                    // trash; the client that made it runs this as its
+                    // uploader disconnects
+                    const filename = command.trim().replace(/^\S+\s+\S+\s*/, "");
+                    try {
+                        const bucket = (this as any).env.AUDIO_BUCKET;
+                        const object = filename ? await bucket.head(filename) : null;
+                        if (!object) {
+                            return { command: "audio", action: "expire", filename, error: "File not found", code: "not-found" };
+                        }
+                        if (!object.customMetadata?.owner && !object.customMetadata?.expiresAt) {
+                            return { command: "audio", action: "expire", filename, error: `${filename} is not temporary`, code: "invalid" };
+                        }
+                        await bucket.delete(filename);
+                        const tags = await this.readAudioTags();
+                        if (tags[filename]) {
+                            delete tags[filename];
+                            await this.state!.storage.put(AUDIO_TAGS_KEY, JSON.stringify(tags));
+                        }
+                        await this.recordAudit(clientId ?? "", "expire", filename);
+                        return { command: "audio", action: "expire", filename, expired: true };
+                    } catch (error) {
+                        return {
+                            command: "audio",
+                            error: `Failed to expire file: ${error instanceof Error ? error.message : String(error)}`
+                        };
+                    }
+                } else if (audioAction === "move") {
+                    // "audio move {"from": ..., "to": ...}"; JSON, as names may hold spaces
+                    try {
+                        const raw = command.trim().replace(/^\S+\s+\S+\s*/, "");
+                        const request = JSON.parse(raw || "{}") as { from?: unknown; to?: unknown };
+                        if (typeof request.from !== "string" || !request.from || typeof request.to !== "string" || !request.to) {
+                            return {
+                                command: "audio",
+                                error: "Usage: audio move {\"from\": <filename>, \"to\": <filename>}",
+                                example: 'audio move {"from":"song.mp3","to":"archive/song.mp3"}'
+                            };
+                        }
+                        const { from, to } = request;
+                        const bucket = (this as any).env.AUDIO_BUCKET;
+                        if (to.startsWith(TRASH_PREFIX)) {
+                            return { command: "audio", action: "move", filename: from, error: `${TRASH_PREFIX} is reserved for the trash`, code: "invalid" };
+                        }
+                        if (await bucket.head(to)) {
+                            return { command: "audio", action: "move", filename: from, error: `${to} already exists`, code: "invalid" };
+                        }
+                        if (from.startsWith(TRASH_PREFIX) || !(await renameObject(bucket, from, to))) {
+                            return { command: "audio", action: "move", filename: from, error: "File not found", code: "not-found" };
+                        }
+                        const tags = await this.readAudioTags();
+                        if (tags[from]) {
+                            tags[to] = tags[from];
+                            delete tags[from];
+                            await this.state!.storage.put(AUDIO_TAGS_KEY, JSON.stringify(tags));
+                        }
+                        const stats = await this.readPlayStats();
+                        if (stats[from]) {
+                            stats[to] = { ...stats[from], name: to };
+                            delete stats[from];
+                            await this.state!.storage.put(PLAY_STATS_KEY, JSON.stringify(stats));
+                        }
+                        await this.recordAudit(clientId ?? "", "move", `${from} → ${to}`);
+                        return { command: "audio", action: "move", filename: from, to, moved: true };
+                    } catch (error) {
+                        return {
+                            command: "audio",
+                            error: `Failed to move file: ${error instanceof Error ? error.message : String(error)}`
+                        };
+                    }
                 } else if (audioAction === "upload") {
                     if (parts.length < 4) {
                         return {
@@ -977,6 +1562,11 @@ class HubApi extends RpcTarget {
                     try {
                         // Decode base64 data
                         const fileData = Uint8Array.from(atob(base64Data), c => c.charCodeAt(0));
+                        const overQuota = await quotaError(
+                            (this as any).env.AUDIO_BUCKET, (this as any).env.STORAGE_QUOTA_BYTES, uploadFilename, fileData.length);
+                        if (overQuota) {
+                            return { command: "audio", error: overQuota, code: "quota-exceeded" };
+                        }
                         
                         // Upload to R2
                         await (this as any).env.AUDIO_BUCKET.put(uploadFilename, fileData, {
@@ -988,6 +1578,7 @@ class HubApi extends RpcTarget {
                             }
                         });
                         
+                        await this.recordAudit(clientId ?? "", "upload", uploadFilename);
                         return {
                             command: "audio",
                             action: "upload",
@@ -1002,6 +1593,323 @@ class HubApi extends RpcTarget {
                         };
                     }
                 }
+            case "tags": {
+                // "tags list", or "tags set {"filename": ..., "tags": [...]}";
+                // the JSON form keeps file names with spaces intact
+                const tagsAction = parts[1]?.toLowerCase();
+                try {
+                    const all = await this.readAudioTags();
+                    if (tagsAction === "list") {
+                        return { command: "tags", action: "list", tags: all };
+                    }
+                    if (tagsAction === "set") {
+                        const raw = command.trim().replace(/^\S+\s+\S+\s*/, "");
+                        const request = JSON.parse(raw) as { filename?: unknown; tags?: unknown };
+                        if (typeof request.filename !== "string" || !request.filename) {
+                            return { command: "tags", error: "filename is required" };
+                        }
+                        const tags = normalizeAudioTags(request.tags);
+                        if (tags.length > 0) {
+                            all[request.filename] = tags;
+                        } else {
+                            delete all[request.filename];
+                        }
+                        await this.state!.storage.put(AUDIO_TAGS_KEY, JSON.stringify(all));
+                        await this.recordAudit(clientId ?? "", "tags", request.filename);
+                        return { command: "tags", action: "set", filename: request.filename, tags: all };
+                    }
+                    return {
+                        command: "tags",
+                        error: "Usage: tags <list|set> [json]",
+                        example: 'tags set {"filename":"song.mp3","tags":["favorite"]}'
+                    };
+                } catch (error) {
+                    return {
+                        command: "tags",
+                        error: `Failed to update tags: ${error instanceof Error ? error.message : String(error)}`
+                    };
+                }
+            }
+            case "kv": {
+                // "kv set {"key": ..., "value": ..., "ttl": ...}", "kv delete {"key": ...}"
+                // or "kv get {"key": ...} | {"prefix": ...}"; JSON keeps spaces intact
+                const kvAction = parts[1]?.toLowerCase();
+                try {
+                    const raw = command.trim().replace(/^\S+\s+\S+\s*/, "");
+                    const request = (raw ? JSON.parse(raw) : {}) as { key?: unknown; value?: unknown; ttl?: unknown; prefix?: unknown };
+                    if (kvAction === "get") {
+                        if (typeof request.key === "string") {
+                            const entry = await this.readKv(request.key);
+                            return { command: "kv", action: "get", entries: entry ? [entry] : [] };
+                        }
+                        const prefix = typeof request.prefix === "string" ? request.prefix : "";
+                        return { command: "kv", action: "get", entries: await this.listKv(prefix) };
+                    }
+                    if (kvAction !== "set" && kvAction !== "delete") {
+                        return {
+                            command: "kv",
+                            error: "Usage: kv <get|set|delete> <json>",
+                            example: 'kv set {"key":"house/mode","value":"away"}'
+                        };
+                    }
+                    if (typeof request.key !== "string" || !request.key || request.key.length > KV_KEY_LIMIT) {
+                        return { command: "kv", error: `key is required and at most ${KV_KEY_LIMIT} characters` };
+                    }
+                    const entry: KvEntry = { key: request.key, by: clientId ?? "unknown", updatedAt: new Date().toISOString() };
+                    if (kvAction === "delete") {
+                        await this.state!.storage.delete(KV_PREFIX + request.key);
+                        entry.deleted = true;
+                    } else {
+                        if (typeof request.value !== "string" || request.value.length > KV_VALUE_LIMIT) {
+                            return { command: "kv", error: `value must be a string of at most ${KV_VALUE_LIMIT} characters` };
+                        }
+                        entry.value = request.value;
+                        const ttl = typeof request.ttl === "number" && request.ttl > 0 ? request.ttl : 0;
+                        if (ttl) {
+                            entry.expiresAt = new Date(Date.now() + ttl * 1000).toISOString();
+                        }
+                        await this.state!.storage.put(KV_PREFIX + request.key, JSON.stringify(entry));
+                    }
+                    await this.broadcast({ type: "kv-changed", entry });
+                    return { command: "kv", action: kvAction, entry };
+                } catch (error) {
+                    return {
+                        command: "kv",
+                        error: `Failed to update key-value state: ${error instanceof Error ? error.message : String(error)}`
+                    };
+                }
+            }
+            case "peer-config": {
+                // "peer-config get" or "peer-config set {"peer": ..., "volume": ...}"
+                const configAction = parts[1]?.toLowerCase() ?? "get";
+                try {
+                    const configs = await this.readPeerConfigs();
+                    if (configAction === "get") {
+                        return { command: "peer-config", action: "get", configs: Object.values(configs) };
+                    }
+                    if (configAction !== "set") {
+                        return {
+                            command: "peer-config",
+                            error: "Usage: peer-config <get|set> [json]",
+                            example: 'peer-config set {"peer":"<id>","volume":60}'
+                        };
+                    }
+                    const raw = command.trim().replace(/^\S+\s+\S+\s*/, "");
+                    const request = (raw ? JSON.parse(raw) : {}) as { peer?: unknown; volume?: unknown };
+                    if (typeof request.peer !== "string" || !request.peer) {
+                        return { command: "peer-config", error: "peer is required" };
+                    }
+                    const volume = request.volume;
+                    if (typeof volume !== "number" || !Number.isInteger(volume) || volume < 0 || volume > MAX_PEER_VOLUME) {
+                        return { command: "peer-config", error: `volume must be a whole number from 0 to ${MAX_PEER_VOLUME}` };
+                    }
+                    const config: PeerConfig = {
+                        ...configs[request.peer],
+                        peer: request.peer,
+                        volume,
+                        updatedBy: clientId ?? "unknown",
+                        updatedAt: new Date().toISOString(),
+                    };
+                    configs[request.peer] = config;
+                    await this.state!.storage.put(PEER_CONFIG_KEY, JSON.stringify(configs));
+                    await this.broadcast({ type: "peer-config-changed", config });
+                    return { command: "peer-config", action: "set", config };
+                } catch (error) {
+                    return {
+                        command: "peer-config",
+                        error: `Failed to update peer settings: ${error instanceof Error ? error.message : String(error)}`
+                    };
+                }
+            }
+            case "zone": {
+                // "zone list", "zone set {"name": ..., "peers": [...]}" or "zone delete {"name": ...}"
+                const zoneAction = parts[1]?.toLowerCase() ?? "list";
+                try {
+                    const zones = await this.readZones();
+                    if (zoneAction === "list") {
+                        return { command: "zone", action: "list", zones: Object.values(zones) };
+                    }
+                    const raw = command.trim().replace(/^\S+\s+\S+\s*/, "");
+                    const request = (raw ? JSON.parse(raw) : {}) as { name?: unknown; peers?: unknown };
+                    const name = typeof request.name === "string" ? request.name.trim() : "";
+                    if (!name) {
+                        return { command: "zone", error: "name is required" };
+                    }
+                    if (zoneAction === "delete") {
+                        const deleted = name in zones;
+                        if (deleted) {
+                            delete zones[name];
+                            await this.state!.storage.put(ZONES_KEY, JSON.stringify(zones));
+                            await this.broadcast({ type: "zone-changed", zone: { name, deleted: true } });
+                        }
+                        return { command: "zone", action: "delete", deleted };
+                    }
+                    if (zoneAction !== "set") {
+                        return {
+                            command: "zone",
+                            error: "Usage: zone <list|set|delete> [json]",
+                            example: 'zone set {"name":"downstairs","peers":["<id>"]}'
+                        };
+                    }
+                    if (!Array.isArray(request.peers) || request.peers.some((peer) => typeof peer !== "string" || !peer)) {
+                        return { command: "zone", error: "peers must be a list of peer ids" };
+                    }
+                    const zone: Zone = {
+                        name,
+                        peers: [...new Set(request.peers as string[])],
+                        updatedBy: clientId ?? "unknown",
+                        updatedAt: new Date().toISOString(),
+                    };
+                    zones[name] = zone;
+                    await this.state!.storage.put(ZONES_KEY, JSON.stringify(zones));
+                    await this.broadcast({ type: "zone-changed", zone });
+                    return { command: "zone", action: "set", zone };
+                } catch (error) {
+                    return {
+                        command: "zone",
+                        error: `Failed to update zones: ${error instanceof Error ? error.message : String(error)}`
+                    };
+                }
+            }
+            case "chat": {
+                // "chat send {"channel": ..., "text": ...}", "chat history {"channel": ..., "limit": ...}"
+                // or "chat typing {"channel": ...}"
+                const chatAction = parts[1]?.toLowerCase();
+                try {
+                    const raw = command.trim().replace(/^\S+\s+\S+\s*/, "");
+                    const request = (raw ? JSON.parse(raw) : {}) as { channel?: unknown; text?: unknown; limit?: unknown };
+                    const channel = typeof request.channel === "string" && request.channel.trim() ? request.channel.trim() : "general";
+                    if (channel.length > CHAT_CHANNEL_LIMIT) {
+                        return { command: "chat", error: `channel is at most ${CHAT_CHANNEL_LIMIT} characters` };
+                    }
+                    if (chatAction === "history") {
+                        const limit = typeof request.limit === "number" && request.limit > 0 ? request.limit : 50;
+                        const messages = await this.readChat(channel);
+                        return { command: "chat", action: "history", messages: messages.slice(-limit) };
+                    }
+                    if (chatAction === "typing") {
+                        await this.broadcast({ type: "chat-typing", channel, from: clientId ?? "unknown" });
+                        return { command: "chat", action: "typing" };
+                    }
+                    if (chatAction !== "send") {
+                        return {
+                            command: "chat",
+                            error: "Usage: chat <send|history|typing> <json>",
+                            example: 'chat send {"channel":"general","text":"lunch?"}'
+                        };
+                    }
+                    if (typeof request.text !== "string" || !request.text.trim() || request.text.length > CHAT_TEXT_LIMIT) {
+                        return { command: "chat", error: `text is required and at most ${CHAT_TEXT_LIMIT} characters` };
+                    }
+                    const message: ChatMessage = {
+                        id: randomRequestId(),
+                        channel,
+                        from: clientId ?? "unknown",
+                        text: request.text,
+                        time: new Date().toISOString(),
+                    };
+                    const messages = await this.readChat(channel);
+                    messages.push(message);
+                    await this.state!.storage.put(CHAT_PREFIX + channel, JSON.stringify(messages.slice(-CHAT_LIMIT)));
+                    await this.broadcast({ type: "chat", message });
+                    return { command: "chat", action: "send", message };
+                } catch (error) {
+                    return {
+                        command: "chat",
+                        error: `Failed to handle chat: ${error instanceof Error ? error.message : String(error)}`
+                    };
+                }
+            }
+            case "stats": {
+                // "stats": broadcast-play counts by file, most played first
+                try {
+                    const stats = Object.values(await this.readPlayStats());
+                    stats.sort((a, b) => b.plays - a.plays || a.name.localeCompare(b.name));
+                    return { command: "stats", files: stats };
+                } catch (error) {
+                    return {
+                        command: "stats",
+                        error: `Failed to read play counts: ${error instanceof Error ? error.message : String(error)}`
+                    };
+                }
+            }
+            case "trash": {
+                // "trash list", "trash restore <filename>" or "trash purge
+                // [filename]"; purge without a name empties the trash
+                const trashAction = parts[1]?.toLowerCase();
+                const filename = command.trim().replace(/^\S+\s+\S+\s*/, "");
+                try {
+                    const bucket = (this as any).env.AUDIO_BUCKET;
+                    const trash = await this.readTrash();
+                    if (trashAction === "list") {
+                        const files = Object.values(trash).map(({ tags, plays, ...file }) => file);
+                        files.sort((a, b) => b.deletedAt.localeCompare(a.deletedAt) || a.name.localeCompare(b.name));
+                        return { command: "trash", action: "list", files };
+                    }
+                    if (trashAction === "restore" && filename) {
+                        const entry = trash[filename];
+                        if (!entry) {
+                            return { command: "trash", error: `${filename} is not in the trash`, code: "not-found" };
+                        }
+                        if (await bucket.head(filename)) {
+                            return { command: "trash", error: `${filename} already exists`, code: "invalid" };
+                        }
+                        if (!(await renameObject(bucket, TRASH_PREFIX + filename, filename))) {
+                            return { command: "trash", error: `${filename} is not in the trash`, code: "not-found" };
+                        }
+                        delete trash[filename];
+                        await this.state!.storage.put(TRASH_KEY, JSON.stringify(trash));
+                        if (entry.tags) {
+                            const tags = await this.readAudioTags();
+                            tags[filename] = entry.tags;
+                            await this.state!.storage.put(AUDIO_TAGS_KEY, JSON.stringify(tags));
+                        }
+                        if (entry.plays) {
+                            const stats = await this.readPlayStats();
+                            stats[filename] = entry.plays;
+                            await this.state!.storage.put(PLAY_STATS_KEY, JSON.stringify(stats));
+                        }
+                        await this.recordAudit(clientId ?? "", "restore", filename);
+                        return { command: "trash", action: "restore", restored: filename };
+                    }
+                    if (trashAction === "purge") {
+                        const names = filename ? [filename] : Object.keys(trash);
+                        if (filename && !trash[filename]) {
+                            return { command: "trash", error: `${filename} is not in the trash`, code: "not-found" };
+                        }
+                        for (const name of names) {
+                            await bucket.delete(TRASH_PREFIX + name);
+                            delete trash[name];
+                        }
+                        await this.state!.storage.put(TRASH_KEY, JSON.stringify(trash));
+                        await this.recordAudit(clientId ?? "", "purge", filename || undefined);
+                        return { command: "trash", action: "purge", purged: names.length };
+                    }
+                    return {
+                        command: "trash",
+                        error: "Usage: trash <list|restore|purge> [filename]",
+                        example: "trash restore song.mp3"
+                    };
+                } catch (error) {
+                    return {
+                        command: "trash",
+                        error: `Failed to update the trash: ${error instanceof Error ? error.message : String(error)}`
+                    };
+                }
+            }
+            case "audit": {
+                // "audit [count]": the most recent entries, oldest first
+                const count = Number.parseInt(parts[1] ?? "100", 10);
+                try {
+                    const entries = await this.readAudit();
+                    return { command: "audit", entries: entries.slice(-(count > 0 ? count : 100)) };
+                } catch (error) {
+                    return {
+                        command: "audit",
+                        error: `Failed to read the audit trail: ${error instanceof Error ? error.message : String(error)}`
+                    };
+                }
+            }
             case "mapreduce":
                 return await this.handleMapReduceCommand(parts.slice(1), clientId);
             default:
@@ -1618,6 +2526,118 @@ class HubApi extends RpcTarget {
         };
     }
 
+    // recordAudit adds an entry to the audit trail. Clients call it for
+    // uploads that reach R2 over HTTP, which the hub does not see.
+    async recordAudit(actor: string, action: string, target?: string) {
+        if (!this.state) return;
+        const entries = await this.readAudit();
+        entries.push({ time: new Date().toISOString(), actor: actor || "unknown", action, ...(target && { target }) });
+        await this.state.storage.put(AUDIT_KEY, JSON.stringify(entries.slice(-AUDIT_LIMIT)));
+    }
+
+    private async auditBroadcast(message: unknown) {
+        if (!message || typeof message !== "object") return;
+        const m = message as { type?: unknown; from?: unknown; message?: unknown; filename?: unknown };
+        const from = typeof m.from === "string" ? m.from : "";
+        try {
+            if (m.type === "user-message" && typeof m.message === "string") {
+                await this.recordAudit(from, "broadcast", m.message);
+            } else if (m.type === "play-audio" && typeof m.filename === "string") {
+                await this.recordAudit(from, "broadcast-play", m.filename);
+                await this.countPlay(m.filename);
+            } else if (m.type === "show-image" && typeof m.filename === "string") {
+                await this.recordAudit(from, "broadcast-image", m.filename);
+            } else if (m.type === "stop-audio") {
+                await this.recordAudit(from, "broadcast-stop");
+            }
+        } catch (error) {
+            console.error("Failed to record audit entry", error);
+        }
+    }
+
+    private async readAudit(): Promise<AuditEntry[]> {
+        const raw = await this.state?.storage.get(AUDIT_KEY);
+        if (typeof raw !== "string") return [];
+        const parsed = JSON.parse(raw);
+        return Array.isArray(parsed) ? parsed : [];
+    }
+
+    // readKv returns the live entry for key, dropping it once expired.
+    private async readKv(key: string): Promise<KvEntry | null> {
+        const raw = await this.state?.storage.get(KV_PREFIX + key);
+        if (typeof raw !== "string") return null;
+        const entry = JSON.parse(raw) as KvEntry;
+        if (entry.expiresAt && Date.parse(entry.expiresAt) <= Date.now()) {
+            await this.state!.storage.delete(KV_PREFIX + key);
+            return null;
+        }
+        return entry;
+    }
+
+    private async listKv(prefix: string): Promise<KvEntry[]> {
+        const stored = await this.state!.storage.list({ prefix: KV_PREFIX + prefix, limit: 1000 });
+        const now = Date.now();
+        const entries: KvEntry[] = [];
+        for (const raw of stored.values()) {
+            if (typeof raw !== "string") continue;
+            const entry = JSON.parse(raw) as KvEntry;
+            if (!entry.expiresAt || Date.parse(entry.expiresAt) > now) entries.push(entry);
+        }
+        return entries;
+    }
+
+    private async readChat(channel: string): Promise<ChatMessage[]> {
+        const raw = await this.state?.storage.get(CHAT_PREFIX + channel);
+        if (typeof raw !== "string") return [];
+        const parsed = JSON.parse(raw);
+        return Array.isArray(parsed) ? parsed : [];
+    }
+
+    private async readAudioTags(): Promise<Record<string, string[]>> {
+        const raw = await this.state?.storage.get(AUDIO_TAGS_KEY);
+        if (typeof raw !== "string") return {};
+        const parsed = JSON.parse(raw);
+        return parsed && typeof parsed === "object" && !Array.isArray(parsed) ? parsed : {};
+    }
+
+    private async countPlay(filename: string) {
+        if (!this.state) return;
+        const stats = await this.readPlayStats();
+        const entry = stats[filename] ?? { name: filename, plays: 0, lastPlayed: "" };
+        entry.plays++;
+        entry.lastPlayed = new Date().toISOString();
+        stats[filename] = entry;
+        await this.state.storage.put(PLAY_STATS_KEY, JSON.stringify(stats));
+    }
+
+    private async readTrash(): Promise<Record<string, TrashEntry>> {
+        const raw = await this.state?.storage.get(TRASH_KEY);
+        if (typeof raw !== "string") return {};
+        const parsed = JSON.parse(raw);
+        return parsed && typeof parsed === "object" && !Array.isArray(parsed) ? parsed : {};
+    }
+
+    private async readPlayStats(): Promise<Record<string, PlayStats>> {
+        const raw = await this.state?.storage.get(PLAY_STATS_KEY);
+        if (typeof raw !== "string") return {};
+        const parsed = JSON.parse(raw);
+        return parsed && typeof parsed === "object" && !Array.isArray(parsed) ? parsed : {};
+    }
+
+    private async readPeerConfigs(): Promise<Record<string, PeerConfig>> {
+        const raw = await this.state?.storage.get(PEER_CONFIG_KEY);
+        if (typeof raw !== "string") return {};
+        const parsed = JSON.parse(raw);
+        return parsed && typeof parsed === "object" && !Array.isArray(parsed) ? parsed : {};
+    }
+
+    private async readZones(): Promise<Record<string, Zone>> {
+        const raw = await this.state?.storage.get(ZONES_KEY);
+        if (typeof raw !== "string") return {};
+        const parsed = JSON.parse(raw);
+        return parsed && typeof parsed === "object" && !Array.isArray(parsed) ? parsed : {};
+    }
+
     private listCommands() {
         return [...this.commands];
     }
@@ -1747,7 +2767,7 @@ export default {
             try {
                 const object = await env.AUDIO_BUCKET.get(filename);
                 
-                if (!object) {
+                if (!object || isExpired(object.customMetadata)) {
                     return new Response('Audio file not found', {
                         status: 404,
                         headers: {
@@ -1798,7 +2818,14 @@ export default {
                 });
             }
 
-            let payload: { filename?: string; base64?: string; contentType?: string };
+            let payload: {
+                filename?: string;
+                base64?: string;
+                contentType?: string;
+                metadata?: unknown;
+                ttlSeconds?: unknown;
+                owner?: unknown;
+            };
             try {
                 payload = await request.json();
             } catch (error) {
@@ -1814,7 +2841,8 @@ export default {
                 );
             }
 
-            const { filename, base64, contentType } = payload;
+            const { filename, base64, contentType, metadata, ttlSeconds, owner } = payload;
+            const temporary = temporaryCustom(ttlSeconds, owner);
 
             if (!filename || typeof filename !== 'string') {
                 return new Response(JSON.stringify({ error: 'filename is required' }), {
@@ -1852,14 +2880,33 @@ export default {
                         ? 'audio/mp4'
                         : 'application/octet-stream');
 
+                const overQuota = await quotaError(env.AUDIO_BUCKET, env.STORAGE_QUOTA_BYTES, filename, bytes.length);
+                if (overQuota) {
+                    return new Response(JSON.stringify({ error: overQuota, code: 'quota-exceeded' }), {
+                        status: 413,
+                        headers: {
+                            ...CORS_HEADERS,
+                            'Content-Type': 'application/json',
+                        },
+                    });
+                }
+
                 await env.AUDIO_BUCKET.put(filename, bytes, {
                     httpMetadata: {
                         contentType: inferredContentType,
                     },
+                    customMetadata: temporary ? { ...audioMetadataToCustom(metadata), ...temporary } : audioMetadataToCustom(metadata),
                 });
+                const sha256 = await sha256Hex(bytes);
 
                 return new Response(
-                    JSON.stringify({ filename, size: bytes.length, contentType: inferredContentType }),
+                    JSON.stringify({
+                        filename,
+                        size: bytes.length,
+                        contentType: inferredContentType,
+                        sha256,
+                        ...(temporary?.expiresAt && { expiresAt: temporary.expiresAt }),
+                    }),
                     {
                         status: 200,
                         headers: {
@@ -1899,4 +2946,11 @@ export default {
         
         return new Response('Not found', { status: 404 });
     },
+
+    // Runs on the cron in wrangler.jsonc and removes temporary uploads
+    // whose TTL has passed.
+    async scheduled(_controller: ScheduledController, env: Env): Promise<void> {
+        const removed = await sweepTemporary(env.AUDIO_BUCKET, (custom) => isExpired(custom));
+        if (removed.length > 0) console.log(`Expired ${removed.length} temporary uploads`);
+    },
 };